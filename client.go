@@ -23,6 +23,7 @@ import (
 	"github.com/bluenviron/gortsplib/v3/pkg/auth"
 	"github.com/bluenviron/gortsplib/v3/pkg/base"
 	"github.com/bluenviron/gortsplib/v3/pkg/bytecounter"
+	"github.com/bluenviron/gortsplib/v3/pkg/capture"
 	"github.com/bluenviron/gortsplib/v3/pkg/conn"
 	"github.com/bluenviron/gortsplib/v3/pkg/formats"
 	"github.com/bluenviron/gortsplib/v3/pkg/headers"
@@ -114,16 +115,38 @@ type announceReq struct {
 }
 
 type setupReq struct {
-	media    *media.Media
-	baseURL  *url.URL
-	rtpPort  int
-	rtcpPort int
-	res      chan clientRes
+	media     *media.Media
+	baseURL   *url.URL
+	transport *Transport
+	rtpPort   int
+	rtcpPort  int
+	res       chan clientRes
+}
+
+type setupAllReq struct {
+	medias  media.Medias
+	baseURL *url.URL
+	res     chan clientRes
 }
 
 type playReq struct {
-	ra  *headers.Range
-	res chan clientRes
+	opts *ClientPlayOptions
+	res  chan clientRes
+}
+
+// ClientPlayOptions contains the options of a PLAY request.
+type ClientPlayOptions struct {
+	// range to play.
+	// It defaults to the beginning of the stream, unless Scale or Speed
+	// are provided, in which case the stream continues from the current position.
+	Range *headers.Range
+
+	// ratio between the playback speed and the normal speed (optional).
+	// It can be used to request fast-forward (2, 4) or rewind (-1).
+	Scale *headers.Scale
+
+	// ratio between the delivery speed and the normal speed (optional).
+	Speed *headers.Speed
 }
 
 type recordReq struct {
@@ -159,6 +182,47 @@ func defaultLog(level LogLevel, format string, args ...interface{}) {
 	log.Printf(format, args...)
 }
 
+func defaultOnServerRequest(req *base.Request) *base.Response {
+	switch req.Method {
+	case base.Announce, base.Redirect, base.GetParameter, base.SetParameter, base.Options, base.Teardown:
+		return &base.Response{
+			StatusCode: base.StatusOK,
+		}
+	}
+
+	return &base.Response{
+		StatusCode: base.StatusNotImplemented,
+	}
+}
+
+func redirectLocation(req *base.Request) (*url.URL, error) {
+	loc, ok := req.Header["Location"]
+	if !ok || len(loc) != 1 {
+		return nil, fmt.Errorf("Location header is missing")
+	}
+
+	ru, err := url.Parse(loc[0])
+	if err != nil {
+		return nil, err
+	}
+
+	if ru.Scheme != "rtsp" && ru.Scheme != "rtsps" {
+		return nil, fmt.Errorf("unsupported scheme '%s'", ru.Scheme)
+	}
+
+	return ru, nil
+}
+
+// errClientRedirect is returned by the reader when the server sends a REDIRECT request.
+type errClientRedirect struct {
+	u *url.URL
+}
+
+// Error implements the error interface.
+func (errClientRedirect) Error() string {
+	return "redirected"
+}
+
 // Client is a RTSP client.
 type Client struct {
 	//
@@ -173,7 +237,8 @@ type Client struct {
 	// a TLS configuration to connect to TLS (RTSPS) servers.
 	// It defaults to nil.
 	TLSConfig *tls.Config
-	// disable being redirected to other servers, that can happen during Describe().
+	// disable being redirected to other servers, that can happen during Describe()
+	// or when the server sends a REDIRECT request.
 	// It defaults to false.
 	RedirectDisable bool
 	// enable communication with servers which don't provide server ports or use
@@ -182,13 +247,35 @@ type Client struct {
 	// It defaults to false.
 	AnyPortEnable bool
 	// transport protocol (UDP, Multicast or TCP).
-	// If nil, it is chosen automatically (first UDP, then, if it fails, TCP).
+	// If nil, it is chosen automatically among TransportPreference.
+	// If set to UDP or UDP-multicast, the protocol is never switched, and reading
+	// fails when no packets are received within InitialUDPReadTimeout.
 	// It defaults to nil.
 	Transport *Transport
-	// If the client is reading with UDP, it must receive
-	// at least a packet within this timeout, otherwise it switches to TCP.
+	// transport protocols that are tried in order when Transport is nil.
+	// It defaults to UDP, then TCP.
+	TransportPreference []Transport
+	// conditions that allow to switch to the next transport protocol of TransportPreference.
+	// It defaults to TransportFallbackAll.
+	TransportFallback TransportFallback
+	// If the client is reading with UDP or UDP-multicast, it must receive
+	// at least a packet within this timeout, otherwise it switches to the next
+	// transport protocol of TransportPreference.
+	// When switching is not possible, because Transport is set, TransportFallback
+	// doesn't contain TransportFallbackNoPackets or there are no other protocols,
+	// reading fails with ErrClientUDPTimeout.
 	// It defaults to 3 seconds.
 	InitialUDPReadTimeout time.Duration
+	// send requests without waiting for the responses of previous requests
+	// (pipelining), when possible. This reduces latency on high-latency links,
+	// since SetupAll() sends all SETUP requests at once, with the
+	// Pipelined-Requests header.
+	// Requests are pipelined only if the server advertises support for the
+	// Pipelined-Requests header, in the Public or Supported header of the OPTIONS
+	// response, or through the RTSP 2.0 "play.basic" feature tag. Otherwise,
+	// SETUP requests are sent one at a time.
+	// It defaults to false.
+	Pipelining bool
 	// read buffer count.
 	// If greater than 1, allows to pass buffers to routines different than the one
 	// that is reading frames.
@@ -198,6 +285,10 @@ type Client struct {
 	// It allows to queue packets before sending them.
 	// It defaults to 256.
 	WriteBufferCount int
+	// policy applied when the write queue is full,
+	// that happens when the server or the network is slower than the writer.
+	// It defaults to WriteQueuePolicyDropUntilKeyframe.
+	WriteQueuePolicy WriteQueuePolicy
 	// user agent header
 	// It defaults to "gortsplib"
 	UserAgent string
@@ -207,6 +298,14 @@ type Client struct {
 	BytesReceived *uint64
 	// pointer to a variable that stores sent bytes.
 	BytesSent *uint64
+	// pointer to a variable that stores packets that have not been sent
+	// because the write queue was full.
+	PacketsDropped *uint64
+	// writer of a capture of the session, that receives RTSP requests and responses,
+	// interleaved frames and UDP packets, in both directions.
+	// Writers of the pcapng and rtpdump formats are available in pkg/capture.
+	// It defaults to nil.
+	Capture capture.Writer
 
 	//
 	// system functions (all optional)
@@ -225,6 +324,15 @@ type Client struct {
 	OnRequest func(*base.Request)
 	// called after every response.
 	OnResponse func(*base.Response)
+	// called when the server sends a request (ANNOUNCE, REDIRECT, SET_PARAMETER, ...).
+	// It must return the response that is sent back to the server.
+	// When a REDIRECT request is answered with 200 OK, the client
+	// reconnects to the URL in the Location header, unless RedirectDisable is true.
+	// When a TEARDOWN request is answered with 200 OK, the client is closed
+	// with liberrors.ErrClientTornDown.
+	// It defaults to a function that answers ANNOUNCE, REDIRECT, GET_PARAMETER,
+	// SET_PARAMETER, OPTIONS and TEARDOWN with 200 OK, and other requests with 501 Not Implemented.
+	OnServerRequest func(*base.Request) *base.Response
 
 	//
 	// logging (all optional)
@@ -249,21 +357,30 @@ type Client struct {
 	state              clientState
 	nconn              net.Conn
 	conn               *conn.Conn
+	capture            *sessionCapture
 	session            string
+	sessionTimeout     time.Duration
 	sender             *auth.Sender
+	senderUser         string
+	senderPass         string
+	senderStaleRetried bool
 	cseq               int
 	optionsSent        bool
 	useGetParameter    bool
+	pipelinedRequests  bool
 	lastDescribeURL    *url.URL
+	lastDescribeMedias media.Medias
 	baseURL            *url.URL
 	effectiveTransport *Transport
 	medias             map[*media.Media]*clientMedia
+	mediasOrdered      []*clientMedia
 	tcpMediasByChannel map[int]*clientMedia
-	lastRange          *headers.Range
+	lastPlayOptions    ClientPlayOptions
 	checkStreamTimer   *time.Timer
 	checkStreamInitial bool
 	tcpLastFrameTime   *int64
 	keepaliveTimer     *time.Timer
+	redirectURL        *url.URL
 	closeError         error
 	writer             writer
 
@@ -274,11 +391,15 @@ type Client struct {
 	// reader channels
 	readerErr chan error
 
+	// writer channels
+	writeQueueFull chan struct{}
+
 	// in
 	options  chan optionsReq
 	describe chan describeReq
 	announce chan announceReq
 	setup    chan setupReq
+	setupAll chan setupAllReq
 	play     chan playReq
 	record   chan recordReq
 	pause    chan pauseReq
@@ -296,6 +417,15 @@ func (c *Client) Start(scheme string, host string) error {
 	if c.WriteTimeout == 0 {
 		c.WriteTimeout = 10 * time.Second
 	}
+	if c.TransportPreference == nil {
+		c.TransportPreference = []Transport{TransportUDP, TransportTCP}
+	}
+	if len(c.TransportPreference) == 0 {
+		return fmt.Errorf("TransportPreference must contain at least a transport protocol")
+	}
+	if c.TransportFallback == 0 {
+		c.TransportFallback = TransportFallbackAll
+	}
 	if c.InitialUDPReadTimeout == 0 {
 		c.InitialUDPReadTimeout = 3 * time.Second
 	}
@@ -317,6 +447,9 @@ func (c *Client) Start(scheme string, host string) error {
 	if c.BytesSent == nil {
 		c.BytesSent = new(uint64)
 	}
+	if c.PacketsDropped == nil {
+		c.PacketsDropped = new(uint64)
+	}
 
 	// system functions
 	if c.DialContext == nil {
@@ -335,6 +468,9 @@ func (c *Client) Start(scheme string, host string) error {
 		c.OnResponse = func(*base.Response) {
 		}
 	}
+	if c.OnServerRequest == nil {
+		c.OnServerRequest = defaultOnServerRequest
+	}
 
 	if c.Log == nil {
 		c.Log = defaultLog
@@ -366,10 +502,13 @@ func (c *Client) Start(scheme string, host string) error {
 	c.describe = make(chan describeReq)
 	c.announce = make(chan announceReq)
 	c.setup = make(chan setupReq)
+	c.setupAll = make(chan setupAllReq)
 	c.play = make(chan playReq)
 	c.record = make(chan recordReq)
 	c.pause = make(chan pauseReq)
+	c.writeQueueFull = make(chan struct{}, 1)
 	c.done = make(chan struct{})
+	c.writer.policy = c.WriteQueuePolicy
 
 	go c.run()
 
@@ -435,6 +574,16 @@ func (c *Client) run() {
 
 func (c *Client) runInner() error {
 	for {
+		if c.redirectURL != nil {
+			ru := c.redirectURL
+			c.redirectURL = nil
+
+			err := c.doRedirect(ru)
+			if err != nil {
+				return err
+			}
+		}
+
 		select {
 		case req := <-c.options:
 			res, err := c.doOptions(req.url)
@@ -449,11 +598,15 @@ func (c *Client) runInner() error {
 			req.res <- clientRes{res: res, err: err}
 
 		case req := <-c.setup:
-			res, err := c.doSetup(req.media, req.baseURL, req.rtpPort, req.rtcpPort)
+			res, err := c.doSetup(req.media, req.baseURL, req.transport, req.rtpPort, req.rtcpPort)
 			req.res <- clientRes{res: res, err: err}
 
+		case req := <-c.setupAll:
+			err := c.doSetupAll(req.medias, req.baseURL)
+			req.res <- clientRes{err: err}
+
 		case req := <-c.play:
-			res, err := c.doPlay(req.ra, false)
+			res, err := c.doPlay(req.opts, false)
 			req.res <- clientRes{res: res, err: err}
 
 		case req := <-c.record:
@@ -465,65 +618,11 @@ func (c *Client) runInner() error {
 			req.res <- clientRes{res: res, err: err}
 
 		case <-c.checkStreamTimer.C:
-			if *c.effectiveTransport == TransportUDP ||
-				*c.effectiveTransport == TransportUDPMulticast {
-				if c.checkStreamInitial {
-					c.checkStreamInitial = false
-
-					// check that at least one packet has been received
-					inTimeout := func() bool {
-						for _, ct := range c.medias {
-							lft := atomic.LoadInt64(ct.udpRTPListener.lastPacketTime)
-							if lft != 0 {
-								return false
-							}
-
-							lft = atomic.LoadInt64(ct.udpRTCPListener.lastPacketTime)
-							if lft != 0 {
-								return false
-							}
-						}
-						return true
-					}()
-					if inTimeout {
-						err := c.trySwitchingProtocol()
-						if err != nil {
-							return err
-						}
-					}
-				} else {
-					inTimeout := func() bool {
-						now := time.Now()
-						for _, ct := range c.medias {
-							lft := time.Unix(atomic.LoadInt64(ct.udpRTPListener.lastPacketTime), 0)
-							if now.Sub(lft) < c.ReadTimeout {
-								return false
-							}
-
-							lft = time.Unix(atomic.LoadInt64(ct.udpRTCPListener.lastPacketTime), 0)
-							if now.Sub(lft) < c.ReadTimeout {
-								return false
-							}
-						}
-						return true
-					}()
-					if inTimeout {
-						return liberrors.ErrClientUDPTimeout{}
-					}
-				}
-			} else { // TCP
-				inTimeout := func() bool {
-					now := time.Now()
-					lft := time.Unix(atomic.LoadInt64(c.tcpLastFrameTime), 0)
-					return now.Sub(lft) >= c.ReadTimeout
-				}()
-				if inTimeout {
-					return liberrors.ErrClientTCPTimeout{}
-				}
+			err := c.checkStream()
+			if err != nil {
+				return err
 			}
 
-			c.checkStreamTimer = time.NewTimer(c.checkStreamPeriod)
-
 		case <-c.keepaliveTimer.C:
 			_, err := c.do(&base.Request{
 				Method: func() base.Method {
@@ -540,10 +639,19 @@ func (c *Client) runInner() error {
 				return err
 			}
 
-			c.keepaliveTimer = time.NewTimer(c.keepalivePeriod)
+			c.keepaliveTimer = time.NewTimer(c.keepaliveInterval())
+
+		case <-c.writeQueueFull:
+			return liberrors.ErrClientWriteQueueFull{}
 
 		case err := <-c.readerErr:
 			c.readerErr = nil
+
+			if rerr, ok := err.(errClientRedirect); ok {
+				c.redirectURL = rerr.u
+				continue
+			}
+
 			return err
 
 		case <-c.ctx.Done():
@@ -552,6 +660,25 @@ func (c *Client) runInner() error {
 	}
 }
 
+func (c *Client) onWriteQueueFull(cm *clientMedia, isRTP bool) error {
+	atomic.AddUint64(c.PacketsDropped, 1)
+
+	switch c.WriteQueuePolicy {
+	case WriteQueuePolicyDisconnect:
+		select {
+		case c.writeQueueFull <- struct{}{}:
+		default:
+		}
+		return liberrors.ErrClientWriteQueueFull{}
+
+	default:
+		if !isRTP || cm.writeDropper.start() {
+			c.Log(LogLevelWarn, "write queue is full, discarding packets")
+		}
+		return nil
+	}
+}
+
 func (c *Client) doClose() {
 	if c.state != clientStatePlay && c.state != clientStateRecord && c.conn != nil {
 		c.connCloserStop()
@@ -584,16 +711,30 @@ func (c *Client) reset() {
 
 	c.state = clientStateInitial
 	c.session = ""
+	c.sessionTimeout = 0
 	c.sender = nil
+	c.senderStaleRetried = false
 	c.cseq = 0
 	c.optionsSent = false
 	c.useGetParameter = false
+	c.pipelinedRequests = false
 	c.baseURL = nil
 	c.effectiveTransport = nil
 	c.medias = nil
+	c.mediasOrdered = nil
 	c.tcpMediasByChannel = nil
 }
 
+// keepaliveInterval returns the interval between keepalives.
+// If the server advertised a session timeout, keepalives are sent
+// before the timeout expires.
+func (c *Client) keepaliveInterval() time.Duration {
+	if c.sessionTimeout > 0 {
+		return c.sessionTimeout * 8 / 10
+	}
+	return c.keepalivePeriod
+}
+
 func (c *Client) checkState(allowed map[clientState]struct{}) error {
 	if _, ok := allowed[c.state]; ok {
 		return nil
@@ -609,40 +750,192 @@ func (c *Client) checkState(allowed map[clientState]struct{}) error {
 	return liberrors.ErrClientInvalidState{AllowedList: allowedList, State: c.state}
 }
 
-func (c *Client) trySwitchingProtocol() error {
-	c.Log(LogLevelWarn, "no UDP packets received, switching to TCP")
+func (c *Client) usesTCP() bool {
+	for _, cm := range c.medias {
+		if cm.transport == TransportTCP {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Client) usesUDP() bool {
+	for _, cm := range c.medias {
+		if cm.transport != TransportTCP {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Client) hasAutomaticMedias() bool {
+	for _, cm := range c.medias {
+		if !cm.transportForced {
+			return true
+		}
+	}
+	return false
+}
 
+// nextTransport returns the transport protocol that follows cur in TransportPreference.
+func (c *Client) nextTransport(cur Transport) (Transport, bool) {
+	for i, tr := range c.TransportPreference {
+		if tr == cur {
+			if i == (len(c.TransportPreference) - 1) {
+				return 0, false
+			}
+			return c.TransportPreference[i+1], true
+		}
+	}
+	return 0, false
+}
+
+// transportFollows checks whether tr follows cur in TransportPreference.
+func (c *Client) transportFollows(cur Transport, tr Transport) bool {
+	for {
+		next, ok := c.nextTransport(cur)
+		if !ok {
+			return false
+		}
+		if next == tr {
+			return true
+		}
+		cur = next
+	}
+}
+
+func (c *Client) canFallback(cond TransportFallback) bool {
+	return c.Transport == nil &&
+		c.scheme != "rtsps" &&
+		(c.TransportFallback&cond) != 0
+}
+
+func (c *Client) checkStream() error {
+	if c.checkStreamInitial {
+		c.checkStreamInitial = false
+
+		// check that at least one packet has been received
+		inTimeout := func() bool {
+			for _, cm := range c.medias {
+				if cm.udpRTPListener == nil {
+					continue
+				}
+
+				lft := atomic.LoadInt64(cm.udpRTPListener.lastPacketTime)
+				if lft != 0 {
+					return false
+				}
+
+				lft = atomic.LoadInt64(cm.udpRTCPListener.lastPacketTime)
+				if lft != 0 {
+					return false
+				}
+			}
+			return true
+		}()
+		if inTimeout {
+			if c.effectiveTransport != nil &&
+				*c.effectiveTransport != TransportTCP &&
+				c.hasAutomaticMedias() &&
+				c.canFallback(TransportFallbackNoPackets) {
+				if next, ok := c.nextTransport(*c.effectiveTransport); ok {
+					c.Log(LogLevelWarn, "no UDP packets received, switching to %v", next)
+					return c.trySwitchingProtocol(next)
+				}
+			}
+
+			return liberrors.ErrClientUDPTimeout{}
+		}
+	} else {
+		now := time.Now()
+
+		if c.usesUDP() {
+			inTimeout := func() bool {
+				for _, cm := range c.medias {
+					if cm.udpRTPListener == nil {
+						continue
+					}
+
+					lft := time.Unix(atomic.LoadInt64(cm.udpRTPListener.lastPacketTime), 0)
+					if now.Sub(lft) < c.ReadTimeout {
+						return false
+					}
+
+					lft = time.Unix(atomic.LoadInt64(cm.udpRTCPListener.lastPacketTime), 0)
+					if now.Sub(lft) < c.ReadTimeout {
+						return false
+					}
+				}
+				return true
+			}()
+			if inTimeout {
+				return liberrors.ErrClientUDPTimeout{}
+			}
+		}
+
+		if c.usesTCP() {
+			lft := time.Unix(atomic.LoadInt64(c.tcpLastFrameTime), 0)
+			if now.Sub(lft) >= c.ReadTimeout {
+				return liberrors.ErrClientTCPTimeout{}
+			}
+		}
+	}
+
+	c.checkStreamTimer = time.NewTimer(c.checkStreamPeriod)
+	return nil
+}
+
+// restart restarts the session with another transport protocol.
+// medias with a forced transport protocol are setupped again with the same protocol.
+func (c *Client) restart(next Transport) (map[*media.Media]*clientMedia, *url.URL, error) {
 	prevScheme := c.scheme
 	prevHost := c.host
 	prevBaseURL := c.baseURL
 	prevMedias := c.medias
+	prevMediasOrdered := c.mediasOrdered
 
 	c.reset()
 
-	v := TransportTCP
-	c.effectiveTransport = &v
+	c.effectiveTransport = &next
 	c.scheme = prevScheme
 	c.host = prevHost
 
 	// some Hikvision cameras require a describe before a setup
 	_, _, _, err := c.doDescribe(c.lastDescribeURL)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
-	for i, cm := range prevMedias {
-		_, err := c.doSetup(cm.media, prevBaseURL, 0, 0)
+	for _, cm := range prevMediasOrdered {
+		var forced *Transport
+		if cm.transportForced {
+			v := cm.transport
+			forced = &v
+		}
+
+		_, err := c.doSetup(cm.media, prevBaseURL, forced, 0, 0)
 		if err != nil {
-			return err
+			return nil, nil, err
 		}
+	}
 
+	return prevMedias, prevBaseURL, nil
+}
+
+func (c *Client) trySwitchingProtocol(next Transport) error {
+	prevMedias, _, err := c.restart(next)
+	if err != nil {
+		return err
+	}
+
+	for i, cm := range prevMedias {
 		c.medias[i].onPacketRTCP = cm.onPacketRTCP
 		for j, tr := range cm.formats {
 			c.medias[i].formats[j].onPacketRTP = tr.onPacketRTP
 		}
 	}
 
-	_, err = c.doPlay(c.lastRange, true)
+	_, err = c.doPlay(&c.lastPlayOptions, true)
 	if err != nil {
 		return err
 	}
@@ -653,23 +946,14 @@ func (c *Client) trySwitchingProtocol() error {
 func (c *Client) trySwitchingProtocol2(medi *media.Media, baseURL *url.URL) (*base.Response, error) {
 	c.Log(LogLevelWarn, "switching to TCP because server requested it")
 
-	prevScheme := c.scheme
-	prevHost := c.host
-
-	c.reset()
-
-	v := TransportTCP
-	c.effectiveTransport = &v
-	c.scheme = prevScheme
-	c.host = prevHost
+	c.baseURL = baseURL
 
-	// some Hikvision cameras require a describe before a setup
-	_, _, _, err := c.doDescribe(c.lastDescribeURL)
+	_, _, err := c.restart(TransportTCP)
 	if err != nil {
 		return nil, err
 	}
 
-	return c.doSetup(medi, baseURL, 0, 0)
+	return c.doSetup(medi, baseURL, nil, 0, 0)
 }
 
 func (c *Client) playRecordStart() {
@@ -677,18 +961,16 @@ func (c *Client) playRecordStart() {
 	c.connCloserStop()
 
 	if c.state == clientStatePlay {
-		c.keepaliveTimer = time.NewTimer(c.keepalivePeriod)
+		c.keepaliveTimer = time.NewTimer(c.keepaliveInterval())
 
-		switch *c.effectiveTransport {
-		case TransportUDP:
+		if c.usesUDP() {
 			c.checkStreamTimer = time.NewTimer(c.InitialUDPReadTimeout)
 			c.checkStreamInitial = true
-
-		case TransportUDPMulticast:
+		} else {
 			c.checkStreamTimer = time.NewTimer(c.checkStreamPeriod)
+		}
 
-		default: // TCP
-			c.checkStreamTimer = time.NewTimer(c.checkStreamPeriod)
+		if c.usesTCP() {
 			v := time.Now().Unix()
 			c.tcpLastFrameTime = &v
 		}
@@ -721,21 +1003,40 @@ func (c *Client) playRecordStart() {
 
 func (c *Client) runReader() {
 	c.readerErr <- func() error {
-		if *c.effectiveTransport == TransportUDP || *c.effectiveTransport == TransportUDPMulticast {
+		if !c.usesTCP() {
 			for {
-				_, err := c.conn.ReadResponse()
+				what, err := c.conn.ReadRequestOrResponse()
 				if err != nil {
 					return err
 				}
+
+				c.captureRead(what)
+
+				if req, ok := what.(*base.Request); ok {
+					err := c.readerHandleRequest(req)
+					if err != nil {
+						return err
+					}
+				}
 			}
 		} else {
 			for {
-				what, err := c.conn.ReadInterleavedFrameOrResponse()
+				what, err := c.conn.ReadInterleavedFrameOrRequestOrResponse()
 				if err != nil {
 					return err
 				}
 
-				if fr, ok := what.(*base.InterleavedFrame); ok {
+				c.captureRead(what)
+
+				switch what := what.(type) {
+				case *base.Request:
+					err := c.readerHandleRequest(what)
+					if err != nil {
+						return err
+					}
+
+				case *base.InterleavedFrame:
+					fr := what
 					channel := fr.Channel
 					isRTP := true
 					if (channel % 2) != 0 {
@@ -762,6 +1063,90 @@ func (c *Client) runReader() {
 	}()
 }
 
+func (c *Client) readerHandleRequest(req *base.Request) error {
+	ru, err := c.handleServerRequest(req)
+	if err != nil {
+		return err
+	}
+
+	if ru != nil {
+		return errClientRedirect{u: ru}
+	}
+
+	return nil
+}
+
+// doRedirect moves the session to another URL.
+// reading sessions are established again at the new URL, while
+// publishing sessions are closed, since the medias are written by the user.
+func (c *Client) doRedirect(ru *url.URL) error {
+	c.Log(LogLevelInfo, "redirected to %v", ru)
+
+	prevState := c.state
+	prevMediasOrdered := c.mediasOrdered
+	prevDescribeMedias := c.lastDescribeMedias
+
+	if c.lastDescribeURL != nil && c.lastDescribeURL.User != nil && ru.User == nil {
+		ru.User = c.lastDescribeURL.User
+	}
+
+	switch prevState {
+	case clientStatePreRecord, clientStateRecord:
+		return liberrors.ErrClientRedirected{URL: ru}
+	}
+
+	c.reset()
+
+	c.scheme = ru.Scheme
+	c.host = ru.Host
+
+	if prevState == clientStateInitial {
+		return nil
+	}
+
+	medias, baseURL, _, err := c.doDescribe(ru)
+	if err != nil {
+		return err
+	}
+
+	if len(medias) != len(prevDescribeMedias) {
+		return fmt.Errorf("the stream at the new URL has a different number of medias")
+	}
+
+	// keep the media objects of the user, in order to keep pointers valid
+	for i, medi := range prevDescribeMedias {
+		medi.Control = medias[i].Control
+	}
+	c.lastDescribeMedias = prevDescribeMedias
+
+	for _, cm := range prevMediasOrdered {
+		var forced *Transport
+		if cm.transportForced {
+			v := cm.transport
+			forced = &v
+		}
+
+		_, err := c.doSetup(cm.media, baseURL, forced, 0, 0)
+		if err != nil {
+			return err
+		}
+
+		c.medias[cm.media].onPacketRTCP = cm.onPacketRTCP
+		for j, tr := range cm.formats {
+			c.medias[cm.media].formats[j].onPacketRTP = tr.onPacketRTP
+		}
+	}
+
+	if prevState == clientStatePlay {
+		_, err := c.doPlay(&c.lastPlayOptions, true)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (c *Client) playRecordStop(isClosing bool) {
 	// stop reader
 	if c.readerErr != nil {
@@ -828,6 +1213,7 @@ func (c *Client) connOpen() error {
 	c.nconn = nconn
 	bc := bytecounter.New(c.nconn, c.BytesReceived, c.BytesSent)
 	c.conn = conn.NewConn(bc)
+	c.capture = newSessionCapture(c.Capture, c.nconn)
 
 	c.connCloserStart()
 	return nil
@@ -855,42 +1241,239 @@ func (c *Client) connCloserStop() {
 	c.connCloserDone = nil
 }
 
-func (c *Client) do(req *base.Request, skipResponse bool, allowFrames bool) (*base.Response, error) {
+// readResponse reads the response with the given CSeq and handles
+// requests sent by the server in between.
+// Responses of previous requests (i.e. keepalives) are discarded.
+// If cseq is nil, any response is returned.
+func (c *Client) readResponse(cseq base.HeaderValue, allowFrames bool) (*base.Response, error) {
+	for {
+		var what interface{}
+		var err error
+		if allowFrames {
+			// ignore interleaved frames in between;
+			// interleaved frames are sent in two cases:
+			// * when the server is v4lrtspserver, before the PLAY response
+			// * when the stream is already playing
+			what, err = c.conn.ReadInterleavedFrameOrRequestOrResponse()
+		} else {
+			what, err = c.conn.ReadRequestOrResponse()
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		c.captureRead(what)
+
+		switch what := what.(type) {
+		case *base.Response:
+			// responses without CSeq are associated with the current request
+			if v, ok := what.Header["CSeq"]; ok && len(v) == 1 && len(cseq) == 1 && v[0] != cseq[0] {
+				continue
+			}
+			return what, nil
+
+		case *base.Request:
+			ru, err := c.handleServerRequest(what)
+			if err != nil {
+				return nil, err
+			}
+
+			// the redirect is performed after the current request is completed
+			if ru != nil {
+				c.redirectURL = ru
+			}
+		}
+	}
+}
+
+// handleServerRequest replies to a request sent by the server.
+// It returns the URL the client must be redirected to, if any.
+func (c *Client) handleServerRequest(req *base.Request) (*url.URL, error) {
+	res := c.OnServerRequest(req)
+	if res == nil {
+		res = &base.Response{
+			StatusCode: base.StatusNotImplemented,
+		}
+	}
+
+	var ru *url.URL
+
+	if req.Method == base.Redirect && res.StatusCode == base.StatusOK && !c.RedirectDisable {
+		var err error
+		ru, err = redirectLocation(req)
+		if err != nil {
+			res = &base.Response{
+				StatusCode: base.StatusBadRequest,
+			}
+		}
+	}
+
+	if res.Header == nil {
+		res.Header = make(base.Header)
+	}
+
+	if cseq, ok := req.Header["CSeq"]; ok {
+		res.Header["CSeq"] = cseq
+	}
+
+	c.nconn.SetWriteDeadline(time.Now().Add(c.WriteTimeout))
+	err := c.conn.WriteResponse(res)
+	if err == nil {
+		c.capture.writeRTSP(c.nconn, true, res)
+	}
+
+	// the server closes the connection after sending a TEARDOWN,
+	// therefore the write error is not relevant.
+	if req.Method == base.Teardown && res.StatusCode == base.StatusOK {
+		return nil, liberrors.ErrClientTornDown{}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ru, nil
+}
+
+// prepareRequest fills the request with the headers shared by all requests.
+func (c *Client) prepareRequest(req *base.Request) error {
 	if c.nconn == nil {
 		err := c.connOpen()
 		if err != nil {
-			return nil, err
+			return err
+		}
+	}
+
+	if !c.optionsSent && req.Method != base.Options {
+		_, err := c.doOptions(req.URL)
+		if err != nil {
+			return err
+		}
+	}
+
+	if req.Header == nil {
+		req.Header = make(base.Header)
+	}
+
+	if c.session != "" {
+		req.Header["Session"] = base.HeaderValue{c.session}
+	}
+
+	c.cseq++
+	req.Header["CSeq"] = base.HeaderValue{strconv.FormatInt(int64(c.cseq), 10)}
+
+	req.Header["User-Agent"] = base.HeaderValue{c.UserAgent}
+
+	if c.sender != nil {
+		c.sender.AddAuthorization(req)
+	}
+
+	c.OnRequest(req)
+
+	return nil
+}
+
+func (c *Client) writeRequest(req *base.Request) error {
+	c.nconn.SetWriteDeadline(time.Now().Add(c.WriteTimeout))
+	err := c.conn.WriteRequest(req)
+	if err != nil {
+		return err
+	}
+
+	c.capture.writeRTSP(c.nconn, true, req)
+	return nil
+}
+
+// captureRead writes a request, a response or an interleaved frame
+// received from the server into the capture.
+func (c *Client) captureRead(what interface{}) {
+	switch what := what.(type) {
+	case *base.Request:
+		c.capture.writeRTSP(c.nconn, false, what)
+
+	case *base.Response:
+		c.capture.writeRTSP(c.nconn, false, what)
+
+	case *base.InterleavedFrame:
+		c.capture.writeInterleavedFrame(c.nconn, false, what.Channel, what.Payload)
+	}
+}
+
+// processResponse processes the response of a request.
+// If the request must be sent again with authentication, it returns true.
+func (c *Client) processResponse(req *base.Request, res *base.Response) (bool, error) {
+	c.OnResponse(res)
+
+	// get session from response
+	if v, ok := res.Header["Session"]; ok {
+		var sx headers.Session
+		err := sx.Unmarshal(v)
+		if err != nil {
+			return false, liberrors.ErrClientSessionHeaderInvalid{Err: err}
+		}
+		c.session = sx.Session
+
+		if sx.Timeout != nil && *sx.Timeout > 0 {
+			c.sessionTimeout = time.Duration(*sx.Timeout) * time.Second
+		}
+	}
+
+	if res.StatusCode != base.StatusUnauthorized {
+		c.senderStaleRetried = false
+		return false, nil
+	}
+
+	// if required, send request again with authentication
+	if req.URL.User != nil && c.sender == nil {
+		pass, _ := req.URL.User.Password()
+		user := req.URL.User.Username()
+
+		sender, err := auth.NewSender(res.Header["WWW-Authenticate"], user, pass)
+		if err != nil {
+			return false, fmt.Errorf("unable to setup authentication: %s", err)
 		}
+		c.sender = sender
+		c.senderUser = user
+		c.senderPass = pass
+
+		return true, nil
 	}
 
-	if !c.optionsSent && req.Method != base.Options {
-		_, err := c.doOptions(req.URL)
+	// if the nonce is expired, credentials are still valid
+	// and the request can be sent again with a new nonce
+	if c.sender != nil && !c.senderStaleRetried && isAuthStale(res.Header["WWW-Authenticate"]) {
+		sender, err := auth.NewSender(res.Header["WWW-Authenticate"], c.senderUser, c.senderPass)
 		if err != nil {
-			return nil, err
+			return false, fmt.Errorf("unable to setup authentication: %s", err)
 		}
-	}
-
-	if req.Header == nil {
-		req.Header = make(base.Header)
-	}
+		c.sender = sender
+		c.senderStaleRetried = true
 
-	if c.session != "" {
-		req.Header["Session"] = base.HeaderValue{c.session}
+		return true, nil
 	}
 
-	c.cseq++
-	req.Header["CSeq"] = base.HeaderValue{strconv.FormatInt(int64(c.cseq), 10)}
-
-	req.Header["User-Agent"] = base.HeaderValue{c.UserAgent}
+	return false, nil
+}
 
-	if c.sender != nil {
-		c.sender.AddAuthorization(req)
+// isAuthStale checks whether a WWW-Authenticate header contains stale=true.
+func isAuthStale(v base.HeaderValue) bool {
+	for _, vi := range v {
+		var h headers.Authenticate
+		err := h.Unmarshal(base.HeaderValue{vi})
+		if err == nil && h.Stale != nil && strings.EqualFold(*h.Stale, "true") {
+			return true
+		}
 	}
+	return false
+}
 
-	c.OnRequest(req)
+func (c *Client) do(req *base.Request, skipResponse bool, allowFrames bool) (*base.Response, error) {
+	err := c.prepareRequest(req)
+	if err != nil {
+		return nil, err
+	}
 
-	c.nconn.SetWriteDeadline(time.Now().Add(c.WriteTimeout))
-	err := c.conn.WriteRequest(req)
+	err = c.writeRequest(req)
 	if err != nil {
 		return nil, err
 	}
@@ -900,51 +1483,118 @@ func (c *Client) do(req *base.Request, skipResponse bool, allowFrames bool) (*ba
 	}
 
 	c.nconn.SetReadDeadline(time.Now().Add(c.ReadTimeout))
-	var res *base.Response
-	if allowFrames {
-		// read the response and ignore interleaved frames in between;
-		// interleaved frames are sent in two cases:
-		// * when the server is v4lrtspserver, before the PLAY response
-		// * when the stream is already playing
-		res, err = c.conn.ReadResponseIgnoreFrames()
-	} else {
-		res, err = c.conn.ReadResponse()
+	res, err := c.readResponse(req.Header["CSeq"], allowFrames)
+	if err != nil {
+		return nil, err
 	}
+
+	resend, err := c.processResponse(req, res)
 	if err != nil {
 		return nil, err
 	}
 
-	c.OnResponse(res)
+	if resend {
+		return c.do(req, skipResponse, allowFrames)
+	}
 
-	// get session from response
-	if v, ok := res.Header["Session"]; ok {
-		var sx headers.Session
-		err := sx.Unmarshal(v)
+	return res, nil
+}
+
+// pipelinedResponseIndex returns the index of the request associated with a response,
+// or -1 if the response is not associated with any pending request.
+func pipelinedResponseIndex(reqs []*base.Request, ress []*base.Response, res *base.Response) int {
+	cseq, ok := res.Header["CSeq"]
+	if !ok || len(cseq) != 1 {
+		// responses without CSeq are associated with the first pending request
+		for i := range reqs {
+			if ress[i] == nil {
+				return i
+			}
+		}
+		return -1
+	}
+
+	for i, req := range reqs {
+		if ress[i] == nil && req.Header["CSeq"][0] == cseq[0] {
+			return i
+		}
+	}
+	return -1
+}
+
+// doPipelined writes multiple requests without waiting for their responses,
+// then reads the responses and matches them with requests by using CSeq.
+func (c *Client) doPipelined(reqs []*base.Request) ([]*base.Response, error) {
+	for _, req := range reqs {
+		err := c.prepareRequest(req)
 		if err != nil {
-			return nil, liberrors.ErrClientSessionHeaderInvalid{Err: err}
+			return nil, err
 		}
-		c.session = sx.Session
+	}
 
-		if sx.Timeout != nil && *sx.Timeout > 0 {
-			c.keepalivePeriod = time.Duration(float64(*sx.Timeout)*0.8) * time.Second
+	// allow the server to associate requests sent before the session ID is known
+	// with the same session (RTSP 2.0)
+	if c.session == "" {
+		for _, req := range reqs {
+			req.Header["Pipelined-Requests"] = reqs[0].Header["CSeq"]
 		}
 	}
 
-	// if required, send request again with authentication
-	if res.StatusCode == base.StatusUnauthorized && req.URL.User != nil && c.sender == nil {
-		pass, _ := req.URL.User.Password()
-		user := req.URL.User.Username()
+	for _, req := range reqs {
+		err := c.writeRequest(req)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-		sender, err := auth.NewSender(res.Header["WWW-Authenticate"], user, pass)
+	ress := make([]*base.Response, len(reqs))
+
+	// responses can be received in any order
+	for received := 0; received < len(reqs); {
+		c.nconn.SetReadDeadline(time.Now().Add(c.ReadTimeout))
+		res, err := c.readResponse(nil, false)
 		if err != nil {
-			return nil, fmt.Errorf("unable to setup authentication: %s", err)
+			return nil, err
 		}
-		c.sender = sender
 
-		return c.do(req, skipResponse, allowFrames)
+		i := pipelinedResponseIndex(reqs, ress, res)
+		if i < 0 {
+			continue
+		}
+
+		// the response is overwritten by the next read
+		resCopy := *res
+		ress[i] = &resCopy
+		received++
 	}
 
-	return res, nil
+	session := c.session
+
+	for i, req := range reqs {
+		resend, err := c.processResponse(req, ress[i])
+		if err != nil {
+			return nil, err
+		}
+
+		if resend {
+			delete(req.Header, "Pipelined-Requests")
+
+			ress[i], err = c.do(req, false, false)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		// requests belong to a single session, that is the one of the first response
+		// when the session ID was not known before sending them.
+		if session == "" {
+			session = c.session
+		} else if c.session != session {
+			return nil, liberrors.ErrClientSessionMismatch{Expected: session, Received: c.session}
+		}
+	}
+
+	return ress, nil
 }
 
 func (c *Client) doOptions(u *url.URL) (*base.Response, error) {
@@ -990,9 +1640,34 @@ func (c *Client) doOptions(u *url.URL) (*base.Response, error) {
 		return false
 	}()
 
+	c.pipelinedRequests = supportsPipelinedRequests(res)
+
 	return res, nil
 }
 
+// headerContainsToken checks whether a comma-separated header contains a token.
+func headerContainsToken(v base.HeaderValue, token string) bool {
+	for _, vi := range v {
+		for _, t := range strings.Split(vi, ",") {
+			if strings.EqualFold(strings.Trim(t, " "), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// supportsPipelinedRequests checks whether a OPTIONS response advertises
+// support for the Pipelined-Requests header, that allows to send requests
+// before the session ID is known.
+// The header is part of the RTSP 2.0 core specification, that is advertised
+// with the "play.basic" feature tag.
+func supportsPipelinedRequests(res *base.Response) bool {
+	return headerContainsToken(res.Header["Public"], "Pipelined-Requests") ||
+		headerContainsToken(res.Header["Supported"], "Pipelined-Requests") ||
+		headerContainsToken(res.Header["Supported"], "play.basic")
+}
+
 // Options writes an OPTIONS request and reads a response.
 func (c *Client) Options(u *url.URL) (*base.Response, error) {
 	cres := make(chan clientRes)
@@ -1083,6 +1758,7 @@ func (c *Client) doDescribe(u *url.URL) (media.Medias, *url.URL, *base.Response,
 	}
 
 	c.lastDescribeURL = u
+	c.lastDescribeMedias = medias
 
 	return medias, baseURL, res, nil
 }
@@ -1152,12 +1828,29 @@ func (c *Client) Announce(u *url.URL, medias media.Medias) (*base.Response, erro
 	}
 }
 
-func (c *Client) doSetup(
+// clientSetup is a SETUP request that is being performed.
+type clientSetup struct {
+	medi               *media.Media
+	baseURL            *url.URL
+	forcedTransport    *Transport
+	rtpPort            int
+	rtcpPort           int
+	requestedTransport Transport
+	mode               headers.TransportMode
+	cm                 *clientMedia
+	req                *base.Request
+}
+
+// setupPrepare allocates the resources needed by a media and builds its SETUP request.
+// pending is the number of medias that have been prepared but not setupped yet.
+func (c *Client) setupPrepare(
 	medi *media.Media,
 	baseURL *url.URL,
+	forcedTransport *Transport,
 	rtpPort int,
 	rtcpPort int,
-) (*base.Response, error) {
+	pending int,
+) (*clientSetup, error) {
 	err := c.checkState(map[clientState]struct{}{
 		clientStateInitial:   {},
 		clientStatePrePlay:   {},
@@ -1173,11 +1866,20 @@ func (c *Client) doSetup(
 
 	// always use TCP if encrypted
 	if c.scheme == "rtsps" {
+		if forcedTransport != nil && *forcedTransport != TransportTCP {
+			return nil, fmt.Errorf("RTSPS can be used only with TCP")
+		}
+
 		v := TransportTCP
 		c.effectiveTransport = &v
 	}
 
 	requestedTransport := func() Transport {
+		// transport set by SetupWithTransport()
+		if forcedTransport != nil {
+			return *forcedTransport
+		}
+
 		// transport set by previous Setup() or trySwitchingProtocol()
 		if c.effectiveTransport != nil {
 			return *c.effectiveTransport
@@ -1188,8 +1890,8 @@ func (c *Client) doSetup(
 			return *c.Transport
 		}
 
-		// try UDP
-		return TransportUDP
+		// try the preferred transport
+		return c.TransportPreference[0]
 	}()
 
 	mode := headers.TransportModePlay
@@ -1237,7 +1939,7 @@ func (c *Client) doSetup(
 		v1 := headers.TransportDeliveryUnicast
 		th.Delivery = &v1
 		th.Protocol = headers.TransportProtocolTCP
-		mediaCount := len(c.medias)
+		mediaCount := len(c.medias) + pending
 		th.InterleavedIDs = &[2]int{(mediaCount * 2), (mediaCount * 2) + 1}
 	}
 
@@ -1247,36 +1949,109 @@ func (c *Client) doSetup(
 		return nil, err
 	}
 
-	res, err := c.do(&base.Request{
-		Method: base.Setup,
-		URL:    mediaURL,
-		Header: base.Header{
-			"Transport": th.Marshal(),
+	return &clientSetup{
+		medi:               medi,
+		baseURL:            baseURL,
+		forcedTransport:    forcedTransport,
+		rtpPort:            rtpPort,
+		rtcpPort:           rtcpPort,
+		requestedTransport: requestedTransport,
+		mode:               mode,
+		cm:                 cm,
+		req: &base.Request{
+			Method: base.Setup,
+			URL:    mediaURL,
+			Header: base.Header{
+				"Transport": th.Marshal(),
+			},
 		},
-	}, false, false)
+	}, nil
+}
+
+// setupNeedsFallback checks whether the response of a SETUP request may
+// trigger a transport switch.
+func (cs *clientSetup) setupNeedsFallback(res *base.Response) bool {
+	if res.StatusCode != base.StatusOK {
+		return true
+	}
+
+	switch cs.requestedTransport {
+	case TransportUDP, TransportUDPMulticast:
+		var thRes headers.Transport
+		err := thRes.Unmarshal(res.Header["Transport"])
+		if err == nil && thRes.Protocol == headers.TransportProtocolTCP {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *Client) doSetup(
+	medi *media.Media,
+	baseURL *url.URL,
+	forcedTransport *Transport,
+	rtpPort int,
+	rtcpPort int,
+) (*base.Response, error) {
+	cs, err := c.setupPrepare(medi, baseURL, forcedTransport, rtpPort, rtcpPort, 0)
 	if err != nil {
-		cm.close()
 		return nil, err
 	}
 
+	res, err := c.do(cs.req, false, false)
+	if err != nil {
+		cs.cm.close()
+		return nil, err
+	}
+
+	return c.setupFinish(cs, res)
+}
+
+// setupFinish processes the response of a SETUP request.
+func (c *Client) setupFinish(cs *clientSetup, res *base.Response) (*base.Response, error) {
+	medi := cs.medi
+	baseURL := cs.baseURL
+	forcedTransport := cs.forcedTransport
+	rtpPort := cs.rtpPort
+	rtcpPort := cs.rtcpPort
+	requestedTransport := cs.requestedTransport
+	mode := cs.mode
+	cm := cs.cm
+
+	// the transport can be switched only if it has been chosen automatically
+	// and no other media has been setupped with it yet.
+	canFallback := func(cond TransportFallback) bool {
+		return forcedTransport == nil &&
+			!c.hasAutomaticMedias() &&
+			c.canFallback(cond)
+	}
+
 	if res.StatusCode != base.StatusOK {
 		cm.close()
 
 		// switch transport automatically
 		if res.StatusCode == base.StatusUnsupportedTransport &&
-			c.effectiveTransport == nil &&
-			c.Transport == nil {
-			c.Log(LogLevelWarn, "switching to TCP because server requested it")
-			v := TransportTCP
-			c.effectiveTransport = &v
-			return c.doSetup(medi, baseURL, 0, 0)
+			canFallback(TransportFallbackUnsupportedTransport) {
+			if next, ok := c.nextTransport(requestedTransport); ok {
+				c.Log(LogLevelWarn, "switching to %v because server requested it", next)
+				prevTransport := c.effectiveTransport
+				c.effectiveTransport = &next
+
+				res, err := c.doSetup(medi, baseURL, nil, rtpPort, rtcpPort)
+				if err != nil {
+					// next SETUPs start again from the preferred transport
+					c.effectiveTransport = prevTransport
+				}
+				return res, err
+			}
 		}
 
 		return nil, liberrors.ErrClientBadStatusCode{Code: res.StatusCode, Message: res.StatusMessage}
 	}
 
 	var thRes headers.Transport
-	err = thRes.Unmarshal(res.Header["Transport"])
+	err := thRes.Unmarshal(res.Header["Transport"])
 	if err != nil {
 		cm.close()
 		return nil, liberrors.ErrClientTransportHeaderInvalid{Err: err}
@@ -1288,9 +2063,8 @@ func (c *Client) doSetup(
 			cm.close()
 
 			// switch transport automatically
-			if c.effectiveTransport == nil &&
-				c.Transport == nil {
-				c.baseURL = baseURL
+			if canFallback(TransportFallbackServerRequest) &&
+				c.transportFollows(requestedTransport, TransportTCP) {
 				return c.trySwitchingProtocol2(medi, baseURL)
 			}
 
@@ -1419,10 +2193,15 @@ func (c *Client) doSetup(
 	}
 
 	c.medias[medi] = cm
+	c.mediasOrdered = append(c.mediasOrdered, cm)
 	cm.setMedia(medi)
+	cm.transport = requestedTransport
+	cm.transportForced = (forcedTransport != nil)
 
 	c.baseURL = baseURL
-	c.effectiveTransport = &requestedTransport
+	if forcedTransport == nil {
+		c.effectiveTransport = &requestedTransport
+	}
 
 	if mode == headers.TransportModePlay {
 		c.state = clientStatePrePlay
@@ -1433,23 +2212,100 @@ func (c *Client) doSetup(
 	return res, nil
 }
 
-// Setup writes a SETUP request and reads a Response.
-// rtpPort and rtcpPort are used only if transport is UDP.
-// if rtpPort and rtcpPort are zero, they are chosen automatically.
-func (c *Client) Setup(
+func (c *Client) doSetupAll(medias media.Medias, baseURL *url.URL) error {
+	if !c.Pipelining || !c.pipelinedRequests || len(medias) <= 1 {
+		for _, medi := range medias {
+			_, err := c.doSetup(medi, baseURL, nil, 0, 0)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	setups := make([]*clientSetup, len(medias))
+	reqs := make([]*base.Request, len(medias))
+
+	closeSetups := func(from int) {
+		for _, cs := range setups[from:] {
+			if cs != nil {
+				cs.cm.close()
+			}
+		}
+	}
+
+	for i, medi := range medias {
+		cs, err := c.setupPrepare(medi, baseURL, nil, 0, 0, i)
+		if err != nil {
+			closeSetups(0)
+			return err
+		}
+		setups[i] = cs
+		reqs[i] = cs.req
+	}
+
+	ress, err := c.doPipelined(reqs)
+	if err != nil {
+		closeSetups(0)
+		return err
+	}
+
+	// the transport protocol may have to be switched.
+	// Discard the session that may have been created by pipelined requests,
+	// switch the transport protocol of the first media,
+	// then perform remaining SETUPs one at a time.
+	if !c.hasAutomaticMedias() && setups[0].setupNeedsFallback(ress[0]) {
+		closeSetups(1)
+
+		if c.session != "" {
+			c.do(&base.Request{
+				Method: base.Teardown,
+				URL:    baseURL,
+			}, true, false)
+			c.session = ""
+		}
+
+		_, err := c.setupFinish(setups[0], ress[0])
+		if err != nil {
+			return err
+		}
+
+		for _, medi := range medias[1:] {
+			_, err := c.doSetup(medi, baseURL, nil, 0, 0)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for i, cs := range setups {
+		_, err := c.setupFinish(cs, ress[i])
+		if err != nil {
+			closeSetups(i + 1)
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *Client) setupInner(
 	media *media.Media,
 	baseURL *url.URL,
+	transport *Transport,
 	rtpPort int,
 	rtcpPort int,
 ) (*base.Response, error) {
 	cres := make(chan clientRes)
 	select {
 	case c.setup <- setupReq{
-		media:    media,
-		baseURL:  baseURL,
-		rtpPort:  rtpPort,
-		rtcpPort: rtcpPort,
-		res:      cres,
+		media:     media,
+		baseURL:   baseURL,
+		transport: transport,
+		rtpPort:   rtpPort,
+		rtcpPort:  rtcpPort,
+		res:       cres,
 	}:
 		res := <-cres
 		return res.res, res.err
@@ -1459,18 +2315,47 @@ func (c *Client) Setup(
 	}
 }
 
+// Setup writes a SETUP request and reads a Response.
+// rtpPort and rtcpPort are used only if transport is UDP.
+// if rtpPort and rtcpPort are zero, they are chosen automatically.
+func (c *Client) Setup(
+	media *media.Media,
+	baseURL *url.URL,
+	rtpPort int,
+	rtcpPort int,
+) (*base.Response, error) {
+	return c.setupInner(media, baseURL, nil, rtpPort, rtcpPort)
+}
+
+// SetupWithTransport writes a SETUP request and reads a Response.
+// The media is setupped with the given transport protocol, regardless of
+// Transport and TransportPreference, and is never switched to another protocol.
+// rtpPort and rtcpPort are used only if transport is UDP.
+// if rtpPort and rtcpPort are zero, they are chosen automatically.
+func (c *Client) SetupWithTransport(
+	media *media.Media,
+	baseURL *url.URL,
+	transport Transport,
+	rtpPort int,
+	rtcpPort int,
+) (*base.Response, error) {
+	return c.setupInner(media, baseURL, &transport, rtpPort, rtcpPort)
+}
+
 // SetupAll setups all the given medias.
 func (c *Client) SetupAll(medias media.Medias, baseURL *url.URL) error {
-	for _, m := range medias {
-		_, err := c.Setup(m, baseURL, 0, 0)
-		if err != nil {
-			return err
-		}
+	cres := make(chan clientRes)
+	select {
+	case c.setupAll <- setupAllReq{medias: medias, baseURL: baseURL, res: cres}:
+		res := <-cres
+		return res.err
+
+	case <-c.ctx.Done():
+		return liberrors.ErrClientTerminated{}
 	}
-	return nil
 }
 
-func (c *Client) doPlay(ra *headers.Range, isSwitchingProtocol bool) (*base.Response, error) {
+func (c *Client) doPlay(opts *ClientPlayOptions, isSwitchingProtocol bool) (*base.Response, error) {
 	err := c.checkState(map[clientState]struct{}{
 		clientStatePrePlay: {},
 	})
@@ -1482,8 +2367,8 @@ func (c *Client) doPlay(ra *headers.Range, isSwitchingProtocol bool) (*base.Resp
 	// do this before sending the request.
 	// don't do this with multicast, otherwise the RTP packet is going to be broadcasted
 	// to all listeners, including us, messing up the stream.
-	if *c.effectiveTransport == TransportUDP {
-		for _, ct := range c.medias {
+	for _, ct := range c.medias {
+		if ct.transport == TransportUDP {
 			byts, _ := (&rtp.Packet{Header: rtp.Header{Version: 2}}).Marshal()
 			ct.udpRTPListener.write(byts)
 
@@ -1492,22 +2377,36 @@ func (c *Client) doPlay(ra *headers.Range, isSwitchingProtocol bool) (*base.Resp
 		}
 	}
 
-	// Range is mandatory in Parrot Streaming Server
-	if ra == nil {
-		ra = &headers.Range{
+	header := make(base.Header)
+
+	// Range is mandatory in Parrot Streaming Server.
+	// When changing Scale or Speed, omit Range in order to continue
+	// from the current position.
+	switch {
+	case opts.Range != nil:
+		header["Range"] = opts.Range.Marshal()
+
+	case opts.Scale == nil && opts.Speed == nil:
+		header["Range"] = headers.Range{
 			Value: &headers.RangeNPT{
 				Start: 0,
 			},
-		}
+		}.Marshal()
+	}
+
+	if opts.Scale != nil {
+		header["Scale"] = opts.Scale.Marshal()
+	}
+
+	if opts.Speed != nil {
+		header["Speed"] = opts.Speed.Marshal()
 	}
 
 	res, err := c.do(&base.Request{
 		Method: base.Play,
 		URL:    c.baseURL,
-		Header: base.Header{
-			"Range": ra.Marshal(),
-		},
-	}, false, *c.effectiveTransport == TransportTCP)
+		Header: header,
+	}, false, c.usesTCP())
 	if err != nil {
 		return nil, err
 	}
@@ -1518,7 +2417,7 @@ func (c *Client) doPlay(ra *headers.Range, isSwitchingProtocol bool) (*base.Resp
 		}
 	}
 
-	c.lastRange = ra
+	c.lastPlayOptions = *opts
 	c.state = clientStatePlay
 	c.playRecordStart()
 
@@ -1528,9 +2427,24 @@ func (c *Client) doPlay(ra *headers.Range, isSwitchingProtocol bool) (*base.Resp
 // Play writes a PLAY request and reads a Response.
 // This can be called only after Setup().
 func (c *Client) Play(ra *headers.Range) (*base.Response, error) {
+	return c.PlayWithOptions(&ClientPlayOptions{
+		Range: ra,
+	})
+}
+
+// PlayWithOptions writes a PLAY request with options and reads a Response.
+// Options allow to request fast-forward and rewind; values accepted by
+// the server are contained in the Scale and Speed headers of the Response.
+// opts can be nil.
+// This can be called only after Setup().
+func (c *Client) PlayWithOptions(opts *ClientPlayOptions) (*base.Response, error) {
+	if opts == nil {
+		opts = &ClientPlayOptions{}
+	}
+
 	cres := make(chan clientRes)
 	select {
-	case c.play <- playReq{ra: ra, res: cres}:
+	case c.play <- playReq{opts: opts, res: cres}:
 		res := <-cres
 		return res.res, res.err
 
@@ -1603,7 +2517,7 @@ func (c *Client) doPause() (*base.Response, error) {
 	res, err := c.do(&base.Request{
 		Method: base.Pause,
 		URL:    c.baseURL,
-	}, false, *c.effectiveTransport == TransportTCP)
+	}, false, c.usesTCP())
 	if err != nil {
 		return nil, err
 	}
@@ -1633,12 +2547,21 @@ func (c *Client) Pause() (*base.Response, error) {
 
 // Seek asks the server to re-start the stream from a specific timestamp.
 func (c *Client) Seek(ra *headers.Range) (*base.Response, error) {
+	return c.SeekWithOptions(&ClientPlayOptions{
+		Range: ra,
+	})
+}
+
+// SeekWithOptions asks the server to re-start the stream with new options,
+// for instance to change the playback speed or direction.
+// opts can be nil.
+func (c *Client) SeekWithOptions(opts *ClientPlayOptions) (*base.Response, error) {
 	_, err := c.Pause()
 	if err != nil {
 		return nil, err
 	}
 
-	return c.Play(ra)
+	return c.PlayWithOptions(opts)
 }
 
 // OnPacketRTPAny sets the callback that is called when a RTP packet is read from any setupped media.
@@ -1676,6 +2599,38 @@ func (c *Client) OnPacketRTCP(medi *media.Media, cb func(rtcp.Packet)) {
 	cm.onPacketRTCP = cb
 }
 
+// OnFrameAny sets the callback that is called when a frame is decoded from any setupped media.
+func (c *Client) OnFrameAny(cb func(*media.Media, formats.Format, *Frame)) {
+	for _, cm := range c.medias {
+		cmedia := cm.media
+		for _, forma := range cm.media.Formats {
+			cforma := forma
+			c.OnFrame(cm.media, forma, func(fr *Frame) {
+				cb(cmedia, cforma, fr)
+			})
+		}
+	}
+}
+
+// OnFrame sets the callback that is called when a frame is decoded.
+// RTP packets are depacketized with the decoder of the format;
+// with formats without a decoder, RTP payloads are provided as they are.
+// It replaces the callback set with OnPacketRTP.
+func (c *Client) OnFrame(medi *media.Media, forma formats.Format, cb func(*Frame)) {
+	cm := c.medias[medi]
+	ct := cm.formats[forma.PayloadType()]
+
+	fd := NewFrameDecoder(forma, cb)
+	ct.frameDecoder = fd
+
+	ct.onPacketRTP = func(pkt *rtp.Packet) {
+		err := fd.ProcessPacket(pkt)
+		if err != nil {
+			c.Log(LogLevelWarn, "unable to decode frame: %v", err)
+		}
+	}
+}
+
 // WritePacketRTP writes a RTP packet to the media stream.
 func (c *Client) WritePacketRTP(medi *media.Media, pkt *rtp.Packet) error {
 	return c.WritePacketRTPWithNTP(medi, pkt, time.Now())
@@ -1688,6 +2643,26 @@ func (c *Client) WritePacketRTPWithNTP(medi *media.Media, pkt *rtp.Packet, ntp t
 	return ct.writePacketRTPWithNTP(pkt, ntp)
 }
 
+// WriteFrame writes a frame to the media stream.
+// The frame is packetized with the encoder of the format.
+// With H264 and H265, Payload contains NALUs, and parameter sets found among them are saved into the format;
+// with MPEG-4 Audio, it can contain multiple access units; otherwise, it must contain a single element.
+// If NTP is zero, it is computed from PTS.
+func (c *Client) WriteFrame(medi *media.Media, forma formats.Format, fr *Frame) error {
+	cm := c.medias[medi]
+	ct := cm.formats[forma.PayloadType()]
+	return ct.frameEncoder.encodeFrame(fr, ct.writePacketRTPWithNTP)
+}
+
+// WriteAccessUnit writes an access unit to the media stream.
+// It is equivalent to WriteFrame with a frame that contains PTS and Payload only.
+func (c *Client) WriteAccessUnit(medi *media.Media, forma formats.Format, pts time.Duration, au [][]byte) error {
+	return c.WriteFrame(medi, forma, &Frame{
+		PTS:     pts,
+		Payload: au,
+	})
+}
+
 // WritePacketRTCP writes a RTCP packet to the media stream.
 func (c *Client) WritePacketRTCP(medi *media.Media, pkt rtcp.Packet) error {
 	cm := c.medias[medi]
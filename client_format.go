@@ -1,6 +1,7 @@
 package gortsplib
 
 import (
+	"sync/atomic"
 	"time"
 
 	"github.com/pion/rtcp"
@@ -19,16 +20,26 @@ type clientFormat struct {
 	udpReorderer    *rtpreorderer.Reorderer    // play
 	udpRTCPReceiver *rtcpreceiver.RTCPReceiver // play
 	rtcpSender      *rtcpsender.RTCPSender     // record
+	frameDecoder    *FrameDecoder              // play
+	frameEncoder    *frameEncoder              // record
 	onPacketRTP     func(*rtp.Packet)
 }
 
 func newClientFormat(cm *clientMedia, forma formats.Format) *clientFormat {
-	return &clientFormat{
+	ct := &clientFormat{
 		c:           cm.c,
 		cm:          cm,
 		format:      forma,
 		onPacketRTP: func(*rtp.Packet) {},
 	}
+
+	// the encoder is shared by all RECORD requests,
+	// in order to keep SSRC and sequence numbers after a PAUSE.
+	if cm.c.state == clientStatePreRecord {
+		ct.frameEncoder = newFrameEncoder(forma)
+	}
+
+	return ct
 }
 
 func (ct *clientFormat) start() {
@@ -83,9 +94,17 @@ func (ct *clientFormat) writePacketRTPWithNTP(pkt *rtp.Packet, ntp time.Time) er
 	default:
 	}
 
-	ct.c.writer.queue(func() {
+	if ct.cm.writeDropper.skip(byts) {
+		atomic.AddUint64(ct.c.PacketsDropped, 1)
+		return nil
+	}
+
+	ok := ct.c.writer.queue(func() {
 		ct.cm.writePacketRTPInQueue(byts)
 	})
+	if !ok {
+		return ct.c.onWriteQueueFull(ct.cm, true)
+	}
 
 	ct.rtcpSender.ProcessPacket(pkt, ntp, ct.format.PTSEqualsDTS(pkt))
 	return nil
@@ -15,6 +15,8 @@ type clientMedia struct {
 	c                      *Client
 	media                  *media.Media
 	formats                map[uint8]*clientFormat
+	transport              Transport
+	transportForced        bool
 	tcpChannel             int
 	udpRTPListener         *clientUDPListener
 	udpRTCPListener        *clientUDPListener
@@ -26,6 +28,7 @@ type clientMedia struct {
 	readRTP                func([]byte) error
 	readRTCP               func([]byte) error
 	onPacketRTCP           func(rtcp.Packet)
+	writeDropper           *writerDropper
 }
 
 func newClientMedia(c *Client) *clientMedia {
@@ -83,6 +86,7 @@ func (cm *clientMedia) allocateUDPListeners(multicast bool, rtpAddress string, r
 
 func (cm *clientMedia) setMedia(medi *media.Media) {
 	cm.media = medi
+	cm.writeDropper = newWriterDropper(medi)
 
 	cm.formats = make(map[uint8]*clientFormat)
 	for _, forma := range medi.Formats {
@@ -169,6 +173,7 @@ func (cm *clientMedia) writePacketRTPInQueueTCP(payload []byte) {
 	cm.tcpRTPFrame.Payload = payload
 	cm.c.nconn.SetWriteDeadline(time.Now().Add(cm.c.WriteTimeout))
 	cm.c.conn.WriteInterleavedFrame(cm.tcpRTPFrame, cm.tcpBuffer)
+	cm.c.capture.writeInterleavedFrame(cm.c.nconn, true, cm.tcpRTPFrame.Channel, payload)
 }
 
 func (cm *clientMedia) writePacketRTCPInQueueTCP(payload []byte) {
@@ -176,6 +181,7 @@ func (cm *clientMedia) writePacketRTCPInQueueTCP(payload []byte) {
 	cm.tcpRTCPFrame.Payload = payload
 	cm.c.nconn.SetWriteDeadline(time.Now().Add(cm.c.WriteTimeout))
 	cm.c.conn.WriteInterleavedFrame(cm.tcpRTCPFrame, cm.tcpBuffer)
+	cm.c.capture.writeInterleavedFrame(cm.c.nconn, true, cm.tcpRTCPFrame.Channel, payload)
 }
 
 func (cm *clientMedia) writePacketRTCP(pkt rtcp.Packet) error {
@@ -190,13 +196,24 @@ func (cm *clientMedia) writePacketRTCP(pkt rtcp.Packet) error {
 	default:
 	}
 
-	cm.c.writer.queue(func() {
+	ok := cm.c.writer.queue(func() {
 		cm.writePacketRTCPInQueue(byts)
 	})
+	if !ok {
+		return cm.c.onWriteQueueFull(cm, false)
+	}
 
 	return nil
 }
 
+func (cm *clientMedia) processSenderReport(sr *rtcp.SenderReport) {
+	for _, ct := range cm.formats {
+		if ct.frameDecoder != nil {
+			ct.frameDecoder.ProcessSenderReport(sr)
+		}
+	}
+}
+
 func (cm *clientMedia) readRTPTCPPlay(payload []byte) error {
 	now := time.Now()
 	atomic.StoreInt64(cm.c.tcpLastFrameTime, now.Unix())
@@ -233,6 +250,10 @@ func (cm *clientMedia) readRTCPTCPPlay(payload []byte) error {
 	}
 
 	for _, pkt := range packets {
+		if sr, ok := pkt.(*rtcp.SenderReport); ok {
+			cm.processSenderReport(sr)
+		}
+
 		cm.onPacketRTCP(pkt)
 	}
 
@@ -313,6 +334,8 @@ func (cm *clientMedia) readRTCPUDPPlay(payload []byte) error {
 			if format != nil {
 				format.udpRTCPReceiver.ProcessSenderReport(sr, now)
 			}
+
+			cm.processSenderReport(sr)
 		}
 
 		cm.onPacketRTCP(pkt)
@@ -611,6 +611,76 @@ func TestClientRecordPauseSerial(t *testing.T) {
 	}
 }
 
+func TestClientRecordPauseWriteFrame(t *testing.T) {
+	recv := make(chan *rtp.Packet, 10)
+
+	s := &Server{
+		Handler: &testServerHandler{
+			onAnnounce: func(ctx *ServerHandlerOnAnnounceCtx) (*base.Response, error) {
+				return &base.Response{
+					StatusCode: base.StatusOK,
+				}, nil
+			},
+			onSetup: func(ctx *ServerHandlerOnSetupCtx) (*base.Response, *ServerStream, error) {
+				return &base.Response{
+					StatusCode: base.StatusOK,
+				}, nil, nil
+			},
+			onRecord: func(ctx *ServerHandlerOnRecordCtx) (*base.Response, error) {
+				ctx.Session.OnPacketRTPAny(func(medi *media.Media, forma formats.Format, pkt *rtp.Packet) {
+					recv <- pkt
+				})
+
+				return &base.Response{
+					StatusCode: base.StatusOK,
+				}, nil
+			},
+			onPause: func(ctx *ServerHandlerOnPauseCtx) (*base.Response, error) {
+				return &base.Response{
+					StatusCode: base.StatusOK,
+				}, nil
+			},
+		},
+		RTSPAddress: "localhost:8554",
+	}
+
+	err := s.Start()
+	require.NoError(t, err)
+	defer s.Close()
+
+	c := Client{
+		Transport: func() *Transport {
+			v := TransportTCP
+			return &v
+		}(),
+	}
+
+	medi := testH264Media
+	medias := media.Medias{medi}
+
+	err = record(&c, "rtsp://localhost:8554/teststream", medias, nil)
+	require.NoError(t, err)
+	defer c.Close()
+
+	err = c.WriteAccessUnit(medi, medi.Formats[0], 0, [][]byte{{0x05, 0x01}})
+	require.NoError(t, err)
+	pkt1 := <-recv
+
+	_, err = c.Pause()
+	require.NoError(t, err)
+
+	_, err = c.Record()
+	require.NoError(t, err)
+
+	err = c.WriteAccessUnit(medi, medi.Formats[0], 40*time.Millisecond, [][]byte{{0x01, 0x02}})
+	require.NoError(t, err)
+	pkt2 := <-recv
+
+	// the source is the same after a pause
+	require.Equal(t, pkt1.SSRC, pkt2.SSRC)
+	require.Equal(t, pkt1.SequenceNumber+1, pkt2.SequenceNumber)
+}
+
 func TestClientRecordPauseParallel(t *testing.T) {
 	for _, transport := range []string{
 		"udp",
@@ -198,6 +198,8 @@ func (u *clientUDPListener) runReader(forPlay bool) {
 		now := time.Now()
 		atomic.StoreInt64(u.lastPacketTime, now.Unix())
 
+		u.cm.c.capture.writeUDP(false, u.port(), uaddr, u.isRTP, buf[:n])
+
 		readFunc(buf[:n])
 	}
 }
@@ -207,5 +209,10 @@ func (u *clientUDPListener) write(payload []byte) error {
 	// https://github.com/golang/go/issues/27203#issuecomment-534386117
 	u.pc.SetWriteDeadline(time.Now().Add(u.writeTimeout))
 	_, err := u.pc.WriteTo(payload, u.writeAddr)
-	return err
+	if err != nil {
+		return err
+	}
+
+	u.cm.c.capture.writeUDP(true, u.port(), u.writeAddr, u.isRTP, payload)
+	return nil
 }
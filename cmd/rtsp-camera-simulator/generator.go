@@ -0,0 +1,275 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bluenviron/mediacommon/pkg/codecs/h264"
+	"github.com/bluenviron/mediacommon/pkg/codecs/h265"
+	"github.com/bluenviron/mediacommon/pkg/codecs/mpeg4audio"
+	"github.com/pion/rtp"
+
+	"github.com/bluenviron/gortsplib/v3/pkg/formats"
+	"github.com/bluenviron/gortsplib/v3/pkg/media"
+)
+
+var (
+	h264SPS = []byte{
+		0x67, 0x64, 0x00, 0x0c, 0xac, 0x3b, 0x50, 0xb0,
+		0x4b, 0x42, 0x00, 0x00, 0x03, 0x00, 0x02, 0x00,
+		0x00, 0x03, 0x00, 0x3d, 0x08,
+	}
+	h264PPS = []byte{0x68, 0xee, 0x3c, 0x80}
+
+	h265VPS = []byte{
+		0x40, 0x1, 0xc, 0x1, 0xff, 0xff, 0x1, 0x60,
+		0x0, 0x0, 0x3, 0x0, 0x90, 0x0, 0x0, 0x3,
+		0x0, 0x0, 0x3, 0x0, 0x78, 0x99, 0x98, 0x9,
+	}
+	h265SPS = []byte{
+		0x42, 0x1, 0x1, 0x1, 0x60, 0x0, 0x0, 0x3,
+		0x0, 0x90, 0x0, 0x0, 0x3, 0x0, 0x0, 0x3,
+		0x0, 0x78, 0xa0, 0x3, 0xc0, 0x80, 0x10, 0xe5,
+		0x96, 0x66, 0x69, 0x24, 0xca, 0xe0, 0x10, 0x0,
+		0x0, 0x3, 0x0, 0x10, 0x0, 0x0, 0x3, 0x1,
+		0xe0, 0x80,
+	}
+	h265PPS = []byte{0x44, 0x1, 0xc1, 0x72, 0xb4, 0x62, 0x40}
+)
+
+// videoCodecs and audioCodecs are the codecs that can be generated.
+var (
+	videoCodecs = []string{"h264", "h265", "vp8", "vp9", "none"}
+	audioCodecs = []string{"g711", "g722", "opus", "mpeg4audio", "lpcm", "none"}
+)
+
+// track is a generated media.
+// Generated frames have a valid structure and the requested size, but their content is filler
+// and does not decode into meaningful pictures or sound.
+type track struct {
+	media  *media.Media
+	period time.Duration
+	// generate returns the packets of the n-th frame.
+	generate func(n int, pts time.Duration) ([]*rtp.Packet, error)
+}
+
+func fillFrame(header []byte, size int) []byte {
+	if size < len(header) {
+		size = len(header)
+	}
+	frame := make([]byte, size)
+	copy(frame, header)
+	for i := len(header); i < size; i++ {
+		frame[i] = byte(i)
+	}
+	return frame
+}
+
+// videoTrackConf contains the settings of a generated video track.
+type videoTrackConf struct {
+	Codec   string
+	Bitrate int // bits per second
+	FPS     int
+	GOP     int // frames between two key frames
+}
+
+func newVideoTrack(conf videoTrackConf) (*track, error) {
+	if conf.FPS <= 0 {
+		return nil, fmt.Errorf("invalid frame rate: %d", conf.FPS)
+	}
+	if conf.GOP <= 0 {
+		return nil, fmt.Errorf("invalid GOP size: %d", conf.GOP)
+	}
+
+	frameSize := conf.Bitrate / 8 / conf.FPS
+	period := time.Second / time.Duration(conf.FPS)
+
+	var forma formats.Format
+	var generate func(n int, pts time.Duration) ([]*rtp.Packet, error)
+
+	switch conf.Codec {
+	case "h264":
+		f := &formats.H264{
+			PayloadTyp:        96,
+			SPS:               h264SPS,
+			PPS:               h264PPS,
+			PacketizationMode: 1,
+		}
+		enc := f.CreateEncoder()
+		forma = f
+
+		generate = func(n int, pts time.Duration) ([]*rtp.Packet, error) {
+			if (n % conf.GOP) == 0 {
+				return enc.Encode([][]byte{
+					h264SPS,
+					h264PPS,
+					fillFrame([]byte{byte(h264.NALUTypeIDR) | 0x60}, frameSize),
+				}, pts)
+			}
+			return enc.Encode([][]byte{fillFrame([]byte{byte(h264.NALUTypeNonIDR) | 0x40}, frameSize)}, pts)
+		}
+
+	case "h265":
+		f := &formats.H265{
+			PayloadTyp: 96,
+			VPS:        h265VPS,
+			SPS:        h265SPS,
+			PPS:        h265PPS,
+		}
+		enc := f.CreateEncoder()
+		forma = f
+
+		generate = func(n int, pts time.Duration) ([]*rtp.Packet, error) {
+			if (n % conf.GOP) == 0 {
+				return enc.Encode([][]byte{
+					h265VPS,
+					h265SPS,
+					h265PPS,
+					fillFrame([]byte{byte(h265.NALUType_IDR_W_RADL) << 1, 0x01}, frameSize),
+				}, pts)
+			}
+			return enc.Encode([][]byte{fillFrame([]byte{byte(h265.NALUType_TRAIL_R) << 1, 0x01}, frameSize)}, pts)
+		}
+
+	case "vp8":
+		f := &formats.VP8{
+			PayloadTyp: 96,
+		}
+		enc := f.CreateEncoder()
+		forma = f
+
+		generate = func(n int, pts time.Duration) ([]*rtp.Packet, error) {
+			if (n % conf.GOP) == 0 {
+				// key frame tag, start code, 320x240
+				header := []byte{0x10, 0x00, 0x00, 0x9d, 0x01, 0x2a, 0x40, 0x01, 0xf0, 0x00}
+				return enc.Encode(fillFrame(header, frameSize), pts)
+			}
+			return enc.Encode(fillFrame([]byte{0x11, 0x00, 0x00}, frameSize), pts)
+		}
+
+	case "vp9":
+		f := &formats.VP9{
+			PayloadTyp: 96,
+		}
+		enc := f.CreateEncoder()
+		forma = f
+
+		generate = func(n int, pts time.Duration) ([]*rtp.Packet, error) {
+			if (n % conf.GOP) == 0 {
+				return enc.Encode(fillFrame([]byte{0x82, 0x49, 0x83, 0x42}, frameSize), pts)
+			}
+			return enc.Encode(fillFrame([]byte{0x86, 0x00, 0x40}, frameSize), pts)
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported video codec: %s", conf.Codec)
+	}
+
+	return &track{
+		media: &media.Media{
+			Type:    media.TypeVideo,
+			Formats: []formats.Format{forma},
+		},
+		period:   period,
+		generate: generate,
+	}, nil
+}
+
+func newAudioTrack(codec string) (*track, error) {
+	var forma formats.Format
+	var period time.Duration
+	var generate func(n int, pts time.Duration) ([]*rtp.Packet, error)
+
+	simpleAudio := func(encode func([]byte, time.Duration) (*rtp.Packet, error), frame []byte) {
+		generate = func(n int, pts time.Duration) ([]*rtp.Packet, error) {
+			pkt, err := encode(frame, pts)
+			if err != nil {
+				return nil, err
+			}
+			return []*rtp.Packet{pkt}, nil
+		}
+	}
+
+	switch codec {
+	case "g711":
+		f := &formats.G711{MULaw: true}
+		forma = f
+		period = 20 * time.Millisecond
+
+		// 160 samples of silence
+		frame := make([]byte, 160)
+		for i := range frame {
+			frame[i] = 0xFF
+		}
+		simpleAudio(f.CreateEncoder().Encode, frame)
+
+	case "g722":
+		f := &formats.G722{}
+		forma = f
+		period = 20 * time.Millisecond
+		simpleAudio(f.CreateEncoder().Encode, make([]byte, 160))
+
+	case "opus":
+		f := &formats.Opus{
+			PayloadTyp: 97,
+		}
+		forma = f
+		period = 20 * time.Millisecond
+
+		// 20ms of silence
+		simpleAudio(f.CreateEncoder().Encode, []byte{0xf8, 0xff, 0xfe})
+
+	case "mpeg4audio":
+		f := &formats.MPEG4Audio{
+			PayloadTyp: 97,
+			Config: &mpeg4audio.Config{
+				Type:         mpeg4audio.ObjectTypeAACLC,
+				SampleRate:   48000,
+				ChannelCount: 1,
+			},
+			SizeLength:       13,
+			IndexLength:      3,
+			IndexDeltaLength: 3,
+		}
+		enc := f.CreateEncoder()
+		forma = f
+		period = mpeg4audio.SamplesPerAccessUnit * time.Second / 48000
+
+		// an access unit of silence
+		au := []byte{0x01, 0x40, 0x20, 0x07}
+
+		generate = func(n int, pts time.Duration) ([]*rtp.Packet, error) {
+			return enc.Encode([][]byte{au}, pts)
+		}
+
+	case "lpcm":
+		f := &formats.LPCM{
+			PayloadTyp:   97,
+			BitDepth:     16,
+			SampleRate:   48000,
+			ChannelCount: 1,
+		}
+		enc := f.CreateEncoder()
+		forma = f
+		period = 20 * time.Millisecond
+
+		// 960 samples of silence
+		frame := make([]byte, 960*2)
+
+		generate = func(n int, pts time.Duration) ([]*rtp.Packet, error) {
+			return enc.Encode(frame, pts)
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported audio codec: %s", codec)
+	}
+
+	return &track{
+		media: &media.Media{
+			Type:    media.TypeAudio,
+			Formats: []formats.Format{forma},
+		},
+		period:   period,
+		generate: generate,
+	}, nil
+}
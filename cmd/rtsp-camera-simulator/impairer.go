@@ -0,0 +1,117 @@
+package main
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/pion/rtp"
+)
+
+// impairerConf contains the impairments applied to the packets of a media.
+type impairerConf struct {
+	// probability that a packet is dropped, between 0 and 1.
+	Loss float64
+	// maximum delay added to packets. Packets are delayed by a random amount between zero and this value,
+	// without changing their order.
+	Jitter time.Duration
+	// probability that a packet is swapped with the following one, between 0 and 1.
+	Reorder float64
+}
+
+type impairedPacket struct {
+	pkt       *rtp.Packet
+	ntp       time.Time
+	releaseAt time.Time
+}
+
+// impairer drops, delays and reorders packets before passing them to write.
+type impairer struct {
+	conf  impairerConf
+	rand  func() float64
+	write func(*rtp.Packet, time.Time)
+
+	mutex       sync.Mutex
+	held        *impairedPacket
+	lastRelease time.Time
+
+	queue chan impairedPacket
+	done  chan struct{}
+}
+
+func newImpairer(conf impairerConf, rnd func() float64, write func(*rtp.Packet, time.Time)) *impairer {
+	if rnd == nil {
+		rnd = rand.New(rand.NewSource(time.Now().UnixNano())).Float64
+	}
+
+	im := &impairer{
+		conf:  conf,
+		rand:  rnd,
+		write: write,
+	}
+
+	if conf.Jitter > 0 {
+		im.queue = make(chan impairedPacket, 1024)
+		im.done = make(chan struct{})
+		go im.run()
+	}
+
+	return im
+}
+
+func (im *impairer) close() {
+	if im.queue != nil {
+		close(im.queue)
+		<-im.done
+	}
+}
+
+func (im *impairer) run() {
+	defer close(im.done)
+
+	for ip := range im.queue {
+		time.Sleep(time.Until(ip.releaseAt))
+		im.write(ip.pkt, ip.ntp)
+	}
+}
+
+// process applies impairments to a packet.
+func (im *impairer) process(pkt *rtp.Packet, ntp time.Time) {
+	im.mutex.Lock()
+	defer im.mutex.Unlock()
+
+	if im.conf.Loss > 0 && im.rand() < im.conf.Loss {
+		return
+	}
+
+	if im.held == nil && im.conf.Reorder > 0 && im.rand() < im.conf.Reorder {
+		im.held = &impairedPacket{pkt: pkt, ntp: ntp}
+		return
+	}
+
+	im.send(pkt, ntp)
+
+	if im.held != nil {
+		im.send(im.held.pkt, im.held.ntp)
+		im.held = nil
+	}
+}
+
+func (im *impairer) send(pkt *rtp.Packet, ntp time.Time) {
+	if im.queue == nil {
+		im.write(pkt, ntp)
+		return
+	}
+
+	// release times are monotonic, in order not to introduce additional reordering
+	releaseAt := time.Now().Add(time.Duration(im.rand() * float64(im.conf.Jitter)))
+	if releaseAt.Before(im.lastRelease) {
+		releaseAt = im.lastRelease
+	}
+	im.lastRelease = releaseAt
+
+	select {
+	case im.queue <- impairedPacket{pkt: pkt, ntp: ntp, releaseAt: releaseAt}:
+	default: // queue is full, packet is lost
+	}
+}
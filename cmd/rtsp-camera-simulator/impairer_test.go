@@ -0,0 +1,84 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/stretchr/testify/require"
+)
+
+func sequenceRand(vals ...float64) func() float64 {
+	return func() float64 {
+		v := vals[0]
+		vals = vals[1:]
+		return v
+	}
+}
+
+func TestImpairer(t *testing.T) {
+	for _, ca := range []struct {
+		name string
+		conf impairerConf
+		rand []float64
+		out  []uint16
+	}{
+		{
+			"none",
+			impairerConf{},
+			nil,
+			[]uint16{0, 1, 2, 3},
+		},
+		{
+			"loss",
+			impairerConf{Loss: 0.5},
+			[]float64{0.9, 0.1, 0.9, 0.1},
+			[]uint16{0, 2},
+		},
+		{
+			"reorder",
+			impairerConf{Reorder: 0.5},
+			[]float64{0.9, 0.1, 0.9, 0.9},
+			[]uint16{0, 2, 1, 3},
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			var out []uint16
+
+			im := newImpairer(ca.conf, sequenceRand(ca.rand...), func(pkt *rtp.Packet, ntp time.Time) {
+				out = append(out, pkt.SequenceNumber)
+			})
+			defer im.close()
+
+			for i := 0; i < 4; i++ {
+				im.process(&rtp.Packet{Header: rtp.Header{SequenceNumber: uint16(i)}}, time.Time{})
+			}
+
+			require.Equal(t, ca.out, out)
+		})
+	}
+}
+
+func TestImpairerJitter(t *testing.T) {
+	done := make(chan []uint16)
+	var out []uint16
+
+	im := newImpairer(impairerConf{Jitter: 100 * time.Millisecond},
+		sequenceRand(1, 0, 0.5), func(pkt *rtp.Packet, ntp time.Time) {
+			out = append(out, pkt.SequenceNumber)
+			if len(out) == 3 {
+				done <- out
+			}
+		})
+	defer im.close()
+
+	start := time.Now()
+
+	for i := 0; i < 3; i++ {
+		im.process(&rtp.Packet{Header: rtp.Header{SequenceNumber: uint16(i)}}, time.Time{})
+	}
+
+	// packets are delayed without being reordered
+	require.Equal(t, []uint16{0, 1, 2}, <-done)
+	require.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+}
@@ -0,0 +1,188 @@
+// rtsp-camera-simulator is a RTSP server that simulates a large number of cameras.
+// Each camera is served on its own path and provides generated media, or media read from a MPEG-TS
+// file in a loop. Packet loss, jitter and reordering can be injected into the served streams.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/bluenviron/gortsplib/v3"
+	"github.com/bluenviron/gortsplib/v3/pkg/base"
+)
+
+type serverHandler struct {
+	paths map[string]*path
+}
+
+func (sh *serverHandler) findStream(p string) (*base.Response, *gortsplib.ServerStream, error) {
+	pa, ok := sh.paths[p]
+	if !ok {
+		return &base.Response{
+			StatusCode: base.StatusNotFound,
+		}, nil, fmt.Errorf("path '%s' not found", p)
+	}
+
+	return &base.Response{
+		StatusCode: base.StatusOK,
+	}, pa.stream, nil
+}
+
+// called when receiving a DESCRIBE request.
+func (sh *serverHandler) OnDescribe(ctx *gortsplib.ServerHandlerOnDescribeCtx) (*base.Response, *gortsplib.ServerStream, error) {
+	return sh.findStream(ctx.Path)
+}
+
+// called when receiving a SETUP request.
+func (sh *serverHandler) OnSetup(ctx *gortsplib.ServerHandlerOnSetupCtx) (*base.Response, *gortsplib.ServerStream, error) {
+	return sh.findStream(ctx.Path)
+}
+
+// called when receiving a PLAY request.
+func (sh *serverHandler) OnPlay(ctx *gortsplib.ServerHandlerOnPlayCtx) (*base.Response, error) {
+	return &base.Response{
+		StatusCode: base.StatusOK,
+	}, nil
+}
+
+func checkProbability(name string, v float64) error {
+	if v < 0 || v > 1 {
+		return fmt.Errorf("%s must be between 0 and 1", name)
+	}
+	return nil
+}
+
+func run() error {
+	rtspAddress := flag.String("rtsp-address", ":8554", "address of the RTSP listener")
+	udpRTPAddress := flag.String("udp-rtp-address", ":8000", "address of the UDP/RTP listener (empty to disable UDP)")
+	udpRTCPAddress := flag.String("udp-rtcp-address", ":8001", "address of the UDP/RTCP listener (empty to disable UDP)")
+	pathCount := flag.Int("paths", 1, "number of paths (cameras)")
+	pathPrefix := flag.String("path-prefix", "cam", "prefix of path names; paths are named <prefix>1 ... <prefix>N")
+	file := flag.String("file", "", "MPEG-TS file to serve in a loop, instead of generated media")
+	videoCodec := flag.String("video", "h264",
+		"video codec of generated media ("+strings.Join(videoCodecs, ", ")+")")
+	videoBitrate := flag.Int("video-bitrate", 2000000, "bitrate of generated video, in bits per second")
+	videoFPS := flag.Int("video-fps", 25, "frame rate of generated video")
+	videoGOP := flag.Int("video-gop", 50, "frames between two key frames of generated video")
+	audioCodec := flag.String("audio", "g711",
+		"audio codec of generated media ("+strings.Join(audioCodecs, ", ")+")")
+	loss := flag.Float64("loss", 0, "probability that a packet is dropped, between 0 and 1")
+	jitter := flag.Duration("jitter", 0, "maximum delay randomly added to packets")
+	reorder := flag.Float64("reorder", 0, "probability that a packet is swapped with the following one, between 0 and 1")
+	flag.Parse()
+
+	if *pathCount <= 0 {
+		return fmt.Errorf("number of paths must be greater than zero")
+	}
+
+	if err := checkProbability("loss", *loss); err != nil {
+		return err
+	}
+	if err := checkProbability("reorder", *reorder); err != nil {
+		return err
+	}
+
+	conf := impairerConf{
+		Loss:    *loss,
+		Jitter:  *jitter,
+		Reorder: *reorder,
+	}
+
+	h := &serverHandler{
+		paths: make(map[string]*path),
+	}
+
+	defer func() {
+		for _, p := range h.paths {
+			p.close()
+		}
+	}()
+
+	for i := 1; i <= *pathCount; i++ {
+		name := "/" + *pathPrefix + fmt.Sprintf("%d", i)
+
+		if *file != "" {
+			p, err := newFilePath(name, *file, conf)
+			if err != nil {
+				return err
+			}
+			h.paths[name] = p
+			continue
+		}
+
+		// tracks are allocated for each path, since encoders keep the state of the stream
+		var tracks []*track
+
+		if *videoCodec != "none" {
+			t, err := newVideoTrack(videoTrackConf{
+				Codec:   *videoCodec,
+				Bitrate: *videoBitrate,
+				FPS:     *videoFPS,
+				GOP:     *videoGOP,
+			})
+			if err != nil {
+				return err
+			}
+			tracks = append(tracks, t)
+		}
+
+		if *audioCodec != "none" {
+			t, err := newAudioTrack(*audioCodec)
+			if err != nil {
+				return err
+			}
+			tracks = append(tracks, t)
+		}
+
+		if len(tracks) == 0 {
+			return fmt.Errorf("at least one between video and audio must be enabled")
+		}
+
+		h.paths[name] = newGeneratedPath(name, tracks, conf)
+	}
+
+	s := &gortsplib.Server{
+		Handler:        h,
+		RTSPAddress:    *rtspAddress,
+		UDPRTPAddress:  *udpRTPAddress,
+		UDPRTCPAddress: *udpRTCPAddress,
+	}
+
+	err := s.Start()
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	log.Printf("serving %d paths on rtsp://localhost%s/%s1 ... /%s%d",
+		*pathCount, *rtspAddress, *pathPrefix, *pathPrefix, *pathCount)
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- s.Wait()
+	}()
+
+	select {
+	case <-interrupt:
+		log.Printf("shutting down")
+		return nil
+
+	case err := <-errChan:
+		return err
+	}
+}
+
+func main() {
+	err := run()
+	if err != nil {
+		log.Printf("ERR: %v", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/pion/rtp"
+
+	"github.com/bluenviron/gortsplib/v3"
+	"github.com/bluenviron/gortsplib/v3/pkg/media"
+	"github.com/bluenviron/gortsplib/v3/pkg/mpegtssource"
+)
+
+// path is a simulated camera, that writes media into a ServerStream.
+type path struct {
+	name      string
+	stream    *gortsplib.ServerStream
+	impairers map[*media.Media]*impairer
+
+	wg        sync.WaitGroup
+	terminate chan struct{}
+}
+
+func newPath(name string, medias media.Medias, conf impairerConf) *path {
+	p := &path{
+		name:      name,
+		stream:    gortsplib.NewServerStream(medias),
+		impairers: make(map[*media.Media]*impairer),
+		terminate: make(chan struct{}),
+	}
+
+	for _, medi := range medias {
+		cmedi := medi
+		p.impairers[medi] = newImpairer(conf, nil, func(pkt *rtp.Packet, ntp time.Time) {
+			p.stream.WritePacketRTPWithNTP(cmedi, pkt, ntp)
+		})
+	}
+
+	return p
+}
+
+// newGeneratedPath allocates a path that serves generated tracks.
+func newGeneratedPath(name string, tracks []*track, conf impairerConf) *path {
+	medias := make(media.Medias, len(tracks))
+	for i, t := range tracks {
+		medias[i] = t.media
+	}
+
+	p := newPath(name, medias, conf)
+	start := time.Now()
+
+	for _, t := range tracks {
+		p.wg.Add(1)
+		go p.runTrack(t, start)
+	}
+
+	return p
+}
+
+// newFilePath allocates a path that serves a MPEG-TS file in a loop.
+func newFilePath(name string, fileName string, conf impairerConf) (*path, error) {
+	source, err := mpegtssource.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	p := newPath(name, source.Medias(), conf)
+
+	p.wg.Add(1)
+	go p.runFile(source)
+
+	return p, nil
+}
+
+func (p *path) close() {
+	close(p.terminate)
+	p.wg.Wait()
+
+	for _, im := range p.impairers {
+		im.close()
+	}
+
+	p.stream.Close()
+}
+
+// wait waits until the given time or the path termination.
+func (p *path) wait(t time.Time) bool {
+	timer := time.NewTimer(time.Until(t))
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-p.terminate:
+		return false
+	}
+}
+
+func (p *path) runTrack(t *track, start time.Time) {
+	defer p.wg.Done()
+
+	im := p.impairers[t.media]
+
+	for n := 0; ; n++ {
+		pts := time.Duration(n) * t.period
+		ntp := start.Add(pts)
+
+		if !p.wait(ntp) {
+			return
+		}
+
+		pkts, err := t.generate(n, pts)
+		if err != nil {
+			log.Printf("[%s] ERR: %v", p.name, err)
+			return
+		}
+
+		for _, pkt := range pkts {
+			im.process(pkt, ntp)
+		}
+	}
+}
+
+func (p *path) runFile(source *mpegtssource.Source) {
+	defer p.wg.Done()
+	defer source.Close()
+
+	start := time.Now()
+	duration := source.Duration()
+	loop := 0
+	empty := true
+
+	for {
+		medi, pkt, pos, err := source.ReadPacket()
+		if err != nil {
+			if err != io.EOF {
+				log.Printf("[%s] ERR: %v", p.name, err)
+				return
+			}
+
+			if empty {
+				log.Printf("[%s] ERR: file is empty", p.name)
+				return
+			}
+
+			// restart from the beginning of the file
+			_, err = source.Seek(0)
+			if err != nil {
+				log.Printf("[%s] ERR: %v", p.name, err)
+				return
+			}
+			loop++
+			empty = true
+			continue
+		}
+
+		empty = false
+
+		// timestamps of the next loops follow the ones of the previous loops
+		offset := time.Duration(loop) * duration
+		pkt.Timestamp += uint32(int64(offset) * int64(medi.Formats[0].ClockRate()) / int64(time.Second))
+
+		ntp := start.Add(offset + pos)
+
+		if !p.wait(ntp) {
+			return
+		}
+
+		p.impairers[medi].process(pkt, ntp)
+	}
+}
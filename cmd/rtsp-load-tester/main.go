@@ -0,0 +1,213 @@
+// rtsp-load-tester opens a large number of RTSP readers against a server and reports
+// aggregate packet loss, interarrival jitter and startup latency.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pion/rtp"
+
+	"github.com/bluenviron/gortsplib/v3"
+	"github.com/bluenviron/gortsplib/v3/pkg/url"
+)
+
+func parseTransport(v string) (*gortsplib.Transport, error) {
+	switch strings.ToLower(v) {
+	case "":
+		return nil, nil
+
+	case "udp":
+		t := gortsplib.TransportUDP
+		return &t, nil
+
+	case "multicast":
+		t := gortsplib.TransportUDPMulticast
+		return &t, nil
+
+	case "tcp":
+		t := gortsplib.TransportTCP
+		return &t, nil
+	}
+
+	return nil, fmt.Errorf("invalid transport: %s", v)
+}
+
+// readerURLs returns the URLs of readers.
+// When paths is greater than zero, readers are distributed among <url>1 ... <url><paths>.
+func readerURLs(rawURL string, paths int, readers int) []string {
+	ret := make([]string, readers)
+	for i := range ret {
+		if paths > 0 {
+			ret[i] = rawURL + fmt.Sprintf("%d", (i%paths)+1)
+		} else {
+			ret[i] = rawURL
+		}
+	}
+	return ret
+}
+
+// runReader reads a stream until terminate is closed or an error occurs.
+func runReader(rawURL string, transport *gortsplib.Transport, stats *readerStats, terminate chan struct{}) error {
+	start := time.Now()
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+
+	c := gortsplib.Client{
+		Transport: transport,
+		// warnings about lost packets are replaced by statistics
+		Log: func(level gortsplib.LogLevel, format string, args ...interface{}) {
+			if level >= gortsplib.LogLevelError {
+				log.Printf("[%s] "+format, append([]interface{}{rawURL}, args...)...)
+			}
+		},
+	}
+
+	err = c.Start(u.Scheme, u.Host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	medias, baseURL, _, err := c.Describe(u)
+	if err != nil {
+		return err
+	}
+
+	err = c.SetupAll(medias, baseURL)
+	if err != nil {
+		return err
+	}
+
+	for _, medi := range medias {
+		for _, forma := range medi.Formats {
+			s := newStreamStats(forma.ClockRate())
+			stats.addStream(s)
+
+			c.OnPacketRTP(medi, forma, func(pkt *rtp.Packet) {
+				now := time.Now()
+				stats.setStarted(now.Sub(start))
+				s.processPacket(pkt, now)
+			})
+		}
+	}
+
+	_, err = c.Play(nil)
+	if err != nil {
+		return err
+	}
+
+	waitErr := make(chan error, 1)
+	go func() {
+		waitErr <- c.Wait()
+	}()
+
+	select {
+	case err := <-waitErr:
+		return err
+
+	case <-terminate:
+		return nil
+	}
+}
+
+func run() error {
+	rawURL := flag.String("url", "rtsp://localhost:8554/cam", "URL of the stream, or URL prefix when -paths is set")
+	paths := flag.Int("paths", 1, "number of paths; readers are distributed among <url>1 ... <url>N (0 to use -url as is)")
+	readers := flag.Int("readers", 1, "number of readers")
+	transportFlag := flag.String("transport", "", "transport protocol (udp, multicast, tcp); by default it's negotiated")
+	duration := flag.Duration("duration", 0, "test duration (0 to run until interrupted)")
+	rampUp := flag.Duration("ramp-up", 10*time.Millisecond, "delay between the start of two readers")
+	reportInterval := flag.Duration("report-interval", 5*time.Second, "interval between two reports")
+	flag.Parse()
+
+	if *readers <= 0 {
+		return fmt.Errorf("number of readers must be greater than zero")
+	}
+
+	transport, err := parseTransport(*transportFlag)
+	if err != nil {
+		return err
+	}
+
+	urls := readerURLs(*rawURL, *paths, *readers)
+	stats := make([]*readerStats, *readers)
+	terminate := make(chan struct{})
+	var wg sync.WaitGroup
+
+	defer func() {
+		close(terminate)
+		wg.Wait()
+		log.Printf("final report: %v", newReport(stats))
+	}()
+
+	for i := range stats {
+		stats[i] = &readerStats{}
+	}
+
+	// the launcher is part of the wait group, in order to add readers safely
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		for i, u := range urls {
+			select {
+			case <-time.After(*rampUp):
+			case <-terminate:
+				return
+			}
+
+			wg.Add(1)
+			go func(u string, rs *readerStats) {
+				defer wg.Done()
+
+				err := runReader(u, transport, rs, terminate)
+				if err != nil {
+					rs.setFailed()
+					log.Printf("[%s] ERR: %v", u, err)
+				}
+			}(u, stats[i])
+		}
+	}()
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+
+	var end <-chan time.Time
+	if *duration > 0 {
+		end = time.After(*duration)
+	}
+
+	ticker := time.NewTicker(*reportInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			log.Printf("%v", newReport(stats))
+
+		case <-end:
+			return nil
+
+		case <-interrupt:
+			return nil
+		}
+	}
+}
+
+func main() {
+	err := run()
+	if err != nil {
+		log.Printf("ERR: %v", err)
+		os.Exit(1)
+	}
+}
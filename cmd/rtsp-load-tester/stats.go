@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pion/rtp"
+)
+
+// streamStats computes loss and interarrival jitter of a RTP stream, as described in RFC 3550, appendix A.
+type streamStats struct {
+	clockRate int
+
+	mutex       sync.Mutex
+	initialized bool
+	baseSeq     uint16
+	maxSeq      uint16
+	cycles      uint64
+	received    uint64
+	prevTransit int64
+	jitter      float64
+}
+
+func newStreamStats(clockRate int) *streamStats {
+	return &streamStats{
+		clockRate: clockRate,
+	}
+}
+
+func (s *streamStats) processPacket(pkt *rtp.Packet, now time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.received++
+
+	if !s.initialized {
+		s.initialized = true
+		s.baseSeq = pkt.SequenceNumber
+		s.maxSeq = pkt.SequenceNumber
+	} else if diff := pkt.SequenceNumber - s.maxSeq; diff != 0 && diff < 0x8000 {
+		// sequence number is ahead of the maximum one
+		if pkt.SequenceNumber < s.maxSeq {
+			s.cycles += 1 << 16
+		}
+		s.maxSeq = pkt.SequenceNumber
+	}
+
+	if s.clockRate <= 0 {
+		return
+	}
+
+	// arrival time and RTP timestamp are compared in the same units
+	arrival := now.UnixNano() * int64(s.clockRate) / int64(time.Second)
+	transit := arrival - int64(pkt.Timestamp)
+
+	if s.received > 1 {
+		// the difference is computed with 32-bit arithmetic, in order to handle timestamp wrap-arounds
+		d := float64(int32(transit - s.prevTransit))
+		if d < 0 {
+			d = -d
+		}
+		s.jitter += (d - s.jitter) / 16
+	}
+	s.prevTransit = transit
+}
+
+// lost returns the number of lost packets, that is the difference between expected and received packets.
+func (s *streamStats) lost() uint64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.initialized {
+		return 0
+	}
+
+	expected := s.cycles + uint64(s.maxSeq) - uint64(s.baseSeq) + 1
+	if s.received >= expected {
+		return 0
+	}
+	return expected - s.received
+}
+
+func (s *streamStats) receivedCount() uint64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.received
+}
+
+// jitterDuration returns the interarrival jitter.
+func (s *streamStats) jitterDuration() time.Duration {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.clockRate <= 0 {
+		return 0
+	}
+	return time.Duration(s.jitter * float64(time.Second) / float64(s.clockRate))
+}
+
+// readerStats contains the statistics of a reader.
+type readerStats struct {
+	mutex          sync.Mutex
+	failed         bool
+	started        bool
+	startupLatency time.Duration
+	streams        []*streamStats
+}
+
+func (r *readerStats) addStream(s *streamStats) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.streams = append(r.streams, s)
+}
+
+// setStarted saves the startup latency, that is the time elapsed between the connection and the first packet.
+func (r *readerStats) setStarted(latency time.Duration) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if !r.started {
+		r.started = true
+		r.startupLatency = latency
+	}
+}
+
+func (r *readerStats) setFailed() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.failed = true
+}
+
+// report contains aggregate statistics of all readers.
+type report struct {
+	readers           int
+	started           int
+	failed            int
+	minStartupLatency time.Duration
+	avgStartupLatency time.Duration
+	maxStartupLatency time.Duration
+	received          uint64
+	lost              uint64
+	avgJitter         time.Duration
+	maxJitter         time.Duration
+}
+
+func newReport(readers []*readerStats) *report {
+	r := &report{
+		readers: len(readers),
+	}
+
+	var totalLatency time.Duration
+	var totalJitter time.Duration
+	streamCount := 0
+
+	for _, rs := range readers {
+		rs.mutex.Lock()
+		failed := rs.failed
+		started := rs.started
+		latency := rs.startupLatency
+		streams := append([]*streamStats(nil), rs.streams...)
+		rs.mutex.Unlock()
+
+		if failed {
+			r.failed++
+		}
+
+		if started {
+			if r.started == 0 || latency < r.minStartupLatency {
+				r.minStartupLatency = latency
+			}
+			if latency > r.maxStartupLatency {
+				r.maxStartupLatency = latency
+			}
+			totalLatency += latency
+			r.started++
+		}
+
+		for _, s := range streams {
+			r.received += s.receivedCount()
+			r.lost += s.lost()
+
+			jitter := s.jitterDuration()
+			totalJitter += jitter
+			if jitter > r.maxJitter {
+				r.maxJitter = jitter
+			}
+			streamCount++
+		}
+	}
+
+	if r.started != 0 {
+		r.avgStartupLatency = totalLatency / time.Duration(r.started)
+	}
+
+	if streamCount != 0 {
+		r.avgJitter = totalJitter / time.Duration(streamCount)
+	}
+
+	return r
+}
+
+func (r *report) lossPercent() float64 {
+	total := r.received + r.lost
+	if total == 0 {
+		return 0
+	}
+	return float64(r.lost) * 100 / float64(total)
+}
+
+func (r *report) String() string {
+	return fmt.Sprintf("readers: %d started, %d failed, %d total; "+
+		"startup latency: min %v, avg %v, max %v; "+
+		"packets: %d received, %d lost (%.2f%%); "+
+		"jitter: avg %v, max %v",
+		r.started, r.failed, r.readers,
+		r.minStartupLatency, r.avgStartupLatency, r.maxStartupLatency,
+		r.received, r.lost, r.lossPercent(),
+		r.avgJitter, r.maxJitter)
+}
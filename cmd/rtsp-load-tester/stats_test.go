@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamStatsLoss(t *testing.T) {
+	s := newStreamStats(0)
+	now := time.Now()
+
+	// sequence numbers wrap around, a packet is reordered and two are lost
+	for _, seq := range []uint16{65533, 65535, 65534, 1, 3} {
+		s.processPacket(&rtp.Packet{Header: rtp.Header{SequenceNumber: seq}}, now)
+	}
+
+	require.Equal(t, uint64(5), s.receivedCount())
+	require.Equal(t, uint64(2), s.lost())
+}
+
+func TestStreamStatsJitter(t *testing.T) {
+	s := newStreamStats(90000)
+	start := time.Now()
+
+	// packets are sent every 100ms and arrive alternately on time and 10ms late
+	for i := 0; i < 200; i++ {
+		delay := time.Duration(i%2) * 10 * time.Millisecond
+		s.processPacket(&rtp.Packet{Header: rtp.Header{
+			SequenceNumber: uint16(i),
+			Timestamp:      uint32(i * 9000),
+		}}, start.Add(time.Duration(i)*100*time.Millisecond+delay))
+	}
+
+	require.Equal(t, uint64(0), s.lost())
+	require.InDelta(t, float64(10*time.Millisecond), float64(s.jitterDuration()), float64(100*time.Microsecond))
+}
+
+func TestReport(t *testing.T) {
+	s1 := newStreamStats(0)
+	s1.processPacket(&rtp.Packet{Header: rtp.Header{SequenceNumber: 1}}, time.Now())
+	s1.processPacket(&rtp.Packet{Header: rtp.Header{SequenceNumber: 4}}, time.Now())
+
+	r1 := &readerStats{}
+	r1.addStream(s1)
+	r1.setStarted(100 * time.Millisecond)
+	r1.setStarted(500 * time.Millisecond)
+
+	r2 := &readerStats{}
+	r2.setStarted(300 * time.Millisecond)
+
+	r3 := &readerStats{}
+	r3.setFailed()
+
+	r := newReport([]*readerStats{r1, r2, r3})
+	require.Equal(t, 3, r.readers)
+	require.Equal(t, 2, r.started)
+	require.Equal(t, 1, r.failed)
+	require.Equal(t, 100*time.Millisecond, r.minStartupLatency)
+	require.Equal(t, 200*time.Millisecond, r.avgStartupLatency)
+	require.Equal(t, 300*time.Millisecond, r.maxStartupLatency)
+	require.Equal(t, uint64(2), r.received)
+	require.Equal(t, uint64(2), r.lost)
+	require.Equal(t, 50.0, r.lossPercent())
+}
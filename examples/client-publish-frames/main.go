@@ -0,0 +1,70 @@
+package main
+
+import (
+	"math"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v3"
+	"github.com/bluenviron/gortsplib/v3/pkg/formats"
+	"github.com/bluenviron/gortsplib/v3/pkg/media"
+)
+
+// This example shows how to
+// 1. generate a sine wave
+// 2. connect to a RTSP server, announce an LPCM media
+// 3. write audio frames to the server, without handling RTP packets.
+
+const (
+	sampleRate      = 44100
+	frequency       = 300
+	frameDuration   = 20 * time.Millisecond
+	samplesPerFrame = sampleRate * int(frameDuration) / int(time.Second)
+)
+
+func main() {
+	// create a media that contains a LPCM format
+	forma := &formats.LPCM{
+		PayloadTyp:   96,
+		BitDepth:     16,
+		SampleRate:   sampleRate,
+		ChannelCount: 1,
+	}
+	medi := &media.Media{
+		Type:    media.TypeAudio,
+		Formats: []formats.Format{forma},
+	}
+
+	c := gortsplib.Client{}
+
+	// connect to the server and start recording the media
+	err := c.StartRecording("rtsp://localhost:8554/mystream", media.Medias{medi})
+	if err != nil {
+		panic(err)
+	}
+	defer c.Close()
+
+	ticker := time.NewTicker(frameDuration)
+	defer ticker.Stop()
+
+	sampleCount := 0
+
+	for range ticker.C {
+		// generate 16-bit big endian samples
+		frame := make([]byte, samplesPerFrame*2)
+		for i := 0; i < samplesPerFrame; i++ {
+			v := int16(math.Sin(2*math.Pi*frequency*float64(sampleCount+i)/sampleRate) * math.MaxInt16 / 2)
+			frame[i*2] = byte(v >> 8)
+			frame[i*2+1] = byte(v)
+		}
+
+		// PTS is computed from the number of samples written so far
+		pts := time.Duration(sampleCount) * time.Second / sampleRate
+		sampleCount += samplesPerFrame
+
+		// packetize the frame and write it to the server
+		err = c.WriteAccessUnit(medi, forma, pts, [][]byte{frame})
+		if err != nil {
+			panic(err)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/bluenviron/gortsplib/v3"
+	"github.com/bluenviron/gortsplib/v3/pkg/capture"
+	"github.com/bluenviron/gortsplib/v3/pkg/formats"
+	"github.com/bluenviron/gortsplib/v3/pkg/media"
+	"github.com/bluenviron/gortsplib/v3/pkg/url"
+	"github.com/pion/rtp"
+)
+
+// This example shows how to
+// 1. connect to a RTSP server
+// 2. read all media streams on a path
+// 3. save RTSP messages and RTP/RTCP packets into a pcapng file, that can be opened with Wireshark
+//    or replayed with the server-replay-capture example.
+
+func main() {
+	f, err := os.Create("capture.pcapng")
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+
+	c := gortsplib.Client{
+		Capture: capture.NewPcapngWriter(f),
+	}
+
+	// parse URL
+	u, err := url.Parse("rtsp://localhost:8554/mystream")
+	if err != nil {
+		panic(err)
+	}
+
+	// connect to the server
+	err = c.Start(u.Scheme, u.Host)
+	if err != nil {
+		panic(err)
+	}
+	defer c.Close()
+
+	// find published medias
+	medias, baseURL, _, err := c.Describe(u)
+	if err != nil {
+		panic(err)
+	}
+
+	// setup all medias
+	err = c.SetupAll(medias, baseURL)
+	if err != nil {
+		panic(err)
+	}
+
+	// called when a RTP packet arrives
+	c.OnPacketRTPAny(func(medi *media.Media, forma formats.Format, pkt *rtp.Packet) {
+		log.Printf("RTP packet from media %v\n", medi)
+	})
+
+	// start playing
+	_, err = c.Play(nil)
+	if err != nil {
+		panic(err)
+	}
+
+	log.Printf("saving into capture.pcapng")
+
+	// wait until a fatal error
+	panic(c.Wait())
+}
@@ -5,9 +5,9 @@ import (
 
 	"github.com/bluenviron/gortsplib/v3"
 	"github.com/bluenviron/gortsplib/v3/pkg/formats"
-	"github.com/bluenviron/gortsplib/v3/pkg/formats/rtph264"
+	"github.com/bluenviron/gortsplib/v3/pkg/media"
+	"github.com/bluenviron/gortsplib/v3/pkg/mpegtsrecorder"
 	"github.com/bluenviron/gortsplib/v3/pkg/url"
-	"github.com/pion/rtp"
 )
 
 // This example shows how to
@@ -44,36 +44,28 @@ func main() {
 		panic("media not found")
 	}
 
-	// setup RTP/H264->H264 decoder
-	rtpDec := forma.CreateDecoder()
-
-	// setup H264->MPEGTS muxer
-	mpegtsMuxer, err := newMPEGTSMuxer(forma.SPS, forma.PPS)
+	// setup a single media
+	_, err = c.Setup(medi, baseURL, 0, 0)
 	if err != nil {
 		panic(err)
 	}
 
-	// setup a single media
-	_, err = c.Setup(medi, baseURL, 0, 0)
+	// setup a MPEG-TS recorder
+	rec := &mpegtsrecorder.Recorder{
+		Medias: media.Medias{medi},
+		Path:   "mystream.ts",
+		OnError: func(err error) {
+			log.Printf("ERR: %v", err)
+		},
+	}
+	err = rec.Start()
 	if err != nil {
 		panic(err)
 	}
+	defer rec.Close()
 
 	// called when a RTP packet arrives
-	c.OnPacketRTP(medi, forma, func(pkt *rtp.Packet) {
-		// extract NALUs from RTP packets
-		// DecodeUntilMarker is necessary for the DTS extractor to work
-		nalus, pts, err := rtpDec.DecodeUntilMarker(pkt)
-		if err != nil {
-			if err != rtph264.ErrNonStartingPacketAndNoPrevious && err != rtph264.ErrMorePacketsNeeded {
-				log.Printf("ERR: %v", err)
-			}
-			return
-		}
-
-		// encode H264 NALUs into MPEG-TS
-		mpegtsMuxer.encode(nalus, pts)
-	})
+	rec.Attach(&c)
 
 	// start playing
 	_, err = c.Play(nil)
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/bluenviron/gortsplib/v3"
+	"github.com/bluenviron/gortsplib/v3/pkg/fmp4"
+	"github.com/bluenviron/gortsplib/v3/pkg/formats"
+	"github.com/bluenviron/gortsplib/v3/pkg/formats/rtph264"
+	"github.com/bluenviron/gortsplib/v3/pkg/media"
+	"github.com/bluenviron/gortsplib/v3/pkg/url"
+	"github.com/pion/rtp"
+)
+
+// This example shows how to
+// 1. connect to a RTSP server
+// 2. check if there's a H264 media
+// 3. save the content of the H264 media into fragmented MP4 files
+//    (an initialization segment and a series of media segments)
+
+func main() {
+	c := gortsplib.Client{}
+
+	// parse URL
+	u, err := url.Parse("rtsp://localhost:8554/mystream")
+	if err != nil {
+		panic(err)
+	}
+
+	// connect to the server
+	err = c.Start(u.Scheme, u.Host)
+	if err != nil {
+		panic(err)
+	}
+	defer c.Close()
+
+	// find published medias
+	medias, baseURL, _, err := c.Describe(u)
+	if err != nil {
+		panic(err)
+	}
+
+	// find the H264 media and format
+	var forma *formats.H264
+	medi := medias.FindFormat(&forma)
+	if medi == nil {
+		panic("media not found")
+	}
+
+	// setup RTP/H264->H264 decoder
+	rtpDec := forma.CreateDecoder()
+
+	// setup H264->fMP4 writer
+	initCount := 0
+	segmentCount := 0
+	w := &fmp4.Writer{
+		Medias: media.Medias{medi},
+		OnInit: func(init []byte) error {
+			// a new initialization segment is generated when the SPS or PPS change
+			fpath := fmt.Sprintf("init_%d.mp4", initCount)
+			initCount++
+			log.Printf("writing %s", fpath)
+			return os.WriteFile(fpath, init, 0o644)
+		},
+		OnSegment: func(segment []byte) error {
+			fpath := fmt.Sprintf("segment_%d.m4s", segmentCount)
+			segmentCount++
+			log.Printf("writing %s", fpath)
+			return os.WriteFile(fpath, segment, 0o644)
+		},
+	}
+	err = w.Start()
+	if err != nil {
+		panic(err)
+	}
+	defer w.Close()
+
+	// setup a single media
+	_, err = c.Setup(medi, baseURL, 0, 0)
+	if err != nil {
+		panic(err)
+	}
+
+	// called when a RTP packet arrives
+	c.OnPacketRTP(medi, forma, func(pkt *rtp.Packet) {
+		// extract access units from RTP packets
+		// DecodeUntilMarker is necessary for the DTS extractor to work
+		au, pts, err := rtpDec.DecodeUntilMarker(pkt)
+		if err != nil {
+			if err != rtph264.ErrNonStartingPacketAndNoPrevious && err != rtph264.ErrMorePacketsNeeded {
+				log.Printf("ERR: %v", err)
+			}
+			return
+		}
+
+		// write the access unit into fMP4
+		err = w.WriteH264(forma, pts, au)
+		if err != nil {
+			log.Printf("ERR: %v", err)
+		}
+	})
+
+	// start playing
+	_, err = c.Play(nil)
+	if err != nil {
+		panic(err)
+	}
+
+	// wait until a fatal error
+	panic(c.Wait())
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"log"
+
+	"github.com/bluenviron/gortsplib/v3"
+	"github.com/bluenviron/gortsplib/v3/pkg/formats"
+	"github.com/bluenviron/gortsplib/v3/pkg/media"
+	"github.com/bluenviron/gortsplib/v3/pkg/url"
+)
+
+// This example shows how to
+// 1. connect to a RTSP server
+// 2. read all media streams on a path
+// 3. receive access units instead of RTP packets.
+
+func main() {
+	c := gortsplib.Client{}
+
+	// parse URL
+	u, err := url.Parse("rtsp://localhost:8554/mystream")
+	if err != nil {
+		panic(err)
+	}
+
+	// connect to the server
+	err = c.Start(u.Scheme, u.Host)
+	if err != nil {
+		panic(err)
+	}
+	defer c.Close()
+
+	// find published medias
+	medias, baseURL, _, err := c.Describe(u)
+	if err != nil {
+		panic(err)
+	}
+
+	// setup all medias
+	err = c.SetupAll(medias, baseURL)
+	if err != nil {
+		panic(err)
+	}
+
+	// called when an access unit is decoded
+	c.OnFrameAny(func(medi *media.Media, forma formats.Format, fr *gortsplib.Frame) {
+		log.Printf("frame from format %s, pts=%v dts=%v ntp=%v keyframe=%v lost=%d units=%d\n",
+			forma, fr.PTS, fr.DTS, fr.NTP, fr.KeyFrame, fr.PacketsLost, len(fr.Payload))
+	})
+
+	// start playing
+	_, err = c.Play(nil)
+	if err != nil {
+		panic(err)
+	}
+
+	// wait until a fatal error
+	panic(c.Wait())
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"log"
+
+	"github.com/bluenviron/gortsplib/v3"
+	"github.com/bluenviron/gortsplib/v3/pkg/rtmpbridge"
+	"github.com/bluenviron/gortsplib/v3/pkg/url"
+)
+
+// This example shows how to
+// 1. connect to a RTSP server and read all medias on a path
+// 2. push the H264 and MPEG-4 Audio medias to a RTMP server.
+
+func main() {
+	c := gortsplib.Client{}
+
+	// parse URL
+	u, err := url.Parse("rtsp://localhost:8554/mystream")
+	if err != nil {
+		panic(err)
+	}
+
+	// connect to the server
+	err = c.Start(u.Scheme, u.Host)
+	if err != nil {
+		panic(err)
+	}
+	defer c.Close()
+
+	// find published medias
+	medias, baseURL, _, err := c.Describe(u)
+	if err != nil {
+		panic(err)
+	}
+
+	// setup all medias
+	err = c.SetupAll(medias, baseURL)
+	if err != nil {
+		panic(err)
+	}
+
+	// connect to the RTMP server and start publishing
+	p := &rtmpbridge.Publisher{
+		URL:    "rtmp://localhost/live/mystream",
+		Medias: medias,
+		OnError: func(err error) {
+			log.Printf("ERR: %v", err)
+		},
+	}
+	err = p.Start()
+	if err != nil {
+		panic(err)
+	}
+	defer p.Close()
+
+	// route RTP packets to the publisher
+	p.Attach(&c)
+
+	// start playing
+	_, err = c.Play(nil)
+	if err != nil {
+		panic(err)
+	}
+
+	// wait until a fatal error
+	panic(c.Wait())
+}
@@ -5,13 +5,10 @@ import (
 	"log"
 	"sync"
 
-	"github.com/pion/rtp"
-
 	"github.com/bluenviron/gortsplib/v3"
 	"github.com/bluenviron/gortsplib/v3/pkg/base"
 	"github.com/bluenviron/gortsplib/v3/pkg/formats"
-	"github.com/bluenviron/gortsplib/v3/pkg/formats/rtph264"
-	"github.com/bluenviron/gortsplib/v3/pkg/media"
+	"github.com/bluenviron/gortsplib/v3/pkg/mpegtsrecorder"
 )
 
 // This example shows how to
@@ -20,12 +17,9 @@ import (
 // 3. save the content of the H264 media into a file in MPEG-TS format
 
 type serverHandler struct {
-	mutex       sync.Mutex
-	publisher   *gortsplib.ServerSession
-	media       *media.Media
-	format      *formats.H264
-	rtpDec      *rtph264.Decoder
-	mpegtsMuxer *mpegtsMuxer
+	mutex     sync.Mutex
+	publisher *gortsplib.ServerSession
+	recorder  *mpegtsrecorder.Recorder
 }
 
 // called when a connection is opened.
@@ -50,8 +44,13 @@ func (sh *serverHandler) OnSessionClose(ctx *gortsplib.ServerHandlerOnSessionClo
 	sh.mutex.Lock()
 	defer sh.mutex.Unlock()
 
-	sh.publisher = nil
-	sh.mpegtsMuxer.close()
+	if sh.publisher == ctx.Session {
+		sh.publisher = nil
+		if sh.recorder != nil {
+			sh.recorder.Close()
+			sh.recorder = nil
+		}
+	}
 }
 
 // called when receiving an ANNOUNCE request.
@@ -63,7 +62,10 @@ func (sh *serverHandler) OnAnnounce(ctx *gortsplib.ServerHandlerOnAnnounceCtx) (
 
 	if sh.publisher != nil {
 		sh.publisher.Close()
-		sh.mpegtsMuxer.close()
+		if sh.recorder != nil {
+			sh.recorder.Close()
+			sh.recorder = nil
+		}
 	}
 
 	// find the H264 media and format
@@ -75,22 +77,7 @@ func (sh *serverHandler) OnAnnounce(ctx *gortsplib.ServerHandlerOnAnnounceCtx) (
 		}, fmt.Errorf("H264 media not found")
 	}
 
-	// setup RTP/H264->H264 decoder
-	rtpDec := forma.CreateDecoder()
-
-	// setup H264->MPEGTS muxer
-	mpegtsMuxer, err := newMPEGTSMuxer(forma.SPS, forma.PPS)
-	if err != nil {
-		return &base.Response{
-			StatusCode: base.StatusBadRequest,
-		}, err
-	}
-
 	sh.publisher = ctx.Session
-	sh.media = medi
-	sh.format = forma
-	sh.rtpDec = rtpDec
-	sh.mpegtsMuxer = mpegtsMuxer
 
 	return &base.Response{
 		StatusCode: base.StatusOK,
@@ -110,16 +97,27 @@ func (sh *serverHandler) OnSetup(ctx *gortsplib.ServerHandlerOnSetupCtx) (*base.
 func (sh *serverHandler) OnRecord(ctx *gortsplib.ServerHandlerOnRecordCtx) (*base.Response, error) {
 	log.Printf("record request")
 
-	// called when receiving a RTP packet
-	ctx.Session.OnPacketRTP(sh.media, sh.format, func(pkt *rtp.Packet) {
-		nalus, pts, err := sh.rtpDec.Decode(pkt)
-		if err != nil {
-			return
-		}
+	sh.mutex.Lock()
+	defer sh.mutex.Unlock()
 
-		// encode H264 NALUs into MPEG-TS
-		sh.mpegtsMuxer.encode(nalus, pts)
-	})
+	// setup a MPEG-TS recorder that saves the setupped medias
+	sh.recorder = &mpegtsrecorder.Recorder{
+		Medias: ctx.Session.SetuppedMedias(),
+		Path:   "mystream.ts",
+		OnError: func(err error) {
+			log.Printf("ERR: %v", err)
+		},
+	}
+	err := sh.recorder.Start()
+	if err != nil {
+		sh.recorder = nil
+		return &base.Response{
+			StatusCode: base.StatusBadRequest,
+		}, err
+	}
+
+	// called when receiving a RTP packet
+	sh.recorder.Attach(ctx.Session)
 
 	return &base.Response{
 		StatusCode: base.StatusOK,
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/pion/rtp"
+
+	"github.com/bluenviron/gortsplib/v3"
+	"github.com/bluenviron/gortsplib/v3/pkg/base"
+	"github.com/bluenviron/gortsplib/v3/pkg/formats"
+	"github.com/bluenviron/gortsplib/v3/pkg/hls"
+	"github.com/bluenviron/gortsplib/v3/pkg/media"
+)
+
+// This example shows how to
+// 1. create a RTSP server which accepts plain connections
+// 2. allow a single client to publish a stream with TCP or UDP
+// 3. allow multiple clients to read that stream with TCP, UDP or UDP-multicast
+// 4. convert the stream into a Low-Latency HLS stream, available at
+//    http://localhost:8888/stream/index.m3u8
+
+type serverHandler struct {
+	mutex     sync.Mutex
+	stream    *gortsplib.ServerStream
+	publisher *gortsplib.ServerSession
+	reader    *gortsplib.ServerStreamReader
+	muxer     *hls.Muxer
+}
+
+// closeStream closes the stream and the HLS muxer.
+func (sh *serverHandler) closeStream() {
+	if sh.muxer != nil {
+		sh.reader.Close()
+		sh.muxer.Close()
+		sh.reader = nil
+		sh.muxer = nil
+	}
+
+	sh.stream.Close()
+	sh.stream = nil
+}
+
+// ServeHTTP implements http.Handler.
+func (sh *serverHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	sh.mutex.Lock()
+	muxer := sh.muxer
+	sh.mutex.Unlock()
+
+	if muxer == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	muxer.ServeHTTP(w, r)
+}
+
+// called when a connection is opened.
+func (sh *serverHandler) OnConnOpen(ctx *gortsplib.ServerHandlerOnConnOpenCtx) {
+	log.Printf("conn opened")
+}
+
+// called when a connection is closed.
+func (sh *serverHandler) OnConnClose(ctx *gortsplib.ServerHandlerOnConnCloseCtx) {
+	log.Printf("conn closed (%v)", ctx.Error)
+}
+
+// called when a session is opened.
+func (sh *serverHandler) OnSessionOpen(ctx *gortsplib.ServerHandlerOnSessionOpenCtx) {
+	log.Printf("session opened")
+}
+
+// called when a session is closed.
+func (sh *serverHandler) OnSessionClose(ctx *gortsplib.ServerHandlerOnSessionCloseCtx) {
+	log.Printf("session closed")
+
+	sh.mutex.Lock()
+	defer sh.mutex.Unlock()
+
+	// if the session is the publisher,
+	// close the stream and disconnect any reader.
+	if sh.stream != nil && ctx.Session == sh.publisher {
+		sh.closeStream()
+	}
+}
+
+// called when receiving a DESCRIBE request.
+func (sh *serverHandler) OnDescribe(ctx *gortsplib.ServerHandlerOnDescribeCtx) (*base.Response, *gortsplib.ServerStream, error) {
+	log.Printf("describe request")
+
+	sh.mutex.Lock()
+	defer sh.mutex.Unlock()
+
+	// no one is publishing yet
+	if sh.stream == nil {
+		return &base.Response{
+			StatusCode: base.StatusNotFound,
+		}, nil, nil
+	}
+
+	// send medias that are being published to the client
+	return &base.Response{
+		StatusCode: base.StatusOK,
+	}, sh.stream, nil
+}
+
+// called when receiving an ANNOUNCE request.
+func (sh *serverHandler) OnAnnounce(ctx *gortsplib.ServerHandlerOnAnnounceCtx) (*base.Response, error) {
+	log.Printf("announce request")
+
+	sh.mutex.Lock()
+	defer sh.mutex.Unlock()
+
+	// disconnect existing publisher
+	if sh.stream != nil {
+		sh.closeStream()
+		sh.publisher.Close()
+	}
+
+	// create the stream and save the publisher
+	sh.stream = gortsplib.NewServerStream(ctx.Medias)
+	sh.publisher = ctx.Session
+
+	// create a HLS muxer
+	muxer := &hls.Muxer{
+		Medias:  ctx.Medias,
+		Variant: hls.VariantLowLatency,
+		OnError: func(err error) {
+			log.Printf("HLS muxer error: %v", err)
+		},
+	}
+	err := muxer.Start()
+	if err != nil {
+		// the stream doesn't contain any format supported by HLS
+		log.Printf("HLS muxer not started: %v", err)
+		return &base.Response{
+			StatusCode: base.StatusOK,
+		}, nil
+	}
+
+	// read the stream from the same process and route packets to the muxer
+	reader := &gortsplib.ServerStreamReader{
+		Stream: sh.stream,
+	}
+	muxer.Attach(reader)
+	err = reader.Start()
+	if err != nil {
+		muxer.Close()
+		return &base.Response{
+			StatusCode: base.StatusBadRequest,
+		}, err
+	}
+
+	sh.muxer = muxer
+	sh.reader = reader
+
+	return &base.Response{
+		StatusCode: base.StatusOK,
+	}, nil
+}
+
+// called when receiving a SETUP request.
+func (sh *serverHandler) OnSetup(ctx *gortsplib.ServerHandlerOnSetupCtx) (*base.Response, *gortsplib.ServerStream, error) {
+	log.Printf("setup request")
+
+	// no one is publishing yet
+	if sh.stream == nil {
+		return &base.Response{
+			StatusCode: base.StatusNotFound,
+		}, nil, nil
+	}
+
+	return &base.Response{
+		StatusCode: base.StatusOK,
+	}, sh.stream, nil
+}
+
+// called when receiving a PLAY request.
+func (sh *serverHandler) OnPlay(ctx *gortsplib.ServerHandlerOnPlayCtx) (*base.Response, error) {
+	log.Printf("play request")
+
+	return &base.Response{
+		StatusCode: base.StatusOK,
+	}, nil
+}
+
+// called when receiving a RECORD request.
+func (sh *serverHandler) OnRecord(ctx *gortsplib.ServerHandlerOnRecordCtx) (*base.Response, error) {
+	log.Printf("record request")
+
+	// called when receiving a RTP packet
+	ctx.Session.OnPacketRTPAny(func(medi *media.Media, forma formats.Format, pkt *rtp.Packet) {
+		// route the RTP packet to all readers
+		sh.stream.WritePacketRTP(medi, pkt)
+	})
+
+	return &base.Response{
+		StatusCode: base.StatusOK,
+	}, nil
+}
+
+func main() {
+	h := &serverHandler{}
+
+	// start the HTTP server
+	go func() {
+		panic(http.ListenAndServe(":8888", http.StripPrefix("/stream", h)))
+	}()
+
+	// configure the server
+	s := &gortsplib.Server{
+		Handler:           h,
+		RTSPAddress:       ":8554",
+		UDPRTPAddress:     ":8000",
+		UDPRTCPAddress:    ":8001",
+		MulticastIPRange:  "224.1.0.0/16",
+		MulticastRTPPort:  8002,
+		MulticastRTCPPort: 8003,
+	}
+
+	// start server and wait until a fatal error
+	log.Printf("server is ready")
+	panic(s.StartAndWait())
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/bluenviron/gortsplib/v3"
+)
+
+// This example shows how to
+// 1. create a RTSP server which routes clients with a ServerMux
+// 2. allow clients to publish streams on paths that match /cameras/{id}
+// 3. allow multiple clients to read these streams with TCP or UDP
+
+func main() {
+	mux := &gortsplib.ServerMux{}
+
+	err := mux.Handle("/cameras/{id}", &gortsplib.ServerMuxPath{
+		// called when a client wants to publish a stream.
+		OnPublish: func(ctx *gortsplib.ServerMuxPathCtx) error {
+			if ctx.Params["id"] == "" {
+				return fmt.Errorf("invalid camera ID")
+			}
+			log.Printf("publish request on camera %s", ctx.Params["id"])
+			return nil
+		},
+
+		// called when a client wants to read a stream.
+		OnRead: func(ctx *gortsplib.ServerMuxPathCtx) error {
+			log.Printf("read request on camera %s", ctx.Params["id"])
+			return nil
+		},
+
+		// called when a stream starts being published.
+		OnStreamReady: func(path string, stream *gortsplib.ServerStream) {
+			log.Printf("stream %s is ready", path)
+		},
+
+		// called when a stream stops being published.
+		OnStreamClose: func(path string, stream *gortsplib.ServerStream) {
+			log.Printf("stream %s is closed", path)
+		},
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	// configure the server
+	s := &gortsplib.Server{
+		Handler:        mux,
+		RTSPAddress:    ":8554",
+		UDPRTPAddress:  ":8000",
+		UDPRTCPAddress: ":8001",
+	}
+
+	// start server and wait until a fatal error
+	log.Printf("server is ready")
+	panic(s.StartAndWait())
+}
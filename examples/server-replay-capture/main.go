@@ -0,0 +1,102 @@
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/pion/rtp"
+
+	"github.com/bluenviron/gortsplib/v3"
+	"github.com/bluenviron/gortsplib/v3/pkg/base"
+	"github.com/bluenviron/gortsplib/v3/pkg/capture"
+	"github.com/bluenviron/gortsplib/v3/pkg/formats"
+	"github.com/bluenviron/gortsplib/v3/pkg/media"
+)
+
+// This example shows how to
+// 1. read a pcapng capture, like the one saved by the client-read-capture example
+// 2. create a RTSP server
+// 3. replay packets of the capture to connected clients, with their original pace.
+
+type serverHandler struct {
+	stream *gortsplib.ServerStream
+}
+
+// called when receiving a DESCRIBE request.
+func (sh *serverHandler) OnDescribe(ctx *gortsplib.ServerHandlerOnDescribeCtx) (*base.Response, *gortsplib.ServerStream, error) {
+	return &base.Response{
+		StatusCode: base.StatusOK,
+	}, sh.stream, nil
+}
+
+// called when receiving a SETUP request.
+func (sh *serverHandler) OnSetup(ctx *gortsplib.ServerHandlerOnSetupCtx) (*base.Response, *gortsplib.ServerStream, error) {
+	return &base.Response{
+		StatusCode: base.StatusOK,
+	}, sh.stream, nil
+}
+
+// called when receiving a PLAY request.
+func (sh *serverHandler) OnPlay(ctx *gortsplib.ServerHandlerOnPlayCtx) (*base.Response, error) {
+	return &base.Response{
+		StatusCode: base.StatusOK,
+	}, nil
+}
+
+func main() {
+	f, err := os.Open("capture.pcapng")
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+
+	r, err := capture.NewPcapngReader(f)
+	if err != nil {
+		panic(err)
+	}
+
+	// read medias from the DESCRIBE response contained into the capture
+	rp := &capture.Replayer{
+		Reader: r,
+	}
+	err = rp.Start()
+	if err != nil {
+		panic(err)
+	}
+	defer rp.Close()
+
+	// create a stream with the medias of the capture
+	stream := gortsplib.NewServerStream(rp.Medias)
+	defer stream.Close()
+
+	// write replayed packets into the stream
+	rp.OnPacketRTPAny(func(medi *media.Media, forma formats.Format, pkt *rtp.Packet) {
+		stream.WritePacketRTP(medi, pkt)
+	})
+
+	// configure the server
+	s := &gortsplib.Server{
+		Handler:        &serverHandler{stream: stream},
+		RTSPAddress:    ":8554",
+		UDPRTPAddress:  ":8000",
+		UDPRTCPAddress: ":8001",
+	}
+
+	err = s.Start()
+	if err != nil {
+		panic(err)
+	}
+	defer s.Close()
+
+	log.Printf("server is ready")
+
+	// start replaying
+	rp.Play()
+
+	err = rp.Wait()
+	if err != nil {
+		panic(err)
+	}
+
+	log.Printf("end of capture")
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"log"
+	"sync"
+
+	"github.com/bluenviron/gortsplib/v3"
+	"github.com/bluenviron/gortsplib/v3/pkg/base"
+	"github.com/bluenviron/gortsplib/v3/pkg/rtmpbridge"
+)
+
+// This example shows how to
+// 1. create a RTMP server which accepts publishers
+// 2. create a RTSP server which allows multiple clients to read the
+//    stream of a RTMP publisher with TCP or UDP.
+//    A stream published to rtmp://localhost/live/mystream
+//    is available at rtsp://localhost:8554/mystream
+
+type serverHandler struct {
+	mutex      sync.Mutex
+	publishers map[string]*rtmpbridge.ServerConn
+}
+
+func (sh *serverHandler) findStream(path string) *gortsplib.ServerStream {
+	sh.mutex.Lock()
+	defer sh.mutex.Unlock()
+
+	c, ok := sh.publishers[path]
+	if !ok {
+		return nil
+	}
+	return c.Stream()
+}
+
+// called when receiving a DESCRIBE request.
+func (sh *serverHandler) OnDescribe(ctx *gortsplib.ServerHandlerOnDescribeCtx) (*base.Response, *gortsplib.ServerStream, error) {
+	log.Printf("describe request")
+
+	stream := sh.findStream(ctx.Path)
+	if stream == nil {
+		return &base.Response{
+			StatusCode: base.StatusNotFound,
+		}, nil, nil
+	}
+
+	return &base.Response{
+		StatusCode: base.StatusOK,
+	}, stream, nil
+}
+
+// called when receiving a SETUP request.
+func (sh *serverHandler) OnSetup(ctx *gortsplib.ServerHandlerOnSetupCtx) (*base.Response, *gortsplib.ServerStream, error) {
+	log.Printf("setup request")
+
+	stream := sh.findStream(ctx.Path)
+	if stream == nil {
+		return &base.Response{
+			StatusCode: base.StatusNotFound,
+		}, nil, nil
+	}
+
+	return &base.Response{
+		StatusCode: base.StatusOK,
+	}, stream, nil
+}
+
+// called when receiving a PLAY request.
+func (sh *serverHandler) OnPlay(ctx *gortsplib.ServerHandlerOnPlayCtx) (*base.Response, error) {
+	log.Printf("play request")
+
+	return &base.Response{
+		StatusCode: base.StatusOK,
+	}, nil
+}
+
+func main() {
+	h := &serverHandler{
+		publishers: make(map[string]*rtmpbridge.ServerConn),
+	}
+
+	// configure the RTMP server
+	rs := &rtmpbridge.Server{
+		Address: ":1935",
+		OnPublish: func(c *rtmpbridge.ServerConn) error {
+			log.Printf("RTMP publisher connected (%s)", c.StreamKey())
+			return nil
+		},
+		OnStreamReady: func(c *rtmpbridge.ServerConn) {
+			h.mutex.Lock()
+			defer h.mutex.Unlock()
+
+			// disconnect existing publisher
+			if existing, ok := h.publishers["/"+c.StreamKey()]; ok {
+				existing.Close()
+			}
+
+			h.publishers["/"+c.StreamKey()] = c
+		},
+		OnConnClose: func(c *rtmpbridge.ServerConn, err error) {
+			log.Printf("RTMP publisher disconnected (%v)", err)
+
+			h.mutex.Lock()
+			defer h.mutex.Unlock()
+
+			if h.publishers["/"+c.StreamKey()] == c {
+				delete(h.publishers, "/"+c.StreamKey())
+			}
+		},
+	}
+	err := rs.Start()
+	if err != nil {
+		panic(err)
+	}
+	defer rs.Close()
+
+	// configure the RTSP server
+	s := &gortsplib.Server{
+		Handler:        h,
+		RTSPAddress:    ":8554",
+		UDPRTPAddress:  ":8000",
+		UDPRTCPAddress: ":8001",
+	}
+
+	// start server and wait until a fatal error
+	log.Printf("server is ready")
+	panic(s.StartAndWait())
+}
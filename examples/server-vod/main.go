@@ -0,0 +1,119 @@
+package main
+
+import (
+	"log"
+
+	"github.com/bluenviron/gortsplib/v3"
+	"github.com/bluenviron/gortsplib/v3/pkg/base"
+	"github.com/bluenviron/gortsplib/v3/pkg/mpegtssource"
+)
+
+// This example shows how to
+// 1. create a RTSP server which serves a MPEG-TS file on demand
+// 2. allow multiple clients to read the file with TCP or UDP,
+//    each with its own position, speed and pause state
+
+const fileName = "myfile.ts"
+
+type serverHandler struct {
+	describeStream *gortsplib.ServerStream
+}
+
+// called when a session is closed.
+func (sh *serverHandler) OnSessionClose(ctx *gortsplib.ServerHandlerOnSessionCloseCtx) {
+	log.Printf("session closed")
+
+	if vod, ok := ctx.Session.UserData().(*gortsplib.ServerVOD); ok {
+		vod.Close()
+	}
+}
+
+// called when receiving a DESCRIBE request.
+func (sh *serverHandler) OnDescribe(ctx *gortsplib.ServerHandlerOnDescribeCtx) (*base.Response, *gortsplib.ServerStream, error) {
+	log.Printf("describe request")
+
+	return &base.Response{
+		StatusCode: base.StatusOK,
+	}, sh.describeStream, nil
+}
+
+// called when receiving a SETUP request.
+func (sh *serverHandler) OnSetup(ctx *gortsplib.ServerHandlerOnSetupCtx) (*base.Response, *gortsplib.ServerStream, error) {
+	log.Printf("setup request")
+
+	// a session can setup multiple medias of the same file
+	if vod, ok := ctx.Session.UserData().(*gortsplib.ServerVOD); ok {
+		return &base.Response{
+			StatusCode: base.StatusOK,
+		}, vod.Stream(), nil
+	}
+
+	// open the file once for each session
+	source, err := mpegtssource.Open(fileName)
+	if err != nil {
+		return &base.Response{
+			StatusCode: base.StatusNotFound,
+		}, nil, err
+	}
+
+	vod := &gortsplib.ServerVOD{
+		Source:         source,
+		DescribeStream: sh.describeStream,
+		OnEnd: func() {
+			log.Printf("end of file reached")
+		},
+	}
+	err = vod.Start()
+	if err != nil {
+		source.Close()
+		return &base.Response{
+			StatusCode: base.StatusInternalServerError,
+		}, nil, err
+	}
+
+	ctx.Session.SetUserData(vod)
+
+	return &base.Response{
+		StatusCode: base.StatusOK,
+	}, vod.Stream(), nil
+}
+
+// called when receiving a PLAY request.
+func (sh *serverHandler) OnPlay(ctx *gortsplib.ServerHandlerOnPlayCtx) (*base.Response, error) {
+	log.Printf("play request")
+
+	// seek, set speed and start reading
+	return ctx.Session.UserData().(*gortsplib.ServerVOD).OnPlay(ctx)
+}
+
+// called when receiving a PAUSE request.
+func (sh *serverHandler) OnPause(ctx *gortsplib.ServerHandlerOnPauseCtx) (*base.Response, error) {
+	log.Printf("pause request")
+
+	return &base.Response{
+		StatusCode: base.StatusOK,
+	}, nil
+}
+
+func main() {
+	// read the medias of the file, that are returned to DESCRIBE requests
+	source, err := mpegtssource.Open(fileName)
+	if err != nil {
+		panic(err)
+	}
+	describeStream := gortsplib.NewServerStream(source.Medias())
+	source.Close()
+	defer describeStream.Close()
+
+	// configure the server
+	s := &gortsplib.Server{
+		Handler:        &serverHandler{describeStream: describeStream},
+		RTSPAddress:    ":8554",
+		UDPRTPAddress:  ":8000",
+		UDPRTCPAddress: ":8001",
+	}
+
+	// start server and wait until a fatal error
+	log.Printf("server is ready")
+	panic(s.StartAndWait())
+}
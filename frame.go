@@ -0,0 +1,479 @@
+package gortsplib
+
+import (
+	"sync"
+	"time"
+
+	"github.com/bluenviron/mediacommon/pkg/codecs/h264"
+	"github.com/bluenviron/mediacommon/pkg/codecs/h265"
+	"github.com/bluenviron/mediacommon/pkg/codecs/mpeg4audio"
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+
+	"github.com/bluenviron/gortsplib/v3/pkg/formats"
+	"github.com/bluenviron/gortsplib/v3/pkg/formats/rtph264"
+	"github.com/bluenviron/gortsplib/v3/pkg/formats/rtph265"
+	"github.com/bluenviron/gortsplib/v3/pkg/formats/rtpmjpeg"
+	"github.com/bluenviron/gortsplib/v3/pkg/formats/rtpmpeg4audio"
+	"github.com/bluenviron/gortsplib/v3/pkg/formats/rtpvp8"
+	"github.com/bluenviron/gortsplib/v3/pkg/formats/rtpvp9"
+	"github.com/bluenviron/gortsplib/v3/pkg/rtptime"
+)
+
+// Frame is an access unit decoded from one or more RTP packets.
+type Frame struct {
+	// presentation timestamp, relative to the first packet of the format.
+	PTS time.Duration
+
+	// decoding timestamp.
+	// It differs from PTS only with formats that support frame reordering (H264, H265).
+	DTS time.Duration
+
+	// absolute time of the frame, computed by using RTCP sender reports.
+	// It is zero until the first sender report is received.
+	NTP time.Time
+
+	// whether the frame can be decoded without previous frames.
+	// It is always true with audio formats and M-JPEG, and always false with formats without a decoder.
+	KeyFrame bool
+
+	// number of RTP packets that have been lost since the previous frame.
+	// Frames that cannot be decoded because of missing packets are discarded.
+	PacketsLost uint64
+
+	// content of the frame.
+	// With H264 and H265, it contains the NALUs of the access unit.
+	// With formats without a decoder, it contains the RTP payload.
+	// Otherwise, it contains a single element.
+	Payload [][]byte
+}
+
+func timeToNTPTime(t time.Time) uint64 {
+	// seconds since 1st January 1900
+	// higher 32 bits are the integer part, lower 32 bits are the fractional part
+	secs := uint64(t.Unix() + 2208988800)
+	frac := uint64(t.Nanosecond()) << 32 / 1000000000
+	return secs<<32 | frac
+}
+
+func ntpTimeToTime(v uint64) time.Time {
+	// seconds since 1st January 1900
+	// higher 32 bits are the integer part, lower 32 bits are the fractional part
+	secs := int64(v>>32) - 2208988800
+	nanos := int64((v & 0xFFFFFFFF) * 1000000000 >> 32)
+	return time.Unix(secs, nanos)
+}
+
+func h264IDRPresent(au [][]byte) bool {
+	for _, nalu := range au {
+		if len(nalu) == 0 {
+			continue
+		}
+
+		if h264.NALUType(nalu[0]&0x1F) == h264.NALUTypeIDR {
+			return true
+		}
+	}
+	return false
+}
+
+func h264FrameDecoder(forma *formats.H264) func(*rtp.Packet) ([]*Frame, error) {
+	dec := forma.CreateDecoder()
+	var dtsExtractor *h264.DTSExtractor
+
+	return func(pkt *rtp.Packet) ([]*Frame, error) {
+		// DecodeUntilMarker is necessary for the DTS extractor to work
+		au, pts, err := dec.DecodeUntilMarker(pkt)
+		if err != nil {
+			if err == rtph264.ErrNonStartingPacketAndNoPrevious || err == rtph264.ErrMorePacketsNeeded {
+				return nil, nil
+			}
+			return nil, err
+		}
+
+		keyFrame := h264IDRPresent(au)
+
+		if dtsExtractor == nil {
+			// skip access units silently until we find one with a IDR
+			if !keyFrame {
+				return nil, nil
+			}
+			dtsExtractor = h264.NewDTSExtractor()
+		}
+
+		extractorAU := au
+
+		// parameters may have been transmitted out of band
+		if keyFrame {
+			sps, _ := forma.SafeParams()
+			if sps != nil {
+				extractorAU = append([][]byte{sps}, au...)
+			}
+		}
+
+		dts, err := dtsExtractor.Extract(extractorAU, pts)
+		if err != nil {
+			dtsExtractor = nil
+			return nil, err
+		}
+
+		return []*Frame{{
+			PTS:      pts,
+			DTS:      dts,
+			KeyFrame: keyFrame,
+			// the decoder reuses its buffer
+			Payload: append([][]byte(nil), au...),
+		}}, nil
+	}
+}
+
+func h265IRAPPresent(au [][]byte) bool {
+	for _, nalu := range au {
+		if len(nalu) == 0 {
+			continue
+		}
+
+		if h265NALUTypeIsIRAP(h265.NALUType((nalu[0] >> 1) & 0b111111)) {
+			return true
+		}
+	}
+	return false
+}
+
+func h265FrameDecoder(forma *formats.H265) func(*rtp.Packet) ([]*Frame, error) {
+	dec := forma.CreateDecoder()
+	var dtsExtractor *h265.DTSExtractor
+
+	return func(pkt *rtp.Packet) ([]*Frame, error) {
+		au, pts, err := dec.DecodeUntilMarker(pkt)
+		if err != nil {
+			if err == rtph265.ErrNonStartingPacketAndNoPrevious || err == rtph265.ErrMorePacketsNeeded {
+				return nil, nil
+			}
+			return nil, err
+		}
+
+		keyFrame := h265IRAPPresent(au)
+
+		if dtsExtractor == nil {
+			// skip access units silently until we find a random access point
+			if !keyFrame {
+				return nil, nil
+			}
+			dtsExtractor = h265.NewDTSExtractor()
+		}
+
+		extractorAU := au
+
+		// parameters may have been transmitted out of band
+		if keyFrame {
+			_, sps, pps := forma.SafeParams()
+			if sps != nil && pps != nil {
+				extractorAU = append([][]byte{sps, pps}, au...)
+			}
+		}
+
+		dts, err := dtsExtractor.Extract(extractorAU, pts)
+		if err != nil {
+			dtsExtractor = nil
+			return nil, err
+		}
+
+		return []*Frame{{
+			PTS:      pts,
+			DTS:      dts,
+			KeyFrame: keyFrame,
+			// the decoder reuses its buffer
+			Payload: append([][]byte(nil), au...),
+		}}, nil
+	}
+}
+
+func vp9IsKeyFrame(frame []byte) bool {
+	if len(frame) == 0 || (frame[0]>>6) != 2 {
+		return false
+	}
+
+	profile := (frame[0]>>5)&0x01 | ((frame[0]>>4)&0x01)<<1
+
+	// skip the reserved bit of profile 3
+	shift := 3
+	if profile == 3 {
+		shift = 2
+	}
+
+	// show_existing_frame
+	if ((frame[0] >> shift) & 0x01) != 0 {
+		return false
+	}
+
+	// frame_type
+	return ((frame[0] >> (shift - 1)) & 0x01) == 0
+}
+
+func vp8FrameDecoder(forma *formats.VP8) func(*rtp.Packet) ([]*Frame, error) {
+	dec := forma.CreateDecoder()
+
+	return func(pkt *rtp.Packet) ([]*Frame, error) {
+		frame, pts, err := dec.Decode(pkt)
+		if err != nil {
+			if err == rtpvp8.ErrNonStartingPacketAndNoPrevious || err == rtpvp8.ErrMorePacketsNeeded {
+				return nil, nil
+			}
+			return nil, err
+		}
+
+		return []*Frame{{
+			PTS:      pts,
+			DTS:      pts,
+			KeyFrame: len(frame) > 0 && (frame[0]&0x01) == 0,
+			Payload:  [][]byte{frame},
+		}}, nil
+	}
+}
+
+func vp9FrameDecoder(forma *formats.VP9) func(*rtp.Packet) ([]*Frame, error) {
+	dec := forma.CreateDecoder()
+
+	return func(pkt *rtp.Packet) ([]*Frame, error) {
+		frame, pts, err := dec.Decode(pkt)
+		if err != nil {
+			if err == rtpvp9.ErrNonStartingPacketAndNoPrevious || err == rtpvp9.ErrMorePacketsNeeded {
+				return nil, nil
+			}
+			return nil, err
+		}
+
+		return []*Frame{{
+			PTS:      pts,
+			DTS:      pts,
+			KeyFrame: vp9IsKeyFrame(frame),
+			Payload:  [][]byte{frame},
+		}}, nil
+	}
+}
+
+func mjpegFrameDecoder(forma *formats.MJPEG) func(*rtp.Packet) ([]*Frame, error) {
+	dec := forma.CreateDecoder()
+
+	return func(pkt *rtp.Packet) ([]*Frame, error) {
+		image, pts, err := dec.Decode(pkt)
+		if err != nil {
+			if err == rtpmjpeg.ErrNonStartingPacketAndNoPrevious || err == rtpmjpeg.ErrMorePacketsNeeded {
+				return nil, nil
+			}
+			return nil, err
+		}
+
+		return []*Frame{{
+			PTS:      pts,
+			DTS:      pts,
+			KeyFrame: true,
+			Payload:  [][]byte{image},
+		}}, nil
+	}
+}
+
+func mpeg4AudioFrameDecoder(forma *formats.MPEG4Audio) func(*rtp.Packet) ([]*Frame, error) {
+	dec := forma.CreateDecoder()
+	sampleRate := time.Duration(forma.ClockRate())
+
+	return func(pkt *rtp.Packet) ([]*Frame, error) {
+		aus, pts, err := dec.Decode(pkt)
+		if err != nil {
+			if err == rtpmpeg4audio.ErrMorePacketsNeeded {
+				return nil, nil
+			}
+			return nil, err
+		}
+
+		frames := make([]*Frame, len(aus))
+
+		for i, au := range aus {
+			auPTS := pts + time.Duration(i)*mpeg4audio.SamplesPerAccessUnit*time.Second/sampleRate
+
+			frames[i] = &Frame{
+				PTS:      auPTS,
+				DTS:      auPTS,
+				KeyFrame: true,
+				Payload:  [][]byte{au},
+			}
+		}
+
+		return frames, nil
+	}
+}
+
+func simpleAudioFrameDecoder(
+	decode func(*rtp.Packet) ([]byte, time.Duration, error),
+) func(*rtp.Packet) ([]*Frame, error) {
+	return func(pkt *rtp.Packet) ([]*Frame, error) {
+		frame, pts, err := decode(pkt)
+		if err != nil {
+			return nil, err
+		}
+
+		return []*Frame{{
+			PTS:      pts,
+			DTS:      pts,
+			KeyFrame: true,
+			Payload:  [][]byte{frame},
+		}}, nil
+	}
+}
+
+func payloadFrameDecoder(forma formats.Format) func(*rtp.Packet) ([]*Frame, error) {
+	var timeDecoder *rtptime.Decoder
+	if forma.ClockRate() > 0 {
+		timeDecoder = rtptime.NewDecoder(forma.ClockRate())
+	}
+
+	return func(pkt *rtp.Packet) ([]*Frame, error) {
+		var pts time.Duration
+		if timeDecoder != nil {
+			pts = timeDecoder.Decode(pkt.Timestamp)
+		}
+
+		return []*Frame{{
+			PTS:     pts,
+			DTS:     pts,
+			Payload: [][]byte{pkt.Payload},
+		}}, nil
+	}
+}
+
+// FrameDecoder decodes frames from the RTP packets of a format.
+// It is used by Client.OnFrame() and ServerSession.OnFrame(), and can be used
+// to decode RTP packets coming from any other source.
+type FrameDecoder struct {
+	clockRate time.Duration
+	decode    func(*rtp.Packet) ([]*Frame, error)
+	onFrame   func(*Frame)
+
+	seqInitialized bool
+	lastSeq        uint16
+	packetsLost    uint64
+
+	// sender reports are read by a different routine
+	srMutex    sync.Mutex
+	srReceived bool
+	srSSRC     uint32
+	srNTP      time.Time
+	srRTPTime  uint32
+}
+
+// NewFrameDecoder allocates a FrameDecoder.
+// onFrame is called synchronously by ProcessPacket() for every decoded frame.
+func NewFrameDecoder(forma formats.Format, onFrame func(*Frame)) *FrameDecoder {
+	d := &FrameDecoder{
+		clockRate: time.Duration(forma.ClockRate()),
+		onFrame:   onFrame,
+	}
+
+	switch forma := forma.(type) {
+	case *formats.H264:
+		d.decode = h264FrameDecoder(forma)
+
+	case *formats.H265:
+		d.decode = h265FrameDecoder(forma)
+
+	case *formats.VP8:
+		d.decode = vp8FrameDecoder(forma)
+
+	case *formats.VP9:
+		d.decode = vp9FrameDecoder(forma)
+
+	case *formats.MJPEG:
+		d.decode = mjpegFrameDecoder(forma)
+
+	case *formats.MPEG4Audio:
+		d.decode = mpeg4AudioFrameDecoder(forma)
+
+	case *formats.G711:
+		dec := forma.CreateDecoder()
+		d.decode = simpleAudioFrameDecoder(dec.Decode)
+
+	case *formats.G722:
+		dec := forma.CreateDecoder()
+		d.decode = simpleAudioFrameDecoder(dec.Decode)
+
+	case *formats.Opus:
+		dec := forma.CreateDecoder()
+		d.decode = simpleAudioFrameDecoder(dec.Decode)
+
+	case *formats.LPCM:
+		dec := forma.CreateDecoder()
+		d.decode = simpleAudioFrameDecoder(dec.Decode)
+
+	default:
+		d.decode = payloadFrameDecoder(forma)
+	}
+
+	return d
+}
+
+// ProcessSenderReport processes a RTCP sender report, that is used to fill the NTP field of frames.
+// It can be called by a different routine than the one that calls ProcessPacket().
+func (d *FrameDecoder) ProcessSenderReport(sr *rtcp.SenderReport) {
+	d.srMutex.Lock()
+	defer d.srMutex.Unlock()
+
+	d.srReceived = true
+	d.srSSRC = sr.SSRC
+	d.srNTP = ntpTimeToTime(sr.NTPTime)
+	d.srRTPTime = sr.RTPTime
+}
+
+func (d *FrameDecoder) frameNTP(pkt *rtp.Packet) time.Time {
+	d.srMutex.Lock()
+	defer d.srMutex.Unlock()
+
+	if !d.srReceived || d.srSSRC != pkt.SSRC || d.clockRate == 0 {
+		return time.Time{}
+	}
+
+	diff := time.Duration(int32(pkt.Timestamp - d.srRTPTime))
+	return d.srNTP.Add(diff * time.Second / d.clockRate)
+}
+
+// ProcessPacket processes a RTP packet.
+func (d *FrameDecoder) ProcessPacket(pkt *rtp.Packet) error {
+	if d.seqInitialized {
+		diff := pkt.SequenceNumber - d.lastSeq
+
+		// ignore duplicate and older packets
+		if diff == 0 || diff >= 0x8000 {
+			return nil
+		}
+
+		d.packetsLost += uint64(diff - 1)
+	}
+	d.seqInitialized = true
+	d.lastSeq = pkt.SequenceNumber
+
+	frames, err := d.decode(pkt)
+	if err != nil {
+		return err
+	}
+
+	if len(frames) == 0 {
+		return nil
+	}
+
+	ntp := d.frameNTP(pkt)
+
+	for i, frame := range frames {
+		if !ntp.IsZero() {
+			frame.NTP = ntp.Add(frame.PTS - frames[0].PTS)
+		}
+
+		if i == 0 {
+			frame.PacketsLost = d.packetsLost
+			d.packetsLost = 0
+		}
+
+		d.onFrame(frame)
+	}
+
+	return nil
+}
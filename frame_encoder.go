@@ -0,0 +1,281 @@
+package gortsplib
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/mediacommon/pkg/codecs/h264"
+	"github.com/bluenviron/mediacommon/pkg/codecs/h265"
+	"github.com/pion/rtp"
+
+	"github.com/bluenviron/gortsplib/v3/pkg/formats"
+	"github.com/bluenviron/gortsplib/v3/pkg/rtptime"
+)
+
+// 1472 (maxPacketSize) - 12 (RTP header)
+const frameEncoderPayloadMaxSize = maxPacketSize - 12
+
+func randUint32() uint32 {
+	var b [4]byte
+	rand.Read(b[:])
+	return uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3])
+}
+
+func frameSinglePayload(fr *Frame) ([]byte, error) {
+	if len(fr.Payload) != 1 {
+		return nil, fmt.Errorf("frame must contain a single element, but contains %d", len(fr.Payload))
+	}
+	return fr.Payload[0], nil
+}
+
+// updateParam replaces a parameter set with a copy of an in-band one, if they differ.
+func updateParam(dest *[]byte, nalu []byte) bool {
+	if bytes.Equal(*dest, nalu) {
+		return false
+	}
+
+	*dest = append([]byte(nil), nalu...)
+	return true
+}
+
+func h264FrameEncoder(forma *formats.H264) func(*Frame) ([]*rtp.Packet, error) {
+	enc := forma.CreateEncoder()
+	enc.PayloadMaxSize = frameEncoderPayloadMaxSize
+
+	return func(fr *Frame) ([]*rtp.Packet, error) {
+		sps, pps := forma.SafeParams()
+		changed := false
+
+		for _, nalu := range fr.Payload {
+			if len(nalu) == 0 {
+				continue
+			}
+
+			switch h264.NALUType(nalu[0] & 0x1F) {
+			case h264.NALUTypeSPS:
+				changed = updateParam(&sps, nalu) || changed
+
+			case h264.NALUTypePPS:
+				changed = updateParam(&pps, nalu) || changed
+			}
+		}
+
+		if changed {
+			forma.SafeSetParams(sps, pps)
+		}
+
+		return enc.Encode(fr.Payload, fr.PTS)
+	}
+}
+
+func h265FrameEncoder(forma *formats.H265) func(*Frame) ([]*rtp.Packet, error) {
+	enc := forma.CreateEncoder()
+	enc.PayloadMaxSize = frameEncoderPayloadMaxSize
+
+	return func(fr *Frame) ([]*rtp.Packet, error) {
+		vps, sps, pps := forma.SafeParams()
+		changed := false
+
+		for _, nalu := range fr.Payload {
+			if len(nalu) == 0 {
+				continue
+			}
+
+			switch h265.NALUType((nalu[0] >> 1) & 0b111111) {
+			case h265.NALUType_VPS_NUT:
+				changed = updateParam(&vps, nalu) || changed
+
+			case h265.NALUType_SPS_NUT:
+				changed = updateParam(&sps, nalu) || changed
+
+			case h265.NALUType_PPS_NUT:
+				changed = updateParam(&pps, nalu) || changed
+			}
+		}
+
+		if changed {
+			forma.SafeSetParams(vps, sps, pps)
+		}
+
+		return enc.Encode(fr.Payload, fr.PTS)
+	}
+}
+
+func singlePayloadFrameEncoder(
+	encode func([]byte, time.Duration) ([]*rtp.Packet, error),
+) func(*Frame) ([]*rtp.Packet, error) {
+	return func(fr *Frame) ([]*rtp.Packet, error) {
+		payload, err := frameSinglePayload(fr)
+		if err != nil {
+			return nil, err
+		}
+
+		return encode(payload, fr.PTS)
+	}
+}
+
+func simpleAudioFrameEncoder(
+	encode func([]byte, time.Duration) (*rtp.Packet, error),
+) func(*Frame) ([]*rtp.Packet, error) {
+	return singlePayloadFrameEncoder(func(frame []byte, pts time.Duration) ([]*rtp.Packet, error) {
+		pkt, err := encode(frame, pts)
+		if err != nil {
+			return nil, err
+		}
+		return []*rtp.Packet{pkt}, nil
+	})
+}
+
+func payloadFrameEncoder(forma formats.Format) func(*Frame) ([]*rtp.Packet, error) {
+	ssrc := randUint32()
+	sequenceNumber := uint16(randUint32())
+
+	var timeEncoder *rtptime.Encoder
+	if forma.ClockRate() > 0 {
+		timeEncoder = rtptime.NewEncoder(forma.ClockRate(), randUint32())
+	}
+
+	return singlePayloadFrameEncoder(func(payload []byte, pts time.Duration) ([]*rtp.Packet, error) {
+		if len(payload) > frameEncoderPayloadMaxSize {
+			return nil, fmt.Errorf("payload size (%d) is greater than maximum allowed (%d)",
+				len(payload), frameEncoderPayloadMaxSize)
+		}
+
+		var ts uint32
+		if timeEncoder != nil {
+			ts = timeEncoder.Encode(pts)
+		}
+
+		pkt := &rtp.Packet{
+			Header: rtp.Header{
+				Version:        2,
+				Marker:         true,
+				PayloadType:    forma.PayloadType(),
+				SequenceNumber: sequenceNumber,
+				Timestamp:      ts,
+				SSRC:           ssrc,
+			},
+			Payload: payload,
+		}
+		sequenceNumber++
+
+		return []*rtp.Packet{pkt}, nil
+	})
+}
+
+func createFrameEncoder(forma formats.Format) func(*Frame) ([]*rtp.Packet, error) {
+	switch forma := forma.(type) {
+	case *formats.H264:
+		return h264FrameEncoder(forma)
+
+	case *formats.H265:
+		return h265FrameEncoder(forma)
+
+	case *formats.VP8:
+		enc := forma.CreateEncoder()
+		enc.PayloadMaxSize = frameEncoderPayloadMaxSize
+		return singlePayloadFrameEncoder(enc.Encode)
+
+	case *formats.VP9:
+		enc := forma.CreateEncoder()
+		enc.PayloadMaxSize = frameEncoderPayloadMaxSize
+		return singlePayloadFrameEncoder(enc.Encode)
+
+	case *formats.MJPEG:
+		enc := forma.CreateEncoder()
+		enc.PayloadMaxSize = frameEncoderPayloadMaxSize
+		return singlePayloadFrameEncoder(enc.Encode)
+
+	case *formats.MPEG4Audio:
+		enc := forma.CreateEncoder()
+		enc.PayloadMaxSize = frameEncoderPayloadMaxSize
+		return func(fr *Frame) ([]*rtp.Packet, error) {
+			return enc.Encode(fr.Payload, fr.PTS)
+		}
+
+	case *formats.LPCM:
+		enc := forma.CreateEncoder()
+		enc.PayloadMaxSize = frameEncoderPayloadMaxSize
+		return singlePayloadFrameEncoder(enc.Encode)
+
+	case *formats.G711:
+		enc := forma.CreateEncoder()
+		enc.PayloadMaxSize = frameEncoderPayloadMaxSize
+		return simpleAudioFrameEncoder(enc.Encode)
+
+	case *formats.G722:
+		enc := forma.CreateEncoder()
+		enc.PayloadMaxSize = frameEncoderPayloadMaxSize
+		return simpleAudioFrameEncoder(enc.Encode)
+
+	case *formats.Opus:
+		enc := forma.CreateEncoder()
+		enc.PayloadMaxSize = frameEncoderPayloadMaxSize
+		return simpleAudioFrameEncoder(enc.Encode)
+
+	default:
+		return payloadFrameEncoder(forma)
+	}
+}
+
+// frameEncoder encodes frames into the RTP packets of a format.
+type frameEncoder struct {
+	format formats.Format
+
+	// frames can be written by multiple routines
+	mutex          sync.Mutex
+	encode         func(*Frame) ([]*rtp.Packet, error)
+	ntpInitialized bool
+	startNTP       time.Time
+	startPTS       time.Duration
+}
+
+func newFrameEncoder(forma formats.Format) *frameEncoder {
+	return &frameEncoder{
+		format: forma,
+	}
+}
+
+// encodeFrame encodes a frame and passes resulting packets to cb, together with their NTP time.
+func (e *frameEncoder) encodeFrame(fr *Frame, cb func(*rtp.Packet, time.Time) error) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	// encoders are allocated when needed, since they use parameters that may be filled after the format creation
+	if e.encode == nil {
+		e.encode = createFrameEncoder(e.format)
+	}
+
+	ntp := fr.NTP
+
+	// NTP is computed from PTS, in order to generate RTCP sender reports that are consistent with RTP timestamps
+	if !e.ntpInitialized {
+		e.ntpInitialized = true
+		e.startPTS = fr.PTS
+		e.startNTP = ntp
+		if e.startNTP.IsZero() {
+			e.startNTP = time.Now()
+		}
+	}
+
+	if ntp.IsZero() {
+		ntp = e.startNTP.Add(fr.PTS - e.startPTS)
+	}
+
+	pkts, err := e.encode(fr)
+	if err != nil {
+		return err
+	}
+
+	for _, pkt := range pkts {
+		err := cb(pkt, ntp)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,119 @@
+package gortsplib
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bluenviron/mediacommon/pkg/codecs/h264"
+	"github.com/pion/rtp"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/gortsplib/v3/pkg/formats"
+)
+
+func TestFrameEncoderH264(t *testing.T) {
+	forma := &formats.H264{
+		PayloadTyp:        96,
+		PacketizationMode: 1,
+	}
+
+	e := newFrameEncoder(forma)
+
+	var frames []*Frame
+	d := NewFrameDecoder(forma, func(fr *Frame) {
+		frames = append(frames, fr)
+	})
+
+	var ntps []time.Time
+	start := time.Date(2008, 5, 20, 22, 15, 20, 0, time.UTC)
+
+	idr := make([]byte, 4000)
+	idr[0] = byte(h264.NALUTypeIDR)
+
+	for i, fr := range []*Frame{
+		{
+			PTS:     1 * time.Second,
+			NTP:     start,
+			Payload: [][]byte{testFrameSPS, testFramePPS, idr},
+		},
+		{
+			PTS:     2 * time.Second,
+			Payload: [][]byte{{byte(h264.NALUTypeNonIDR), 1}},
+		},
+	} {
+		n := 0
+
+		err := e.encodeFrame(fr, func(pkt *rtp.Packet, ntp time.Time) error {
+			byts, err := pkt.Marshal()
+			require.NoError(t, err)
+			require.LessOrEqual(t, len(byts), maxPacketSize)
+
+			ntps = append(ntps, ntp)
+			n++
+			return d.ProcessPacket(pkt)
+		})
+		require.NoError(t, err)
+
+		if i == 0 {
+			// the IDR is fragmented
+			require.Greater(t, n, 1)
+		}
+	}
+
+	// parameters are saved into the format
+	sps, pps := forma.SafeParams()
+	require.Equal(t, testFrameSPS, sps)
+	require.Equal(t, testFramePPS, pps)
+
+	// NTP is computed from PTS
+	require.Equal(t, start.Add(1*time.Second), ntps[len(ntps)-1])
+
+	require.Equal(t, []*Frame{
+		{
+			KeyFrame: true,
+			Payload:  [][]byte{testFrameSPS, testFramePPS, idr},
+		},
+		{
+			PTS:     1 * time.Second,
+			DTS:     1 * time.Second,
+			Payload: [][]byte{{byte(h264.NALUTypeNonIDR), 1}},
+		},
+	}, frames)
+}
+
+func TestFrameEncoderGeneric(t *testing.T) {
+	forma := &formats.Generic{
+		PayloadTyp: 98,
+		RTPMap:     "custom/90000",
+	}
+	err := forma.Init()
+	require.NoError(t, err)
+
+	e := newFrameEncoder(forma)
+
+	var pkts []*rtp.Packet
+
+	for i := 0; i < 2; i++ {
+		err := e.encodeFrame(&Frame{
+			PTS:     time.Duration(i) * time.Second,
+			Payload: [][]byte{{0x01, 0x02, byte(i)}},
+		}, func(pkt *rtp.Packet, ntp time.Time) error {
+			pkts = append(pkts, pkt)
+			return nil
+		})
+		require.NoError(t, err)
+	}
+
+	require.Equal(t, 2, len(pkts))
+	require.Equal(t, uint8(98), pkts[0].PayloadType)
+	require.Equal(t, pkts[0].SequenceNumber+1, pkts[1].SequenceNumber)
+	require.Equal(t, pkts[0].Timestamp+90000, pkts[1].Timestamp)
+	require.Equal(t, []byte{0x01, 0x02, 0x01}, pkts[1].Payload)
+
+	err = e.encodeFrame(&Frame{
+		Payload: [][]byte{{0x01}, {0x02}},
+	}, func(pkt *rtp.Packet, ntp time.Time) error {
+		return nil
+	})
+	require.EqualError(t, err, "frame must contain a single element, but contains 2")
+}
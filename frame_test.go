@@ -0,0 +1,185 @@
+package gortsplib
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bluenviron/mediacommon/pkg/codecs/h264"
+	"github.com/bluenviron/mediacommon/pkg/codecs/h265"
+	"github.com/bluenviron/mediacommon/pkg/codecs/mpeg4audio"
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/gortsplib/v3/pkg/formats"
+)
+
+var (
+	testFrameSPS = []byte{
+		0x67, 0x64, 0x00, 0x0c, 0xac, 0x3b, 0x50, 0xb0,
+		0x4b, 0x42, 0x00, 0x00, 0x03, 0x00, 0x02, 0x00,
+		0x00, 0x03, 0x00, 0x3d, 0x08,
+	}
+	testFramePPS = []byte{0x68, 0xee, 0x3c, 0x80}
+)
+
+func TestFrameDecoderH264(t *testing.T) {
+	forma := &formats.H264{
+		PayloadTyp:        96,
+		SPS:               testFrameSPS,
+		PPS:               testFramePPS,
+		PacketizationMode: 1,
+	}
+
+	var frames []*Frame
+	fd := NewFrameDecoder(forma, func(fr *Frame) {
+		frames = append(frames, fr)
+	})
+
+	enc := forma.CreateEncoder()
+
+	encode := func(nalus [][]byte, pts time.Duration) []*rtp.Packet {
+		pkts, err := enc.Encode(nalus, pts)
+		require.NoError(t, err)
+		return pkts
+	}
+
+	process := func(pkts []*rtp.Packet) {
+		for _, pkt := range pkts {
+			err := fd.ProcessPacket(pkt)
+			require.NoError(t, err)
+		}
+	}
+
+	// access units that precede the first IDR are discarded
+	pkts := encode([][]byte{{byte(h264.NALUTypeNonIDR), 0}}, 0)
+	process(pkts)
+	require.Equal(t, 0, len(frames))
+
+	ntp := time.Date(2008, 5, 20, 22, 15, 20, 0, time.UTC)
+
+	fd.ProcessSenderReport(&rtcp.SenderReport{
+		SSRC:    pkts[0].SSRC,
+		NTPTime: uint64(ntp.Unix()+2208988800) << 32,
+		RTPTime: pkts[0].Timestamp,
+	})
+
+	// parameters are provided by the format only
+	process(encode([][]byte{{byte(h264.NALUTypeIDR), 1}}, 500*time.Millisecond))
+
+	// packets of a frame are lost
+	encode([][]byte{{byte(h264.NALUTypeNonIDR), 2}}, 1*time.Second)
+
+	process(encode([][]byte{{byte(h264.NALUTypeNonIDR), 3}}, 1500*time.Millisecond))
+
+	require.Equal(t, []*Frame{
+		{
+			PTS:      500 * time.Millisecond,
+			DTS:      500 * time.Millisecond,
+			NTP:      ntp.Add(500 * time.Millisecond).Local(),
+			KeyFrame: true,
+			Payload:  [][]byte{{byte(h264.NALUTypeIDR), 1}},
+		},
+		{
+			PTS:         1500 * time.Millisecond,
+			DTS:         1500 * time.Millisecond,
+			NTP:         ntp.Add(1500 * time.Millisecond).Local(),
+			PacketsLost: 1,
+			Payload:     [][]byte{{byte(h264.NALUTypeNonIDR), 3}},
+		},
+	}, frames)
+}
+
+func TestFrameDecoderMPEG4Audio(t *testing.T) {
+	forma := &formats.MPEG4Audio{
+		PayloadTyp: 96,
+		Config: &mpeg4audio.Config{
+			Type:         mpeg4audio.ObjectTypeAACLC,
+			SampleRate:   48000,
+			ChannelCount: 2,
+		},
+		SizeLength:       13,
+		IndexLength:      3,
+		IndexDeltaLength: 3,
+	}
+
+	var frames []*Frame
+	fd := NewFrameDecoder(forma, func(fr *Frame) {
+		frames = append(frames, fr)
+	})
+
+	pkts, err := forma.CreateEncoder().Encode([][]byte{{0x01, 0x02}, {0x03, 0x04}}, 0)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(pkts))
+
+	err = fd.ProcessPacket(pkts[0])
+	require.NoError(t, err)
+
+	// access units of the same packet have increasing timestamps
+	require.Equal(t, []*Frame{
+		{
+			KeyFrame: true,
+			Payload:  [][]byte{{0x01, 0x02}},
+		},
+		{
+			PTS:      mpeg4audio.SamplesPerAccessUnit * time.Second / 48000,
+			DTS:      mpeg4audio.SamplesPerAccessUnit * time.Second / 48000,
+			KeyFrame: true,
+			Payload:  [][]byte{{0x03, 0x04}},
+		},
+	}, frames)
+}
+
+func TestFrameDecoderGeneric(t *testing.T) {
+	forma := &formats.Generic{
+		PayloadTyp: 98,
+		RTPMap:     "custom/90000",
+	}
+	err := forma.Init()
+	require.NoError(t, err)
+
+	var frames []*Frame
+	fd := NewFrameDecoder(forma, func(fr *Frame) {
+		frames = append(frames, fr)
+	})
+
+	for i, ts := range []uint32{1000, 1000 + 90000} {
+		err := fd.ProcessPacket(&rtp.Packet{
+			Header: rtp.Header{
+				Version:        2,
+				PayloadType:    98,
+				SequenceNumber: uint16(100 + i),
+				Timestamp:      ts,
+				SSRC:           0x38F27A2F,
+			},
+			Payload: []byte{0x01, 0x02, byte(i)},
+		})
+		require.NoError(t, err)
+	}
+
+	// RTP payloads are provided as they are
+	require.Equal(t, []*Frame{
+		{
+			Payload: [][]byte{{0x01, 0x02, 0x00}},
+		},
+		{
+			PTS:     1 * time.Second,
+			DTS:     1 * time.Second,
+			Payload: [][]byte{{0x01, 0x02, 0x01}},
+		},
+	}, frames)
+}
+
+func TestVP9IsKeyFrame(t *testing.T) {
+	require.Equal(t, true, vp9IsKeyFrame([]byte{0x82, 0x49, 0x83, 0x42}))
+	require.Equal(t, false, vp9IsKeyFrame([]byte{0x86, 0x00, 0x40}))
+	require.Equal(t, false, vp9IsKeyFrame([]byte{0x88}))
+}
+
+func TestKeyFramePresentEmptyNALU(t *testing.T) {
+	require.Equal(t, true, h264IDRPresent([][]byte{{}, {byte(h264.NALUTypeIDR)}}))
+	require.Equal(t, false, h264IDRPresent([][]byte{{}}))
+
+	require.Equal(t, true, h265IRAPPresent([][]byte{{}, {byte(h265.NALUType_RSV_IRAP_VCL22) << 1, 1}}))
+	require.Equal(t, false, h265IRAPPresent([][]byte{{}}))
+}
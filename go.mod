@@ -5,19 +5,32 @@ go 1.18
 require (
 	github.com/asticode/go-astits v1.11.0
 	github.com/bluenviron/mediacommon v0.2.0
-	github.com/google/uuid v1.3.0
-	github.com/pion/rtcp v1.2.10
-	github.com/pion/rtp v0.0.0-20230107162714-c3ea6851e25b
+	github.com/google/uuid v1.3.1
+	github.com/pion/interceptor v0.1.25
+	github.com/pion/rtcp v1.2.12
+	github.com/pion/rtp v1.8.3
 	github.com/pion/sdp/v3 v3.0.6
-	github.com/stretchr/testify v1.8.2
-	golang.org/x/net v0.8.0
+	github.com/pion/webrtc/v3 v3.2.24
+	github.com/stretchr/testify v1.8.4
+	golang.org/x/net v0.14.0
 )
 
 require (
 	github.com/asticode/go-astikit v0.30.0 // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/pion/datachannel v1.5.5 // indirect
+	github.com/pion/dtls/v2 v2.2.7 // indirect
+	github.com/pion/ice/v2 v2.3.11 // indirect
+	github.com/pion/logging v0.2.2 // indirect
+	github.com/pion/mdns v0.0.8 // indirect
 	github.com/pion/randutil v0.1.0 // indirect
+	github.com/pion/sctp v1.8.8 // indirect
+	github.com/pion/srtp/v2 v2.0.18 // indirect
+	github.com/pion/stun v0.6.1 // indirect
+	github.com/pion/transport/v2 v2.2.3 // indirect
+	github.com/pion/turn/v2 v2.1.3 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	golang.org/x/sys v0.6.0 // indirect
+	golang.org/x/crypto v0.12.0 // indirect
+	golang.org/x/sys v0.11.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,14 @@
+package gortsplib
+
+import (
+	"github.com/pion/rtp"
+
+	"github.com/bluenviron/gortsplib/v3/pkg/formats"
+	"github.com/bluenviron/gortsplib/v3/pkg/media"
+)
+
+// PacketSource is a source of RTP packets.
+// It is implemented by Client, ServerSession and ServerStreamReader.
+type PacketSource interface {
+	OnPacketRTP(medi *media.Media, forma formats.Format, cb func(*rtp.Packet))
+}
@@ -0,0 +1,223 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v3/pkg/base"
+	"github.com/bluenviron/gortsplib/v3/pkg/headers"
+	"github.com/bluenviron/gortsplib/v3/pkg/url"
+)
+
+// ErrStaleNonce is returned by Authenticator.ValidateRequest when
+// credentials are valid but the nonce is expired.
+var ErrStaleNonce = errors.New("nonce is expired")
+
+// overridden in tests.
+var timeNow = time.Now
+
+// Authenticator allows to validate credentials of multiple users,
+// provided by a CredentialProvider.
+// Unlike Validator, nonces of the Digest method expire.
+type Authenticator struct {
+	// credential provider.
+	Credentials CredentialProvider
+
+	// realm.
+	// It defaults to "IPCAM".
+	Realm string
+
+	// authentication methods.
+	// It defaults to Basic and Digest.
+	Methods []headers.AuthMethod
+
+	// lifetime of nonces.
+	// It defaults to 5 minutes.
+	NonceLifetime time.Duration
+
+	secret []byte
+}
+
+// Init initializes the Authenticator.
+func (a *Authenticator) Init() {
+	if a.Realm == "" {
+		a.Realm = "IPCAM"
+	}
+	if a.Methods == nil {
+		a.Methods = []headers.AuthMethod{headers.AuthBasic, headers.AuthDigest}
+	}
+	if a.NonceLifetime == 0 {
+		a.NonceLifetime = 5 * time.Minute
+	}
+
+	a.secret = make([]byte, 32)
+	rand.Read(a.secret)
+}
+
+func (a *Authenticator) nonceSignature(ts []byte) []byte {
+	h := hmac.New(sha256.New, a.secret)
+	h.Write(ts)
+	return h.Sum(nil)[:16]
+}
+
+// nonce returns a nonce that contains its creation time and a signature.
+func (a *Authenticator) nonce() string {
+	ts := make([]byte, 8)
+	binary.BigEndian.PutUint64(ts, uint64(timeNow().UnixNano()))
+	return hex.EncodeToString(append(ts, a.nonceSignature(ts)...))
+}
+
+func (a *Authenticator) checkNonce(nonce string) (bool, error) {
+	byts, err := hex.DecodeString(nonce)
+	if err != nil || len(byts) != 24 {
+		return false, fmt.Errorf("wrong nonce")
+	}
+
+	if !hmac.Equal(byts[8:], a.nonceSignature(byts[:8])) {
+		return false, fmt.Errorf("wrong nonce")
+	}
+
+	created := time.Unix(0, int64(binary.BigEndian.Uint64(byts[:8])))
+	return timeNow().Sub(created) >= a.NonceLifetime, nil
+}
+
+// Header generates the WWW-Authenticate header needed by a client to
+// authenticate. If stale is true, the client is notified that its nonce
+// is expired and that it can repeat the request with the new nonce
+// without asking the user for new credentials.
+func (a *Authenticator) Header(stale bool) base.HeaderValue {
+	var ret base.HeaderValue
+	for _, m := range a.Methods {
+		switch m {
+		case headers.AuthBasic:
+			ret = append(ret, (&headers.Authenticate{
+				Method: headers.AuthBasic,
+				Realm:  &a.Realm,
+			}).Marshal()...)
+
+		case headers.AuthDigest:
+			nonce := a.nonce()
+			h := headers.Authenticate{
+				Method: headers.AuthDigest,
+				Realm:  &a.Realm,
+				Nonce:  &nonce,
+			}
+			if stale {
+				v := "true"
+				h.Stale = &v
+			}
+			ret = append(ret, h.Marshal()...)
+		}
+	}
+	return ret
+}
+
+func (a *Authenticator) methodEnabled(m headers.AuthMethod) bool {
+	for _, m2 := range a.Methods {
+		if m2 == m {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateRequest validates a request sent by a client and returns the
+// authenticated user.
+// If credentials are valid but the nonce is expired, ErrStaleNonce is returned.
+func (a *Authenticator) ValidateRequest(req *base.Request, baseURL *url.URL) (string, error) {
+	var auth headers.Authorization
+	err := auth.Unmarshal(req.Header["Authorization"])
+	if err != nil {
+		return "", err
+	}
+
+	if !a.methodEnabled(auth.Method) {
+		return "", fmt.Errorf("authentication method not enabled")
+	}
+
+	switch auth.Method {
+	case headers.AuthBasic:
+		pass, ok := a.Credentials.Password(auth.BasicUser)
+		if !ok || !checkPassword(pass, auth.BasicPass) {
+			return "", fmt.Errorf("wrong response")
+		}
+
+		return auth.BasicUser, nil
+
+	default: // headers.AuthDigest
+		if auth.DigestValues.Realm == nil {
+			return "", fmt.Errorf("realm is missing")
+		}
+
+		if auth.DigestValues.Nonce == nil {
+			return "", fmt.Errorf("nonce is missing")
+		}
+
+		if auth.DigestValues.Username == nil {
+			return "", fmt.Errorf("username is missing")
+		}
+
+		if auth.DigestValues.URI == nil {
+			return "", fmt.Errorf("uri is missing")
+		}
+
+		if auth.DigestValues.Response == nil {
+			return "", fmt.Errorf("response is missing")
+		}
+
+		stale, err := a.checkNonce(*auth.DigestValues.Nonce)
+		if err != nil {
+			return "", err
+		}
+
+		if *auth.DigestValues.Realm != a.Realm {
+			return "", fmt.Errorf("wrong realm")
+		}
+
+		user := *auth.DigestValues.Username
+
+		pass, ok := a.Credentials.Password(user)
+		if !ok {
+			return "", fmt.Errorf("wrong username")
+		}
+
+		// hashed passwords can't be used to compute the response
+		if isHashedPassword(pass) {
+			return "", fmt.Errorf("wrong response")
+		}
+
+		ur := req.URL
+
+		if *auth.DigestValues.URI != ur.String() {
+			// in SETUP requests, VLC strips the control attribute.
+			// try again with the base URL.
+			if baseURL != nil {
+				ur = baseURL
+				if *auth.DigestValues.URI != ur.String() {
+					return "", fmt.Errorf("wrong URL")
+				}
+			} else {
+				return "", fmt.Errorf("wrong URL")
+			}
+		}
+
+		response := md5Hex(md5Hex(user+":"+a.Realm+":"+pass) +
+			":" + *auth.DigestValues.Nonce + ":" + md5Hex(string(req.Method)+":"+ur.String()))
+
+		if !stringsEqual(*auth.DigestValues.Response, response) {
+			return "", fmt.Errorf("wrong response")
+		}
+
+		if stale {
+			return "", ErrStaleNonce
+		}
+
+		return user, nil
+	}
+}
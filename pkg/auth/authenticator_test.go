@@ -0,0 +1,165 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/gortsplib/v3/pkg/base"
+	"github.com/bluenviron/gortsplib/v3/pkg/headers"
+)
+
+func TestAuthenticator(t *testing.T) {
+	for _, method := range []headers.AuthMethod{headers.AuthBasic, headers.AuthDigest} {
+		for _, conf := range []string{
+			"nofail",
+			"wronguser",
+			"wrongpass",
+			"hashed",
+		} {
+			t.Run(map[headers.AuthMethod]string{
+				headers.AuthBasic:  "basic",
+				headers.AuthDigest: "digest",
+			}[method]+"_"+conf, func(t *testing.T) {
+				a := &Authenticator{
+					Credentials: StaticCredentials{
+						"user1": "pass1",
+						"user2": "sha256:" + sha256Base64("pass2"),
+					},
+					Realm:   "myrealm",
+					Methods: []headers.AuthMethod{method},
+				}
+				a.Init()
+
+				user, pass := "user1", "pass1"
+				switch conf {
+				case "wronguser":
+					user = "user3"
+				case "wrongpass":
+					pass = "pass2"
+				case "hashed":
+					user, pass = "user2", "pass2"
+				}
+
+				se, err := NewSender(a.Header(false), user, pass)
+				require.NoError(t, err)
+
+				req := &base.Request{
+					Method: base.Describe,
+					URL:    mustParseURL("rtsp://myhost/mypath"),
+				}
+				se.AddAuthorization(req)
+
+				authUser, err := a.ValidateRequest(req, nil)
+
+				switch {
+				case conf == "nofail" || (conf == "hashed" && method == headers.AuthBasic):
+					require.NoError(t, err)
+					require.Equal(t, user, authUser)
+
+				default:
+					require.Error(t, err)
+				}
+			})
+		}
+	}
+}
+
+func TestAuthenticatorStaleNonce(t *testing.T) {
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	a := &Authenticator{
+		Credentials:   StaticCredentials{"myuser": "mypass"},
+		Methods:       []headers.AuthMethod{headers.AuthDigest},
+		NonceLifetime: 10 * time.Second,
+	}
+	a.Init()
+
+	for _, ca := range []struct {
+		name  string
+		pass  string
+		valid bool
+	}{
+		{"valid credentials", "mypass", true},
+		{"invalid credentials", "wrongpass", false},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			now = time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+			se, err := NewSender(a.Header(false), "myuser", ca.pass)
+			require.NoError(t, err)
+
+			req := &base.Request{
+				Method: base.Describe,
+				URL:    mustParseURL("rtsp://myhost/mypath"),
+			}
+			se.AddAuthorization(req)
+
+			now = now.Add(5 * time.Second)
+			_, err = a.ValidateRequest(req, nil)
+			if ca.valid {
+				require.NoError(t, err)
+			} else {
+				require.EqualError(t, err, "wrong response")
+			}
+
+			now = now.Add(5 * time.Second)
+			_, err = a.ValidateRequest(req, nil)
+			if ca.valid {
+				require.Equal(t, ErrStaleNonce, err)
+			} else {
+				require.EqualError(t, err, "wrong response")
+			}
+		})
+	}
+
+	var h headers.Authenticate
+	err := h.Unmarshal(a.Header(true))
+	require.NoError(t, err)
+	require.Equal(t, "true", *h.Stale)
+}
+
+func TestAuthenticatorErrors(t *testing.T) {
+	a := &Authenticator{
+		Credentials: StaticCredentials{"myuser": "mypass"},
+		Methods:     []headers.AuthMethod{headers.AuthDigest},
+	}
+	a.Init()
+
+	for _, ca := range []struct {
+		name string
+		hv   base.HeaderValue
+		err  string
+	}{
+		{
+			"method not enabled",
+			base.HeaderValue{`Basic bXl1c2VyOm15cGFzcw==`},
+			"authentication method not enabled",
+		},
+		{
+			"digest invalid nonce",
+			base.HeaderValue{`Digest realm=IPCAM,nonce=123,username=myuser,uri=123,response=123`},
+			"wrong nonce",
+		},
+		{
+			"digest forged nonce",
+			base.HeaderValue{`Digest realm=IPCAM,nonce=000000000000000000000000000000000000000000000000,` +
+				`username=myuser,uri=123,response=123`},
+			"wrong nonce",
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			_, err := a.ValidateRequest(&base.Request{
+				Method: base.Describe,
+				URL:    nil,
+				Header: base.Header{
+					"Authorization": ca.hv,
+				},
+			}, nil)
+			require.EqualError(t, err, ca.err)
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// CredentialProvider provides the credentials of users.
+type CredentialProvider interface {
+	// Password returns the password of a user, or false if the user doesn't exist.
+	// The password can be in plain text or hashed. Hashed passwords
+	// begin with "sha256:" (base64-encoded SHA256) or "{SHA}" (base64-encoded SHA1)
+	// and can only be validated with the Basic method.
+	Password(user string) (string, bool)
+}
+
+// StaticCredentials is a CredentialProvider that contains a fixed set of users.
+// Keys are users and values are passwords.
+type StaticCredentials map[string]string
+
+// Password implements CredentialProvider.
+func (sc StaticCredentials) Password(user string) (string, bool) {
+	pass, ok := sc[user]
+	return pass, ok
+}
+
+// CredentialFunc is a CredentialProvider that calls a function.
+type CredentialFunc func(user string) (string, bool)
+
+// Password implements CredentialProvider.
+func (f CredentialFunc) Password(user string) (string, bool) {
+	return f(user)
+}
+
+// Htpasswd is a CredentialProvider that reads credentials from a htpasswd-style file.
+// Each line contains a user and a password, separated by a colon.
+// Passwords can be in plain text or hashed with SHA1 ("{SHA}" prefix).
+type Htpasswd struct {
+	mutex sync.RWMutex
+	users map[string]string
+}
+
+// ParseHtpasswd parses credentials in htpasswd format.
+func ParseHtpasswd(r io.Reader) (*Htpasswd, error) {
+	h := &Htpasswd{}
+	err := h.read(r)
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// LoadHtpasswd loads credentials from a htpasswd-style file.
+func LoadHtpasswd(fpath string) (*Htpasswd, error) {
+	h := &Htpasswd{}
+	err := h.load(fpath)
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Reload reloads credentials from a htpasswd-style file.
+// Existing credentials are kept in case of errors.
+func (h *Htpasswd) Reload(fpath string) error {
+	return h.load(fpath)
+}
+
+func (h *Htpasswd) load(fpath string) error {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return h.read(f)
+}
+
+func (h *Htpasswd) read(r io.Reader) error {
+	users := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	n := 0
+
+	for scanner.Scan() {
+		n++
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		i := strings.IndexByte(line, ':')
+		if i <= 0 {
+			return fmt.Errorf("invalid line %d", n)
+		}
+		user, pass := line[:i], line[i+1:]
+
+		if strings.HasPrefix(pass, "$") {
+			return fmt.Errorf("unsupported password hash of user '%s'", user)
+		}
+
+		users[user] = pass
+	}
+
+	err := scanner.Err()
+	if err != nil {
+		return err
+	}
+
+	h.mutex.Lock()
+	h.users = users
+	h.mutex.Unlock()
+
+	return nil
+}
+
+// Password implements CredentialProvider.
+func (h *Htpasswd) Password(user string) (string, bool) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	pass, ok := h.users[user]
+	return pass, ok
+}
@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHtpasswd(t *testing.T) {
+	h, err := ParseHtpasswd(strings.NewReader("# comment\n" +
+		"\n" +
+		"user1:pass1\n" +
+		"user2:{SHA}" + sha1Base64("pass2") + "\n"))
+	require.NoError(t, err)
+
+	pass, ok := h.Password("user1")
+	require.Equal(t, true, ok)
+	require.Equal(t, "pass1", pass)
+
+	pass, ok = h.Password("user2")
+	require.Equal(t, true, ok)
+	require.Equal(t, true, checkPassword(pass, "pass2"))
+	require.Equal(t, false, checkPassword(pass, "pass1"))
+
+	_, ok = h.Password("user3")
+	require.Equal(t, false, ok)
+}
+
+func TestHtpasswdErrors(t *testing.T) {
+	for _, ca := range []struct {
+		name string
+		byts string
+		err  string
+	}{
+		{
+			"missing colon",
+			"user1pass1\n",
+			"invalid line 1",
+		},
+		{
+			"missing user",
+			"user1:pass1\n:pass2\n",
+			"invalid line 2",
+		},
+		{
+			"unsupported hash",
+			"user1:$apr1$abcdefgh$abcdefghijklmnopqrstuv\n",
+			"unsupported password hash of user 'user1'",
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			_, err := ParseHtpasswd(strings.NewReader(ca.byts))
+			require.EqualError(t, err, ca.err)
+		})
+	}
+}
+
+func TestHtpasswdReload(t *testing.T) {
+	fpath := filepath.Join(t.TempDir(), "htpasswd")
+
+	err := os.WriteFile(fpath, []byte("user1:pass1\n"), 0o644)
+	require.NoError(t, err)
+
+	h, err := LoadHtpasswd(fpath)
+	require.NoError(t, err)
+
+	err = os.WriteFile(fpath, []byte("user2:pass2\n"), 0o644)
+	require.NoError(t, err)
+
+	err = h.Reload(fpath)
+	require.NoError(t, err)
+
+	_, ok := h.Password("user1")
+	require.Equal(t, false, ok)
+
+	pass, ok := h.Password("user2")
+	require.Equal(t, true, ok)
+	require.Equal(t, "pass2", pass)
+}
@@ -2,9 +2,12 @@ package auth
 
 import (
 	"crypto/md5"
+	"crypto/sha1"
 	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/base64"
 	"encoding/hex"
+	"strings"
 )
 
 func md5Hex(in string) string {
@@ -18,3 +21,31 @@ func sha256Base64(in string) string {
 	h.Write([]byte(in))
 	return base64.StdEncoding.EncodeToString(h.Sum(nil))
 }
+
+func sha1Base64(in string) string {
+	h := sha1.New()
+	h.Write([]byte(in))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+func isHashedPassword(pass string) bool {
+	return strings.HasPrefix(pass, "sha256:") || strings.HasPrefix(pass, "{SHA}")
+}
+
+func stringsEqual(a string, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// checkPassword compares a password provided by a client with a
+// password that can be in plain text or hashed.
+func checkPassword(stored string, provided string) bool {
+	switch {
+	case strings.HasPrefix(stored, "sha256:"):
+		return stringsEqual(sha256Base64(provided), strings.TrimPrefix(stored, "sha256:"))
+
+	case strings.HasPrefix(stored, "{SHA}"):
+		return stringsEqual(sha1Base64(provided), strings.TrimPrefix(stored, "{SHA}"))
+	}
+
+	return stringsEqual(provided, stored)
+}
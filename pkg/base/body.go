@@ -7,13 +7,9 @@ import (
 	"strconv"
 )
 
-const (
-	rtspMaxContentLength = 128 * 1024
-)
-
 type body []byte
 
-func (b *body) unmarshal(header Header, rb *bufio.Reader) error {
+func (b *body) unmarshal(header Header, rb *bufio.Reader, maxSize int) error {
 	cls, ok := header["Content-Length"]
 	if !ok || len(cls) != 1 {
 		*b = nil
@@ -25,9 +21,9 @@ func (b *body) unmarshal(header Header, rb *bufio.Reader) error {
 		return fmt.Errorf("invalid Content-Length")
 	}
 
-	if cl > rtspMaxContentLength {
+	if cl > int64(maxSize) {
 		return fmt.Errorf("Content-Length exceeds %d (it's %d)",
-			rtspMaxContentLength, cl)
+			maxSize, cl)
 	}
 
 	*b = make([]byte, cl)
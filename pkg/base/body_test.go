@@ -26,7 +26,7 @@ func TestBodyUnmarshal(t *testing.T) {
 	for _, ca := range casesBody {
 		t.Run(ca.name, func(t *testing.T) {
 			var p body
-			err := p.unmarshal(ca.h, bufio.NewReader(bytes.NewReader(ca.byts)))
+			err := p.unmarshal(ca.h, bufio.NewReader(bytes.NewReader(ca.byts)), defaultMaxBodySize)
 			require.NoError(t, err)
 			require.Equal(t, ca.byts, []byte(p))
 		})
@@ -67,7 +67,7 @@ func TestBodyUnmarshalErrors(t *testing.T) {
 	} {
 		t.Run(ca.name, func(t *testing.T) {
 			var p body
-			err := p.unmarshal(ca.h, bufio.NewReader(bytes.NewReader(ca.byts)))
+			err := p.unmarshal(ca.h, bufio.NewReader(bytes.NewReader(ca.byts)), defaultMaxBodySize)
 			require.EqualError(t, err, ca.err)
 		})
 	}
@@ -34,9 +34,10 @@ type HeaderValue []string
 // Header is a RTSP reader, present in both Requests and Responses.
 type Header map[string]HeaderValue
 
-func (h *Header) unmarshal(br *bufio.Reader) error {
+func (h *Header) unmarshal(br *bufio.Reader, maxSize int) error {
 	*h = make(Header)
 	count := 0
+	size := 2
 
 	for {
 		byt, err := br.ReadByte()
@@ -58,7 +59,7 @@ func (h *Header) unmarshal(br *bufio.Reader) error {
 		}
 
 		key := string([]byte{byt})
-		byts, err := readBytesLimited(br, ':', headerMaxKeyLength-1)
+		byts, err := readHeaderKey(br, headerMaxKeyLength-1)
 		if err != nil {
 			return fmt.Errorf("value is missing")
 		}
@@ -90,6 +91,11 @@ func (h *Header) unmarshal(br *bufio.Reader) error {
 			return err
 		}
 
+		size += len(key) + len(val) + 4
+		if size > maxSize {
+			return fmt.Errorf("header size exceeds %d", maxSize)
+		}
+
 		(*h)[key] = append((*h)[key], val)
 		count++
 	}
@@ -3,6 +3,7 @@ package base
 import (
 	"bufio"
 	"bytes"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -109,7 +110,7 @@ func TestHeaderUnmarshal(t *testing.T) {
 	for _, ca := range cases {
 		t.Run(ca.name, func(t *testing.T) {
 			h := make(Header)
-			err := h.unmarshal(bufio.NewReader(bytes.NewBuffer(ca.dec)))
+			err := h.unmarshal(bufio.NewReader(bytes.NewBuffer(ca.dec)), defaultMaxHeaderSize)
 			require.NoError(t, err)
 			require.Equal(t, ca.header, h)
 		})
@@ -152,6 +153,11 @@ func TestHeaderUnmarshalErrors(t *testing.T) {
 			[]byte("Testing\r\n"),
 			"value is missing",
 		},
+		{
+			"missing value with following headers",
+			[]byte("Testing\r\nTesting: val\r\n\r\n"),
+			"value is missing",
+		},
 		{
 			"too many entries",
 			func() []byte {
@@ -164,10 +170,22 @@ func TestHeaderUnmarshalErrors(t *testing.T) {
 			}(),
 			"headers count exceeds 255",
 		},
+		{
+			"too big",
+			func() []byte {
+				var ret []byte
+				for i := 0; i < 40; i++ {
+					ret = append(ret, []byte("Testing: "+strings.Repeat("a", 2000)+"\r\n")...)
+				}
+				ret = append(ret, []byte("\r\n")...)
+				return ret
+			}(),
+			"header size exceeds 65536",
+		},
 	} {
 		t.Run(ca.name, func(t *testing.T) {
 			h := make(Header)
-			err := h.unmarshal(bufio.NewReader(bytes.NewBuffer(ca.dec)))
+			err := h.unmarshal(bufio.NewReader(bytes.NewBuffer(ca.dec)), defaultMaxHeaderSize)
 			require.EqualError(t, err, ca.err)
 		})
 	}
@@ -83,3 +83,28 @@ func TestInterleavedFrameMarshal(t *testing.T) {
 		})
 	}
 }
+
+func FuzzInterleavedFrameUnmarshal(f *testing.F) {
+	for _, ca := range casesInterleavedFrame {
+		f.Add(ca.enc)
+	}
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		var fr InterleavedFrame
+		err := fr.Unmarshal(bufio.NewReader(bytes.NewBuffer(b)))
+		if err != nil {
+			return
+		}
+
+		byts, err := fr.Marshal()
+		require.NoError(t, err)
+
+		var fr2 InterleavedFrame
+		err = fr2.Unmarshal(bufio.NewReader(bytes.NewBuffer(byts)))
+		require.NoError(t, err)
+
+		byts2, err := fr2.Marshal()
+		require.NoError(t, err)
+		require.Equal(t, byts, byts2)
+	})
+}
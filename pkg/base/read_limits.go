@@ -0,0 +1,32 @@
+package base
+
+const (
+	defaultMaxHeaderSize = 64 * 1024
+	defaultMaxBodySize   = 128 * 1024
+)
+
+// ReadLimits contains the limits applied when reading requests and responses,
+// in order to prevent the other party from exhausting memory.
+type ReadLimits struct {
+	// maximum size of the header section.
+	// It defaults to 64 KiB.
+	MaxHeaderSize int
+
+	// maximum size of the body.
+	// It defaults to 128 KiB.
+	MaxBodySize int
+}
+
+func (l ReadLimits) maxHeaderSize() int {
+	if l.MaxHeaderSize == 0 {
+		return defaultMaxHeaderSize
+	}
+	return l.MaxHeaderSize
+}
+
+func (l ReadLimits) maxBodySize() int {
+	if l.MaxBodySize == 0 {
+		return defaultMaxBodySize
+	}
+	return l.MaxBodySize
+}
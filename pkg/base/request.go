@@ -28,6 +28,7 @@ const (
 	Pause        Method = "PAUSE"
 	Play         Method = "PLAY"
 	Record       Method = "RECORD"
+	Redirect     Method = "REDIRECT"
 	Setup        Method = "SETUP"
 	SetParameter Method = "SET_PARAMETER"
 	Teardown     Method = "TEARDOWN"
@@ -50,6 +51,11 @@ type Request struct {
 
 // Unmarshal reads a request.
 func (req *Request) Unmarshal(br *bufio.Reader) error {
+	return req.UnmarshalWithLimits(br, ReadLimits{})
+}
+
+// UnmarshalWithLimits reads a request, applying the given limits.
+func (req *Request) UnmarshalWithLimits(br *bufio.Reader, limits ReadLimits) error {
 	byts, err := readBytesLimited(br, ' ', requestMaxMethodLength)
 	if err != nil {
 		return err
@@ -87,12 +93,12 @@ func (req *Request) Unmarshal(br *bufio.Reader) error {
 		return err
 	}
 
-	err = req.Header.unmarshal(br)
+	err = req.Header.unmarshal(br, limits.maxHeaderSize())
 	if err != nil {
 		return err
 	}
 
-	err = (*body)(&req.Body).unmarshal(req.Header, br)
+	err = (*body)(&req.Body).unmarshal(req.Header, br, limits.maxBodySize())
 	if err != nil {
 		return err
 	}
@@ -228,6 +228,25 @@ func TestRequestUnmarshalErrors(t *testing.T) {
 	}
 }
 
+func TestRequestUnmarshalWithLimits(t *testing.T) {
+	byts := []byte("ANNOUNCE rtsp://testing123 RTSP/1.0\r\n" +
+		"CSeq: 1\r\n" +
+		"Content-Length: 8\r\n" +
+		"\r\n" +
+		"12345678")
+
+	var req Request
+	err := req.UnmarshalWithLimits(bufio.NewReader(bytes.NewBuffer(byts)), ReadLimits{MaxBodySize: 8})
+	require.NoError(t, err)
+	require.Equal(t, []byte("12345678"), req.Body)
+
+	err = req.UnmarshalWithLimits(bufio.NewReader(bytes.NewBuffer(byts)), ReadLimits{MaxBodySize: 4})
+	require.EqualError(t, err, "Content-Length exceeds 4 (it's 8)")
+
+	err = req.UnmarshalWithLimits(bufio.NewReader(bytes.NewBuffer(byts)), ReadLimits{MaxHeaderSize: 16})
+	require.EqualError(t, err, "header size exceeds 16")
+}
+
 func TestRequestMarshal(t *testing.T) {
 	for _, ca := range casesRequest {
 		t.Run(ca.name, func(t *testing.T) {
@@ -250,3 +269,29 @@ func TestRequestString(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, string(byts), req.String())
 }
+
+func FuzzRequestUnmarshal(f *testing.F) {
+	for _, ca := range casesRequest {
+		f.Add(ca.byts)
+	}
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		var req Request
+		err := req.Unmarshal(bufio.NewReader(bytes.NewBuffer(b)))
+		if err != nil {
+			return
+		}
+
+		byts, err := req.Marshal()
+		require.NoError(t, err)
+
+		var req2 Request
+		err = req2.Unmarshal(bufio.NewReader(bytes.NewBuffer(byts)))
+		require.NoError(t, err)
+
+		// requests are compared in encoded form, since URLs contain parsing details
+		byts2, err := req2.Marshal()
+		require.NoError(t, err)
+		require.Equal(t, byts, byts2)
+	})
+}
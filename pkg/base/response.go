@@ -134,6 +134,11 @@ type Response struct {
 
 // Unmarshal reads a response.
 func (res *Response) Unmarshal(br *bufio.Reader) error {
+	return res.UnmarshalWithLimits(br, ReadLimits{})
+}
+
+// UnmarshalWithLimits reads a response, applying the given limits.
+func (res *Response) UnmarshalWithLimits(br *bufio.Reader, limits ReadLimits) error {
 	byts, err := readBytesLimited(br, ' ', 255)
 	if err != nil {
 		return err
@@ -171,12 +176,12 @@ func (res *Response) Unmarshal(br *bufio.Reader) error {
 		return err
 	}
 
-	err = res.Header.unmarshal(br)
+	err = res.Header.unmarshal(br, limits.maxHeaderSize())
 	if err != nil {
 		return err
 	}
 
-	err = (*body)(&res.Body).unmarshal(res.Header, br)
+	err = (*body)(&res.Body).unmarshal(res.Header, br, limits.maxBodySize())
 	if err != nil {
 		return err
 	}
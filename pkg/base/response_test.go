@@ -224,3 +224,28 @@ func TestResponseString(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, string(byts), res.String())
 }
+
+func FuzzResponseUnmarshal(f *testing.F) {
+	for _, ca := range casesResponse {
+		f.Add(ca.byts)
+	}
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		var res Response
+		err := res.Unmarshal(bufio.NewReader(bytes.NewBuffer(b)))
+		if err != nil {
+			return
+		}
+
+		byts, err := res.Marshal()
+		require.NoError(t, err)
+
+		var res2 Response
+		err = res2.Unmarshal(bufio.NewReader(bytes.NewBuffer(byts)))
+		require.NoError(t, err)
+
+		byts2, err := res2.Marshal()
+		require.NoError(t, err)
+		require.Equal(t, byts, byts2)
+	})
+}
@@ -32,3 +32,28 @@ func readBytesLimited(rb *bufio.Reader, delim byte, n int) ([]byte, error) {
 	}
 	return nil, fmt.Errorf("buffer length exceeds %d", n)
 }
+
+// readHeaderKey reads a header key until the colon.
+// Unlike readBytesLimited, it stops at the end of the line, in order not to wait for a colon
+// in the following lines when the colon is missing.
+func readHeaderKey(rb *bufio.Reader, n int) ([]byte, error) {
+	for i := 1; i <= n; i++ {
+		byts, err := rb.Peek(i)
+		if err != nil {
+			return nil, err
+		}
+
+		switch byts[len(byts)-1] {
+		case ':':
+			_, err := rb.Discard(len(byts))
+			if err != nil {
+				return nil, err
+			}
+			return byts, nil
+
+		case '\r', '\n':
+			return nil, fmt.Errorf("colon is missing")
+		}
+	}
+	return nil, fmt.Errorf("buffer length exceeds %d", n)
+}
@@ -0,0 +1,81 @@
+// Package capture contains utilities to capture RTSP sessions into pcapng or rtpdump files
+// and to replay them.
+package capture
+
+import (
+	"net"
+	"time"
+)
+
+// Protocol is the transport protocol of a captured packet.
+type Protocol int
+
+// transport protocols.
+const (
+	ProtocolTCP Protocol = iota
+	ProtocolUDP
+)
+
+// Content is the content of a captured packet.
+type Content int
+
+// contents.
+const (
+	// a RTSP request or response.
+	ContentRTSP Content = iota
+
+	// a RTP packet.
+	ContentRTP
+
+	// a RTCP packet.
+	ContentRTCP
+)
+
+// Packet is a captured packet.
+type Packet struct {
+	// time at which the packet has been sent or received.
+	Time time.Time
+
+	// transport protocol.
+	Protocol Protocol
+
+	// source address.
+	SrcIP   net.IP
+	SrcPort int
+
+	// destination address.
+	DstIP   net.IP
+	DstPort int
+
+	// content of the packet.
+	Content Content
+
+	// channel of the interleaved frame that contains the packet.
+	// It is filled only when Protocol is TCP and Content is RTP or RTCP.
+	Channel int
+
+	// the RTSP message, or the RTP or RTCP packet.
+	Payload []byte
+}
+
+// Writer is a capture writer.
+// Implementations must be safe for concurrent use,
+// since packets are written by multiple routines.
+type Writer interface {
+	// WritePacket writes a packet.
+	WritePacket(pkt *Packet) error
+}
+
+// Reader is a capture reader.
+type Reader interface {
+	// ReadPacket reads the next packet.
+	// At the end of the capture, io.EOF is returned.
+	ReadPacket() (*Packet, error)
+}
+
+// isRTCP checks whether a packet received through UDP contains RTCP,
+// by checking the payload type field.
+// Specification: RFC5761, section 4
+func isRTCP(payload []byte) bool {
+	return len(payload) >= 2 && payload[1] >= 192 && payload[1] <= 223
+}
@@ -0,0 +1,258 @@
+package capture
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+)
+
+const (
+	ipProtocolTCP = 6
+	ipProtocolUDP = 17
+
+	ipv4HeaderSize = 20
+	ipv6HeaderSize = 40
+	tcpHeaderSize  = 20
+	udpHeaderSize  = 8
+
+	ipTTL = 64
+)
+
+// ipChecksum computes the checksum of a IPv4 header.
+// Specification: RFC1071
+func ipChecksum(buf []byte) uint16 {
+	var sum uint32
+	for i := 0; i < len(buf)-1; i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(buf[i:]))
+	}
+	for sum > 0xFFFF {
+		sum = (sum >> 16) + (sum & 0xFFFF)
+	}
+	return ^uint16(sum)
+}
+
+// tcpPayload returns the bytes that are sent through the TCP connection,
+// that are the RTSP message or the interleaved frame containing the packet.
+func tcpPayload(pkt *Packet) []byte {
+	if pkt.Content == ContentRTSP {
+		return pkt.Payload
+	}
+
+	buf := make([]byte, 4+len(pkt.Payload))
+	buf[0] = '$'
+	buf[1] = byte(pkt.Channel)
+	binary.BigEndian.PutUint16(buf[2:], uint16(len(pkt.Payload)))
+	copy(buf[4:], pkt.Payload)
+	return buf
+}
+
+// marshalIPPacket builds a synthetic IP packet that contains the packet.
+// seq and ack are used only in TCP headers.
+func marshalIPPacket(pkt *Packet, seq uint32, ack uint32) []byte {
+	var transport []byte
+	var proto byte
+
+	if pkt.Protocol == ProtocolTCP {
+		data := tcpPayload(pkt)
+		transport = make([]byte, tcpHeaderSize+len(data))
+		binary.BigEndian.PutUint16(transport[0:], uint16(pkt.SrcPort))
+		binary.BigEndian.PutUint16(transport[2:], uint16(pkt.DstPort))
+		binary.BigEndian.PutUint32(transport[4:], seq)
+		binary.BigEndian.PutUint32(transport[8:], ack)
+		transport[12] = (tcpHeaderSize / 4) << 4
+		transport[13] = 0x18 // PSH, ACK
+		binary.BigEndian.PutUint16(transport[14:], 0xFFFF)
+		copy(transport[tcpHeaderSize:], data)
+		proto = ipProtocolTCP
+	} else {
+		transport = make([]byte, udpHeaderSize+len(pkt.Payload))
+		binary.BigEndian.PutUint16(transport[0:], uint16(pkt.SrcPort))
+		binary.BigEndian.PutUint16(transport[2:], uint16(pkt.DstPort))
+		binary.BigEndian.PutUint16(transport[4:], uint16(len(transport)))
+		copy(transport[udpHeaderSize:], pkt.Payload)
+		proto = ipProtocolUDP
+	}
+
+	src4 := pkt.SrcIP.To4()
+	dst4 := pkt.DstIP.To4()
+
+	if src4 != nil && dst4 != nil {
+		buf := make([]byte, ipv4HeaderSize+len(transport))
+		buf[0] = 0x45
+		binary.BigEndian.PutUint16(buf[2:], uint16(len(buf)))
+		binary.BigEndian.PutUint16(buf[6:], 0x4000) // don't fragment
+		buf[8] = ipTTL
+		buf[9] = proto
+		copy(buf[12:], src4)
+		copy(buf[16:], dst4)
+		binary.BigEndian.PutUint16(buf[10:], ipChecksum(buf[:ipv4HeaderSize]))
+		copy(buf[ipv4HeaderSize:], transport)
+		return buf
+	}
+
+	buf := make([]byte, ipv6HeaderSize+len(transport))
+	buf[0] = 0x60
+	binary.BigEndian.PutUint16(buf[4:], uint16(len(transport)))
+	buf[6] = proto
+	buf[7] = ipTTL
+	copy(buf[8:], to16(pkt.SrcIP))
+	copy(buf[24:], to16(pkt.DstIP))
+	copy(buf[ipv6HeaderSize:], transport)
+	return buf
+}
+
+func to16(ip net.IP) net.IP {
+	if ip16 := ip.To16(); ip16 != nil {
+		return ip16
+	}
+	return net.IPv6unspecified
+}
+
+// ipPacket is a decoded IP packet.
+type ipPacket struct {
+	protocol Protocol
+	srcIP    net.IP
+	srcPort  int
+	dstIP    net.IP
+	dstPort  int
+	payload  []byte
+}
+
+func (p *ipPacket) unmarshal(buf []byte) error {
+	if len(buf) < 1 {
+		return fmt.Errorf("invalid IP packet")
+	}
+
+	var proto byte
+
+	switch buf[0] >> 4 {
+	case 4:
+		if len(buf) < ipv4HeaderSize {
+			return fmt.Errorf("invalid IPv4 packet")
+		}
+
+		headerLen := int(buf[0]&0x0F) * 4
+		totalLen := int(binary.BigEndian.Uint16(buf[2:]))
+		if headerLen < ipv4HeaderSize || totalLen < headerLen || totalLen > len(buf) {
+			return fmt.Errorf("invalid IPv4 packet")
+		}
+
+		if binary.BigEndian.Uint16(buf[6:])&0x3FFF != 0 {
+			return fmt.Errorf("fragmented IPv4 packets are not supported")
+		}
+
+		proto = buf[9]
+		p.srcIP = net.IP(append([]byte(nil), buf[12:16]...))
+		p.dstIP = net.IP(append([]byte(nil), buf[16:20]...))
+		buf = buf[headerLen:totalLen]
+
+	case 6:
+		if len(buf) < ipv6HeaderSize {
+			return fmt.Errorf("invalid IPv6 packet")
+		}
+
+		payloadLen := int(binary.BigEndian.Uint16(buf[4:]))
+		if (ipv6HeaderSize + payloadLen) > len(buf) {
+			return fmt.Errorf("invalid IPv6 packet")
+		}
+
+		proto = buf[6]
+		p.srcIP = net.IP(append([]byte(nil), buf[8:24]...))
+		p.dstIP = net.IP(append([]byte(nil), buf[24:40]...))
+		buf = buf[ipv6HeaderSize : ipv6HeaderSize+payloadLen]
+
+	default:
+		return fmt.Errorf("unsupported IP version: %d", buf[0]>>4)
+	}
+
+	switch proto {
+	case ipProtocolTCP:
+		if len(buf) < tcpHeaderSize {
+			return fmt.Errorf("invalid TCP segment")
+		}
+
+		headerLen := int(buf[12]>>4) * 4
+		if headerLen < tcpHeaderSize || headerLen > len(buf) {
+			return fmt.Errorf("invalid TCP segment")
+		}
+
+		p.protocol = ProtocolTCP
+		p.srcPort = int(binary.BigEndian.Uint16(buf[0:]))
+		p.dstPort = int(binary.BigEndian.Uint16(buf[2:]))
+		p.payload = buf[headerLen:]
+
+	case ipProtocolUDP:
+		if len(buf) < udpHeaderSize {
+			return fmt.Errorf("invalid UDP datagram")
+		}
+
+		l := int(binary.BigEndian.Uint16(buf[4:]))
+		if l < udpHeaderSize || l > len(buf) {
+			return fmt.Errorf("invalid UDP datagram")
+		}
+
+		p.protocol = ProtocolUDP
+		p.srcPort = int(binary.BigEndian.Uint16(buf[0:]))
+		p.dstPort = int(binary.BigEndian.Uint16(buf[2:]))
+		p.payload = buf[udpHeaderSize:l]
+
+	default:
+		return fmt.Errorf("unsupported IP protocol: %d", proto)
+	}
+
+	return nil
+}
+
+// splitTCPPayload splits the bytes of a TCP segment into packets.
+// Segments must contain whole RTSP messages or whole interleaved frames.
+func splitTCPPayload(ip *ipPacket) ([]*Packet, error) {
+	newPacket := func() *Packet {
+		return &Packet{
+			Protocol: ProtocolTCP,
+			SrcIP:    ip.srcIP,
+			SrcPort:  ip.srcPort,
+			DstIP:    ip.dstIP,
+			DstPort:  ip.dstPort,
+		}
+	}
+
+	buf := ip.payload
+
+	if len(buf) == 0 {
+		return nil, nil
+	}
+
+	if buf[0] != '$' {
+		pkt := newPacket()
+		pkt.Content = ContentRTSP
+		pkt.Payload = append([]byte(nil), buf...)
+		return []*Packet{pkt}, nil
+	}
+
+	var ret []*Packet
+
+	for len(buf) > 0 {
+		if len(buf) < 4 || buf[0] != '$' {
+			return nil, fmt.Errorf("invalid interleaved frame")
+		}
+
+		l := int(binary.BigEndian.Uint16(buf[2:]))
+		if len(buf[4:]) < l {
+			return nil, fmt.Errorf("invalid interleaved frame")
+		}
+
+		pkt := newPacket()
+		pkt.Channel = int(buf[1])
+		if (pkt.Channel % 2) == 0 {
+			pkt.Content = ContentRTP
+		} else {
+			pkt.Content = ContentRTCP
+		}
+		pkt.Payload = append([]byte(nil), buf[4:4+l]...)
+		ret = append(ret, pkt)
+
+		buf = buf[4+l:]
+	}
+
+	return ret, nil
+}
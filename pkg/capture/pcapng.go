@@ -0,0 +1,412 @@
+package capture
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// pcapng block types.
+const (
+	pcapngBlockSectionHeader        = 0x0A0D0D0A
+	pcapngBlockInterfaceDescription = 0x00000001
+	pcapngBlockEnhancedPacket       = 0x00000006
+)
+
+const (
+	pcapngByteOrderMagic = 0x1A2B3C4D
+	pcapngOptionTSResol  = 9
+	pcapngMaxBlockSize   = 16 * 1024 * 1024
+)
+
+// link types.
+// Specification: https://www.tcpdump.org/linktypes.html
+const (
+	linkTypeEthernet = 1
+	linkTypeRaw      = 101
+	linkTypeLinuxSLL = 113
+	linkTypeIPv4     = 228
+	linkTypeIPv6     = 229
+)
+
+func pcapngPad(l int) int {
+	return (4 - l%4) % 4
+}
+
+func flowKey(srcIP net.IP, srcPort int, dstIP net.IP, dstPort int) string {
+	return net.JoinHostPort(srcIP.String(), strconv.FormatInt(int64(srcPort), 10)) + ">" +
+		net.JoinHostPort(dstIP.String(), strconv.FormatInt(int64(dstPort), 10))
+}
+
+// PcapngWriter writes a capture in the pcapng format.
+// Packets are wrapped into synthetic IP, UDP and TCP headers,
+// therefore the capture can be inspected with tools like Wireshark.
+// Specification: https://datatracker.ietf.org/doc/html/draft-ietf-opsawg-pcapng
+type PcapngWriter struct {
+	w io.Writer
+
+	mutex         sync.Mutex
+	headerWritten bool
+	tcpSeqs       map[string]uint32
+}
+
+// NewPcapngWriter allocates a PcapngWriter.
+func NewPcapngWriter(w io.Writer) *PcapngWriter {
+	return &PcapngWriter{
+		w:       w,
+		tcpSeqs: make(map[string]uint32),
+	}
+}
+
+func (w *PcapngWriter) writeHeader() error {
+	// section header block
+	buf := make([]byte, 28)
+	binary.LittleEndian.PutUint32(buf[0:], pcapngBlockSectionHeader)
+	binary.LittleEndian.PutUint32(buf[4:], 28)
+	binary.LittleEndian.PutUint32(buf[8:], pcapngByteOrderMagic)
+	binary.LittleEndian.PutUint16(buf[12:], 1) // major version
+	binary.LittleEndian.PutUint16(buf[14:], 0) // minor version
+	binary.LittleEndian.PutUint64(buf[16:], math.MaxUint64)
+	binary.LittleEndian.PutUint32(buf[24:], 28)
+
+	// interface description block, with nanosecond resolution
+	buf2 := make([]byte, 32)
+	binary.LittleEndian.PutUint32(buf2[0:], pcapngBlockInterfaceDescription)
+	binary.LittleEndian.PutUint32(buf2[4:], 32)
+	binary.LittleEndian.PutUint16(buf2[8:], linkTypeRaw)
+	binary.LittleEndian.PutUint32(buf2[12:], 0) // snap length
+	binary.LittleEndian.PutUint16(buf2[16:], pcapngOptionTSResol)
+	binary.LittleEndian.PutUint16(buf2[18:], 1)
+	buf2[20] = 9
+	binary.LittleEndian.PutUint32(buf2[28:], 32)
+
+	_, err := w.w.Write(append(buf, buf2...))
+	return err
+}
+
+// WritePacket implements Writer.
+func (w *PcapngWriter) WritePacket(pkt *Packet) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if !w.headerWritten {
+		err := w.writeHeader()
+		if err != nil {
+			return err
+		}
+		w.headerWritten = true
+	}
+
+	var seq uint32
+	var ack uint32
+
+	if pkt.Protocol == ProtocolTCP {
+		key := flowKey(pkt.SrcIP, pkt.SrcPort, pkt.DstIP, pkt.DstPort)
+		seq = w.tcpSeqs[key]
+		ack = w.tcpSeqs[flowKey(pkt.DstIP, pkt.DstPort, pkt.SrcIP, pkt.SrcPort)]
+		w.tcpSeqs[key] = seq + uint32(len(tcpPayload(pkt)))
+	}
+
+	data := marshalIPPacket(pkt, seq, ack)
+	blockLen := 32 + len(data) + pcapngPad(len(data))
+	ts := uint64(pkt.Time.UnixNano())
+
+	buf := make([]byte, blockLen)
+	binary.LittleEndian.PutUint32(buf[0:], pcapngBlockEnhancedPacket)
+	binary.LittleEndian.PutUint32(buf[4:], uint32(blockLen))
+	binary.LittleEndian.PutUint32(buf[8:], 0) // interface ID
+	binary.LittleEndian.PutUint32(buf[12:], uint32(ts>>32))
+	binary.LittleEndian.PutUint32(buf[16:], uint32(ts))
+	binary.LittleEndian.PutUint32(buf[20:], uint32(len(data)))
+	binary.LittleEndian.PutUint32(buf[24:], uint32(len(data)))
+	copy(buf[28:], data)
+	binary.LittleEndian.PutUint32(buf[blockLen-4:], uint32(blockLen))
+
+	_, err := w.w.Write(buf)
+	return err
+}
+
+type pcapngInterface struct {
+	linkType uint16
+	tsResol  byte
+}
+
+// timestamp converts a timestamp expressed in the resolution of the interface.
+func (i pcapngInterface) timestamp(v uint64) time.Time {
+	if (i.tsResol & 0x80) != 0 {
+		exp := i.tsResol & 0x7F
+		secs := v >> exp
+		frac := v & ((1 << exp) - 1)
+		return time.Unix(int64(secs), int64(float64(frac)*1e9/math.Pow(2, float64(exp))))
+	}
+
+	div := uint64(math.Pow10(int(i.tsResol)))
+	secs := v / div
+	frac := v % div
+	return time.Unix(int64(secs), int64(float64(frac)*1e9/float64(div)))
+}
+
+// PcapngReader reads a capture in the pcapng format.
+// Supported link types are raw IP, Ethernet and Linux cooked captures.
+// TCP segments must contain whole RTSP messages or whole interleaved frames,
+// like the ones produced by PcapngWriter.
+// Packets that are not IP, TCP or UDP are skipped.
+type PcapngReader struct {
+	r          io.Reader
+	order      binary.ByteOrder
+	interfaces []pcapngInterface
+	queue      []*Packet
+}
+
+// NewPcapngReader allocates a PcapngReader.
+func NewPcapngReader(r io.Reader) (*PcapngReader, error) {
+	pr := &PcapngReader{
+		r: r,
+	}
+
+	typ, body, err := pr.readBlock()
+	if err != nil {
+		return nil, err
+	}
+
+	if typ != pcapngBlockSectionHeader {
+		return nil, fmt.Errorf("section header block not found")
+	}
+
+	if pr.order.Uint16(body[4:]) != 1 {
+		return nil, fmt.Errorf("unsupported pcapng version")
+	}
+
+	return pr, nil
+}
+
+func (pr *PcapngReader) readBlock() (uint32, []byte, error) {
+	var header [8]byte
+	_, err := io.ReadFull(pr.r, header[:])
+	if err != nil {
+		return 0, nil, err
+	}
+
+	// the byte order of the section header block type is irrelevant,
+	// since the type is palindromic.
+	if binary.LittleEndian.Uint32(header[:]) == pcapngBlockSectionHeader {
+		var magic [4]byte
+		_, err := io.ReadFull(pr.r, magic[:])
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch {
+		case binary.LittleEndian.Uint32(magic[:]) == pcapngByteOrderMagic:
+			pr.order = binary.LittleEndian
+		case binary.BigEndian.Uint32(magic[:]) == pcapngByteOrderMagic:
+			pr.order = binary.BigEndian
+		default:
+			return 0, nil, fmt.Errorf("invalid byte order magic")
+		}
+
+		pr.interfaces = nil
+
+		l := pr.order.Uint32(header[4:])
+		if l < 28 || l > pcapngMaxBlockSize {
+			return 0, nil, fmt.Errorf("invalid block length: %d", l)
+		}
+
+		body := make([]byte, l-8)
+		copy(body, magic[:])
+		_, err = io.ReadFull(pr.r, body[4:])
+		if err != nil {
+			return 0, nil, err
+		}
+
+		return pcapngBlockSectionHeader, body, nil
+	}
+
+	if pr.order == nil {
+		return 0, nil, fmt.Errorf("section header block not found")
+	}
+
+	l := pr.order.Uint32(header[4:])
+	if l < 12 || (l%4) != 0 || l > pcapngMaxBlockSize {
+		return 0, nil, fmt.Errorf("invalid block length: %d", l)
+	}
+
+	body := make([]byte, l-8)
+	_, err = io.ReadFull(pr.r, body)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return pr.order.Uint32(header[:]), body, nil
+}
+
+func (pr *PcapngReader) readInterface(body []byte) error {
+	if len(body) < 12 {
+		return fmt.Errorf("invalid interface description block")
+	}
+
+	intf := pcapngInterface{
+		linkType: pr.order.Uint16(body[0:]),
+		tsResol:  6,
+	}
+
+	opts := body[8 : len(body)-4]
+	for len(opts) >= 4 {
+		code := pr.order.Uint16(opts[0:])
+		l := int(pr.order.Uint16(opts[2:]))
+		opts = opts[4:]
+
+		if code == 0 || len(opts) < l {
+			break
+		}
+
+		if code == pcapngOptionTSResol && l >= 1 {
+			intf.tsResol = opts[0]
+		}
+
+		l += pcapngPad(l)
+		if l > len(opts) {
+			break
+		}
+		opts = opts[l:]
+	}
+
+	pr.interfaces = append(pr.interfaces, intf)
+	return nil
+}
+
+// linkPayload returns the IP packet contained into a frame.
+func linkPayload(linkType uint16, buf []byte) ([]byte, bool) {
+	switch linkType {
+	case linkTypeRaw, linkTypeIPv4, linkTypeIPv6:
+		return buf, true
+
+	case linkTypeEthernet:
+		if len(buf) < 14 {
+			return nil, false
+		}
+		etherType := binary.BigEndian.Uint16(buf[12:])
+		buf = buf[14:]
+
+		// VLAN tag
+		if etherType == 0x8100 {
+			if len(buf) < 4 {
+				return nil, false
+			}
+			etherType = binary.BigEndian.Uint16(buf[2:])
+			buf = buf[4:]
+		}
+
+		if etherType != 0x0800 && etherType != 0x86DD {
+			return nil, false
+		}
+		return buf, true
+
+	case linkTypeLinuxSLL:
+		if len(buf) < 16 {
+			return nil, false
+		}
+		etherType := binary.BigEndian.Uint16(buf[14:])
+		if etherType != 0x0800 && etherType != 0x86DD {
+			return nil, false
+		}
+		return buf[16:], true
+	}
+
+	return nil, false
+}
+
+func (pr *PcapngReader) decodePacket(body []byte) ([]*Packet, error) {
+	if len(body) < 24 {
+		return nil, fmt.Errorf("invalid enhanced packet block")
+	}
+
+	id := int(pr.order.Uint32(body[0:]))
+	if id >= len(pr.interfaces) {
+		return nil, fmt.Errorf("invalid interface ID: %d", id)
+	}
+	intf := pr.interfaces[id]
+
+	ts := intf.timestamp(uint64(pr.order.Uint32(body[4:]))<<32 | uint64(pr.order.Uint32(body[8:])))
+
+	capLen := int(pr.order.Uint32(body[12:]))
+	if capLen > len(body)-24 {
+		return nil, fmt.Errorf("invalid enhanced packet block")
+	}
+
+	buf, ok := linkPayload(intf.linkType, body[20:20+capLen])
+	if !ok {
+		return nil, nil
+	}
+
+	// packets that can't be decoded are skipped
+	var ip ipPacket
+	err := ip.unmarshal(buf)
+	if err != nil {
+		return nil, nil
+	}
+
+	var pkts []*Packet
+
+	if ip.protocol == ProtocolTCP {
+		pkts, err = splitTCPPayload(&ip)
+		if err != nil {
+			return nil, nil
+		}
+	} else {
+		pkt := &Packet{
+			Protocol: ProtocolUDP,
+			SrcIP:    ip.srcIP,
+			SrcPort:  ip.srcPort,
+			DstIP:    ip.dstIP,
+			DstPort:  ip.dstPort,
+			Payload:  append([]byte(nil), ip.payload...),
+		}
+		if isRTCP(pkt.Payload) {
+			pkt.Content = ContentRTCP
+		} else {
+			pkt.Content = ContentRTP
+		}
+		pkts = []*Packet{pkt}
+	}
+
+	for _, pkt := range pkts {
+		pkt.Time = ts
+	}
+
+	return pkts, nil
+}
+
+// ReadPacket implements Reader.
+func (pr *PcapngReader) ReadPacket() (*Packet, error) {
+	for len(pr.queue) == 0 {
+		typ, body, err := pr.readBlock()
+		if err != nil {
+			return nil, err
+		}
+
+		switch typ {
+		case pcapngBlockInterfaceDescription:
+			err := pr.readInterface(body)
+			if err != nil {
+				return nil, err
+			}
+
+		case pcapngBlockEnhancedPacket:
+			pkts, err := pr.decodePacket(body)
+			if err != nil {
+				return nil, err
+			}
+			pr.queue = pkts
+		}
+	}
+
+	pkt := pr.queue[0]
+	pr.queue = pr.queue[1:]
+	return pkt, nil
+}
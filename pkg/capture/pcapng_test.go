@@ -0,0 +1,147 @@
+package capture
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var testPackets = []*Packet{
+	{
+		Time:     time.Date(2023, 4, 5, 10, 0, 0, 123456789, time.UTC),
+		Protocol: ProtocolTCP,
+		SrcIP:    net.ParseIP("192.168.1.2").To4(),
+		SrcPort:  34567,
+		DstIP:    net.ParseIP("192.168.1.3").To4(),
+		DstPort:  554,
+		Content:  ContentRTSP,
+		Payload:  []byte("OPTIONS rtsp://192.168.1.3/stream RTSP/1.0\r\nCSeq: 1\r\n\r\n"),
+	},
+	{
+		Time:     time.Date(2023, 4, 5, 10, 0, 1, 0, time.UTC),
+		Protocol: ProtocolTCP,
+		SrcIP:    net.ParseIP("192.168.1.3").To4(),
+		SrcPort:  554,
+		DstIP:    net.ParseIP("192.168.1.2").To4(),
+		DstPort:  34567,
+		Content:  ContentRTP,
+		Channel:  2,
+		Payload:  []byte{0x80, 0x60, 0x00, 0x01, 0x01, 0x02, 0x03, 0x04, 0x05},
+	},
+	{
+		Time:     time.Date(2023, 4, 5, 10, 0, 2, 0, time.UTC),
+		Protocol: ProtocolTCP,
+		SrcIP:    net.ParseIP("192.168.1.3").To4(),
+		SrcPort:  554,
+		DstIP:    net.ParseIP("192.168.1.2").To4(),
+		DstPort:  34567,
+		Content:  ContentRTCP,
+		Channel:  3,
+		Payload:  []byte{0x80, 0xc8, 0x00, 0x06, 0x01, 0x02, 0x03, 0x04},
+	},
+	{
+		Time:     time.Date(2023, 4, 5, 10, 0, 3, 0, time.UTC),
+		Protocol: ProtocolUDP,
+		SrcIP:    net.ParseIP("fd00::1"),
+		SrcPort:  8000,
+		DstIP:    net.ParseIP("fd00::2"),
+		DstPort:  35466,
+		Content:  ContentRTP,
+		Payload:  []byte{0x80, 0x60, 0x00, 0x02, 0x01, 0x02, 0x03, 0x04},
+	},
+	{
+		Time:     time.Date(2023, 4, 5, 10, 0, 4, 0, time.UTC),
+		Protocol: ProtocolUDP,
+		SrcIP:    net.ParseIP("fd00::2"),
+		SrcPort:  35467,
+		DstIP:    net.ParseIP("fd00::1"),
+		DstPort:  8001,
+		Content:  ContentRTCP,
+		Payload:  []byte{0x80, 0xc9, 0x00, 0x01, 0x01, 0x02, 0x03, 0x04},
+	},
+}
+
+func TestPcapng(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewPcapngWriter(&buf)
+
+	for _, pkt := range testPackets {
+		err := w.WritePacket(pkt)
+		require.NoError(t, err)
+	}
+
+	r, err := NewPcapngReader(&buf)
+	require.NoError(t, err)
+
+	for _, pkt := range testPackets {
+		recv, err := r.ReadPacket()
+		require.NoError(t, err)
+		require.True(t, pkt.Time.Equal(recv.Time))
+		recv.Time = pkt.Time
+		require.Equal(t, pkt, recv)
+	}
+
+	_, err = r.ReadPacket()
+	require.Equal(t, io.EOF, err)
+}
+
+func TestPcapngReaderEthernet(t *testing.T) {
+	// big endian section with microsecond resolution and a Ethernet interface
+	byts := []byte{
+		0x0a, 0x0d, 0x0d, 0x0a, 0x00, 0x00, 0x00, 0x1c,
+		0x1a, 0x2b, 0x3c, 0x4d, 0x00, 0x01, 0x00, 0x00,
+		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+		0x00, 0x00, 0x00, 0x1c,
+
+		0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x14,
+		0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x14,
+	}
+
+	frame := []byte{
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x01,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x02,
+		0x08, 0x00,
+	}
+	frame = append(frame, marshalIPPacket(&Packet{
+		Protocol: ProtocolUDP,
+		SrcIP:    net.ParseIP("10.0.0.1"),
+		SrcPort:  5000,
+		DstIP:    net.ParseIP("10.0.0.2"),
+		DstPort:  5002,
+		Payload:  []byte{0x80, 0x60, 0x00, 0x02},
+	}, 0, 0)...)
+
+	epb := []byte{
+		0x00, 0x00, 0x00, 0x06, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x0f, 0x42, 0x41, // 1000001 us
+		0x00, 0x00, 0x00, byte(len(frame)),
+		0x00, 0x00, 0x00, byte(len(frame)),
+	}
+	epb = append(epb, frame...)
+	epb = append(epb, make([]byte, pcapngPad(len(frame)))...)
+	epb = append(epb, 0, 0, 0, 0)
+	epb[7] = byte(len(epb))
+	epb[len(epb)-1] = byte(len(epb))
+
+	r, err := NewPcapngReader(bytes.NewReader(append(byts, epb...)))
+	require.NoError(t, err)
+
+	pkt, err := r.ReadPacket()
+	require.NoError(t, err)
+	require.Equal(t, &Packet{
+		Time:     time.Unix(1, 1000),
+		Protocol: ProtocolUDP,
+		SrcIP:    net.ParseIP("10.0.0.1").To4(),
+		SrcPort:  5000,
+		DstIP:    net.ParseIP("10.0.0.2").To4(),
+		DstPort:  5002,
+		Content:  ContentRTP,
+		Payload:  []byte{0x80, 0x60, 0x00, 0x02},
+	}, pkt)
+}
@@ -0,0 +1,515 @@
+package capture
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+
+	"github.com/bluenviron/gortsplib/v3/pkg/base"
+	"github.com/bluenviron/gortsplib/v3/pkg/formats"
+	"github.com/bluenviron/gortsplib/v3/pkg/headers"
+	"github.com/bluenviron/gortsplib/v3/pkg/media"
+	"github.com/bluenviron/gortsplib/v3/pkg/sdp"
+	"github.com/bluenviron/gortsplib/v3/pkg/url"
+)
+
+var responsePrefix = []byte("RTSP/")
+
+// replayerUDPMedia associates UDP ports with a media.
+type replayerUDPMedia struct {
+	media      *media.Media
+	clientRTP  int
+	clientRTCP int
+	serverRTP  int // zero if unknown
+	serverRTCP int // zero if unknown
+	multicast  bool
+}
+
+// match checks whether a packet belongs to the media,
+// and returns whether the packet has been sent by the client.
+func (m *replayerUDPMedia) match(pkt *Packet) (bool, bool) {
+	clientPort, serverPort := m.clientRTP, m.serverRTP
+	if pkt.Content == ContentRTCP {
+		clientPort, serverPort = m.clientRTCP, m.serverRTCP
+	}
+
+	// multicast packets are sent by the server only
+	if m.multicast {
+		return pkt.DstPort == clientPort, false
+	}
+
+	if pkt.SrcPort == clientPort && (serverPort == 0 || pkt.DstPort == serverPort) {
+		return true, true
+	}
+
+	if pkt.DstPort == clientPort && (serverPort == 0 || pkt.SrcPort == serverPort) {
+		return true, false
+	}
+
+	return false, false
+}
+
+// Replayer reads a capture and replays its RTP and RTCP packets
+// with the same pace they were captured, acting like a Client that is
+// reading a stream. This allows to reproduce issues offline.
+//
+// Medias are taken from the DESCRIBE response or the ANNOUNCE request
+// contained into the capture, and packets are associated with medias by using
+// SETUP requests and responses; only RTCP packets sent by the same side of the RTP packets
+// (the server when reading, the client when publishing) are replayed.
+// If Medias are provided, RTSP messages are ignored, RTP packets are associated with formats
+// by using their payload type and RTCP packets are associated with medias by using
+// the SSRC of sender reports. This is needed in case of rtpdump captures.
+//
+// A capture can be fed into a gortsplib.ServerStream by allocating the stream
+// with Medias and by writing into it packets received by OnPacketRTPAny.
+type Replayer struct {
+	//
+	// parameters (all optional except Reader)
+	//
+	// source of packets.
+	Reader Reader
+	// medias of the capture.
+	// It defaults to the medias contained into the capture, that are filled by Start().
+	Medias media.Medias
+	// replay packets as fast as possible, ignoring their original pace.
+	// This is useful in unit tests.
+	// It defaults to false.
+	DisablePacing bool
+
+	fromCapture   bool
+	ctx           context.Context
+	ctxCancel     func()
+	clientIP      net.IP
+	clientPort    int
+	baseURL       *url.URL
+	record        bool
+	requests      map[string]*base.Request
+	tcpChannels   map[int]*media.Media
+	udpMedias     []*replayerUDPMedia
+	ssrcs         map[uint32]*media.Media
+	onPacketRTPs  map[formats.Format]func(*rtp.Packet)
+	onPacketRTCPs map[*media.Media]func(rtcp.Packet)
+	startTime     time.Time
+	startWall     time.Time
+	started       bool
+	err           error
+
+	done chan struct{}
+}
+
+// Start initializes the Replayer.
+// If Medias is nil, the capture is read until medias are found.
+func (r *Replayer) Start() error {
+	if r.Reader == nil {
+		return fmt.Errorf("reader not provided")
+	}
+
+	r.requests = make(map[string]*base.Request)
+	r.tcpChannels = make(map[int]*media.Media)
+	r.ssrcs = make(map[uint32]*media.Media)
+	r.onPacketRTPs = make(map[formats.Format]func(*rtp.Packet))
+	r.onPacketRTCPs = make(map[*media.Media]func(rtcp.Packet))
+
+	if r.Medias == nil {
+		r.fromCapture = true
+
+		for r.Medias == nil {
+			pkt, err := r.Reader.ReadPacket()
+			if err != nil {
+				if err == io.EOF {
+					return fmt.Errorf("medias not found in the capture")
+				}
+				return err
+			}
+
+			if pkt.Content == ContentRTSP {
+				r.processRTSP(pkt)
+			}
+		}
+	}
+
+	r.ctx, r.ctxCancel = context.WithCancel(context.Background())
+	r.done = make(chan struct{})
+
+	return nil
+}
+
+// Close stops the replay and closes the Replayer.
+func (r *Replayer) Close() {
+	r.ctxCancel()
+	if r.started {
+		<-r.done
+	}
+}
+
+// Play starts replaying packets.
+// Callbacks must be set before calling Play.
+func (r *Replayer) Play() {
+	r.started = true
+	go r.run()
+}
+
+// Wait waits until the end of the capture is reached or an error occurs.
+// At the end of the capture, it returns nil.
+func (r *Replayer) Wait() error {
+	<-r.done
+	return r.err
+}
+
+// OnPacketRTPAny sets the callback that is called when a RTP packet of any media is replayed.
+func (r *Replayer) OnPacketRTPAny(cb func(*media.Media, formats.Format, *rtp.Packet)) {
+	for _, medi := range r.Medias {
+		cmedia := medi
+		for _, forma := range medi.Formats {
+			cforma := forma
+			r.OnPacketRTP(medi, forma, func(pkt *rtp.Packet) {
+				cb(cmedia, cforma, pkt)
+			})
+		}
+	}
+}
+
+// OnPacketRTCPAny sets the callback that is called when a RTCP packet of any media is replayed.
+func (r *Replayer) OnPacketRTCPAny(cb func(*media.Media, rtcp.Packet)) {
+	for _, medi := range r.Medias {
+		cmedia := medi
+		r.OnPacketRTCP(medi, func(pkt rtcp.Packet) {
+			cb(cmedia, pkt)
+		})
+	}
+}
+
+// OnPacketRTP sets the callback that is called when a RTP packet is replayed.
+func (r *Replayer) OnPacketRTP(_ *media.Media, forma formats.Format, cb func(*rtp.Packet)) {
+	r.onPacketRTPs[forma] = cb
+}
+
+// OnPacketRTCP sets the callback that is called when a RTCP packet is replayed.
+func (r *Replayer) OnPacketRTCP(medi *media.Media, cb func(rtcp.Packet)) {
+	r.onPacketRTCPs[medi] = cb
+}
+
+func (r *Replayer) run() {
+	defer close(r.done)
+
+	for {
+		pkt, err := r.Reader.ReadPacket()
+		if err != nil {
+			if err != io.EOF {
+				r.err = err
+			}
+			return
+		}
+
+		if pkt.Content == ContentRTSP {
+			if r.fromCapture {
+				r.processRTSP(pkt)
+			}
+			continue
+		}
+
+		medi, ok := r.findMedia(pkt)
+		if !ok {
+			continue
+		}
+
+		if !r.wait(pkt.Time) {
+			r.err = fmt.Errorf("terminated")
+			return
+		}
+
+		if pkt.Content == ContentRTP {
+			r.processRTP(medi, pkt.Payload)
+		} else {
+			r.processRTCP(medi, pkt.Payload)
+		}
+	}
+}
+
+// wait waits until the time at which a packet must be replayed.
+func (r *Replayer) wait(t time.Time) bool {
+	if !r.startWall.IsZero() && !r.DisablePacing {
+		d := t.Sub(r.startTime) - time.Since(r.startWall)
+		if d > 0 {
+			timer := time.NewTimer(d)
+			defer timer.Stop()
+
+			select {
+			case <-timer.C:
+			case <-r.ctx.Done():
+				return false
+			}
+		}
+	} else {
+		r.startTime = t
+		r.startWall = time.Now()
+	}
+
+	select {
+	case <-r.ctx.Done():
+		return false
+	default:
+		return true
+	}
+}
+
+// findMedia finds the media of a RTP or RTCP packet.
+// RTCP packets sent by the receiving side are discarded.
+func (r *Replayer) findMedia(pkt *Packet) (*media.Media, bool) {
+	if !r.fromCapture {
+		if pkt.Content == ContentRTP {
+			var h rtp.Header
+			_, err := h.Unmarshal(pkt.Payload)
+			if err != nil {
+				return nil, false
+			}
+
+			for _, medi := range r.Medias {
+				for _, forma := range medi.Formats {
+					if forma.PayloadType() == h.PayloadType {
+						r.ssrcs[h.SSRC] = medi
+						return medi, true
+					}
+				}
+			}
+			return nil, false
+		}
+
+		pkts, err := rtcp.Unmarshal(pkt.Payload)
+		if err != nil {
+			return nil, false
+		}
+
+		if sr, ok := pkts[0].(*rtcp.SenderReport); ok {
+			medi, ok := r.ssrcs[sr.SSRC]
+			return medi, ok
+		}
+		return nil, false
+	}
+
+	var medi *media.Media
+	var fromClient bool
+
+	if pkt.Protocol == ProtocolTCP {
+		channel := pkt.Channel
+		if pkt.Content == ContentRTCP {
+			channel--
+		}
+
+		var ok bool
+		medi, ok = r.tcpChannels[channel]
+		if !ok {
+			return nil, false
+		}
+
+		fromClient = pkt.SrcIP.Equal(r.clientIP) && pkt.SrcPort == r.clientPort
+	} else {
+		for _, um := range r.udpMedias {
+			var ok bool
+			ok, fromClient = um.match(pkt)
+			if ok {
+				medi = um.media
+				break
+			}
+		}
+
+		if medi == nil {
+			return nil, false
+		}
+	}
+
+	if pkt.Content == ContentRTCP && fromClient != r.record {
+		return nil, false
+	}
+
+	return medi, true
+}
+
+func (r *Replayer) processRTP(medi *media.Media, payload []byte) {
+	var pkt rtp.Packet
+	err := pkt.Unmarshal(payload)
+	if err != nil {
+		return
+	}
+
+	for _, forma := range medi.Formats {
+		if forma.PayloadType() == pkt.PayloadType {
+			if cb, ok := r.onPacketRTPs[forma]; ok {
+				cb(&pkt)
+			}
+			return
+		}
+	}
+}
+
+func (r *Replayer) processRTCP(medi *media.Media, payload []byte) {
+	pkts, err := rtcp.Unmarshal(payload)
+	if err != nil {
+		return
+	}
+
+	cb, ok := r.onPacketRTCPs[medi]
+	if !ok {
+		return
+	}
+
+	for _, pkt := range pkts {
+		cb(pkt)
+	}
+}
+
+func (r *Replayer) processRTSP(pkt *Packet) {
+	br := bufio.NewReader(bytes.NewReader(pkt.Payload))
+
+	if bytes.HasPrefix(pkt.Payload, responsePrefix) {
+		var res base.Response
+		err := res.Unmarshal(br)
+		if err != nil {
+			return
+		}
+
+		// responses are sent to the client
+		if !pkt.DstIP.Equal(r.clientIP) || pkt.DstPort != r.clientPort {
+			return
+		}
+
+		cseq, ok := res.Header["CSeq"]
+		if !ok || len(cseq) != 1 {
+			return
+		}
+
+		req, ok := r.requests[cseq[0]]
+		if !ok {
+			return
+		}
+		delete(r.requests, cseq[0])
+
+		if res.StatusCode != base.StatusOK {
+			return
+		}
+
+		switch req.Method {
+		case base.Describe:
+			if r.Medias == nil {
+				r.processDescription(req, &res, res.Body)
+			}
+
+		case base.Setup:
+			r.processSetup(req, &res)
+		}
+		return
+	}
+
+	var req base.Request
+	err := req.Unmarshal(br)
+	if err != nil {
+		return
+	}
+
+	// the client is the side that sends the first request
+	if r.clientIP == nil {
+		r.clientIP = pkt.SrcIP
+		r.clientPort = pkt.SrcPort
+	} else if !pkt.SrcIP.Equal(r.clientIP) || pkt.SrcPort != r.clientPort {
+		return
+	}
+
+	if cseq, ok := req.Header["CSeq"]; ok && len(cseq) == 1 {
+		r.requests[cseq[0]] = &req
+	}
+
+	if req.Method == base.Announce && r.Medias == nil {
+		r.record = true
+		r.processDescription(&req, nil, req.Body)
+	}
+}
+
+func (r *Replayer) processDescription(req *base.Request, res *base.Response, body []byte) {
+	var sd sdp.SessionDescription
+	err := sd.Unmarshal(body)
+	if err != nil {
+		return
+	}
+
+	var medias media.Medias
+	err = medias.Unmarshal(sd.MediaDescriptions)
+	if err != nil {
+		return
+	}
+
+	r.baseURL = req.URL
+
+	if control, ok := sd.Attribute("control"); ok && control != "*" {
+		if u, err := url.Parse(control); err == nil {
+			r.baseURL = u
+		}
+	} else if res != nil {
+		if cb, ok := res.Header["Content-Base"]; ok && len(cb) == 1 {
+			if u, err := url.Parse(cb[0]); err == nil {
+				r.baseURL = u
+			}
+		}
+	}
+
+	r.Medias = medias
+}
+
+func (r *Replayer) processSetup(req *base.Request, res *base.Response) {
+	var medi *media.Media
+	for _, m := range r.Medias {
+		u, err := m.URL(r.baseURL)
+		if err == nil && (u.String() == req.URL.String() || u.Path == req.URL.Path) {
+			medi = m
+			break
+		}
+	}
+
+	if medi == nil {
+		return
+	}
+
+	var th headers.Transport
+	err := th.Unmarshal(res.Header["Transport"])
+	if err != nil {
+		return
+	}
+
+	if th.Mode != nil && *th.Mode == headers.TransportModeRecord {
+		r.record = true
+	}
+
+	switch {
+	case th.InterleavedIDs != nil:
+		r.tcpChannels[th.InterleavedIDs[0]] = medi
+
+	case th.Delivery != nil && *th.Delivery == headers.TransportDeliveryMulticast:
+		if th.Ports != nil {
+			r.udpMedias = append(r.udpMedias, &replayerUDPMedia{
+				media:      medi,
+				clientRTP:  th.Ports[0],
+				clientRTCP: th.Ports[1],
+				multicast:  true,
+			})
+		}
+
+	case th.ClientPorts != nil:
+		um := &replayerUDPMedia{
+			media:      medi,
+			clientRTP:  th.ClientPorts[0],
+			clientRTCP: th.ClientPorts[1],
+		}
+		if th.ServerPorts != nil {
+			um.serverRTP = th.ServerPorts[0]
+			um.serverRTCP = th.ServerPorts[1]
+		}
+		r.udpMedias = append(r.udpMedias, um)
+	}
+}
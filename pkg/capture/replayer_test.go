@@ -0,0 +1,305 @@
+package capture
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/gortsplib/v3/pkg/base"
+	"github.com/bluenviron/gortsplib/v3/pkg/formats"
+	"github.com/bluenviron/gortsplib/v3/pkg/headers"
+	"github.com/bluenviron/gortsplib/v3/pkg/media"
+	"github.com/bluenviron/gortsplib/v3/pkg/url"
+)
+
+func mustParseURL(s string) *url.URL {
+	u, err := url.Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+func mustMarshal(v interface{ Marshal() ([]byte, error) }) []byte {
+	byts, err := v.Marshal()
+	if err != nil {
+		panic(err)
+	}
+	return byts
+}
+
+var (
+	clientIP = net.ParseIP("192.168.1.2").To4()
+	serverIP = net.ParseIP("192.168.1.3").To4()
+)
+
+type testCapture struct {
+	w     *PcapngWriter
+	start time.Time
+}
+
+func (c *testCapture) write(t *testing.T, offset time.Duration, fromClient bool, pkt *Packet) {
+	pkt.Time = c.start.Add(offset)
+
+	if pkt.Protocol == ProtocolTCP {
+		pkt.SrcPort, pkt.DstPort = 554, 34567
+		if fromClient {
+			pkt.SrcPort, pkt.DstPort = pkt.DstPort, pkt.SrcPort
+		}
+	}
+
+	pkt.SrcIP, pkt.DstIP = serverIP, clientIP
+	if fromClient {
+		pkt.SrcIP, pkt.DstIP = pkt.DstIP, pkt.SrcIP
+	}
+
+	err := c.w.WritePacket(pkt)
+	require.NoError(t, err)
+}
+
+func (c *testCapture) writeRTSP(t *testing.T, fromClient bool, msg interface{ Marshal() ([]byte, error) }) {
+	c.write(t, 0, fromClient, &Packet{
+		Protocol: ProtocolTCP,
+		Content:  ContentRTSP,
+		Payload:  mustMarshal(msg),
+	})
+}
+
+func TestReplayer(t *testing.T) {
+	medias := media.Medias{
+		{
+			Type:    media.TypeVideo,
+			Control: "trackID=0",
+			Formats: []formats.Format{&formats.H264{
+				PayloadTyp:        96,
+				PacketizationMode: 1,
+			}},
+		},
+		{
+			Type:    media.TypeAudio,
+			Control: "trackID=1",
+			Formats: []formats.Format{&formats.G711{MULaw: true}},
+		},
+	}
+
+	var buf bytes.Buffer
+	c := &testCapture{
+		w:     NewPcapngWriter(&buf),
+		start: time.Date(2023, 4, 5, 10, 0, 0, 0, time.UTC),
+	}
+
+	c.writeRTSP(t, true, &base.Request{
+		Method: base.Describe,
+		URL:    mustParseURL("rtsp://192.168.1.3/stream"),
+		Header: base.Header{"CSeq": base.HeaderValue{"1"}},
+	})
+	c.writeRTSP(t, false, &base.Response{
+		StatusCode: base.StatusOK,
+		Header: base.Header{
+			"CSeq":         base.HeaderValue{"1"},
+			"Content-Base": base.HeaderValue{"rtsp://192.168.1.3/stream/"},
+			"Content-Type": base.HeaderValue{"application/sdp"},
+		},
+		Body: mustMarshal(medias.Marshal(false)),
+	})
+
+	c.writeRTSP(t, true, &base.Request{
+		Method: base.Setup,
+		URL:    mustParseURL("rtsp://192.168.1.3/stream/trackID=0"),
+		Header: base.Header{"CSeq": base.HeaderValue{"2"}},
+	})
+	c.writeRTSP(t, false, &base.Response{
+		StatusCode: base.StatusOK,
+		Header: base.Header{
+			"CSeq": base.HeaderValue{"2"},
+			"Transport": headers.Transport{
+				Protocol:       headers.TransportProtocolTCP,
+				InterleavedIDs: &[2]int{4, 5},
+			}.Marshal(),
+		},
+	})
+
+	c.writeRTSP(t, true, &base.Request{
+		Method: base.Setup,
+		URL:    mustParseURL("rtsp://192.168.1.3/stream/trackID=1"),
+		Header: base.Header{"CSeq": base.HeaderValue{"3"}},
+	})
+	c.writeRTSP(t, false, &base.Response{
+		StatusCode: base.StatusOK,
+		Header: base.Header{
+			"CSeq": base.HeaderValue{"3"},
+			"Transport": headers.Transport{
+				Protocol:    headers.TransportProtocolUDP,
+				ClientPorts: &[2]int{35466, 35467},
+				ServerPorts: &[2]int{8000, 8001},
+			}.Marshal(),
+		},
+	})
+
+	videoPkt := &rtp.Packet{
+		Header: rtp.Header{
+			Version:        2,
+			PayloadType:    96,
+			SequenceNumber: 1,
+			SSRC:           1234,
+			CSRC:           []uint32{},
+		},
+		Payload: []byte{0x05, 0x01},
+	}
+
+	audioPkt := &rtp.Packet{
+		Header: rtp.Header{
+			Version:        2,
+			PayloadType:    0,
+			SequenceNumber: 1,
+			SSRC:           5678,
+			CSRC:           []uint32{},
+		},
+		Payload: []byte{0x01, 0x02},
+	}
+
+	sr := &rtcp.SenderReport{SSRC: 5678}
+	rr := &rtcp.ReceiverReport{SSRC: 4321}
+
+	c.write(t, 0, false, &Packet{
+		Protocol: ProtocolTCP,
+		Content:  ContentRTP,
+		Channel:  4,
+		Payload:  mustMarshal(videoPkt),
+	})
+
+	c.write(t, 100*time.Millisecond, false, &Packet{
+		Protocol: ProtocolUDP,
+		SrcPort:  8000,
+		DstPort:  35466,
+		Content:  ContentRTP,
+		Payload:  mustMarshal(audioPkt),
+	})
+
+	c.write(t, 100*time.Millisecond, false, &Packet{
+		Protocol: ProtocolUDP,
+		SrcPort:  8001,
+		DstPort:  35467,
+		Content:  ContentRTCP,
+		Payload:  mustMarshal(sr),
+	})
+
+	// receiver reports of the client are not replayed
+	c.write(t, 100*time.Millisecond, true, &Packet{
+		Protocol: ProtocolUDP,
+		SrcPort:  35467,
+		DstPort:  8001,
+		Content:  ContentRTCP,
+		Payload:  mustMarshal(rr),
+	})
+
+	// packets of other ports are not replayed
+	c.write(t, 100*time.Millisecond, false, &Packet{
+		Protocol: ProtocolUDP,
+		SrcPort:  8000,
+		DstPort:  40000,
+		Content:  ContentRTP,
+		Payload:  mustMarshal(audioPkt),
+	})
+
+	r, err := NewPcapngReader(&buf)
+	require.NoError(t, err)
+
+	rp := &Replayer{Reader: r}
+	err = rp.Start()
+	require.NoError(t, err)
+	defer rp.Close()
+
+	require.Equal(t, 2, len(rp.Medias))
+	require.Equal(t, media.TypeVideo, rp.Medias[0].Type)
+
+	var recvRTP []*rtp.Packet
+	var recvRTCP []rtcp.Packet
+
+	rp.OnPacketRTPAny(func(medi *media.Media, forma formats.Format, pkt *rtp.Packet) {
+		recvRTP = append(recvRTP, pkt)
+	})
+
+	rp.OnPacketRTCP(rp.Medias[1], func(pkt rtcp.Packet) {
+		recvRTCP = append(recvRTCP, pkt)
+	})
+
+	start := time.Now()
+	rp.Play()
+
+	err = rp.Wait()
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+
+	require.Equal(t, []*rtp.Packet{videoPkt, audioPkt}, recvRTP)
+	require.Equal(t, []rtcp.Packet{sr}, recvRTCP)
+}
+
+func TestReplayerRTPDump(t *testing.T) {
+	forma := &formats.G711{MULaw: true}
+	medi := &media.Media{
+		Type:    media.TypeAudio,
+		Formats: []formats.Format{forma},
+	}
+
+	var buf bytes.Buffer
+	w := NewRTPDumpWriter(&buf)
+	start := time.Date(2023, 4, 5, 10, 0, 0, 0, time.UTC)
+
+	var pkts []*rtp.Packet
+
+	for i := 0; i < 3; i++ {
+		pkt := &rtp.Packet{
+			Header: rtp.Header{
+				Version:        2,
+				PayloadType:    0,
+				SequenceNumber: uint16(i),
+				SSRC:           5678,
+				CSRC:           []uint32{},
+			},
+			Payload: []byte{byte(i)},
+		}
+		pkts = append(pkts, pkt)
+
+		err := w.WritePacket(&Packet{
+			Time:     start.Add(time.Duration(i) * time.Second),
+			Protocol: ProtocolUDP,
+			SrcIP:    serverIP,
+			DstIP:    clientIP,
+			Content:  ContentRTP,
+			Payload:  mustMarshal(pkt),
+		})
+		require.NoError(t, err)
+	}
+
+	r, err := NewRTPDumpReader(&buf)
+	require.NoError(t, err)
+
+	rp := &Replayer{
+		Reader:        r,
+		Medias:        media.Medias{medi},
+		DisablePacing: true,
+	}
+	err = rp.Start()
+	require.NoError(t, err)
+	defer rp.Close()
+
+	var recv []*rtp.Packet
+
+	rp.OnPacketRTP(medi, forma, func(pkt *rtp.Packet) {
+		recv = append(recv, pkt)
+	})
+
+	begin := time.Now()
+	rp.Play()
+
+	err = rp.Wait()
+	require.NoError(t, err)
+	require.Less(t, time.Since(begin), 1*time.Second)
+	require.Equal(t, pkts, recv)
+}
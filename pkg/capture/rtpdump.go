@@ -0,0 +1,200 @@
+package capture
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	rtpdumpPrefix       = "#!rtpplay1.0 "
+	rtpdumpHeaderSize   = 16
+	rtpdumpPacketHeader = 8
+	rtpdumpMaxLineSize  = 256
+)
+
+// RTPDumpWriter writes a capture in the rtpdump format.
+// Since the format supports only RTP and RTCP packets, RTSP messages are discarded.
+// The address written in the file header is the one of the destination of the first packet.
+// Specification: https://github.com/irtlab/rtptools
+type RTPDumpWriter struct {
+	w io.Writer
+
+	mutex         sync.Mutex
+	headerWritten bool
+	start         time.Time
+}
+
+// NewRTPDumpWriter allocates a RTPDumpWriter.
+func NewRTPDumpWriter(w io.Writer) *RTPDumpWriter {
+	return &RTPDumpWriter{
+		w: w,
+	}
+}
+
+func (w *RTPDumpWriter) writeHeader(pkt *Packet) error {
+	w.start = pkt.Time
+
+	buf := []byte(rtpdumpPrefix + pkt.DstIP.String() + "/" + strconv.FormatInt(int64(pkt.DstPort), 10) + "\n")
+
+	var header [rtpdumpHeaderSize]byte
+	binary.BigEndian.PutUint32(header[0:], uint32(w.start.Unix()))
+	binary.BigEndian.PutUint32(header[4:], uint32(w.start.Nanosecond()/1000))
+	if src4 := pkt.SrcIP.To4(); src4 != nil {
+		copy(header[8:], src4)
+	}
+	binary.BigEndian.PutUint16(header[12:], uint16(pkt.SrcPort))
+
+	_, err := w.w.Write(append(buf, header[:]...))
+	return err
+}
+
+// WritePacket implements Writer.
+func (w *RTPDumpWriter) WritePacket(pkt *Packet) error {
+	if pkt.Content == ContentRTSP {
+		return nil
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if !w.headerWritten {
+		err := w.writeHeader(pkt)
+		if err != nil {
+			return err
+		}
+		w.headerWritten = true
+	}
+
+	offset := pkt.Time.Sub(w.start)
+	if offset < 0 {
+		offset = 0
+	}
+
+	buf := make([]byte, rtpdumpPacketHeader+len(pkt.Payload))
+	binary.BigEndian.PutUint16(buf[0:], uint16(len(buf)))
+	if pkt.Content == ContentRTP {
+		binary.BigEndian.PutUint16(buf[2:], uint16(len(pkt.Payload)))
+	}
+	binary.BigEndian.PutUint32(buf[4:], uint32(offset/time.Millisecond))
+	copy(buf[rtpdumpPacketHeader:], pkt.Payload)
+
+	_, err := w.w.Write(buf)
+	return err
+}
+
+// RTPDumpReader reads a capture in the rtpdump format.
+// Since the format doesn't contain addresses of packets,
+// source and destination of all packets are the ones in the file header.
+type RTPDumpReader struct {
+	br      *bufio.Reader
+	dstIP   net.IP
+	dstPort int
+	srcIP   net.IP
+	srcPort int
+	start   time.Time
+}
+
+// NewRTPDumpReader allocates a RTPDumpReader.
+func NewRTPDumpReader(r io.Reader) (*RTPDumpReader, error) {
+	rr := &RTPDumpReader{
+		br: bufio.NewReader(r),
+	}
+
+	var line []byte
+	for {
+		b, err := rr.br.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+
+		if b == '\n' {
+			break
+		}
+
+		line = append(line, b)
+		if len(line) > rtpdumpMaxLineSize {
+			return nil, fmt.Errorf("invalid rtpdump header")
+		}
+	}
+
+	if !strings.HasPrefix(string(line), rtpdumpPrefix) {
+		return nil, fmt.Errorf("invalid rtpdump header")
+	}
+
+	addr := string(line[len(rtpdumpPrefix):])
+	i := strings.LastIndexByte(addr, '/')
+	if i < 0 {
+		return nil, fmt.Errorf("invalid rtpdump address: '%s'", addr)
+	}
+
+	rr.dstIP = net.ParseIP(addr[:i])
+	if rr.dstIP == nil {
+		// the address can be a host name
+		rr.dstIP = net.IPv4zero
+	}
+
+	tmp, err := strconv.ParseUint(addr[i+1:], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rtpdump address: '%s'", addr)
+	}
+	rr.dstPort = int(tmp)
+
+	var header [rtpdumpHeaderSize]byte
+	_, err = io.ReadFull(rr.br, header[:])
+	if err != nil {
+		return nil, err
+	}
+
+	rr.start = time.Unix(int64(binary.BigEndian.Uint32(header[0:])),
+		int64(binary.BigEndian.Uint32(header[4:]))*1000)
+	rr.srcIP = net.IP(append([]byte(nil), header[8:12]...))
+	rr.srcPort = int(binary.BigEndian.Uint16(header[12:]))
+
+	return rr, nil
+}
+
+// ReadPacket implements Reader.
+func (rr *RTPDumpReader) ReadPacket() (*Packet, error) {
+	var header [rtpdumpPacketHeader]byte
+	_, err := io.ReadFull(rr.br, header[:])
+	if err != nil {
+		return nil, err
+	}
+
+	l := int(binary.BigEndian.Uint16(header[0:]))
+	if l < rtpdumpPacketHeader {
+		return nil, fmt.Errorf("invalid packet length: %d", l)
+	}
+
+	payload := make([]byte, l-rtpdumpPacketHeader)
+	_, err = io.ReadFull(rr.br, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	pkt := &Packet{
+		Time:     rr.start.Add(time.Duration(binary.BigEndian.Uint32(header[4:])) * time.Millisecond),
+		Protocol: ProtocolUDP,
+		SrcIP:    rr.srcIP,
+		SrcPort:  rr.srcPort,
+		DstIP:    rr.dstIP,
+		DstPort:  rr.dstPort,
+		Payload:  payload,
+	}
+
+	// the RTP length is zero in case of RTCP packets
+	if binary.BigEndian.Uint16(header[2:]) == 0 {
+		pkt.Content = ContentRTCP
+	} else {
+		pkt.Content = ContentRTP
+	}
+
+	return pkt, nil
+}
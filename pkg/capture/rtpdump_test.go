@@ -0,0 +1,81 @@
+package capture
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRTPDump(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewRTPDumpWriter(&buf)
+
+	start := time.Date(2023, 4, 5, 10, 0, 0, 500000000, time.UTC)
+
+	pkts := []*Packet{
+		{
+			Time:     start,
+			Protocol: ProtocolUDP,
+			SrcIP:    net.ParseIP("192.168.1.3").To4(),
+			SrcPort:  8000,
+			DstIP:    net.ParseIP("192.168.1.2").To4(),
+			DstPort:  35466,
+			Content:  ContentRTP,
+			Payload:  []byte{0x80, 0x60, 0x00, 0x01, 0x01, 0x02, 0x03, 0x04},
+		},
+		{
+			Time:     start.Add(40 * time.Millisecond),
+			Protocol: ProtocolUDP,
+			SrcIP:    net.ParseIP("192.168.1.3").To4(),
+			SrcPort:  8001,
+			DstIP:    net.ParseIP("192.168.1.2").To4(),
+			DstPort:  35467,
+			Content:  ContentRTCP,
+			Payload:  []byte{0x80, 0xc8, 0x00, 0x06, 0x01, 0x02, 0x03, 0x04},
+		},
+	}
+
+	// RTSP messages are discarded
+	err := w.WritePacket(&Packet{
+		Time:     start,
+		Protocol: ProtocolTCP,
+		Content:  ContentRTSP,
+		Payload:  []byte("OPTIONS * RTSP/1.0\r\nCSeq: 1\r\n\r\n"),
+	})
+	require.NoError(t, err)
+
+	for _, pkt := range pkts {
+		err := w.WritePacket(pkt)
+		require.NoError(t, err)
+	}
+
+	require.Equal(t, "#!rtpplay1.0 192.168.1.2/35466\n", buf.String()[:31])
+
+	r, err := NewRTPDumpReader(&buf)
+	require.NoError(t, err)
+
+	for _, pkt := range pkts {
+		recv, err := r.ReadPacket()
+		require.NoError(t, err)
+		require.True(t, pkt.Time.Equal(recv.Time))
+		require.Equal(t, pkt.Content, recv.Content)
+		require.Equal(t, pkt.Payload, recv.Payload)
+		require.Equal(t, pkts[0].SrcIP, recv.SrcIP)
+		require.Equal(t, pkts[0].DstPort, recv.DstPort)
+	}
+
+	_, err = r.ReadPacket()
+	require.Equal(t, io.EOF, err)
+}
+
+func TestRTPDumpReaderErrors(t *testing.T) {
+	_, err := NewRTPDumpReader(bytes.NewReader([]byte("#!rtpplay2.0 127.0.0.1/5000\n")))
+	require.EqualError(t, err, "invalid rtpdump header")
+
+	_, err = NewRTPDumpReader(bytes.NewReader([]byte("#!rtpplay1.0 127.0.0.1\n")))
+	require.EqualError(t, err, "invalid rtpdump address: '127.0.0.1'")
+}
@@ -3,6 +3,7 @@ package conn
 
 import (
 	"bufio"
+	"bytes"
 	"io"
 
 	"github.com/bluenviron/gortsplib/v3/pkg/base"
@@ -12,13 +13,16 @@ const (
 	readBufferSize = 4096
 )
 
+var responsePrefix = []byte("RTSP/")
+
 // Conn is a RTSP connection.
 type Conn struct {
-	w   io.Writer
-	br  *bufio.Reader
-	req base.Request
-	res base.Response
-	fr  base.InterleavedFrame
+	w      io.Writer
+	br     *bufio.Reader
+	limits base.ReadLimits
+	req    base.Request
+	res    base.Response
+	fr     base.InterleavedFrame
 }
 
 // NewConn allocates a Conn.
@@ -29,15 +33,20 @@ func NewConn(rw io.ReadWriter) *Conn {
 	}
 }
 
+// SetReadLimits sets the limits applied when reading requests and responses.
+func (c *Conn) SetReadLimits(limits base.ReadLimits) {
+	c.limits = limits
+}
+
 // ReadRequest reads a Request.
 func (c *Conn) ReadRequest() (*base.Request, error) {
-	err := c.req.Unmarshal(c.br)
+	err := c.req.UnmarshalWithLimits(c.br, c.limits)
 	return &c.req, err
 }
 
 // ReadResponse reads a Response.
 func (c *Conn) ReadResponse() (*base.Response, error) {
-	err := c.res.Unmarshal(c.br)
+	err := c.res.UnmarshalWithLimits(c.br, c.limits)
 	return &c.res, err
 }
 
@@ -77,6 +86,35 @@ func (c *Conn) ReadInterleavedFrameOrResponse() (interface{}, error) {
 	return c.ReadResponse()
 }
 
+// ReadRequestOrResponse reads a Request or a Response.
+func (c *Conn) ReadRequestOrResponse() (interface{}, error) {
+	byts, err := c.br.Peek(len(responsePrefix))
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.Equal(byts, responsePrefix) {
+		return c.ReadResponse()
+	}
+
+	return c.ReadRequest()
+}
+
+// ReadInterleavedFrameOrRequestOrResponse reads an InterleavedFrame, a Request or a Response.
+func (c *Conn) ReadInterleavedFrameOrRequestOrResponse() (interface{}, error) {
+	b, err := c.br.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	c.br.UnreadByte()
+
+	if b == base.InterleavedFrameMagicByte {
+		return c.ReadInterleavedFrame()
+	}
+
+	return c.ReadRequestOrResponse()
+}
+
 // ReadRequestIgnoreFrames reads a Request and ignores frames in between.
 func (c *Conn) ReadRequestIgnoreFrames() (*base.Request, error) {
 	for {
@@ -138,6 +138,82 @@ func TestReadInterleavedFrameOrResponseErrors(t *testing.T) {
 	}
 }
 
+func TestReadInterleavedFrameOrRequestOrResponse(t *testing.T) {
+	byts := []byte("RTSP/1.0 200 OK\r\n" +
+		"CSeq: 1\r\n" +
+		"\r\n")
+	byts = append(byts, []byte("REDIRECT rtsp://example.com/media.mp4 RTSP/1.0\r\n"+
+		"CSeq: 2\r\n"+
+		"Location: rtsp://example2.com/media.mp4\r\n"+
+		"\r\n")...)
+	byts = append(byts, []byte{0x24, 0x6, 0x0, 0x4, 0x1, 0x2, 0x3, 0x4}...)
+
+	conn := NewConn(bytes.NewBuffer(byts))
+
+	out, err := conn.ReadInterleavedFrameOrRequestOrResponse()
+	require.NoError(t, err)
+	require.Equal(t, &base.Response{
+		StatusCode:    200,
+		StatusMessage: "OK",
+		Header: base.Header{
+			"CSeq": base.HeaderValue{"1"},
+		},
+	}, out)
+
+	out, err = conn.ReadInterleavedFrameOrRequestOrResponse()
+	require.NoError(t, err)
+	require.Equal(t, &base.Request{
+		Method: base.Redirect,
+		URL:    mustParseURL("rtsp://example.com/media.mp4"),
+		Header: base.Header{
+			"CSeq":     base.HeaderValue{"2"},
+			"Location": base.HeaderValue{"rtsp://example2.com/media.mp4"},
+		},
+	}, out)
+
+	out, err = conn.ReadInterleavedFrameOrRequestOrResponse()
+	require.NoError(t, err)
+	require.Equal(t, &base.InterleavedFrame{
+		Channel: 6,
+		Payload: []byte{0x01, 0x02, 0x03, 0x04},
+	}, out)
+}
+
+func TestReadInterleavedFrameOrRequestOrResponseErrors(t *testing.T) {
+	for _, ca := range []struct {
+		name string
+		byts []byte
+		err  string
+	}{
+		{
+			"empty",
+			[]byte{},
+			"EOF",
+		},
+		{
+			"invalid frame",
+			[]byte{0x24, 0x00},
+			"unexpected EOF",
+		},
+		{
+			"invalid response",
+			[]byte("RTSP/1.0"),
+			"EOF",
+		},
+		{
+			"invalid request",
+			[]byte("DESCRIBE"),
+			"EOF",
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			conn := NewConn(bytes.NewBuffer(ca.byts))
+			_, err := conn.ReadInterleavedFrameOrRequestOrResponse()
+			require.EqualError(t, err, ca.err)
+		})
+	}
+}
+
 func TestReadRequestIgnoreFrames(t *testing.T) {
 	byts := []byte{0x24, 0x6, 0x0, 0x4, 0x1, 0x2, 0x3, 0x4}
 	byts = append(byts, []byte("OPTIONS rtsp://example.com/media.mp4 RTSP/1.0\r\n"+
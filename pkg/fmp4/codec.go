@@ -0,0 +1,261 @@
+package fmp4
+
+import (
+	"fmt"
+
+	"github.com/bluenviron/mediacommon/pkg/codecs/h264"
+	"github.com/bluenviron/mediacommon/pkg/codecs/h265"
+	"github.com/bluenviron/mediacommon/pkg/codecs/mpeg4audio"
+)
+
+// Codec is the codec of a track.
+type Codec interface {
+	isVideo() bool
+	sampleEntry(trackID int) ([]byte, int, int, error)
+}
+
+// CodecH264 is a H264 codec.
+type CodecH264 struct {
+	SPS []byte
+	PPS []byte
+}
+
+func (c *CodecH264) isVideo() bool {
+	return true
+}
+
+func (c *CodecH264) sampleEntry(int) ([]byte, int, int, error) {
+	var sps h264.SPS
+	err := sps.Unmarshal(c.SPS)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("invalid SPS: %v", err)
+	}
+
+	if len(c.SPS) < 4 {
+		return nil, 0, 0, fmt.Errorf("invalid SPS")
+	}
+
+	var conf buffer
+	conf.u8(1)        // configuration version
+	conf.u8(c.SPS[1]) // profile
+	conf.u8(c.SPS[2]) // profile compatibility
+	conf.u8(c.SPS[3]) // level
+	conf.u8(0xFF)     // length size minus one = 3
+	conf.u8(0xE1)     // number of SPS = 1
+	conf.u16(uint16(len(c.SPS)))
+	conf.bytes(c.SPS)
+	conf.u8(1) // number of PPS
+	conf.u16(uint16(len(c.PPS)))
+	conf.bytes(c.PPS)
+
+	switch sps.ProfileIdc {
+	case 100, 110, 122, 144:
+		conf.u8(0xFC | uint8(sps.ChromeFormatIdc))
+		conf.u8(0xF8 | uint8(sps.BitDepthLumaMinus8))
+		conf.u8(0xF8 | uint8(sps.BitDepthChromaMinus8))
+		conf.u8(0) // number of SPS extensions
+	}
+
+	width := sps.Width()
+	height := sps.Height()
+
+	return visualSampleEntry("avc1", width, height, box("avcC", conf)), width, height, nil
+}
+
+// CodecH265 is a H265 codec.
+type CodecH265 struct {
+	VPS []byte
+	SPS []byte
+	PPS []byte
+}
+
+func (c *CodecH265) isVideo() bool {
+	return true
+}
+
+func (c *CodecH265) sampleEntry(int) ([]byte, int, int, error) {
+	var sps h265.SPS
+	err := sps.Unmarshal(c.SPS)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("invalid SPS: %v", err)
+	}
+
+	// copy the profile, tier and level from the SPS, after the NALU header and the first byte
+	rbsp := h264.EmulationPreventionRemove(c.SPS)
+	if len(rbsp) < 15 {
+		return nil, 0, 0, fmt.Errorf("invalid SPS")
+	}
+	ptl := rbsp[3:15]
+
+	temporalIDNested := uint8(0)
+	if sps.TemporalIDNestingFlag {
+		temporalIDNested = 1
+	}
+
+	var conf buffer
+	conf.u8(1) // configuration version
+	conf.bytes(ptl)
+	conf.u16(0xF000) // min spatial segmentation
+	conf.u8(0xFC)    // parallelism type
+	conf.u8(0xFC | uint8(sps.ChromaFormatIdc))
+	conf.u8(0xF8 | uint8(sps.BitDepthLumaMinus8))
+	conf.u8(0xF8 | uint8(sps.BitDepthChromaMinus8))
+	conf.u16(0) // average frame rate
+	conf.u8((sps.MaxSubLayersMinus1+1)<<3 | temporalIDNested<<2 | 3)
+	conf.u8(3) // number of arrays
+
+	for _, nalu := range [][]byte{c.VPS, c.SPS, c.PPS} {
+		conf.u8(1<<7 | (nalu[0]>>1)&0b111111) // array completeness and NALU type
+		conf.u16(1)
+		conf.u16(uint16(len(nalu)))
+		conf.bytes(nalu)
+	}
+
+	width := sps.Width()
+	height := sps.Height()
+
+	return visualSampleEntry("hvc1", width, height, box("hvcC", conf)), width, height, nil
+}
+
+// CodecVP9 is a VP9 codec.
+type CodecVP9 struct {
+	Width             int
+	Height            int
+	Profile           uint8
+	BitDepth          uint8
+	ChromaSubsampling uint8
+	ColorRange        bool
+}
+
+func (c *CodecVP9) isVideo() bool {
+	return true
+}
+
+func (c *CodecVP9) sampleEntry(int) ([]byte, int, int, error) {
+	colorRange := uint8(0)
+	if c.ColorRange {
+		colorRange = 1
+	}
+
+	var conf buffer
+	conf.u8(c.Profile)
+	conf.u8(10) // level
+	conf.u8(c.BitDepth<<4 | c.ChromaSubsampling<<1 | colorRange)
+	conf.u8(2)  // colour primaries: unspecified
+	conf.u8(2)  // transfer characteristics: unspecified
+	conf.u8(2)  // matrix coefficients: unspecified
+	conf.u16(0) // codec initialization data size
+
+	return visualSampleEntry("vp09", c.Width, c.Height, fullBox("vpcC", 1, 0, conf)), c.Width, c.Height, nil
+}
+
+// CodecMPEG4Audio is a MPEG-4 Audio codec.
+type CodecMPEG4Audio struct {
+	Config mpeg4audio.Config
+}
+
+func (c *CodecMPEG4Audio) isVideo() bool {
+	return false
+}
+
+func descriptor(tag uint8, content ...[]byte) []byte {
+	size := 0
+	for _, c := range content {
+		size += len(c)
+	}
+
+	var ret buffer
+	ret.u8(tag)
+	ret.u8(0x80 | uint8(size>>21)&0x7F)
+	ret.u8(0x80 | uint8(size>>14)&0x7F)
+	ret.u8(0x80 | uint8(size>>7)&0x7F)
+	ret.u8(uint8(size) & 0x7F)
+	for _, c := range content {
+		ret.bytes(c)
+	}
+
+	return ret
+}
+
+func (c *CodecMPEG4Audio) sampleEntry(trackID int) ([]byte, int, int, error) {
+	asc, err := c.Config.Marshal()
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	var es buffer
+	es.u16(uint16(trackID))
+	es.u8(0) // flags
+
+	var dc buffer
+	dc.u8(0x40)        // object type indication: MPEG-4 Audio
+	dc.u8(0x05<<2 | 1) // stream type: audio
+	dc.u24(0)          // buffer size
+	dc.u32(0)          // max bitrate
+	dc.u32(0)          // average bitrate
+
+	esds := fullBox("esds", 0, 0,
+		descriptor(3, es,
+			descriptor(4, dc,
+				descriptor(5, asc)),
+			descriptor(6, []byte{2})))
+
+	return audioSampleEntry("mp4a", c.Config.ChannelCount, c.Config.SampleRate, esds), 0, 0, nil
+}
+
+// CodecOpus is an Opus codec.
+type CodecOpus struct {
+	ChannelCount int
+}
+
+func (c *CodecOpus) isVideo() bool {
+	return false
+}
+
+func (c *CodecOpus) sampleEntry(int) ([]byte, int, int, error) {
+	var conf buffer
+	conf.u8(0) // version
+	conf.u8(uint8(c.ChannelCount))
+	conf.u16(312) // pre-skip
+	conf.u32(48000)
+	conf.u16(0) // output gain
+	conf.u8(0)  // channel mapping family
+
+	return audioSampleEntry("Opus", c.ChannelCount, 48000, box("dOps", conf)), 0, 0, nil
+}
+
+func visualSampleEntry(typ string, width int, height int, conf []byte) []byte {
+	var b buffer
+	b.zeros(6)           // reserved
+	b.u16(1)             // data reference index
+	b.zeros(16)          // pre-defined and reserved
+	b.u16(uint16(width)) // width
+	b.u16(uint16(height))
+	b.u32(0x00480000) // horizontal resolution
+	b.u32(0x00480000) // vertical resolution
+	b.u32(0)          // reserved
+	b.u16(1)          // frame count
+	b.zeros(32)       // compressor name
+	b.u16(0x0018)     // depth
+	b.u16(0xFFFF)     // pre-defined
+
+	return box(typ, b, conf)
+}
+
+func audioSampleEntry(typ string, channelCount int, sampleRate int, conf []byte) []byte {
+	var b buffer
+	b.zeros(6) // reserved
+	b.u16(1)   // data reference index
+	b.zeros(8) // reserved
+	b.u16(uint16(channelCount))
+	b.u16(16) // sample size
+	b.u16(0)  // pre-defined
+	b.u16(0)  // reserved
+	if sampleRate <= 0xFFFF {
+		b.u32(uint32(sampleRate) << 16)
+	} else {
+		b.u32(0)
+	}
+
+	return box(typ, b, conf)
+}
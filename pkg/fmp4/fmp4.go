@@ -0,0 +1,70 @@
+// Package fmp4 contains a fragmented MP4 (fMP4/CMAF) writer.
+package fmp4
+
+import (
+	"time"
+)
+
+type buffer []byte
+
+func (b *buffer) u8(v uint8) {
+	*b = append(*b, v)
+}
+
+func (b *buffer) u16(v uint16) {
+	*b = append(*b, byte(v>>8), byte(v))
+}
+
+func (b *buffer) u24(v uint32) {
+	*b = append(*b, byte(v>>16), byte(v>>8), byte(v))
+}
+
+func (b *buffer) u32(v uint32) {
+	*b = append(*b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func (b *buffer) u64(v uint64) {
+	b.u32(uint32(v >> 32))
+	b.u32(uint32(v))
+}
+
+func (b *buffer) bytes(v []byte) {
+	*b = append(*b, v...)
+}
+
+func (b *buffer) zeros(n int) {
+	*b = append(*b, make([]byte, n)...)
+}
+
+func box(typ string, content ...[]byte) []byte {
+	size := 8
+	for _, c := range content {
+		size += len(c)
+	}
+
+	ret := make(buffer, 0, size)
+	ret.u32(uint32(size))
+	ret.bytes([]byte(typ))
+	for _, c := range content {
+		ret.bytes(c)
+	}
+
+	return ret
+}
+
+func fullBox(typ string, version uint8, flags uint32, content ...[]byte) []byte {
+	var header buffer
+	header.u8(version)
+	header.u24(flags)
+	return box(typ, append([][]byte{header}, content...)...)
+}
+
+var identityMatrix = []uint32{0x00010000, 0, 0, 0, 0x00010000, 0, 0, 0, 0x40000000}
+
+func durationToTicks(d time.Duration, timeScale uint32) uint64 {
+	// avoid an int64 overflow and preserve resolution by splitting division into two parts:
+	// first add the integer part, then the decimal part, rounded to the nearest tick.
+	secs := d / time.Second
+	dec := d % time.Second
+	return uint64(secs)*uint64(timeScale) + (uint64(dec)*uint64(timeScale)+uint64(time.Second)/2)/uint64(time.Second)
+}
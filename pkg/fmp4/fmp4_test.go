@@ -0,0 +1,67 @@
+package fmp4
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var containerBoxes = map[string]struct{}{
+	"moov": {},
+	"trak": {},
+	"mdia": {},
+	"minf": {},
+	"dinf": {},
+	"stbl": {},
+	"mvex": {},
+	"moof": {},
+	"traf": {},
+}
+
+type testBox struct {
+	path    string
+	content []byte
+}
+
+// walkBoxes returns the boxes contained into a buffer, depth-first.
+func walkBoxes(t *testing.T, buf []byte, prefix string) []testBox {
+	var ret []testBox
+
+	for len(buf) > 0 {
+		require.GreaterOrEqual(t, len(buf), 8)
+		size := int(binary.BigEndian.Uint32(buf))
+		require.GreaterOrEqual(t, size, 8)
+		require.LessOrEqual(t, size, len(buf))
+
+		path := prefix + string(buf[4:8])
+		content := buf[8:size]
+		ret = append(ret, testBox{path: path, content: content})
+
+		if _, ok := containerBoxes[string(buf[4:8])]; ok {
+			ret = append(ret, walkBoxes(t, content, path+"/")...)
+		}
+
+		buf = buf[size:]
+	}
+
+	return ret
+}
+
+func boxPaths(boxes []testBox) []string {
+	ret := make([]string, len(boxes))
+	for i, b := range boxes {
+		ret[i] = b.path
+	}
+	return ret
+}
+
+func findBoxes(boxes []testBox, path string) []testBox {
+	var ret []testBox
+	for _, b := range boxes {
+		if b.path == path {
+			ret = append(ret, b)
+		}
+	}
+	return ret
+}
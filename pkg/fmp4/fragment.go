@@ -0,0 +1,92 @@
+package fmp4
+
+const (
+	trunFlagDataOffsetPresent                   = 0x01
+	trunFlagSampleDurationPresent               = 0x100
+	trunFlagSampleSizePresent                   = 0x200
+	trunFlagSampleFlagsPresent                  = 0x400
+	trunFlagSampleCompositionTimeOffsetsPresent = 0x800
+
+	tfhdFlagDefaultBaseIsMoof = 0x20000
+
+	sampleFlagsSync    = 0x02000000 // does not depend on other samples
+	sampleFlagsNonSync = 0x01010000 // depends on other samples, non-sync sample
+)
+
+// Sample is a sample of a fragment.
+type Sample struct {
+	Duration        uint32
+	PTSOffset       int32
+	IsNonSyncSample bool
+	Payload         []byte
+}
+
+// FragmentTrack is a track of a fragment.
+type FragmentTrack struct {
+	ID       int
+	BaseTime uint64
+	Samples  []*Sample
+}
+
+// Fragment is a fMP4 fragment, made of a moof and a mdat box.
+type Fragment struct {
+	SequenceNumber uint32
+	Tracks         []*FragmentTrack
+}
+
+func (f *Fragment) marshalMoof(dataOffset int) []byte {
+	var mfhd buffer
+	mfhd.u32(f.SequenceNumber)
+
+	moof := [][]byte{fullBox("mfhd", 0, 0, mfhd)}
+
+	for _, t := range f.Tracks {
+		var tfhd buffer
+		tfhd.u32(uint32(t.ID))
+
+		var tfdt buffer
+		tfdt.u64(t.BaseTime)
+
+		var trun buffer
+		trun.u32(uint32(len(t.Samples)))
+		trun.u32(uint32(dataOffset))
+
+		for _, s := range t.Samples {
+			trun.u32(s.Duration)
+			trun.u32(uint32(len(s.Payload)))
+			if s.IsNonSyncSample {
+				trun.u32(sampleFlagsNonSync)
+			} else {
+				trun.u32(sampleFlagsSync)
+			}
+			trun.u32(uint32(s.PTSOffset))
+			dataOffset += len(s.Payload)
+		}
+
+		moof = append(moof, box("traf",
+			fullBox("tfhd", 0, tfhdFlagDefaultBaseIsMoof, tfhd),
+			fullBox("tfdt", 1, 0, tfdt),
+			fullBox("trun", 1, trunFlagDataOffsetPresent|trunFlagSampleDurationPresent|
+				trunFlagSampleSizePresent|trunFlagSampleFlagsPresent|
+				trunFlagSampleCompositionTimeOffsetsPresent, trun)))
+	}
+
+	return box("moof", moof...)
+}
+
+// Marshal encodes a fragment.
+func (f *Fragment) Marshal() ([]byte, error) {
+	// data offsets are relative to the start of the moof box,
+	// whose size does not depend on offsets.
+	moofSize := len(f.marshalMoof(0))
+	moof := f.marshalMoof(moofSize + 8)
+
+	var mdat [][]byte
+	for _, t := range f.Tracks {
+		for _, s := range t.Samples {
+			mdat = append(mdat, s.Payload)
+		}
+	}
+
+	return append(moof, box("mdat", mdat...)...), nil
+}
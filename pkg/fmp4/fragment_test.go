@@ -0,0 +1,82 @@
+package fmp4
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFragmentMarshal(t *testing.T) {
+	frag := &Fragment{
+		SequenceNumber: 5,
+		Tracks: []*FragmentTrack{
+			{
+				ID:       1,
+				BaseTime: 90000,
+				Samples: []*Sample{
+					{
+						Duration: 3000,
+						Payload:  []byte{0x01, 0x02},
+					},
+					{
+						Duration:        3000,
+						PTSOffset:       -3000,
+						IsNonSyncSample: true,
+						Payload:         []byte{0x03},
+					},
+				},
+			},
+			{
+				ID:       2,
+				BaseTime: 44100,
+				Samples: []*Sample{
+					{
+						Duration: 1024,
+						Payload:  []byte{0x04, 0x05, 0x06},
+					},
+				},
+			},
+		},
+	}
+
+	buf, err := frag.Marshal()
+	require.NoError(t, err)
+
+	boxes := walkBoxes(t, buf, "")
+	require.Equal(t, []string{
+		"moof",
+		"moof/mfhd",
+		"moof/traf",
+		"moof/traf/tfhd",
+		"moof/traf/tfdt",
+		"moof/traf/trun",
+		"moof/traf",
+		"moof/traf/tfhd",
+		"moof/traf/tfdt",
+		"moof/traf/trun",
+		"mdat",
+	}, boxPaths(boxes))
+
+	require.Equal(t, []byte{0, 0, 0, 0, 0, 0, 0, 5}, findBoxes(boxes, "moof/mfhd")[0].content)
+
+	tfdts := findBoxes(boxes, "moof/traf/tfdt")
+	require.Equal(t, uint64(90000), binary.BigEndian.Uint64(tfdts[0].content[4:]))
+	require.Equal(t, uint64(44100), binary.BigEndian.Uint64(tfdts[1].content[4:]))
+
+	truns := findBoxes(boxes, "moof/traf/trun")
+
+	// data offsets point to the payloads
+	for i, payload := range [][]byte{{0x01, 0x02}, {0x04, 0x05, 0x06}} {
+		offset := binary.BigEndian.Uint32(truns[i].content[8:])
+		require.Equal(t, payload, buf[offset:int(offset)+len(payload)])
+	}
+
+	// second sample of first track
+	require.Equal(t, []byte{
+		0x00, 0x00, 0x0b, 0xb8, // duration
+		0x00, 0x00, 0x00, 0x01, // size
+		0x01, 0x01, 0x00, 0x00, // flags
+		0xff, 0xff, 0xf4, 0x48, // PTS offset
+	}, truns[0].content[28:44])
+}
@@ -0,0 +1,133 @@
+package fmp4
+
+// InitTrack is a track of an initialization segment.
+type InitTrack struct {
+	ID        int
+	TimeScale uint32
+	Codec     Codec
+}
+
+func (t *InitTrack) marshal() ([]byte, error) {
+	entry, width, height, err := t.Codec.sampleEntry(t.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var tkhd buffer
+	tkhd.u32(0) // creation time
+	tkhd.u32(0) // modification time
+	tkhd.u32(uint32(t.ID))
+	tkhd.u32(0)   // reserved
+	tkhd.u32(0)   // duration
+	tkhd.zeros(8) // reserved
+	tkhd.u16(0)   // layer
+	tkhd.u16(0)   // alternate group
+	if t.Codec.isVideo() {
+		tkhd.u16(0) // volume
+	} else {
+		tkhd.u16(0x0100)
+	}
+	tkhd.u16(0) // reserved
+	for _, v := range identityMatrix {
+		tkhd.u32(v)
+	}
+	tkhd.u32(uint32(width) << 16)
+	tkhd.u32(uint32(height) << 16)
+
+	var mdhd buffer
+	mdhd.u32(0) // creation time
+	mdhd.u32(0) // modification time
+	mdhd.u32(t.TimeScale)
+	mdhd.u32(0)      // duration
+	mdhd.u16(0x55C4) // language: und
+	mdhd.u16(0)      // pre-defined
+
+	var hdlr buffer
+	hdlr.u32(0) // pre-defined
+	var mhd []byte
+
+	if t.Codec.isVideo() {
+		hdlr.bytes([]byte("vide"))
+		hdlr.zeros(12) // reserved
+		hdlr.bytes([]byte("VideoHandler\x00"))
+		mhd = fullBox("vmhd", 0, 1, make([]byte, 8))
+	} else {
+		hdlr.bytes([]byte("soun"))
+		hdlr.zeros(12) // reserved
+		hdlr.bytes([]byte("SoundHandler\x00"))
+		mhd = fullBox("smhd", 0, 0, make([]byte, 4))
+	}
+
+	var stsd buffer
+	stsd.u32(1) // entry count
+
+	return box("trak",
+		fullBox("tkhd", 0, 3, tkhd),
+		box("mdia",
+			fullBox("mdhd", 0, 0, mdhd),
+			fullBox("hdlr", 0, 0, hdlr),
+			box("minf",
+				mhd,
+				box("dinf",
+					fullBox("dref", 0, 0, []byte{0, 0, 0, 1},
+						fullBox("url ", 0, 1))),
+				box("stbl",
+					fullBox("stsd", 0, 0, stsd, entry),
+					fullBox("stts", 0, 0, make([]byte, 4)),
+					fullBox("stsc", 0, 0, make([]byte, 4)),
+					fullBox("stsz", 0, 0, make([]byte, 8)),
+					fullBox("stco", 0, 0, make([]byte, 4)))))), nil
+}
+
+// Init is a fMP4 initialization segment.
+type Init struct {
+	Tracks []*InitTrack
+}
+
+// Marshal encodes an initialization segment.
+func (i *Init) Marshal() ([]byte, error) {
+	var ftyp buffer
+	ftyp.bytes([]byte("iso6")) // major brand
+	ftyp.u32(1)                // minor version
+	ftyp.bytes([]byte("iso6"))
+	ftyp.bytes([]byte("cmfc"))
+	ftyp.bytes([]byte("mp41"))
+
+	var mvhd buffer
+	mvhd.u32(0)    // creation time
+	mvhd.u32(0)    // modification time
+	mvhd.u32(1000) // time scale
+	mvhd.u32(0)    // duration
+	mvhd.u32(0x00010000)
+	mvhd.u16(0x0100) // volume
+	mvhd.zeros(10)   // reserved
+	for _, v := range identityMatrix {
+		mvhd.u32(v)
+	}
+	mvhd.zeros(24) // pre-defined
+	mvhd.u32(uint32(len(i.Tracks) + 1))
+
+	moov := [][]byte{fullBox("mvhd", 0, 0, mvhd)}
+	var mvex [][]byte
+
+	for _, t := range i.Tracks {
+		trak, err := t.marshal()
+		if err != nil {
+			return nil, err
+		}
+		moov = append(moov, trak)
+
+		var trex buffer
+		trex.u32(uint32(t.ID))
+		trex.u32(1) // default sample description index
+		trex.u32(0) // default sample duration
+		trex.u32(0) // default sample size
+		trex.u32(0) // default sample flags
+		mvex = append(mvex, fullBox("trex", 0, 0, trex))
+	}
+
+	moov = append(moov, box("mvex", mvex...))
+
+	ret := box("ftyp", ftyp)
+	return append(ret, box("moov", moov...)...), nil
+}
@@ -0,0 +1,207 @@
+package fmp4
+
+import (
+	"testing"
+
+	"github.com/bluenviron/mediacommon/pkg/codecs/mpeg4audio"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	testSPS = []byte{
+		0x67, 0x64, 0x00, 0x0c, 0xac, 0x3b, 0x50, 0xb0,
+		0x4b, 0x42, 0x00, 0x00, 0x03, 0x00, 0x02, 0x00,
+		0x00, 0x03, 0x00, 0x3d, 0x08,
+	}
+
+	testPPS = []byte{0x68, 0xee, 0x3c, 0x80}
+
+	testH265SPS = []byte{
+		0x42, 0x01, 0x01, 0x01, 0x60, 0x00, 0x00, 0x03,
+		0x00, 0x90, 0x00, 0x00, 0x03, 0x00, 0x00, 0x03,
+		0x00, 0x78, 0xa0, 0x03, 0xc0, 0x80, 0x10, 0xe5,
+		0x96, 0x66, 0x69, 0x24, 0xca, 0xe0, 0x10, 0x00,
+		0x00, 0x03, 0x00, 0x10, 0x00, 0x00, 0x03, 0x01,
+		0xe0, 0x80,
+	}
+)
+
+func trakPaths(mhd string) []string {
+	return []string{
+		"moov/trak",
+		"moov/trak/tkhd",
+		"moov/trak/mdia",
+		"moov/trak/mdia/mdhd",
+		"moov/trak/mdia/hdlr",
+		"moov/trak/mdia/minf",
+		"moov/trak/mdia/minf/" + mhd,
+		"moov/trak/mdia/minf/dinf",
+		"moov/trak/mdia/minf/dinf/dref",
+		"moov/trak/mdia/minf/stbl",
+		"moov/trak/mdia/minf/stbl/stsd",
+		"moov/trak/mdia/minf/stbl/stts",
+		"moov/trak/mdia/minf/stbl/stsc",
+		"moov/trak/mdia/minf/stbl/stsz",
+		"moov/trak/mdia/minf/stbl/stco",
+	}
+}
+
+func TestInitMarshal(t *testing.T) {
+	init := &Init{
+		Tracks: []*InitTrack{
+			{
+				ID:        1,
+				TimeScale: 90000,
+				Codec: &CodecH264{
+					SPS: testSPS,
+					PPS: testPPS,
+				},
+			},
+			{
+				ID:        2,
+				TimeScale: 44100,
+				Codec: &CodecMPEG4Audio{
+					Config: mpeg4audio.Config{
+						Type:         mpeg4audio.ObjectTypeAACLC,
+						SampleRate:   44100,
+						ChannelCount: 2,
+					},
+				},
+			},
+		},
+	}
+
+	buf, err := init.Marshal()
+	require.NoError(t, err)
+
+	boxes := walkBoxes(t, buf, "")
+
+	expected := []string{"ftyp", "moov", "moov/mvhd"}
+	expected = append(expected, trakPaths("vmhd")...)
+	expected = append(expected, trakPaths("smhd")...)
+	expected = append(expected, "moov/mvex", "moov/mvex/trex", "moov/mvex/trex")
+	require.Equal(t, expected, boxPaths(boxes))
+
+	// track IDs
+	tkhds := findBoxes(boxes, "moov/trak/tkhd")
+	require.Equal(t, []byte{0, 0, 0, 1}, tkhds[0].content[12:16])
+	require.Equal(t, []byte{0, 0, 0, 2}, tkhds[1].content[12:16])
+
+	// width and height
+	require.Equal(t, []byte{0x01, 0x60, 0, 0, 0x01, 0x20, 0, 0}, tkhds[0].content[76:84])
+
+	// sample entries
+	stsds := findBoxes(boxes, "moov/trak/mdia/minf/stbl/stsd")
+
+	avc1 := walkBoxes(t, stsds[0].content[8:], "")
+	require.Equal(t, []string{"avc1"}, boxPaths(avc1))
+	avcC := walkBoxes(t, avc1[0].content[78:], "")
+	require.Equal(t, []testBox{{
+		path: "avcC",
+		content: append(append(append(
+			[]byte{1, 0x64, 0x00, 0x0c, 0xff, 0xe1, 0x00, 0x15},
+			testSPS...),
+			0x01, 0x00, 0x04),
+			append(testPPS, 0xfd, 0xf8, 0xf8, 0x00)...),
+	}}, avcC)
+
+	mp4a := walkBoxes(t, stsds[1].content[8:], "")
+	require.Equal(t, []string{"mp4a"}, boxPaths(mp4a))
+	esds := walkBoxes(t, mp4a[0].content[28:], "")
+	require.Equal(t, []string{"esds"}, boxPaths(esds))
+	// the AudioSpecificConfig is at the end of the DecoderConfigDescriptor
+	require.Contains(t, string(esds[0].content), string([]byte{0x05, 0x80, 0x80, 0x80, 0x02, 0x12, 0x10}))
+}
+
+func TestInitMarshalCodecs(t *testing.T) {
+	for _, ca := range []struct {
+		name  string
+		codec Codec
+		entry string
+		conf  string
+	}{
+		{
+			"h265",
+			&CodecH265{
+				VPS: []byte{0x40, 0x01, 0x0c},
+				SPS: testH265SPS,
+				PPS: []byte{0x44, 0x01, 0xc1},
+			},
+			"hvc1",
+			"hvcC",
+		},
+		{
+			"vp9",
+			&CodecVP9{
+				Width:             1920,
+				Height:            1080,
+				BitDepth:          8,
+				ChromaSubsampling: 1,
+			},
+			"vp09",
+			"vpcC",
+		},
+		{
+			"opus",
+			&CodecOpus{
+				ChannelCount: 2,
+			},
+			"Opus",
+			"dOps",
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			init := &Init{
+				Tracks: []*InitTrack{{
+					ID:        1,
+					TimeScale: 90000,
+					Codec:     ca.codec,
+				}},
+			}
+
+			buf, err := init.Marshal()
+			require.NoError(t, err)
+
+			boxes := walkBoxes(t, buf, "")
+			stsd := findBoxes(boxes, "moov/trak/mdia/minf/stbl/stsd")
+			require.Equal(t, 1, len(stsd))
+
+			entry := walkBoxes(t, stsd[0].content[8:], "")
+			require.Equal(t, []string{ca.entry}, boxPaths(entry))
+
+			confOffset := 78
+			if !ca.codec.isVideo() {
+				confOffset = 28
+			}
+			conf := walkBoxes(t, entry[0].content[confOffset:], "")
+			require.Equal(t, []string{ca.conf}, boxPaths(conf))
+		})
+	}
+}
+
+func TestInitMarshalH265Config(t *testing.T) {
+	entry, width, height, err := (&CodecH265{
+		VPS: []byte{0x40, 0x01, 0x0c},
+		SPS: testH265SPS,
+		PPS: []byte{0x44, 0x01, 0xc1},
+	}).sampleEntry(1)
+	require.NoError(t, err)
+	require.Equal(t, 1920, width)
+	require.Equal(t, 1080, height)
+
+	conf := walkBoxes(t, entry[8+78:], "")
+	require.Equal(t, []byte{
+		0x01,                   // version
+		0x01,                   // profile space, tier, profile
+		0x60, 0x00, 0x00, 0x00, // profile compatibility
+		0x90, 0x00, 0x00, 0x00, 0x00, 0x00, // constraints
+		0x78,       // level
+		0xf0, 0x00, // min spatial segmentation
+		0xfc,       // parallelism type
+		0xfd,       // chroma format
+		0xf8, 0xf8, // bit depths
+		0x00, 0x00, // frame rate
+		0x0f, // temporal layers, nesting, length size
+		0x03, // arrays
+	}, conf[0].content[:23])
+}
@@ -0,0 +1,168 @@
+package fmp4
+
+import (
+	"fmt"
+)
+
+type bitReader struct {
+	buf []byte
+	pos int
+}
+
+func (r *bitReader) read(n int) (uint32, error) {
+	if (r.pos + n) > len(r.buf)*8 {
+		return 0, fmt.Errorf("not enough bits")
+	}
+
+	v := uint32(0)
+	for i := 0; i < n; i++ {
+		v <<= 1
+		v |= uint32(r.buf[r.pos/8]>>(7-(r.pos%8))) & 1
+		r.pos++
+	}
+	return v, nil
+}
+
+func (r *bitReader) readMany(dest ...*uint32) error {
+	for _, d := range dest {
+		v, err := r.read(1)
+		if err != nil {
+			return err
+		}
+		*d = v
+	}
+	return nil
+}
+
+// vp9ParseHeader parses the uncompressed header of a VP9 frame.
+// It returns the codec parameters when the frame is a keyframe, nil otherwise.
+func vp9ParseHeader(frame []byte) (*CodecVP9, error) {
+	r := &bitReader{buf: frame}
+
+	frameMarker, err := r.read(2)
+	if err != nil {
+		return nil, err
+	}
+	if frameMarker != 2 {
+		return nil, fmt.Errorf("invalid frame marker")
+	}
+
+	var profileLow, profileHigh uint32
+	err = r.readMany(&profileLow, &profileHigh)
+	if err != nil {
+		return nil, err
+	}
+	profile := uint8(profileHigh<<1 | profileLow)
+
+	if profile == 3 {
+		_, err = r.read(1) // reserved
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var showExistingFrame uint32
+	err = r.readMany(&showExistingFrame)
+	if err != nil {
+		return nil, err
+	}
+	if showExistingFrame == 1 {
+		return nil, nil
+	}
+
+	var frameType, showFrame, errorResilientMode uint32
+	err = r.readMany(&frameType, &showFrame, &errorResilientMode)
+	if err != nil {
+		return nil, err
+	}
+	if frameType != 0 {
+		return nil, nil
+	}
+
+	syncCode, err := r.read(24)
+	if err != nil {
+		return nil, err
+	}
+	if syncCode != 0x498342 {
+		return nil, fmt.Errorf("invalid sync code")
+	}
+
+	c := &CodecVP9{
+		Profile:  profile,
+		BitDepth: 8,
+	}
+
+	if profile >= 2 {
+		var tenOrTwelveBit uint32
+		err = r.readMany(&tenOrTwelveBit)
+		if err != nil {
+			return nil, err
+		}
+		if tenOrTwelveBit == 1 {
+			c.BitDepth = 12
+		} else {
+			c.BitDepth = 10
+		}
+	}
+
+	colorSpace, err := r.read(3)
+	if err != nil {
+		return nil, err
+	}
+
+	subsamplingX, subsamplingY := uint32(1), uint32(1)
+
+	if colorSpace != 7 { // sRGB
+		var colorRange uint32
+		err = r.readMany(&colorRange)
+		if err != nil {
+			return nil, err
+		}
+		c.ColorRange = (colorRange == 1)
+
+		if profile == 1 || profile == 3 {
+			var reserved uint32
+			err = r.readMany(&subsamplingX, &subsamplingY, &reserved)
+			if err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		c.ColorRange = true
+
+		if profile == 1 || profile == 3 {
+			subsamplingX, subsamplingY = 0, 0
+
+			_, err = r.read(1) // reserved
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	switch {
+	case subsamplingX == 1 && subsamplingY == 1:
+		c.ChromaSubsampling = 1 // 4:2:0 colocated with luma
+
+	case subsamplingX == 1:
+		c.ChromaSubsampling = 2 // 4:2:2
+
+	default:
+		c.ChromaSubsampling = 3 // 4:4:4
+	}
+
+	widthMinus1, err := r.read(16)
+	if err != nil {
+		return nil, err
+	}
+
+	heightMinus1, err := r.read(16)
+	if err != nil {
+		return nil, err
+	}
+
+	c.Width = int(widthMinus1) + 1
+	c.Height = int(heightMinus1) + 1
+
+	return c, nil
+}
@@ -0,0 +1,29 @@
+package fmp4
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVP9ParseHeader(t *testing.T) {
+	params, err := vp9ParseHeader([]byte{0x82, 0x49, 0x83, 0x42, 0x00, 0x15, 0xf0, 0x11, 0xf0})
+	require.NoError(t, err)
+	require.Equal(t, &CodecVP9{
+		Width:             352,
+		Height:            288,
+		BitDepth:          8,
+		ChromaSubsampling: 1,
+	}, params)
+
+	// non-key frame
+	params, err = vp9ParseHeader([]byte{0x86, 0x00})
+	require.NoError(t, err)
+	require.Nil(t, params)
+
+	_, err = vp9ParseHeader([]byte{0x02, 0x00})
+	require.EqualError(t, err, "invalid frame marker")
+
+	_, err = vp9ParseHeader([]byte{0x82, 0x49})
+	require.EqualError(t, err, "not enough bits")
+}
@@ -0,0 +1,557 @@
+package fmp4
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/mediacommon/pkg/codecs/h264"
+	"github.com/bluenviron/mediacommon/pkg/codecs/h265"
+	"github.com/bluenviron/mediacommon/pkg/codecs/mpeg4audio"
+
+	"github.com/bluenviron/gortsplib/v3/pkg/formats"
+	"github.com/bluenviron/gortsplib/v3/pkg/media"
+)
+
+const (
+	videoTimeScale = 90000
+)
+
+type writerSample struct {
+	isSync    bool
+	payload   []byte
+	dtsTicks  uint64
+	ptsOffset int32
+}
+
+type writerTrack struct {
+	id        int
+	timeScale uint32
+	codec     Codec
+	isVideo   bool
+
+	h264DTSExtractor *h264.DTSExtractor
+	h265DTSExtractor *h265.DTSExtractor
+
+	paramsChanged bool
+	pending       *writerSample
+	lastDuration  uint32
+	samples       []*Sample
+	baseTime      uint64
+}
+
+func (t *writerTrack) ready() bool {
+	switch codec := t.codec.(type) {
+	case *CodecH264:
+		return codec.SPS != nil && codec.PPS != nil
+
+	case *CodecH265:
+		return codec.VPS != nil && codec.SPS != nil && codec.PPS != nil
+
+	case *CodecVP9:
+		return codec.Width != 0
+
+	default:
+		return true
+	}
+}
+
+// push moves the pending sample into the current fragment,
+// by using the DTS of the next sample to compute its duration.
+func (t *writerTrack) push(nextDTSTicks uint64) {
+	if t.pending == nil {
+		return
+	}
+
+	if len(t.samples) == 0 {
+		t.baseTime = t.pending.dtsTicks
+	}
+
+	if nextDTSTicks > t.pending.dtsTicks {
+		t.lastDuration = uint32(nextDTSTicks - t.pending.dtsTicks)
+	}
+
+	t.samples = append(t.samples, &Sample{
+		Duration:        t.lastDuration,
+		PTSOffset:       t.pending.ptsOffset,
+		IsNonSyncSample: !t.pending.isSync,
+		Payload:         t.pending.payload,
+	})
+	t.pending = nil
+}
+
+// Writer writes access units into a fragmented MP4 stream,
+// made of initialization segments and media segments.
+// Supported formats are H264, H265, VP9, MPEG-4 Audio (AAC) and Opus;
+// other formats are ignored.
+type Writer struct {
+	//
+	// parameters (all optional except Medias)
+	//
+	// medias to write.
+	Medias media.Medias
+	// minimum duration of segments.
+	// A segment is completed when this duration is reached and a keyframe is received.
+	// It defaults to 1 second.
+	SegmentDuration time.Duration
+
+	//
+	// callbacks (all optional)
+	//
+	// called when an initialization segment is available.
+	// It is generated before the first segment and every time codec parameters change.
+	OnInit func(init []byte) error
+	// called when a segment is available.
+	OnSegment func(segment []byte) error
+
+	mutex       sync.Mutex
+	tracks      map[formats.Format]*writerTrack
+	trackList   []*writerTrack
+	leading     *writerTrack
+	initialized bool
+	startDTS    time.Duration
+	segStartDTS time.Duration
+	nextSeqNum  uint32
+}
+
+// Start initializes the writer.
+func (w *Writer) Start() error {
+	if w.SegmentDuration == 0 {
+		w.SegmentDuration = 1 * time.Second
+	}
+	if w.OnInit == nil {
+		w.OnInit = func([]byte) error { return nil }
+	}
+	if w.OnSegment == nil {
+		w.OnSegment = func([]byte) error { return nil }
+	}
+
+	w.tracks = make(map[formats.Format]*writerTrack)
+
+	for _, medi := range w.Medias {
+		for _, forma := range medi.Formats {
+			t := &writerTrack{
+				id:        len(w.trackList) + 1,
+				timeScale: videoTimeScale,
+			}
+
+			switch tforma := forma.(type) {
+			case *formats.H264:
+				sps, pps := tforma.SafeParams()
+				t.codec = &CodecH264{SPS: sps, PPS: pps}
+
+			case *formats.H265:
+				vps, sps, pps := tforma.SafeParams()
+				t.codec = &CodecH265{VPS: vps, SPS: sps, PPS: pps}
+
+			case *formats.VP9:
+				t.codec = &CodecVP9{}
+
+			case *formats.MPEG4Audio:
+				if tforma.Config == nil {
+					continue
+				}
+				t.codec = &CodecMPEG4Audio{Config: *tforma.Config}
+				t.timeScale = uint32(tforma.Config.SampleRate)
+
+			case *formats.Opus:
+				channelCount := 1
+				if tforma.IsStereo {
+					channelCount = 2
+				}
+				t.codec = &CodecOpus{ChannelCount: channelCount}
+				t.timeScale = 48000
+
+			default:
+				continue
+			}
+
+			t.isVideo = t.codec.isVideo()
+
+			w.tracks[forma] = t
+			w.trackList = append(w.trackList, t)
+
+			if t.isVideo && w.leading == nil {
+				w.leading = t
+			}
+		}
+	}
+
+	if len(w.trackList) == 0 {
+		return fmt.Errorf("no supported formats found")
+	}
+
+	// segments are cut on the first track when there are no video tracks
+	if w.leading == nil {
+		w.leading = w.trackList[0]
+	}
+
+	return nil
+}
+
+// Close writes pending samples into a final segment.
+func (w *Writer) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if !w.initialized {
+		return nil
+	}
+
+	for _, t := range w.trackList {
+		t.push(0)
+	}
+
+	return w.writeSegment()
+}
+
+func (w *Writer) writeInit() error {
+	init := &Init{}
+
+	for _, t := range w.trackList {
+		init.Tracks = append(init.Tracks, &InitTrack{
+			ID:        t.id,
+			TimeScale: t.timeScale,
+			Codec:     t.codec,
+		})
+	}
+
+	buf, err := init.Marshal()
+	if err != nil {
+		return err
+	}
+
+	return w.OnInit(buf)
+}
+
+func (w *Writer) writeSegment() error {
+	frag := &Fragment{
+		SequenceNumber: w.nextSeqNum,
+	}
+
+	for _, t := range w.trackList {
+		if len(t.samples) == 0 {
+			continue
+		}
+
+		frag.Tracks = append(frag.Tracks, &FragmentTrack{
+			ID:       t.id,
+			BaseTime: t.baseTime,
+			Samples:  t.samples,
+		})
+		t.samples = nil
+	}
+
+	if len(frag.Tracks) == 0 {
+		return nil
+	}
+
+	w.nextSeqNum++
+
+	buf, err := frag.Marshal()
+	if err != nil {
+		return err
+	}
+
+	return w.OnSegment(buf)
+}
+
+func (w *Writer) allReady() bool {
+	for _, t := range w.trackList {
+		if !t.ready() {
+			return false
+		}
+	}
+	return true
+}
+
+func (w *Writer) writeSample(
+	t *writerTrack,
+	pts time.Duration,
+	dts time.Duration,
+	isSync bool,
+	paramsChanged bool,
+	payload []byte,
+) error {
+	// parameters can be sent before the sync sample that uses them
+	if paramsChanged {
+		t.paramsChanged = true
+	}
+
+	if !w.initialized {
+		if t != w.leading || !isSync || !w.allReady() {
+			return nil
+		}
+
+		err := w.writeInit()
+		if err != nil {
+			return err
+		}
+
+		w.initialized = true
+		w.startDTS = dts
+		w.segStartDTS = dts
+
+		for _, ot := range w.trackList {
+			ot.paramsChanged = false
+		}
+	}
+
+	// discard samples that precede the first segment
+	if dts < w.startDTS {
+		return nil
+	}
+
+	sample := &writerSample{
+		isSync:   isSync,
+		payload:  payload,
+		dtsTicks: durationToTicks(dts-w.startDTS, t.timeScale),
+	}
+	sample.ptsOffset = int32(durationToTicks(pts-w.startDTS, t.timeScale) - sample.dtsTicks)
+
+	t.push(sample.dtsTicks)
+
+	if isSync && t.paramsChanged ||
+		t == w.leading && isSync && (dts-w.segStartDTS) >= w.SegmentDuration {
+		err := w.writeSegment()
+		if err != nil {
+			return err
+		}
+
+		if t.paramsChanged {
+			t.paramsChanged = false
+
+			err = w.writeInit()
+			if err != nil {
+				return err
+			}
+		}
+
+		w.segStartDTS = dts
+	}
+
+	t.pending = sample
+
+	return nil
+}
+
+// WriteH264 writes a H264 access unit.
+func (w *Writer) WriteH264(forma *formats.H264, pts time.Duration, au [][]byte) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	t, ok := w.tracks[forma]
+	if !ok {
+		return fmt.Errorf("format not found")
+	}
+
+	codec := t.codec.(*CodecH264)
+	filtered := make([][]byte, 0, len(au))
+	paramsChanged := false
+	idrPresent := false
+
+	for _, nalu := range au {
+		typ := h264.NALUType(nalu[0] & 0x1F)
+
+		switch typ {
+		case h264.NALUTypeSPS:
+			if !bytes.Equal(codec.SPS, nalu) {
+				codec.SPS = append([]byte(nil), nalu...)
+				paramsChanged = true
+			}
+			continue
+
+		case h264.NALUTypePPS:
+			if !bytes.Equal(codec.PPS, nalu) {
+				codec.PPS = append([]byte(nil), nalu...)
+				paramsChanged = true
+			}
+			continue
+
+		case h264.NALUTypeAccessUnitDelimiter:
+			continue
+
+		case h264.NALUTypeIDR:
+			idrPresent = true
+		}
+
+		filtered = append(filtered, nalu)
+	}
+
+	if len(filtered) == 0 || !t.ready() {
+		return nil
+	}
+
+	if idrPresent {
+		// restart the DTS extractor, since the stream may have been reset
+		if paramsChanged || t.h264DTSExtractor == nil {
+			t.h264DTSExtractor = h264.NewDTSExtractor()
+		}
+	} else if t.h264DTSExtractor == nil {
+		return nil
+	}
+
+	// the DTS extractor needs parameters in order to work
+	dtsAU := filtered
+	if idrPresent {
+		dtsAU = append([][]byte{codec.SPS, codec.PPS}, filtered...)
+	}
+
+	dts, err := t.h264DTSExtractor.Extract(dtsAU, pts)
+	if err != nil {
+		return err
+	}
+
+	payload, err := h264.AVCCMarshal(filtered)
+	if err != nil {
+		return err
+	}
+
+	return w.writeSample(t, pts, dts, idrPresent, paramsChanged, payload)
+}
+
+// WriteH265 writes a H265 access unit.
+func (w *Writer) WriteH265(forma *formats.H265, pts time.Duration, au [][]byte) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	t, ok := w.tracks[forma]
+	if !ok {
+		return fmt.Errorf("format not found")
+	}
+
+	codec := t.codec.(*CodecH265)
+	filtered := make([][]byte, 0, len(au))
+	paramsChanged := false
+	randomAccess := false
+
+	setParam := func(dest *[]byte, nalu []byte) {
+		if !bytes.Equal(*dest, nalu) {
+			*dest = append([]byte(nil), nalu...)
+			paramsChanged = true
+		}
+	}
+
+	for _, nalu := range au {
+		typ := h265.NALUType((nalu[0] >> 1) & 0b111111)
+
+		switch typ {
+		case h265.NALUType_VPS_NUT:
+			setParam(&codec.VPS, nalu)
+			continue
+
+		case h265.NALUType_SPS_NUT:
+			setParam(&codec.SPS, nalu)
+			continue
+
+		case h265.NALUType_PPS_NUT:
+			setParam(&codec.PPS, nalu)
+			continue
+
+		case h265.NALUType_AUD_NUT:
+			continue
+
+		case h265.NALUType_IDR_W_RADL, h265.NALUType_IDR_N_LP, h265.NALUType_CRA_NUT:
+			randomAccess = true
+		}
+
+		filtered = append(filtered, nalu)
+	}
+
+	if len(filtered) == 0 || !t.ready() {
+		return nil
+	}
+
+	if randomAccess {
+		if paramsChanged || t.h265DTSExtractor == nil {
+			t.h265DTSExtractor = h265.NewDTSExtractor()
+		}
+	} else if t.h265DTSExtractor == nil {
+		return nil
+	}
+
+	dtsAU := filtered
+	if randomAccess {
+		dtsAU = append([][]byte{codec.VPS, codec.SPS, codec.PPS}, filtered...)
+	}
+
+	dts, err := t.h265DTSExtractor.Extract(dtsAU, pts)
+	if err != nil {
+		return err
+	}
+
+	payload, err := h264.AVCCMarshal(filtered)
+	if err != nil {
+		return err
+	}
+
+	return w.writeSample(t, pts, dts, randomAccess, paramsChanged, payload)
+}
+
+// WriteVP9 writes a VP9 frame.
+func (w *Writer) WriteVP9(forma *formats.VP9, pts time.Duration, frame []byte) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	t, ok := w.tracks[forma]
+	if !ok {
+		return fmt.Errorf("format not found")
+	}
+
+	params, err := vp9ParseHeader(frame)
+	if err != nil {
+		return err
+	}
+
+	paramsChanged := false
+
+	if params != nil {
+		codec := t.codec.(*CodecVP9)
+		if *codec != *params {
+			*codec = *params
+			paramsChanged = true
+		}
+	} else if !t.ready() {
+		return nil
+	}
+
+	return w.writeSample(t, pts, pts, params != nil, paramsChanged, frame)
+}
+
+// WriteMPEG4Audio writes MPEG-4 Audio access units.
+func (w *Writer) WriteMPEG4Audio(forma *formats.MPEG4Audio, pts time.Duration, aus [][]byte) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	t, ok := w.tracks[forma]
+	if !ok {
+		return fmt.Errorf("format not found")
+	}
+
+	sampleRate := time.Duration(t.codec.(*CodecMPEG4Audio).Config.SampleRate)
+
+	for i, au := range aus {
+		auPTS := pts + time.Duration(i)*mpeg4audio.SamplesPerAccessUnit*time.Second/sampleRate
+
+		err := w.writeSample(t, auPTS, auPTS, true, false, au)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WriteOpus writes an Opus frame.
+func (w *Writer) WriteOpus(forma *formats.Opus, pts time.Duration, frame []byte) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	t, ok := w.tracks[forma]
+	if !ok {
+		return fmt.Errorf("format not found")
+	}
+
+	return w.writeSample(t, pts, pts, true, false, frame)
+}
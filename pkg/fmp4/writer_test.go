@@ -0,0 +1,237 @@
+package fmp4
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/bluenviron/mediacommon/pkg/codecs/h264"
+	"github.com/bluenviron/mediacommon/pkg/codecs/mpeg4audio"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/gortsplib/v3/pkg/formats"
+	"github.com/bluenviron/gortsplib/v3/pkg/media"
+)
+
+type testTrun struct {
+	trackID   uint32
+	baseTime  uint64
+	durations []uint32
+	sync      []bool
+}
+
+func readSegment(t *testing.T, buf []byte) []testTrun {
+	boxes := walkBoxes(t, buf, "")
+	tfhds := findBoxes(boxes, "moof/traf/tfhd")
+	tfdts := findBoxes(boxes, "moof/traf/tfdt")
+	truns := findBoxes(boxes, "moof/traf/trun")
+
+	ret := make([]testTrun, len(truns))
+
+	for i, trun := range truns {
+		ret[i].trackID = binary.BigEndian.Uint32(tfhds[i].content[4:])
+		ret[i].baseTime = binary.BigEndian.Uint64(tfdts[i].content[4:])
+
+		count := int(binary.BigEndian.Uint32(trun.content[4:]))
+		for j := 0; j < count; j++ {
+			sample := trun.content[12+j*16:]
+			ret[i].durations = append(ret[i].durations, binary.BigEndian.Uint32(sample))
+			ret[i].sync = append(ret[i].sync, binary.BigEndian.Uint32(sample[8:]) == sampleFlagsSync)
+		}
+	}
+
+	return ret
+}
+
+func newTestWriter(t *testing.T) (*Writer, *formats.H264, *formats.MPEG4Audio, *[][]byte, *[][]byte) {
+	h264Forma := &formats.H264{
+		PayloadTyp:        96,
+		SPS:               testSPS,
+		PPS:               testPPS,
+		PacketizationMode: 1,
+	}
+
+	audioForma := &formats.MPEG4Audio{
+		PayloadTyp: 97,
+		Config: &mpeg4audio.Config{
+			Type:         mpeg4audio.ObjectTypeAACLC,
+			SampleRate:   48000,
+			ChannelCount: 2,
+		},
+		SizeLength:       13,
+		IndexLength:      3,
+		IndexDeltaLength: 3,
+	}
+
+	var inits [][]byte
+	var segments [][]byte
+
+	w := &Writer{
+		Medias: media.Medias{
+			{
+				Type:    media.TypeVideo,
+				Formats: []formats.Format{h264Forma},
+			},
+			{
+				Type:    media.TypeAudio,
+				Formats: []formats.Format{audioForma},
+			},
+		},
+		OnInit: func(init []byte) error {
+			inits = append(inits, init)
+			return nil
+		},
+		OnSegment: func(segment []byte) error {
+			segments = append(segments, segment)
+			return nil
+		},
+	}
+	err := w.Start()
+	require.NoError(t, err)
+
+	return w, h264Forma, audioForma, &inits, &segments
+}
+
+func TestWriter(t *testing.T) {
+	w, h264Forma, audioForma, inits, segments := newTestWriter(t)
+
+	// samples that precede the first keyframe are discarded
+	err := w.WriteMPEG4Audio(audioForma, 0, [][]byte{{0x01}})
+	require.NoError(t, err)
+
+	err = w.WriteH264(h264Forma, 0, [][]byte{{byte(h264.NALUTypeNonIDR), 0x00}})
+	require.NoError(t, err)
+
+	for i := 1; i <= 6; i++ {
+		// a keyframe every second
+		var au [][]byte
+		if (i % 2) == 1 {
+			au = [][]byte{{byte(h264.NALUTypeIDR), byte(i)}}
+		} else {
+			au = [][]byte{{byte(h264.NALUTypeNonIDR), byte(i)}}
+		}
+
+		pts := time.Duration(i) * 500 * time.Millisecond
+
+		err = w.WriteH264(h264Forma, pts, au)
+		require.NoError(t, err)
+
+		err = w.WriteMPEG4Audio(audioForma, pts, [][]byte{{0x01, byte(i)}, {0x02, byte(i)}})
+		require.NoError(t, err)
+	}
+
+	err = w.Close()
+	require.NoError(t, err)
+
+	require.Equal(t, 1, len(*inits))
+	require.Equal(t, 3, len(*segments))
+
+	require.Equal(t, []testTrun{
+		{
+			trackID:   1,
+			baseTime:  0,
+			durations: []uint32{45000, 45000},
+			sync:      []bool{true, false},
+		},
+		{
+			trackID:   2,
+			baseTime:  0,
+			durations: []uint32{1024, 22976, 1024},
+			sync:      []bool{true, true, true},
+		},
+	}, readSegment(t, (*segments)[0]))
+
+	require.Equal(t, []testTrun{
+		{
+			trackID:   1,
+			baseTime:  90000,
+			durations: []uint32{45000, 45000},
+			sync:      []bool{true, false},
+		},
+		{
+			trackID:   2,
+			baseTime:  25024,
+			durations: []uint32{22976, 1024, 22976, 1024},
+			sync:      []bool{true, true, true, true},
+		},
+	}, readSegment(t, (*segments)[1]))
+
+	// the last samples reuse the previous duration
+	require.Equal(t, []testTrun{
+		{
+			trackID:   1,
+			baseTime:  180000,
+			durations: []uint32{45000, 45000},
+			sync:      []bool{true, false},
+		},
+		{
+			trackID:   2,
+			baseTime:  73024,
+			durations: []uint32{22976, 1024, 22976, 1024, 1024},
+			sync:      []bool{true, true, true, true, true},
+		},
+	}, readSegment(t, (*segments)[2]))
+}
+
+func TestWriterParamsChange(t *testing.T) {
+	w, h264Forma, _, inits, segments := newTestWriter(t)
+
+	// SPS with a different level
+	sps2 := append([]byte(nil), testSPS...)
+	sps2[3] = 0x0d
+
+	for i, au := range [][][]byte{
+		{{byte(h264.NALUTypeIDR), 0x00}},
+		{{byte(h264.NALUTypeNonIDR), 0x01}},
+		{sps2, testPPS, {byte(h264.NALUTypeIDR), 0x02}},
+		{{byte(h264.NALUTypeNonIDR), 0x03}},
+	} {
+		err := w.WriteH264(h264Forma, time.Duration(i)*100*time.Millisecond, au)
+		require.NoError(t, err)
+	}
+
+	err := w.Close()
+	require.NoError(t, err)
+
+	// a segment is cut when parameters change, even if the segment duration is not reached
+	require.Equal(t, 2, len(*inits))
+	require.Equal(t, 2, len(*segments))
+
+	avcCs := func(init []byte) []byte {
+		boxes := walkBoxes(t, init, "")
+		stsd := findBoxes(boxes, "moov/trak/mdia/minf/stbl/stsd")[0]
+		avc1 := walkBoxes(t, stsd.content[8:], "")
+		return walkBoxes(t, avc1[0].content[78:], "")[0].content
+	}
+	require.Equal(t, byte(0x0c), avcCs((*inits)[0])[3])
+	require.Equal(t, byte(0x0d), avcCs((*inits)[1])[3])
+
+	require.Equal(t, []testTrun{{
+		trackID:   1,
+		baseTime:  0,
+		durations: []uint32{9000, 9000},
+		sync:      []bool{true, false},
+	}}, readSegment(t, (*segments)[0]))
+
+	require.Equal(t, []testTrun{{
+		trackID:   1,
+		baseTime:  18000,
+		durations: []uint32{9000, 9000},
+		sync:      []bool{true, false},
+	}}, readSegment(t, (*segments)[1]))
+}
+
+func TestWriterErrors(t *testing.T) {
+	w := &Writer{
+		Medias: media.Medias{{
+			Type:    media.TypeVideo,
+			Formats: []formats.Format{&formats.VP8{PayloadTyp: 96}},
+		}},
+	}
+	err := w.Start()
+	require.EqualError(t, err, "no supported formats found")
+
+	w, _, _, _, _ = newTestWriter(t)
+	err = w.WriteH264(&formats.H264{}, 0, [][]byte{{0x05}})
+	require.EqualError(t, err, "format not found")
+}
@@ -1,6 +1,9 @@
 package formats
 
 import (
+	"sort"
+	"strconv"
+	"strings"
 	"testing"
 
 	psdp "github.com/pion/sdp/v3"
@@ -1010,3 +1013,91 @@ func TestNewFromMediaDescriptionErrors(t *testing.T) {
 		})
 	}
 }
+
+// marshalFormat encodes a format into a media description, in the same way of media.Media.
+func marshalFormat(mediaType string, forma Format) *psdp.MediaDescription {
+	typ := strconv.FormatUint(uint64(forma.PayloadType()), 10)
+	rtpmap, fmtp := forma.Marshal()
+
+	md := &psdp.MediaDescription{
+		MediaName: psdp.MediaName{
+			Media:   mediaType,
+			Protos:  []string{"RTP", "AVP"},
+			Formats: []string{typ},
+		},
+	}
+
+	if rtpmap != "" {
+		md.Attributes = append(md.Attributes, psdp.Attribute{
+			Key:   "rtpmap",
+			Value: typ + " " + rtpmap,
+		})
+	}
+
+	if len(fmtp) != 0 {
+		keys := make([]string, 0, len(fmtp))
+		for key := range fmtp {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		tmp := make([]string, len(keys))
+		for i, key := range keys {
+			tmp[i] = key + "=" + fmtp[key]
+		}
+
+		md.Attributes = append(md.Attributes, psdp.Attribute{
+			Key:   "fmtp",
+			Value: typ + " " + strings.Join(tmp, "; "),
+		})
+	}
+
+	return md
+}
+
+func FuzzUnmarshal(f *testing.F) {
+	f.Add("video", "96", "H264/90000", "packetization-mode=1; "+
+		"sprop-parameter-sets=Z2QADKw7ULBLQgAAAwACAAADAD0I,aO48gA==; profile-level-id=64000C")
+	f.Add("video", "96", "H265/90000", "sprop-vps=QAEMAf//AWAAAAMAkAAAAwAAAwB4mZgJ; "+
+		"sprop-sps=QgEBAWAAAAMAkAAAAwAAAwB4oAPAgBDllmZpJMrgEAAAAwAQAAADAeCA; "+
+		"sprop-pps=RAHBcrRiQA==; sprop-max-don-diff=2")
+	f.Add("video", "96", "VP8/90000", "max-fr=123;max-fs=456")
+	f.Add("video", "96", "VP9/90000", "max-fr=123;max-fs=456;profile-id=789")
+	f.Add("video", "26", "", "")
+	f.Add("audio", "0", "", "")
+	f.Add("audio", "96", "mpeg4-generic/48000/2", "profile-level-id=1; mode=AAC-hbr; sizelength=13; "+
+		"indexlength=3; indexdeltalength=3; config=1190")
+	f.Add("audio", "96", "opus/48000/2", "sprop-stereo=1")
+	f.Add("audio", "96", "L24/48000/2", "")
+	f.Add("audio", "96", "vorbis/44100/2", "configuration=AQIDBA==")
+	f.Add("application", "98", "custom/90000", "")
+
+	f.Fuzz(func(t *testing.T, mediaType string, payloadType string, rtpMap string, fmtp string) {
+		md := &psdp.MediaDescription{
+			MediaName: psdp.MediaName{
+				Media:   mediaType,
+				Protos:  []string{"RTP", "AVP"},
+				Formats: []string{payloadType},
+			},
+			Attributes: []psdp.Attribute{
+				{
+					Key:   "rtpmap",
+					Value: payloadType + " " + rtpMap,
+				},
+				{
+					Key:   "fmtp",
+					Value: payloadType + " " + fmtp,
+				},
+			},
+		}
+
+		forma, err := Unmarshal(md, payloadType)
+		if err != nil {
+			return
+		}
+
+		// formats are not compared, since decoding fills default values and drops unknown parameters
+		_, err = Unmarshal(marshalFormat(mediaType, forma), payloadType)
+		require.NoError(t, err)
+	})
+}
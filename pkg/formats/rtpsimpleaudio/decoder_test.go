@@ -43,3 +43,24 @@ func TestDecode(t *testing.T) {
 		})
 	}
 }
+
+func FuzzDecoderUnmarshal(f *testing.F) {
+	d := &Decoder{
+		SampleRate: 8000,
+	}
+	d.Init()
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		d.Decode(&rtp.Packet{
+			Header: rtp.Header{
+				Version:        2,
+				Marker:         false,
+				PayloadType:    0,
+				SequenceNumber: 17645,
+				Timestamp:      2289527317,
+				SSRC:           0x9dbb7812,
+			},
+			Payload: b,
+		})
+	})
+}
@@ -33,10 +33,67 @@ func (d *Decoder) Init() {
 	d.timeDecoder = rtptime.NewDecoder(rtpClockRate)
 }
 
+// payloadDescriptorSize returns the size of the payload descriptor, as described in RFC 7741, section 4.2.
+// It returns an error when the payload is shorter than the descriptor.
+func payloadDescriptorSize(payload []byte) (int, error) {
+	if len(payload) < 1 {
+		return 0, fmt.Errorf("payload is too short")
+	}
+
+	// X bit
+	if (payload[0] & 0x80) == 0 {
+		return 1, nil
+	}
+
+	if len(payload) < 2 {
+		return 0, fmt.Errorf("payload is too short")
+	}
+
+	ext := payload[1]
+	n := 2
+
+	// I bit
+	if (ext & 0x80) != 0 {
+		if len(payload) < (n + 1) {
+			return 0, fmt.Errorf("payload is too short")
+		}
+
+		// M bit
+		if (payload[n] & 0x80) != 0 {
+			n += 2
+		} else {
+			n++
+		}
+	}
+
+	// L bit
+	if (ext & 0x40) != 0 {
+		n++
+	}
+
+	// T or K bit
+	if (ext & 0x30) != 0 {
+		n++
+	}
+
+	if len(payload) < n {
+		return 0, fmt.Errorf("payload is too short")
+	}
+
+	return n, nil
+}
+
 // Decode decodes a VP8 frame from a RTP/VP8 packet.
 func (d *Decoder) Decode(pkt *rtp.Packet) ([]byte, time.Duration, error) {
+	// VP8Packet.Unmarshal() doesn't check the size of all fields of the payload descriptor
+	_, err := payloadDescriptorSize(pkt.Payload)
+	if err != nil {
+		d.fragments = d.fragments[:0] // discard pending fragmented packets
+		return nil, 0, err
+	}
+
 	var vpkt codecs.VP8Packet
-	_, err := vpkt.Unmarshal(pkt.Payload)
+	_, err = vpkt.Unmarshal(pkt.Payload)
 	if err != nil {
 		d.fragments = d.fragments[:0] // discard pending fragmented packets
 		return nil, 0, err
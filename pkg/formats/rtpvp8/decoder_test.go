@@ -52,6 +52,60 @@ func TestDecode(t *testing.T) {
 	}
 }
 
+func TestDecodeShortPayload(t *testing.T) {
+	for _, ca := range []struct {
+		name    string
+		payload []byte
+	}{
+		{
+			"empty",
+			[]byte{},
+		},
+		{
+			"missing extension",
+			[]byte{0x90},
+		},
+		{
+			"missing picture id",
+			[]byte{0x90, 0x80},
+		},
+		{
+			"truncated 16-bit picture id",
+			[]byte{0x90, 0x80, 0x80},
+		},
+		{
+			"missing tl0picidx",
+			[]byte{0x90, 0xc0},
+		},
+		{
+			"missing tid and keyidx",
+			[]byte{0x90, 0x90},
+		},
+		{
+			"missing all fields",
+			[]byte{0x90, 0xf0, 0x80, 0x01},
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			d := &Decoder{}
+			d.Init()
+
+			_, _, err := d.Decode(&rtp.Packet{
+				Header: rtp.Header{
+					Version:        2,
+					Marker:         true,
+					PayloadType:    96,
+					SequenceNumber: 17645,
+					Timestamp:      2289527317,
+					SSRC:           0x9dbb7812,
+				},
+				Payload: ca.payload,
+			})
+			require.EqualError(t, err, "payload is too short")
+		})
+	}
+}
+
 func FuzzDecoderUnmarshal(f *testing.F) {
 	d := &Decoder{}
 	d.Init()
@@ -1,6 +1,7 @@
 package headers
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -237,3 +238,33 @@ func TestAuthenticateMarshal(t *testing.T) {
 		})
 	}
 }
+
+// authenticateHasQuotes checks whether a value contains quotes,
+// that can't be marshaled since escaping is not supported.
+func authenticateHasQuotes(h Authenticate) bool {
+	for _, v := range []*string{h.Username, h.Realm, h.Nonce, h.URI, h.Response, h.Opaque, h.Stale, h.Algorithm} {
+		if v != nil && strings.Contains(*v, "\"") {
+			return true
+		}
+	}
+	return false
+}
+
+func FuzzAuthenticateUnmarshal(f *testing.F) {
+	for _, ca := range casesAuthenticate {
+		f.Add(ca.vin[0])
+	}
+
+	f.Fuzz(func(t *testing.T, b string) {
+		var h Authenticate
+		err := h.Unmarshal(base.HeaderValue{b})
+		if err != nil || authenticateHasQuotes(h) {
+			return
+		}
+
+		var h2 Authenticate
+		err = h2.Unmarshal(h.Marshal())
+		require.NoError(t, err)
+		require.Equal(t, h, h2)
+	})
+}
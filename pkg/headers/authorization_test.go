@@ -113,3 +113,22 @@ func TestAuthorizationMarshal(t *testing.T) {
 		})
 	}
 }
+
+func FuzzAuthorizationUnmarshal(f *testing.F) {
+	for _, ca := range casesAuthorization {
+		f.Add(ca.vin[0])
+	}
+
+	f.Fuzz(func(t *testing.T, b string) {
+		var h Authorization
+		err := h.Unmarshal(base.HeaderValue{b})
+		if err != nil || authenticateHasQuotes(h.DigestValues) {
+			return
+		}
+
+		var h2 Authorization
+		err = h2.Unmarshal(h.Marshal())
+		require.NoError(t, err)
+		require.Equal(t, h, h2)
+	})
+}
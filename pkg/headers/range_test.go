@@ -270,3 +270,22 @@ func TestRangeMarshal(t *testing.T) {
 		})
 	}
 }
+
+func FuzzRangeUnmarshal(f *testing.F) {
+	for _, ca := range casesRange {
+		f.Add(ca.vin[0])
+	}
+
+	f.Fuzz(func(t *testing.T, b string) {
+		var h Range
+		err := h.Unmarshal(base.HeaderValue{b})
+		if err != nil {
+			return
+		}
+
+		var h2 Range
+		err = h2.Unmarshal(h.Marshal())
+		require.NoError(t, err)
+		require.Equal(t, h, h2)
+	})
+}
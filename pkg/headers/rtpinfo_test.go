@@ -237,3 +237,22 @@ func TestRTPInfoMarshal(t *testing.T) {
 		})
 	}
 }
+
+func FuzzRTPInfoUnmarshal(f *testing.F) {
+	for _, ca := range casesRTPInfo {
+		f.Add(ca.vin[0])
+	}
+
+	f.Fuzz(func(t *testing.T, b string) {
+		var h RTPInfo
+		err := h.Unmarshal(base.HeaderValue{b})
+		if err != nil {
+			return
+		}
+
+		var h2 RTPInfo
+		err = h2.Unmarshal(h.Marshal())
+		require.NoError(t, err)
+		require.Equal(t, h, h2)
+	})
+}
@@ -0,0 +1,54 @@
+package headers
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/bluenviron/gortsplib/v3/pkg/base"
+)
+
+func unmarshalRate(v base.HeaderValue) (float64, error) {
+	if len(v) == 0 {
+		return 0, fmt.Errorf("value not provided")
+	}
+
+	if len(v) > 1 {
+		return 0, fmt.Errorf("value provided multiple times (%v)", v)
+	}
+
+	return strconv.ParseFloat(strings.TrimSpace(v[0]), 64)
+}
+
+func marshalRate(v float64) base.HeaderValue {
+	return base.HeaderValue{strconv.FormatFloat(v, 'f', -1, 64)}
+}
+
+// Scale is a Scale header.
+// It contains the ratio between the playback speed and the normal speed.
+// Negative values mean reverse playback.
+type Scale struct {
+	// ratio between the playback speed and the normal speed.
+	Value float64
+}
+
+// Unmarshal decodes a Scale header.
+func (h *Scale) Unmarshal(v base.HeaderValue) error {
+	f, err := unmarshalRate(v)
+	if err != nil {
+		return err
+	}
+
+	if f == 0 || math.IsNaN(f) || math.IsInf(f, 0) {
+		return fmt.Errorf("invalid scale (%v)", v[0])
+	}
+
+	h.Value = f
+	return nil
+}
+
+// Marshal encodes a Scale header.
+func (h Scale) Marshal() base.HeaderValue {
+	return marshalRate(h.Value)
+}
@@ -0,0 +1,138 @@
+package headers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/gortsplib/v3/pkg/base"
+)
+
+var casesScale = []struct {
+	name string
+	vin  base.HeaderValue
+	vout base.HeaderValue
+	h    Scale
+}{
+	{
+		"integer",
+		base.HeaderValue{`2`},
+		base.HeaderValue{`2`},
+		Scale{
+			Value: 2,
+		},
+	},
+	{
+		"decimal",
+		base.HeaderValue{`1.0`},
+		base.HeaderValue{`1`},
+		Scale{
+			Value: 1,
+		},
+	},
+	{
+		"fraction",
+		base.HeaderValue{` 0.5`},
+		base.HeaderValue{`0.5`},
+		Scale{
+			Value: 0.5,
+		},
+	},
+	{
+		"reverse",
+		base.HeaderValue{`-1`},
+		base.HeaderValue{`-1`},
+		Scale{
+			Value: -1,
+		},
+	},
+}
+
+func TestScaleUnmarshal(t *testing.T) {
+	for _, ca := range casesScale {
+		t.Run(ca.name, func(t *testing.T) {
+			var h Scale
+			err := h.Unmarshal(ca.vin)
+			require.NoError(t, err)
+			require.Equal(t, ca.h, h)
+		})
+	}
+}
+
+func TestScaleUnmarshalErrors(t *testing.T) {
+	for _, ca := range []struct {
+		name string
+		hv   base.HeaderValue
+		err  string
+	}{
+		{
+			"empty",
+			base.HeaderValue{},
+			"value not provided",
+		},
+		{
+			"2 values",
+			base.HeaderValue{"a", "b"},
+			"value provided multiple times ([a b])",
+		},
+		{
+			"invalid",
+			base.HeaderValue{"aaa"},
+			"strconv.ParseFloat: parsing \"aaa\": invalid syntax",
+		},
+		{
+			"zero",
+			base.HeaderValue{"0"},
+			"invalid scale (0)",
+		},
+		{
+			"nan",
+			base.HeaderValue{"NaN"},
+			"invalid scale (NaN)",
+		},
+		{
+			"infinite",
+			base.HeaderValue{"Inf"},
+			"invalid scale (Inf)",
+		},
+		{
+			"negative infinite",
+			base.HeaderValue{"-Inf"},
+			"invalid scale (-Inf)",
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			var h Scale
+			err := h.Unmarshal(ca.hv)
+			require.EqualError(t, err, ca.err)
+		})
+	}
+}
+
+func TestScaleMarshal(t *testing.T) {
+	for _, ca := range casesScale {
+		t.Run(ca.name, func(t *testing.T) {
+			req := ca.h.Marshal()
+			require.Equal(t, ca.vout, req)
+		})
+	}
+}
+
+func FuzzScaleUnmarshal(f *testing.F) {
+	for _, ca := range casesScale {
+		f.Add(ca.vin[0])
+	}
+
+	f.Fuzz(func(t *testing.T, b string) {
+		var h Scale
+		err := h.Unmarshal(base.HeaderValue{b})
+		if err != nil {
+			return
+		}
+
+		var h2 Scale
+		err = h2.Unmarshal(h.Marshal())
+		require.NoError(t, err)
+		require.Equal(t, h, h2)
+	})
+}
@@ -102,3 +102,22 @@ func TestSessionMarshal(t *testing.T) {
 		})
 	}
 }
+
+func FuzzSessionUnmarshal(f *testing.F) {
+	for _, ca := range casesSession {
+		f.Add(ca.vin[0])
+	}
+
+	f.Fuzz(func(t *testing.T, b string) {
+		var h Session
+		err := h.Unmarshal(base.HeaderValue{b})
+		if err != nil {
+			return
+		}
+
+		var h2 Session
+		err = h2.Unmarshal(h.Marshal())
+		require.NoError(t, err)
+		require.Equal(t, h, h2)
+	})
+}
@@ -0,0 +1,36 @@
+package headers
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/bluenviron/gortsplib/v3/pkg/base"
+)
+
+// Speed is a Speed header.
+// It contains the ratio between the delivery speed and the normal speed.
+// Unlike Scale, it doesn't change the playback speed.
+type Speed struct {
+	// ratio between the delivery speed and the normal speed.
+	Value float64
+}
+
+// Unmarshal decodes a Speed header.
+func (h *Speed) Unmarshal(v base.HeaderValue) error {
+	f, err := unmarshalRate(v)
+	if err != nil {
+		return err
+	}
+
+	if f <= 0 || math.IsNaN(f) || math.IsInf(f, 0) {
+		return fmt.Errorf("invalid speed (%v)", v[0])
+	}
+
+	h.Value = f
+	return nil
+}
+
+// Marshal encodes a Speed header.
+func (h Speed) Marshal() base.HeaderValue {
+	return marshalRate(h.Value)
+}
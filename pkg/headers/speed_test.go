@@ -0,0 +1,130 @@
+package headers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/gortsplib/v3/pkg/base"
+)
+
+var casesSpeed = []struct {
+	name string
+	vin  base.HeaderValue
+	vout base.HeaderValue
+	h    Speed
+}{
+	{
+		"integer",
+		base.HeaderValue{`2`},
+		base.HeaderValue{`2`},
+		Speed{
+			Value: 2,
+		},
+	},
+	{
+		"decimal",
+		base.HeaderValue{`1.0`},
+		base.HeaderValue{`1`},
+		Speed{
+			Value: 1,
+		},
+	},
+	{
+		"fraction",
+		base.HeaderValue{` 0.5`},
+		base.HeaderValue{`0.5`},
+		Speed{
+			Value: 0.5,
+		},
+	},
+}
+
+func TestSpeedUnmarshal(t *testing.T) {
+	for _, ca := range casesSpeed {
+		t.Run(ca.name, func(t *testing.T) {
+			var h Speed
+			err := h.Unmarshal(ca.vin)
+			require.NoError(t, err)
+			require.Equal(t, ca.h, h)
+		})
+	}
+}
+
+func TestSpeedUnmarshalErrors(t *testing.T) {
+	for _, ca := range []struct {
+		name string
+		hv   base.HeaderValue
+		err  string
+	}{
+		{
+			"empty",
+			base.HeaderValue{},
+			"value not provided",
+		},
+		{
+			"2 values",
+			base.HeaderValue{"a", "b"},
+			"value provided multiple times ([a b])",
+		},
+		{
+			"invalid",
+			base.HeaderValue{"aaa"},
+			"strconv.ParseFloat: parsing \"aaa\": invalid syntax",
+		},
+		{
+			"zero",
+			base.HeaderValue{"0"},
+			"invalid speed (0)",
+		},
+		{
+			"negative",
+			base.HeaderValue{"-1"},
+			"invalid speed (-1)",
+		},
+		{
+			"nan",
+			base.HeaderValue{"NaN"},
+			"invalid speed (NaN)",
+		},
+		{
+			"infinite",
+			base.HeaderValue{"+Inf"},
+			"invalid speed (+Inf)",
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			var h Speed
+			err := h.Unmarshal(ca.hv)
+			require.EqualError(t, err, ca.err)
+		})
+	}
+}
+
+func TestSpeedMarshal(t *testing.T) {
+	for _, ca := range casesSpeed {
+		t.Run(ca.name, func(t *testing.T) {
+			req := ca.h.Marshal()
+			require.Equal(t, ca.vout, req)
+		})
+	}
+}
+
+func FuzzSpeedUnmarshal(f *testing.F) {
+	for _, ca := range casesSpeed {
+		f.Add(ca.vin[0])
+	}
+
+	f.Fuzz(func(t *testing.T, b string) {
+		var h Speed
+		err := h.Unmarshal(base.HeaderValue{b})
+		if err != nil {
+			return
+		}
+
+		var h2 Speed
+		err = h2.Unmarshal(h.Marshal())
+		require.NoError(t, err)
+		require.Equal(t, h, h2)
+	})
+}
@@ -0,0 +1,480 @@
+// Package hls contains a HLS muxer, that converts media streams into
+// HLS and Low-Latency HLS streams and serves them through HTTP.
+package hls
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/pion/rtp"
+
+	"github.com/bluenviron/gortsplib/v3"
+	"github.com/bluenviron/gortsplib/v3/pkg/fmp4"
+	"github.com/bluenviron/gortsplib/v3/pkg/formats"
+	"github.com/bluenviron/gortsplib/v3/pkg/media"
+	"github.com/bluenviron/gortsplib/v3/pkg/mpegtsrecorder"
+	"github.com/bluenviron/gortsplib/v3/pkg/rtptime"
+)
+
+var timeNow = time.Now
+
+// Variant is a HLS variant.
+type Variant int
+
+// variants.
+const (
+	// segments are MPEG-TS files.
+	// Supported formats are H264, H265 and MPEG-4 Audio (AAC).
+	VariantMPEGTS Variant = iota
+
+	// segments are fragmented MP4 files.
+	// Supported formats are H264, H265, MPEG-4 Audio (AAC) and Opus.
+	VariantFMP4
+
+	// segments are fragmented MP4 files, split into partial segments,
+	// that are advertised in playlists as soon as they are available.
+	// Clients can request playlists that are not yet available, and are
+	// served as soon as they are (blocking playlist reload).
+	VariantLowLatency
+)
+
+// String implements fmt.Stringer.
+func (v Variant) String() string {
+	switch v {
+	case VariantMPEGTS:
+		return "mpegts"
+	case VariantFMP4:
+		return "fmp4"
+	case VariantLowLatency:
+		return "lowLatency"
+	}
+	return "unknown"
+}
+
+// Muxer converts media streams into a HLS stream.
+// It implements http.Handler, and serves:
+//   - the multivariant playlist (index.m3u8);
+//   - the media playlist (stream.m3u8);
+//   - initialization segments, segments and partial segments.
+//
+// Segments are kept in memory.
+// Formats that are not supported by the chosen variant are ignored.
+type Muxer struct {
+	//
+	// parameters (all optional except Medias)
+	//
+	// medias to mux.
+	Medias media.Medias
+	// variant.
+	// It defaults to VariantMPEGTS.
+	Variant Variant
+	// number of segments listed in the media playlist.
+	// It defaults to 7.
+	SegmentCount int
+	// minimum duration of segments.
+	// A segment is completed when this duration is reached and a keyframe is received
+	// (or when an audio frame is received when there are no video tracks).
+	// It defaults to 1 second.
+	SegmentDuration time.Duration
+	// minimum duration of partial segments.
+	// It is used with VariantLowLatency only.
+	// It defaults to 200 milliseconds.
+	PartDuration time.Duration
+
+	//
+	// callbacks (all optional)
+	//
+	// called when a packet cannot be processed.
+	OnError func(err error)
+
+	mutex        sync.Mutex
+	tracks       map[formats.Format]*muxerTrack
+	trackList    []*muxerTrack
+	leading      *muxerTrack
+	timeDec      *rtptime.GlobalDecoder
+	started      bool
+	startDTS     time.Duration
+	mpegts       *mpegtsrecorder.Writer
+	inits        map[uint64][]byte
+	nextInitID   uint64
+	segments     []*muxerSegment
+	curSegment   *muxerSegment
+	nextSegID    uint64
+	parts        map[uint64]*muxerPart
+	curPartStart time.Duration
+	nextPartID   uint64
+	changed      chan struct{}
+	closed       bool
+}
+
+// Start initializes the muxer.
+// The stream is available when the first segment is completed.
+func (m *Muxer) Start() error {
+	if m.SegmentCount == 0 {
+		m.SegmentCount = 7
+	}
+	if m.SegmentDuration == 0 {
+		m.SegmentDuration = 1 * time.Second
+	}
+	if m.PartDuration == 0 {
+		m.PartDuration = 200 * time.Millisecond
+	}
+	if m.OnError == nil {
+		m.OnError = func(error) {}
+	}
+
+	if m.SegmentCount < 2 {
+		return fmt.Errorf("SegmentCount must be at least 2")
+	}
+
+	m.tracks = make(map[formats.Format]*muxerTrack)
+
+	for _, medi := range m.Medias {
+		for _, forma := range medi.Formats {
+			t := newMuxerTrack(m, len(m.trackList)+1, forma)
+			if t == nil {
+				continue
+			}
+
+			m.tracks[forma] = t
+			m.trackList = append(m.trackList, t)
+
+			if t.isVideo && m.leading == nil {
+				m.leading = t
+			}
+		}
+	}
+
+	if len(m.trackList) == 0 {
+		return fmt.Errorf("no supported formats found")
+	}
+
+	// segments are cut on the first track when there are no video tracks
+	if m.leading == nil {
+		m.leading = m.trackList[0]
+	}
+
+	if m.Variant == VariantMPEGTS {
+		writerTracks := make([]*mpegtsrecorder.WriterTrack, len(m.trackList))
+		for i, t := range m.trackList {
+			writerTracks[i] = t.wt
+		}
+
+		var err error
+		m.mpegts, err = mpegtsrecorder.NewWriter(io.Discard, writerTracks)
+		if err != nil {
+			return err
+		}
+	}
+
+	m.timeDec = rtptime.NewGlobalDecoder(timeNow())
+	m.inits = make(map[uint64][]byte)
+	m.parts = make(map[uint64]*muxerPart)
+	m.changed = make(chan struct{})
+
+	return nil
+}
+
+// Close closes the muxer.
+// Pending HTTP requests are terminated.
+func (m *Muxer) Close() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.closed {
+		return
+	}
+
+	m.closed = true
+	close(m.changed)
+}
+
+// Attach routes the RTP packets of a source into the muxer.
+func (m *Muxer) Attach(src gortsplib.PacketSource) {
+	for _, medi := range m.Medias {
+		for _, forma := range medi.Formats {
+			if _, ok := m.tracks[forma]; !ok {
+				continue
+			}
+
+			cmedi := medi
+			cforma := forma
+			src.OnPacketRTP(medi, forma, func(pkt *rtp.Packet) {
+				err := m.WritePacketRTP(cmedi, cforma, pkt)
+				if err != nil {
+					m.OnError(err)
+				}
+			})
+		}
+	}
+}
+
+// WritePacketRTP writes a RTP packet.
+func (m *Muxer) WritePacketRTP(medi *media.Media, forma formats.Format, pkt *rtp.Packet) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.closed {
+		return nil
+	}
+
+	t, ok := m.tracks[forma]
+	if !ok {
+		return nil
+	}
+
+	return t.writePacketRTP(pkt, timeNow())
+}
+
+// notify wakes up pending HTTP requests.
+func (m *Muxer) notify() {
+	close(m.changed)
+	m.changed = make(chan struct{})
+}
+
+// waitUntil waits until a condition is true.
+// It must be called with the mutex locked.
+func (m *Muxer) waitUntil(ctx context.Context, cond func() bool) bool {
+	for !cond() {
+		if m.closed {
+			return false
+		}
+
+		ch := m.changed
+		m.mutex.Unlock()
+
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			m.mutex.Lock()
+			return false
+		}
+
+		m.mutex.Lock()
+	}
+
+	return true
+}
+
+func (m *Muxer) allReady() bool {
+	for _, t := range m.trackList {
+		if !t.ready() {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *Muxer) writeInit() error {
+	init := &fmp4.Init{}
+
+	for _, t := range m.trackList {
+		init.Tracks = append(init.Tracks, &fmp4.InitTrack{
+			ID:        t.id,
+			TimeScale: t.timeScale,
+			Codec:     t.fmp4Codec(),
+		})
+	}
+
+	buf, err := init.Marshal()
+	if err != nil {
+		return err
+	}
+
+	m.inits[m.nextInitID] = buf
+	m.nextInitID++
+
+	return nil
+}
+
+func (m *Muxer) paramsChanged() bool {
+	for _, t := range m.trackList {
+		if t.paramsChanged {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Muxer) startSegment(dts time.Duration) error {
+	m.curSegment = &muxerSegment{
+		id:       m.nextSegID,
+		startDTS: dts,
+	}
+	m.nextSegID++
+
+	if m.Variant == VariantMPEGTS {
+		m.curSegment.ext = ".ts"
+		return m.mpegts.SetOutput(&m.curSegment.buf)
+	}
+
+	m.curSegment.ext = ".mp4"
+	m.curSegment.initID = m.nextInitID - 1
+	m.curPartStart = dts
+	return nil
+}
+
+func (m *Muxer) completePart(endDTS time.Duration) error {
+	independent := false
+	if len(m.leading.samples) != 0 {
+		independent = !m.leading.samples[0].IsNonSyncSample
+	}
+
+	content, err := marshalPart(uint32(m.nextPartID), m.trackList)
+	if err != nil {
+		return err
+	}
+
+	part := &muxerPart{
+		id:          m.nextPartID,
+		startDTS:    m.curPartStart,
+		duration:    endDTS - m.curPartStart,
+		independent: independent,
+		content:     content,
+	}
+	m.nextPartID++
+
+	m.parts[part.id] = part
+	m.curSegment.parts = append(m.curSegment.parts, part)
+	m.curSegment.buf.Write(content)
+	m.curPartStart = endDTS
+
+	return nil
+}
+
+func (m *Muxer) completeSegment(endDTS time.Duration) {
+	m.curSegment.duration = endDTS - m.curSegment.startDTS
+	m.segments = append(m.segments, m.curSegment)
+	m.curSegment = nil
+
+	// segments are kept for a little longer than the time they are listed,
+	// in order to allow clients to download them.
+	for len(m.segments) > m.SegmentCount+1 {
+		for _, p := range m.segments[0].parts {
+			delete(m.parts, p.id)
+		}
+		if len(m.segments) > 1 && m.segments[1].initID != m.segments[0].initID {
+			delete(m.inits, m.segments[0].initID)
+		}
+		m.segments = m.segments[1:]
+	}
+}
+
+func (m *Muxer) writeSample(t *muxerTrack, s *muxerSample) error {
+	if !m.started {
+		if t != m.leading || !s.isSync || !m.allReady() {
+			return nil
+		}
+
+		m.started = true
+		m.startDTS = s.dts
+
+		if m.Variant != VariantMPEGTS {
+			err := m.writeInit()
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, ot := range m.trackList {
+			ot.paramsChanged = false
+		}
+
+		err := m.startSegment(0)
+		if err != nil {
+			return err
+		}
+	}
+
+	// discard samples that precede the first segment
+	if s.dts < m.startDTS {
+		return nil
+	}
+
+	s.dts -= m.startDTS
+	s.pts -= m.startDTS
+
+	if m.Variant == VariantMPEGTS {
+		return m.writeSampleMPEGTS(t, s)
+	}
+
+	return m.writeSampleFMP4(t, s)
+}
+
+func (m *Muxer) writeSampleMPEGTS(t *muxerTrack, s *muxerSample) error {
+	if t == m.leading && s.isSync && (s.dts-m.curSegment.startDTS) >= m.SegmentDuration {
+		m.completeSegment(s.dts)
+
+		err := m.startSegment(s.dts)
+		if err != nil {
+			return err
+		}
+
+		m.notify()
+	}
+
+	return t.writeMPEGTS(m.mpegts, s)
+}
+
+func (m *Muxer) writeSampleFMP4(t *muxerTrack, s *muxerSample) error {
+	payload, err := t.fmp4Payload(s)
+	if err != nil {
+		return err
+	}
+
+	sample := &fmp4Sample{
+		isSync:   s.isSync,
+		payload:  payload,
+		dtsTicks: durationToTicks(s.dts, t.timeScale),
+	}
+	sample.ptsOffset = int32(durationToTicks(s.pts, t.timeScale) - sample.dtsTicks)
+
+	t.push(sample.dtsTicks)
+
+	if t == m.leading {
+		paramsChanged := s.isSync && m.paramsChanged()
+
+		switch {
+		case paramsChanged || s.isSync && (s.dts-m.curSegment.startDTS) >= m.SegmentDuration:
+			err := m.completePart(s.dts)
+			if err != nil {
+				return err
+			}
+
+			m.completeSegment(s.dts)
+
+			if paramsChanged {
+				for _, ot := range m.trackList {
+					ot.paramsChanged = false
+				}
+
+				err = m.writeInit()
+				if err != nil {
+					return err
+				}
+			}
+
+			err = m.startSegment(s.dts)
+			if err != nil {
+				return err
+			}
+
+			m.notify()
+
+		case m.Variant == VariantLowLatency && (s.dts-m.curPartStart) >= m.PartDuration:
+			err := m.completePart(s.dts)
+			if err != nil {
+				return err
+			}
+
+			m.notify()
+		}
+	}
+
+	t.pending = sample
+
+	return nil
+}
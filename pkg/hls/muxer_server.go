@@ -0,0 +1,178 @@
+package hls
+
+import (
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+type response struct {
+	status      int
+	contentType string
+	body        []byte
+}
+
+func parseUint(s string, prefix string, suffix string) (uint64, bool) {
+	if !strings.HasPrefix(s, prefix) || !strings.HasSuffix(s, suffix) {
+		return 0, false
+	}
+
+	v, err := strconv.ParseUint(s[len(prefix):len(s)-len(suffix)], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return v, true
+}
+
+// ServeHTTP implements http.Handler.
+// Files are served by their base name, therefore the handler can be mounted
+// under any path, for instance with http.StripPrefix.
+func (m *Muxer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := path.Base(r.URL.Path)
+
+	// the response is computed with the mutex locked and written after unlocking it,
+	// in order not to block the muxer when clients are slow.
+	m.mutex.Lock()
+	var res response
+	switch {
+	case name == "index.m3u8":
+		res = m.serveMultivariantPlaylist(r)
+
+	case name == "stream.m3u8":
+		res = m.serveMediaPlaylist(r)
+
+	default:
+		res = m.serveFile(r, name)
+	}
+	m.mutex.Unlock()
+
+	if res.contentType != "" {
+		w.Header().Set("Content-Type", res.contentType)
+	}
+	w.WriteHeader(res.status)
+
+	if r.Method == http.MethodGet {
+		w.Write(res.body)
+	}
+}
+
+func (m *Muxer) serveMultivariantPlaylist(r *http.Request) response {
+	// wait until the first segment is available, since the bandwidth is computed from it
+	if !m.waitUntil(r.Context(), func() bool { return len(m.segments) != 0 }) {
+		return response{status: http.StatusNotFound}
+	}
+
+	return response{
+		status:      http.StatusOK,
+		contentType: "application/vnd.apple.mpegurl",
+		body:        m.multivariantPlaylist(),
+	}
+}
+
+func (m *Muxer) serveMediaPlaylist(r *http.Request) response {
+	if !m.waitUntil(r.Context(), func() bool { return len(m.segments) != 0 }) {
+		return response{status: http.StatusNotFound}
+	}
+
+	if m.Variant == VariantLowLatency {
+		q := r.URL.Query()
+
+		if msnStr := q.Get("_HLS_msn"); msnStr != "" {
+			msn, err := strconv.ParseUint(msnStr, 10, 64)
+			if err != nil {
+				return response{status: http.StatusBadRequest}
+			}
+
+			hasPart := false
+			var part uint64
+
+			if partStr := q.Get("_HLS_part"); partStr != "" {
+				part, err = strconv.ParseUint(partStr, 10, 64)
+				if err != nil {
+					return response{status: http.StatusBadRequest}
+				}
+				hasPart = true
+			}
+
+			// requests that are too far in the future are rejected
+			if msn > m.curSegment.id+1 {
+				return response{status: http.StatusBadRequest}
+			}
+
+			ok := m.waitUntil(r.Context(), func() bool {
+				if msn < m.curSegment.id {
+					return true
+				}
+				return hasPart && msn == m.curSegment.id && uint64(len(m.curSegment.parts)) > part
+			})
+			if !ok {
+				return response{status: http.StatusNotFound}
+			}
+		}
+	}
+
+	return response{
+		status:      http.StatusOK,
+		contentType: "application/vnd.apple.mpegurl",
+		body:        m.mediaPlaylist(),
+	}
+}
+
+func (m *Muxer) serveFile(r *http.Request, name string) response {
+	if id, ok := parseUint(name, "init", ".mp4"); ok {
+		content, ok := m.inits[id]
+		if !ok {
+			return response{status: http.StatusNotFound}
+		}
+
+		return response{
+			status:      http.StatusOK,
+			contentType: "video/mp4",
+			body:        content,
+		}
+	}
+
+	if id, ok := parseUint(name, "part", ".mp4"); ok && m.Variant == VariantLowLatency {
+		// the next partial segment is advertised with a preload hint
+		// and is served as soon as it is available.
+		if id == m.nextPartID {
+			if !m.waitUntil(r.Context(), func() bool { return m.nextPartID > id }) {
+				return response{status: http.StatusNotFound}
+			}
+		}
+
+		part, ok := m.parts[id]
+		if !ok {
+			return response{status: http.StatusNotFound}
+		}
+
+		return response{
+			status:      http.StatusOK,
+			contentType: "video/mp4",
+			body:        part.content,
+		}
+	}
+
+	for _, seg := range m.segments {
+		if seg.name() == name {
+			res := response{
+				status:      http.StatusOK,
+				contentType: "video/mp4",
+				body:        seg.buf.Bytes(),
+			}
+			if m.Variant == VariantMPEGTS {
+				res.contentType = "video/MP2T"
+			}
+			return res
+		}
+	}
+
+	return response{status: http.StatusNotFound}
+}
@@ -0,0 +1,417 @@
+package hls
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bluenviron/mediacommon/pkg/codecs/h264"
+	"github.com/bluenviron/mediacommon/pkg/codecs/mpeg4audio"
+	"github.com/pion/rtp"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/gortsplib/v3/pkg/formats"
+	"github.com/bluenviron/gortsplib/v3/pkg/media"
+)
+
+var (
+	testSPS = []byte{
+		0x67, 0x64, 0x00, 0x0c, 0xac, 0x3b, 0x50, 0xb0,
+		0x4b, 0x42, 0x00, 0x00, 0x03, 0x00, 0x02, 0x00,
+		0x00, 0x03, 0x00, 0x3d, 0x08,
+	}
+
+	testPPS = []byte{0x68, 0xee, 0x3c, 0x80}
+
+	testH265SPS = []byte{
+		0x42, 0x01, 0x01, 0x01, 0x60, 0x00, 0x00, 0x03,
+		0x00, 0x90, 0x00, 0x00, 0x03, 0x00, 0x00, 0x03,
+		0x00, 0x78, 0xa0, 0x03, 0xc0, 0x80, 0x10, 0xe5,
+		0x96, 0x66, 0x69, 0x24, 0xca, 0xe0, 0x10, 0x00,
+		0x00, 0x03, 0x00, 0x10, 0x00, 0x00, 0x03, 0x01,
+		0xe0, 0x80,
+	}
+)
+
+type testSource struct {
+	cbs map[formats.Format]func(*rtp.Packet)
+}
+
+func (s *testSource) OnPacketRTP(medi *media.Media, forma formats.Format, cb func(*rtp.Packet)) {
+	s.cbs[forma] = cb
+}
+
+func setTimeNow(t *testing.T, now *time.Time) {
+	timeNow = func() time.Time { return *now }
+	t.Cleanup(func() { timeNow = time.Now })
+}
+
+type testStream struct {
+	t          *testing.T
+	src        *testSource
+	now        *time.Time
+	h264Forma  *formats.H264
+	audioForma *formats.MPEG4Audio
+	h264Enc    interface {
+		Encode([][]byte, time.Duration) ([]*rtp.Packet, error)
+	}
+	audioEnc interface {
+		Encode([][]byte, time.Duration) ([]*rtp.Packet, error)
+	}
+	count int
+}
+
+func newTestStream(t *testing.T, now *time.Time) (*testStream, media.Medias) {
+	h264Forma := &formats.H264{
+		PayloadTyp:        96,
+		SPS:               testSPS,
+		PPS:               testPPS,
+		PacketizationMode: 1,
+	}
+
+	audioForma := &formats.MPEG4Audio{
+		PayloadTyp: 97,
+		Config: &mpeg4audio.Config{
+			Type:         mpeg4audio.ObjectTypeAACLC,
+			SampleRate:   48000,
+			ChannelCount: 2,
+		},
+		SizeLength:       13,
+		IndexLength:      3,
+		IndexDeltaLength: 3,
+	}
+
+	return &testStream{
+		t:          t,
+		src:        &testSource{cbs: make(map[formats.Format]func(*rtp.Packet))},
+		now:        now,
+		h264Forma:  h264Forma,
+		audioForma: audioForma,
+		h264Enc:    h264Forma.CreateEncoder(),
+		audioEnc:   audioForma.CreateEncoder(),
+	}, media.Medias{
+		{
+			Type:    media.TypeVideo,
+			Formats: []formats.Format{h264Forma},
+		},
+		{
+			Type:    media.TypeAudio,
+			Formats: []formats.Format{audioForma},
+		},
+	}
+}
+
+// write writes video frames every 100ms, with a keyframe every second,
+// and an audio frame after every video frame.
+func (s *testStream) write(count int) {
+	for j := 0; j < count; j++ {
+		i := s.count
+		s.count++
+
+		var nalus [][]byte
+		if (i % 10) == 0 {
+			nalus = [][]byte{testSPS, testPPS, {byte(h264.NALUTypeIDR), byte(i)}}
+		} else {
+			nalus = [][]byte{{byte(h264.NALUTypeNonIDR), byte(i)}}
+		}
+
+		pts := time.Duration(i) * 100 * time.Millisecond
+
+		pkts, err := s.h264Enc.Encode(nalus, pts)
+		require.NoError(s.t, err)
+		for _, pkt := range pkts {
+			s.src.cbs[s.h264Forma](pkt)
+		}
+
+		pkts, err = s.audioEnc.Encode([][]byte{{0x01, 0x02, byte(i)}}, pts)
+		require.NoError(s.t, err)
+		for _, pkt := range pkts {
+			s.src.cbs[s.audioForma](pkt)
+		}
+
+		*s.now = s.now.Add(100 * time.Millisecond)
+	}
+}
+
+func doGet(t *testing.T, m *Muxer, path string) (int, string, []byte) {
+	return doGetWithContext(context.Background(), t, m, path)
+}
+
+func doGetWithContext(ctx context.Context, t *testing.T, m *Muxer, path string) (int, string, []byte) {
+	req := httptest.NewRequest(http.MethodGet, path, nil).WithContext(ctx)
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, req)
+
+	res := rec.Result()
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+
+	return res.StatusCode, res.Header.Get("Content-Type"), body
+}
+
+func TestMuxerMPEGTS(t *testing.T) {
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	setTimeNow(t, &now)
+
+	s, medias := newTestStream(t, &now)
+
+	m := &Muxer{
+		Medias:       medias,
+		Variant:      VariantMPEGTS,
+		SegmentCount: 2,
+	}
+	err := m.Start()
+	require.NoError(t, err)
+	defer m.Close()
+
+	m.Attach(s.src)
+	s.write(41)
+
+	code, typ, body := doGet(t, m, "/mystream/index.m3u8")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "application/vnd.apple.mpegurl", typ)
+	require.Regexp(t, "^#EXTM3U\n"+
+		"#EXT-X-VERSION:3\n"+
+		"#EXT-X-INDEPENDENT-SEGMENTS\n"+
+		"\n"+
+		"#EXT-X-STREAM-INF:BANDWIDTH=[0-9]+,CODECS=\"avc1.64000c,mp4a.40.2\"\n"+
+		"stream.m3u8\n$", string(body))
+
+	code, _, body = doGet(t, m, "/mystream/stream.m3u8")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "#EXTM3U\n"+
+		"#EXT-X-VERSION:3\n"+
+		"#EXT-X-TARGETDURATION:1\n"+
+		"#EXT-X-MEDIA-SEQUENCE:2\n"+
+		"\n"+
+		"#EXTINF:1.00000,\n"+
+		"seg2.ts\n"+
+		"\n"+
+		"#EXTINF:1.00000,\n"+
+		"seg3.ts\n", string(body))
+
+	code, typ, body = doGet(t, m, "/mystream/seg3.ts")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "video/MP2T", typ)
+	require.Equal(t, 0, len(body)%188)
+	require.Equal(t, byte(0x47), body[0])
+
+	// segments that are not listed anymore are kept for a while
+	code, _, _ = doGet(t, m, "/mystream/seg1.ts")
+	require.Equal(t, http.StatusOK, code)
+
+	code, _, _ = doGet(t, m, "/mystream/seg0.ts")
+	require.Equal(t, http.StatusNotFound, code)
+}
+
+func TestMuxerFMP4(t *testing.T) {
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	setTimeNow(t, &now)
+
+	s, medias := newTestStream(t, &now)
+
+	m := &Muxer{
+		Medias:  medias,
+		Variant: VariantFMP4,
+	}
+	err := m.Start()
+	require.NoError(t, err)
+	defer m.Close()
+
+	m.Attach(s.src)
+	s.write(21)
+
+	code, _, body := doGet(t, m, "/stream.m3u8")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "#EXTM3U\n"+
+		"#EXT-X-VERSION:7\n"+
+		"#EXT-X-TARGETDURATION:1\n"+
+		"#EXT-X-MEDIA-SEQUENCE:0\n"+
+		"#EXT-X-INDEPENDENT-SEGMENTS\n"+
+		"\n"+
+		"#EXT-X-MAP:URI=\"init0.mp4\"\n"+
+		"\n"+
+		"#EXTINF:1.00000,\n"+
+		"seg0.mp4\n"+
+		"\n"+
+		"#EXTINF:1.00000,\n"+
+		"seg1.mp4\n", string(body))
+
+	code, typ, body := doGet(t, m, "/init0.mp4")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "video/mp4", typ)
+	require.Equal(t, "ftyp", string(body[4:8]))
+
+	code, typ, body = doGet(t, m, "/seg1.mp4")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "video/mp4", typ)
+	require.Equal(t, "moof", string(body[4:8]))
+
+	// partial segments are not served
+	code, _, _ = doGet(t, m, "/part0.mp4")
+	require.Equal(t, http.StatusNotFound, code)
+}
+
+func TestMuxerLowLatency(t *testing.T) {
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	setTimeNow(t, &now)
+
+	s, medias := newTestStream(t, &now)
+
+	m := &Muxer{
+		Medias:       medias,
+		Variant:      VariantLowLatency,
+		PartDuration: 500 * time.Millisecond,
+	}
+	err := m.Start()
+	require.NoError(t, err)
+	defer m.Close()
+
+	m.Attach(s.src)
+	s.write(17)
+
+	code, _, body := doGet(t, m, "/stream.m3u8")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "#EXTM3U\n"+
+		"#EXT-X-VERSION:9\n"+
+		"#EXT-X-TARGETDURATION:1\n"+
+		"#EXT-X-SERVER-CONTROL:CAN-BLOCK-RELOAD=YES,PART-HOLD-BACK=1.50000\n"+
+		"#EXT-X-PART-INF:PART-TARGET=0.50000\n"+
+		"#EXT-X-MEDIA-SEQUENCE:0\n"+
+		"#EXT-X-INDEPENDENT-SEGMENTS\n"+
+		"\n"+
+		"#EXT-X-MAP:URI=\"init0.mp4\"\n"+
+		"\n"+
+		"#EXT-X-PART:DURATION=0.50000,URI=\"part0.mp4\",INDEPENDENT=YES\n"+
+		"#EXT-X-PART:DURATION=0.50000,URI=\"part1.mp4\"\n"+
+		"#EXTINF:1.00000,\n"+
+		"seg0.mp4\n"+
+		"\n"+
+		"#EXT-X-PART:DURATION=0.50000,URI=\"part2.mp4\",INDEPENDENT=YES\n"+
+		"#EXT-X-PRELOAD-HINT:TYPE=PART,URI=\"part3.mp4\"\n", string(body))
+
+	// blocking playlist reload
+	done := make(chan []byte)
+	go func() {
+		_, _, body := doGet(t, m, "/stream.m3u8?_HLS_msn=1&_HLS_part=1")
+		done <- body
+	}()
+
+	// blocking preload hint
+	partDone := make(chan []byte)
+	go func() {
+		_, _, body := doGet(t, m, "/part3.mp4")
+		partDone <- body
+	}()
+
+	select {
+	case <-done:
+		t.Errorf("should not happen")
+	case <-partDone:
+		t.Errorf("should not happen")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	s.write(4)
+
+	body = <-done
+	require.Contains(t, string(body), "#EXT-X-PART:DURATION=0.50000,URI=\"part3.mp4\"\n"+
+		"#EXTINF:1.00000,\n"+
+		"seg1.mp4\n"+
+		"\n"+
+		"#EXT-X-PRELOAD-HINT:TYPE=PART,URI=\"part4.mp4\"\n")
+
+	body = <-partDone
+	require.Equal(t, "moof", string(body[4:8]))
+
+	// requests that are too far in the future are rejected
+	code, _, _ = doGet(t, m, "/stream.m3u8?_HLS_msn=10")
+	require.Equal(t, http.StatusBadRequest, code)
+
+	// pending requests are terminated when the context is canceled
+	ctx, ctxCancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		ctxCancel()
+	}()
+	code, _, _ = doGetWithContext(ctx, t, m, "/stream.m3u8?_HLS_msn=3")
+	require.Equal(t, http.StatusNotFound, code)
+}
+
+func TestMuxerAudioOnly(t *testing.T) {
+	forma := &formats.Opus{
+		PayloadTyp: 96,
+		IsStereo:   true,
+	}
+
+	m := &Muxer{
+		Medias: media.Medias{{
+			Type:    media.TypeAudio,
+			Formats: []formats.Format{forma},
+		}},
+		Variant: VariantMPEGTS,
+	}
+	err := m.Start()
+	require.EqualError(t, err, "no supported formats found")
+
+	m = &Muxer{
+		Medias: media.Medias{{
+			Type:    media.TypeAudio,
+			Formats: []formats.Format{forma},
+		}},
+		Variant: VariantFMP4,
+	}
+	err = m.Start()
+	require.NoError(t, err)
+	defer m.Close()
+
+	enc := forma.CreateEncoder()
+	for i := 0; i < 60; i++ {
+		pkt, err := enc.Encode([]byte{0x01, byte(i)}, time.Duration(i)*20*time.Millisecond)
+		require.NoError(t, err)
+		err = m.WritePacketRTP(m.Medias[0], forma, pkt)
+		require.NoError(t, err)
+	}
+
+	code, _, body := doGet(t, m, "/index.m3u8")
+	require.Equal(t, http.StatusOK, code)
+	require.Contains(t, string(body), "CODECS=\"opus\"")
+}
+
+func TestCodecString(t *testing.T) {
+	for _, ca := range []struct {
+		name  string
+		forma formats.Format
+		codec string
+	}{
+		{
+			"h264",
+			&formats.H264{SPS: testSPS, PPS: testPPS},
+			"avc1.64000c",
+		},
+		{
+			"h265",
+			&formats.H265{VPS: []byte{0x40, 0x01}, SPS: testH265SPS, PPS: []byte{0x44, 0x01}},
+			"hvc1.1.6.L120.90",
+		},
+		{
+			"mpeg4audio",
+			&formats.MPEG4Audio{Config: &mpeg4audio.Config{
+				Type:         mpeg4audio.ObjectTypeAACLC,
+				SampleRate:   44100,
+				ChannelCount: 2,
+			}},
+			"mp4a.40.2",
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			tr := newMuxerTrack(&Muxer{}, 1, ca.forma)
+			require.Equal(t, ca.codec, tr.codecString())
+		})
+	}
+}
@@ -0,0 +1,324 @@
+package hls
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/bluenviron/mediacommon/pkg/codecs/h264"
+	"github.com/bluenviron/mediacommon/pkg/codecs/h265"
+	"github.com/pion/rtp"
+
+	"github.com/bluenviron/gortsplib/v3"
+	"github.com/bluenviron/gortsplib/v3/pkg/fmp4"
+	"github.com/bluenviron/gortsplib/v3/pkg/formats"
+	"github.com/bluenviron/gortsplib/v3/pkg/mpegtsrecorder"
+)
+
+const (
+	videoTimeScale = 90000
+)
+
+type muxerSample struct {
+	pts    time.Duration
+	dts    time.Duration
+	isSync bool
+
+	// NALUs of the access unit (H264, H265) or a single frame (audio formats).
+	au [][]byte
+}
+
+type muxerTrack struct {
+	m         *Muxer
+	id        int
+	timeScale uint32
+	isVideo   bool
+	wt        *mpegtsrecorder.WriterTrack
+
+	dec    *gortsplib.FrameDecoder
+	frames []*gortsplib.Frame
+
+	h264Format *formats.H264
+	h264SPS    []byte
+	h264PPS    []byte
+
+	h265Format *formats.H265
+	h265VPS    []byte
+	h265SPS    []byte
+	h265PPS    []byte
+
+	mpeg4AudioFormat *formats.MPEG4Audio
+
+	opusFormat *formats.Opus
+
+	// fMP4 state
+	paramsChanged bool
+	pending       *fmp4Sample
+	lastDuration  uint32
+	samples       []*fmp4.Sample
+	baseTime      uint64
+}
+
+func newMuxerTrack(m *Muxer, id int, forma formats.Format) *muxerTrack {
+	t := &muxerTrack{
+		m:         m,
+		id:        id,
+		timeScale: videoTimeScale,
+		wt: &mpegtsrecorder.WriterTrack{
+			PID:    uint16(255 + id),
+			Format: forma,
+		},
+	}
+
+	switch tforma := forma.(type) {
+	case *formats.H264:
+		t.h264Format = tforma
+		t.h264SPS, t.h264PPS = tforma.SafeParams()
+		t.isVideo = true
+
+	case *formats.H265:
+		t.h265Format = tforma
+		t.h265VPS, t.h265SPS, t.h265PPS = tforma.SafeParams()
+		t.isVideo = true
+
+	case *formats.MPEG4Audio:
+		if tforma.Config == nil {
+			return nil
+		}
+		t.mpeg4AudioFormat = tforma
+		t.timeScale = uint32(tforma.Config.SampleRate)
+
+	case *formats.Opus:
+		// Opus can't be inserted into MPEG-TS HLS segments
+		if m.Variant == VariantMPEGTS {
+			return nil
+		}
+		t.opusFormat = tforma
+		t.timeScale = 48000
+
+	default:
+		return nil
+	}
+
+	t.dec = gortsplib.NewFrameDecoder(forma, func(fr *gortsplib.Frame) {
+		t.frames = append(t.frames, fr)
+	})
+
+	return t
+}
+
+func (t *muxerTrack) ready() bool {
+	switch {
+	case t.h264Format != nil:
+		return t.h264SPS != nil && t.h264PPS != nil
+
+	case t.h265Format != nil:
+		return t.h265VPS != nil && t.h265SPS != nil && t.h265PPS != nil
+
+	default:
+		return true
+	}
+}
+
+func (t *muxerTrack) fmp4Codec() fmp4.Codec {
+	switch {
+	case t.h264Format != nil:
+		return &fmp4.CodecH264{SPS: t.h264SPS, PPS: t.h264PPS}
+
+	case t.h265Format != nil:
+		return &fmp4.CodecH265{VPS: t.h265VPS, SPS: t.h265SPS, PPS: t.h265PPS}
+
+	case t.mpeg4AudioFormat != nil:
+		return &fmp4.CodecMPEG4Audio{Config: *t.mpeg4AudioFormat.Config}
+
+	default:
+		channelCount := 1
+		if t.opusFormat.IsStereo {
+			channelCount = 2
+		}
+		return &fmp4.CodecOpus{ChannelCount: channelCount}
+	}
+}
+
+func (t *muxerTrack) setParam(dest *[]byte, nalu []byte) {
+	if !bytes.Equal(*dest, nalu) {
+		*dest = append([]byte(nil), nalu...)
+		t.paramsChanged = true
+	}
+}
+
+// push moves the pending fMP4 sample into the current part,
+// by using the DTS of the next sample to compute its duration.
+func (t *muxerTrack) push(nextDTSTicks uint64) {
+	if t.pending == nil {
+		return
+	}
+
+	if len(t.samples) == 0 {
+		t.baseTime = t.pending.dtsTicks
+	}
+
+	if nextDTSTicks > t.pending.dtsTicks {
+		t.lastDuration = uint32(nextDTSTicks - t.pending.dtsTicks)
+	}
+
+	t.samples = append(t.samples, &fmp4.Sample{
+		Duration:        t.lastDuration,
+		PTSOffset:       t.pending.ptsOffset,
+		IsNonSyncSample: !t.pending.isSync,
+		Payload:         t.pending.payload,
+	})
+	t.pending = nil
+}
+
+// fmp4Payload encodes a sample into the payload of a fMP4 sample.
+func (t *muxerTrack) fmp4Payload(s *muxerSample) ([]byte, error) {
+	if t.isVideo {
+		return h264.AVCCMarshal(s.au)
+	}
+	return s.au[0], nil
+}
+
+// writeMPEGTS writes a sample into a MPEG-TS stream.
+func (t *muxerTrack) writeMPEGTS(w *mpegtsrecorder.Writer, s *muxerSample) error {
+	switch {
+	case t.h264Format != nil:
+		au := s.au
+		// parameters are sent before every IDR
+		if s.isSync {
+			au = append([][]byte{t.h264SPS, t.h264PPS}, au...)
+		}
+		return w.WriteH26x(t.wt, s.pts, s.dts, s.isSync, au)
+
+	case t.h265Format != nil:
+		au := s.au
+		if s.isSync {
+			au = append([][]byte{t.h265VPS, t.h265SPS, t.h265PPS}, au...)
+		}
+		return w.WriteH26x(t.wt, s.pts, s.dts, s.isSync, au)
+
+	default:
+		return w.WriteMPEG4Audio(t.wt, s.pts, s.au)
+	}
+}
+
+func (t *muxerTrack) writePacketRTP(pkt *rtp.Packet, now time.Time) error {
+	err := t.dec.ProcessPacket(pkt)
+	if err != nil {
+		return err
+	}
+
+	frames := t.frames
+	t.frames = nil
+
+	for _, fr := range frames {
+		pts := t.m.timeDec.Decode(t, fr.PTS, now)
+		dts := pts + fr.DTS - fr.PTS
+
+		var err error
+
+		switch {
+		case t.h264Format != nil:
+			err = t.writeH264(fr, pts, dts)
+
+		case t.h265Format != nil:
+			err = t.writeH265(fr, pts, dts)
+
+		default:
+			err = t.m.writeSample(t, &muxerSample{
+				pts:    pts,
+				dts:    pts,
+				isSync: true,
+				au:     fr.Payload,
+			})
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (t *muxerTrack) writeH264(fr *gortsplib.Frame, pts time.Duration, dts time.Duration) error {
+	filteredNALUs := make([][]byte, 0, len(fr.Payload))
+
+	for _, nalu := range fr.Payload {
+		if len(nalu) == 0 {
+			continue
+		}
+
+		switch h264.NALUType(nalu[0] & 0x1F) {
+		case h264.NALUTypeSPS:
+			t.setParam(&t.h264SPS, nalu)
+			continue
+
+		case h264.NALUTypePPS:
+			t.setParam(&t.h264PPS, nalu)
+			continue
+
+		case h264.NALUTypeAccessUnitDelimiter:
+			continue
+		}
+
+		filteredNALUs = append(filteredNALUs, nalu)
+	}
+
+	if len(filteredNALUs) == 0 || !t.ready() {
+		return nil
+	}
+
+	return t.m.writeSample(t, &muxerSample{
+		pts:    pts,
+		dts:    dts,
+		isSync: fr.KeyFrame,
+		au:     filteredNALUs,
+	})
+}
+
+func (t *muxerTrack) writeH265(fr *gortsplib.Frame, pts time.Duration, dts time.Duration) error {
+	filteredNALUs := make([][]byte, 0, len(fr.Payload))
+	picturePresent := false
+
+	for _, nalu := range fr.Payload {
+		if len(nalu) == 0 {
+			continue
+		}
+
+		typ := h265.NALUType((nalu[0] >> 1) & 0b111111)
+
+		switch typ {
+		case h265.NALUType_VPS_NUT:
+			t.setParam(&t.h265VPS, nalu)
+			continue
+
+		case h265.NALUType_SPS_NUT:
+			t.setParam(&t.h265SPS, nalu)
+			continue
+
+		case h265.NALUType_PPS_NUT:
+			t.setParam(&t.h265PPS, nalu)
+			continue
+
+		case h265.NALUType_AUD_NUT:
+			continue
+		}
+
+		if typ < h265.NALUType_VPS_NUT {
+			picturePresent = true
+		}
+
+		filteredNALUs = append(filteredNALUs, nalu)
+	}
+
+	if !picturePresent || !t.ready() {
+		return nil
+	}
+
+	return t.m.writeSample(t, &muxerSample{
+		pts:    pts,
+		dts:    dts,
+		isSync: fr.KeyFrame,
+		au:     filteredNALUs,
+	})
+}
@@ -0,0 +1,213 @@
+package hls
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bluenviron/mediacommon/pkg/codecs/h264"
+)
+
+func reverseBits32(v uint32) uint32 {
+	var ret uint32
+	for i := 0; i < 32; i++ {
+		ret = ret<<1 | (v & 1)
+		v >>= 1
+	}
+	return ret
+}
+
+// codecString returns the codec identifier of a track, as defined in RFC6381.
+func (t *muxerTrack) codecString() string {
+	switch {
+	case t.h264Format != nil:
+		if len(t.h264SPS) < 4 {
+			return "avc1"
+		}
+		return fmt.Sprintf("avc1.%02x%02x%02x", t.h264SPS[1], t.h264SPS[2], t.h264SPS[3])
+
+	case t.h265Format != nil:
+		// profile, tier and level are placed after the NALU header and the first byte
+		rbsp := h264.EmulationPreventionRemove(t.h265SPS)
+		if len(rbsp) < 15 {
+			return "hvc1"
+		}
+		ptl := rbsp[3:15]
+
+		ret := "hvc1."
+		if profileSpace := ptl[0] >> 6; profileSpace != 0 {
+			ret += string(rune('A' + profileSpace - 1))
+		}
+		ret += strconv.FormatUint(uint64(ptl[0]&0x1F), 10)
+
+		compat := uint32(ptl[1])<<24 | uint32(ptl[2])<<16 | uint32(ptl[3])<<8 | uint32(ptl[4])
+		ret += "." + strconv.FormatUint(uint64(reverseBits32(compat)), 16)
+
+		if (ptl[0]>>5)&0x01 != 0 {
+			ret += ".H"
+		} else {
+			ret += ".L"
+		}
+		ret += strconv.FormatUint(uint64(ptl[11]), 10)
+
+		// trailing constraint bytes that are zero are omitted
+		constraints := ptl[5:11]
+		for len(constraints) > 0 && constraints[len(constraints)-1] == 0 {
+			constraints = constraints[:len(constraints)-1]
+		}
+		for _, b := range constraints {
+			ret += "." + strconv.FormatUint(uint64(b), 16)
+		}
+
+		return ret
+
+	case t.mpeg4AudioFormat != nil:
+		return "mp4a.40." + strconv.FormatInt(int64(t.mpeg4AudioFormat.Config.Type), 10)
+
+	default:
+		return "opus"
+	}
+}
+
+func formatSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 5, 64)
+}
+
+func (m *Muxer) version() int {
+	switch m.Variant {
+	case VariantMPEGTS:
+		return 3
+	case VariantFMP4:
+		return 7
+	default:
+		return 9
+	}
+}
+
+// bandwidth returns the peak bitrate of segments.
+func (m *Muxer) bandwidth() int {
+	ret := 0
+	for _, seg := range m.segments {
+		if seg.duration <= 0 {
+			continue
+		}
+
+		bw := int(float64(seg.size()*8) / seg.duration.Seconds())
+		if bw > ret {
+			ret = bw
+		}
+	}
+	return ret
+}
+
+func (m *Muxer) multivariantPlaylist() []byte {
+	codecs := make([]string, len(m.trackList))
+	for i, t := range m.trackList {
+		codecs[i] = t.codecString()
+	}
+
+	return []byte("#EXTM3U\n" +
+		"#EXT-X-VERSION:" + strconv.FormatInt(int64(m.version()), 10) + "\n" +
+		"#EXT-X-INDEPENDENT-SEGMENTS\n" +
+		"\n" +
+		"#EXT-X-STREAM-INF:BANDWIDTH=" + strconv.FormatInt(int64(m.bandwidth()), 10) +
+		",CODECS=\"" + strings.Join(codecs, ",") + "\"\n" +
+		"stream.m3u8\n")
+}
+
+// targetDuration returns the maximum duration of segments, rounded up to seconds.
+func (m *Muxer) targetDuration() int {
+	ret := int(math.Ceil(m.SegmentDuration.Seconds()))
+	for _, seg := range m.segments {
+		v := int(math.Ceil(seg.duration.Seconds()))
+		if v > ret {
+			ret = v
+		}
+	}
+	return ret
+}
+
+// partTarget returns the maximum duration of partial segments.
+func (m *Muxer) partTarget() time.Duration {
+	ret := m.PartDuration
+	for _, p := range m.parts {
+		if p.duration > ret {
+			ret = p.duration
+		}
+	}
+	return ret
+}
+
+func (m *Muxer) mediaPlaylist() []byte {
+	var b strings.Builder
+
+	b.WriteString("#EXTM3U\n")
+	b.WriteString("#EXT-X-VERSION:" + strconv.FormatInt(int64(m.version()), 10) + "\n")
+	b.WriteString("#EXT-X-TARGETDURATION:" + strconv.FormatInt(int64(m.targetDuration()), 10) + "\n")
+
+	if m.Variant == VariantLowLatency {
+		partTarget := m.partTarget()
+		b.WriteString("#EXT-X-SERVER-CONTROL:CAN-BLOCK-RELOAD=YES,PART-HOLD-BACK=" +
+			formatSeconds(partTarget*3) + "\n")
+		b.WriteString("#EXT-X-PART-INF:PART-TARGET=" + formatSeconds(partTarget) + "\n")
+	}
+
+	segments := m.segments
+	if len(segments) > m.SegmentCount {
+		segments = segments[len(segments)-m.SegmentCount:]
+	}
+
+	b.WriteString("#EXT-X-MEDIA-SEQUENCE:" + strconv.FormatUint(segments[0].id, 10) + "\n")
+
+	if m.Variant != VariantMPEGTS {
+		b.WriteString("#EXT-X-INDEPENDENT-SEGMENTS\n")
+	}
+
+	writeMap := func(initID uint64) {
+		b.WriteString("#EXT-X-MAP:URI=\"init" + strconv.FormatUint(initID, 10) + ".mp4\"\n")
+	}
+
+	writeParts := func(parts []*muxerPart) {
+		for _, p := range parts {
+			b.WriteString("#EXT-X-PART:DURATION=" + formatSeconds(p.duration) +
+				",URI=\"" + p.name() + "\"")
+			if p.independent {
+				b.WriteString(",INDEPENDENT=YES")
+			}
+			b.WriteString("\n")
+		}
+	}
+
+	for i, seg := range segments {
+		if m.Variant != VariantMPEGTS && (i == 0 || seg.initID != segments[i-1].initID) {
+			b.WriteString("\n")
+			writeMap(seg.initID)
+		}
+
+		b.WriteString("\n")
+
+		// partial segments are listed for the last two segments only
+		if m.Variant == VariantLowLatency && i >= len(segments)-2 {
+			writeParts(seg.parts)
+		}
+
+		b.WriteString("#EXTINF:" + formatSeconds(seg.duration) + ",\n")
+		b.WriteString(seg.name() + "\n")
+	}
+
+	if m.Variant == VariantLowLatency {
+		b.WriteString("\n")
+
+		if m.curSegment.initID != segments[len(segments)-1].initID {
+			writeMap(m.curSegment.initID)
+		}
+
+		writeParts(m.curSegment.parts)
+		b.WriteString("#EXT-X-PRELOAD-HINT:TYPE=PART,URI=\"part" +
+			strconv.FormatUint(m.nextPartID, 10) + ".mp4\"\n")
+	}
+
+	return []byte(b.String())
+}
@@ -0,0 +1,78 @@
+package hls
+
+import (
+	"bytes"
+	"strconv"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v3/pkg/fmp4"
+	"github.com/bluenviron/gortsplib/v3/pkg/rtptime"
+)
+
+// durationToTicks converts a duration into ticks of a time scale, rounding to the nearest tick.
+func durationToTicks(d time.Duration, timeScale uint32) uint64 {
+	return uint64(rtptime.DurationToTicks(d+time.Second/time.Duration(2*timeScale), int(timeScale)))
+}
+
+type fmp4Sample struct {
+	isSync    bool
+	payload   []byte
+	dtsTicks  uint64
+	ptsOffset int32
+}
+
+// muxerPart is a partial segment of a fMP4 segment.
+type muxerPart struct {
+	id          uint64
+	startDTS    time.Duration
+	duration    time.Duration
+	independent bool
+	content     []byte
+}
+
+func (p *muxerPart) name() string {
+	return "part" + strconv.FormatUint(p.id, 10) + ".mp4"
+}
+
+type muxerSegment struct {
+	id       uint64
+	initID   uint64
+	ext      string
+	startDTS time.Duration
+	duration time.Duration
+	parts    []*muxerPart
+
+	// MPEG-TS segments are written directly into the buffer,
+	// while fMP4 segments are the concatenation of their parts.
+	buf bytes.Buffer
+}
+
+func (s *muxerSegment) name() string {
+	return "seg" + strconv.FormatUint(s.id, 10) + s.ext
+}
+
+func (s *muxerSegment) size() int {
+	return s.buf.Len()
+}
+
+// marshalPart encodes the samples that have been accumulated by tracks into a fMP4 fragment.
+func marshalPart(seqNum uint32, tracks []*muxerTrack) ([]byte, error) {
+	frag := &fmp4.Fragment{
+		SequenceNumber: seqNum,
+	}
+
+	for _, t := range tracks {
+		if len(t.samples) == 0 {
+			continue
+		}
+
+		frag.Tracks = append(frag.Tracks, &fmp4.FragmentTrack{
+			ID:       t.id,
+			BaseTime: t.baseTime,
+			Samples:  t.samples,
+		})
+		t.samples = nil
+	}
+
+	return frag.Marshal()
+}
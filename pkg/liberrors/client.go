@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/bluenviron/gortsplib/v3/pkg/base"
+	"github.com/bluenviron/gortsplib/v3/pkg/url"
 )
 
 // ErrClientTerminated is an error that can be returned by a client.
@@ -36,6 +37,17 @@ func (e ErrClientSessionHeaderInvalid) Error() string {
 	return fmt.Sprintf("invalid session header: %v", e.Err)
 }
 
+// ErrClientSessionMismatch is an error that can be returned by a client.
+type ErrClientSessionMismatch struct {
+	Expected string
+	Received string
+}
+
+// Error implements the error interface.
+func (e ErrClientSessionMismatch) Error() string {
+	return fmt.Sprintf("expected session '%s', received '%s'", e.Expected, e.Received)
+}
+
 // ErrClientBadStatusCode is an error that can be returned by a client.
 type ErrClientBadStatusCode struct {
 	Code    base.StatusCode
@@ -196,3 +208,29 @@ type ErrClientRTPInfoInvalid struct {
 func (e ErrClientRTPInfoInvalid) Error() string {
 	return fmt.Sprintf("invalid RTP-Info: %v", e.Err)
 }
+
+// ErrClientRedirected is an error that can be returned by a client.
+type ErrClientRedirected struct {
+	URL *url.URL
+}
+
+// Error implements the error interface.
+func (e ErrClientRedirected) Error() string {
+	return fmt.Sprintf("redirected to %v", e.URL)
+}
+
+// ErrClientTornDown is an error that can be returned by a client.
+type ErrClientTornDown struct{}
+
+// Error implements the error interface.
+func (e ErrClientTornDown) Error() string {
+	return "torn down by server"
+}
+
+// ErrClientWriteQueueFull is an error that can be returned by a client.
+type ErrClientWriteQueueFull struct{}
+
+// Error implements the error interface.
+func (e ErrClientWriteQueueFull) Error() string {
+	return "write queue is full, the server or the network is too slow"
+}
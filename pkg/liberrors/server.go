@@ -3,6 +3,7 @@ package liberrors
 import (
 	"fmt"
 	"net"
+	"time"
 
 	"github.com/bluenviron/gortsplib/v3/pkg/base"
 	"github.com/bluenviron/gortsplib/v3/pkg/headers"
@@ -98,6 +99,26 @@ func (e ErrServerTransportHeaderInvalid) Error() string {
 	return fmt.Sprintf("invalid transport header: %v", e.Err)
 }
 
+// ErrServerScaleHeaderInvalid is an error that can be returned by a server.
+type ErrServerScaleHeaderInvalid struct {
+	Err error
+}
+
+// Error implements the error interface.
+func (e ErrServerScaleHeaderInvalid) Error() string {
+	return fmt.Sprintf("invalid scale header: %v", e.Err)
+}
+
+// ErrServerSpeedHeaderInvalid is an error that can be returned by a server.
+type ErrServerSpeedHeaderInvalid struct {
+	Err error
+}
+
+// Error implements the error interface.
+func (e ErrServerSpeedHeaderInvalid) Error() string {
+	return fmt.Sprintf("invalid speed header: %v", e.Err)
+}
+
 // ErrServerMediaAlreadySetup is an error that can be returned by a server.
 type ErrServerMediaAlreadySetup struct{}
 
@@ -259,3 +280,79 @@ type ErrServerUnexpectedFrame struct{}
 func (e ErrServerUnexpectedFrame) Error() string {
 	return "received unexpected interleaved frame"
 }
+
+// ErrServerSessionNoConn is an error that can be returned by a server.
+type ErrServerSessionNoConn struct{}
+
+// Error implements the error interface.
+func (e ErrServerSessionNoConn) Error() string {
+	return "session is not associated with any connection"
+}
+
+// ErrServerWriteQueueFull is an error that can be returned by a server.
+type ErrServerWriteQueueFull struct{}
+
+// Error implements the error interface.
+func (e ErrServerWriteQueueFull) Error() string {
+	return "write queue is full, the reader is too slow"
+}
+
+// ErrServerTooManyConnections is an error that can be returned by a server.
+type ErrServerTooManyConnections struct{}
+
+// Error implements the error interface.
+func (e ErrServerTooManyConnections) Error() string {
+	return "too many connections"
+}
+
+// ErrServerTooManySessions is an error that can be returned by a server.
+type ErrServerTooManySessions struct {
+	IP net.IP
+}
+
+// Error implements the error interface.
+func (e ErrServerTooManySessions) Error() string {
+	return fmt.Sprintf("too many sessions opened by %v", e.IP)
+}
+
+// ErrServerRequestRateExceeded is an error that can be returned by a server.
+type ErrServerRequestRateExceeded struct{}
+
+// Error implements the error interface.
+func (e ErrServerRequestRateExceeded) Error() string {
+	return "too many requests"
+}
+
+// ErrServerUnauthenticatedTimeout is an error that can be returned by a server.
+type ErrServerUnauthenticatedTimeout struct{}
+
+// Error implements the error interface.
+func (e ErrServerUnauthenticatedTimeout) Error() string {
+	return "connection has not been authenticated in time"
+}
+
+// ErrServerShuttingDown is an error that can be returned by a server.
+type ErrServerShuttingDown struct{}
+
+// Error implements the error interface.
+func (e ErrServerShuttingDown) Error() string {
+	return "server is shutting down"
+}
+
+// ErrServerClientResponseTimeout is an error that can be returned by a server.
+type ErrServerClientResponseTimeout struct{}
+
+// Error implements the error interface.
+func (e ErrServerClientResponseTimeout) Error() string {
+	return "client did not reply to the request in time"
+}
+
+// ErrServerInvalidSessionTimeout is an error that can be returned by a server.
+type ErrServerInvalidSessionTimeout struct {
+	Value time.Duration
+}
+
+// Error implements the error interface.
+func (e ErrServerInvalidSessionTimeout) Error() string {
+	return fmt.Sprintf("invalid session timeout (%v): it must be at least one second", e.Value)
+}
@@ -0,0 +1,252 @@
+// Package mpegtsrecorder contains a recorder that saves media streams into MPEG-TS files.
+package mpegtsrecorder
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pion/rtp"
+
+	"github.com/bluenviron/gortsplib/v3"
+	"github.com/bluenviron/gortsplib/v3/pkg/formats"
+	"github.com/bluenviron/gortsplib/v3/pkg/media"
+	"github.com/bluenviron/gortsplib/v3/pkg/rtptime"
+)
+
+var timeNow = time.Now
+
+// Recorder saves media streams into MPEG-TS files.
+// Supported formats are H264, H265, MPEG-4 Audio (AAC), Opus and MPEG-1/2 Audio;
+// other formats are ignored.
+type Recorder struct {
+	//
+	// parameters (all optional except Medias and Path)
+	//
+	// medias to record.
+	Medias media.Medias
+	// path of recorded files.
+	// When files are rotated, it must contain a %d placeholder,
+	// that is replaced by the number of the file, starting from zero.
+	Path string
+	// maximum duration of a file.
+	// When reached, a new file is created at the next keyframe
+	// (or at the next audio frame when there are no video tracks).
+	// It defaults to zero, that means that files are not rotated by duration.
+	SegmentDuration time.Duration
+	// maximum size of a file.
+	// When reached, a new file is created at the next keyframe
+	// (or at the next audio frame when there are no video tracks).
+	// It defaults to zero, that means that files are not rotated by size.
+	SegmentMaxSize uint64
+
+	//
+	// callbacks (all optional)
+	//
+	// called when a file is created.
+	OnSegmentCreate func(path string)
+	// called when a file is completed.
+	OnSegmentComplete func(path string)
+	// called when a packet cannot be processed.
+	OnError func(err error)
+
+	mutex        sync.Mutex
+	tracks       map[formats.Format]*track
+	hasVideo     bool
+	timeDec      *rtptime.GlobalDecoder
+	w            *Writer
+	videoStarted bool
+	seg          *segment
+	segCount     int
+	closed       bool
+}
+
+// Start initializes the recorder.
+// Files are created when the first frame that can be decoded is received.
+func (r *Recorder) Start() error {
+	if r.Path == "" {
+		return fmt.Errorf("path not provided")
+	}
+
+	if (r.SegmentDuration != 0 || r.SegmentMaxSize != 0) && !strings.Contains(r.Path, "%d") {
+		return fmt.Errorf("path must contain a %%d placeholder when files are rotated")
+	}
+
+	if r.OnSegmentCreate == nil {
+		r.OnSegmentCreate = func(string) {}
+	}
+	if r.OnSegmentComplete == nil {
+		r.OnSegmentComplete = func(string) {}
+	}
+	if r.OnError == nil {
+		r.OnError = func(error) {}
+	}
+
+	r.tracks = make(map[formats.Format]*track)
+	var writerTracks []*WriterTrack
+	pid := uint16(256)
+
+	for _, medi := range r.Medias {
+		for _, forma := range medi.Formats {
+			t := newTrack(r, pid, forma)
+			if t == nil {
+				continue
+			}
+
+			r.tracks[forma] = t
+			writerTracks = append(writerTracks, t.wt)
+			pid++
+
+			if t.isVideo() {
+				r.hasVideo = true
+			}
+		}
+	}
+
+	if len(r.tracks) == 0 {
+		return fmt.Errorf("no supported formats found")
+	}
+
+	var err error
+	r.w, err = NewWriter(io.Discard, writerTracks)
+	if err != nil {
+		return err
+	}
+
+	r.timeDec = rtptime.NewGlobalDecoder(timeNow())
+
+	return nil
+}
+
+// Close closes the current file.
+func (r *Recorder) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.closed = true
+
+	if r.seg != nil {
+		err := r.seg.close()
+		r.OnSegmentComplete(r.seg.path)
+		r.seg = nil
+		return err
+	}
+
+	return nil
+}
+
+// Attach sets the callbacks of a Client or ServerSession in order to
+// record all its supported formats.
+// Medias must have been set up.
+func (r *Recorder) Attach(src gortsplib.PacketSource) {
+	for _, medi := range r.Medias {
+		for _, forma := range medi.Formats {
+			if _, ok := r.tracks[forma]; !ok {
+				continue
+			}
+
+			cmedia := medi
+			cformat := forma
+			src.OnPacketRTP(medi, forma, func(pkt *rtp.Packet) {
+				err := r.WritePacketRTP(cmedia, cformat, pkt)
+				if err != nil {
+					r.OnError(err)
+				}
+			})
+		}
+	}
+}
+
+// WritePacketRTP writes a RTP packet into the recording.
+func (r *Recorder) WritePacketRTP(medi *media.Media, forma formats.Format, pkt *rtp.Packet) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.closed {
+		return nil
+	}
+
+	t, ok := r.tracks[forma]
+	if !ok {
+		return nil
+	}
+
+	return t.writePacketRTP(pkt, timeNow())
+}
+
+// canWrite returns whether frames of a track can be written.
+// When there are video tracks, frames are discarded until the first keyframe.
+func (r *Recorder) canWrite(t *track, randomAccess bool) bool {
+	if !r.hasVideo {
+		return r.seg != nil || randomAccess
+	}
+
+	if !r.videoStarted {
+		if !t.isVideo() || !randomAccess {
+			return false
+		}
+		r.videoStarted = true
+	}
+
+	return true
+}
+
+// prepareSegment creates or rotates the current file.
+func (r *Recorder) prepareSegment(t *track, dts time.Duration, randomAccess bool) error {
+	if r.seg != nil {
+		if !randomAccess || (r.hasVideo && !t.isVideo()) {
+			return nil
+		}
+
+		if !((r.SegmentDuration != 0 && (dts-r.seg.startDTS) >= r.SegmentDuration) ||
+			(r.SegmentMaxSize != 0 && r.seg.size >= r.SegmentMaxSize)) {
+			return nil
+		}
+
+		err := r.seg.close()
+		r.OnSegmentComplete(r.seg.path)
+		r.seg = nil
+		if err != nil {
+			return err
+		}
+	}
+
+	path := r.Path
+	if strings.Contains(path, "%d") {
+		path = fmt.Sprintf(path, r.segCount)
+	}
+
+	seg, err := newSegment(path, dts)
+	if err != nil {
+		return err
+	}
+
+	err = r.w.SetOutput(seg)
+	if err != nil {
+		seg.close() //nolint:errcheck
+		return err
+	}
+
+	r.seg = seg
+	r.segCount++
+	r.OnSegmentCreate(path)
+
+	return nil
+}
+
+// prepareWrite checks whether a frame of a track can be written,
+// and creates or rotates the current file.
+func (r *Recorder) prepareWrite(t *track, dts time.Duration, randomAccess bool) (bool, error) {
+	if !r.canWrite(t, randomAccess) {
+		return false, nil
+	}
+
+	err := r.prepareSegment(t, dts, randomAccess)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,327 @@
+package mpegtsrecorder
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/asticode/go-astits"
+	"github.com/bluenviron/mediacommon/pkg/codecs/h264"
+	"github.com/bluenviron/mediacommon/pkg/codecs/mpeg4audio"
+	"github.com/pion/rtp"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/gortsplib/v3/pkg/formats"
+	"github.com/bluenviron/gortsplib/v3/pkg/media"
+	"github.com/bluenviron/gortsplib/v3/pkg/mpegtssource"
+)
+
+var (
+	testSPS = []byte{
+		0x67, 0x64, 0x00, 0x0c, 0xac, 0x3b, 0x50, 0xb0,
+		0x4b, 0x42, 0x00, 0x00, 0x03, 0x00, 0x02, 0x00,
+		0x00, 0x03, 0x00, 0x3d, 0x08,
+	}
+	testPPS = []byte{0x68, 0xee, 0x3c, 0x80}
+)
+
+type testSource struct {
+	cbs map[formats.Format]func(*rtp.Packet)
+}
+
+func (s *testSource) OnPacketRTP(medi *media.Media, forma formats.Format, cb func(*rtp.Packet)) {
+	s.cbs[forma] = cb
+}
+
+func setTimeNow(t *testing.T, now *time.Time) {
+	timeNow = func() time.Time { return *now }
+	t.Cleanup(func() { timeNow = time.Now })
+}
+
+func writeTestStream(t *testing.T, src *testSource, now *time.Time,
+	h264Forma *formats.H264, audioForma *formats.MPEG4Audio, count int,
+) {
+	h264Enc := h264Forma.CreateEncoder()
+	audioEnc := audioForma.CreateEncoder()
+
+	writeAudio := func(i int) {
+		pkts, err := audioEnc.Encode([][]byte{{0x01, 0x02, byte(i)}}, time.Duration(i)*500*time.Millisecond)
+		require.NoError(t, err)
+		for _, pkt := range pkts {
+			src.cbs[audioForma](pkt)
+		}
+	}
+
+	// audio frames that precede the first keyframe are discarded
+	writeAudio(0)
+
+	for i := 0; i < count; i++ {
+		// a keyframe every second
+		var nalus [][]byte
+		if (i % 2) == 0 {
+			nalus = [][]byte{testSPS, testPPS, {byte(h264.NALUTypeIDR), byte(i)}}
+		} else {
+			nalus = [][]byte{{byte(h264.NALUTypeNonIDR), byte(i)}}
+		}
+
+		pkts, err := h264Enc.Encode(nalus, time.Duration(i)*500*time.Millisecond)
+		require.NoError(t, err)
+		for _, pkt := range pkts {
+			src.cbs[h264Forma](pkt)
+		}
+
+		if i != 0 {
+			writeAudio(i)
+		}
+
+		*now = now.Add(500 * time.Millisecond)
+	}
+}
+
+func readPositions(t *testing.T, path string) map[media.Type][]time.Duration {
+	s, err := mpegtssource.Open(path)
+	require.NoError(t, err)
+	defer s.Close()
+
+	ret := make(map[media.Type][]time.Duration)
+
+	for {
+		medi, _, pos, err := s.ReadPacket()
+		if err == io.EOF {
+			return ret
+		}
+		require.NoError(t, err)
+		ret[medi.Type] = append(ret[medi.Type], pos)
+	}
+}
+
+func newTestFormats() (*formats.H264, *formats.MPEG4Audio, media.Medias) {
+	h264Forma := &formats.H264{
+		PayloadTyp:        96,
+		SPS:               testSPS,
+		PPS:               testPPS,
+		PacketizationMode: 1,
+	}
+
+	audioForma := &formats.MPEG4Audio{
+		PayloadTyp: 97,
+		Config: &mpeg4audio.Config{
+			Type:         mpeg4audio.ObjectTypeAACLC,
+			SampleRate:   48000,
+			ChannelCount: 2,
+		},
+		SizeLength:       13,
+		IndexLength:      3,
+		IndexDeltaLength: 3,
+	}
+
+	return h264Forma, audioForma, media.Medias{
+		{
+			Type:    media.TypeVideo,
+			Formats: []formats.Format{h264Forma},
+		},
+		{
+			Type:    media.TypeAudio,
+			Formats: []formats.Format{audioForma},
+		},
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	setTimeNow(t, &now)
+
+	h264Forma, audioForma, medias := newTestFormats()
+
+	var created []string
+	var completed []string
+
+	r := &Recorder{
+		Medias: medias,
+		Path:   filepath.Join(t.TempDir(), "rec.ts"),
+		OnSegmentCreate: func(path string) {
+			created = append(created, path)
+		},
+		OnSegmentComplete: func(path string) {
+			completed = append(completed, path)
+		},
+		OnError: func(err error) {
+			t.Errorf("unexpected error: %v", err)
+		},
+	}
+	err := r.Start()
+	require.NoError(t, err)
+
+	src := &testSource{cbs: make(map[formats.Format]func(*rtp.Packet))}
+	r.Attach(src)
+	require.Equal(t, 2, len(src.cbs))
+
+	writeTestStream(t, src, &now, h264Forma, audioForma, 6)
+
+	err = r.Close()
+	require.NoError(t, err)
+
+	require.Equal(t, []string{r.Path}, created)
+	require.Equal(t, []string{r.Path}, completed)
+
+	all := []time.Duration{
+		0,
+		500 * time.Millisecond,
+		1000 * time.Millisecond,
+		1500 * time.Millisecond,
+		2000 * time.Millisecond,
+		2500 * time.Millisecond,
+	}
+
+	pos := readPositions(t, r.Path)
+	require.Equal(t, all, pos[media.TypeVideo])
+	require.Equal(t, all[1:], pos[media.TypeAudio])
+}
+
+func TestRecorderRotation(t *testing.T) {
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	setTimeNow(t, &now)
+
+	h264Forma, audioForma, medias := newTestFormats()
+
+	var completed []string
+
+	r := &Recorder{
+		Medias:          medias,
+		Path:            filepath.Join(t.TempDir(), "rec_%d.ts"),
+		SegmentDuration: 1 * time.Second,
+		OnSegmentComplete: func(path string) {
+			completed = append(completed, path)
+		},
+	}
+	err := r.Start()
+	require.NoError(t, err)
+
+	src := &testSource{cbs: make(map[formats.Format]func(*rtp.Packet))}
+	r.Attach(src)
+
+	writeTestStream(t, src, &now, h264Forma, audioForma, 6)
+
+	err = r.Close()
+	require.NoError(t, err)
+
+	require.Equal(t, 3, len(completed))
+
+	for i, path := range completed {
+		require.Equal(t, filepath.Join(filepath.Dir(r.Path), "rec_"+string(rune('0'+i))+".ts"), path)
+
+		// every file starts with a keyframe
+		pos := readPositions(t, path)
+		require.Equal(t, []time.Duration{0, 500 * time.Millisecond}, pos[media.TypeVideo])
+	}
+}
+
+func TestRecorderAudioFormats(t *testing.T) {
+	opusForma := &formats.Opus{
+		PayloadTyp: 96,
+		IsStereo:   true,
+	}
+	mpeg2AudioForma := &formats.MPEG2Audio{}
+
+	r := &Recorder{
+		Medias: media.Medias{
+			{
+				Type:    media.TypeAudio,
+				Formats: []formats.Format{opusForma},
+			},
+			{
+				Type:    media.TypeAudio,
+				Formats: []formats.Format{mpeg2AudioForma},
+			},
+		},
+		Path: filepath.Join(t.TempDir(), "rec.ts"),
+	}
+	err := r.Start()
+	require.NoError(t, err)
+
+	opusEnc := opusForma.CreateEncoder()
+	pkt, err := opusEnc.Encode([]byte{0x01, 0x02, 0x03}, 0)
+	require.NoError(t, err)
+
+	err = r.WritePacketRTP(r.Medias[0], opusForma, pkt)
+	require.NoError(t, err)
+
+	err = r.WritePacketRTP(r.Medias[1], mpeg2AudioForma, &rtp.Packet{
+		Header: rtp.Header{
+			Version:     2,
+			PayloadType: 14,
+			Timestamp:   1234,
+		},
+		Payload: []byte{0x00, 0x00, 0x00, 0x00, 0xff, 0xfb, 0x01},
+	})
+	require.NoError(t, err)
+
+	err = r.Close()
+	require.NoError(t, err)
+
+	f, err := os.Open(r.Path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	dmx := astits.NewDemuxer(context.Background(), bufio.NewReader(f))
+
+	var streamTypes []astits.StreamType
+	datas := make(map[uint16][]byte)
+
+	for {
+		d, err := dmx.NextData()
+		if err == astits.ErrNoMorePackets {
+			break
+		}
+		require.NoError(t, err)
+
+		if d.PMT != nil {
+			streamTypes = nil
+			for _, es := range d.PMT.ElementaryStreams {
+				streamTypes = append(streamTypes, es.StreamType)
+			}
+		}
+
+		if d.PES != nil {
+			datas[d.PID] = d.PES.Data
+		}
+	}
+
+	require.Equal(t, []astits.StreamType{astits.StreamTypePrivateData, astits.StreamTypeMPEG1Audio}, streamTypes)
+	require.Equal(t, map[uint16][]byte{
+		256: {0x7f, 0xe0, 0x03, 0x01, 0x02, 0x03},
+		257: {0xff, 0xfb, 0x01},
+	}, datas)
+}
+
+func TestRecorderErrors(t *testing.T) {
+	_, _, medias := newTestFormats()
+
+	r := &Recorder{
+		Medias: medias,
+	}
+	err := r.Start()
+	require.EqualError(t, err, "path not provided")
+
+	r = &Recorder{
+		Medias:         medias,
+		Path:           "rec.ts",
+		SegmentMaxSize: 1024,
+	}
+	err = r.Start()
+	require.EqualError(t, err, "path must contain a %d placeholder when files are rotated")
+
+	r = &Recorder{
+		Medias: media.Medias{{
+			Type:    media.TypeVideo,
+			Formats: []formats.Format{&formats.VP8{PayloadTyp: 96}},
+		}},
+		Path: "rec.ts",
+	}
+	err = r.Start()
+	require.EqualError(t, err, "no supported formats found")
+}
@@ -0,0 +1,46 @@
+package mpegtsrecorder
+
+import (
+	"bufio"
+	"os"
+	"time"
+)
+
+type segment struct {
+	path     string
+	startDTS time.Duration
+
+	f    *os.File
+	bw   *bufio.Writer
+	size uint64
+}
+
+func newSegment(path string, startDTS time.Duration) (*segment, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &segment{
+		path:     path,
+		startDTS: startDTS,
+		f:        f,
+		bw:       bufio.NewWriter(f),
+	}, nil
+}
+
+func (s *segment) close() error {
+	err := s.bw.Flush()
+	err2 := s.f.Close()
+	if err == nil {
+		err = err2
+	}
+	return err
+}
+
+// Write implements io.Writer.
+func (s *segment) Write(p []byte) (int, error) {
+	n, err := s.bw.Write(p)
+	s.size += uint64(n)
+	return n, err
+}
@@ -0,0 +1,230 @@
+package mpegtsrecorder
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bluenviron/mediacommon/pkg/codecs/h264"
+	"github.com/bluenviron/mediacommon/pkg/codecs/h265"
+	"github.com/pion/rtp"
+
+	"github.com/bluenviron/gortsplib/v3"
+	"github.com/bluenviron/gortsplib/v3/pkg/formats"
+)
+
+const mpeg1AudioPayloadHeaderSize = 4
+
+type track struct {
+	r  *Recorder
+	wt *WriterTrack
+
+	dec    *gortsplib.FrameDecoder
+	frames []*gortsplib.Frame
+
+	h264SPS []byte
+	h264PPS []byte
+
+	h265VPS []byte
+	h265SPS []byte
+	h265PPS []byte
+}
+
+func newTrack(r *Recorder, pid uint16, forma formats.Format) *track {
+	t := &track{
+		r: r,
+		wt: &WriterTrack{
+			PID:    pid,
+			Format: forma,
+		},
+	}
+
+	switch tforma := forma.(type) {
+	case *formats.H264:
+		t.h264SPS, t.h264PPS = tforma.SafeParams()
+
+	case *formats.H265:
+		t.h265VPS, t.h265SPS, t.h265PPS = tforma.SafeParams()
+
+	case *formats.MPEG4Audio:
+		if tforma.Config == nil {
+			return nil
+		}
+
+	case *formats.Opus, *formats.MPEG2Audio:
+
+	default:
+		return nil
+	}
+
+	t.dec = gortsplib.NewFrameDecoder(forma, func(fr *gortsplib.Frame) {
+		t.frames = append(t.frames, fr)
+	})
+
+	return t
+}
+
+func (t *track) isVideo() bool {
+	return t.wt.isVideo()
+}
+
+func (t *track) writePacketRTP(pkt *rtp.Packet, now time.Time) error {
+	err := t.dec.ProcessPacket(pkt)
+	if err != nil {
+		return err
+	}
+
+	frames := t.frames
+	t.frames = nil
+
+	for _, fr := range frames {
+		pts := t.r.timeDec.Decode(t, fr.PTS, now)
+		dts := pts + fr.DTS - fr.PTS
+
+		err := t.writeFrame(fr, pts, dts)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (t *track) writeFrame(fr *gortsplib.Frame, pts time.Duration, dts time.Duration) error {
+	switch t.wt.Format.(type) {
+	case *formats.H264:
+		return t.writeH264(fr, pts, dts)
+
+	case *formats.H265:
+		return t.writeH265(fr, pts, dts)
+
+	case *formats.MPEG4Audio:
+		ok, err := t.r.prepareWrite(t, pts, true)
+		if !ok || err != nil {
+			return err
+		}
+		return t.r.w.WriteMPEG4Audio(t.wt, pts, fr.Payload)
+
+	case *formats.Opus:
+		ok, err := t.r.prepareWrite(t, pts, true)
+		if !ok || err != nil {
+			return err
+		}
+		return t.r.w.WriteOpus(t.wt, pts, fr.Payload[0])
+
+	default:
+		return t.writeMPEG2Audio(fr, pts)
+	}
+}
+
+func (t *track) writeH264(fr *gortsplib.Frame, pts time.Duration, dts time.Duration) error {
+	filteredNALUs := make([][]byte, 0, len(fr.Payload))
+
+	for _, nalu := range fr.Payload {
+		if len(nalu) == 0 {
+			continue
+		}
+
+		switch h264.NALUType(nalu[0] & 0x1F) {
+		case h264.NALUTypeSPS:
+			t.h264SPS = append([]byte(nil), nalu...)
+			continue
+
+		case h264.NALUTypePPS:
+			t.h264PPS = append([]byte(nil), nalu...)
+			continue
+
+		case h264.NALUTypeAccessUnitDelimiter:
+			continue
+		}
+
+		filteredNALUs = append(filteredNALUs, nalu)
+	}
+
+	if len(filteredNALUs) == 0 {
+		return nil
+	}
+
+	// add SPS and PPS before every group that contains an IDR
+	if fr.KeyFrame {
+		if t.h264SPS == nil || t.h264PPS == nil {
+			return fmt.Errorf("H264 parameters not received yet")
+		}
+
+		filteredNALUs = append([][]byte{t.h264SPS, t.h264PPS}, filteredNALUs...)
+	}
+
+	ok, err := t.r.prepareWrite(t, dts, fr.KeyFrame)
+	if !ok || err != nil {
+		return err
+	}
+
+	return t.r.w.WriteH26x(t.wt, pts, dts, fr.KeyFrame, filteredNALUs)
+}
+
+func (t *track) writeH265(fr *gortsplib.Frame, pts time.Duration, dts time.Duration) error {
+	filteredNALUs := make([][]byte, 0, len(fr.Payload))
+
+	for _, nalu := range fr.Payload {
+		if len(nalu) == 0 {
+			continue
+		}
+
+		switch h265.NALUType((nalu[0] >> 1) & 0b111111) {
+		case h265.NALUType_VPS_NUT:
+			t.h265VPS = append([]byte(nil), nalu...)
+			continue
+
+		case h265.NALUType_SPS_NUT:
+			t.h265SPS = append([]byte(nil), nalu...)
+			continue
+
+		case h265.NALUType_PPS_NUT:
+			t.h265PPS = append([]byte(nil), nalu...)
+			continue
+
+		case h265.NALUType_AUD_NUT:
+			continue
+		}
+
+		filteredNALUs = append(filteredNALUs, nalu)
+	}
+
+	if len(filteredNALUs) == 0 {
+		return nil
+	}
+
+	// add VPS, SPS and PPS before every group that contains a random access point
+	if fr.KeyFrame {
+		if t.h265VPS == nil || t.h265SPS == nil || t.h265PPS == nil {
+			return fmt.Errorf("H265 parameters not received yet")
+		}
+
+		filteredNALUs = append([][]byte{t.h265VPS, t.h265SPS, t.h265PPS}, filteredNALUs...)
+	}
+
+	ok, err := t.r.prepareWrite(t, dts, fr.KeyFrame)
+	if !ok || err != nil {
+		return err
+	}
+
+	return t.r.w.WriteH26x(t.wt, pts, dts, fr.KeyFrame, filteredNALUs)
+}
+
+func (t *track) writeMPEG2Audio(fr *gortsplib.Frame, pts time.Duration) error {
+	// frames of formats without a decoder contain the RTP payload.
+	// RFC2250, section 3.5
+	payload := fr.Payload[0]
+	if len(payload) <= mpeg1AudioPayloadHeaderSize {
+		return fmt.Errorf("invalid MPEG-1/2 Audio payload size (%d)", len(payload))
+	}
+
+	fragOffset := uint16(payload[2])<<8 | uint16(payload[3])
+	frameStart := fragOffset == 0
+
+	ok, err := t.r.prepareWrite(t, pts, frameStart)
+	if !ok || err != nil {
+		return err
+	}
+
+	return t.r.w.WriteMPEG2Audio(t.wt, pts, frameStart, payload[mpeg1AudioPayloadHeaderSize:])
+}
@@ -0,0 +1,285 @@
+package mpegtsrecorder
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/asticode/go-astits"
+	"github.com/bluenviron/mediacommon/pkg/codecs/h264"
+	"github.com/bluenviron/mediacommon/pkg/codecs/h265"
+	"github.com/bluenviron/mediacommon/pkg/codecs/mpeg4audio"
+
+	"github.com/bluenviron/gortsplib/v3/pkg/formats"
+	"github.com/bluenviron/gortsplib/v3/pkg/rtptime"
+)
+
+const (
+	timestampClock = 90000
+	timestampMask  = (1 << 33) - 1
+
+	// timestamps are shifted forward in order to prevent the DTS of
+	// the first frames from being negative.
+	timestampOffset = 1 * time.Second
+)
+
+func durationToTimestamp(d time.Duration) int64 {
+	return rtptime.DurationToTicks(d+timestampOffset, timestampClock) & timestampMask
+}
+
+func opusControlHeader(size int) []byte {
+	// prefix (11 bits), no start trim, no end trim, no control extension
+	ret := []byte{0x7F, 0xE0}
+	for size >= 255 {
+		ret = append(ret, 255)
+		size -= 255
+	}
+	return append(ret, byte(size))
+}
+
+// WriterTrack is a track of a Writer.
+type WriterTrack struct {
+	// PID of the track.
+	PID uint16
+
+	// format of the track.
+	// Supported formats are H264, H265, MPEG-4 Audio (AAC), Opus and MPEG-1/2 Audio.
+	Format formats.Format
+}
+
+func (t *WriterTrack) isVideo() bool {
+	switch t.Format.(type) {
+	case *formats.H264, *formats.H265:
+		return true
+	}
+	return false
+}
+
+func (t *WriterTrack) elementaryStream() astits.PMTElementaryStream {
+	es := astits.PMTElementaryStream{
+		ElementaryPID: t.PID,
+	}
+
+	switch forma := t.Format.(type) {
+	case *formats.H264:
+		es.StreamType = astits.StreamTypeH264Video
+
+	case *formats.H265:
+		es.StreamType = astits.StreamTypeH265Video
+
+	case *formats.MPEG4Audio:
+		es.StreamType = astits.StreamTypeAACAudio
+
+	case *formats.Opus:
+		channelCount := uint8(1)
+		if forma.IsStereo {
+			channelCount = 2
+		}
+
+		es.StreamType = astits.StreamTypePrivateData
+		es.ElementaryStreamDescriptors = []*astits.Descriptor{
+			{
+				Length: 4,
+				Tag:    astits.DescriptorTagRegistration,
+				Registration: &astits.DescriptorRegistration{
+					FormatIdentifier: 'O'<<24 | 'p'<<16 | 'u'<<8 | 's',
+				},
+			},
+			{
+				Length: 2,
+				Tag:    astits.DescriptorTagExtension,
+				Extension: &astits.DescriptorExtension{
+					Tag:     0x80,
+					Unknown: &[]uint8{channelCount},
+				},
+			},
+		}
+
+	default:
+		es.StreamType = astits.StreamTypeMPEG1Audio
+	}
+
+	return es
+}
+
+func (t *WriterTrack) streamID() uint8 {
+	switch t.Format.(type) {
+	case *formats.H264, *formats.H265:
+		return 224
+
+	case *formats.Opus:
+		return 189 // private stream 1
+
+	default:
+		return 192
+	}
+}
+
+// switchableWriter allows a MPEG-TS muxer to write into a destination after another,
+// preserving continuity counters.
+type switchableWriter struct {
+	w io.Writer
+}
+
+func (w *switchableWriter) Write(p []byte) (int, error) {
+	return w.w.Write(p)
+}
+
+// Writer writes frames into a MPEG-TS stream.
+// The stream can be split into segments by switching the destination with SetOutput().
+type Writer struct {
+	sw       *switchableWriter
+	mux      *astits.Muxer
+	pcrTrack *WriterTrack
+}
+
+// NewWriter allocates a Writer.
+// The first video track, or the first track when there are no video tracks, is used as PCR track.
+func NewWriter(w io.Writer, tracks []*WriterTrack) (*Writer, error) {
+	wr := &Writer{
+		sw: &switchableWriter{w: w},
+	}
+
+	wr.mux = astits.NewMuxer(context.Background(), wr.sw)
+
+	for _, t := range tracks {
+		err := wr.mux.AddElementaryStream(t.elementaryStream())
+		if err != nil {
+			return nil, err
+		}
+
+		if wr.pcrTrack == nil && t.isVideo() {
+			wr.pcrTrack = t
+		}
+	}
+
+	if wr.pcrTrack == nil {
+		wr.pcrTrack = tracks[0]
+	}
+
+	wr.mux.SetPCRPID(wr.pcrTrack.PID)
+
+	return wr, nil
+}
+
+// SetOutput redirects the stream to another destination, and writes PAT and PMT into it.
+func (w *Writer) SetOutput(out io.Writer) error {
+	w.sw.w = out
+	_, err := w.mux.WriteTables()
+	return err
+}
+
+// WriteH26x writes a H264 or H265 access unit.
+// An access unit delimiter is prepended, since it is required by some players.
+func (w *Writer) WriteH26x(
+	t *WriterTrack,
+	pts time.Duration,
+	dts time.Duration,
+	randomAccess bool,
+	au [][]byte,
+) error {
+	var aud []byte
+	if _, ok := t.Format.(*formats.H265); ok {
+		aud = []byte{byte(h265.NALUType_AUD_NUT) << 1, 1, 0x50}
+	} else {
+		aud = []byte{byte(h264.NALUTypeAccessUnitDelimiter), 240}
+	}
+
+	enc, err := h264.AnnexBMarshal(append([][]byte{aud}, au...))
+	if err != nil {
+		return err
+	}
+
+	return w.writeData(t, pts, dts, true, randomAccess, enc)
+}
+
+// WriteMPEG4Audio writes MPEG-4 Audio access units, encoded with ADTS.
+func (w *Writer) WriteMPEG4Audio(t *WriterTrack, pts time.Duration, aus [][]byte) error {
+	config := t.Format.(*formats.MPEG4Audio).Config
+
+	pkts := make(mpeg4audio.ADTSPackets, len(aus))
+	for i, au := range aus {
+		pkts[i] = &mpeg4audio.ADTSPacket{
+			Type:         config.Type,
+			SampleRate:   config.SampleRate,
+			ChannelCount: config.ChannelCount,
+			AU:           au,
+		}
+	}
+
+	enc, err := pkts.Marshal()
+	if err != nil {
+		return err
+	}
+
+	return w.writeData(t, pts, pts, true, true, enc)
+}
+
+// WriteOpus writes an Opus packet.
+func (w *Writer) WriteOpus(t *WriterTrack, pts time.Duration, packet []byte) error {
+	enc := append(opusControlHeader(len(packet)), packet...)
+	return w.writeData(t, pts, pts, true, true, enc)
+}
+
+// WriteMPEG2Audio writes MPEG-1/2 Audio data.
+// Data that does not start a frame is written without timestamp,
+// since MPEG-TS allows frames to be split between PES packets.
+func (w *Writer) WriteMPEG2Audio(t *WriterTrack, pts time.Duration, frameStart bool, data []byte) error {
+	return w.writeData(t, pts, pts, frameStart, frameStart, data)
+}
+
+func (w *Writer) writeData(
+	t *WriterTrack,
+	pts time.Duration,
+	dts time.Duration,
+	hasPTS bool,
+	randomAccess bool,
+	data []byte,
+) error {
+	oh := &astits.PESOptionalHeader{
+		MarkerBits: 2,
+	}
+
+	switch {
+	case !hasPTS:
+		oh.PTSDTSIndicator = astits.PTSDTSIndicatorNoPTSOrDTS
+
+	case dts == pts:
+		oh.PTSDTSIndicator = astits.PTSDTSIndicatorOnlyPTS
+		oh.PTS = &astits.ClockReference{Base: durationToTimestamp(pts)}
+
+	default:
+		oh.PTSDTSIndicator = astits.PTSDTSIndicatorBothPresent
+		oh.DTS = &astits.ClockReference{Base: durationToTimestamp(dts)}
+		oh.PTS = &astits.ClockReference{Base: durationToTimestamp(pts)}
+	}
+
+	var af *astits.PacketAdaptationField
+
+	if randomAccess {
+		af = &astits.PacketAdaptationField{
+			RandomAccessIndicator: true,
+		}
+	}
+
+	if t == w.pcrTrack && hasPTS {
+		if af == nil {
+			af = &astits.PacketAdaptationField{}
+		}
+		af.HasPCR = true
+		af.PCR = &astits.ClockReference{Base: durationToTimestamp(dts)}
+	}
+
+	_, err := w.mux.WriteData(&astits.MuxerData{
+		PID:             t.PID,
+		AdaptationField: af,
+		PES: &astits.PESData{
+			Header: &astits.PESHeader{
+				OptionalHeader: oh,
+				StreamID:       t.streamID(),
+			},
+			Data: data,
+		},
+	})
+	return err
+}
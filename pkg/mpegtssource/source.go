@@ -0,0 +1,523 @@
+// Package mpegtssource contains a source of on-demand streams that reads MPEG-TS files.
+package mpegtssource
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/asticode/go-astits"
+	"github.com/bluenviron/mediacommon/pkg/codecs/h264"
+	"github.com/bluenviron/mediacommon/pkg/codecs/mpeg4audio"
+	"github.com/pion/rtp"
+
+	"github.com/bluenviron/gortsplib/v3/pkg/formats"
+	"github.com/bluenviron/gortsplib/v3/pkg/formats/rtph264"
+	"github.com/bluenviron/gortsplib/v3/pkg/formats/rtpmpeg4audio"
+	"github.com/bluenviron/gortsplib/v3/pkg/media"
+)
+
+const (
+	packetSize     = 188
+	timestampMask  = (1 << 33) - 1
+	timestampClock = 90000
+)
+
+func timestampToDuration(ts int64) time.Duration {
+	return time.Duration(ts) * time.Second / timestampClock
+}
+
+type track struct {
+	media *media.Media
+
+	h264Format *formats.H264
+	h264Enc    *rtph264.Encoder
+
+	aacFormat *formats.MPEG4Audio
+	aacEnc    *rtpmpeg4audio.Encoder
+}
+
+type keyframe struct {
+	offset int64
+	dts    time.Duration
+}
+
+type pesBuffer struct {
+	offset int64
+	buf    []byte
+}
+
+type queuedPacket struct {
+	media *media.Media
+	pkt   *rtp.Packet
+	pos   time.Duration
+}
+
+// Source is a source of on-demand streams that reads a MPEG-TS file.
+// It implements gortsplib.ServerVODSource.
+// Supported codecs are H264 and MPEG-4 Audio (AAC).
+type Source struct {
+	f         *os.File
+	tracks    map[uint16]*track
+	medias    media.Medias
+	startDTS  int64
+	duration  time.Duration
+	keyframes []keyframe
+
+	dmx    *astits.Demuxer
+	offset int64
+	pes    map[uint16]*pesBuffer
+	queue  []queuedPacket
+	minPos time.Duration
+	eof    bool
+}
+
+// Open opens a MPEG-TS file and indexes its keyframes.
+func Open(path string) (*Source, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Source{
+		f: f,
+	}
+
+	err = s.readTracks()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	err = s.index()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	for i, pid := range s.sortedPIDs() {
+		t := s.tracks[pid]
+
+		switch {
+		case t.h264Format != nil:
+			t.h264Format.PayloadTyp = 96 + uint8(i)
+			if t.h264Format.SPS == nil || t.h264Format.PPS == nil {
+				f.Close()
+				return nil, fmt.Errorf("H264 parameters not found")
+			}
+			t.h264Enc = t.h264Format.CreateEncoder()
+			t.media = &media.Media{
+				Type:    media.TypeVideo,
+				Formats: []formats.Format{t.h264Format},
+			}
+
+		default:
+			t.aacFormat.PayloadTyp = 96 + uint8(i)
+			if t.aacFormat.Config == nil {
+				f.Close()
+				return nil, fmt.Errorf("MPEG-4 Audio configuration not found")
+			}
+			t.aacEnc = t.aacFormat.CreateEncoder()
+			t.media = &media.Media{
+				Type:    media.TypeAudio,
+				Formats: []formats.Format{t.aacFormat},
+			}
+		}
+
+		s.medias = append(s.medias, t.media)
+	}
+
+	_, err = s.Seek(0)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Close implements gortsplib.ServerVODSource.
+func (s *Source) Close() error {
+	return s.f.Close()
+}
+
+// Medias implements gortsplib.ServerVODSource.
+func (s *Source) Medias() media.Medias {
+	return s.medias
+}
+
+// Duration implements gortsplib.ServerVODSource.
+func (s *Source) Duration() time.Duration {
+	return s.duration
+}
+
+func (s *Source) sortedPIDs() []uint16 {
+	ret := make([]uint16, 0, len(s.tracks))
+	for pid := range s.tracks {
+		ret = append(ret, pid)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i] < ret[j]
+	})
+	return ret
+}
+
+// readTracks reads the program map table.
+func (s *Source) readTracks() error {
+	dmx := astits.NewDemuxer(context.Background(), bufio.NewReader(s.f), astits.DemuxerOptPacketSize(packetSize))
+
+	for {
+		d, err := dmx.NextData()
+		if err != nil {
+			if err == astits.ErrNoMorePackets {
+				return fmt.Errorf("no program map table found")
+			}
+			return err
+		}
+
+		if d.PMT == nil {
+			continue
+		}
+
+		s.tracks = make(map[uint16]*track)
+
+		for _, es := range d.PMT.ElementaryStreams {
+			switch es.StreamType {
+			case astits.StreamTypeH264Video:
+				s.tracks[es.ElementaryPID] = &track{
+					h264Format: &formats.H264{
+						PacketizationMode: 1,
+					},
+				}
+
+			case astits.StreamTypeAACAudio:
+				s.tracks[es.ElementaryPID] = &track{
+					aacFormat: &formats.MPEG4Audio{
+						SizeLength:       13,
+						IndexLength:      3,
+						IndexDeltaLength: 3,
+					},
+				}
+			}
+		}
+
+		if len(s.tracks) == 0 {
+			return fmt.Errorf("no supported tracks found")
+		}
+
+		return nil
+	}
+}
+
+// index reads the whole file in order to find codec parameters,
+// keyframes and duration.
+func (s *Source) index() error {
+	s.startDTS = -1
+	var endPTS time.Duration
+
+	err := s.reset(0)
+	if err != nil {
+		return err
+	}
+
+	for {
+		pid, pes, err := s.nextPES()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+
+		t := s.tracks[pid]
+
+		pts, dts, payload, err := parsePES(pes.buf)
+		if err != nil {
+			continue
+		}
+
+		if s.startDTS < 0 {
+			s.startDTS = dts
+		}
+
+		relPTS := timestampToDuration((pts - s.startDTS) & timestampMask)
+		relDTS := timestampToDuration((dts - s.startDTS) & timestampMask)
+
+		if relPTS > endPTS {
+			endPTS = relPTS
+		}
+
+		if t.h264Format != nil {
+			nalus, err := h264.AnnexBUnmarshal(payload)
+			if err != nil {
+				continue
+			}
+
+			for _, nalu := range nalus {
+				switch h264.NALUType(nalu[0] & 0x1F) {
+				case h264.NALUTypeSPS:
+					if t.h264Format.SPS == nil {
+						t.h264Format.SPS = append([]byte(nil), nalu...)
+					}
+
+				case h264.NALUTypePPS:
+					if t.h264Format.PPS == nil {
+						t.h264Format.PPS = append([]byte(nil), nalu...)
+					}
+				}
+			}
+
+			if h264.IDRPresent(nalus) {
+				s.keyframes = append(s.keyframes, keyframe{
+					offset: pes.offset,
+					dts:    relDTS,
+				})
+			}
+		} else if t.aacFormat.Config == nil {
+			var pkts mpeg4audio.ADTSPackets
+			err := pkts.Unmarshal(payload)
+			if err != nil {
+				continue
+			}
+
+			t.aacFormat.Config = &mpeg4audio.Config{
+				Type:         pkts[0].Type,
+				SampleRate:   pkts[0].SampleRate,
+				ChannelCount: pkts[0].ChannelCount,
+			}
+		}
+	}
+
+	if s.startDTS < 0 {
+		return fmt.Errorf("no frames found")
+	}
+
+	s.duration = endPTS
+
+	return nil
+}
+
+// reset moves the read position to the given offset.
+func (s *Source) reset(offset int64) error {
+	_, err := s.f.Seek(offset, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	s.dmx = astits.NewDemuxer(context.Background(), bufio.NewReader(s.f), astits.DemuxerOptPacketSize(packetSize))
+	s.offset = offset
+	s.pes = make(map[uint16]*pesBuffer)
+	s.queue = nil
+	s.eof = false
+
+	return nil
+}
+
+// nextPES returns the next complete PES of a supported track.
+func (s *Source) nextPES() (uint16, *pesBuffer, error) {
+	for {
+		if s.eof {
+			// return remaining PES
+			for pid, pes := range s.pes {
+				delete(s.pes, pid)
+				return pid, pes, nil
+			}
+			return 0, nil, io.EOF
+		}
+
+		offset := s.offset
+
+		pkt, err := s.dmx.NextPacket()
+		if err != nil {
+			if err == astits.ErrNoMorePackets {
+				s.eof = true
+				continue
+			}
+			return 0, nil, err
+		}
+
+		s.offset += packetSize
+
+		if _, ok := s.tracks[pkt.Header.PID]; !ok {
+			continue
+		}
+
+		cur := s.pes[pkt.Header.PID]
+
+		if pkt.Header.PayloadUnitStartIndicator {
+			s.pes[pkt.Header.PID] = &pesBuffer{
+				offset: offset,
+				buf:    append([]byte(nil), pkt.Payload...),
+			}
+
+			if cur != nil {
+				return pkt.Header.PID, cur, nil
+			}
+			continue
+		}
+
+		// wait for the beginning of a PES
+		if cur != nil {
+			cur.buf = append(cur.buf, pkt.Payload...)
+		}
+	}
+}
+
+func parseTimestamp(buf []byte) int64 {
+	return int64(buf[0]>>1&0x07)<<30 |
+		int64(buf[1])<<22 |
+		int64(buf[2]>>1)<<15 |
+		int64(buf[3])<<7 |
+		int64(buf[4]>>1)
+}
+
+// parsePES returns PTS, DTS and payload of a PES.
+func parsePES(buf []byte) (int64, int64, []byte, error) {
+	if len(buf) < 9 || buf[0] != 0 || buf[1] != 0 || buf[2] != 1 {
+		return 0, 0, nil, fmt.Errorf("invalid PES header")
+	}
+
+	flags := buf[7] >> 6
+	headerLen := int(buf[8])
+
+	if len(buf) < 9+headerLen {
+		return 0, 0, nil, fmt.Errorf("invalid PES header")
+	}
+
+	switch flags {
+	case 2:
+		if headerLen < 5 {
+			return 0, 0, nil, fmt.Errorf("invalid PES header")
+		}
+		pts := parseTimestamp(buf[9:])
+		return pts, pts, buf[9+headerLen:], nil
+
+	case 3:
+		if headerLen < 10 {
+			return 0, 0, nil, fmt.Errorf("invalid PES header")
+		}
+		return parseTimestamp(buf[9:]), parseTimestamp(buf[14:]), buf[9+headerLen:], nil
+	}
+
+	return 0, 0, nil, fmt.Errorf("PTS is missing")
+}
+
+// Seek implements gortsplib.ServerVODSource.
+func (s *Source) Seek(pos time.Duration) (time.Duration, error) {
+	var offset int64
+	minPos := pos
+
+	if len(s.keyframes) != 0 {
+		kf := s.keyframes[0]
+		for _, k := range s.keyframes[1:] {
+			if k.dts > pos {
+				break
+			}
+			kf = k
+		}
+		offset = kf.offset
+		minPos = kf.dts
+	}
+
+	err := s.reset(offset)
+	if err != nil {
+		return 0, err
+	}
+
+	s.minPos = minPos
+	return minPos, nil
+}
+
+// ReadPacket implements gortsplib.ServerVODSource.
+func (s *Source) ReadPacket() (*media.Media, *rtp.Packet, time.Duration, error) {
+	for len(s.queue) == 0 {
+		pid, pes, err := s.nextPES()
+		if err != nil {
+			return nil, nil, 0, err
+		}
+
+		err = s.processPES(s.tracks[pid], pes)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+	}
+
+	p := s.queue[0]
+	s.queue = s.queue[1:]
+	return p.media, p.pkt, p.pos, nil
+}
+
+// processPES converts a PES into RTP packets.
+// Invalid PES are skipped.
+func (s *Source) processPES(t *track, pes *pesBuffer) error {
+	pts, dts, payload, err := parsePES(pes.buf)
+	if err != nil {
+		return nil
+	}
+
+	relPTS := timestampToDuration((pts - s.startDTS) & timestampMask)
+	relDTS := timestampToDuration((dts - s.startDTS) & timestampMask)
+
+	// skip frames that precede the seek position
+	if relDTS < s.minPos {
+		return nil
+	}
+
+	var pkts []*rtp.Packet
+
+	if t.h264Format != nil {
+		nalus, err := h264.AnnexBUnmarshal(payload)
+		if err != nil {
+			return nil
+		}
+
+		// remove access unit delimiters
+		n := 0
+		for _, nalu := range nalus {
+			if h264.NALUType(nalu[0]&0x1F) != h264.NALUTypeAccessUnitDelimiter {
+				nalus[n] = nalu
+				n++
+			}
+		}
+		nalus = nalus[:n]
+
+		if len(nalus) == 0 {
+			return nil
+		}
+
+		pkts, err = t.h264Enc.Encode(nalus, relPTS)
+		if err != nil {
+			return err
+		}
+	} else {
+		var adtsPkts mpeg4audio.ADTSPackets
+		err := adtsPkts.Unmarshal(payload)
+		if err != nil {
+			return nil
+		}
+
+		aus := make([][]byte, len(adtsPkts))
+		for i, p := range adtsPkts {
+			aus[i] = p.AU
+		}
+
+		pkts, err = t.aacEnc.Encode(aus, relPTS)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, pkt := range pkts {
+		s.queue = append(s.queue, queuedPacket{
+			media: t.media,
+			pkt:   pkt,
+			pos:   relDTS,
+		})
+	}
+
+	return nil
+}
@@ -0,0 +1,182 @@
+package mpegtssource
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/asticode/go-astits"
+	"github.com/bluenviron/mediacommon/pkg/codecs/h264"
+	"github.com/bluenviron/mediacommon/pkg/codecs/mpeg4audio"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/gortsplib/v3/pkg/formats"
+	"github.com/bluenviron/gortsplib/v3/pkg/media"
+)
+
+var (
+	testSPS = []byte{
+		0x67, 0x64, 0x00, 0x0c, 0xac, 0x3b, 0x50, 0xb0,
+		0x4b, 0x42, 0x00, 0x00, 0x03, 0x00, 0x02, 0x00,
+		0x00, 0x03, 0x00, 0x3d, 0x08,
+	}
+	testPPS = []byte{0x68, 0xee, 0x3c, 0x80}
+)
+
+func writeTestFile(t *testing.T) string {
+	fpath := filepath.Join(t.TempDir(), "test.ts")
+
+	f, err := os.Create(fpath)
+	require.NoError(t, err)
+	defer f.Close()
+
+	mux := astits.NewMuxer(context.Background(), f)
+	mux.AddElementaryStream(astits.PMTElementaryStream{
+		ElementaryPID: 256,
+		StreamType:    astits.StreamTypeH264Video,
+	})
+	mux.AddElementaryStream(astits.PMTElementaryStream{
+		ElementaryPID: 257,
+		StreamType:    astits.StreamTypeAACAudio,
+	})
+	mux.SetPCRPID(256)
+
+	// timestamps do not start from zero
+	const offset = 10 * 90000
+
+	for i := 0; i < 6; i++ {
+		// a keyframe every second
+		var nalus [][]byte
+		if (i % 2) == 0 {
+			nalus = [][]byte{testSPS, testPPS, {byte(h264.NALUTypeIDR), byte(i)}}
+		} else {
+			nalus = [][]byte{{byte(h264.NALUTypeNonIDR), byte(i)}}
+		}
+
+		annexb, err := h264.AnnexBMarshal(nalus)
+		require.NoError(t, err)
+
+		_, err = mux.WriteData(&astits.MuxerData{
+			PID: 256,
+			PES: &astits.PESData{
+				Header: &astits.PESHeader{
+					OptionalHeader: &astits.PESOptionalHeader{
+						MarkerBits:      2,
+						PTSDTSIndicator: astits.PTSDTSIndicatorOnlyPTS,
+						PTS:             &astits.ClockReference{Base: offset + int64(i)*45000},
+					},
+					StreamID: 224,
+				},
+				Data: annexb,
+			},
+		})
+		require.NoError(t, err)
+
+		adts, err := mpeg4audio.ADTSPackets{{
+			Type:         mpeg4audio.ObjectTypeAACLC,
+			SampleRate:   48000,
+			ChannelCount: 2,
+			AU:           []byte{0x01, 0x02, byte(i)},
+		}}.Marshal()
+		require.NoError(t, err)
+
+		_, err = mux.WriteData(&astits.MuxerData{
+			PID: 257,
+			PES: &astits.PESData{
+				Header: &astits.PESHeader{
+					OptionalHeader: &astits.PESOptionalHeader{
+						MarkerBits:      2,
+						PTSDTSIndicator: astits.PTSDTSIndicatorOnlyPTS,
+						PTS:             &astits.ClockReference{Base: offset + int64(i)*45000},
+					},
+					StreamID: 192,
+				},
+				Data: adts,
+			},
+		})
+		require.NoError(t, err)
+	}
+
+	return fpath
+}
+
+func readAll(t *testing.T, s *Source) map[*media.Media][]time.Duration {
+	ret := make(map[*media.Media][]time.Duration)
+
+	for {
+		medi, pkt, pos, err := s.ReadPacket()
+		if err == io.EOF {
+			return ret
+		}
+		require.NoError(t, err)
+		require.Equal(t, medi.Formats[0].PayloadType(), pkt.PayloadType)
+		ret[medi] = append(ret[medi], pos)
+	}
+}
+
+func TestSource(t *testing.T) {
+	s, err := Open(writeTestFile(t))
+	require.NoError(t, err)
+	defer s.Close()
+
+	medias := s.Medias()
+	require.Equal(t, 2, len(medias))
+
+	require.Equal(t, &formats.H264{
+		PayloadTyp:        96,
+		SPS:               testSPS,
+		PPS:               testPPS,
+		PacketizationMode: 1,
+	}, medias[0].Formats[0])
+
+	require.Equal(t, &formats.MPEG4Audio{
+		PayloadTyp: 97,
+		Config: &mpeg4audio.Config{
+			Type:         mpeg4audio.ObjectTypeAACLC,
+			SampleRate:   48000,
+			ChannelCount: 2,
+		},
+		SizeLength:       13,
+		IndexLength:      3,
+		IndexDeltaLength: 3,
+	}, medias[1].Formats[0])
+
+	require.Equal(t, 2500*time.Millisecond, s.Duration())
+
+	all := []time.Duration{
+		0,
+		500 * time.Millisecond,
+		1000 * time.Millisecond,
+		1500 * time.Millisecond,
+		2000 * time.Millisecond,
+		2500 * time.Millisecond,
+	}
+
+	ret := readAll(t, s)
+	require.Equal(t, all, ret[medias[0]])
+	require.Equal(t, all, ret[medias[1]])
+
+	// seek to the keyframe that precedes the position
+	pos, err := s.Seek(1700 * time.Millisecond)
+	require.NoError(t, err)
+	require.Equal(t, 1000*time.Millisecond, pos)
+
+	ret = readAll(t, s)
+	require.Equal(t, all[2:], ret[medias[0]])
+	require.Equal(t, all[2:], ret[medias[1]])
+}
+
+func TestSourceErrors(t *testing.T) {
+	_, err := Open(filepath.Join(t.TempDir(), "missing.ts"))
+	require.Error(t, err)
+
+	fpath := filepath.Join(t.TempDir(), "empty.ts")
+	err = os.WriteFile(fpath, nil, 0o644)
+	require.NoError(t, err)
+
+	_, err = Open(fpath)
+	require.EqualError(t, err, "no program map table found")
+}
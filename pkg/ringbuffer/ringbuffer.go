@@ -13,8 +13,11 @@ type RingBuffer struct {
 	readIndex  uint64
 	writeIndex uint64
 	closed     int64
+	pushClosed int64
+	pushWaits  int64
 	buffer     []unsafe.Pointer
 	event      *event
+	pullEvent  *event
 }
 
 // New allocates a RingBuffer.
@@ -31,13 +34,16 @@ func New(size uint64) (*RingBuffer, error) {
 		writeIndex: 0,
 		buffer:     make([]unsafe.Pointer, size),
 		event:      newEvent(),
+		pullEvent:  newEvent(),
 	}, nil
 }
 
-// Close makes Pull() return false.
+// Close makes Pull() and PushWait() return false.
 func (r *RingBuffer) Close() {
 	atomic.StoreInt64(&r.closed, 1)
+	atomic.StoreInt64(&r.pushClosed, 1)
 	r.event.signal()
+	r.pullEvent.signal()
 }
 
 // Reset restores Pull() behavior after a Close().
@@ -48,14 +54,61 @@ func (r *RingBuffer) Reset() {
 	atomic.SwapUint64(&r.writeIndex, 0)
 	r.readIndex = 1
 	atomic.StoreInt64(&r.closed, 0)
+	atomic.StoreInt64(&r.pushClosed, 0)
 }
 
 // Push pushes data at the end of the buffer.
-func (r *RingBuffer) Push(data interface{}) {
+// If the buffer is full, the oldest unread element is overwritten
+// and false is returned.
+func (r *RingBuffer) Push(data interface{}) bool {
 	writeIndex := atomic.AddUint64(&r.writeIndex, 1)
 	i := writeIndex % r.size
-	atomic.SwapPointer(&r.buffer[i], unsafe.Pointer(&data))
+	old := atomic.SwapPointer(&r.buffer[i], unsafe.Pointer(&data))
 	r.event.signal()
+	return old == nil
+}
+
+// TryPush pushes data at the end of the buffer.
+// If the buffer is full, data is discarded and false is returned.
+func (r *RingBuffer) TryPush(data interface{}) bool {
+	for {
+		writeIndex := atomic.LoadUint64(&r.writeIndex)
+		i := (writeIndex + 1) % r.size
+
+		if atomic.LoadPointer(&r.buffer[i]) != nil {
+			return false
+		}
+
+		if atomic.CompareAndSwapUint64(&r.writeIndex, writeIndex, writeIndex+1) {
+			atomic.StorePointer(&r.buffer[i], unsafe.Pointer(&data))
+			r.event.signal()
+			return true
+		}
+	}
+}
+
+// PushWait pushes data at the end of the buffer.
+// If the buffer is full, it waits until an element is pulled.
+// It returns false if the buffer is closed in the meanwhile.
+func (r *RingBuffer) PushWait(data interface{}) bool {
+	for {
+		// increase pushWaits before trying to push,
+		// in order to be notified by every Pull() that happens later.
+		atomic.AddInt64(&r.pushWaits, 1)
+
+		if atomic.LoadInt64(&r.pushClosed) == 1 {
+			atomic.AddInt64(&r.pushWaits, -1)
+			return false
+		}
+
+		if r.TryPush(data) {
+			atomic.AddInt64(&r.pushWaits, -1)
+			return true
+		}
+
+		r.pullEvent.wait()
+		atomic.AddInt64(&r.pushWaits, -1)
+	}
 }
 
 // Pull pulls data from the beginning of the buffer.
@@ -72,6 +125,11 @@ func (r *RingBuffer) Pull() (interface{}, bool) {
 		}
 
 		r.readIndex++
+
+		if atomic.LoadInt64(&r.pushWaits) > 0 {
+			r.pullEvent.signal()
+		}
+
 		return *res, true
 	}
 }
@@ -75,6 +75,101 @@ func TestClose(t *testing.T) {
 	require.Equal(t, true, ok)
 }
 
+func TestPushOverwrite(t *testing.T) {
+	r, err := New(2)
+	require.NoError(t, err)
+	defer r.Close()
+
+	ok := r.Push([]byte{0x01})
+	require.Equal(t, true, ok)
+
+	ok = r.Push([]byte{0x02})
+	require.Equal(t, true, ok)
+
+	ok = r.Push([]byte{0x03})
+	require.Equal(t, false, ok)
+
+	ret, ok := r.Pull()
+	require.Equal(t, true, ok)
+	require.Equal(t, []byte{0x03}, ret)
+}
+
+func TestTryPush(t *testing.T) {
+	r, err := New(2)
+	require.NoError(t, err)
+	defer r.Close()
+
+	ok := r.TryPush([]byte{0x01})
+	require.Equal(t, true, ok)
+
+	ok = r.TryPush([]byte{0x02})
+	require.Equal(t, true, ok)
+
+	ok = r.TryPush([]byte{0x03})
+	require.Equal(t, false, ok)
+
+	ret, ok := r.Pull()
+	require.Equal(t, true, ok)
+	require.Equal(t, []byte{0x01}, ret)
+
+	ok = r.TryPush([]byte{0x04})
+	require.Equal(t, true, ok)
+
+	ret, ok = r.Pull()
+	require.Equal(t, true, ok)
+	require.Equal(t, []byte{0x02}, ret)
+
+	ret, ok = r.Pull()
+	require.Equal(t, true, ok)
+	require.Equal(t, []byte{0x04}, ret)
+}
+
+func TestPushWait(t *testing.T) {
+	r, err := New(2)
+	require.NoError(t, err)
+
+	r.PushWait([]byte{0x01})
+	r.PushWait([]byte{0x02})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ok := r.PushWait([]byte{0x03})
+		require.Equal(t, true, ok)
+	}()
+
+	select {
+	case <-done:
+		t.Errorf("should not happen")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	ret, ok := r.Pull()
+	require.Equal(t, true, ok)
+	require.Equal(t, []byte{0x01}, ret)
+	<-done
+
+	done = make(chan struct{})
+	go func() {
+		defer close(done)
+		ok := r.PushWait([]byte{0x04})
+		require.Equal(t, false, ok)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	r.Close()
+	<-done
+
+	for _, cmp := range [][]byte{{0x02}, {0x03}} {
+		ret, ok = r.Pull()
+		require.Equal(t, true, ok)
+		require.Equal(t, cmp, ret)
+	}
+
+	_, ok = r.Pull()
+	require.Equal(t, false, ok)
+}
+
 func BenchmarkPushPullContinuous(b *testing.B) {
 	r, _ := New(1024 * 8)
 	defer r.Close()
@@ -0,0 +1,268 @@
+package rtmpbridge
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+const (
+	amf0TypeNumber      = 0x00
+	amf0TypeBoolean     = 0x01
+	amf0TypeString      = 0x02
+	amf0TypeObject      = 0x03
+	amf0TypeNull        = 0x05
+	amf0TypeUndefined   = 0x06
+	amf0TypeECMAArray   = 0x08
+	amf0TypeObjectEnd   = 0x09
+	amf0TypeStrictArray = 0x0A
+	amf0TypeLongString  = 0x0C
+)
+
+// amf0Entry is an entry of an AMF0 object.
+type amf0Entry struct {
+	Key   string
+	Value interface{}
+}
+
+// amf0Object is an AMF0 object or ECMA array.
+// Entries are kept in order, since some peers depend on it.
+type amf0Object []amf0Entry
+
+// get returns the value of a key.
+func (o amf0Object) get(key string) (interface{}, bool) {
+	for _, e := range o {
+		if e.Key == key {
+			return e.Value, true
+		}
+	}
+	return nil, false
+}
+
+// getString returns the value of a key, if it is a string.
+func (o amf0Object) getString(key string) string {
+	v, _ := o.get(key)
+	s, _ := v.(string)
+	return s
+}
+
+// getNumber returns the value of a key, if it is a number.
+func (o amf0Object) getNumber(key string) (float64, bool) {
+	v, _ := o.get(key)
+	n, ok := v.(float64)
+	return n, ok
+}
+
+// amf0ECMAArrayValue is an object that is encoded as an ECMA array.
+type amf0ECMAArrayValue amf0Object
+
+func amf0DecodeString(buf []byte) (string, []byte, error) {
+	if len(buf) < 2 {
+		return "", nil, fmt.Errorf("not enough bytes")
+	}
+	l := int(binary.BigEndian.Uint16(buf))
+	buf = buf[2:]
+
+	if len(buf) < l {
+		return "", nil, fmt.Errorf("not enough bytes")
+	}
+	return string(buf[:l]), buf[l:], nil
+}
+
+func amf0DecodeObject(buf []byte) (amf0Object, []byte, error) {
+	ret := amf0Object{}
+
+	for {
+		var key string
+		var err error
+		key, buf, err = amf0DecodeString(buf)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if key == "" {
+			if len(buf) < 1 || buf[0] != amf0TypeObjectEnd {
+				return nil, nil, fmt.Errorf("object end not found")
+			}
+			return ret, buf[1:], nil
+		}
+
+		var value interface{}
+		value, buf, err = amf0DecodeValue(buf)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		ret = append(ret, amf0Entry{Key: key, Value: value})
+	}
+}
+
+func amf0DecodeValue(buf []byte) (interface{}, []byte, error) {
+	if len(buf) < 1 {
+		return nil, nil, fmt.Errorf("not enough bytes")
+	}
+
+	typ := buf[0]
+	buf = buf[1:]
+
+	switch typ {
+	case amf0TypeNumber:
+		if len(buf) < 8 {
+			return nil, nil, fmt.Errorf("not enough bytes")
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(buf)), buf[8:], nil
+
+	case amf0TypeBoolean:
+		if len(buf) < 1 {
+			return nil, nil, fmt.Errorf("not enough bytes")
+		}
+		return buf[0] != 0, buf[1:], nil
+
+	case amf0TypeString:
+		return amf0DecodeString(buf)
+
+	case amf0TypeLongString:
+		if len(buf) < 4 {
+			return nil, nil, fmt.Errorf("not enough bytes")
+		}
+		l := int(binary.BigEndian.Uint32(buf))
+		buf = buf[4:]
+
+		if len(buf) < l {
+			return nil, nil, fmt.Errorf("not enough bytes")
+		}
+		return string(buf[:l]), buf[l:], nil
+
+	case amf0TypeObject:
+		return amf0DecodeObject(buf)
+
+	case amf0TypeECMAArray:
+		// the entry count is not reliable and is ignored
+		if len(buf) < 4 {
+			return nil, nil, fmt.Errorf("not enough bytes")
+		}
+		return amf0DecodeObject(buf[4:])
+
+	case amf0TypeStrictArray:
+		if len(buf) < 4 {
+			return nil, nil, fmt.Errorf("not enough bytes")
+		}
+		count := int(binary.BigEndian.Uint32(buf))
+		buf = buf[4:]
+
+		var ret []interface{}
+		for i := 0; i < count; i++ {
+			var value interface{}
+			var err error
+			value, buf, err = amf0DecodeValue(buf)
+			if err != nil {
+				return nil, nil, err
+			}
+			ret = append(ret, value)
+		}
+		return ret, buf, nil
+
+	case amf0TypeNull, amf0TypeUndefined:
+		return nil, buf, nil
+	}
+
+	return nil, nil, fmt.Errorf("unsupported AMF0 type: %d", typ)
+}
+
+// amf0Decode decodes a sequence of AMF0 values.
+func amf0Decode(buf []byte) ([]interface{}, error) {
+	var ret []interface{}
+
+	for len(buf) > 0 {
+		var value interface{}
+		var err error
+		value, buf, err = amf0DecodeValue(buf)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, value)
+	}
+
+	return ret, nil
+}
+
+func appendUint32(buf []byte, v uint32) []byte {
+	return append(buf, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func appendUint64(buf []byte, v uint64) []byte {
+	return appendUint32(appendUint32(buf, uint32(v>>32)), uint32(v))
+}
+
+func amf0EncodeString(buf []byte, s string) []byte {
+	buf = append(buf, byte(len(s)>>8), byte(len(s)))
+	return append(buf, s...)
+}
+
+func amf0EncodeObjectEntries(buf []byte, o []amf0Entry) ([]byte, error) {
+	for _, e := range o {
+		buf = amf0EncodeString(buf, e.Key)
+
+		var err error
+		buf, err = amf0EncodeValue(buf, e.Value)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return append(buf, 0, 0, amf0TypeObjectEnd), nil
+}
+
+func amf0EncodeValue(buf []byte, value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case float64:
+		buf = append(buf, amf0TypeNumber)
+		return appendUint64(buf, math.Float64bits(v)), nil
+
+	case int:
+		return amf0EncodeValue(buf, float64(v))
+
+	case bool:
+		if v {
+			return append(buf, amf0TypeBoolean, 1), nil
+		}
+		return append(buf, amf0TypeBoolean, 0), nil
+
+	case string:
+		if len(v) > 0xFFFF {
+			buf = append(buf, amf0TypeLongString)
+			buf = appendUint32(buf, uint32(len(v)))
+			return append(buf, v...), nil
+		}
+		buf = append(buf, amf0TypeString)
+		return amf0EncodeString(buf, v), nil
+
+	case amf0Object:
+		buf = append(buf, amf0TypeObject)
+		return amf0EncodeObjectEntries(buf, v)
+
+	case amf0ECMAArrayValue:
+		buf = append(buf, amf0TypeECMAArray)
+		buf = appendUint32(buf, uint32(len(v)))
+		return amf0EncodeObjectEntries(buf, v)
+
+	case nil:
+		return append(buf, amf0TypeNull), nil
+	}
+
+	return nil, fmt.Errorf("unsupported AMF0 value: %T", value)
+}
+
+// amf0Encode encodes a sequence of AMF0 values.
+func amf0Encode(values ...interface{}) ([]byte, error) {
+	var buf []byte
+
+	for _, value := range values {
+		var err error
+		buf, err = amf0EncodeValue(buf, value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return buf, nil
+}
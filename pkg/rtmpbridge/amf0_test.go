@@ -0,0 +1,54 @@
+package rtmpbridge
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAMF0(t *testing.T) {
+	values := []interface{}{
+		"connect",
+		float64(1),
+		amf0Object{
+			{Key: "app", Value: "live"},
+			{Key: "fpad", Value: false},
+			{Key: "nested", Value: amf0Object{
+				{Key: "a", Value: nil},
+			}},
+		},
+		nil,
+	}
+
+	buf, err := amf0Encode(values...)
+	require.NoError(t, err)
+
+	dec, err := amf0Decode(buf)
+	require.NoError(t, err)
+	require.Equal(t, values, dec)
+
+	// ECMA arrays are decoded as objects
+	buf, err = amf0Encode(amf0ECMAArrayValue{{Key: "videocodecid", Value: float64(7)}})
+	require.NoError(t, err)
+
+	dec, err = amf0Decode(buf)
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{amf0Object{{Key: "videocodecid", Value: float64(7)}}}, dec)
+}
+
+func TestAMF0DecodeErrors(t *testing.T) {
+	for _, ca := range []struct {
+		name string
+		byts []byte
+	}{
+		{"number", []byte{amf0TypeNumber, 0x01}},
+		{"string", []byte{amf0TypeString, 0x00, 0x05, 'a'}},
+		{"object end", []byte{amf0TypeObject, 0x00, 0x00, 0x01}},
+		{"unsupported", []byte{0x11}},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			_, err := amf0Decode(ca.byts)
+			require.Error(t, err)
+		})
+	}
+}
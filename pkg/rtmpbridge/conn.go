@@ -0,0 +1,567 @@
+package rtmpbridge
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	handshakeSize    = 1536
+	defaultChunkSize = 128
+	localChunkSize   = 65536
+	localWindowSize  = 2500000
+)
+
+// message types.
+const (
+	msgSetChunkSize     = 1
+	msgAbort            = 2
+	msgAcknowledgement  = 3
+	msgUserControl      = 4
+	msgWindowAckSize    = 5
+	msgSetPeerBandwidth = 6
+	msgAudio            = 8
+	msgVideo            = 9
+	msgDataAMF3         = 15
+	msgCommandAMF3      = 17
+	msgDataAMF0         = 18
+	msgCommandAMF0      = 20
+)
+
+// chunk stream IDs used when writing messages.
+const (
+	chunkStreamControl = 2
+	chunkStreamCommand = 3
+	chunkStreamAudio   = 4
+	chunkStreamData    = 5
+	chunkStreamVideo   = 6
+)
+
+// user control events.
+const (
+	userControlPingRequest  = 6
+	userControlPingResponse = 7
+)
+
+// message is a RTMP message.
+type message struct {
+	chunkStreamID uint32
+	timestamp     uint32
+	typ           uint8
+	streamID      uint32
+	body          []byte
+}
+
+// chunkStream is the state of an incoming chunk stream.
+type chunkStream struct {
+	timestamp      uint32
+	timestampDelta uint32
+	extended       bool
+	length         uint32
+	typ            uint8
+	streamID       uint32
+	body           []byte
+}
+
+// countingReader counts read bytes, in order to send acknowledgements.
+type countingReader struct {
+	r io.Reader
+	n uint32
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += uint32(n)
+	return n, err
+}
+
+// conn is a RTMP connection, that reads and writes messages.
+type conn struct {
+	nconn        net.Conn
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+
+	cr             *countingReader
+	br             *bufio.Reader
+	readChunkSize  uint32
+	readWindowSize uint32
+	lastAck        uint32
+	chunkStreams   map[uint32]*chunkStream
+
+	writeMutex     sync.Mutex
+	bw             *bufio.Writer
+	writeChunkSize uint32
+}
+
+func newConn(nconn net.Conn, readTimeout time.Duration, writeTimeout time.Duration) *conn {
+	cr := &countingReader{r: nconn}
+
+	return &conn{
+		nconn:          nconn,
+		readTimeout:    readTimeout,
+		writeTimeout:   writeTimeout,
+		cr:             cr,
+		br:             bufio.NewReader(cr),
+		readChunkSize:  defaultChunkSize,
+		chunkStreams:   make(map[uint32]*chunkStream),
+		bw:             bufio.NewWriter(nconn),
+		writeChunkSize: defaultChunkSize,
+	}
+}
+
+func (c *conn) setReadDeadline() {
+	if c.readTimeout != 0 {
+		c.nconn.SetReadDeadline(time.Now().Add(c.readTimeout))
+	} else {
+		c.nconn.SetReadDeadline(time.Time{})
+	}
+}
+
+func newHandshakePart() []byte {
+	buf := make([]byte, handshakeSize)
+	rand.Read(buf[8:])
+	return buf
+}
+
+// serverHandshake performs the handshake on the server side.
+// The simple handshake is used, that is accepted by all publishers.
+func (c *conn) serverHandshake() error {
+	c.setReadDeadline()
+
+	c0c1 := make([]byte, 1+handshakeSize)
+	_, err := io.ReadFull(c.br, c0c1)
+	if err != nil {
+		return err
+	}
+
+	if c0c1[0] != 3 {
+		return fmt.Errorf("unsupported RTMP version: %d", c0c1[0])
+	}
+
+	// S0, S1, S2 (echo of C1)
+	buf := append([]byte{3}, newHandshakePart()...)
+	buf = append(buf, c0c1[1:]...)
+
+	err = c.writeRaw(buf)
+	if err != nil {
+		return err
+	}
+
+	c2 := make([]byte, handshakeSize)
+	_, err = io.ReadFull(c.br, c2)
+	return err
+}
+
+// clientHandshake performs the handshake on the client side.
+func (c *conn) clientHandshake() error {
+	err := c.writeRaw(append([]byte{3}, newHandshakePart()...))
+	if err != nil {
+		return err
+	}
+
+	c.setReadDeadline()
+
+	s0s1s2 := make([]byte, 1+2*handshakeSize)
+	_, err = io.ReadFull(c.br, s0s1s2)
+	if err != nil {
+		return err
+	}
+
+	if s0s1s2[0] != 3 {
+		return fmt.Errorf("unsupported RTMP version: %d", s0s1s2[0])
+	}
+
+	// C2 (echo of S1)
+	return c.writeRaw(s0s1s2[1 : 1+handshakeSize])
+}
+
+func (c *conn) writeRaw(buf []byte) error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	if c.writeTimeout != 0 {
+		c.nconn.SetWriteDeadline(time.Now().Add(c.writeTimeout))
+	}
+
+	_, err := c.bw.Write(buf)
+	if err != nil {
+		return err
+	}
+	return c.bw.Flush()
+}
+
+func (c *conn) readUint(n int) (uint32, error) {
+	var buf [4]byte
+	_, err := io.ReadFull(c.br, buf[4-n:])
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(buf[:]), nil
+}
+
+// readChunk reads a chunk and returns a message when it is complete.
+func (c *conn) readChunk() (*message, error) {
+	b0, err := c.br.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	chunkType := b0 >> 6
+	csid := uint32(b0 & 0x3F)
+
+	switch csid {
+	case 0:
+		v, err := c.readUint(1)
+		if err != nil {
+			return nil, err
+		}
+		csid = 64 + v
+
+	case 1:
+		var buf [2]byte
+		_, err := io.ReadFull(c.br, buf[:])
+		if err != nil {
+			return nil, err
+		}
+		csid = 64 + uint32(buf[0]) + uint32(buf[1])*256
+	}
+
+	cs, ok := c.chunkStreams[csid]
+	if !ok {
+		if chunkType != 0 {
+			return nil, fmt.Errorf("received a chunk of type %d on a new chunk stream", chunkType)
+		}
+		cs = &chunkStream{}
+		c.chunkStreams[csid] = cs
+	}
+
+	var ts uint32
+
+	if chunkType <= 2 {
+		ts, err = c.readUint(3)
+		if err != nil {
+			return nil, err
+		}
+
+		if chunkType <= 1 {
+			cs.length, err = c.readUint(3)
+			if err != nil {
+				return nil, err
+			}
+
+			typ, err := c.br.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			cs.typ = typ
+
+			if chunkType == 0 {
+				var buf [4]byte
+				_, err := io.ReadFull(c.br, buf[:])
+				if err != nil {
+					return nil, err
+				}
+				cs.streamID = binary.LittleEndian.Uint32(buf[:])
+			}
+		}
+
+		cs.extended = (ts == 0xFFFFFF)
+		if cs.extended {
+			ts, err = c.readUint(4)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		// a new header interrupts any message in progress
+		cs.body = cs.body[:0]
+
+		if chunkType == 0 {
+			cs.timestamp = ts
+			cs.timestampDelta = 0
+		} else {
+			cs.timestamp += ts
+			cs.timestampDelta = ts
+		}
+	} else {
+		if cs.extended {
+			_, err = c.readUint(4)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		// a new message that reuses the previous header
+		if len(cs.body) == 0 {
+			cs.timestamp += cs.timestampDelta
+		}
+	}
+
+	if cs.length > 16*1024*1024 {
+		return nil, fmt.Errorf("message too big (%d bytes)", cs.length)
+	}
+
+	n := cs.length - uint32(len(cs.body))
+	if n > c.readChunkSize {
+		n = c.readChunkSize
+	}
+
+	start := len(cs.body)
+	cs.body = append(cs.body, make([]byte, n)...)
+	_, err = io.ReadFull(c.br, cs.body[start:])
+	if err != nil {
+		return nil, err
+	}
+
+	if uint32(len(cs.body)) < cs.length {
+		return nil, nil
+	}
+
+	msg := &message{
+		chunkStreamID: csid,
+		timestamp:     cs.timestamp,
+		typ:           cs.typ,
+		streamID:      cs.streamID,
+		body:          cs.body,
+	}
+	cs.body = nil
+
+	return msg, nil
+}
+
+// readMessage reads a message.
+// Protocol control messages are handled internally.
+func (c *conn) readMessage() (*message, error) {
+	for {
+		c.setReadDeadline()
+
+		msg, err := c.readChunk()
+		if err != nil {
+			return nil, err
+		}
+
+		// send an acknowledgement when the window is filled
+		if c.readWindowSize != 0 && (c.cr.n-c.lastAck) >= c.readWindowSize {
+			c.lastAck = c.cr.n
+
+			err := c.writeMessage(&message{
+				chunkStreamID: chunkStreamControl,
+				typ:           msgAcknowledgement,
+				body:          appendUint32(nil, c.cr.n),
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if msg == nil {
+			continue
+		}
+
+		switch msg.typ {
+		case msgSetChunkSize:
+			if len(msg.body) != 4 {
+				return nil, fmt.Errorf("invalid SetChunkSize message")
+			}
+			c.readChunkSize = binary.BigEndian.Uint32(msg.body) & 0x7FFFFFFF
+			if c.readChunkSize == 0 {
+				return nil, fmt.Errorf("invalid chunk size")
+			}
+
+		case msgAbort:
+			if len(msg.body) != 4 {
+				return nil, fmt.Errorf("invalid Abort message")
+			}
+			if cs, ok := c.chunkStreams[binary.BigEndian.Uint32(msg.body)]; ok {
+				cs.body = nil
+			}
+
+		case msgWindowAckSize:
+			if len(msg.body) != 4 {
+				return nil, fmt.Errorf("invalid WindowAckSize message")
+			}
+			c.readWindowSize = binary.BigEndian.Uint32(msg.body)
+
+		case msgUserControl:
+			if len(msg.body) >= 6 && binary.BigEndian.Uint16(msg.body) == userControlPingRequest {
+				err := c.writeMessage(&message{
+					chunkStreamID: chunkStreamControl,
+					typ:           msgUserControl,
+					body:          append([]byte{0, userControlPingResponse}, msg.body[2:6]...),
+				})
+				if err != nil {
+					return nil, err
+				}
+			}
+
+		case msgAcknowledgement, msgSetPeerBandwidth:
+
+		default:
+			return msg, nil
+		}
+	}
+}
+
+// writeMessage writes a message, splitting it into chunks.
+func (c *conn) writeMessage(msg *message) error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	if c.writeTimeout != 0 {
+		c.nconn.SetWriteDeadline(time.Now().Add(c.writeTimeout))
+	}
+
+	extended := msg.timestamp >= 0xFFFFFF
+	ts := msg.timestamp
+	if extended {
+		ts = 0xFFFFFF
+	}
+
+	header := []byte{
+		byte(msg.chunkStreamID),
+		byte(ts >> 16), byte(ts >> 8), byte(ts),
+		byte(len(msg.body) >> 16), byte(len(msg.body) >> 8), byte(len(msg.body)),
+		msg.typ,
+		byte(msg.streamID), byte(msg.streamID >> 8), byte(msg.streamID >> 16), byte(msg.streamID >> 24),
+	}
+	if extended {
+		header = appendUint32(header, msg.timestamp)
+	}
+
+	_, err := c.bw.Write(header)
+	if err != nil {
+		return err
+	}
+
+	body := msg.body
+	first := true
+
+	for first || len(body) > 0 {
+		if !first {
+			_, err = c.bw.Write([]byte{0xC0 | byte(msg.chunkStreamID)})
+			if err != nil {
+				return err
+			}
+
+			if extended {
+				_, err = c.bw.Write(appendUint32(nil, msg.timestamp))
+				if err != nil {
+					return err
+				}
+			}
+		}
+		first = false
+
+		n := uint32(len(body))
+		if n > c.writeChunkSize {
+			n = c.writeChunkSize
+		}
+
+		_, err = c.bw.Write(body[:n])
+		if err != nil {
+			return err
+		}
+		body = body[n:]
+	}
+
+	return c.bw.Flush()
+}
+
+// writeControl writes a protocol control message that contains a 32-bit value.
+func (c *conn) writeControl(typ uint8, values ...uint32) error {
+	var body []byte
+	for _, v := range values {
+		body = appendUint32(body, v)
+	}
+
+	return c.writeMessage(&message{
+		chunkStreamID: chunkStreamControl,
+		typ:           typ,
+		body:          body,
+	})
+}
+
+// setWriteChunkSize notifies the peer of a new chunk size and starts using it.
+func (c *conn) setWriteChunkSize(size uint32) error {
+	err := c.writeControl(msgSetChunkSize, size)
+	if err != nil {
+		return err
+	}
+
+	c.writeMutex.Lock()
+	c.writeChunkSize = size
+	c.writeMutex.Unlock()
+	return nil
+}
+
+// writeCommand writes an AMF0 command or data message.
+func (c *conn) writeCommand(chunkStreamID uint32, typ uint8, streamID uint32, values ...interface{}) error {
+	body, err := amf0Encode(values...)
+	if err != nil {
+		return err
+	}
+
+	return c.writeMessage(&message{
+		chunkStreamID: chunkStreamID,
+		typ:           typ,
+		streamID:      streamID,
+		body:          body,
+	})
+}
+
+// decodeCommand decodes a command or data message.
+func decodeCommand(msg *message) ([]interface{}, error) {
+	body := msg.body
+
+	// AMF3 commands start with a byte, then contain AMF0 values
+	if msg.typ == msgCommandAMF3 || msg.typ == msgDataAMF3 {
+		if len(body) < 1 {
+			return nil, fmt.Errorf("invalid AMF3 message")
+		}
+		body = body[1:]
+	}
+
+	values, err := amf0Decode(body)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(values) == 0 {
+		return nil, fmt.Errorf("empty command")
+	}
+
+	return values, nil
+}
+
+// readCommand reads messages until a command with one of the given names is received.
+// Other messages are discarded.
+func (c *conn) readCommand(names ...string) (string, []interface{}, error) {
+	for {
+		msg, err := c.readMessage()
+		if err != nil {
+			return "", nil, err
+		}
+
+		if msg.typ != msgCommandAMF0 && msg.typ != msgCommandAMF3 {
+			continue
+		}
+
+		values, err := decodeCommand(msg)
+		if err != nil {
+			return "", nil, err
+		}
+
+		name, _ := values[0].(string)
+		for _, n := range names {
+			if name == n {
+				return name, values, nil
+			}
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package rtmpbridge
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnMessages(t *testing.T) {
+	nc1, nc2 := net.Pipe()
+	defer nc1.Close()
+	defer nc2.Close()
+
+	c1 := newConn(nc1, 0, 0)
+	c2 := newConn(nc2, 0, 0)
+
+	msgs := []*message{
+		{
+			chunkStreamID: chunkStreamVideo,
+			timestamp:     1000,
+			typ:           msgVideo,
+			streamID:      1,
+			body:          bytes.Repeat([]byte{1, 2, 3, 4}, 100),
+		},
+		{
+			// extended timestamp, with multiple chunks
+			chunkStreamID: chunkStreamAudio,
+			timestamp:     0x1000000,
+			typ:           msgAudio,
+			streamID:      1,
+			body:          bytes.Repeat([]byte{5, 6}, 200),
+		},
+		{
+			chunkStreamID: chunkStreamAudio,
+			timestamp:     0x1000010,
+			typ:           msgAudio,
+			streamID:      1,
+			body:          []byte{7},
+		},
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, msg := range msgs {
+			err := c1.writeMessage(msg)
+			require.NoError(t, err)
+		}
+	}()
+
+	for _, msg := range msgs {
+		recv, err := c2.readMessage()
+		require.NoError(t, err)
+		require.Equal(t, msg, recv)
+	}
+
+	<-done
+
+	// after a SetChunkSize, bigger chunks are used
+	go func() {
+		err := c1.setWriteChunkSize(localChunkSize)
+		require.NoError(t, err)
+		err = c1.writeMessage(msgs[0])
+		require.NoError(t, err)
+	}()
+
+	recv, err := c2.readMessage()
+	require.NoError(t, err)
+	require.Equal(t, msgs[0], recv)
+	require.Equal(t, uint32(localChunkSize), c2.readChunkSize)
+}
+
+func TestConnHandshake(t *testing.T) {
+	nc1, nc2 := net.Pipe()
+	defer nc1.Close()
+	defer nc2.Close()
+
+	done := make(chan error)
+	go func() {
+		done <- newConn(nc1, 0, 0).serverHandshake()
+	}()
+
+	err := newConn(nc2, 0, 0).clientHandshake()
+	require.NoError(t, err)
+	require.NoError(t, <-done)
+}
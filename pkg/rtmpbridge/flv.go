@@ -0,0 +1,134 @@
+package rtmpbridge
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// FLV codec identifiers.
+const (
+	flvCodecAVC       = 7
+	flvSoundFormatAAC = 10
+)
+
+// FLV packet types.
+const (
+	flvPacketTypeSequenceHeader = 0
+	flvPacketTypeData           = 1
+)
+
+// FLV video frame types.
+const (
+	flvFrameTypeKey   = 1
+	flvFrameTypeInter = 2
+)
+
+// avcConfigMarshal encodes an AVCDecoderConfigurationRecord.
+// Specification: ISO 14496-15, section 5.2.4.1
+func avcConfigMarshal(sps []byte, pps []byte) ([]byte, error) {
+	if len(sps) < 4 {
+		return nil, fmt.Errorf("invalid SPS")
+	}
+
+	buf := []byte{
+		1,
+		sps[1], sps[2], sps[3],
+		0xFF, // lengthSizeMinusOne = 3
+		0xE1, // one SPS
+		byte(len(sps) >> 8), byte(len(sps)),
+	}
+	buf = append(buf, sps...)
+	buf = append(buf,
+		1, // one PPS
+		byte(len(pps)>>8), byte(len(pps)))
+	buf = append(buf, pps...)
+
+	return buf, nil
+}
+
+// avcConfigUnmarshal decodes an AVCDecoderConfigurationRecord.
+// The first SPS and the first PPS are returned.
+func avcConfigUnmarshal(buf []byte) ([]byte, []byte, error) {
+	if len(buf) < 6 {
+		return nil, nil, fmt.Errorf("invalid AVC configuration")
+	}
+
+	if buf[4]&0x03 != 3 {
+		return nil, nil, fmt.Errorf("unsupported NALU length size: %d", (buf[4]&0x03)+1)
+	}
+
+	readParams := func(buf []byte, count int) ([]byte, []byte, error) {
+		var first []byte
+
+		for i := 0; i < count; i++ {
+			if len(buf) < 2 {
+				return nil, nil, fmt.Errorf("invalid AVC configuration")
+			}
+			l := int(binary.BigEndian.Uint16(buf))
+			buf = buf[2:]
+
+			if len(buf) < l {
+				return nil, nil, fmt.Errorf("invalid AVC configuration")
+			}
+			if first == nil {
+				first = buf[:l]
+			}
+			buf = buf[l:]
+		}
+
+		return first, buf, nil
+	}
+
+	sps, buf, err := readParams(buf[6:], int(buf[5]&0x1F))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(buf) < 1 {
+		return nil, nil, fmt.Errorf("invalid AVC configuration")
+	}
+
+	pps, _, err := readParams(buf[1:], int(buf[0]))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if sps == nil || pps == nil {
+		return nil, nil, fmt.Errorf("SPS or PPS not found")
+	}
+
+	return sps, pps, nil
+}
+
+// videoTagHeader returns the header of a AVC video tag.
+func videoTagHeader(isKey bool, packetType uint8, compositionTime int32) []byte {
+	frameType := byte(flvFrameTypeInter)
+	if isKey {
+		frameType = flvFrameTypeKey
+	}
+
+	return []byte{
+		frameType<<4 | flvCodecAVC,
+		packetType,
+		byte(compositionTime >> 16), byte(compositionTime >> 8), byte(compositionTime),
+	}
+}
+
+// audioTagHeader returns the header of a AAC audio tag.
+// Rate, size and channels are always set to their maximum value,
+// since the actual values are contained in the AudioSpecificConfig.
+func audioTagHeader(packetType uint8) []byte {
+	return []byte{
+		flvSoundFormatAAC<<4 | 0x0F,
+		packetType,
+	}
+}
+
+// decodeCompositionTime decodes the composition time offset of a video tag, that is a signed 24-bit value.
+func decodeCompositionTime(buf []byte) int32 {
+	v := int32(buf[0])<<16 | int32(buf[1])<<8 | int32(buf[2])
+	if v&0x800000 != 0 {
+		v -= 0x1000000
+	}
+	return v
+}
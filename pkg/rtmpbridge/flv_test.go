@@ -0,0 +1,38 @@
+package rtmpbridge
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	testSPS = []byte{
+		0x67, 0x64, 0x00, 0x0c, 0xac, 0x3b, 0x50, 0xb0,
+		0x4b, 0x42, 0x00, 0x00, 0x03, 0x00, 0x02, 0x00,
+		0x00, 0x03, 0x00, 0x3d, 0x08,
+	}
+
+	testPPS = []byte{0x68, 0xee, 0x3c, 0x80}
+)
+
+func TestAVCConfig(t *testing.T) {
+	buf, err := avcConfigMarshal(testSPS, testPPS)
+	require.NoError(t, err)
+	require.Equal(t, []byte{0x01, 0x64, 0x00, 0x0c, 0xff, 0xe1, 0x00, 0x15}, buf[:8])
+
+	sps, pps, err := avcConfigUnmarshal(buf)
+	require.NoError(t, err)
+	require.Equal(t, testSPS, sps)
+	require.Equal(t, testPPS, pps)
+
+	_, _, err = avcConfigUnmarshal(buf[:10])
+	require.Error(t, err)
+}
+
+func TestCompositionTime(t *testing.T) {
+	for _, v := range []int32{0, 40, -40, 8388607, -8388608} {
+		h := videoTagHeader(false, flvPacketTypeData, v)
+		require.Equal(t, v, decodeCompositionTime(h[2:5]))
+	}
+}
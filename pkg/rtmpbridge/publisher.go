@@ -0,0 +1,529 @@
+package rtmpbridge
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/mediacommon/pkg/codecs/h264"
+	"github.com/pion/rtp"
+
+	"github.com/bluenviron/gortsplib/v3"
+	"github.com/bluenviron/gortsplib/v3/pkg/formats"
+	"github.com/bluenviron/gortsplib/v3/pkg/media"
+	"github.com/bluenviron/gortsplib/v3/pkg/rtptime"
+)
+
+var timeNow = time.Now
+
+// parseURL splits a RTMP URL into host, application and stream key.
+func parseURL(ur string) (string, string, string, error) {
+	u, err := url.Parse(ur)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	if u.Scheme != "rtmp" {
+		return "", "", "", fmt.Errorf("unsupported scheme '%s'", u.Scheme)
+	}
+
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "1935")
+	}
+
+	pa := strings.TrimPrefix(u.Path, "/")
+	i := strings.IndexByte(pa, '/')
+	if i <= 0 || i == len(pa)-1 {
+		return "", "", "", fmt.Errorf("the URL path must contain an application and a stream key")
+	}
+
+	key := pa[i+1:]
+	if u.RawQuery != "" {
+		key += "?" + u.RawQuery
+	}
+
+	return host, pa[:i], key, nil
+}
+
+// Publisher pushes media streams to a RTMP server.
+// The first H264 format and the first MPEG-4 Audio format are pushed,
+// other formats are ignored.
+type Publisher struct {
+	//
+	// parameters (all optional except URL and Medias)
+	//
+	// URL of the stream, in the format rtmp://host[:port]/app/key.
+	URL string
+	// medias to push.
+	Medias media.Medias
+	// timeout of read operations.
+	// It defaults to 10 seconds.
+	ReadTimeout time.Duration
+	// timeout of write operations.
+	// It defaults to 10 seconds.
+	WriteTimeout time.Duration
+
+	//
+	// callbacks (all optional)
+	//
+	// called when a packet cannot be processed or when the connection is closed by the server.
+	OnError func(err error)
+
+	mutex    sync.Mutex
+	c        *conn
+	nconn    net.Conn
+	streamID uint32
+	timeDec  *rtptime.GlobalDecoder
+	closed   bool
+	done     chan struct{}
+	frames   []*gortsplib.Frame
+
+	videoMedia  *media.Media
+	videoFormat *formats.H264
+	videoDec    *gortsplib.FrameDecoder
+	sps         []byte
+	pps         []byte
+	spsSent     []byte
+	ppsSent     []byte
+
+	audioMedia  *media.Media
+	audioFormat *formats.MPEG4Audio
+	audioDec    *gortsplib.FrameDecoder
+}
+
+// Start connects to the server and starts publishing.
+func (p *Publisher) Start() error {
+	if p.ReadTimeout == 0 {
+		p.ReadTimeout = 10 * time.Second
+	}
+	if p.WriteTimeout == 0 {
+		p.WriteTimeout = 10 * time.Second
+	}
+	if p.OnError == nil {
+		p.OnError = func(error) {}
+	}
+
+	host, app, key, err := parseURL(p.URL)
+	if err != nil {
+		return err
+	}
+
+	for _, medi := range p.Medias {
+		for _, forma := range medi.Formats {
+			switch tforma := forma.(type) {
+			case *formats.H264:
+				if p.videoFormat == nil {
+					p.videoMedia = medi
+					p.videoFormat = tforma
+					p.videoDec = gortsplib.NewFrameDecoder(tforma, p.onFrame)
+					p.sps, p.pps = tforma.SafeParams()
+				}
+
+			case *formats.MPEG4Audio:
+				if p.audioFormat == nil && tforma.Config != nil {
+					p.audioMedia = medi
+					p.audioFormat = tforma
+					p.audioDec = gortsplib.NewFrameDecoder(tforma, p.onFrame)
+				}
+			}
+		}
+	}
+
+	if p.videoFormat == nil && p.audioFormat == nil {
+		return fmt.Errorf("no supported formats found (H264, MPEG-4 Audio)")
+	}
+
+	p.nconn, err = net.DialTimeout("tcp", host, p.ReadTimeout)
+	if err != nil {
+		return err
+	}
+
+	p.c = newConn(p.nconn, p.ReadTimeout, p.WriteTimeout)
+
+	err = p.initialize(host, app, key)
+	if err != nil {
+		p.nconn.Close()
+		return err
+	}
+
+	// from now on, messages coming from the server are read without timeout,
+	// since the server is not required to send anything.
+	p.c.readTimeout = 0
+	p.timeDec = rtptime.NewGlobalDecoder(timeNow())
+	p.done = make(chan struct{})
+
+	go p.runReader()
+
+	return nil
+}
+
+// Close stops publishing and closes the connection.
+func (p *Publisher) Close() {
+	p.mutex.Lock()
+	if p.closed {
+		p.mutex.Unlock()
+		return
+	}
+	p.closed = true
+	p.mutex.Unlock()
+
+	p.c.writeCommand(chunkStreamCommand, msgCommandAMF0, 0, //nolint:errcheck
+		"deleteStream", float64(0), nil, float64(p.streamID))
+
+	p.nconn.Close()
+	<-p.done
+}
+
+func (p *Publisher) runReader() {
+	defer close(p.done)
+
+	for {
+		_, err := p.c.readMessage()
+		if err != nil {
+			p.mutex.Lock()
+			closed := p.closed
+			p.mutex.Unlock()
+
+			if !closed {
+				p.OnError(err)
+			}
+			return
+		}
+	}
+}
+
+// readResult reads the result of a command.
+func (p *Publisher) readResult(txID float64) ([]interface{}, error) {
+	for {
+		name, values, err := p.c.readCommand("_result", "_error")
+		if err != nil {
+			return nil, err
+		}
+
+		err = checkRemoteCommand(values, 2)
+		if err != nil {
+			return nil, err
+		}
+
+		if id, _ := values[1].(float64); id != txID {
+			continue
+		}
+
+		if name == "_error" {
+			return nil, fmt.Errorf("server returned an error: %v", values[2:])
+		}
+
+		return values, nil
+	}
+}
+
+func (p *Publisher) initialize(host string, app string, key string) error {
+	err := p.c.clientHandshake()
+	if err != nil {
+		return err
+	}
+
+	err = p.c.setWriteChunkSize(localChunkSize)
+	if err != nil {
+		return err
+	}
+
+	err = p.c.writeCommand(chunkStreamCommand, msgCommandAMF0, 0,
+		"connect",
+		float64(1),
+		amf0Object{
+			{Key: "app", Value: app},
+			{Key: "flashVer", Value: "FMLE/3.0 (compatible; FMSc/1.0)"},
+			{Key: "tcUrl", Value: "rtmp://" + host + "/" + app},
+			{Key: "type", Value: "nonprivate"},
+		})
+	if err != nil {
+		return err
+	}
+
+	_, err = p.readResult(1)
+	if err != nil {
+		return err
+	}
+
+	err = p.c.writeCommand(chunkStreamCommand, msgCommandAMF0, 0,
+		"releaseStream", float64(2), nil, key)
+	if err != nil {
+		return err
+	}
+
+	err = p.c.writeCommand(chunkStreamCommand, msgCommandAMF0, 0,
+		"FCPublish", float64(3), nil, key)
+	if err != nil {
+		return err
+	}
+
+	err = p.c.writeCommand(chunkStreamCommand, msgCommandAMF0, 0,
+		"createStream", float64(4), nil)
+	if err != nil {
+		return err
+	}
+
+	values, err := p.readResult(4)
+	if err != nil {
+		return err
+	}
+
+	err = checkRemoteCommand(values, 4)
+	if err != nil {
+		return err
+	}
+
+	streamID, ok := values[3].(float64)
+	if !ok {
+		return fmt.Errorf("invalid stream ID: %v", values[3])
+	}
+	p.streamID = uint32(streamID)
+
+	err = p.c.writeCommand(chunkStreamData, msgCommandAMF0, p.streamID,
+		"publish", float64(5), nil, key, "live")
+	if err != nil {
+		return err
+	}
+
+	_, values, err = p.c.readCommand("onStatus")
+	if err != nil {
+		return err
+	}
+
+	err = checkRemoteCommand(values, 4)
+	if err != nil {
+		return err
+	}
+
+	obj, _ := values[3].(amf0Object)
+	if code := obj.getString("code"); code != "NetStream.Publish.Start" {
+		return fmt.Errorf("server refused to publish: %s (%s)", code, obj.getString("description"))
+	}
+
+	return p.writeHeaders()
+}
+
+// writeHeaders writes metadata and sequence headers.
+func (p *Publisher) writeHeaders() error {
+	metadata := amf0ECMAArrayValue{}
+
+	if p.videoFormat != nil {
+		metadata = append(metadata, amf0Entry{Key: "videocodecid", Value: float64(flvCodecAVC)})
+	}
+
+	if p.audioFormat != nil {
+		metadata = append(metadata,
+			amf0Entry{Key: "audiocodecid", Value: float64(flvSoundFormatAAC)},
+			amf0Entry{Key: "audiosamplerate", Value: float64(p.audioFormat.Config.SampleRate)},
+			amf0Entry{Key: "audiochannels", Value: float64(p.audioFormat.Config.ChannelCount)})
+	}
+
+	err := p.c.writeCommand(chunkStreamData, msgDataAMF0, p.streamID,
+		"@setDataFrame", "onMetaData", metadata)
+	if err != nil {
+		return err
+	}
+
+	if p.videoFormat != nil && p.sps != nil && p.pps != nil {
+		err := p.writeVideoSequenceHeader(0)
+		if err != nil {
+			return err
+		}
+	}
+
+	if p.audioFormat != nil {
+		// AudioSpecificConfig
+		conf, err := p.audioFormat.Config.Marshal()
+		if err != nil {
+			return err
+		}
+
+		err = p.c.writeMessage(&message{
+			chunkStreamID: chunkStreamAudio,
+			typ:           msgAudio,
+			streamID:      p.streamID,
+			body:          append(audioTagHeader(flvPacketTypeSequenceHeader), conf...),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeVideoSequenceHeader writes an AVCDecoderConfigurationRecord.
+func (p *Publisher) writeVideoSequenceHeader(timestamp uint32) error {
+	conf, err := avcConfigMarshal(p.sps, p.pps)
+	if err != nil {
+		return err
+	}
+
+	err = p.c.writeMessage(&message{
+		chunkStreamID: chunkStreamVideo,
+		timestamp:     timestamp,
+		typ:           msgVideo,
+		streamID:      p.streamID,
+		body:          append(videoTagHeader(true, flvPacketTypeSequenceHeader, 0), conf...),
+	})
+	if err != nil {
+		return err
+	}
+
+	p.spsSent = p.sps
+	p.ppsSent = p.pps
+	return nil
+}
+
+// Attach routes the RTP packets of a source into the publisher.
+func (p *Publisher) Attach(src gortsplib.PacketSource) {
+	if p.videoFormat != nil {
+		src.OnPacketRTP(p.videoMedia, p.videoFormat, func(pkt *rtp.Packet) {
+			err := p.WritePacketRTP(p.videoMedia, p.videoFormat, pkt)
+			if err != nil {
+				p.OnError(err)
+			}
+		})
+	}
+
+	if p.audioFormat != nil {
+		src.OnPacketRTP(p.audioMedia, p.audioFormat, func(pkt *rtp.Packet) {
+			err := p.WritePacketRTP(p.audioMedia, p.audioFormat, pkt)
+			if err != nil {
+				p.OnError(err)
+			}
+		})
+	}
+}
+
+// WritePacketRTP writes a RTP packet.
+func (p *Publisher) WritePacketRTP(medi *media.Media, forma formats.Format, pkt *rtp.Packet) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.closed {
+		return nil
+	}
+
+	var dec *gortsplib.FrameDecoder
+
+	switch {
+	case p.videoFormat != nil && forma == formats.Format(p.videoFormat):
+		dec = p.videoDec
+
+	case p.audioFormat != nil && forma == formats.Format(p.audioFormat):
+		dec = p.audioDec
+
+	default:
+		return nil
+	}
+
+	err := dec.ProcessPacket(pkt)
+	if err != nil {
+		return err
+	}
+
+	frames := p.frames
+	p.frames = nil
+	now := timeNow()
+
+	for _, fr := range frames {
+		pts := p.timeDec.Decode(forma, fr.PTS, now)
+
+		var err error
+		if dec == p.videoDec {
+			err = p.writeH264(fr, pts, pts+fr.DTS-fr.PTS)
+		} else {
+			err = p.writeMPEG4Audio(fr, pts)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *Publisher) onFrame(fr *gortsplib.Frame) {
+	p.frames = append(p.frames, fr)
+}
+
+func durationToMs(d time.Duration) uint32 {
+	return uint32(d / time.Millisecond)
+}
+
+func (p *Publisher) writeH264(fr *gortsplib.Frame, pts time.Duration, dts time.Duration) error {
+	filteredNALUs := make([][]byte, 0, len(fr.Payload))
+
+	for _, nalu := range fr.Payload {
+		if len(nalu) == 0 {
+			continue
+		}
+
+		switch h264.NALUType(nalu[0] & 0x1F) {
+		case h264.NALUTypeSPS:
+			p.sps = append([]byte(nil), nalu...)
+			continue
+
+		case h264.NALUTypePPS:
+			p.pps = append([]byte(nil), nalu...)
+			continue
+
+		case h264.NALUTypeAccessUnitDelimiter:
+			continue
+		}
+
+		filteredNALUs = append(filteredNALUs, nalu)
+	}
+
+	if len(filteredNALUs) == 0 || p.sps == nil || p.pps == nil {
+		return nil
+	}
+
+	// RTMP timestamps can't be negative
+	if dts < 0 {
+		return nil
+	}
+
+	if fr.KeyFrame && (!bytes.Equal(p.sps, p.spsSent) || !bytes.Equal(p.pps, p.ppsSent)) {
+		err := p.writeVideoSequenceHeader(durationToMs(dts))
+		if err != nil {
+			return err
+		}
+	}
+
+	avcc, err := h264.AVCCMarshal(filteredNALUs)
+	if err != nil {
+		return err
+	}
+
+	return p.c.writeMessage(&message{
+		chunkStreamID: chunkStreamVideo,
+		timestamp:     durationToMs(dts),
+		typ:           msgVideo,
+		streamID:      p.streamID,
+		body: append(videoTagHeader(fr.KeyFrame, flvPacketTypeData,
+			int32((pts-dts)/time.Millisecond)), avcc...),
+	})
+}
+
+func (p *Publisher) writeMPEG4Audio(fr *gortsplib.Frame, pts time.Duration) error {
+	// RTMP timestamps can't be negative
+	if pts < 0 {
+		return nil
+	}
+
+	return p.c.writeMessage(&message{
+		chunkStreamID: chunkStreamAudio,
+		timestamp:     durationToMs(pts),
+		typ:           msgAudio,
+		streamID:      p.streamID,
+		body:          append(audioTagHeader(flvPacketTypeData), fr.Payload[0]...),
+	})
+}
@@ -0,0 +1,137 @@
+package rtmpbridge
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// Server is a RTMP server that accepts publishers
+// and routes their streams into ServerStreams.
+// Reading streams through RTMP is not supported.
+type Server struct {
+	//
+	// parameters (all optional)
+	//
+	// address of the server.
+	// It defaults to ":1935".
+	Address string
+	// timeout of read operations.
+	// It defaults to 10 seconds.
+	ReadTimeout time.Duration
+	// timeout of write operations.
+	// It defaults to 10 seconds.
+	WriteTimeout time.Duration
+	// maximum number of messages that are buffered while waiting
+	// for the configuration of all tracks.
+	// It defaults to 512.
+	MaxBufferedMessages int
+
+	//
+	// callbacks (all optional)
+	//
+	// called when a client requests to publish.
+	// App() and StreamKey() are available, Medias() and Stream() are not.
+	// Returning an error rejects the publisher.
+	OnPublish func(*ServerConn) error
+	// called when the stream of a publisher is ready.
+	OnStreamReady func(*ServerConn)
+	// called when a publisher that has been accepted is closed.
+	OnConnClose func(*ServerConn, error)
+
+	ln     net.Listener
+	mutex  sync.Mutex
+	conns  map[*ServerConn]struct{}
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// Start starts the server.
+func (s *Server) Start() error {
+	if s.Address == "" {
+		s.Address = ":1935"
+	}
+	if s.ReadTimeout == 0 {
+		s.ReadTimeout = 10 * time.Second
+	}
+	if s.WriteTimeout == 0 {
+		s.WriteTimeout = 10 * time.Second
+	}
+	if s.MaxBufferedMessages == 0 {
+		s.MaxBufferedMessages = 512
+	}
+	if s.OnPublish == nil {
+		s.OnPublish = func(*ServerConn) error { return nil }
+	}
+	if s.OnStreamReady == nil {
+		s.OnStreamReady = func(*ServerConn) {}
+	}
+	if s.OnConnClose == nil {
+		s.OnConnClose = func(*ServerConn, error) {}
+	}
+
+	var err error
+	s.ln, err = net.Listen("tcp", s.Address)
+	if err != nil {
+		return err
+	}
+
+	s.conns = make(map[*ServerConn]struct{})
+
+	s.wg.Add(1)
+	go s.runAccept()
+
+	return nil
+}
+
+// Close closes the server and all its connections.
+func (s *Server) Close() {
+	s.mutex.Lock()
+	s.closed = true
+	for c := range s.conns {
+		c.nconn.Close()
+	}
+	s.mutex.Unlock()
+
+	s.ln.Close()
+	s.wg.Wait()
+}
+
+func (s *Server) runAccept() {
+	defer s.wg.Done()
+
+	for {
+		nconn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+
+		c := newServerConn(s, nconn)
+
+		s.mutex.Lock()
+		if s.closed {
+			s.mutex.Unlock()
+			nconn.Close()
+			return
+		}
+		s.conns[c] = struct{}{}
+		s.mutex.Unlock()
+
+		s.wg.Add(1)
+		go c.run()
+	}
+}
+
+func (s *Server) connClose(c *ServerConn) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.conns, c)
+}
+
+func checkRemoteCommand(values []interface{}, minLen int) error {
+	if len(values) < minLen {
+		return fmt.Errorf("invalid command: %v", values)
+	}
+	return nil
+}
@@ -0,0 +1,549 @@
+package rtmpbridge
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/bluenviron/mediacommon/pkg/codecs/h264"
+	"github.com/bluenviron/mediacommon/pkg/codecs/mpeg4audio"
+
+	"github.com/bluenviron/gortsplib/v3"
+	"github.com/bluenviron/gortsplib/v3/pkg/formats"
+	"github.com/bluenviron/gortsplib/v3/pkg/formats/rtph264"
+	"github.com/bluenviron/gortsplib/v3/pkg/formats/rtpmpeg4audio"
+	"github.com/bluenviron/gortsplib/v3/pkg/media"
+)
+
+// errUnpublished is returned when the publisher stops publishing.
+var errUnpublished = fmt.Errorf("publisher has stopped publishing")
+
+// the stream ID assigned to publishers.
+const publishStreamID = 1
+
+// ServerConn is a connection of a RTMP publisher.
+type ServerConn struct {
+	s     *Server
+	nconn net.Conn
+	c     *conn
+
+	app       string
+	streamKey string
+
+	videoFormat  *formats.H264
+	videoMedia   *media.Media
+	videoEncoder *rtph264.Encoder
+	sps          []byte
+	pps          []byte
+
+	audioFormat  *formats.MPEG4Audio
+	audioMedia   *media.Media
+	audioEncoder *rtpmpeg4audio.Encoder
+
+	medias media.Medias
+	stream *gortsplib.ServerStream
+}
+
+func newServerConn(s *Server, nconn net.Conn) *ServerConn {
+	return &ServerConn{
+		s:     s,
+		nconn: nconn,
+		c:     newConn(nconn, s.ReadTimeout, s.WriteTimeout),
+	}
+}
+
+// NetConn returns the underlying net.Conn.
+func (sc *ServerConn) NetConn() net.Conn {
+	return sc.nconn
+}
+
+// App returns the application requested by the publisher.
+func (sc *ServerConn) App() string {
+	return sc.app
+}
+
+// StreamKey returns the stream key (stream name) requested by the publisher.
+func (sc *ServerConn) StreamKey() string {
+	return sc.streamKey
+}
+
+// Medias returns the medias published by the publisher.
+func (sc *ServerConn) Medias() media.Medias {
+	return sc.medias
+}
+
+// Stream returns the stream that contains the packets published by the publisher.
+// It can be served by a gortsplib.Server or read with a gortsplib.ServerStreamReader.
+func (sc *ServerConn) Stream() *gortsplib.ServerStream {
+	return sc.stream
+}
+
+// Close closes the connection.
+func (sc *ServerConn) Close() {
+	sc.nconn.Close()
+}
+
+func (sc *ServerConn) run() {
+	defer sc.s.wg.Done()
+
+	accepted, err := sc.runInner()
+
+	sc.nconn.Close()
+	sc.s.connClose(sc)
+
+	if sc.stream != nil {
+		sc.stream.Close()
+	}
+
+	if accepted {
+		sc.s.OnConnClose(sc, err)
+	}
+}
+
+func (sc *ServerConn) runInner() (bool, error) {
+	err := sc.c.serverHandshake()
+	if err != nil {
+		return false, err
+	}
+
+	err = sc.readConnect()
+	if err != nil {
+		return false, err
+	}
+
+	err = sc.readPublish()
+	if err != nil {
+		return false, err
+	}
+
+	return true, sc.readMedia()
+}
+
+func (sc *ServerConn) readConnect() error {
+	_, values, err := sc.c.readCommand("connect")
+	if err != nil {
+		return err
+	}
+
+	err = checkRemoteCommand(values, 3)
+	if err != nil {
+		return err
+	}
+
+	txID, _ := values[1].(float64)
+	obj, _ := values[2].(amf0Object)
+	sc.app = obj.getString("app")
+
+	err = sc.c.writeControl(msgWindowAckSize, localWindowSize)
+	if err != nil {
+		return err
+	}
+
+	err = sc.c.writeMessage(&message{
+		chunkStreamID: chunkStreamControl,
+		typ:           msgSetPeerBandwidth,
+		body:          append(appendUint32(nil, localWindowSize), 2),
+	})
+	if err != nil {
+		return err
+	}
+
+	err = sc.c.setWriteChunkSize(localChunkSize)
+	if err != nil {
+		return err
+	}
+
+	return sc.c.writeCommand(chunkStreamCommand, msgCommandAMF0, 0,
+		"_result",
+		txID,
+		amf0Object{
+			{Key: "fmsVer", Value: "LNX 9,0,124,2"},
+			{Key: "capabilities", Value: float64(31)},
+		},
+		amf0Object{
+			{Key: "level", Value: "status"},
+			{Key: "code", Value: "NetConnection.Connect.Success"},
+			{Key: "description", Value: "Connection succeeded."},
+			{Key: "objectEncoding", Value: float64(0)},
+		})
+}
+
+func (sc *ServerConn) writeOnStatus(level string, code string, description string) error {
+	return sc.c.writeCommand(chunkStreamData, msgCommandAMF0, publishStreamID,
+		"onStatus",
+		float64(0),
+		nil,
+		amf0Object{
+			{Key: "level", Value: level},
+			{Key: "code", Value: code},
+			{Key: "description", Value: description},
+		})
+}
+
+func (sc *ServerConn) readPublish() error {
+	for {
+		name, values, err := sc.c.readCommand(
+			"releaseStream", "FCPublish", "createStream", "publish", "play", "deleteStream")
+		if err != nil {
+			return err
+		}
+
+		err = checkRemoteCommand(values, 2)
+		if err != nil {
+			return err
+		}
+
+		txID, _ := values[1].(float64)
+
+		switch name {
+		case "releaseStream", "FCPublish":
+			if txID != 0 {
+				err := sc.c.writeCommand(chunkStreamCommand, msgCommandAMF0, 0,
+					"_result", txID, nil)
+				if err != nil {
+					return err
+				}
+			}
+
+		case "createStream":
+			err := sc.c.writeCommand(chunkStreamCommand, msgCommandAMF0, 0,
+				"_result", txID, nil, float64(publishStreamID))
+			if err != nil {
+				return err
+			}
+
+		case "publish":
+			err = checkRemoteCommand(values, 4)
+			if err != nil {
+				return err
+			}
+
+			sc.streamKey, _ = values[3].(string)
+
+			err = sc.s.OnPublish(sc)
+			if err != nil {
+				sc.writeOnStatus("error", "NetStream.Publish.BadName", err.Error()) //nolint:errcheck
+				return err
+			}
+
+			return sc.writeOnStatus("status", "NetStream.Publish.Start", "Start publishing.")
+
+		case "play":
+			sc.writeOnStatus("error", "NetStream.Play.Failed", "reading is not supported") //nolint:errcheck
+			return fmt.Errorf("reading is not supported")
+
+		default:
+			return errUnpublished
+		}
+	}
+}
+
+// readTracks reads messages until the configuration of all tracks is available.
+// Messages that contain frames are returned, in order to be processed later.
+func (sc *ServerConn) readTracks() ([]*message, error) {
+	hasMetadata := false
+	expectVideo := false
+	expectAudio := false
+	var audioConfig *mpeg4audio.Config
+	var buffered []*message
+
+	ready := func() bool {
+		if hasMetadata {
+			return (!expectVideo || sc.sps != nil) && (!expectAudio || audioConfig != nil)
+		}
+
+		// without metadata, tracks are considered complete when frames are received
+		return (sc.sps != nil || audioConfig != nil) && len(buffered) != 0
+	}
+
+	for !ready() {
+		if len(buffered) >= sc.s.MaxBufferedMessages {
+			break
+		}
+
+		msg, err := sc.c.readMessage()
+		if err != nil {
+			return nil, err
+		}
+
+		switch msg.typ {
+		case msgDataAMF0, msgDataAMF3:
+			values, err := decodeCommand(msg)
+			if err != nil {
+				return nil, err
+			}
+
+			if s, ok := values[0].(string); ok && s == "@setDataFrame" {
+				values = values[1:]
+			}
+
+			if len(values) < 2 {
+				continue
+			}
+
+			if s, ok := values[0].(string); !ok || s != "onMetaData" {
+				continue
+			}
+
+			obj, ok := values[1].(amf0Object)
+			if !ok {
+				continue
+			}
+
+			hasMetadata = true
+			expectVideo = isCodecID(obj, "videocodecid", flvCodecAVC, "avc1")
+			expectAudio = isCodecID(obj, "audiocodecid", flvSoundFormatAAC, "mp4a")
+
+		case msgVideo:
+			if len(msg.body) < 5 || msg.body[0]&0x0F != flvCodecAVC {
+				continue
+			}
+
+			if msg.body[1] == flvPacketTypeSequenceHeader {
+				sc.sps, sc.pps, err = avcConfigUnmarshal(msg.body[5:])
+				if err != nil {
+					return nil, err
+				}
+				continue
+			}
+
+			buffered = append(buffered, msg)
+
+		case msgAudio:
+			if len(msg.body) < 2 || msg.body[0]>>4 != flvSoundFormatAAC {
+				continue
+			}
+
+			if msg.body[1] == flvPacketTypeSequenceHeader {
+				var conf mpeg4audio.Config
+				err := conf.Unmarshal(msg.body[2:])
+				if err != nil {
+					return nil, err
+				}
+				audioConfig = &conf
+				continue
+			}
+
+			buffered = append(buffered, msg)
+
+		case msgCommandAMF0, msgCommandAMF3:
+			values, err := decodeCommand(msg)
+			if err != nil {
+				return nil, err
+			}
+
+			if name, _ := values[0].(string); name == "deleteStream" || name == "FCUnpublish" {
+				return nil, errUnpublished
+			}
+		}
+	}
+
+	if sc.sps != nil {
+		sc.videoFormat = &formats.H264{
+			PayloadTyp:        96,
+			PacketizationMode: 1,
+			SPS:               sc.sps,
+			PPS:               sc.pps,
+		}
+		sc.videoMedia = &media.Media{
+			Type:    media.TypeVideo,
+			Formats: []formats.Format{sc.videoFormat},
+		}
+		sc.medias = append(sc.medias, sc.videoMedia)
+
+		sc.videoEncoder = &rtph264.Encoder{
+			PayloadType:       96,
+			PacketizationMode: 1,
+		}
+		sc.videoEncoder.Init()
+	}
+
+	if audioConfig != nil {
+		sc.audioFormat = &formats.MPEG4Audio{
+			PayloadTyp:       97,
+			Config:           audioConfig,
+			SizeLength:       13,
+			IndexLength:      3,
+			IndexDeltaLength: 3,
+		}
+		sc.audioMedia = &media.Media{
+			Type:    media.TypeAudio,
+			Formats: []formats.Format{sc.audioFormat},
+		}
+		sc.medias = append(sc.medias, sc.audioMedia)
+
+		sc.audioEncoder = &rtpmpeg4audio.Encoder{
+			PayloadType:      97,
+			SampleRate:       audioConfig.SampleRate,
+			SizeLength:       13,
+			IndexLength:      3,
+			IndexDeltaLength: 3,
+		}
+		sc.audioEncoder.Init()
+	}
+
+	if len(sc.medias) == 0 {
+		return nil, fmt.Errorf("the stream doesn't contain any supported track (H264, MPEG-4 Audio)")
+	}
+
+	return buffered, nil
+}
+
+func isCodecID(obj amf0Object, key string, id int, fourCC string) bool {
+	v, ok := obj.get(key)
+	if !ok {
+		return false
+	}
+
+	switch tv := v.(type) {
+	case float64:
+		return int(tv) == id
+	case string:
+		return tv == fourCC
+	}
+	return false
+}
+
+func (sc *ServerConn) readMedia() error {
+	buffered, err := sc.readTracks()
+	if err != nil {
+		return err
+	}
+
+	sc.stream = gortsplib.NewServerStream(sc.medias)
+	sc.s.OnStreamReady(sc)
+
+	for _, msg := range buffered {
+		err := sc.processMessage(msg)
+		if err != nil {
+			return err
+		}
+	}
+
+	for {
+		msg, err := sc.c.readMessage()
+		if err != nil {
+			return err
+		}
+
+		err = sc.processMessage(msg)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (sc *ServerConn) processMessage(msg *message) error {
+	switch msg.typ {
+	case msgVideo:
+		return sc.processVideo(msg)
+
+	case msgAudio:
+		return sc.processAudio(msg)
+
+	case msgCommandAMF0, msgCommandAMF3:
+		values, err := decodeCommand(msg)
+		if err != nil {
+			return err
+		}
+
+		if name, _ := values[0].(string); name == "deleteStream" || name == "FCUnpublish" {
+			return errUnpublished
+		}
+	}
+
+	return nil
+}
+
+func (sc *ServerConn) processVideo(msg *message) error {
+	if sc.videoFormat == nil || len(msg.body) < 5 || msg.body[0]&0x0F != flvCodecAVC {
+		return nil
+	}
+
+	switch msg.body[1] {
+	case flvPacketTypeSequenceHeader:
+		sps, pps, err := avcConfigUnmarshal(msg.body[5:])
+		if err != nil {
+			return err
+		}
+
+		sc.sps = sps
+		sc.pps = pps
+		sc.videoFormat.SafeSetParams(sps, pps)
+		return nil
+
+	case flvPacketTypeData:
+		nalus, err := h264.AVCCUnmarshal(msg.body[5:])
+		if err != nil {
+			return err
+		}
+
+		// parameters are sent in-band before every IDR,
+		// since they can change during the stream.
+		if h264.IDRPresent(nalus) && !containsSPS(nalus) {
+			nalus = append([][]byte{sc.sps, sc.pps}, nalus...)
+		}
+
+		dts := time.Duration(msg.timestamp) * time.Millisecond
+		pts := dts + time.Duration(decodeCompositionTime(msg.body[2:5]))*time.Millisecond
+
+		pkts, err := sc.videoEncoder.Encode(nalus, pts)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		for _, pkt := range pkts {
+			sc.stream.WritePacketRTPWithNTP(sc.videoMedia, pkt, now)
+		}
+	}
+
+	return nil
+}
+
+func containsSPS(nalus [][]byte) bool {
+	for _, nalu := range nalus {
+		if h264.NALUType(nalu[0]&0x1F) == h264.NALUTypeSPS {
+			return true
+		}
+	}
+	return false
+}
+
+func (sc *ServerConn) processAudio(msg *message) error {
+	if sc.audioFormat == nil || len(msg.body) < 2 || msg.body[0]>>4 != flvSoundFormatAAC {
+		return nil
+	}
+
+	switch msg.body[1] {
+	case flvPacketTypeSequenceHeader:
+		// the configuration can't be changed, since it is part of the SDP
+		var conf mpeg4audio.Config
+		err := conf.Unmarshal(msg.body[2:])
+		if err != nil {
+			return err
+		}
+
+		enc1, _ := conf.Marshal()
+		enc2, _ := sc.audioFormat.Config.Marshal()
+		if !bytes.Equal(enc1, enc2) {
+			return fmt.Errorf("MPEG-4 Audio configuration changed")
+		}
+		return nil
+
+	case flvPacketTypeData:
+		pkts, err := sc.audioEncoder.Encode([][]byte{msg.body[2:]},
+			time.Duration(msg.timestamp)*time.Millisecond)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		for _, pkt := range pkts {
+			sc.stream.WritePacketRTPWithNTP(sc.audioMedia, pkt, now)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,166 @@
+package rtmpbridge
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/bluenviron/mediacommon/pkg/codecs/h264"
+	"github.com/bluenviron/mediacommon/pkg/codecs/mpeg4audio"
+	"github.com/pion/rtp"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/gortsplib/v3"
+	"github.com/bluenviron/gortsplib/v3/pkg/formats"
+	"github.com/bluenviron/gortsplib/v3/pkg/media"
+)
+
+func TestServerPublisher(t *testing.T) {
+	streamReady := make(chan *ServerConn, 1)
+	connClose := make(chan error, 1)
+
+	s := &Server{
+		Address: "127.0.0.1:19350",
+		OnPublish: func(sc *ServerConn) error {
+			require.Equal(t, "live", sc.App())
+			if sc.StreamKey() != "mystream?key=value" {
+				return fmt.Errorf("invalid stream key")
+			}
+			return nil
+		},
+		OnStreamReady: func(sc *ServerConn) {
+			streamReady <- sc
+		},
+		OnConnClose: func(sc *ServerConn, err error) {
+			connClose <- err
+		},
+	}
+	err := s.Start()
+	require.NoError(t, err)
+	defer s.Close()
+
+	videoForma := &formats.H264{
+		PayloadTyp:        96,
+		SPS:               testSPS,
+		PPS:               testPPS,
+		PacketizationMode: 1,
+	}
+	videoMedia := &media.Media{
+		Type:    media.TypeVideo,
+		Formats: []formats.Format{videoForma},
+	}
+
+	audioForma := &formats.MPEG4Audio{
+		PayloadTyp: 97,
+		Config: &mpeg4audio.Config{
+			Type:         mpeg4audio.ObjectTypeAACLC,
+			SampleRate:   48000,
+			ChannelCount: 2,
+		},
+		SizeLength:       13,
+		IndexLength:      3,
+		IndexDeltaLength: 3,
+	}
+	audioMedia := &media.Media{
+		Type:    media.TypeAudio,
+		Formats: []formats.Format{audioForma},
+	}
+
+	// publishers with an invalid stream key are rejected
+	p := &Publisher{
+		URL:    "rtmp://127.0.0.1:19350/live/otherstream",
+		Medias: media.Medias{videoMedia, audioMedia},
+	}
+	err = p.Start()
+	require.EqualError(t, err, "server refused to publish: NetStream.Publish.BadName (invalid stream key)")
+
+	p = &Publisher{
+		URL:    "rtmp://127.0.0.1:19350/live/mystream?key=value",
+		Medias: media.Medias{videoMedia, audioMedia},
+	}
+	err = p.Start()
+	require.NoError(t, err)
+	defer p.Close()
+
+	sc := <-streamReady
+	require.Equal(t, 2, len(sc.Medias()))
+
+	recvVideoForma := sc.Medias()[0].Formats[0].(*formats.H264)
+	require.Equal(t, testSPS, recvVideoForma.SPS)
+	require.Equal(t, testPPS, recvVideoForma.PPS)
+
+	recvAudioForma := sc.Medias()[1].Formats[0].(*formats.MPEG4Audio)
+	require.Equal(t, audioForma.Config, recvAudioForma.Config)
+
+	videoRecv := make(chan [][]byte, 16)
+	audioRecv := make(chan [][]byte, 16)
+
+	r := &gortsplib.ServerStreamReader{Stream: sc.Stream()}
+
+	videoDec := recvVideoForma.CreateDecoder()
+	r.OnPacketRTP(sc.Medias()[0], recvVideoForma, func(pkt *rtp.Packet) {
+		nalus, _, err := videoDec.Decode(pkt)
+		if err == nil {
+			videoRecv <- nalus
+		}
+	})
+
+	audioDec := recvAudioForma.CreateDecoder()
+	r.OnPacketRTP(sc.Medias()[1], recvAudioForma, func(pkt *rtp.Packet) {
+		aus, _, err := audioDec.Decode(pkt)
+		if err == nil {
+			audioRecv <- aus
+		}
+	})
+
+	err = r.Start()
+	require.NoError(t, err)
+	defer r.Close()
+
+	videoEnc := videoForma.CreateEncoder()
+	audioEnc := audioForma.CreateEncoder()
+
+	writeVideo := func(nalus [][]byte, pts time.Duration) {
+		pkts, err := videoEnc.Encode(nalus, pts)
+		require.NoError(t, err)
+		for _, pkt := range pkts {
+			err := p.WritePacketRTP(videoMedia, videoForma, pkt)
+			require.NoError(t, err)
+		}
+	}
+
+	// access units that precede the first IDR are discarded
+	writeVideo([][]byte{{byte(h264.NALUTypeNonIDR), 0x00}}, 0)
+	writeVideo([][]byte{{byte(h264.NALUTypeIDR), 0x01}}, 40*time.Millisecond)
+	writeVideo([][]byte{{byte(h264.NALUTypeNonIDR), 0x02}}, 80*time.Millisecond)
+
+	// parameters are sent in-band before IDRs
+	require.Equal(t, [][]byte{testSPS, testPPS, {byte(h264.NALUTypeIDR), 0x01}}, <-videoRecv)
+	require.Equal(t, [][]byte{{byte(h264.NALUTypeNonIDR), 0x02}}, <-videoRecv)
+
+	pkts, err := audioEnc.Encode([][]byte{{0x01, 0x02, 0x03, 0x04}}, 0)
+	require.NoError(t, err)
+	for _, pkt := range pkts {
+		err := p.WritePacketRTP(audioMedia, audioForma, pkt)
+		require.NoError(t, err)
+	}
+
+	require.Equal(t, [][]byte{{0x01, 0x02, 0x03, 0x04}}, <-audioRecv)
+
+	p.Close()
+	require.Equal(t, errUnpublished, <-connClose)
+}
+
+func TestParseURL(t *testing.T) {
+	host, app, key, err := parseURL("rtmp://localhost/live/mystream")
+	require.NoError(t, err)
+	require.Equal(t, "localhost:1935", host)
+	require.Equal(t, "live", app)
+	require.Equal(t, "mystream", key)
+
+	_, _, _, err = parseURL("rtmp://localhost/live")
+	require.Error(t, err)
+
+	_, _, _, err = parseURL("http://localhost/live/mystream")
+	require.Error(t, err)
+}
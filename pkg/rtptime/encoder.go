@@ -23,3 +23,8 @@ func NewEncoder(clockRate int, initialTimestamp uint32) *Encoder {
 func (e *Encoder) Encode(ts time.Duration) uint32 {
 	return uint32((e.initialTimestamp + ts).Seconds() * e.clockRate)
 }
+
+// DurationToTicks converts a duration into ticks of a clock.
+func DurationToTicks(d time.Duration, clockRate int) int64 {
+	return int64(multiplyAndDivide(d, time.Duration(clockRate), time.Second))
+}
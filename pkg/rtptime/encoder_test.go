@@ -14,6 +14,13 @@ func TestEncoder(t *testing.T) {
 	require.Equal(t, uint32(12345), ts)
 }
 
+func TestDurationToTicks(t *testing.T) {
+	require.Equal(t, int64(90000*2+45000), DurationToTicks(2500*time.Millisecond, 90000))
+
+	// large durations do not overflow
+	require.Equal(t, int64(90000*1000000), DurationToTicks(1000000*time.Second, 90000))
+}
+
 func BenchmarkEncoder(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		func() {
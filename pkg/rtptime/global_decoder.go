@@ -0,0 +1,36 @@
+package rtptime
+
+import (
+	"time"
+)
+
+// GlobalDecoder places the timestamps of multiple tracks on a common timeline.
+// Since RTP timestamps of different tracks are not related to each other,
+// the first timestamp of every track is placed on the timeline by using its arrival time.
+type GlobalDecoder struct {
+	startTime time.Time
+	offsets   map[interface{}]time.Duration
+}
+
+// NewGlobalDecoder allocates a GlobalDecoder.
+// startTime is the time that corresponds to the beginning of the timeline.
+func NewGlobalDecoder(startTime time.Time) *GlobalDecoder {
+	return &GlobalDecoder{
+		startTime: startTime,
+		offsets:   make(map[interface{}]time.Duration),
+	}
+}
+
+// Decode converts a timestamp of a track, that is relative to the first timestamp of the track,
+// into a timestamp that is relative to the beginning of the timeline.
+// track is a comparable value that identifies the track.
+// now is the arrival time of the sample.
+func (d *GlobalDecoder) Decode(track interface{}, ts time.Duration, now time.Time) time.Duration {
+	offset, ok := d.offsets[track]
+	if !ok {
+		offset = now.Sub(d.startTime) - ts
+		d.offsets[track] = offset
+	}
+
+	return ts + offset
+}
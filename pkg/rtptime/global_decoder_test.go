@@ -0,0 +1,20 @@
+package rtptime
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGlobalDecoder(t *testing.T) {
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	d := NewGlobalDecoder(start)
+
+	require.Equal(t, time.Duration(0), d.Decode(1, 0, start))
+	require.Equal(t, 1*time.Second, d.Decode(1, 1*time.Second, start.Add(5*time.Second)))
+
+	// the first sample of the second track arrives after 2 seconds
+	require.Equal(t, 2*time.Second, d.Decode(2, 3*time.Second, start.Add(2*time.Second)))
+	require.Equal(t, 3*time.Second, d.Decode(2, 4*time.Second, start.Add(2*time.Second)))
+}
@@ -0,0 +1,220 @@
+package webrtcbridge
+
+import (
+	"strconv"
+	"strings"
+
+	psdp "github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v3"
+
+	"github.com/bluenviron/gortsplib/v3/pkg/formats"
+	"github.com/bluenviron/gortsplib/v3/pkg/media"
+)
+
+// supportedCodecs are the codecs that can be received from WebRTC publishers.
+var supportedCodecs = []webrtc.RTPCodecParameters{
+	{
+		RTPCodecCapability: webrtc.RTPCodecCapability{
+			MimeType:    webrtc.MimeTypeH264,
+			ClockRate:   90000,
+			SDPFmtpLine: "level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42e01f",
+		},
+		PayloadType: 96,
+	},
+	{
+		RTPCodecCapability: webrtc.RTPCodecCapability{
+			MimeType:    webrtc.MimeTypeH264,
+			ClockRate:   90000,
+			SDPFmtpLine: "level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=640032",
+		},
+		PayloadType: 97,
+	},
+	{
+		RTPCodecCapability: webrtc.RTPCodecCapability{
+			MimeType:  webrtc.MimeTypeVP8,
+			ClockRate: 90000,
+		},
+		PayloadType: 98,
+	},
+	{
+		RTPCodecCapability: webrtc.RTPCodecCapability{
+			MimeType:    webrtc.MimeTypeVP9,
+			ClockRate:   90000,
+			SDPFmtpLine: "profile-id=0",
+		},
+		PayloadType: 99,
+	},
+	{
+		RTPCodecCapability: webrtc.RTPCodecCapability{
+			MimeType:    webrtc.MimeTypeOpus,
+			ClockRate:   48000,
+			Channels:    2,
+			SDPFmtpLine: "minptime=10;useinbandfec=1",
+		},
+		PayloadType: 111,
+	},
+	{
+		RTPCodecCapability: webrtc.RTPCodecCapability{
+			MimeType:  webrtc.MimeTypeG722,
+			ClockRate: 8000,
+		},
+		PayloadType: 9,
+	},
+	{
+		RTPCodecCapability: webrtc.RTPCodecCapability{
+			MimeType:  webrtc.MimeTypePCMU,
+			ClockRate: 8000,
+		},
+		PayloadType: 0,
+	},
+	{
+		RTPCodecCapability: webrtc.RTPCodecCapability{
+			MimeType:  webrtc.MimeTypePCMA,
+			ClockRate: 8000,
+		},
+		PayloadType: 8,
+	},
+}
+
+func codecType(mimeType string) webrtc.RTPCodecType {
+	if strings.HasPrefix(strings.ToLower(mimeType), "video/") {
+		return webrtc.RTPCodecTypeVideo
+	}
+	return webrtc.RTPCodecTypeAudio
+}
+
+// formatToCodec returns the WebRTC codec that corresponds to a format.
+// Dynamic payload types are assigned by the caller, in order to avoid
+// collisions between formats of different medias.
+func formatToCodec(forma formats.Format, dynamicPayloadType uint8) (webrtc.RTPCodecParameters, bool) {
+	switch tforma := forma.(type) {
+	case *formats.H264:
+		// browsers are able to decode every profile, therefore
+		// the most compatible one is advertised.
+		return webrtc.RTPCodecParameters{
+			RTPCodecCapability: webrtc.RTPCodecCapability{
+				MimeType:  webrtc.MimeTypeH264,
+				ClockRate: 90000,
+				SDPFmtpLine: "level-asymmetry-allowed=1;packetization-mode=" +
+					strconv.FormatInt(int64(tforma.PacketizationMode), 10) + ";profile-level-id=42e01f",
+			},
+			PayloadType: webrtc.PayloadType(dynamicPayloadType),
+		}, true
+
+	case *formats.VP8:
+		return webrtc.RTPCodecParameters{
+			RTPCodecCapability: webrtc.RTPCodecCapability{
+				MimeType:  webrtc.MimeTypeVP8,
+				ClockRate: 90000,
+			},
+			PayloadType: webrtc.PayloadType(dynamicPayloadType),
+		}, true
+
+	case *formats.VP9:
+		return webrtc.RTPCodecParameters{
+			RTPCodecCapability: webrtc.RTPCodecCapability{
+				MimeType:    webrtc.MimeTypeVP9,
+				ClockRate:   90000,
+				SDPFmtpLine: "profile-id=0",
+			},
+			PayloadType: webrtc.PayloadType(dynamicPayloadType),
+		}, true
+
+	case *formats.Opus:
+		fmtp := "minptime=10;useinbandfec=1"
+		if tforma.IsStereo {
+			fmtp += ";stereo=1;sprop-stereo=1"
+		}
+
+		// in WebRTC, Opus always has two channels in SDP
+		return webrtc.RTPCodecParameters{
+			RTPCodecCapability: webrtc.RTPCodecCapability{
+				MimeType:    webrtc.MimeTypeOpus,
+				ClockRate:   48000,
+				Channels:    2,
+				SDPFmtpLine: fmtp,
+			},
+			PayloadType: webrtc.PayloadType(dynamicPayloadType),
+		}, true
+
+	case *formats.G722:
+		return webrtc.RTPCodecParameters{
+			RTPCodecCapability: webrtc.RTPCodecCapability{
+				MimeType:  webrtc.MimeTypeG722,
+				ClockRate: 8000,
+			},
+			PayloadType: 9,
+		}, true
+
+	case *formats.G711:
+		if tforma.MULaw {
+			return webrtc.RTPCodecParameters{
+				RTPCodecCapability: webrtc.RTPCodecCapability{
+					MimeType:  webrtc.MimeTypePCMU,
+					ClockRate: 8000,
+				},
+				PayloadType: 0,
+			}, true
+		}
+
+		return webrtc.RTPCodecParameters{
+			RTPCodecCapability: webrtc.RTPCodecCapability{
+				MimeType:  webrtc.MimeTypePCMA,
+				ClockRate: 8000,
+			},
+			PayloadType: 8,
+		}, true
+	}
+
+	return webrtc.RTPCodecParameters{}, false
+}
+
+// codecToFormat returns the format that corresponds to a WebRTC codec,
+// by decoding the codec like a SDP media description.
+func codecToFormat(codec webrtc.RTPCodecParameters) (formats.Format, bool) {
+	mimeParts := strings.SplitN(codec.MimeType, "/", 2)
+	if len(mimeParts) != 2 {
+		return nil, false
+	}
+
+	pt := strconv.FormatUint(uint64(codec.PayloadType), 10)
+
+	rtpmap := pt + " " + mimeParts[1] + "/" + strconv.FormatUint(uint64(codec.ClockRate), 10)
+	if codec.Channels != 0 {
+		rtpmap += "/" + strconv.FormatUint(uint64(codec.Channels), 10)
+	}
+
+	md := &psdp.MediaDescription{
+		MediaName: psdp.MediaName{
+			Media:   string(media.TypeAudio),
+			Formats: []string{pt},
+		},
+		Attributes: []psdp.Attribute{{
+			Key:   "rtpmap",
+			Value: rtpmap,
+		}},
+	}
+
+	if codecType(codec.MimeType) == webrtc.RTPCodecTypeVideo {
+		md.MediaName.Media = string(media.TypeVideo)
+	}
+
+	if codec.SDPFmtpLine != "" {
+		md.Attributes = append(md.Attributes, psdp.Attribute{
+			Key:   "fmtp",
+			Value: pt + " " + codec.SDPFmtpLine,
+		})
+	}
+
+	forma, err := formats.Unmarshal(md, pt)
+	if err != nil {
+		return nil, false
+	}
+
+	// retransmission, redundancy and error correction codecs are not forwarded
+	if _, ok := forma.(*formats.Generic); ok {
+		return nil, false
+	}
+
+	return forma, true
+}
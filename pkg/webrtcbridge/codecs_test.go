@@ -0,0 +1,101 @@
+package webrtcbridge
+
+import (
+	"testing"
+
+	"github.com/pion/webrtc/v3"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/gortsplib/v3/pkg/formats"
+)
+
+func TestCodecs(t *testing.T) {
+	for _, ca := range []struct {
+		name  string
+		forma formats.Format
+		codec webrtc.RTPCodecParameters
+	}{
+		{
+			"h264",
+			&formats.H264{
+				PayloadTyp:        96,
+				PacketizationMode: 1,
+			},
+			webrtc.RTPCodecParameters{
+				RTPCodecCapability: webrtc.RTPCodecCapability{
+					MimeType:    webrtc.MimeTypeH264,
+					ClockRate:   90000,
+					SDPFmtpLine: "level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42e01f",
+				},
+				PayloadType: 96,
+			},
+		},
+		{
+			"vp8",
+			&formats.VP8{
+				PayloadTyp: 96,
+			},
+			webrtc.RTPCodecParameters{
+				RTPCodecCapability: webrtc.RTPCodecCapability{
+					MimeType:  webrtc.MimeTypeVP8,
+					ClockRate: 90000,
+				},
+				PayloadType: 96,
+			},
+		},
+		{
+			"opus",
+			&formats.Opus{
+				PayloadTyp: 96,
+				IsStereo:   true,
+			},
+			webrtc.RTPCodecParameters{
+				RTPCodecCapability: webrtc.RTPCodecCapability{
+					MimeType:    webrtc.MimeTypeOpus,
+					ClockRate:   48000,
+					Channels:    2,
+					SDPFmtpLine: "minptime=10;useinbandfec=1;stereo=1;sprop-stereo=1",
+				},
+				PayloadType: 96,
+			},
+		},
+		{
+			"pcmu",
+			&formats.G711{
+				MULaw: true,
+			},
+			webrtc.RTPCodecParameters{
+				RTPCodecCapability: webrtc.RTPCodecCapability{
+					MimeType:  webrtc.MimeTypePCMU,
+					ClockRate: 8000,
+				},
+				PayloadType: 0,
+			},
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			codec, ok := formatToCodec(ca.forma, 96)
+			require.Equal(t, true, ok)
+			require.Equal(t, ca.codec, codec)
+
+			forma, ok := codecToFormat(codec)
+			require.Equal(t, true, ok)
+			require.Equal(t, ca.forma, forma)
+		})
+	}
+}
+
+func TestCodecsUnsupported(t *testing.T) {
+	_, ok := formatToCodec(&formats.MPEG4Audio{PayloadTyp: 96}, 96)
+	require.Equal(t, false, ok)
+
+	_, ok = codecToFormat(webrtc.RTPCodecParameters{
+		RTPCodecCapability: webrtc.RTPCodecCapability{
+			MimeType:    "video/rtx",
+			ClockRate:   90000,
+			SDPFmtpLine: "apt=96",
+		},
+		PayloadType: 97,
+	})
+	require.Equal(t, false, ok)
+}
@@ -0,0 +1,227 @@
+// Package webrtcbridge contains a bridge between RTSP server streams and WebRTC.
+// Server streams can be read through WHEP, and WHIP publishers can be
+// routed into server streams. RTP packets are forwarded without transcoding.
+package webrtcbridge
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pion/interceptor"
+	"github.com/pion/rtcp"
+	"github.com/pion/webrtc/v3"
+)
+
+const (
+	gatheringTimeout = 10 * time.Second
+	maxOfferSize     = 64 * 1024
+)
+
+// session is a WHEP or WHIP session.
+type session interface {
+	close()
+}
+
+// newAPI allocates a WebRTC API that supports the given codecs.
+func newAPI(codecs []webrtc.RTPCodecParameters) (*webrtc.API, error) {
+	me := &webrtc.MediaEngine{}
+
+	for _, codec := range codecs {
+		err := me.RegisterCodec(codec, codecType(codec.MimeType))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ir := &interceptor.Registry{}
+
+	// NACK responder and generator, RTCP sender and receiver reports
+	err := webrtc.ConfigureNack(me, ir)
+	if err != nil {
+		return nil, err
+	}
+
+	err = webrtc.ConfigureRTCPReports(ir)
+	if err != nil {
+		return nil, err
+	}
+
+	return webrtc.NewAPI(
+		webrtc.WithMediaEngine(me),
+		webrtc.WithInterceptorRegistry(ir)), nil
+}
+
+func newConfiguration(iceServers []string) webrtc.Configuration {
+	conf := webrtc.Configuration{}
+	for _, u := range iceServers {
+		conf.ICEServers = append(conf.ICEServers, webrtc.ICEServer{URLs: []string{u}})
+	}
+	return conf
+}
+
+// answer sets the remote offer and returns an answer that contains all local candidates,
+// since trickle ICE is not supported.
+func answer(ctx context.Context, pc *webrtc.PeerConnection) (*webrtc.SessionDescription, error) {
+	ans, err := pc.CreateAnswer(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	gatherComplete := webrtc.GatheringCompletePromise(pc)
+
+	err = pc.SetLocalDescription(ans)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, gatheringTimeout)
+	defer cancel()
+
+	select {
+	case <-gatherComplete:
+	case <-ctx.Done():
+		return nil, fmt.Errorf("ICE gathering timed out")
+	}
+
+	return pc.LocalDescription(), nil
+}
+
+// isKeyframeRequest checks whether a RTCP packet requests a keyframe.
+func isKeyframeRequest(pkt rtcp.Packet) bool {
+	switch pkt.(type) {
+	case *rtcp.PictureLossIndication, *rtcp.FullIntraRequest:
+		return true
+	}
+	return false
+}
+
+// handler contains the HTTP logic shared by WHEP and WHIP.
+type handler struct {
+	mutex    sync.Mutex
+	sessions map[string]session
+	closed   bool
+}
+
+func (h *handler) add(s session) (string, bool) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.closed {
+		return "", false
+	}
+
+	if h.sessions == nil {
+		h.sessions = make(map[string]session)
+	}
+
+	id := uuid.New().String()
+	h.sessions[id] = s
+	return id, true
+}
+
+func (h *handler) remove(id string) session {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	s, ok := h.sessions[id]
+	if !ok {
+		return nil
+	}
+
+	delete(h.sessions, id)
+	return s
+}
+
+// removeSession removes a session that has been closed by the peer.
+func (h *handler) removeSession(s session) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for id, cur := range h.sessions {
+		if cur == s {
+			delete(h.sessions, id)
+			return
+		}
+	}
+}
+
+func (h *handler) closeAll() {
+	h.mutex.Lock()
+	h.closed = true
+	sessions := h.sessions
+	h.sessions = nil
+	h.mutex.Unlock()
+
+	for _, s := range sessions {
+		s.close()
+	}
+}
+
+// serveHTTP routes a request.
+// Offers are POSTed to the handler path; sessions are available at <path>/<id>.
+func (h *handler) serveHTTP(
+	w http.ResponseWriter,
+	r *http.Request,
+	onOffer func(ctx context.Context, offer string) (session, string, error),
+) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Expose-Headers", "Location")
+
+	switch r.Method {
+	case http.MethodOptions:
+		w.Header().Set("Access-Control-Allow-Methods", "OPTIONS, POST, DELETE")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.WriteHeader(http.StatusNoContent)
+
+	case http.MethodPost:
+		if r.Header.Get("Content-Type") != "application/sdp" {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+
+		offer, err := io.ReadAll(io.LimitReader(r.Body, maxOfferSize))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		s, ans, err := onOffer(r.Context(), string(offer))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		id, ok := h.add(s)
+		if !ok {
+			s.close()
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/sdp")
+		w.Header().Set("Location", strings.TrimSuffix(r.URL.Path, "/")+"/"+id)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(ans))
+
+	case http.MethodDelete:
+		i := strings.LastIndexByte(r.URL.Path, '/')
+		s := h.remove(r.URL.Path[i+1:])
+		if s == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		s.close()
+		w.WriteHeader(http.StatusOK)
+
+	default:
+		// trickle ICE and ICE restarts are not supported
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
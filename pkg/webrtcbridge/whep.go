@@ -0,0 +1,228 @@
+package webrtcbridge
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+
+	"github.com/bluenviron/gortsplib/v3"
+	"github.com/bluenviron/gortsplib/v3/pkg/formats"
+	"github.com/bluenviron/gortsplib/v3/pkg/media"
+)
+
+type whepTrack struct {
+	medi  *media.Media
+	forma formats.Format
+	codec webrtc.RTPCodecParameters
+	track *webrtc.TrackLocalStaticRTP
+	ssrc  uint32 // accessed atomically
+}
+
+type whepSession struct {
+	h      *WHEPHandler
+	pc     *webrtc.PeerConnection
+	reader *gortsplib.ServerStreamReader
+	tracks []*whepTrack
+
+	closeOnce sync.Once
+}
+
+func (s *whepSession) close() {
+	s.closeOnce.Do(func() {
+		s.h.h.removeSession(s)
+		s.reader.Close()
+		s.pc.Close()
+	})
+}
+
+// requestKeyframe asks the RTSP side to send a keyframe.
+func (s *whepSession) requestKeyframe(t *whepTrack) {
+	if s.h.OnPacketRTCP == nil {
+		return
+	}
+
+	s.h.OnPacketRTCP(t.medi, &rtcp.PictureLossIndication{
+		MediaSSRC: atomic.LoadUint32(&t.ssrc),
+	})
+}
+
+func (s *whepSession) runRTCPReader(t *whepTrack, sender *webrtc.RTPSender) {
+	for {
+		pkts, _, err := sender.ReadRTCP()
+		if err != nil {
+			return
+		}
+
+		// NACKs are answered by the NACK responder,
+		// that keeps a copy of the latest packets sent to the peer.
+		for _, pkt := range pkts {
+			if isKeyframeRequest(pkt) {
+				s.requestKeyframe(t)
+			}
+		}
+	}
+}
+
+// WHEPHandler is a HTTP handler that allows to read a ServerStream
+// with the WebRTC-HTTP Egress Protocol (WHEP).
+// For each media of the stream, the first format that is supported by WebRTC
+// (H264, VP8, VP9, Opus, G722, G711) is sent to the peer.
+//
+// Offers must be POSTed to the handler path;
+// sessions can be terminated with a DELETE request to the returned location.
+type WHEPHandler struct {
+	//
+	// parameters (all optional except Stream)
+	//
+	// stream to read.
+	Stream *gortsplib.ServerStream
+	// URLs of ICE servers (STUN or TURN) to use.
+	ICEServers []string
+
+	//
+	// callbacks (all optional)
+	//
+	// called when the WebRTC peer requests a keyframe, with a PLI or a FIR.
+	// The packet is a PLI addressed to the SSRC of the stream, and can be
+	// forwarded to the publisher of the stream.
+	OnPacketRTCP func(medi *media.Media, pkt rtcp.Packet)
+
+	h handler
+}
+
+// Close closes all sessions.
+func (h *WHEPHandler) Close() {
+	h.h.closeAll()
+}
+
+// ServeHTTP implements http.Handler.
+func (h *WHEPHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.h.serveHTTP(w, r, func(ctx context.Context, offer string) (session, string, error) {
+		return h.newSession(ctx, offer)
+	})
+}
+
+func (h *WHEPHandler) newSession(ctx context.Context, offer string) (session, string, error) {
+	var tracks []*whepTrack
+	var codecs []webrtc.RTPCodecParameters
+	dynamicPayloadType := uint8(96)
+
+	for _, medi := range h.Stream.Medias() {
+		for _, forma := range medi.Formats {
+			codec, ok := formatToCodec(forma, dynamicPayloadType)
+			if !ok {
+				continue
+			}
+
+			if codec.PayloadType == webrtc.PayloadType(dynamicPayloadType) {
+				dynamicPayloadType++
+			}
+
+			tracks = append(tracks, &whepTrack{
+				medi:  medi,
+				forma: forma,
+				codec: codec,
+			})
+			codecs = append(codecs, codec)
+			break
+		}
+	}
+
+	if len(tracks) == 0 {
+		return nil, "", fmt.Errorf("the stream doesn't contain any format supported by WebRTC")
+	}
+
+	api, err := newAPI(codecs)
+	if err != nil {
+		return nil, "", err
+	}
+
+	pc, err := api.NewPeerConnection(newConfiguration(h.ICEServers))
+	if err != nil {
+		return nil, "", err
+	}
+
+	s := &whepSession{
+		h:      h,
+		pc:     pc,
+		reader: &gortsplib.ServerStreamReader{Stream: h.Stream},
+		tracks: tracks,
+	}
+
+	ans, err := s.initialize(ctx, offer)
+	if err != nil {
+		pc.Close()
+		return nil, "", err
+	}
+
+	return s, ans, nil
+}
+
+func (s *whepSession) initialize(ctx context.Context, offer string) (string, error) {
+	err := s.pc.SetRemoteDescription(webrtc.SessionDescription{
+		Type: webrtc.SDPTypeOffer,
+		SDP:  offer,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	senders := make([]*webrtc.RTPSender, len(s.tracks))
+
+	for i, t := range s.tracks {
+		t.track, err = webrtc.NewTrackLocalStaticRTP(t.codec.RTPCodecCapability,
+			string(t.medi.Type)+strconv.FormatInt(int64(i), 10), "gortsplib")
+		if err != nil {
+			return "", err
+		}
+
+		senders[i], err = s.pc.AddTrack(t.track)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	s.pc.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		switch state {
+		case webrtc.PeerConnectionStateConnected:
+			// the stream can be decoded starting from a keyframe only
+			for _, t := range s.tracks {
+				if t.medi.Type == media.TypeVideo {
+					s.requestKeyframe(t)
+				}
+			}
+
+		case webrtc.PeerConnectionStateFailed, webrtc.PeerConnectionStateClosed:
+			go s.close()
+		}
+	})
+
+	ans, err := answer(ctx, s.pc)
+	if err != nil {
+		return "", err
+	}
+
+	for i, t := range s.tracks {
+		ct := t
+		s.reader.OnPacketRTP(t.medi, t.forma, func(pkt *rtp.Packet) {
+			atomic.StoreUint32(&ct.ssrc, pkt.SSRC)
+			ct.track.WriteRTP(pkt) //nolint:errcheck
+		})
+
+		go s.runRTCPReader(t, senders[i])
+	}
+
+	err = s.reader.Start()
+	if err != nil {
+		return "", err
+	}
+
+	return ans.SDP, nil
+}
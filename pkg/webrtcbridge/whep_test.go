@@ -0,0 +1,216 @@
+package webrtcbridge
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/gortsplib/v3"
+	"github.com/bluenviron/gortsplib/v3/pkg/formats"
+	"github.com/bluenviron/gortsplib/v3/pkg/media"
+	"github.com/bluenviron/mediacommon/pkg/codecs/mpeg4audio"
+)
+
+// newTestPeer allocates a peer connection that plays the role of a browser.
+func newTestPeer(t *testing.T) *webrtc.PeerConnection {
+	api, err := newAPI(supportedCodecs)
+	require.NoError(t, err)
+
+	pc, err := api.NewPeerConnection(webrtc.Configuration{})
+	require.NoError(t, err)
+
+	return pc
+}
+
+// sendOffer sends the offer of a test peer to a handler, and sets the answer.
+func sendOffer(t *testing.T, pc *webrtc.PeerConnection, ur string) string {
+	offer, err := pc.CreateOffer(nil)
+	require.NoError(t, err)
+
+	gatherComplete := webrtc.GatheringCompletePromise(pc)
+
+	err = pc.SetLocalDescription(offer)
+	require.NoError(t, err)
+
+	<-gatherComplete
+
+	res, err := http.Post(ur, "application/sdp", bytes.NewReader([]byte(pc.LocalDescription().SDP)))
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+	require.Equal(t, "application/sdp", res.Header.Get("Content-Type"))
+
+	ans, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+
+	err = pc.SetRemoteDescription(webrtc.SessionDescription{
+		Type: webrtc.SDPTypeAnswer,
+		SDP:  string(ans),
+	})
+	require.NoError(t, err)
+
+	return res.Header.Get("Location")
+}
+
+func TestWHEP(t *testing.T) {
+	medi := &media.Media{
+		Type: media.TypeVideo,
+		Formats: []formats.Format{&formats.H264{
+			PayloadTyp:        96,
+			PacketizationMode: 1,
+		}},
+	}
+
+	stream := gortsplib.NewServerStream(media.Medias{medi})
+	defer stream.Close()
+
+	keyframeRequests := make(chan *rtcp.PictureLossIndication, 16)
+
+	h := &WHEPHandler{
+		Stream: stream,
+		OnPacketRTCP: func(rmedi *media.Media, pkt rtcp.Packet) {
+			require.Equal(t, medi, rmedi)
+			keyframeRequests <- pkt.(*rtcp.PictureLossIndication)
+		},
+	}
+	defer h.Close()
+
+	s := httptest.NewServer(h)
+	defer s.Close()
+
+	pc := newTestPeer(t)
+	defer pc.Close()
+
+	_, err := pc.AddTransceiverFromKind(webrtc.RTPCodecTypeVideo, webrtc.RTPTransceiverInit{
+		Direction: webrtc.RTPTransceiverDirectionRecvonly,
+	})
+	require.NoError(t, err)
+
+	received := make(chan *rtp.Packet)
+
+	pc.OnTrack(func(track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		pkt, _, err := track.ReadRTP()
+		if err != nil {
+			return
+		}
+
+		// ask for a keyframe
+		pc.WriteRTCP([]rtcp.Packet{&rtcp.PictureLossIndication{ //nolint:errcheck
+			MediaSSRC: uint32(track.SSRC()),
+		}})
+
+		received <- pkt
+	})
+
+	location := sendOffer(t, pc, s.URL+"/whep")
+
+	// packets are written until the peer is connected
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+
+	var pkt *rtp.Packet
+	for pkt == nil {
+		select {
+		case pkt = <-received:
+		case <-ticker.C:
+			stream.WritePacketRTP(medi, &rtp.Packet{
+				Header: rtp.Header{
+					Version:        2,
+					Marker:         true,
+					PayloadType:    96,
+					SequenceNumber: 123,
+					SSRC:           0x38F27A2F,
+				},
+				Payload: []byte{0x05, 0x01, 0x02},
+			})
+		case <-time.After(10 * time.Second):
+			t.Fatal("timed out")
+		}
+	}
+
+	require.Equal(t, []byte{0x05, 0x01, 0x02}, pkt.Payload)
+
+	// keyframe requests are readdressed to the SSRC of the stream
+	for {
+		pli := <-keyframeRequests
+		if pli.MediaSSRC == 0x38F27A2F {
+			break
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodDelete, s.URL+location, nil)
+	require.NoError(t, err)
+
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	res, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	res.Body.Close()
+	require.Equal(t, http.StatusNotFound, res.StatusCode)
+}
+
+func TestWHEPErrors(t *testing.T) {
+	stream := gortsplib.NewServerStream(media.Medias{{
+		Type: media.TypeAudio,
+		Formats: []formats.Format{&formats.MPEG4Audio{
+			PayloadTyp: 96,
+			Config: &mpeg4audio.Config{
+				Type:         2,
+				SampleRate:   44100,
+				ChannelCount: 2,
+			},
+			SizeLength:       13,
+			IndexLength:      3,
+			IndexDeltaLength: 3,
+		}},
+	}})
+	defer stream.Close()
+
+	h := &WHEPHandler{Stream: stream}
+	defer h.Close()
+
+	s := httptest.NewServer(h)
+	defer s.Close()
+
+	res, err := http.Post(s.URL, "text/plain", bytes.NewReader([]byte("abc")))
+	require.NoError(t, err)
+	res.Body.Close()
+	require.Equal(t, http.StatusUnsupportedMediaType, res.StatusCode)
+
+	// the stream doesn't contain any format supported by WebRTC
+	pc := newTestPeer(t)
+	defer pc.Close()
+
+	_, err = pc.AddTransceiverFromKind(webrtc.RTPCodecTypeAudio, webrtc.RTPTransceiverInit{
+		Direction: webrtc.RTPTransceiverDirectionRecvonly,
+	})
+	require.NoError(t, err)
+
+	offer, err := pc.CreateOffer(nil)
+	require.NoError(t, err)
+
+	res, err = http.Post(s.URL, "application/sdp", bytes.NewReader([]byte(offer.SDP)))
+	require.NoError(t, err)
+	res.Body.Close()
+	require.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	req, err := http.NewRequest(http.MethodPatch, s.URL, nil)
+	require.NoError(t, err)
+
+	res, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	res.Body.Close()
+	require.Equal(t, http.StatusMethodNotAllowed, res.StatusCode)
+}
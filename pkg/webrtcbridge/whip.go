@@ -0,0 +1,296 @@
+package webrtcbridge
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/webrtc/v3"
+
+	"github.com/bluenviron/gortsplib/v3"
+	"github.com/bluenviron/gortsplib/v3/pkg/media"
+)
+
+type whipTrack struct {
+	medi *media.Media
+	ssrc uint32 // accessed atomically
+}
+
+// WHIPSession is a session of a WHIP publisher.
+type WHIPSession struct {
+	h      *WHIPHandler
+	pc     *webrtc.PeerConnection
+	medias media.Medias
+	tracks map[*webrtc.RTPTransceiver]*whipTrack
+	stream *gortsplib.ServerStream
+
+	closeOnce sync.Once
+}
+
+// Medias returns the medias published by the peer.
+func (s *WHIPSession) Medias() media.Medias {
+	return s.medias
+}
+
+// Stream returns the stream that contains the packets published by the peer.
+// It can be served by a gortsplib.Server or read with a gortsplib.ServerStreamReader.
+func (s *WHIPSession) Stream() *gortsplib.ServerStream {
+	return s.stream
+}
+
+// Close closes the session.
+func (s *WHIPSession) Close() {
+	s.close()
+}
+
+func (s *WHIPSession) close() {
+	s.closeOnce.Do(func() {
+		s.h.h.removeSession(s)
+		s.pc.Close()
+		s.stream.Close()
+		s.h.OnSessionClose(s)
+	})
+}
+
+func (s *WHIPSession) findTrack(medi *media.Media) *whipTrack {
+	for _, t := range s.tracks {
+		if t.medi == medi {
+			return t
+		}
+	}
+	return nil
+}
+
+// WritePacketRTCP sends a RTCP packet to the peer.
+// Keyframe requests (PLI, FIR) and retransmission requests (NACK) coming
+// from RTSP readers are readdressed to the SSRC of the published track.
+func (s *WHIPSession) WritePacketRTCP(medi *media.Media, pkt rtcp.Packet) error {
+	t := s.findTrack(medi)
+	if t == nil {
+		return fmt.Errorf("media not found")
+	}
+
+	ssrc := atomic.LoadUint32(&t.ssrc)
+	if ssrc == 0 {
+		// the track has not been received yet
+		return nil
+	}
+
+	switch tpkt := pkt.(type) {
+	case *rtcp.PictureLossIndication:
+		pkt = &rtcp.PictureLossIndication{
+			SenderSSRC: tpkt.SenderSSRC,
+			MediaSSRC:  ssrc,
+		}
+
+	case *rtcp.FullIntraRequest:
+		fir := make([]rtcp.FIREntry, len(tpkt.FIR))
+		for i, e := range tpkt.FIR {
+			fir[i] = rtcp.FIREntry{
+				SSRC:           ssrc,
+				SequenceNumber: e.SequenceNumber,
+			}
+		}
+		pkt = &rtcp.FullIntraRequest{
+			SenderSSRC: tpkt.SenderSSRC,
+			MediaSSRC:  ssrc,
+			FIR:        fir,
+		}
+
+	case *rtcp.TransportLayerNack:
+		pkt = &rtcp.TransportLayerNack{
+			SenderSSRC: tpkt.SenderSSRC,
+			MediaSSRC:  ssrc,
+			Nacks:      tpkt.Nacks,
+		}
+
+	default:
+		return nil
+	}
+
+	return s.pc.WriteRTCP([]rtcp.Packet{pkt})
+}
+
+func (s *WHIPSession) runTrack(t *whipTrack, track *webrtc.TrackRemote) {
+	atomic.StoreUint32(&t.ssrc, uint32(track.SSRC()))
+
+	// the stream can be decoded starting from a keyframe only
+	if t.medi.Type == media.TypeVideo {
+		s.pc.WriteRTCP([]rtcp.Packet{&rtcp.PictureLossIndication{ //nolint:errcheck
+			MediaSSRC: uint32(track.SSRC()),
+		}})
+	}
+
+	// lost packets are requested by the NACK generator
+	for {
+		pkt, _, err := track.ReadRTP()
+		if err != nil {
+			return
+		}
+
+		s.stream.WritePacketRTP(t.medi, pkt)
+	}
+}
+
+// WHIPHandler is a HTTP handler that accepts publishers that use the
+// WebRTC-HTTP Ingestion Protocol (WHIP).
+// Each publisher is routed into a ServerStream, that contains
+// the formats that have been negotiated with the publisher
+// (H264, VP8, VP9, Opus, G722, G711).
+//
+// Offers must be POSTed to the handler path;
+// sessions can be terminated with a DELETE request to the returned location.
+type WHIPHandler struct {
+	//
+	// parameters (all optional)
+	//
+	// URLs of ICE servers (STUN or TURN) to use.
+	ICEServers []string
+
+	//
+	// callbacks (all optional)
+	//
+	// called when a session is opened.
+	OnSessionOpen func(*WHIPSession)
+	// called when a session is closed.
+	OnSessionClose func(*WHIPSession)
+
+	h         handler
+	initMutex sync.Mutex
+	inited    bool
+}
+
+func (h *WHIPHandler) initialize() {
+	h.initMutex.Lock()
+	defer h.initMutex.Unlock()
+
+	if h.inited {
+		return
+	}
+	h.inited = true
+
+	if h.OnSessionOpen == nil {
+		h.OnSessionOpen = func(*WHIPSession) {}
+	}
+	if h.OnSessionClose == nil {
+		h.OnSessionClose = func(*WHIPSession) {}
+	}
+}
+
+// Close closes all sessions.
+func (h *WHIPHandler) Close() {
+	h.h.closeAll()
+}
+
+// ServeHTTP implements http.Handler.
+func (h *WHIPHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.initialize()
+
+	h.h.serveHTTP(w, r, func(ctx context.Context, offer string) (session, string, error) {
+		return h.newSession(ctx, offer)
+	})
+}
+
+func (h *WHIPHandler) newSession(ctx context.Context, offer string) (session, string, error) {
+	api, err := newAPI(supportedCodecs)
+	if err != nil {
+		return nil, "", err
+	}
+
+	pc, err := api.NewPeerConnection(newConfiguration(h.ICEServers))
+	if err != nil {
+		return nil, "", err
+	}
+
+	s := &WHIPSession{
+		h:      h,
+		pc:     pc,
+		tracks: make(map[*webrtc.RTPTransceiver]*whipTrack),
+	}
+
+	ans, err := s.initialize(ctx, offer)
+	if err != nil {
+		// the session is closed without calling OnSessionClose,
+		// since OnSessionOpen has not been called.
+		s.closeOnce.Do(func() {
+			pc.Close()
+			if s.stream != nil {
+				s.stream.Close()
+			}
+		})
+		return nil, "", err
+	}
+
+	h.OnSessionOpen(s)
+
+	return s, ans, nil
+}
+
+func (s *WHIPSession) initialize(ctx context.Context, offer string) (string, error) {
+	err := s.pc.SetRemoteDescription(webrtc.SessionDescription{
+		Type: webrtc.SDPTypeOffer,
+		SDP:  offer,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	for _, tr := range s.pc.GetTransceivers() {
+		if tr.Direction() != webrtc.RTPTransceiverDirectionRecvonly {
+			continue
+		}
+
+		medi := &media.Media{
+			Type: media.TypeAudio,
+		}
+		if tr.Kind() == webrtc.RTPCodecTypeVideo {
+			medi.Type = media.TypeVideo
+		}
+
+		for _, codec := range tr.Receiver().GetParameters().Codecs {
+			forma, ok := codecToFormat(codec)
+			if ok {
+				medi.Formats = append(medi.Formats, forma)
+			}
+		}
+
+		if len(medi.Formats) == 0 {
+			continue
+		}
+
+		s.medias = append(s.medias, medi)
+		s.tracks[tr] = &whipTrack{medi: medi}
+	}
+
+	if len(s.medias) == 0 {
+		return "", fmt.Errorf("the offer doesn't contain any supported codec")
+	}
+
+	s.stream = gortsplib.NewServerStream(s.medias)
+
+	s.pc.OnTrack(func(track *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) {
+		t, ok := s.tracks[receiver.RTPTransceiver()]
+		if !ok {
+			return
+		}
+
+		go s.runTrack(t, track)
+	})
+
+	s.pc.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		switch state {
+		case webrtc.PeerConnectionStateFailed, webrtc.PeerConnectionStateClosed:
+			go s.close()
+		}
+	})
+
+	ans, err := answer(ctx, s.pc)
+	if err != nil {
+		return "", err
+	}
+
+	return ans.SDP, nil
+}
@@ -0,0 +1,133 @@
+package webrtcbridge
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/gortsplib/v3"
+	"github.com/bluenviron/gortsplib/v3/pkg/formats"
+	"github.com/bluenviron/gortsplib/v3/pkg/media"
+)
+
+func TestWHIP(t *testing.T) {
+	sessionOpen := make(chan *WHIPSession, 1)
+	sessionClose := make(chan *WHIPSession, 1)
+
+	h := &WHIPHandler{
+		OnSessionOpen: func(s *WHIPSession) {
+			sessionOpen <- s
+		},
+		OnSessionClose: func(s *WHIPSession) {
+			sessionClose <- s
+		},
+	}
+	defer h.Close()
+
+	s := httptest.NewServer(h)
+	defer s.Close()
+
+	pc := newTestPeer(t)
+	defer pc.Close()
+
+	track, err := webrtc.NewTrackLocalStaticRTP(webrtc.RTPCodecCapability{
+		MimeType:    webrtc.MimeTypeH264,
+		ClockRate:   90000,
+		SDPFmtpLine: "level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42e01f",
+	}, "video", "stream")
+	require.NoError(t, err)
+
+	tr, err := pc.AddTransceiverFromTrack(track, webrtc.RTPTransceiverInit{
+		Direction: webrtc.RTPTransceiverDirectionSendonly,
+	})
+	require.NoError(t, err)
+
+	keyframeRequests := make(chan *rtcp.PictureLossIndication, 16)
+
+	go func() {
+		for {
+			pkts, _, err := tr.Sender().ReadRTCP()
+			if err != nil {
+				return
+			}
+
+			for _, pkt := range pkts {
+				if pli, ok := pkt.(*rtcp.PictureLossIndication); ok {
+					keyframeRequests <- pli
+				}
+			}
+		}
+	}()
+
+	sendOffer(t, pc, s.URL+"/whip")
+
+	sess := <-sessionOpen
+
+	require.Equal(t, 1, len(sess.Medias()))
+	medi := sess.Medias()[0]
+	require.Equal(t, media.TypeVideo, medi.Type)
+
+	var forma *formats.H264
+	medi.FindFormat(&forma)
+	require.NotNil(t, forma)
+	require.Equal(t, 1, forma.PacketizationMode)
+
+	received := make(chan *rtp.Packet, 16)
+
+	r := &gortsplib.ServerStreamReader{Stream: sess.Stream()}
+	for _, forma := range medi.Formats {
+		r.OnPacketRTP(medi, forma, func(pkt *rtp.Packet) {
+			received <- pkt
+		})
+	}
+	err = r.Start()
+	require.NoError(t, err)
+	defer r.Close()
+
+	// packets are written until the peer is connected
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+
+	var pkt *rtp.Packet
+	for pkt == nil {
+		select {
+		case pkt = <-received:
+		case <-ticker.C:
+			track.WriteRTP(&rtp.Packet{ //nolint:errcheck
+				Header: rtp.Header{
+					Version:        2,
+					Marker:         true,
+					SequenceNumber: 123,
+				},
+				Payload: []byte{0x05, 0x01, 0x02},
+			})
+		case <-time.After(10 * time.Second):
+			t.Fatal("timed out")
+		}
+	}
+
+	require.Equal(t, []byte{0x05, 0x01, 0x02}, pkt.Payload)
+
+	// keyframe requests coming from the RTSP side are readdressed
+	// to the SSRC of the published track
+	ssrc := uint32(tr.Sender().GetParameters().Encodings[0].SSRC)
+	require.Equal(t, ssrc, pkt.SSRC)
+
+	err = sess.WritePacketRTCP(medi, &rtcp.PictureLossIndication{
+		MediaSSRC: 0x38F27A2F,
+	})
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		pli := <-keyframeRequests
+		require.Equal(t, ssrc, pli.MediaSSRC)
+	}
+
+	sess.Close()
+	require.Equal(t, sess, <-sessionClose)
+}
@@ -0,0 +1,8 @@
+FUZZTIME ?= 30s
+
+fuzz:
+	for PKG in $$(go list ./pkg/...); do \
+		for TARGET in $$(go test -list '^Fuzz' $$PKG | grep '^Fuzz'); do \
+			go test -run '^$$' -fuzz "^$$TARGET\$$" -fuzztime $(FUZZTIME) $$PKG || exit 1; \
+		done; \
+	done
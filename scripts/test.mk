@@ -7,7 +7,10 @@ test-pkg:
 test-root:
 	go test -v -race -coverprofile=coverage-root.txt .
 
-test-nodocker: test-examples test-pkg test-root
+test-cmd:
+	go test -v -race ./cmd/...
+
+test-nodocker: test-examples test-pkg test-root test-cmd
 
 define DOCKERFILE_TEST
 FROM $(BASE_IMAGE)
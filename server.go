@@ -47,13 +47,23 @@ type streamMulticastIPReq struct {
 	res chan net.IP
 }
 
+type serverNewConn struct {
+	nconn    net.Conn
+	listener *serverListener
+}
+
+type shutdownReq struct {
+	res chan chan struct{}
+}
+
 // Server is a RTSP server.
 type Server struct {
 	//
-	// RTSP parameters (all optional except RTSPAddress)
+	// RTSP parameters (all optional except RTSPAddress or Listeners)
 	//
 	// the RTSP address of the server, to accept connections and send and receive
 	// packets with the TCP transport.
+	// It can be left empty when Listeners is filled.
 	RTSPAddress string
 	// a port to send and receive RTP packets with the UDP transport.
 	// If UDPRTPAddress and UDPRTCPAddress are filled, the server can support the UDP transport.
@@ -79,8 +89,22 @@ type Server struct {
 	// timeout of write operations.
 	// It defaults to 10 seconds
 	WriteTimeout time.Duration
+	// timeout of sessions.
+	// It is advertised to clients in the Session header, in order to let them
+	// send keepalives. Sessions that are reading with the UDP or UDP-multicast
+	// transport protocol are closed when no requests or RTCP packets are received
+	// within this timeout.
+	// It can be overridden for each session through ServerHandlerOnSetupCtx.SessionTimeout.
+	// It must be at least one second.
+	// It defaults to 60 seconds
+	SessionTimeout time.Duration
 	// a TLS configuration to accept TLS (RTSPS) connections.
 	TLSConfig *tls.Config
+	// additional listeners, that allow to accept connections on multiple addresses,
+	// with or without TLS, each with its own UDP ports (i.e. for IPv4 and IPv6 clients).
+	// Streams, sessions and multicast addresses are shared among listeners.
+	// It defaults to nil.
+	Listeners []ServerListener
 	// read buffer count.
 	// If greater than 1, allows to pass buffers to routines different than the one
 	// that is reading frames.
@@ -92,6 +116,10 @@ type Server struct {
 	// It allows to queue packets before sending them.
 	// It defaults to 256.
 	WriteBufferCount int
+	// policy applied to sessions whose write queue is full,
+	// that happens when a reader is slower than the stream.
+	// It defaults to WriteQueuePolicyDropUntilKeyframe.
+	WriteQueuePolicy WriteQueuePolicy
 	// disable automatic RTCP sender reports.
 	DisableRTCPSenderReports bool
 
@@ -101,6 +129,44 @@ type Server struct {
 	// an handler to handle server events.
 	Handler ServerHandler
 
+	//
+	// authentication (optional)
+	//
+	// an authentication and authorization layer.
+	// When filled, requests are authenticated before being passed to the handler.
+	Auth *ServerAuth
+
+	//
+	// limits (all optional)
+	//
+	// maximum number of simultaneous connections.
+	// When the limit is reached, new connections are answered
+	// with 503 Service Unavailable and closed immediately.
+	// It defaults to 0 (unlimited).
+	MaxConnections int
+	// maximum number of sessions that can be opened from a single IP.
+	// When the limit is reached, requests that would create a session are answered
+	// with 453 Not Enough Bandwidth and connections are closed.
+	// It defaults to 0 (unlimited).
+	MaxSessionsPerIP int
+	// maximum number of requests per second that can be sent through a connection.
+	// Bursts of this size are allowed. When the limit is exceeded, the request is answered
+	// with 503 Service Unavailable and the connection is closed.
+	// It defaults to 0 (unlimited).
+	MaxRequestsPerSecond int
+	// deadline, measured from the moment connections are accepted, within which
+	// connections must be authenticated, otherwise they are closed.
+	// It is not extended by requests, and doesn't apply anymore once a request
+	// has been authenticated. It is applied only when Auth is filled.
+	// It defaults to 10 seconds.
+	UnauthenticatedTimeout time.Duration
+	// maximum size of the header section of requests.
+	// It defaults to 64 KiB.
+	MaxRequestHeaderSize int
+	// maximum size of the body of requests.
+	// It defaults to 128 KiB.
+	MaxRequestBodySize int
+
 	//
 	// system functions (all optional)
 	//
@@ -117,7 +183,6 @@ type Server struct {
 
 	udpReceiverReportPeriod time.Duration
 	senderReportPeriod      time.Duration
-	sessionTimeout          time.Duration
 	checkStreamPeriod       time.Duration
 
 	ctx             context.Context
@@ -125,18 +190,18 @@ type Server struct {
 	wg              sync.WaitGroup
 	multicastNet    *net.IPNet
 	multicastNextIP net.IP
-	tcpListener     net.Listener
-	udpRTPListener  *serverUDPListener
-	udpRTCPListener *serverUDPListener
+	listeners       []*serverListener
 	sessions        map[string]*ServerSession
 	conns           map[*ServerConn]struct{}
 	closeError      error
+	drained         chan struct{} // closed when all sessions have ended after Shutdown()
 
 	// in
 	connClose         chan *ServerConn
 	sessionRequest    chan sessionRequestReq
 	sessionClose      chan *ServerSession
 	streamMulticastIP chan streamMulticastIPReq
+	shutdown          chan shutdownReq
 }
 
 // Start starts the server.
@@ -148,6 +213,12 @@ func (s *Server) Start() error {
 	if s.WriteTimeout == 0 {
 		s.WriteTimeout = 10 * time.Second
 	}
+	if s.SessionTimeout == 0 {
+		s.SessionTimeout = 1 * 60 * time.Second
+	}
+	if s.SessionTimeout < time.Second {
+		return fmt.Errorf("SessionTimeout must be at least one second")
+	}
 	if s.ReadBufferCount == 0 {
 		s.ReadBufferCount = 256
 	}
@@ -158,6 +229,18 @@ func (s *Server) Start() error {
 		return fmt.Errorf("WriteBufferCount must be a power of two")
 	}
 
+	if s.Auth != nil {
+		err := s.Auth.initialize()
+		if err != nil {
+			return err
+		}
+	}
+
+	// limits
+	if s.UnauthenticatedTimeout == 0 {
+		s.UnauthenticatedTimeout = 10 * time.Second
+	}
+
 	// system functions
 	if s.Listen == nil {
 		s.Listen = net.Listen
@@ -173,134 +256,78 @@ func (s *Server) Start() error {
 	if s.senderReportPeriod == 0 {
 		s.senderReportPeriod = 10 * time.Second
 	}
-	if s.sessionTimeout == 0 {
-		s.sessionTimeout = 1 * 60 * time.Second
-	}
 	if s.checkStreamPeriod == 0 {
 		s.checkStreamPeriod = 1 * time.Second
 	}
 
-	if s.TLSConfig != nil && s.UDPRTPAddress != "" {
-		return fmt.Errorf("TLS can't be used with UDP")
-	}
-
 	if s.TLSConfig != nil && s.MulticastIPRange != "" {
 		return fmt.Errorf("TLS can't be used with UDP-multicast")
 	}
 
-	if s.RTSPAddress == "" {
+	var confs []*ServerListener
+
+	if s.RTSPAddress != "" {
+		confs = append(confs, &ServerListener{
+			RTSPAddress:    s.RTSPAddress,
+			TLSConfig:      s.TLSConfig,
+			UDPRTPAddress:  s.UDPRTPAddress,
+			UDPRTCPAddress: s.UDPRTCPAddress,
+		})
+	} else if len(s.Listeners) == 0 {
 		return fmt.Errorf("RTSPAddress not provided")
 	}
 
-	if (s.UDPRTPAddress != "" && s.UDPRTCPAddress == "") ||
-		(s.UDPRTPAddress == "" && s.UDPRTCPAddress != "") {
-		return fmt.Errorf("UDPRTPAddress and UDPRTCPAddress must be used together")
+	for i := range s.Listeners {
+		confs = append(confs, &s.Listeners[i])
 	}
 
-	if s.UDPRTPAddress != "" {
-		rtpPort, err := extractPort(s.UDPRTPAddress)
+	for _, conf := range confs {
+		err := conf.validate()
 		if err != nil {
 			return err
 		}
-
-		rtcpPort, err := extractPort(s.UDPRTCPAddress)
-		if err != nil {
-			return err
-		}
-
-		if (rtpPort % 2) != 0 {
-			return fmt.Errorf("RTP port must be even")
-		}
-
-		if rtcpPort != (rtpPort + 1) {
-			return fmt.Errorf("RTP and RTCP ports must be consecutive")
-		}
-
-		s.udpRTPListener, err = newServerUDPListener(
-			s.ListenPacket,
-			s.WriteTimeout,
-			false,
-			s.UDPRTPAddress,
-			true,
-		)
-		if err != nil {
-			return err
-		}
-
-		s.udpRTCPListener, err = newServerUDPListener(
-			s.ListenPacket,
-			s.WriteTimeout,
-			false,
-			s.UDPRTCPAddress,
-			false,
-		)
-		if err != nil {
-			s.udpRTPListener.close()
-			return err
-		}
 	}
 
 	if s.MulticastIPRange != "" && (s.MulticastRTPPort == 0 || s.MulticastRTCPPort == 0) ||
 		(s.MulticastRTPPort != 0 && (s.MulticastRTCPPort == 0 || s.MulticastIPRange == "")) ||
 		s.MulticastRTCPPort != 0 && (s.MulticastRTPPort == 0 || s.MulticastIPRange == "") {
-		if s.udpRTPListener != nil {
-			s.udpRTPListener.close()
-		}
-		if s.udpRTCPListener != nil {
-			s.udpRTCPListener.close()
-		}
 		return fmt.Errorf("MulticastIPRange, MulticastRTPPort and MulticastRTCPPort must be used together")
 	}
 
 	if s.MulticastIPRange != "" {
 		if (s.MulticastRTPPort % 2) != 0 {
-			if s.udpRTPListener != nil {
-				s.udpRTPListener.close()
-			}
-			if s.udpRTCPListener != nil {
-				s.udpRTCPListener.close()
-			}
 			return fmt.Errorf("RTP port must be even")
 		}
 
 		if s.MulticastRTCPPort != (s.MulticastRTPPort + 1) {
-			if s.udpRTPListener != nil {
-				s.udpRTPListener.close()
-			}
-			if s.udpRTCPListener != nil {
-				s.udpRTCPListener.close()
-			}
 			return fmt.Errorf("RTP and RTCP ports must be consecutive")
 		}
 
 		var err error
 		_, s.multicastNet, err = net.ParseCIDR(s.MulticastIPRange)
 		if err != nil {
-			if s.udpRTPListener != nil {
-				s.udpRTPListener.close()
-			}
-			if s.udpRTCPListener != nil {
-				s.udpRTCPListener.close()
-			}
 			return err
 		}
 
 		s.multicastNextIP = s.multicastNet.IP
 	}
 
-	var err error
-	s.tcpListener, err = s.Listen("tcp", s.RTSPAddress)
-	if err != nil {
-		if s.udpRTPListener != nil {
-			s.udpRTPListener.close()
-		}
-		if s.udpRTCPListener != nil {
-			s.udpRTCPListener.close()
+	s.listeners = nil
+
+	for _, conf := range confs {
+		l, err := newServerListener(s, conf)
+		if err != nil {
+			for _, l := range s.listeners {
+				l.close()
+			}
+			return err
 		}
-		return err
+
+		s.listeners = append(s.listeners, l)
 	}
 
 	s.ctx, s.ctxCancel = context.WithCancel(context.Background())
+	s.shutdown = make(chan shutdownReq)
 
 	s.wg.Add(1)
 	go s.run()
@@ -315,6 +342,37 @@ func (s *Server) Close() error {
 	return s.closeError
 }
 
+// Shutdown gracefully shuts down the server.
+// It stops accepting connections, closes connections that are not associated with a session,
+// sends a TEARDOWN request to readers and closes their sessions, then waits for
+// recording sessions to end, in order to allow publishers to finish their recordings.
+// When all sessions have ended, or when the context expires, all the server resources are closed.
+// It returns the context error if the context expires before all sessions have ended.
+func (s *Server) Shutdown(ctx context.Context) error {
+	req := shutdownReq{
+		res: make(chan chan struct{}),
+	}
+
+	var drained chan struct{}
+	select {
+	case s.shutdown <- req:
+		drained = <-req.res
+	case <-s.ctx.Done():
+		s.Close()
+		return nil
+	}
+
+	var err error
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	s.Close()
+	return err
+}
+
 // Wait waits until all server resources are closed.
 // This can happen when a fatal error occurs or when Close() is called.
 func (s *Server) Wait() error {
@@ -332,40 +390,40 @@ func (s *Server) run() {
 	s.sessionClose = make(chan *ServerSession)
 	s.streamMulticastIP = make(chan streamMulticastIPReq)
 
-	s.wg.Add(1)
-	connNew := make(chan net.Conn)
+	connNew := make(chan serverNewConn)
 	acceptErr := make(chan error)
-	go func() {
-		defer s.wg.Done()
-		err := func() error {
-			for {
-				nconn, err := s.tcpListener.Accept()
-				if err != nil {
-					return err
-				}
 
-				select {
-				case connNew <- nconn:
-				case <-s.ctx.Done():
-					nconn.Close()
-				}
-			}
-		}()
+	for _, l := range s.listeners {
+		s.wg.Add(1)
+		go func(l *serverListener) {
+			defer s.wg.Done()
+			err := l.runAccept(s, connNew)
 
-		select {
-		case acceptErr <- err:
-		case <-s.ctx.Done():
-		}
-	}()
+			select {
+			case acceptErr <- err:
+			case <-s.ctx.Done():
+			}
+		}(l)
+	}
 
 	s.closeError = func() error {
 		for {
 			select {
 			case err := <-acceptErr:
+				// the listener has been closed by Shutdown()
+				if s.drained != nil {
+					continue
+				}
 				return err
 
-			case nconn := <-connNew:
-				sc := newServerConn(s, nconn)
+			case nc := <-connNew:
+				if s.MaxConnections != 0 && len(s.conns) >= s.MaxConnections {
+					// the connection is not counted, and is closed after sending a 503 response.
+					newServerConn(s, nc.nconn, nc.listener, liberrors.ErrServerTooManyConnections{})
+					continue
+				}
+
+				sc := newServerConn(s, nc.nconn, nc.listener, nil)
 				s.conns[sc] = struct{}{}
 
 			case sc := <-s.connClose:
@@ -409,6 +467,26 @@ func (s *Server) run() {
 						continue
 					}
 
+					if s.drained != nil {
+						req.res <- sessionRequestRes{
+							res: &base.Response{
+								StatusCode: base.StatusServiceUnavailable,
+							},
+							err: liberrors.ErrServerShuttingDown{},
+						}
+						continue
+					}
+
+					if s.MaxSessionsPerIP != 0 && s.sessionCountByIP(req.sc) >= s.MaxSessionsPerIP {
+						req.res <- sessionRequestRes{
+							res: &base.Response{
+								StatusCode: base.StatusNotEnoughBandwidth,
+							},
+							err: liberrors.ErrServerTooManySessions{IP: req.sc.ip()},
+						}
+						continue
+					}
+
 					secretID := uuid.New().String()
 					ss := newServerSession(s, secretID, req.sc)
 					s.sessions[secretID] = ss
@@ -431,6 +509,10 @@ func (s *Server) run() {
 				}
 				delete(s.sessions, ss.secretID)
 				ss.Close()
+				s.checkDrained()
+
+			case req := <-s.shutdown:
+				s.doShutdown(req)
 
 			case req := <-s.streamMulticastIP:
 				ip32 := uint32(s.multicastNextIP[0])<<24 | uint32(s.multicastNextIP[1])<<16 |
@@ -454,15 +536,68 @@ func (s *Server) run() {
 
 	s.ctxCancel()
 
-	if s.udpRTCPListener != nil {
-		s.udpRTCPListener.close()
+	for _, l := range s.listeners {
+		l.close()
+	}
+}
+
+func (s *Server) doShutdown(req shutdownReq) {
+	if s.drained != nil {
+		req.res <- s.drained
+		return
+	}
+
+	s.drained = make(chan struct{})
+	req.res <- s.drained
+
+	for _, l := range s.listeners {
+		l.tcpListener.Close()
+	}
+
+	// close connections that are not associated with a session.
+	inUse := make(map[*ServerConn]struct{})
+	for _, ss := range s.sessions {
+		ss.connsMutex.RLock()
+		for sc := range ss.conns {
+			inUse[sc] = struct{}{}
+		}
+		ss.connsMutex.RUnlock()
+	}
+
+	for sc := range s.conns {
+		if _, ok := inUse[sc]; !ok {
+			sc.Close()
+		}
 	}
 
-	if s.udpRTPListener != nil {
-		s.udpRTPListener.close()
+	for _, ss := range s.sessions {
+		select {
+		case ss.shutdown <- struct{}{}:
+		default:
+		}
 	}
 
-	s.tcpListener.Close()
+	s.checkDrained()
+}
+
+func (s *Server) checkDrained() {
+	if s.drained != nil && len(s.sessions) == 0 {
+		select {
+		case <-s.drained:
+		default:
+			close(s.drained)
+		}
+	}
+}
+
+func (s *Server) sessionCountByIP(sc *ServerConn) int {
+	n := 0
+	for _, ss := range s.sessions {
+		if ss.author.ip().Equal(sc.ip()) && ss.author.zone() == sc.zone() {
+			n++
+		}
+	}
+	return n
 }
 
 // StartAndWait starts the server and waits until a fatal error.
@@ -0,0 +1,179 @@
+package gortsplib
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v3/pkg/auth"
+	"github.com/bluenviron/gortsplib/v3/pkg/base"
+	"github.com/bluenviron/gortsplib/v3/pkg/headers"
+	"github.com/bluenviron/gortsplib/v3/pkg/url"
+)
+
+// ServerAuthAction is an action that can be performed on a path.
+type ServerAuthAction int
+
+// actions.
+const (
+	ServerAuthActionRead ServerAuthAction = iota
+	ServerAuthActionPublish
+)
+
+var serverAuthActionLabels = map[ServerAuthAction]string{
+	ServerAuthActionRead:    "read",
+	ServerAuthActionPublish: "publish",
+}
+
+// String implements fmt.Stringer.
+func (a ServerAuthAction) String() string {
+	if l, ok := serverAuthActionLabels[a]; ok {
+		return l
+	}
+	return "unknown"
+}
+
+// ServerAuthPermission allows a user to perform an action on some paths.
+type ServerAuthPermission struct {
+	// user.
+	// If empty, the permission is granted to everybody,
+	// including clients that do not provide credentials.
+	User string
+
+	// action.
+	Action ServerAuthAction
+
+	// path. It can be a static path, like "/mystream", or a pattern,
+	// with the same syntax of ServerMux, like "/cameras/{id}".
+	// If empty, the permission is valid for all paths.
+	Path string
+
+	route *serverMuxRoute
+}
+
+func (p *ServerAuthPermission) matches(user string, action ServerAuthAction, path string) bool {
+	if p.User != "" && p.User != user {
+		return false
+	}
+
+	if p.Action != action {
+		return false
+	}
+
+	if p.route != nil {
+		if _, ok := p.route.match(path); !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ServerAuth is the authentication and authorization layer of a Server.
+//
+// DESCRIBE, ANNOUNCE and SETUP requests are authenticated and authorized
+// before being passed to the handler; requests without valid credentials
+// are answered with 401, requests of users without permissions are answered with 403.
+// Other requests are bound to a session, that can only be created by
+// an authenticated client.
+type ServerAuth struct {
+	// credential provider. It is mandatory.
+	// Available implementations are auth.StaticCredentials, auth.Htpasswd
+	// and auth.CredentialFunc.
+	Credentials auth.CredentialProvider
+
+	// permissions.
+	// If nil, all authenticated users can read and publish any path.
+	Permissions []ServerAuthPermission
+
+	// realm.
+	// It defaults to "IPCAM".
+	Realm string
+
+	// authentication methods.
+	// Hashed passwords can only be used with the Basic method.
+	// It defaults to Basic and Digest.
+	Methods []headers.AuthMethod
+
+	// lifetime of nonces of the Digest method.
+	// When a nonce expires, the client is asked to repeat the request
+	// with a new nonce (stale=true).
+	// It defaults to 5 minutes.
+	NonceLifetime time.Duration
+
+	authenticator *auth.Authenticator
+}
+
+func (a *ServerAuth) initialize() error {
+	if a.Credentials == nil {
+		return fmt.Errorf("Credentials must be provided")
+	}
+
+	for i := range a.Permissions {
+		p := &a.Permissions[i]
+
+		if p.Path != "" {
+			r, err := newServerMuxRoute(p.Path, nil)
+			if err != nil {
+				return fmt.Errorf("invalid permission path '%s': %s", p.Path, err)
+			}
+			p.route = r
+		}
+	}
+
+	a.authenticator = &auth.Authenticator{
+		Credentials:   a.Credentials,
+		Realm:         a.Realm,
+		Methods:       a.Methods,
+		NonceLifetime: a.NonceLifetime,
+	}
+	a.authenticator.Init()
+
+	return nil
+}
+
+func (a *ServerAuth) permitted(user string, action ServerAuthAction, path string) bool {
+	if a.Permissions == nil {
+		return user != ""
+	}
+
+	for i := range a.Permissions {
+		if a.Permissions[i].matches(user, action, path) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// authorize checks whether a request is allowed to perform an action on a path.
+// It returns a response if the request must be refused.
+func (a *ServerAuth) authorize(
+	req *base.Request,
+	baseURL *url.URL,
+	action ServerAuthAction,
+	path string,
+) *base.Response {
+	_, hasCredentials := req.Header["Authorization"]
+
+	if !hasCredentials && a.permitted("", action, path) {
+		return nil
+	}
+
+	user, err := a.authenticator.ValidateRequest(req, baseURL)
+	if err != nil {
+		return &base.Response{
+			StatusCode: base.StatusUnauthorized,
+			Header: base.Header{
+				"WWW-Authenticate": a.authenticator.Header(err == auth.ErrStaleNonce),
+			},
+		}
+	}
+
+	if !a.permitted(user, action, path) {
+		return &base.Response{
+			StatusCode: base.StatusForbidden,
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,412 @@
+package gortsplib
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/gortsplib/v3/pkg/base"
+	"github.com/bluenviron/gortsplib/v3/pkg/conn"
+	"github.com/bluenviron/gortsplib/v3/pkg/formats"
+	"github.com/bluenviron/gortsplib/v3/pkg/headers"
+	"github.com/bluenviron/gortsplib/v3/pkg/media"
+)
+
+const (
+	// placeholder of the URL of the media returned by DESCRIBE.
+	conformancePlayMediaURL = "<play-media>"
+
+	conformancePlayTransport   = "RTP/AVP/TCP;unicast;interleaved=0-1"
+	conformanceRecordTransport = "RTP/AVP/TCP;unicast;interleaved=0-1;mode=record"
+)
+
+var conformanceRecordMedias = media.Medias{
+	{
+		Type:    media.TypeVideo,
+		Control: "trackID=0",
+		Formats: []formats.Format{&formats.H264{
+			PayloadTyp:        96,
+			SPS:               []byte{0x01, 0x02, 0x03, 0x04},
+			PPS:               []byte{0x01, 0x02, 0x03, 0x04},
+			PacketizationMode: 1,
+		}},
+	},
+	{
+		Type:    media.TypeAudio,
+		Control: "trackID=1",
+		Formats: []formats.Format{&formats.G711{}},
+	},
+}
+
+// conformanceStep is a request and the status code that the server must return.
+// When raw is set, it is sent as it is, and status zero means that the server must close the connection.
+type conformanceStep struct {
+	method base.Method
+	url    string
+	header base.Header
+	body   []byte
+	raw    string
+	status base.StatusCode
+}
+
+func conformanceAnnounce(status base.StatusCode) conformanceStep {
+	return conformanceStep{
+		method: base.Announce,
+		url:    "rtsp://localhost:8554/teststream",
+		header: base.Header{"Content-Type": base.HeaderValue{"application/sdp"}},
+		body:   mustMarshalMedias(conformanceRecordMedias),
+		status: status,
+	}
+}
+
+func conformanceSetup(u string, transport string, status base.StatusCode) conformanceStep {
+	return conformanceStep{
+		method: base.Setup,
+		url:    u,
+		header: base.Header{"Transport": base.HeaderValue{transport}},
+		status: status,
+	}
+}
+
+func conformanceRequest(method base.Method, u string, status base.StatusCode) conformanceStep {
+	return conformanceStep{
+		method: method,
+		url:    u,
+		status: status,
+	}
+}
+
+func TestServerConformance(t *testing.T) {
+	for _, ca := range []struct {
+		name  string
+		steps []conformanceStep
+	}{
+		{
+			"play",
+			[]conformanceStep{
+				conformanceRequest(base.Options, "rtsp://localhost:8554/teststream", base.StatusOK),
+				conformanceRequest(base.Describe, "rtsp://localhost:8554/teststream", base.StatusOK),
+				conformanceSetup(conformancePlayMediaURL, conformancePlayTransport, base.StatusOK),
+				conformanceRequest(base.Play, "rtsp://localhost:8554/teststream", base.StatusOK),
+				conformanceRequest(base.Pause, "rtsp://localhost:8554/teststream", base.StatusOK),
+				conformanceRequest(base.Play, "rtsp://localhost:8554/teststream", base.StatusOK),
+				conformanceRequest(base.Teardown, "rtsp://localhost:8554/teststream", base.StatusOK),
+			},
+		},
+		{
+			"record",
+			[]conformanceStep{
+				conformanceAnnounce(base.StatusOK),
+				conformanceSetup("rtsp://localhost:8554/teststream/trackID=0", conformanceRecordTransport, base.StatusOK),
+				conformanceSetup("rtsp://localhost:8554/teststream/trackID=1",
+					"RTP/AVP/TCP;unicast;interleaved=2-3;mode=record", base.StatusOK),
+				conformanceRequest(base.Record, "rtsp://localhost:8554/teststream", base.StatusOK),
+				conformanceRequest(base.Pause, "rtsp://localhost:8554/teststream", base.StatusOK),
+				conformanceRequest(base.Teardown, "rtsp://localhost:8554/teststream", base.StatusOK),
+			},
+		},
+		{
+			"play without session",
+			[]conformanceStep{
+				conformanceRequest(base.Play, "rtsp://localhost:8554/teststream", base.StatusSessionNotFound),
+			},
+		},
+		{
+			"record without session",
+			[]conformanceStep{
+				conformanceRequest(base.Record, "rtsp://localhost:8554/teststream", base.StatusSessionNotFound),
+			},
+		},
+		{
+			"pause without session",
+			[]conformanceStep{
+				conformanceRequest(base.Pause, "rtsp://localhost:8554/teststream", base.StatusSessionNotFound),
+			},
+		},
+		{
+			"teardown without session",
+			[]conformanceStep{
+				conformanceRequest(base.Teardown, "rtsp://localhost:8554/teststream", base.StatusSessionNotFound),
+			},
+		},
+		{
+			"play with unknown session",
+			[]conformanceStep{
+				{
+					method: base.Play,
+					url:    "rtsp://localhost:8554/teststream",
+					header: base.Header{"Session": base.HeaderValue{"ABC"}},
+					status: base.StatusSessionNotFound,
+				},
+			},
+		},
+		{
+			"record after setup for playing",
+			[]conformanceStep{
+				conformanceSetup(conformancePlayMediaURL, conformancePlayTransport, base.StatusOK),
+				conformanceRequest(base.Record, "rtsp://localhost:8554/teststream", base.StatusMethodNotValidInThisState),
+			},
+		},
+		{
+			"play after announce",
+			[]conformanceStep{
+				conformanceAnnounce(base.StatusOK),
+				conformanceSetup("rtsp://localhost:8554/teststream/trackID=0", conformanceRecordTransport, base.StatusOK),
+				conformanceRequest(base.Play, "rtsp://localhost:8554/teststream", base.StatusMethodNotValidInThisState),
+			},
+		},
+		{
+			"announce after setup for playing",
+			[]conformanceStep{
+				conformanceSetup(conformancePlayMediaURL, conformancePlayTransport, base.StatusOK),
+				conformanceAnnounce(base.StatusMethodNotValidInThisState),
+			},
+		},
+		{
+			"setup after play",
+			[]conformanceStep{
+				conformanceSetup(conformancePlayMediaURL, conformancePlayTransport, base.StatusOK),
+				conformanceRequest(base.Play, "rtsp://localhost:8554/teststream", base.StatusOK),
+				conformanceSetup(conformancePlayMediaURL,
+					"RTP/AVP/TCP;unicast;interleaved=2-3", base.StatusMethodNotValidInThisState),
+			},
+		},
+		{
+			"setup after record",
+			[]conformanceStep{
+				conformanceAnnounce(base.StatusOK),
+				conformanceSetup("rtsp://localhost:8554/teststream/trackID=0", conformanceRecordTransport, base.StatusOK),
+				conformanceSetup("rtsp://localhost:8554/teststream/trackID=1",
+					"RTP/AVP/TCP;unicast;interleaved=2-3;mode=record", base.StatusOK),
+				conformanceRequest(base.Record, "rtsp://localhost:8554/teststream", base.StatusOK),
+				conformanceSetup("rtsp://localhost:8554/teststream/trackID=1",
+					"RTP/AVP/TCP;unicast;interleaved=4-5;mode=record", base.StatusMethodNotValidInThisState),
+			},
+		},
+		{
+			"record before all medias are setup",
+			[]conformanceStep{
+				conformanceAnnounce(base.StatusOK),
+				conformanceSetup("rtsp://localhost:8554/teststream/trackID=0", conformanceRecordTransport, base.StatusOK),
+				conformanceRequest(base.Record, "rtsp://localhost:8554/teststream", base.StatusBadRequest),
+			},
+		},
+		{
+			"setup of a media that is already setup",
+			[]conformanceStep{
+				conformanceSetup(conformancePlayMediaURL, conformancePlayTransport, base.StatusOK),
+				conformanceSetup(conformancePlayMediaURL, "RTP/AVP/TCP;unicast;interleaved=2-3", base.StatusBadRequest),
+			},
+		},
+		{
+			"play after teardown",
+			[]conformanceStep{
+				conformanceSetup(conformancePlayMediaURL, conformancePlayTransport, base.StatusOK),
+				conformanceRequest(base.Teardown, "rtsp://localhost:8554/teststream", base.StatusOK),
+				conformanceRequest(base.Play, "rtsp://localhost:8554/teststream", base.StatusSessionNotFound),
+			},
+		},
+		{
+			"setup without transport",
+			[]conformanceStep{
+				conformanceRequest(base.Setup, conformancePlayMediaURL, base.StatusBadRequest),
+			},
+		},
+		{
+			"setup with invalid transport",
+			[]conformanceStep{
+				conformanceSetup(conformancePlayMediaURL, "RTP/AVP/TCP;unicast;interleaved=a-b", base.StatusBadRequest),
+			},
+		},
+		{
+			"setup with unsupported transport",
+			[]conformanceStep{
+				conformanceSetup(conformancePlayMediaURL, "RTP/AVP;multicast", base.StatusUnsupportedTransport),
+			},
+		},
+		{
+			"setup of a media that does not exist",
+			[]conformanceStep{
+				conformanceAnnounce(base.StatusOK),
+				conformanceSetup("rtsp://localhost:8554/teststream/trackID=5", conformanceRecordTransport,
+					base.StatusBadRequest),
+			},
+		},
+		{
+			"announce without content type",
+			[]conformanceStep{
+				{
+					method: base.Announce,
+					url:    "rtsp://localhost:8554/teststream",
+					body:   mustMarshalMedias(conformanceRecordMedias),
+					status: base.StatusBadRequest,
+				},
+			},
+		},
+		{
+			"announce with invalid sdp",
+			[]conformanceStep{
+				{
+					method: base.Announce,
+					url:    "rtsp://localhost:8554/teststream",
+					header: base.Header{"Content-Type": base.HeaderValue{"application/sdp"}},
+					body:   []byte("invalid"),
+					status: base.StatusBadRequest,
+				},
+			},
+		},
+		{
+			"unsupported method",
+			[]conformanceStep{
+				conformanceRequest(base.Method("INVALID"), "rtsp://localhost:8554/teststream", base.StatusNotImplemented),
+			},
+		},
+		{
+			"missing cseq",
+			[]conformanceStep{
+				{
+					raw:    "OPTIONS rtsp://localhost:8554/teststream RTSP/1.0\r\n\r\n",
+					status: base.StatusBadRequest,
+				},
+			},
+		},
+		{
+			"invalid protocol",
+			[]conformanceStep{
+				{
+					raw: "OPTIONS rtsp://localhost:8554/teststream RTSP/2.0\r\nCSeq: 1\r\n\r\n",
+				},
+			},
+		},
+		{
+			"invalid url",
+			[]conformanceStep{
+				{
+					raw: "OPTIONS http://localhost:8554/teststream RTSP/1.0\r\nCSeq: 1\r\n\r\n",
+				},
+			},
+		},
+		{
+			"header without colon",
+			[]conformanceStep{
+				{
+					raw: "OPTIONS rtsp://localhost:8554/teststream RTSP/1.0\r\nCSeq 1\r\n\r\n",
+				},
+			},
+		},
+		{
+			"invalid content length",
+			[]conformanceStep{
+				{
+					raw: "ANNOUNCE rtsp://localhost:8554/teststream RTSP/1.0\r\nCSeq: 1\r\nContent-Length: a\r\n\r\n",
+				},
+			},
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			stream := NewServerStream(media.Medias{testH264Media})
+			defer stream.Close()
+
+			s := &Server{
+				Handler: &testServerHandler{
+					onDescribe: func(ctx *ServerHandlerOnDescribeCtx) (*base.Response, *ServerStream, error) {
+						return &base.Response{
+							StatusCode: base.StatusOK,
+						}, stream, nil
+					},
+					onAnnounce: func(ctx *ServerHandlerOnAnnounceCtx) (*base.Response, error) {
+						return &base.Response{
+							StatusCode: base.StatusOK,
+						}, nil
+					},
+					onSetup: func(ctx *ServerHandlerOnSetupCtx) (*base.Response, *ServerStream, error) {
+						if ctx.Session.State() == ServerSessionStatePreRecord {
+							return &base.Response{
+								StatusCode: base.StatusOK,
+							}, nil, nil
+						}
+						return &base.Response{
+							StatusCode: base.StatusOK,
+						}, stream, nil
+					},
+					onPlay: func(ctx *ServerHandlerOnPlayCtx) (*base.Response, error) {
+						return &base.Response{
+							StatusCode: base.StatusOK,
+						}, nil
+					},
+					onRecord: func(ctx *ServerHandlerOnRecordCtx) (*base.Response, error) {
+						return &base.Response{
+							StatusCode: base.StatusOK,
+						}, nil
+					},
+					onPause: func(ctx *ServerHandlerOnPauseCtx) (*base.Response, error) {
+						return &base.Response{
+							StatusCode: base.StatusOK,
+						}, nil
+					},
+				},
+				RTSPAddress: "localhost:8554",
+			}
+
+			err := s.Start()
+			require.NoError(t, err)
+			defer s.Close()
+
+			nconn, err := net.Dial("tcp", "localhost:8554")
+			require.NoError(t, err)
+			defer nconn.Close()
+			conn := conn.NewConn(nconn)
+
+			desc, err := doDescribe(conn)
+			require.NoError(t, err)
+			playMediaURL := absoluteControlAttribute(desc.MediaDescriptions[0])
+
+			session := ""
+
+			for i, step := range ca.steps {
+				if step.raw != "" {
+					_, err := nconn.Write([]byte(step.raw))
+					require.NoError(t, err)
+
+					res, err := conn.ReadResponse()
+					if step.status == 0 {
+						require.Error(t, err, "step %d", i)
+					} else {
+						require.NoError(t, err)
+						require.Equal(t, step.status, res.StatusCode, "step %d", i)
+					}
+					continue
+				}
+
+				h := base.Header{
+					"CSeq": base.HeaderValue{strconv.FormatInt(int64(i)+2, 10)},
+				}
+				for k, v := range step.header {
+					h[k] = v
+				}
+				if _, ok := h["Session"]; !ok && session != "" {
+					h["Session"] = base.HeaderValue{session}
+				}
+
+				res, err := writeReqReadRes(conn, base.Request{
+					Method: step.method,
+					URL:    mustParseURL(strings.ReplaceAll(step.url, conformancePlayMediaURL, playMediaURL)),
+					Header: h,
+					Body:   step.body,
+				})
+				require.NoError(t, err)
+				require.Equal(t, step.status, res.StatusCode, "step %d", i)
+
+				if v, ok := res.Header["Session"]; ok {
+					var sx headers.Session
+					err := sx.Unmarshal(v)
+					require.NoError(t, err)
+					session = sx.Session
+				}
+			}
+		})
+	}
+}
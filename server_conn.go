@@ -6,7 +6,9 @@ import (
 	"errors"
 	"net"
 	gourl "net/url"
+	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -55,10 +57,17 @@ type readReq struct {
 	res chan error
 }
 
+type serverConnPendingRequest struct {
+	ss    *ServerSession
+	req   *base.Request
+	timer *time.Timer
+}
+
 // ServerConn is a server-side RTSP connection.
 type ServerConn struct {
-	s     *Server
-	nconn net.Conn
+	s        *Server
+	nconn    net.Conn
+	listener *serverListener
 
 	ctx        context.Context
 	ctxCancel  func()
@@ -68,6 +77,17 @@ type ServerConn struct {
 	conn       *conn.Conn
 	session    *ServerSession
 	readFunc   func(readRequest chan readReq) error
+	rejectErr  error
+
+	// limits
+	authenticated     bool
+	requestTokens     float64
+	requestTokensTime time.Time
+
+	// requests sent to the client
+	requestsMutex   sync.Mutex
+	cseq            int
+	pendingRequests map[string]*serverConnPendingRequest
 
 	// in
 	sessionRemove chan *ServerSession
@@ -79,22 +99,29 @@ type ServerConn struct {
 func newServerConn(
 	s *Server,
 	nconn net.Conn,
+	listener *serverListener,
+	rejectErr error,
 ) *ServerConn {
 	ctx, ctxCancel := context.WithCancel(s.ctx)
 
-	if s.TLSConfig != nil {
-		nconn = tls.Server(nconn, s.TLSConfig)
+	if listener.conf.TLSConfig != nil {
+		nconn = tls.Server(nconn, listener.conf.TLSConfig)
 	}
 
 	sc := &ServerConn{
-		s:             s,
-		nconn:         nconn,
-		bc:            bytecounter.New(nconn, nil, nil),
-		ctx:           ctx,
-		ctxCancel:     ctxCancel,
-		remoteAddr:    nconn.RemoteAddr().(*net.TCPAddr),
-		sessionRemove: make(chan *ServerSession),
-		done:          make(chan struct{}),
+		s:                 s,
+		nconn:             nconn,
+		listener:          listener,
+		bc:                bytecounter.New(nconn, nil, nil),
+		ctx:               ctx,
+		ctxCancel:         ctxCancel,
+		remoteAddr:        nconn.RemoteAddr().(*net.TCPAddr),
+		rejectErr:         rejectErr,
+		requestTokens:     float64(s.MaxRequestsPerSecond),
+		requestTokensTime: time.Now(),
+		pendingRequests:   make(map[string]*serverConnPendingRequest),
+		sessionRemove:     make(chan *ServerSession),
+		done:              make(chan struct{}),
 	}
 
 	sc.readFunc = sc.readFuncStandard
@@ -116,6 +143,11 @@ func (sc *ServerConn) NetConn() net.Conn {
 	return sc.nconn
 }
 
+// Listener returns the listener through which the connection has been accepted.
+func (sc *ServerConn) Listener() *ServerListener {
+	return sc.listener.conf
+}
+
 // BytesReceived returns the number of read bytes.
 func (sc *ServerConn) BytesReceived() uint64 {
 	return sc.bc.BytesReceived()
@@ -155,6 +187,10 @@ func (sc *ServerConn) run() {
 	}
 
 	sc.conn = conn.NewConn(sc.bc)
+	sc.conn.SetReadLimits(base.ReadLimits{
+		MaxHeaderSize: sc.s.MaxRequestHeaderSize,
+		MaxBodySize:   sc.s.MaxRequestBodySize,
+	})
 
 	readRequest := make(chan readReq)
 	readErr := make(chan error)
@@ -168,6 +204,8 @@ func (sc *ServerConn) run() {
 	sc.nconn.Close()
 	<-readDone
 
+	sc.closePendingRequests(err)
+
 	if sc.session != nil {
 		select {
 		case sc.session.connRemove <- sc:
@@ -189,14 +227,46 @@ func (sc *ServerConn) run() {
 }
 
 func (sc *ServerConn) runInner(readRequest chan readReq, readErr chan error) error {
+	// answer rejected connections without waiting for a request, then close them.
+	if sc.rejectErr != nil {
+		sc.nconn.SetWriteDeadline(time.Now().Add(sc.s.WriteTimeout))
+		sc.conn.WriteResponse(&base.Response{
+			StatusCode: base.StatusServiceUnavailable,
+			Header: base.Header{
+				"Server": base.HeaderValue{"gortsplib"},
+			},
+		})
+		sc.onReject(nil, sc.rejectErr)
+		return sc.rejectErr
+	}
+
+	// close connections that are not authenticated within a deadline.
+	authTimer := emptyTimer()
+	if sc.s.Auth != nil {
+		authTimer = time.NewTimer(sc.s.UnauthenticatedTimeout)
+	}
+	defer authTimer.Stop()
+
 	for {
 		select {
 		case req := <-readRequest:
 			req.res <- sc.handleRequestOuter(req.req)
 
+			if sc.authenticated {
+				authTimer.Stop()
+			}
+
 		case err := <-readErr:
 			return err
 
+		case <-authTimer.C:
+			// the timer may have fired before being stopped.
+			if !sc.authenticated {
+				err := liberrors.ErrServerUnauthenticatedTimeout{}
+				sc.onReject(nil, err)
+				return err
+			}
+
 		case ss := <-sc.sessionRemove:
 			if sc.session == ss {
 				sc.session = nil
@@ -233,12 +303,15 @@ func (sc *ServerConn) readFuncStandard(readRequest chan readReq) error {
 	sc.nconn.SetReadDeadline(time.Time{})
 
 	for {
-		any, err := sc.conn.ReadInterleavedFrameOrRequest()
+		any, err := sc.conn.ReadInterleavedFrameOrRequestOrResponse()
 		if err != nil {
 			return err
 		}
 
 		switch what := any.(type) {
+		case *base.Response:
+			sc.handleResponse(what)
+
 		case *base.Request:
 			cres := make(chan error)
 			select {
@@ -272,12 +345,15 @@ func (sc *ServerConn) readFuncTCP(readRequest chan readReq) error {
 			sc.nconn.SetReadDeadline(time.Now().Add(sc.s.ReadTimeout))
 		}
 
-		what, err := sc.conn.ReadInterleavedFrameOrRequest()
+		what, err := sc.conn.ReadInterleavedFrameOrRequestOrResponse()
 		if err != nil {
 			return err
 		}
 
 		switch twhat := what.(type) {
+		case *base.Response:
+			sc.handleResponse(twhat)
+
 		case *base.InterleavedFrame:
 			channel := twhat.Channel
 			isRTP := true
@@ -287,6 +363,7 @@ func (sc *ServerConn) readFuncTCP(readRequest chan readReq) error {
 			}
 
 			atomic.AddUint64(sc.session.bytesReceived, uint64(len(twhat.Payload)))
+			sc.session.capture.writeInterleavedFrame(sc.nconn, false, twhat.Channel, twhat.Payload)
 
 			if sm, ok := sc.session.tcpMediasByChannel[channel]; ok {
 				if isRTP {
@@ -320,6 +397,12 @@ func (sc *ServerConn) handleRequest(req *base.Request) (*base.Response, error) {
 		}, liberrors.ErrServerCSeqMissing{}
 	}
 
+	if sc.s.MaxRequestsPerSecond != 0 && !sc.consumeRequestToken() {
+		return &base.Response{
+			StatusCode: base.StatusServiceUnavailable,
+		}, liberrors.ErrServerRequestRateExceeded{}
+	}
+
 	sxID := getSessionID(req.Header)
 
 	var path string
@@ -376,6 +459,12 @@ func (sc *ServerConn) handleRequest(req *base.Request) (*base.Response, error) {
 
 	case base.Describe:
 		if h, ok := sc.s.Handler.(ServerHandlerOnDescribe); ok {
+			if sc.s.Auth != nil {
+				if res := sc.authorize(req, nil, ServerAuthActionRead, path); res != nil {
+					return res, nil
+				}
+			}
+
 			res, stream, err := h.OnDescribe(&ServerHandlerOnDescribeCtx{
 				Conn:    sc,
 				Request: req,
@@ -423,30 +512,22 @@ func (sc *ServerConn) handleRequest(req *base.Request) (*base.Response, error) {
 		}
 
 	case base.Play:
-		if sxID != "" {
-			if _, ok := sc.s.Handler.(ServerHandlerOnPlay); ok {
-				return sc.handleRequestInSession(sxID, req, false)
-			}
+		if _, ok := sc.s.Handler.(ServerHandlerOnPlay); ok {
+			return sc.handleRequestInExistingSession(sxID, req)
 		}
 
 	case base.Record:
-		if sxID != "" {
-			if _, ok := sc.s.Handler.(ServerHandlerOnRecord); ok {
-				return sc.handleRequestInSession(sxID, req, false)
-			}
+		if _, ok := sc.s.Handler.(ServerHandlerOnRecord); ok {
+			return sc.handleRequestInExistingSession(sxID, req)
 		}
 
 	case base.Pause:
-		if sxID != "" {
-			if _, ok := sc.s.Handler.(ServerHandlerOnPause); ok {
-				return sc.handleRequestInSession(sxID, req, false)
-			}
+		if _, ok := sc.s.Handler.(ServerHandlerOnPause); ok {
+			return sc.handleRequestInExistingSession(sxID, req)
 		}
 
 	case base.Teardown:
-		if sxID != "" {
-			return sc.handleRequestInSession(sxID, req, false)
-		}
+		return sc.handleRequestInExistingSession(sxID, req)
 
 	case base.GetParameter:
 		if sxID != "" {
@@ -482,13 +563,44 @@ func (sc *ServerConn) handleRequest(req *base.Request) (*base.Response, error) {
 	}, nil
 }
 
+// handleRequestInExistingSession handles a request that can only be performed inside a session.
+func (sc *ServerConn) handleRequestInExistingSession(sxID string, req *base.Request) (*base.Response, error) {
+	if sxID == "" {
+		return &base.Response{
+			StatusCode: base.StatusSessionNotFound,
+		}, liberrors.ErrServerSessionNotFound{}
+	}
+
+	return sc.handleRequestInSession(sxID, req, false)
+}
+
 func (sc *ServerConn) handleRequestOuter(req *base.Request) error {
 	if h, ok := sc.s.Handler.(ServerHandlerOnRequest); ok {
 		h.OnRequest(sc, req)
 	}
 
+	ss := sc.session
+
 	res, err := sc.handleRequest(req)
 
+	// the request may have created the session or may have been routed to it
+	if sc.session != nil {
+		ss = sc.session
+	}
+
+	switch err.(type) {
+	case liberrors.ErrServerTooManyConnections,
+		liberrors.ErrServerTooManySessions,
+		liberrors.ErrServerRequestRateExceeded:
+		sc.onReject(req, err)
+	}
+
+	// sessions can only be created by authenticated clients,
+	// therefore clients that are able to use them are authenticated too.
+	if res.StatusCode == base.StatusOK && getSessionID(req.Header) != "" {
+		sc.authenticated = true
+	}
+
 	if res.Header == nil {
 		res.Header = make(base.Header)
 	}
@@ -508,9 +620,160 @@ func (sc *ServerConn) handleRequestOuter(req *base.Request) error {
 	sc.nconn.SetWriteDeadline(time.Now().Add(sc.s.WriteTimeout))
 	sc.conn.WriteResponse(res)
 
+	if ss != nil {
+		ss.capture.writeRTSP(sc.nconn, false, req)
+		ss.capture.writeRTSP(sc.nconn, true, res)
+	}
+
 	return err
 }
 
+// authorize checks a request with the authentication layer,
+// and marks the connection as authenticated if the request is allowed.
+func (sc *ServerConn) authorize(
+	req *base.Request,
+	baseURL *url.URL,
+	action ServerAuthAction,
+	path string,
+) *base.Response {
+	res := sc.s.Auth.authorize(req, baseURL, action, path)
+	if res == nil {
+		sc.authenticated = true
+	}
+	return res
+}
+
+// consumeRequestToken implements a token bucket that limits the request rate.
+func (sc *ServerConn) consumeRequestToken() bool {
+	now := time.Now()
+	max := float64(sc.s.MaxRequestsPerSecond)
+
+	sc.requestTokens += now.Sub(sc.requestTokensTime).Seconds() * max
+	if sc.requestTokens > max {
+		sc.requestTokens = max
+	}
+	sc.requestTokensTime = now
+
+	if sc.requestTokens < 1 {
+		return false
+	}
+
+	sc.requestTokens--
+	return true
+}
+
+func (sc *ServerConn) onReject(req *base.Request, err error) {
+	if h, ok := sc.s.Handler.(ServerHandlerOnReject); ok {
+		h.OnReject(&ServerHandlerOnRejectCtx{
+			Conn:    sc,
+			Request: req,
+			Error:   err,
+		})
+	}
+}
+
+// writeRequest sends a request to the client.
+// The response is passed to OnClientResponse.
+func (sc *ServerConn) writeRequest(ss *ServerSession, req *base.Request) error {
+	if req.Header == nil {
+		req.Header = make(base.Header)
+	}
+
+	if ss != nil {
+		req.Header["Session"] = base.HeaderValue{ss.secretID}
+	}
+
+	sc.requestsMutex.Lock()
+	sc.cseq++
+	cseq := strconv.FormatInt(int64(sc.cseq), 10)
+	req.Header["CSeq"] = base.HeaderValue{cseq}
+	sc.pendingRequests[cseq] = &serverConnPendingRequest{
+		ss:  ss,
+		req: req,
+		timer: time.AfterFunc(sc.s.ReadTimeout, func() {
+			pr := sc.removePendingRequest(cseq)
+			if pr != nil {
+				sc.onClientResponse(pr, nil, liberrors.ErrServerClientResponseTimeout{})
+			}
+		}),
+	}
+	sc.requestsMutex.Unlock()
+
+	sc.nconn.SetWriteDeadline(time.Now().Add(sc.s.WriteTimeout))
+	err := sc.conn.WriteRequest(req)
+	if err != nil {
+		sc.removePendingRequest(cseq)
+		return err
+	}
+
+	if ss != nil {
+		ss.capture.writeRTSP(sc.nconn, true, req)
+	}
+
+	return nil
+}
+
+// handleResponse handles a response to a request sent by writeRequest.
+func (sc *ServerConn) handleResponse(res *base.Response) {
+	cseq, ok := res.Header["CSeq"]
+	if !ok || len(cseq) != 1 {
+		return
+	}
+
+	pr := sc.removePendingRequest(cseq[0])
+	if pr == nil {
+		return
+	}
+
+	if pr.ss != nil {
+		pr.ss.capture.writeRTSP(sc.nconn, false, res)
+	}
+
+	sc.onClientResponse(pr, res, nil)
+}
+
+// removePendingRequest removes a request sent by writeRequest from pending ones.
+// It returns nil if the request is not pending anymore.
+func (sc *ServerConn) removePendingRequest(cseq string) *serverConnPendingRequest {
+	sc.requestsMutex.Lock()
+	defer sc.requestsMutex.Unlock()
+
+	pr, ok := sc.pendingRequests[cseq]
+	if !ok {
+		return nil
+	}
+
+	pr.timer.Stop()
+	delete(sc.pendingRequests, cseq)
+	return pr
+}
+
+// closePendingRequests reports an error for all the requests that have not been replied
+// when the connection is closed.
+func (sc *ServerConn) closePendingRequests(err error) {
+	sc.requestsMutex.Lock()
+	prs := sc.pendingRequests
+	sc.pendingRequests = make(map[string]*serverConnPendingRequest)
+	sc.requestsMutex.Unlock()
+
+	for _, pr := range prs {
+		pr.timer.Stop()
+		sc.onClientResponse(pr, nil, err)
+	}
+}
+
+func (sc *ServerConn) onClientResponse(pr *serverConnPendingRequest, res *base.Response, err error) {
+	if h, ok := sc.s.Handler.(ServerHandlerOnClientResponse); ok {
+		h.OnClientResponse(&ServerHandlerOnClientResponseCtx{
+			Session:  pr.ss,
+			Conn:     sc,
+			Request:  pr.req,
+			Response: res,
+			Error:    err,
+		})
+	}
+}
+
 func (sc *ServerConn) handleRequestInSession(
 	sxID string,
 	req *base.Request,
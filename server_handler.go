@@ -1,7 +1,10 @@
 package gortsplib
 
 import (
+	"time"
+
 	"github.com/bluenviron/gortsplib/v3/pkg/base"
+	"github.com/bluenviron/gortsplib/v3/pkg/headers"
 	"github.com/bluenviron/gortsplib/v3/pkg/media"
 )
 
@@ -107,6 +110,13 @@ type ServerHandlerOnSetupCtx struct {
 	Path      string
 	Query     string
 	Transport Transport
+
+	// timeout of the session.
+	// It contains the current timeout, and can be changed by the handler in order
+	// to override Server.SessionTimeout for this session. The new value is
+	// advertised in the response and enforced from then on.
+	// It must be at least one second.
+	SessionTimeout time.Duration
 }
 
 // ServerHandlerOnSetup can be implemented by a ServerHandler.
@@ -126,6 +136,16 @@ type ServerHandlerOnPlayCtx struct {
 	Request *base.Request
 	Path    string
 	Query   string
+
+	// requested playback speed and direction (optional).
+	// The handler can accept it by filling the Scale header of the response
+	// with the value in use, which can be different from the requested one.
+	Scale *headers.Scale
+
+	// requested delivery speed (optional).
+	// The handler can accept it by filling the Speed header of the response
+	// with the value in use, which can be different from the requested one.
+	Speed *headers.Speed
 }
 
 // ServerHandlerOnPlay can be implemented by a ServerHandler.
@@ -194,6 +214,38 @@ type ServerHandlerOnSetParameter interface {
 	OnSetParameter(*ServerHandlerOnSetParameterCtx) (*base.Response, error)
 }
 
+// ServerHandlerOnClientResponseCtx is the context of OnClientResponse.
+type ServerHandlerOnClientResponseCtx struct {
+	Session  *ServerSession
+	Conn     *ServerConn
+	Request  *base.Request
+	Response *base.Response // nil when Error is set
+	Error    error
+}
+
+// ServerHandlerOnClientResponse can be implemented by a ServerHandler.
+type ServerHandlerOnClientResponse interface {
+	// called when a client replies to a request sent by the server
+	// (i.e. by ServerSession.Redirect() or ServerSession.Announce()),
+	// or when the client doesn't reply within ReadTimeout, or when the connection is closed
+	// before the reply.
+	OnClientResponse(*ServerHandlerOnClientResponseCtx)
+}
+
+// ServerHandlerOnRejectCtx is the context of OnReject.
+type ServerHandlerOnRejectCtx struct {
+	Conn    *ServerConn
+	Request *base.Request // nil when the connection is closed before sending a request
+	Error   error
+}
+
+// ServerHandlerOnReject can be implemented by a ServerHandler.
+type ServerHandlerOnReject interface {
+	// called when a connection, a session or a request is rejected
+	// because a limit has been reached.
+	OnReject(*ServerHandlerOnRejectCtx)
+}
+
 // ServerHandlerOnWarningCtx is the context of OnWarning.
 type ServerHandlerOnWarningCtx struct {
 	Session *ServerSession
@@ -202,6 +254,7 @@ type ServerHandlerOnWarningCtx struct {
 
 // ServerHandlerOnWarning can be implemented by a ServerHandler.
 type ServerHandlerOnWarning interface {
-	// called when there's a non-fatal decoding error of RTP or RTCP packets.
+	// called when there's a non-fatal decoding error of RTP or RTCP packets,
+	// or when packets are discarded because the write queue is full.
 	OnWarning(*ServerHandlerOnWarningCtx)
 }
@@ -0,0 +1,140 @@
+package gortsplib
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+)
+
+// ServerListener is a set of addresses on which a Server accepts connections
+// and exchanges packets.
+type ServerListener struct {
+	// the RTSP address, to accept connections and send and receive
+	// packets with the TCP transport.
+	RTSPAddress string
+	// a TLS configuration to accept TLS (RTSPS) connections.
+	TLSConfig *tls.Config
+	// a port to send and receive RTP packets with the UDP transport.
+	// If UDPRTPAddress and UDPRTCPAddress are filled, sessions created
+	// through the listener can use the UDP transport.
+	UDPRTPAddress string
+	// a port to send and receive RTCP packets with the UDP transport.
+	// If UDPRTPAddress and UDPRTCPAddress are filled, sessions created
+	// through the listener can use the UDP transport.
+	UDPRTCPAddress string
+}
+
+func (conf *ServerListener) validate() error {
+	if conf.RTSPAddress == "" {
+		return fmt.Errorf("RTSPAddress not provided")
+	}
+
+	if conf.TLSConfig != nil && conf.UDPRTPAddress != "" {
+		return fmt.Errorf("TLS can't be used with UDP")
+	}
+
+	if (conf.UDPRTPAddress != "" && conf.UDPRTCPAddress == "") ||
+		(conf.UDPRTPAddress == "" && conf.UDPRTCPAddress != "") {
+		return fmt.Errorf("UDPRTPAddress and UDPRTCPAddress must be used together")
+	}
+
+	if conf.UDPRTPAddress != "" {
+		rtpPort, err := extractPort(conf.UDPRTPAddress)
+		if err != nil {
+			return err
+		}
+
+		rtcpPort, err := extractPort(conf.UDPRTCPAddress)
+		if err != nil {
+			return err
+		}
+
+		if (rtpPort % 2) != 0 {
+			return fmt.Errorf("RTP port must be even")
+		}
+
+		if rtcpPort != (rtpPort + 1) {
+			return fmt.Errorf("RTP and RTCP ports must be consecutive")
+		}
+	}
+
+	return nil
+}
+
+type serverListener struct {
+	conf            *ServerListener
+	tcpListener     net.Listener
+	udpRTPListener  *serverUDPListener
+	udpRTCPListener *serverUDPListener
+}
+
+func newServerListener(s *Server, conf *ServerListener) (*serverListener, error) {
+	l := &serverListener{
+		conf: conf,
+	}
+
+	if conf.UDPRTPAddress != "" {
+		var err error
+		l.udpRTPListener, err = newServerUDPListener(
+			s.ListenPacket,
+			s.WriteTimeout,
+			false,
+			conf.UDPRTPAddress,
+			true,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		l.udpRTCPListener, err = newServerUDPListener(
+			s.ListenPacket,
+			s.WriteTimeout,
+			false,
+			conf.UDPRTCPAddress,
+			false,
+		)
+		if err != nil {
+			l.udpRTPListener.close()
+			return nil, err
+		}
+	}
+
+	var err error
+	l.tcpListener, err = s.Listen("tcp", conf.RTSPAddress)
+	if err != nil {
+		l.closeUDP()
+		return nil, err
+	}
+
+	return l, nil
+}
+
+func (l *serverListener) close() {
+	l.closeUDP()
+	l.tcpListener.Close()
+}
+
+func (l *serverListener) closeUDP() {
+	if l.udpRTCPListener != nil {
+		l.udpRTCPListener.close()
+	}
+
+	if l.udpRTPListener != nil {
+		l.udpRTPListener.close()
+	}
+}
+
+func (l *serverListener) runAccept(s *Server, connNew chan serverNewConn) error {
+	for {
+		nconn, err := l.tcpListener.Accept()
+		if err != nil {
+			return err
+		}
+
+		select {
+		case connNew <- serverNewConn{nconn: nconn, listener: l}:
+		case <-s.ctx.Done():
+			nconn.Close()
+		}
+	}
+}
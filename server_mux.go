@@ -0,0 +1,445 @@
+package gortsplib
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/pion/rtp"
+
+	"github.com/bluenviron/gortsplib/v3/pkg/base"
+	"github.com/bluenviron/gortsplib/v3/pkg/formats"
+	"github.com/bluenviron/gortsplib/v3/pkg/media"
+)
+
+// ServerMuxPathCtx is the context of the hooks of a ServerMuxPath.
+type ServerMuxPathCtx struct {
+	Session *ServerSession
+	Conn    *ServerConn
+	Request *base.Request
+	Path    string
+	Query   string
+	// values of the parameters of the pattern of the path.
+	Params map[string]string
+}
+
+// ServerMuxPath contains the settings and hooks of a path (or a group of paths) of a ServerMux.
+type ServerMuxPath struct {
+	//
+	// settings (all optional)
+	//
+	// disable replacing the current publisher with a new one.
+	// When true, new publishers are rejected while the path is being published.
+	// It defaults to false.
+	PublisherReplaceDisable bool
+
+	//
+	// hooks (all optional)
+	//
+	// called when a client wants to publish to the path (ANNOUNCE request).
+	// If it returns an error, the request is rejected with 403 Forbidden.
+	OnPublish func(*ServerMuxPathCtx) error
+	// called when a client wants to read from the path (DESCRIBE and SETUP requests).
+	// If it returns an error, the request is rejected with 403 Forbidden.
+	OnRead func(*ServerMuxPathCtx) error
+	// called when the publisher starts recording and the stream is ready.
+	OnStreamReady func(path string, stream *ServerStream)
+	// called when the publisher leaves or is replaced and the stream is closed.
+	// Readers are disconnected after this call.
+	OnStreamClose func(path string, stream *ServerStream)
+}
+
+type serverMuxRoute struct {
+	pattern  string
+	segments []string
+	path     *ServerMuxPath
+}
+
+func newServerMuxRoute(pattern string, path *ServerMuxPath) (*serverMuxRoute, error) {
+	if !strings.HasPrefix(pattern, "/") {
+		return nil, fmt.Errorf("pattern must begin with a slash")
+	}
+
+	segments := strings.Split(pattern[1:], "/")
+
+	for i, seg := range segments {
+		if !strings.HasPrefix(seg, "{") {
+			if strings.ContainsAny(seg, "{}") {
+				return nil, fmt.Errorf("invalid segment '%s'", seg)
+			}
+			continue
+		}
+
+		if !strings.HasSuffix(seg, "}") || len(seg) < 3 {
+			return nil, fmt.Errorf("invalid segment '%s'", seg)
+		}
+
+		if strings.HasSuffix(seg, "...}") {
+			if i != (len(segments) - 1) {
+				return nil, fmt.Errorf("a wildcard segment can only be the last segment")
+			}
+			if len(seg) < 6 {
+				return nil, fmt.Errorf("invalid segment '%s'", seg)
+			}
+		}
+	}
+
+	return &serverMuxRoute{
+		pattern:  pattern,
+		segments: segments,
+		path:     path,
+	}, nil
+}
+
+func (r *serverMuxRoute) match(path string) (map[string]string, bool) {
+	if !strings.HasPrefix(path, "/") {
+		return nil, false
+	}
+
+	parts := strings.Split(path[1:], "/")
+	params := make(map[string]string)
+
+	for i, seg := range r.segments {
+		if strings.HasSuffix(seg, "...}") {
+			if i >= len(parts) {
+				return nil, false
+			}
+
+			rest := strings.Join(parts[i:], "/")
+			if rest == "" {
+				return nil, false
+			}
+
+			params[seg[1:len(seg)-4]] = rest
+			return params, true
+		}
+
+		if i >= len(parts) {
+			return nil, false
+		}
+
+		if strings.HasPrefix(seg, "{") {
+			if parts[i] == "" {
+				return nil, false
+			}
+			params[seg[1:len(seg)-1]] = parts[i]
+			continue
+		}
+
+		if seg != parts[i] {
+			return nil, false
+		}
+	}
+
+	if len(parts) != len(r.segments) {
+		return nil, false
+	}
+
+	return params, true
+}
+
+type serverMuxStream struct {
+	route     *serverMuxRoute
+	stream    *ServerStream
+	publisher *ServerSession
+	ready     bool
+}
+
+// ServerMux is a ServerHandler that routes clients to paths.
+// Clients can publish to a path with ANNOUNCE and RECORD; a ServerStream is then
+// created and packets of the publisher are routed to all the readers of the path.
+// When the publisher leaves, the stream is closed and readers are disconnected.
+type ServerMux struct {
+	mutex    sync.Mutex
+	exact    map[string]*serverMuxRoute
+	patterns []*serverMuxRoute
+	streams  map[string]*serverMuxStream
+	sessions map[*ServerSession]string
+}
+
+// Handle registers a path.
+// The pattern can be a static path (i.e. /mystream) or can contain parameters,
+// enclosed in braces, that match a single segment (i.e. /cameras/{id}) or all
+// remaining segments (i.e. /live/{name...}).
+// Static paths take precedence over patterns; patterns are tried in registration order.
+func (m *ServerMux) Handle(pattern string, path *ServerMuxPath) error {
+	r, err := newServerMuxRoute(pattern, path)
+	if err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.exact == nil {
+		m.exact = make(map[string]*serverMuxRoute)
+	}
+
+	if _, ok := m.exact[pattern]; ok {
+		return fmt.Errorf("pattern '%s' is already registered", pattern)
+	}
+	for _, r2 := range m.patterns {
+		if r2.pattern == pattern {
+			return fmt.Errorf("pattern '%s' is already registered", pattern)
+		}
+	}
+
+	if !strings.Contains(pattern, "{") {
+		m.exact[pattern] = r
+	} else {
+		m.patterns = append(m.patterns, r)
+	}
+
+	return nil
+}
+
+// Stream returns the stream of a path, if the path is being published.
+func (m *ServerMux) Stream(path string) (*ServerStream, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	ms, ok := m.streams[path]
+	if !ok || !ms.ready {
+		return nil, false
+	}
+	return ms.stream, true
+}
+
+func (m *ServerMux) findRoute(path string) (*serverMuxRoute, map[string]string, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if r, ok := m.exact[path]; ok {
+		return r, map[string]string{}, true
+	}
+
+	for _, r := range m.patterns {
+		if params, ok := r.match(path); ok {
+			return r, params, true
+		}
+	}
+
+	return nil, nil, false
+}
+
+// OnSessionClose implements ServerHandlerOnSessionClose.
+func (m *ServerMux) OnSessionClose(ctx *ServerHandlerOnSessionCloseCtx) {
+	m.mutex.Lock()
+
+	path, ok := m.sessions[ctx.Session]
+	if !ok {
+		m.mutex.Unlock()
+		return
+	}
+
+	delete(m.sessions, ctx.Session)
+
+	ms, ok := m.streams[path]
+	if !ok || ms.publisher != ctx.Session {
+		m.mutex.Unlock()
+		return
+	}
+
+	delete(m.streams, path)
+	m.mutex.Unlock()
+
+	if ms.ready && ms.route.path.OnStreamClose != nil {
+		ms.route.path.OnStreamClose(path, ms.stream)
+	}
+
+	// disconnect readers
+	ms.stream.Close()
+}
+
+// OnDescribe implements ServerHandlerOnDescribe.
+func (m *ServerMux) OnDescribe(ctx *ServerHandlerOnDescribeCtx) (*base.Response, *ServerStream, error) {
+	r, params, ok := m.findRoute(ctx.Path)
+	if !ok {
+		return &base.Response{
+			StatusCode: base.StatusNotFound,
+		}, nil, nil
+	}
+
+	if r.path.OnRead != nil {
+		err := r.path.OnRead(&ServerMuxPathCtx{
+			Conn:    ctx.Conn,
+			Request: ctx.Request,
+			Path:    ctx.Path,
+			Query:   ctx.Query,
+			Params:  params,
+		})
+		if err != nil {
+			return &base.Response{
+				StatusCode: base.StatusForbidden,
+			}, nil, nil
+		}
+	}
+
+	stream, ok := m.Stream(ctx.Path)
+	if !ok {
+		return &base.Response{
+			StatusCode: base.StatusNotFound,
+		}, nil, nil
+	}
+
+	return &base.Response{
+		StatusCode: base.StatusOK,
+	}, stream, nil
+}
+
+// OnAnnounce implements ServerHandlerOnAnnounce.
+func (m *ServerMux) OnAnnounce(ctx *ServerHandlerOnAnnounceCtx) (*base.Response, error) {
+	r, params, ok := m.findRoute(ctx.Path)
+	if !ok {
+		return &base.Response{
+			StatusCode: base.StatusNotFound,
+		}, nil
+	}
+
+	if r.path.OnPublish != nil {
+		err := r.path.OnPublish(&ServerMuxPathCtx{
+			Session: ctx.Session,
+			Conn:    ctx.Conn,
+			Request: ctx.Request,
+			Path:    ctx.Path,
+			Query:   ctx.Query,
+			Params:  params,
+		})
+		if err != nil {
+			return &base.Response{
+				StatusCode: base.StatusForbidden,
+			}, nil
+		}
+	}
+
+	m.mutex.Lock()
+
+	prev, replacing := m.streams[ctx.Path]
+	if replacing && r.path.PublisherReplaceDisable {
+		m.mutex.Unlock()
+		return &base.Response{
+			StatusCode: base.StatusBadRequest,
+		}, fmt.Errorf("path '%s' is already being published", ctx.Path)
+	}
+
+	if m.streams == nil {
+		m.streams = make(map[string]*serverMuxStream)
+	}
+	if m.sessions == nil {
+		m.sessions = make(map[*ServerSession]string)
+	}
+
+	m.streams[ctx.Path] = &serverMuxStream{
+		route:     r,
+		stream:    NewServerStream(ctx.Medias),
+		publisher: ctx.Session,
+	}
+	m.sessions[ctx.Session] = ctx.Path
+
+	m.mutex.Unlock()
+
+	// replace the previous publisher and disconnect its readers
+	if replacing {
+		if prev.ready && r.path.OnStreamClose != nil {
+			r.path.OnStreamClose(ctx.Path, prev.stream)
+		}
+
+		prev.stream.Close()
+		prev.publisher.Close()
+	}
+
+	return &base.Response{
+		StatusCode: base.StatusOK,
+	}, nil
+}
+
+// OnSetup implements ServerHandlerOnSetup.
+func (m *ServerMux) OnSetup(ctx *ServerHandlerOnSetupCtx) (*base.Response, *ServerStream, error) {
+	// publishing
+	if ctx.Session.State() == ServerSessionStatePreRecord {
+		return &base.Response{
+			StatusCode: base.StatusOK,
+		}, nil, nil
+	}
+
+	r, params, ok := m.findRoute(ctx.Path)
+	if !ok {
+		return &base.Response{
+			StatusCode: base.StatusNotFound,
+		}, nil, nil
+	}
+
+	if r.path.OnRead != nil {
+		err := r.path.OnRead(&ServerMuxPathCtx{
+			Session: ctx.Session,
+			Conn:    ctx.Conn,
+			Request: ctx.Request,
+			Path:    ctx.Path,
+			Query:   ctx.Query,
+			Params:  params,
+		})
+		if err != nil {
+			return &base.Response{
+				StatusCode: base.StatusForbidden,
+			}, nil, nil
+		}
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	ms, ok := m.streams[ctx.Path]
+	if !ok || !ms.ready {
+		return &base.Response{
+			StatusCode: base.StatusNotFound,
+		}, nil, nil
+	}
+
+	if m.sessions == nil {
+		m.sessions = make(map[*ServerSession]string)
+	}
+	m.sessions[ctx.Session] = ctx.Path
+
+	return &base.Response{
+		StatusCode: base.StatusOK,
+	}, ms.stream, nil
+}
+
+// OnPlay implements ServerHandlerOnPlay.
+func (m *ServerMux) OnPlay(ctx *ServerHandlerOnPlayCtx) (*base.Response, error) {
+	return &base.Response{
+		StatusCode: base.StatusOK,
+	}, nil
+}
+
+// OnRecord implements ServerHandlerOnRecord.
+func (m *ServerMux) OnRecord(ctx *ServerHandlerOnRecordCtx) (*base.Response, error) {
+	m.mutex.Lock()
+
+	ms, ok := m.streams[ctx.Path]
+	if !ok || ms.publisher != ctx.Session {
+		m.mutex.Unlock()
+		return &base.Response{
+			StatusCode: base.StatusBadRequest,
+		}, fmt.Errorf("session is not the publisher of path '%s'", ctx.Path)
+	}
+
+	ms.ready = true
+
+	m.mutex.Unlock()
+
+	stream := ms.stream
+
+	// route RTP packets to readers
+	ctx.Session.OnPacketRTPAny(func(medi *media.Media, forma formats.Format, pkt *rtp.Packet) {
+		stream.WritePacketRTP(medi, pkt)
+	})
+
+	if ms.route.path.OnStreamReady != nil {
+		ms.route.path.OnStreamReady(ctx.Path, stream)
+	}
+
+	return &base.Response{
+		StatusCode: base.StatusOK,
+	}, nil
+}
@@ -0,0 +1,282 @@
+package gortsplib
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/gortsplib/v3/pkg/formats"
+	"github.com/bluenviron/gortsplib/v3/pkg/media"
+)
+
+func TestServerMuxRouteMatch(t *testing.T) {
+	for _, ca := range []struct {
+		pattern string
+		path    string
+		params  map[string]string
+		ok      bool
+	}{
+		{"/mystream", "/mystream", map[string]string{}, true},
+		{"/mystream", "/otherstream", nil, false},
+		{"/mystream", "/mystream/sub", nil, false},
+		{"/cameras/{id}", "/cameras/1", map[string]string{"id": "1"}, true},
+		{"/cameras/{id}", "/cameras/", nil, false},
+		{"/cameras/{id}", "/cameras/1/2", nil, false},
+		{"/cameras/{id}/{stream}", "/cameras/1/main", map[string]string{"id": "1", "stream": "main"}, true},
+		{"/live/{name...}", "/live/a/b/c", map[string]string{"name": "a/b/c"}, true},
+		{"/live/{name...}", "/live/a", map[string]string{"name": "a"}, true},
+		{"/live/{name...}", "/live", nil, false},
+		{"/live/{name...}", "/live/", nil, false},
+	} {
+		t.Run(ca.pattern+" "+ca.path, func(t *testing.T) {
+			r, err := newServerMuxRoute(ca.pattern, &ServerMuxPath{})
+			require.NoError(t, err)
+
+			params, ok := r.match(ca.path)
+			require.Equal(t, ca.ok, ok)
+			if ok {
+				require.Equal(t, ca.params, params)
+			}
+		})
+	}
+}
+
+func TestServerMuxHandleErrors(t *testing.T) {
+	for _, ca := range []struct {
+		name    string
+		pattern string
+		err     string
+	}{
+		{"no slash", "mystream", "pattern must begin with a slash"},
+		{"invalid segment", "/cam{id}", "invalid segment 'cam{id}'"},
+		{"empty parameter", "/cameras/{}", "invalid segment '{}'"},
+		{"wildcard not last", "/live/{name...}/sub", "a wildcard segment can only be the last segment"},
+		{"duplicate", "/mystream", "pattern '/mystream' is already registered"},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			m := &ServerMux{}
+			err := m.Handle("/mystream", &ServerMuxPath{})
+			require.NoError(t, err)
+
+			err = m.Handle(ca.pattern, &ServerMuxPath{})
+			require.EqualError(t, err, ca.err)
+		})
+	}
+}
+
+func newTestMuxMedias() media.Medias {
+	return media.Medias{&media.Media{
+		Type:    media.TypeVideo,
+		Formats: testH264Media.Formats,
+	}}
+}
+
+func startTestMuxReader(t *testing.T, ur string) (*Client, chan struct{}) {
+	packetRecv := make(chan struct{}, 16)
+
+	c := &Client{
+		Transport: func() *Transport {
+			v := TransportTCP
+			return &v
+		}(),
+	}
+
+	err := readAll(c, ur, func(medi *media.Media, forma formats.Format, pkt *rtp.Packet) {
+		select {
+		case packetRecv <- struct{}{}:
+		default:
+		}
+	})
+	require.NoError(t, err)
+
+	return c, packetRecv
+}
+
+func TestServerMuxPublishRead(t *testing.T) {
+	publishCtx := make(chan *ServerMuxPathCtx, 1)
+	readCtx := make(chan *ServerMuxPathCtx, 2)
+	streamReady := make(chan string, 1)
+	streamClose := make(chan string, 1)
+
+	m := &ServerMux{}
+
+	err := m.Handle("/cameras/{id}", &ServerMuxPath{
+		OnPublish: func(ctx *ServerMuxPathCtx) error {
+			publishCtx <- ctx
+			return nil
+		},
+		OnRead: func(ctx *ServerMuxPathCtx) error {
+			readCtx <- ctx
+			if ctx.Params["id"] == "forbidden" {
+				return fmt.Errorf("forbidden")
+			}
+			return nil
+		},
+		OnStreamReady: func(path string, stream *ServerStream) {
+			streamReady <- path
+		},
+		OnStreamClose: func(path string, stream *ServerStream) {
+			streamClose <- path
+		},
+	})
+	require.NoError(t, err)
+
+	s := &Server{
+		Handler:     m,
+		RTSPAddress: "localhost:8554",
+	}
+
+	err = s.Start()
+	require.NoError(t, err)
+	defer s.Close()
+
+	medias := newTestMuxMedias()
+
+	source := Client{}
+	err = source.StartRecording("rtsp://localhost:8554/cameras/1", medias)
+	require.NoError(t, err)
+	defer source.Close()
+
+	ctx := <-publishCtx
+	require.Equal(t, "/cameras/1", ctx.Path)
+	require.Equal(t, map[string]string{"id": "1"}, ctx.Params)
+	require.Equal(t, "/cameras/1", <-streamReady)
+
+	_, ok := m.Stream("/cameras/1")
+	require.Equal(t, true, ok)
+
+	reader, packetRecv := startTestMuxReader(t, "rtsp://localhost:8554/cameras/1")
+	defer reader.Close()
+
+	for i := 0; i < 2; i++ {
+		ctx = <-readCtx
+		require.Equal(t, map[string]string{"id": "1"}, ctx.Params)
+	}
+
+	err = source.WritePacketRTP(medias[0], &testRTPPacket)
+	require.NoError(t, err)
+	<-packetRecv
+
+	// path not registered
+	c := Client{}
+	err = readAll(&c, "rtsp://localhost:8554/other", nil)
+	require.EqualError(t, err, "bad status code: 404 (Not Found)")
+
+	// path not published
+	err = readAll(&c, "rtsp://localhost:8554/cameras/2", nil)
+	require.EqualError(t, err, "bad status code: 404 (Not Found)")
+	<-readCtx
+
+	// read refused by hook
+	err = readAll(&c, "rtsp://localhost:8554/cameras/forbidden", nil)
+	require.EqualError(t, err, "bad status code: 403 (Forbidden)")
+	<-readCtx
+
+	// when the publisher leaves, readers are disconnected
+	source.Close()
+	require.Equal(t, "/cameras/1", <-streamClose)
+
+	err = reader.Wait()
+	require.Error(t, err)
+
+	_, ok = m.Stream("/cameras/1")
+	require.Equal(t, false, ok)
+}
+
+func TestServerMuxPublisherReplace(t *testing.T) {
+	for _, ca := range []string{"replace", "replace disabled"} {
+		t.Run(ca, func(t *testing.T) {
+			streamReady := make(chan struct{}, 2)
+
+			m := &ServerMux{}
+
+			err := m.Handle("/mystream", &ServerMuxPath{
+				PublisherReplaceDisable: ca == "replace disabled",
+				OnStreamReady: func(path string, stream *ServerStream) {
+					streamReady <- struct{}{}
+				},
+			})
+			require.NoError(t, err)
+
+			s := &Server{
+				Handler:     m,
+				RTSPAddress: "localhost:8554",
+			}
+
+			err = s.Start()
+			require.NoError(t, err)
+			defer s.Close()
+
+			source1 := Client{}
+			err = source1.StartRecording("rtsp://localhost:8554/mystream", newTestMuxMedias())
+			require.NoError(t, err)
+			defer source1.Close()
+			<-streamReady
+
+			reader, _ := startTestMuxReader(t, "rtsp://localhost:8554/mystream")
+			defer reader.Close()
+
+			medias := newTestMuxMedias()
+
+			source2 := Client{}
+			err = source2.StartRecording("rtsp://localhost:8554/mystream", medias)
+
+			if ca == "replace disabled" {
+				require.EqualError(t, err, "bad status code: 400 (Bad Request)")
+				return
+			}
+
+			require.NoError(t, err)
+			defer source2.Close()
+			<-streamReady
+
+			// previous publisher and its readers are disconnected
+			err = source1.Wait()
+			require.Error(t, err)
+
+			err = reader.Wait()
+			require.Error(t, err)
+
+			// new readers receive packets of the new publisher
+			reader2, packetRecv := startTestMuxReader(t, "rtsp://localhost:8554/mystream")
+			defer reader2.Close()
+
+			for {
+				err = source2.WritePacketRTP(medias[0], &testRTPPacket)
+				require.NoError(t, err)
+
+				select {
+				case <-packetRecv:
+					return
+				case <-time.After(100 * time.Millisecond):
+				}
+			}
+		})
+	}
+}
+
+func TestServerMuxPublishNotFound(t *testing.T) {
+	m := &ServerMux{}
+
+	err := m.Handle("/mystream", &ServerMuxPath{})
+	require.NoError(t, err)
+
+	s := &Server{
+		Handler:     m,
+		RTSPAddress: "localhost:8554",
+	}
+
+	err = s.Start()
+	require.NoError(t, err)
+	defer s.Close()
+
+	c := Client{}
+	err = c.StartRecording("rtsp://localhost:8554/other", newTestMuxMedias())
+	require.EqualError(t, err, "bad status code: 404 (Not Found)")
+
+	_, ok := m.Stream("/mystream")
+	require.Equal(t, false, ok)
+}
@@ -18,9 +18,11 @@ import (
 	"golang.org/x/net/ipv4"
 
 	"github.com/bluenviron/gortsplib/v3/pkg/base"
+	"github.com/bluenviron/gortsplib/v3/pkg/capture"
 	"github.com/bluenviron/gortsplib/v3/pkg/conn"
 	"github.com/bluenviron/gortsplib/v3/pkg/formats"
 	"github.com/bluenviron/gortsplib/v3/pkg/headers"
+	"github.com/bluenviron/gortsplib/v3/pkg/liberrors"
 	"github.com/bluenviron/gortsplib/v3/pkg/media"
 	"github.com/bluenviron/gortsplib/v3/pkg/sdp"
 	"github.com/bluenviron/gortsplib/v3/pkg/url"
@@ -1270,6 +1272,249 @@ func TestServerPlayTCPResponseBeforeFrames(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestServerPlayServerRequests(t *testing.T) {
+	stream := NewServerStream(media.Medias{testH264Media})
+	defer stream.Close()
+
+	sessionCreated := make(chan *ServerSession, 1)
+	clientResponses := make(chan *ServerHandlerOnClientResponseCtx, 2)
+
+	s := &Server{
+		Handler: &testServerHandler{
+			onDescribe: func(ctx *ServerHandlerOnDescribeCtx) (*base.Response, *ServerStream, error) {
+				return &base.Response{
+					StatusCode: base.StatusOK,
+				}, stream, nil
+			},
+			onSetup: func(ctx *ServerHandlerOnSetupCtx) (*base.Response, *ServerStream, error) {
+				return &base.Response{
+					StatusCode: base.StatusOK,
+				}, stream, nil
+			},
+			onPlay: func(ctx *ServerHandlerOnPlayCtx) (*base.Response, error) {
+				sessionCreated <- ctx.Session
+				return &base.Response{
+					StatusCode: base.StatusOK,
+				}, nil
+			},
+			onClientResponse: func(ctx *ServerHandlerOnClientResponseCtx) {
+				clientResponses <- ctx
+			},
+		},
+		RTSPAddress: "localhost:8554",
+	}
+
+	err := s.Start()
+	require.NoError(t, err)
+	defer s.Close()
+
+	nconn, err := net.Dial("tcp", "localhost:8554")
+	require.NoError(t, err)
+	defer nconn.Close()
+	conn := conn.NewConn(nconn)
+
+	desc, err := doDescribe(conn)
+	require.NoError(t, err)
+
+	res, err := writeReqReadRes(conn, base.Request{
+		Method: base.Setup,
+		URL:    mustParseURL(absoluteControlAttribute(desc.MediaDescriptions[0])),
+		Header: base.Header{
+			"CSeq": base.HeaderValue{"2"},
+			"Transport": headers.Transport{
+				Protocol: headers.TransportProtocolTCP,
+				Delivery: func() *headers.TransportDelivery {
+					v := headers.TransportDeliveryUnicast
+					return &v
+				}(),
+				Mode: func() *headers.TransportMode {
+					v := headers.TransportModePlay
+					return &v
+				}(),
+				InterleavedIDs: &[2]int{0, 1},
+			}.Marshal(),
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, base.StatusOK, res.StatusCode)
+
+	var sx headers.Session
+	err = sx.Unmarshal(res.Header["Session"])
+	require.NoError(t, err)
+
+	res, err = writeReqReadRes(conn, base.Request{
+		Method: base.Play,
+		URL:    mustParseURL("rtsp://localhost:8554/teststream"),
+		Header: base.Header{
+			"CSeq":    base.HeaderValue{"3"},
+			"Session": base.HeaderValue{sx.Session},
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, base.StatusOK, res.StatusCode)
+
+	ss := <-sessionCreated
+
+	err = ss.Redirect(mustParseURL("rtsp://otherhost:8554/teststream"), &headers.Range{
+		Value: &headers.RangeNPT{
+			Start: 10 * time.Second,
+		},
+	})
+	require.NoError(t, err)
+
+	req, err := conn.ReadRequestIgnoreFrames()
+	require.NoError(t, err)
+	require.Equal(t, base.Redirect, req.Method)
+	require.Equal(t, mustParseURL("rtsp://localhost:8554/teststream"), req.URL)
+	require.Equal(t, base.HeaderValue{"rtsp://otherhost:8554/teststream"}, req.Header["Location"])
+	require.Equal(t, base.HeaderValue{"npt=10-"}, req.Header["Range"])
+	require.Equal(t, base.HeaderValue{sx.Session}, req.Header["Session"])
+
+	err = conn.WriteResponse(&base.Response{
+		StatusCode: base.StatusOK,
+		Header: base.Header{
+			"CSeq": req.Header["CSeq"],
+		},
+	})
+	require.NoError(t, err)
+
+	ctx := <-clientResponses
+	require.Equal(t, ss, ctx.Session)
+	require.Equal(t, base.Redirect, ctx.Request.Method)
+	require.Equal(t, base.StatusOK, ctx.Response.StatusCode)
+
+	err = ss.Announce(media.Medias{testH264Media})
+	require.NoError(t, err)
+
+	req, err = conn.ReadRequestIgnoreFrames()
+	require.NoError(t, err)
+	require.Equal(t, base.Announce, req.Method)
+	require.Equal(t, base.HeaderValue{"application/sdp"}, req.Header["Content-Type"])
+
+	var medias media.Medias
+	var sd sdp.SessionDescription
+	err = sd.Unmarshal(req.Body)
+	require.NoError(t, err)
+	err = medias.Unmarshal(sd.MediaDescriptions)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(medias))
+
+	err = conn.WriteResponse(&base.Response{
+		StatusCode: base.StatusNotImplemented,
+		Header: base.Header{
+			"CSeq": req.Header["CSeq"],
+		},
+	})
+	require.NoError(t, err)
+
+	ctx = <-clientResponses
+	require.Equal(t, base.Announce, ctx.Request.Method)
+	require.Equal(t, base.StatusNotImplemented, ctx.Response.StatusCode)
+}
+
+func TestServerPlayServerRequestTimeout(t *testing.T) {
+	stream := NewServerStream(media.Medias{testH264Media})
+	defer stream.Close()
+
+	sessionCreated := make(chan *ServerSession, 1)
+	clientResponses := make(chan *ServerHandlerOnClientResponseCtx, 1)
+
+	s := &Server{
+		Handler: &testServerHandler{
+			onDescribe: func(ctx *ServerHandlerOnDescribeCtx) (*base.Response, *ServerStream, error) {
+				return &base.Response{
+					StatusCode: base.StatusOK,
+				}, stream, nil
+			},
+			onSetup: func(ctx *ServerHandlerOnSetupCtx) (*base.Response, *ServerStream, error) {
+				return &base.Response{
+					StatusCode: base.StatusOK,
+				}, stream, nil
+			},
+			onPlay: func(ctx *ServerHandlerOnPlayCtx) (*base.Response, error) {
+				sessionCreated <- ctx.Session
+				return &base.Response{
+					StatusCode: base.StatusOK,
+				}, nil
+			},
+			onClientResponse: func(ctx *ServerHandlerOnClientResponseCtx) {
+				clientResponses <- ctx
+			},
+		},
+		RTSPAddress: "localhost:8554",
+		ReadTimeout: 500 * time.Millisecond,
+	}
+
+	err := s.Start()
+	require.NoError(t, err)
+	defer s.Close()
+
+	nconn, err := net.Dial("tcp", "localhost:8554")
+	require.NoError(t, err)
+	defer nconn.Close()
+	conn := conn.NewConn(nconn)
+
+	desc, err := doDescribe(conn)
+	require.NoError(t, err)
+
+	res, err := writeReqReadRes(conn, base.Request{
+		Method: base.Setup,
+		URL:    mustParseURL(absoluteControlAttribute(desc.MediaDescriptions[0])),
+		Header: base.Header{
+			"CSeq": base.HeaderValue{"2"},
+			"Transport": headers.Transport{
+				Protocol: headers.TransportProtocolTCP,
+				Delivery: func() *headers.TransportDelivery {
+					v := headers.TransportDeliveryUnicast
+					return &v
+				}(),
+				Mode: func() *headers.TransportMode {
+					v := headers.TransportModePlay
+					return &v
+				}(),
+				InterleavedIDs: &[2]int{0, 1},
+			}.Marshal(),
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, base.StatusOK, res.StatusCode)
+
+	var sx headers.Session
+	err = sx.Unmarshal(res.Header["Session"])
+	require.NoError(t, err)
+
+	res, err = writeReqReadRes(conn, base.Request{
+		Method: base.Play,
+		URL:    mustParseURL("rtsp://localhost:8554/teststream"),
+		Header: base.Header{
+			"CSeq":    base.HeaderValue{"3"},
+			"Session": base.HeaderValue{sx.Session},
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, base.StatusOK, res.StatusCode)
+
+	ss := <-sessionCreated
+
+	err = ss.Redirect(mustParseURL("rtsp://otherhost:8554/teststream"), nil)
+	require.NoError(t, err)
+
+	// the client reads the request but doesn't reply
+	req, err := conn.ReadRequestIgnoreFrames()
+	require.NoError(t, err)
+	require.Equal(t, base.Redirect, req.Method)
+
+	ctx := <-clientResponses
+	require.Equal(t, ss, ctx.Session)
+	require.Equal(t, base.Redirect, ctx.Request.Method)
+	require.Nil(t, ctx.Response)
+	require.Equal(t, liberrors.ErrServerClientResponseTimeout{}, ctx.Error)
+
+	ss.author.requestsMutex.Lock()
+	require.Empty(t, ss.author.pendingRequests)
+	ss.author.requestsMutex.Unlock()
+}
+
 func TestServerPlayPlayPlay(t *testing.T) {
 	stream := NewServerStream(media.Medias{testH264Media})
 	defer stream.Close()
@@ -1652,7 +1897,7 @@ func TestServerPlayTimeout(t *testing.T) {
 					},
 				},
 				ReadTimeout:       1 * time.Second,
-				sessionTimeout:    1 * time.Second,
+				SessionTimeout:    1 * time.Second,
 				RTSPAddress:       "localhost:8554",
 				checkStreamPeriod: 500 * time.Millisecond,
 			}
@@ -1731,59 +1976,217 @@ func TestServerPlayTimeout(t *testing.T) {
 	}
 }
 
-func TestServerPlayWithoutTeardown(t *testing.T) {
-	for _, transport := range []string{
-		"udp",
-		"tcp",
-	} {
-		t.Run(transport, func(t *testing.T) {
-			nconnClosed := make(chan struct{})
-			sessionClosed := make(chan struct{})
+func TestServerPlaySessionTimeoutFromSetup(t *testing.T) {
+	sessionClosed := make(chan struct{})
 
-			stream := NewServerStream(media.Medias{testH264Media})
-			defer stream.Close()
+	stream := NewServerStream(media.Medias{testH264Media})
+	defer stream.Close()
 
-			s := &Server{
-				Handler: &testServerHandler{
-					onConnClose: func(ctx *ServerHandlerOnConnCloseCtx) {
-						close(nconnClosed)
-					},
-					onSessionClose: func(ctx *ServerHandlerOnSessionCloseCtx) {
-						close(sessionClosed)
-					},
-					onDescribe: func(ctx *ServerHandlerOnDescribeCtx) (*base.Response, *ServerStream, error) {
-						return &base.Response{
-							StatusCode: base.StatusOK,
-						}, stream, nil
-					},
-					onSetup: func(ctx *ServerHandlerOnSetupCtx) (*base.Response, *ServerStream, error) {
-						return &base.Response{
-							StatusCode: base.StatusOK,
-						}, stream, nil
-					},
-					onPlay: func(ctx *ServerHandlerOnPlayCtx) (*base.Response, error) {
-						return &base.Response{
-							StatusCode: base.StatusOK,
-						}, nil
-					},
-				},
-				ReadTimeout:    1 * time.Second,
-				sessionTimeout: 1 * time.Second,
-				RTSPAddress:    "localhost:8554",
-			}
+	s := &Server{
+		Handler: &testServerHandler{
+			onSessionClose: func(ctx *ServerHandlerOnSessionCloseCtx) {
+				close(sessionClosed)
+			},
+			onDescribe: func(ctx *ServerHandlerOnDescribeCtx) (*base.Response, *ServerStream, error) {
+				return &base.Response{
+					StatusCode: base.StatusOK,
+				}, stream, nil
+			},
+			onSetup: func(ctx *ServerHandlerOnSetupCtx) (*base.Response, *ServerStream, error) {
+				require.Equal(t, 60*time.Second, ctx.SessionTimeout)
+				ctx.SessionTimeout = 1 * time.Second
 
-			if transport == "udp" {
-				s.UDPRTPAddress = "127.0.0.1:8000"
-				s.UDPRTCPAddress = "127.0.0.1:8001"
-			}
+				return &base.Response{
+					StatusCode: base.StatusOK,
+				}, stream, nil
+			},
+			onPlay: func(ctx *ServerHandlerOnPlayCtx) (*base.Response, error) {
+				return &base.Response{
+					StatusCode: base.StatusOK,
+				}, nil
+			},
+		},
+		UDPRTPAddress:     "127.0.0.1:8000",
+		UDPRTCPAddress:    "127.0.0.1:8001",
+		RTSPAddress:       "localhost:8554",
+		checkStreamPeriod: 500 * time.Millisecond,
+	}
 
-			err := s.Start()
-			require.NoError(t, err)
-			defer s.Close()
+	err := s.Start()
+	require.NoError(t, err)
+	defer s.Close()
 
-			nconn, err := net.Dial("tcp", "localhost:8554")
-			require.NoError(t, err)
-			defer nconn.Close()
+	nconn, err := net.Dial("tcp", "localhost:8554")
+	require.NoError(t, err)
+	defer nconn.Close()
+	conn := conn.NewConn(nconn)
+
+	desc, err := doDescribe(conn)
+	require.NoError(t, err)
+
+	res, err := writeReqReadRes(conn, base.Request{
+		Method: base.Setup,
+		URL:    mustParseURL(absoluteControlAttribute(desc.MediaDescriptions[0])),
+		Header: base.Header{
+			"CSeq": base.HeaderValue{"2"},
+			"Transport": headers.Transport{
+				Protocol: headers.TransportProtocolUDP,
+				Delivery: func() *headers.TransportDelivery {
+					v := headers.TransportDeliveryUnicast
+					return &v
+				}(),
+				Mode: func() *headers.TransportMode {
+					v := headers.TransportModePlay
+					return &v
+				}(),
+				ClientPorts: &[2]int{35466, 35467},
+			}.Marshal(),
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, base.StatusOK, res.StatusCode)
+
+	var sx headers.Session
+	err = sx.Unmarshal(res.Header["Session"])
+	require.NoError(t, err)
+	require.NotNil(t, sx.Timeout)
+	require.Equal(t, uint(1), *sx.Timeout)
+
+	res, err = writeReqReadRes(conn, base.Request{
+		Method: base.Play,
+		URL:    mustParseURL("rtsp://localhost:8554/teststream"),
+		Header: base.Header{
+			"CSeq":    base.HeaderValue{"3"},
+			"Session": base.HeaderValue{sx.Session},
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, base.StatusOK, res.StatusCode)
+
+	select {
+	case <-sessionClosed:
+	case <-time.After(5 * time.Second):
+		t.Errorf("session was not closed")
+	}
+}
+
+func TestServerPlayInvalidSessionTimeoutFromSetup(t *testing.T) {
+	stream := NewServerStream(media.Medias{testH264Media})
+	defer stream.Close()
+
+	connErr := make(chan error, 1)
+
+	s := &Server{
+		Handler: &testServerHandler{
+			onConnClose: func(ctx *ServerHandlerOnConnCloseCtx) {
+				connErr <- ctx.Error
+			},
+			onDescribe: func(ctx *ServerHandlerOnDescribeCtx) (*base.Response, *ServerStream, error) {
+				return &base.Response{
+					StatusCode: base.StatusOK,
+				}, stream, nil
+			},
+			onSetup: func(ctx *ServerHandlerOnSetupCtx) (*base.Response, *ServerStream, error) {
+				ctx.SessionTimeout = 500 * time.Millisecond
+
+				return &base.Response{
+					StatusCode: base.StatusOK,
+				}, stream, nil
+			},
+		},
+		RTSPAddress: "localhost:8554",
+	}
+
+	err := s.Start()
+	require.NoError(t, err)
+	defer s.Close()
+
+	nconn, err := net.Dial("tcp", "localhost:8554")
+	require.NoError(t, err)
+	defer nconn.Close()
+	conn := conn.NewConn(nconn)
+
+	desc, err := doDescribe(conn)
+	require.NoError(t, err)
+
+	res, err := writeReqReadRes(conn, base.Request{
+		Method: base.Setup,
+		URL:    mustParseURL(absoluteControlAttribute(desc.MediaDescriptions[0])),
+		Header: base.Header{
+			"CSeq": base.HeaderValue{"2"},
+			"Transport": headers.Transport{
+				Protocol: headers.TransportProtocolTCP,
+				Delivery: func() *headers.TransportDelivery {
+					v := headers.TransportDeliveryUnicast
+					return &v
+				}(),
+				Mode: func() *headers.TransportMode {
+					v := headers.TransportModePlay
+					return &v
+				}(),
+				InterleavedIDs: &[2]int{0, 1},
+			}.Marshal(),
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, base.StatusInternalServerError, res.StatusCode)
+
+	require.Equal(t, liberrors.ErrServerInvalidSessionTimeout{Value: 500 * time.Millisecond}, <-connErr)
+}
+
+func TestServerPlayWithoutTeardown(t *testing.T) {
+	for _, transport := range []string{
+		"udp",
+		"tcp",
+	} {
+		t.Run(transport, func(t *testing.T) {
+			nconnClosed := make(chan struct{})
+			sessionClosed := make(chan struct{})
+
+			stream := NewServerStream(media.Medias{testH264Media})
+			defer stream.Close()
+
+			s := &Server{
+				Handler: &testServerHandler{
+					onConnClose: func(ctx *ServerHandlerOnConnCloseCtx) {
+						close(nconnClosed)
+					},
+					onSessionClose: func(ctx *ServerHandlerOnSessionCloseCtx) {
+						close(sessionClosed)
+					},
+					onDescribe: func(ctx *ServerHandlerOnDescribeCtx) (*base.Response, *ServerStream, error) {
+						return &base.Response{
+							StatusCode: base.StatusOK,
+						}, stream, nil
+					},
+					onSetup: func(ctx *ServerHandlerOnSetupCtx) (*base.Response, *ServerStream, error) {
+						return &base.Response{
+							StatusCode: base.StatusOK,
+						}, stream, nil
+					},
+					onPlay: func(ctx *ServerHandlerOnPlayCtx) (*base.Response, error) {
+						return &base.Response{
+							StatusCode: base.StatusOK,
+						}, nil
+					},
+				},
+				ReadTimeout:    1 * time.Second,
+				SessionTimeout: 1 * time.Second,
+				RTSPAddress:    "localhost:8554",
+			}
+
+			if transport == "udp" {
+				s.UDPRTPAddress = "127.0.0.1:8000"
+				s.UDPRTCPAddress = "127.0.0.1:8001"
+			}
+
+			err := s.Start()
+			require.NoError(t, err)
+			defer s.Close()
+
+			nconn, err := net.Dial("tcp", "localhost:8554")
+			require.NoError(t, err)
+			defer nconn.Close()
 			conn := conn.NewConn(nconn)
 
 			desc, err := doDescribe(conn)
@@ -2259,3 +2662,956 @@ func TestServerPlayAdditionalInfos(t *testing.T) {
 		}(),
 	}, ssrcs)
 }
+
+func TestServerPlayGOPCache(t *testing.T) {
+	stream := NewServerStream(media.Medias{testH264Media})
+	defer stream.Close()
+
+	err := stream.EnableGOPCache(stream.Medias()[0], 64)
+	require.NoError(t, err)
+
+	s := &Server{
+		Handler: &testServerHandler{
+			onDescribe: func(ctx *ServerHandlerOnDescribeCtx) (*base.Response, *ServerStream, error) {
+				return &base.Response{
+					StatusCode: base.StatusOK,
+				}, stream, nil
+			},
+			onSetup: func(ctx *ServerHandlerOnSetupCtx) (*base.Response, *ServerStream, error) {
+				return &base.Response{
+					StatusCode: base.StatusOK,
+				}, stream, nil
+			},
+			onPlay: func(ctx *ServerHandlerOnPlayCtx) (*base.Response, error) {
+				return &base.Response{
+					StatusCode: base.StatusOK,
+				}, nil
+			},
+		},
+		RTSPAddress: "localhost:8554",
+	}
+
+	err = s.Start()
+	require.NoError(t, err)
+	defer s.Close()
+
+	for _, pkt := range []struct {
+		seqNum  uint16
+		ts      uint32
+		payload []byte
+	}{
+		{10, 100, []byte{0x41, 0x01}}, // non-IDR, before the first keyframe
+		{11, 200, []byte{0x67, 0x01}}, // SPS
+		{13, 200, []byte{0x65, 0x01}}, // IDR
+		{14, 300, []byte{0x41, 0x02}}, // non-IDR
+	} {
+		stream.WritePacketRTP(stream.Medias()[0], &rtp.Packet{
+			Header: rtp.Header{
+				Version:        2,
+				PayloadType:    96,
+				SequenceNumber: pkt.seqNum,
+				Timestamp:      pkt.ts,
+				SSRC:           96342362,
+			},
+			Payload: pkt.payload,
+		})
+	}
+
+	nconn, err := net.Dial("tcp", "localhost:8554")
+	require.NoError(t, err)
+	defer nconn.Close()
+	conn := conn.NewConn(nconn)
+
+	desc, err := doDescribe(conn)
+	require.NoError(t, err)
+
+	inTH := &headers.Transport{
+		Delivery: func() *headers.TransportDelivery {
+			v := headers.TransportDeliveryUnicast
+			return &v
+		}(),
+		Mode: func() *headers.TransportMode {
+			v := headers.TransportModePlay
+			return &v
+		}(),
+		Protocol:       headers.TransportProtocolTCP,
+		InterleavedIDs: &[2]int{0, 1},
+	}
+
+	res, err := writeReqReadRes(conn, base.Request{
+		Method: base.Setup,
+		URL:    mustParseURL(absoluteControlAttribute(desc.MediaDescriptions[0])),
+		Header: base.Header{
+			"CSeq":      base.HeaderValue{"2"},
+			"Transport": inTH.Marshal(),
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, base.StatusOK, res.StatusCode)
+
+	var sx headers.Session
+	err = sx.Unmarshal(res.Header["Session"])
+	require.NoError(t, err)
+
+	res, err = writeReqReadRes(conn, base.Request{
+		Method: base.Play,
+		URL:    mustParseURL("rtsp://localhost:8554/teststream"),
+		Header: base.Header{
+			"CSeq":    base.HeaderValue{"3"},
+			"Session": base.HeaderValue{sx.Session},
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, base.StatusOK, res.StatusCode)
+
+	// RTP-Info describes the first cached packet
+	var ri headers.RTPInfo
+	err = ri.Unmarshal(res.Header["RTP-Info"])
+	require.NoError(t, err)
+	require.Equal(t, uint16(11), *ri[0].SequenceNumber)
+	require.Equal(t, uint32(300), *ri[0].Timestamp)
+
+	for _, pkt := range []struct {
+		seqNum  uint16
+		ts      uint32
+		payload []byte
+	}{
+		{15, 400, []byte{0x41, 0x03}},
+		{16, 500, []byte{0x41, 0x04}},
+	} {
+		stream.WritePacketRTP(stream.Medias()[0], &rtp.Packet{
+			Header: rtp.Header{
+				Version:        2,
+				PayloadType:    96,
+				SequenceNumber: pkt.seqNum,
+				Timestamp:      pkt.ts,
+				SSRC:           96342362,
+			},
+			Payload: pkt.payload,
+		})
+	}
+
+	stream.WritePacketRTCP(stream.Medias()[0], &rtcp.SenderReport{
+		SSRC:    96342362,
+		NTPTime: 0xe8ed2d7f9b9ec000,
+		RTPTime: 500,
+	})
+
+	// cached packets are rebased in order to be consecutive and to start
+	// from the timestamp of the last received packet.
+	// live packets continue both sequences.
+	var prev *rtp.Packet
+
+	for _, expected := range []struct {
+		seqNum  uint16
+		ts      uint32
+		payload []byte
+	}{
+		{11, 300, []byte{0x67, 0x01}},
+		{12, 300, []byte{0x65, 0x01}},
+		{13, 400, []byte{0x41, 0x02}},
+		{14, 500, []byte{0x41, 0x03}},
+		{15, 600, []byte{0x41, 0x04}},
+	} {
+		f, err := conn.ReadInterleavedFrame()
+		require.NoError(t, err)
+		require.Equal(t, 0, f.Channel)
+
+		var pkt rtp.Packet
+		err = pkt.Unmarshal(f.Payload)
+		require.NoError(t, err)
+		require.Equal(t, expected.seqNum, pkt.SequenceNumber)
+		require.Equal(t, expected.ts, pkt.Timestamp)
+		require.Equal(t, expected.payload, pkt.Payload)
+
+		if prev != nil {
+			require.Equal(t, prev.SequenceNumber+1, pkt.SequenceNumber)
+			require.GreaterOrEqual(t, pkt.Timestamp, prev.Timestamp)
+		}
+		prev = &pkt
+	}
+
+	// sender reports are rebased too
+	f, err := conn.ReadInterleavedFrame()
+	require.NoError(t, err)
+	require.Equal(t, 1, f.Channel)
+
+	packets, err := rtcp.Unmarshal(f.Payload)
+	require.NoError(t, err)
+	require.Equal(t, &rtcp.SenderReport{
+		SSRC:    96342362,
+		NTPTime: 0xe8ed2d7f9b9ec000,
+		RTPTime: 600,
+	}, packets[0])
+}
+
+func TestServerPlayTimeShiftCloseUnlocked(t *testing.T) {
+	stream := NewServerStream(media.Medias{testH264Media})
+
+	err := stream.EnableTimeShift(1*time.Minute, 1024*1024)
+	require.NoError(t, err)
+
+	// a reader that is waiting for space in the write queue of its session
+	r := &serverStreamTimeShiftReader{
+		ctxCancel: func() {},
+		done:      make(chan struct{}),
+	}
+	stream.timeShiftReaders[nil] = r
+
+	closeDone := make(chan struct{})
+	go func() {
+		defer close(closeDone)
+		stream.Close()
+	}()
+
+	// the stream is not locked while waiting for the reader
+	writeDone := make(chan struct{})
+	go func() {
+		defer close(writeDone)
+		for {
+			stream.mutex.RLock()
+			closed := stream.closed
+			stream.mutex.RUnlock()
+			if closed {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+
+	select {
+	case <-writeDone:
+	case <-time.After(2 * time.Second):
+		t.Errorf("stream is locked")
+	}
+
+	close(r.done)
+	<-closeDone
+}
+
+func TestServerPlayTimeShift(t *testing.T) {
+	stream := NewServerStream(media.Medias{testH264Media})
+	defer stream.Close()
+
+	err := stream.EnableTimeShift(1*time.Minute, 1024*1024)
+	require.NoError(t, err)
+
+	s := &Server{
+		Handler: &testServerHandler{
+			onDescribe: func(ctx *ServerHandlerOnDescribeCtx) (*base.Response, *ServerStream, error) {
+				return &base.Response{
+					StatusCode: base.StatusOK,
+				}, stream, nil
+			},
+			onSetup: func(ctx *ServerHandlerOnSetupCtx) (*base.Response, *ServerStream, error) {
+				return &base.Response{
+					StatusCode: base.StatusOK,
+				}, stream, nil
+			},
+			onPlay: func(ctx *ServerHandlerOnPlayCtx) (*base.Response, error) {
+				return &base.Response{
+					StatusCode: base.StatusOK,
+				}, nil
+			},
+			onPause: func(ctx *ServerHandlerOnPauseCtx) (*base.Response, error) {
+				return &base.Response{
+					StatusCode: base.StatusOK,
+				}, nil
+			},
+		},
+		RTSPAddress: "localhost:8554",
+	}
+
+	err = s.Start()
+	require.NoError(t, err)
+	defer s.Close()
+
+	writePacket := func(seqNum uint16, ts uint32, payload []byte, ntp time.Time) {
+		stream.WritePacketRTPWithNTP(stream.Medias()[0], &rtp.Packet{
+			Header: rtp.Header{
+				Version:        2,
+				PayloadType:    96,
+				SequenceNumber: seqNum,
+				Timestamp:      ts,
+				SSRC:           96342362,
+			},
+			Payload: payload,
+		}, ntp)
+	}
+
+	start := time.Now().Add(-1 * time.Second)
+	writePacket(1, 0, []byte{0x65, 0x01}, start)                               // IDR
+	writePacket(2, 9000, []byte{0x41, 0x01}, start.Add(100*time.Millisecond))  // non-IDR
+	writePacket(3, 45000, []byte{0x67, 0x01}, start.Add(500*time.Millisecond)) // SPS
+	writePacket(4, 45000, []byte{0x65, 0x02}, start.Add(500*time.Millisecond)) // IDR
+	writePacket(5, 54000, []byte{0x41, 0x02}, start.Add(600*time.Millisecond)) // non-IDR
+
+	nconn, err := net.Dial("tcp", "localhost:8554")
+	require.NoError(t, err)
+	defer nconn.Close()
+	conn := conn.NewConn(nconn)
+
+	desc, err := doDescribe(conn)
+	require.NoError(t, err)
+
+	inTH := &headers.Transport{
+		Delivery: func() *headers.TransportDelivery {
+			v := headers.TransportDeliveryUnicast
+			return &v
+		}(),
+		Mode: func() *headers.TransportMode {
+			v := headers.TransportModePlay
+			return &v
+		}(),
+		Protocol:       headers.TransportProtocolTCP,
+		InterleavedIDs: &[2]int{0, 1},
+	}
+
+	res, err := writeReqReadRes(conn, base.Request{
+		Method: base.Setup,
+		URL:    mustParseURL(absoluteControlAttribute(desc.MediaDescriptions[0])),
+		Header: base.Header{
+			"CSeq":      base.HeaderValue{"2"},
+			"Transport": inTH.Marshal(),
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, base.StatusOK, res.StatusCode)
+
+	var sx headers.Session
+	err = sx.Unmarshal(res.Header["Session"])
+	require.NoError(t, err)
+
+	play := func(cseq string, ra *headers.Range) *base.Response {
+		h := base.Header{
+			"CSeq":    base.HeaderValue{cseq},
+			"Session": base.HeaderValue{sx.Session},
+		}
+		if ra != nil {
+			h["Range"] = ra.Marshal()
+		}
+
+		res, err := writeReqReadRes(conn, base.Request{
+			Method: base.Play,
+			URL:    mustParseURL("rtsp://localhost:8554/teststream"),
+			Header: h,
+		})
+		require.NoError(t, err)
+		require.Equal(t, base.StatusOK, res.StatusCode)
+		return res
+	}
+
+	var reports []*rtcp.SenderReport
+
+	// reads a RTP packet, saving received sender reports.
+	readPacket := func() *rtp.Packet {
+		for {
+			f, err := conn.ReadInterleavedFrame()
+			require.NoError(t, err)
+
+			if f.Channel == 1 {
+				pkts, err := rtcp.Unmarshal(f.Payload)
+				require.NoError(t, err)
+				reports = append(reports, pkts[0].(*rtcp.SenderReport))
+				continue
+			}
+
+			var pkt rtp.Packet
+			err = pkt.Unmarshal(f.Payload)
+			require.NoError(t, err)
+			return &pkt
+		}
+	}
+
+	// seek to a point in the past
+	res = play("3", &headers.Range{
+		Value: &headers.RangeNPT{
+			Start: 550 * time.Millisecond,
+		},
+	})
+
+	var ra headers.Range
+	err = ra.Unmarshal(res.Header["Range"])
+	require.NoError(t, err)
+	require.Equal(t, &headers.RangeNPT{Start: 500 * time.Millisecond}, ra.Value)
+
+	var ri headers.RTPInfo
+	err = ri.Unmarshal(res.Header["RTP-Info"])
+	require.NoError(t, err)
+	require.Equal(t, uint16(3), *ri[0].SequenceNumber)
+	require.Equal(t, uint32(45000), *ri[0].Timestamp)
+
+	// playback starts from the access unit that contains the keyframe
+	for _, seqNum := range []uint16{3, 4, 5} {
+		require.Equal(t, seqNum, readPacket().SequenceNumber)
+	}
+
+	// a sender report maps the timestamp of the keyframe to the time in which it was received
+	require.Equal(t, 1, len(reports))
+	require.Equal(t, uint32(96342362), reports[0].SSRC)
+	require.Equal(t, uint32(45000), reports[0].RTPTime)
+	require.Equal(t, uint32(2), reports[0].PacketCount)
+	require.Equal(t, start.Add(500*time.Millisecond).UnixMicro(), ntpTimeToTime(reports[0].NTPTime).UnixMicro())
+
+	// live packets are received with the same delay
+	writePacket(6, 63000, []byte{0x41, 0x03}, time.Now())
+	require.Equal(t, uint16(6), readPacket().SequenceNumber)
+
+	res, err = writeReqReadRes(conn, base.Request{
+		Method: base.Pause,
+		URL:    mustParseURL("rtsp://localhost:8554/teststream"),
+		Header: base.Header{
+			"CSeq":    base.HeaderValue{"4"},
+			"Session": base.HeaderValue{sx.Session},
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, base.StatusOK, res.StatusCode)
+
+	writePacket(7, 72000, []byte{0x41, 0x04}, time.Now())
+
+	// resume from the paused position
+	res = play("5", nil)
+
+	ri = nil
+	err = ri.Unmarshal(res.Header["RTP-Info"])
+	require.NoError(t, err)
+	require.Equal(t, uint16(7), *ri[0].SequenceNumber)
+
+	require.Equal(t, uint16(7), readPacket().SequenceNumber)
+}
+
+func TestServerPlayScaleSpeed(t *testing.T) {
+	stream := NewServerStream(media.Medias{testH264Media})
+	defer stream.Close()
+
+	s := &Server{
+		Handler: &testServerHandler{
+			onDescribe: func(ctx *ServerHandlerOnDescribeCtx) (*base.Response, *ServerStream, error) {
+				return &base.Response{
+					StatusCode: base.StatusOK,
+				}, stream, nil
+			},
+			onSetup: func(ctx *ServerHandlerOnSetupCtx) (*base.Response, *ServerStream, error) {
+				return &base.Response{
+					StatusCode: base.StatusOK,
+				}, stream, nil
+			},
+			onPlay: func(ctx *ServerHandlerOnPlayCtx) (*base.Response, error) {
+				require.Equal(t, &headers.Scale{Value: 4}, ctx.Scale)
+				require.Equal(t, &headers.Speed{Value: 1.5}, ctx.Speed)
+
+				// accept a lower scale, ignore speed
+				return &base.Response{
+					StatusCode: base.StatusOK,
+					Header: base.Header{
+						"Scale": headers.Scale{Value: 2}.Marshal(),
+					},
+				}, nil
+			},
+		},
+		RTSPAddress: "localhost:8554",
+	}
+
+	err := s.Start()
+	require.NoError(t, err)
+	defer s.Close()
+
+	c := Client{}
+
+	u := mustParseURL("rtsp://localhost:8554/teststream")
+
+	err = c.Start(u.Scheme, u.Host)
+	require.NoError(t, err)
+	defer c.Close()
+
+	medias, baseURL, _, err := c.Describe(u)
+	require.NoError(t, err)
+
+	err = c.SetupAll(medias, baseURL)
+	require.NoError(t, err)
+
+	res, err := c.PlayWithOptions(&ClientPlayOptions{
+		Scale: &headers.Scale{Value: 4},
+		Speed: &headers.Speed{Value: 1.5},
+	})
+	require.NoError(t, err)
+
+	var scale headers.Scale
+	err = scale.Unmarshal(res.Header["Scale"])
+	require.NoError(t, err)
+	require.Equal(t, headers.Scale{Value: 2}, scale)
+
+	// Speed was not accepted by the handler
+	_, ok := res.Header["Speed"]
+	require.False(t, ok)
+}
+
+func TestServerPlayPipelining(t *testing.T) {
+	for _, transport := range []string{
+		"udp",
+		"tcp",
+	} {
+		t.Run(transport, func(t *testing.T) {
+			medias := media.Medias{
+				&media.Media{
+					Type:    media.TypeVideo,
+					Formats: testH264Media.Formats,
+				},
+				&media.Media{
+					Type:    media.TypeVideo,
+					Formats: testH264Media.Formats,
+				},
+				&media.Media{
+					Type:    media.TypeVideo,
+					Formats: testH264Media.Formats,
+				},
+			}
+
+			stream := NewServerStream(medias)
+			defer stream.Close()
+
+			sessionOpened := make(chan struct{}, 3)
+			setupHasSession := make(chan bool, 3)
+
+			s := &Server{
+				Handler: &testServerHandler{
+					onSessionOpen: func(ctx *ServerHandlerOnSessionOpenCtx) {
+						sessionOpened <- struct{}{}
+					},
+					onDescribe: func(ctx *ServerHandlerOnDescribeCtx) (*base.Response, *ServerStream, error) {
+						return &base.Response{
+							StatusCode: base.StatusOK,
+						}, stream, nil
+					},
+					onSetup: func(ctx *ServerHandlerOnSetupCtx) (*base.Response, *ServerStream, error) {
+						_, ok := ctx.Request.Header["Session"]
+						setupHasSession <- ok
+
+						return &base.Response{
+							StatusCode: base.StatusOK,
+						}, stream, nil
+					},
+					onPlay: func(ctx *ServerHandlerOnPlayCtx) (*base.Response, error) {
+						// a single session contains all medias
+						require.Equal(t, 3, len(ctx.Session.SetuppedMedias()))
+						return &base.Response{
+							StatusCode: base.StatusOK,
+						}, nil
+					},
+				},
+				RTSPAddress: "localhost:8554",
+			}
+
+			if transport == "udp" {
+				s.UDPRTPAddress = "127.0.0.1:8000"
+				s.UDPRTCPAddress = "127.0.0.1:8001"
+			}
+
+			err := s.Start()
+			require.NoError(t, err)
+			defer s.Close()
+
+			c := Client{
+				Transport: func() *Transport {
+					if transport == "udp" {
+						v := TransportUDP
+						return &v
+					}
+					v := TransportTCP
+					return &v
+				}(),
+				Pipelining: true,
+			}
+
+			u := mustParseURL("rtsp://localhost:8554/teststream")
+
+			err = c.Start(u.Scheme, u.Host)
+			require.NoError(t, err)
+			defer c.Close()
+
+			descMedias, baseURL, _, err := c.Describe(u)
+			require.NoError(t, err)
+
+			err = c.SetupAll(descMedias, baseURL)
+			require.NoError(t, err)
+
+			_, err = c.Play(nil)
+			require.NoError(t, err)
+
+			require.Equal(t, 1, len(sessionOpened))
+
+			// SETUP requests that follow the first one are sent inside its session
+			require.Equal(t, false, <-setupHasSession)
+			require.Equal(t, true, <-setupHasSession)
+			require.Equal(t, true, <-setupHasSession)
+		})
+	}
+}
+
+func TestServerPlayWriteQueueFull(t *testing.T) {
+	for _, ca := range []WriteQueuePolicy{
+		WriteQueuePolicyDropUntilKeyframe,
+		WriteQueuePolicyDisconnect,
+	} {
+		t.Run(ca.String(), func(t *testing.T) {
+			stream := NewServerStream(media.Medias{testH264Media})
+			defer stream.Close()
+
+			var session *ServerSession
+			warning := make(chan error, 1)
+			sessionClosed := make(chan error, 1)
+
+			s := &Server{
+				Handler: &testServerHandler{
+					onSessionClose: func(ctx *ServerHandlerOnSessionCloseCtx) {
+						sessionClosed <- ctx.Error
+					},
+					onDescribe: func(ctx *ServerHandlerOnDescribeCtx) (*base.Response, *ServerStream, error) {
+						return &base.Response{
+							StatusCode: base.StatusOK,
+						}, stream, nil
+					},
+					onSetup: func(ctx *ServerHandlerOnSetupCtx) (*base.Response, *ServerStream, error) {
+						return &base.Response{
+							StatusCode: base.StatusOK,
+						}, stream, nil
+					},
+					onPlay: func(ctx *ServerHandlerOnPlayCtx) (*base.Response, error) {
+						session = ctx.Session
+						return &base.Response{
+							StatusCode: base.StatusOK,
+						}, nil
+					},
+					onWarning: func(ctx *ServerHandlerOnWarningCtx) {
+						select {
+						case warning <- ctx.Error:
+						default:
+						}
+					},
+				},
+				RTSPAddress:      "localhost:8554",
+				WriteBufferCount: 16,
+				WriteQueuePolicy: ca,
+			}
+
+			err := s.Start()
+			require.NoError(t, err)
+			defer s.Close()
+
+			nconn, err := net.Dial("tcp", "localhost:8554")
+			require.NoError(t, err)
+			defer nconn.Close()
+			conn := conn.NewConn(nconn)
+
+			desc, err := doDescribe(conn)
+			require.NoError(t, err)
+
+			inTH := &headers.Transport{
+				Delivery: func() *headers.TransportDelivery {
+					v := headers.TransportDeliveryUnicast
+					return &v
+				}(),
+				Mode: func() *headers.TransportMode {
+					v := headers.TransportModePlay
+					return &v
+				}(),
+				Protocol:       headers.TransportProtocolTCP,
+				InterleavedIDs: &[2]int{0, 1},
+			}
+
+			res, err := writeReqReadRes(conn, base.Request{
+				Method: base.Setup,
+				URL:    mustParseURL(absoluteControlAttribute(desc.MediaDescriptions[0])),
+				Header: base.Header{
+					"CSeq":      base.HeaderValue{"2"},
+					"Transport": inTH.Marshal(),
+				},
+			})
+			require.NoError(t, err)
+			require.Equal(t, base.StatusOK, res.StatusCode)
+
+			var sx headers.Session
+			err = sx.Unmarshal(res.Header["Session"])
+			require.NoError(t, err)
+
+			res, err = writeReqReadRes(conn, base.Request{
+				Method: base.Play,
+				URL:    mustParseURL("rtsp://localhost:8554/teststream"),
+				Header: base.Header{
+					"CSeq":    base.HeaderValue{"3"},
+					"Session": base.HeaderValue{sx.Session},
+				},
+			})
+			require.NoError(t, err)
+			require.Equal(t, base.StatusOK, res.StatusCode)
+
+			// packets contain their index, and every 50 packets there's a IDR.
+			writePacket := func(i int) {
+				payload := make([]byte, 1000)
+				if (i % 50) == 0 {
+					payload[0] = 0x65
+				} else {
+					payload[0] = 0x41
+				}
+				payload[1] = byte(i >> 8)
+				payload[2] = byte(i)
+
+				stream.WritePacketRTP(stream.Medias()[0], &rtp.Packet{
+					Header: rtp.Header{
+						Version:        2,
+						PayloadType:    96,
+						SequenceNumber: uint16(i),
+						SSRC:           96342362,
+					},
+					Payload: payload,
+				})
+			}
+
+			// the reader is not reading, fill network buffers and the write queue
+			const count = 20000
+			for i := 0; i < count; i++ {
+				writePacket(i)
+			}
+
+			if ca == WriteQueuePolicyDisconnect {
+				require.Equal(t, liberrors.ErrServerWriteQueueFull{}, <-sessionClosed)
+				return
+			}
+
+			require.Equal(t, liberrors.ErrServerWriteQueueFull{}, <-warning)
+			require.NotZero(t, session.PacketsDropped())
+
+			// once the reader starts reading, write a last packet
+			go func() {
+				time.Sleep(500 * time.Millisecond)
+				writePacket(count)
+			}()
+
+			prev := -1
+
+			for prev != count {
+				f, err := conn.ReadInterleavedFrame()
+				require.NoError(t, err)
+				if f.Channel != 0 {
+					continue
+				}
+
+				var pkt rtp.Packet
+				err = pkt.Unmarshal(f.Payload)
+				require.NoError(t, err)
+
+				i := int(pkt.Payload[1])<<8 | int(pkt.Payload[2])
+
+				// after a discontinuity, the first packet is a IDR
+				if i != (prev + 1) {
+					require.Equal(t, byte(0x65), pkt.Payload[0])
+				}
+				prev = i
+			}
+		})
+	}
+}
+
+func TestServerPlayCapture(t *testing.T) {
+	for _, transport := range []string{
+		"udp",
+		"tcp",
+	} {
+		t.Run(transport, func(t *testing.T) {
+			stream := NewServerStream(media.Medias{testH264Media})
+			defer stream.Close()
+
+			var serverBuf bytes.Buffer
+
+			s := &Server{
+				Handler: &testServerHandler{
+					onSessionOpen: func(ctx *ServerHandlerOnSessionOpenCtx) {
+						ctx.Session.SetCapture(capture.NewPcapngWriter(&serverBuf))
+					},
+					onDescribe: func(ctx *ServerHandlerOnDescribeCtx) (*base.Response, *ServerStream, error) {
+						return &base.Response{
+							StatusCode: base.StatusOK,
+						}, stream, nil
+					},
+					onSetup: func(ctx *ServerHandlerOnSetupCtx) (*base.Response, *ServerStream, error) {
+						return &base.Response{
+							StatusCode: base.StatusOK,
+						}, stream, nil
+					},
+					onPlay: func(ctx *ServerHandlerOnPlayCtx) (*base.Response, error) {
+						return &base.Response{
+							StatusCode: base.StatusOK,
+						}, nil
+					},
+				},
+				RTSPAddress: "localhost:8554",
+			}
+
+			if transport == "udp" {
+				s.UDPRTPAddress = "127.0.0.1:8000"
+				s.UDPRTCPAddress = "127.0.0.1:8001"
+			}
+
+			err := s.Start()
+			require.NoError(t, err)
+			defer s.Close()
+
+			var clientBuf bytes.Buffer
+
+			c := Client{
+				Transport: func() *Transport {
+					if transport == "udp" {
+						v := TransportUDP
+						return &v
+					}
+					v := TransportTCP
+					return &v
+				}(),
+				Capture: capture.NewPcapngWriter(&clientBuf),
+			}
+
+			recv := make(chan struct{})
+
+			err = readAll(&c, "rtsp://localhost:8554/teststream",
+				func(medi *media.Media, forma formats.Format, pkt *rtp.Packet) {
+					close(recv)
+				})
+			require.NoError(t, err)
+
+			stream.WritePacketRTP(stream.Medias()[0], &testRTPPacket)
+			<-recv
+
+			// wait until all packets are written into captures
+			c.Close()
+			s.Close()
+
+			// captures of clients contain the DESCRIBE response,
+			// while captures of sessions need the medias of the stream.
+			for _, ca := range []struct {
+				buf    *bytes.Buffer
+				medias media.Medias
+			}{
+				{&clientBuf, nil},
+				{&serverBuf, stream.Medias()},
+			} {
+				r, err := capture.NewPcapngReader(ca.buf)
+				require.NoError(t, err)
+
+				rp := &capture.Replayer{
+					Reader:        r,
+					Medias:        ca.medias,
+					DisablePacing: true,
+				}
+				err = rp.Start()
+				require.NoError(t, err)
+
+				var replayed []*rtp.Packet
+				rp.OnPacketRTPAny(func(medi *media.Media, forma formats.Format, pkt *rtp.Packet) {
+					replayed = append(replayed, pkt)
+				})
+
+				rp.Play()
+				err = rp.Wait()
+				require.NoError(t, err)
+				rp.Close()
+
+				require.Equal(t, []*rtp.Packet{&testRTPPacket}, replayed)
+			}
+		})
+	}
+}
+
+func TestServerPlayFrame(t *testing.T) {
+	for _, transport := range []string{
+		"udp",
+		"tcp",
+	} {
+		t.Run(transport, func(t *testing.T) {
+			forma := &formats.G711{MULaw: true}
+			medi := &media.Media{
+				Type:    media.TypeAudio,
+				Formats: []formats.Format{forma},
+			}
+
+			stream := NewServerStream(media.Medias{medi})
+			defer stream.Close()
+
+			s := &Server{
+				Handler: &testServerHandler{
+					onDescribe: func(ctx *ServerHandlerOnDescribeCtx) (*base.Response, *ServerStream, error) {
+						return &base.Response{
+							StatusCode: base.StatusOK,
+						}, stream, nil
+					},
+					onSetup: func(ctx *ServerHandlerOnSetupCtx) (*base.Response, *ServerStream, error) {
+						return &base.Response{
+							StatusCode: base.StatusOK,
+						}, stream, nil
+					},
+					onPlay: func(ctx *ServerHandlerOnPlayCtx) (*base.Response, error) {
+						return &base.Response{
+							StatusCode: base.StatusOK,
+						}, nil
+					},
+				},
+				RTSPAddress: "localhost:8554",
+			}
+
+			if transport == "udp" {
+				s.UDPRTPAddress = "127.0.0.1:8000"
+				s.UDPRTCPAddress = "127.0.0.1:8001"
+			}
+
+			err := s.Start()
+			require.NoError(t, err)
+			defer s.Close()
+
+			c := Client{
+				Transport: func() *Transport {
+					if transport == "udp" {
+						v := TransportUDP
+						return &v
+					}
+					v := TransportTCP
+					return &v
+				}(),
+			}
+
+			u, err := url.Parse("rtsp://localhost:8554/teststream")
+			require.NoError(t, err)
+
+			err = c.Start(u.Scheme, u.Host)
+			require.NoError(t, err)
+			defer c.Close()
+
+			medias, baseURL, _, err := c.Describe(u)
+			require.NoError(t, err)
+
+			err = c.SetupAll(medias, baseURL)
+			require.NoError(t, err)
+
+			frameRecv := make(chan *Frame)
+
+			c.OnFrame(medias[0], medias[0].Formats[0], func(fr *Frame) {
+				frameRecv <- fr
+			})
+
+			_, err = c.Play(nil)
+			require.NoError(t, err)
+
+			for i := 0; i < 2; i++ {
+				err := stream.WriteAccessUnit(medi, forma, time.Duration(i)*time.Second, [][]byte{{0x01, 0x02, byte(i)}})
+				require.NoError(t, err)
+
+				fr := <-frameRecv
+				require.Equal(t, &Frame{
+					PTS:      time.Duration(i) * time.Second,
+					DTS:      time.Duration(i) * time.Second,
+					KeyFrame: true,
+					Payload:  [][]byte{{0x01, 0x02, byte(i)}},
+				}, fr)
+			}
+		})
+	}
+}
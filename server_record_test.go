@@ -14,6 +14,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/bluenviron/gortsplib/v3/pkg/base"
+	"github.com/bluenviron/gortsplib/v3/pkg/capture"
 	"github.com/bluenviron/gortsplib/v3/pkg/conn"
 	"github.com/bluenviron/gortsplib/v3/pkg/formats"
 	"github.com/bluenviron/gortsplib/v3/pkg/headers"
@@ -1644,3 +1645,191 @@ func TestServerRecordDecodeErrors(t *testing.T) {
 		})
 	}
 }
+
+func TestServerRecordCapture(t *testing.T) {
+	for _, transport := range []string{
+		"udp",
+		"tcp",
+	} {
+		t.Run(transport, func(t *testing.T) {
+			var serverBuf bytes.Buffer
+			recv := make(chan struct{})
+
+			s := &Server{
+				Handler: &testServerHandler{
+					onSessionOpen: func(ctx *ServerHandlerOnSessionOpenCtx) {
+						ctx.Session.SetCapture(capture.NewPcapngWriter(&serverBuf))
+					},
+					onAnnounce: func(ctx *ServerHandlerOnAnnounceCtx) (*base.Response, error) {
+						return &base.Response{
+							StatusCode: base.StatusOK,
+						}, nil
+					},
+					onSetup: func(ctx *ServerHandlerOnSetupCtx) (*base.Response, *ServerStream, error) {
+						return &base.Response{
+							StatusCode: base.StatusOK,
+						}, nil, nil
+					},
+					onRecord: func(ctx *ServerHandlerOnRecordCtx) (*base.Response, error) {
+						ctx.Session.OnPacketRTPAny(func(medi *media.Media, forma formats.Format, pkt *rtp.Packet) {
+							close(recv)
+						})
+
+						return &base.Response{
+							StatusCode: base.StatusOK,
+						}, nil
+					},
+				},
+				RTSPAddress: "localhost:8554",
+			}
+
+			if transport == "udp" {
+				s.UDPRTPAddress = "127.0.0.1:8000"
+				s.UDPRTCPAddress = "127.0.0.1:8001"
+			}
+
+			err := s.Start()
+			require.NoError(t, err)
+			defer s.Close()
+
+			c := Client{
+				Transport: func() *Transport {
+					if transport == "udp" {
+						v := TransportUDP
+						return &v
+					}
+					v := TransportTCP
+					return &v
+				}(),
+			}
+
+			medias := newTestMuxMedias()
+			err = c.StartRecording("rtsp://localhost:8554/teststream", medias)
+			require.NoError(t, err)
+			defer c.Close()
+
+			err = c.WritePacketRTP(medias[0], &testRTPPacket)
+			require.NoError(t, err)
+			<-recv
+
+			// wait until all packets are written into the capture
+			c.Close()
+			s.Close()
+
+			// medias are taken from the ANNOUNCE request
+			r, err := capture.NewPcapngReader(&serverBuf)
+			require.NoError(t, err)
+
+			rp := &capture.Replayer{
+				Reader:        r,
+				DisablePacing: true,
+			}
+			err = rp.Start()
+			require.NoError(t, err)
+			defer rp.Close()
+
+			require.Equal(t, 1, len(rp.Medias))
+
+			var replayed []*rtp.Packet
+			rp.OnPacketRTPAny(func(medi *media.Media, forma formats.Format, pkt *rtp.Packet) {
+				replayed = append(replayed, pkt)
+			})
+
+			rp.Play()
+			err = rp.Wait()
+			require.NoError(t, err)
+
+			require.Equal(t, []*rtp.Packet{&testRTPPacket}, replayed)
+		})
+	}
+}
+
+func TestServerRecordFrame(t *testing.T) {
+	for _, transport := range []string{
+		"udp",
+		"tcp",
+	} {
+		t.Run(transport, func(t *testing.T) {
+			frameRecv := make(chan *Frame)
+
+			s := &Server{
+				Handler: &testServerHandler{
+					onAnnounce: func(ctx *ServerHandlerOnAnnounceCtx) (*base.Response, error) {
+						return &base.Response{
+							StatusCode: base.StatusOK,
+						}, nil
+					},
+					onSetup: func(ctx *ServerHandlerOnSetupCtx) (*base.Response, *ServerStream, error) {
+						return &base.Response{
+							StatusCode: base.StatusOK,
+						}, nil, nil
+					},
+					onRecord: func(ctx *ServerHandlerOnRecordCtx) (*base.Response, error) {
+						ctx.Session.OnFrameAny(func(medi *media.Media, forma formats.Format, fr *Frame) {
+							require.Equal(t, ctx.Session.AnnouncedMedias()[0], medi)
+							require.Equal(t, ctx.Session.AnnouncedMedias()[0].Formats[0], forma)
+							frameRecv <- fr
+						})
+
+						return &base.Response{
+							StatusCode: base.StatusOK,
+						}, nil
+					},
+				},
+				RTSPAddress: "localhost:8554",
+			}
+
+			if transport == "udp" {
+				s.UDPRTPAddress = "127.0.0.1:8000"
+				s.UDPRTCPAddress = "127.0.0.1:8001"
+			}
+
+			err := s.Start()
+			require.NoError(t, err)
+			defer s.Close()
+
+			c := Client{
+				Transport: func() *Transport {
+					if transport == "udp" {
+						v := TransportUDP
+						return &v
+					}
+					v := TransportTCP
+					return &v
+				}(),
+			}
+
+			forma := &formats.G711{MULaw: true}
+			medias := media.Medias{{
+				Type:    media.TypeAudio,
+				Formats: []formats.Format{forma},
+			}}
+
+			err = c.StartRecording("rtsp://localhost:8554/teststream", medias)
+			require.NoError(t, err)
+			defer c.Close()
+
+			for i := 0; i < 2; i++ {
+				err = c.WritePacketRTP(medias[0], &rtp.Packet{
+					Header: rtp.Header{
+						Version:        2,
+						PayloadType:    0,
+						SequenceNumber: uint16(1000 + i),
+						Timestamp:      uint32(54352 + i*160),
+						SSRC:           753621,
+					},
+					Payload: []byte{0x01, 0x02, byte(i)},
+				})
+				require.NoError(t, err)
+
+				fr := <-frameRecv
+				require.Equal(t, &Frame{
+					PTS:      time.Duration(i) * 20 * time.Millisecond,
+					DTS:      time.Duration(i) * 20 * time.Millisecond,
+					KeyFrame: true,
+					Payload:  [][]byte{{0x01, 0x02, byte(i)}},
+				}, fr)
+			}
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -12,6 +13,7 @@ import (
 	"github.com/pion/rtp"
 
 	"github.com/bluenviron/gortsplib/v3/pkg/base"
+	"github.com/bluenviron/gortsplib/v3/pkg/capture"
 	"github.com/bluenviron/gortsplib/v3/pkg/formats"
 	"github.com/bluenviron/gortsplib/v3/pkg/headers"
 	"github.com/bluenviron/gortsplib/v3/pkg/liberrors"
@@ -77,14 +79,18 @@ func findMediaByUUID(st *ServerStream, uuid string) *media.Media {
 	return nil
 }
 
-func findFirstSupportedTransportHeader(s *Server, tsh headers.Transports) *headers.Transport {
+func findFirstSupportedTransportHeader(
+	s *Server,
+	l *serverListener,
+	tsh headers.Transports,
+) *headers.Transport {
 	// Per RFC2326 section 12.39, client specifies transports in order of preference.
 	// Filter out the ones we don't support and then pick first supported transport.
 	for _, tr := range tsh {
 		isMulticast := tr.Delivery != nil && *tr.Delivery == headers.TransportDeliveryMulticast
 		if tr.Protocol == headers.TransportProtocolUDP &&
-			((!isMulticast && s.udpRTPListener == nil) ||
-				(isMulticast && s.MulticastIPRange == "")) {
+			((!isMulticast && l.udpRTPListener == nil) ||
+				(isMulticast && (s.MulticastIPRange == "" || l.conf.TLSConfig != nil))) {
 			continue
 		}
 		return &tr
@@ -156,13 +162,18 @@ type ServerSession struct {
 	s        *Server
 	secretID string // must not be shared, allows to take ownership of the session
 	author   *ServerConn
+	listener *serverListener
 
 	ctx                   context.Context
 	ctxCancel             func()
 	bytesReceived         *uint64
 	bytesSent             *uint64
+	packetsDropped        *uint64
 	userData              interface{}
+	timeout               time.Duration
+	connsMutex            sync.RWMutex
 	conns                 map[*ServerConn]struct{}
+	requestURL            *url.URL
 	state                 ServerSessionState
 	setuppedMedias        map[*media.Media]*serverSessionMedia
 	setuppedMediasOrdered []*serverSessionMedia
@@ -177,11 +188,14 @@ type ServerSession struct {
 	udpLastPacketTime     *int64       // publish
 	udpCheckStreamTimer   *time.Timer
 	writer                writer
+	capture               *sessionCapture
 
 	// in
-	request     chan sessionRequestReq
-	connRemove  chan *ServerConn
-	startWriter chan struct{}
+	request        chan sessionRequestReq
+	connRemove     chan *ServerConn
+	startWriter    chan struct{}
+	writeQueueFull chan struct{}
+	shutdown       chan struct{}
 }
 
 func newServerSession(
@@ -195,24 +209,48 @@ func newServerSession(
 		s:                   s,
 		secretID:            secretID,
 		author:              author,
+		listener:            author.listener,
 		ctx:                 ctx,
 		ctxCancel:           ctxCancel,
 		bytesReceived:       new(uint64),
 		bytesSent:           new(uint64),
+		packetsDropped:      new(uint64),
+		timeout:             s.SessionTimeout,
 		conns:               make(map[*ServerConn]struct{}),
 		lastRequestTime:     time.Now(),
 		udpCheckStreamTimer: emptyTimer(),
 		request:             make(chan sessionRequestReq),
 		connRemove:          make(chan *ServerConn),
 		startWriter:         make(chan struct{}),
+		writeQueueFull:      make(chan struct{}, 1),
+		shutdown:            make(chan struct{}, 1),
 	}
 
+	ss.writer.policy = s.WriteQueuePolicy
+
 	s.wg.Add(1)
 	go ss.run()
 
 	return ss
 }
 
+func (ss *ServerSession) onWriteQueueFull(sm *serverSessionMedia, isRTP bool) {
+	atomic.AddUint64(ss.packetsDropped, 1)
+
+	switch ss.s.WriteQueuePolicy {
+	case WriteQueuePolicyDisconnect:
+		select {
+		case ss.writeQueueFull <- struct{}{}:
+		default:
+		}
+
+	default:
+		if !isRTP || sm.writeDropper.start() {
+			onWarning(ss, liberrors.ErrServerWriteQueueFull{})
+		}
+	}
+}
+
 // Close closes the ServerSession.
 func (ss *ServerSession) Close() error {
 	ss.ctxCancel()
@@ -229,6 +267,17 @@ func (ss *ServerSession) BytesSent() uint64 {
 	return atomic.LoadUint64(ss.bytesSent)
 }
 
+// PacketsDropped returns the number of packets that have not been sent
+// because the write queue was full.
+func (ss *ServerSession) PacketsDropped() uint64 {
+	return atomic.LoadUint64(ss.packetsDropped)
+}
+
+// Listener returns the listener through which the session has been created.
+func (ss *ServerSession) Listener() *ServerListener {
+	return ss.listener.conf
+}
+
 // State returns the state of the session.
 func (ss *ServerSession) State() ServerSessionState {
 	return ss.state
@@ -253,6 +302,21 @@ func (ss *ServerSession) SetuppedMedias() media.Medias {
 	return ret
 }
 
+// Timeout returns the session timeout.
+func (ss *ServerSession) Timeout() time.Duration {
+	return ss.timeout
+}
+
+// SetCapture enables the capture of the session. The writer receives RTSP requests
+// and responses of the session, interleaved frames and UDP packets, in both directions.
+// Packets sent with the UDP-multicast transport protocol are not captured,
+// since they are shared among sessions.
+// Writers of the pcapng and rtpdump formats are available in pkg/capture.
+// It must be called inside a handler of the session, like OnSessionOpen or OnSetup.
+func (ss *ServerSession) SetCapture(w capture.Writer) {
+	ss.capture = newSessionCapture(w, ss.author.nconn)
+}
+
 // SetUserData sets some user data associated to the session.
 func (ss *ServerSession) SetUserData(v interface{}) {
 	ss.userData = v
@@ -263,6 +327,71 @@ func (ss *ServerSession) UserData() interface{} {
 	return ss.userData
 }
 
+// Redirect asks the client to connect to another URL.
+// ra is the time at which the redirection takes place; if nil, it takes place immediately.
+// The response of the client is passed to OnClientResponse.
+func (ss *ServerSession) Redirect(u *url.URL, ra *headers.Range) error {
+	h := base.Header{
+		"Location": base.HeaderValue{u.String()},
+	}
+
+	if ra != nil {
+		h["Range"] = ra.Marshal()
+	}
+
+	return ss.writeRequest(&base.Request{
+		Method: base.Redirect,
+		Header: h,
+	})
+}
+
+// Announce notifies the client that the stream description has changed.
+// The response of the client is passed to OnClientResponse.
+func (ss *ServerSession) Announce(medias media.Medias) error {
+	byts, err := medias.Marshal(false).Marshal()
+	if err != nil {
+		return err
+	}
+
+	return ss.writeRequest(&base.Request{
+		Method: base.Announce,
+		Header: base.Header{
+			"Content-Type": base.HeaderValue{"application/sdp"},
+		},
+		Body: byts,
+	})
+}
+
+func (ss *ServerSession) writeRequest(req *base.Request) error {
+	ss.connsMutex.RLock()
+	var sc *ServerConn
+	for c := range ss.conns {
+		sc = c
+		break
+	}
+	req.URL = ss.requestURL
+	ss.connsMutex.RUnlock()
+
+	if sc == nil {
+		return liberrors.ErrServerSessionNoConn{}
+	}
+
+	return sc.writeRequest(ss, req)
+}
+
+// presentationURL returns the URL of the path of the session.
+func (ss *ServerSession) presentationURL(reqURL *url.URL) *url.URL {
+	u := reqURL.CloneWithoutCredentials()
+
+	if ss.setuppedPath != nil {
+		u.Path = *ss.setuppedPath
+		u.RawPath = ""
+		u.RawQuery = ss.setuppedQuery
+	}
+
+	return u
+}
+
 func (ss *ServerSession) checkState(allowed map[ServerSessionState]struct{}) error {
 	if _, ok := allowed[ss.state]; ok {
 		return nil
@@ -291,6 +420,10 @@ func (ss *ServerSession) run() {
 
 	ss.ctxCancel()
 
+	// stop the writer before removing the session from the stream,
+	// in order to unblock routines that are waiting for space in the queue.
+	ss.writer.stop()
+
 	if ss.setuppedStream != nil {
 		ss.setuppedStream.readerSetInactive(ss)
 		ss.setuppedStream.readerRemove(ss)
@@ -300,8 +433,6 @@ func (ss *ServerSession) run() {
 		sm.stop()
 	}
 
-	ss.writer.stop()
-
 	// close all associated connections, both UDP and TCP
 	// except for the ones that called TEARDOWN
 	// (that are detached from the session just after the request)
@@ -337,11 +468,17 @@ func (ss *ServerSession) runInner() error {
 			ss.lastRequestTime = time.Now()
 
 			if _, ok := ss.conns[req.sc]; !ok {
+				ss.connsMutex.Lock()
 				ss.conns[req.sc] = struct{}{}
+				ss.connsMutex.Unlock()
 			}
 
 			res, err := ss.handleRequest(req.sc, req.req)
 
+			ss.connsMutex.Lock()
+			ss.requestURL = ss.presentationURL(req.req.URL)
+			ss.connsMutex.Unlock()
+
 			returnedSession := ss
 
 			if err == nil || err == errSwitchReadFunc {
@@ -352,27 +489,21 @@ func (ss *ServerSession) runInner() error {
 						res.Header = make(base.Header)
 					}
 
+					// timeout controls the sending of keepalives.
 					res.Header["Session"] = headers.Session{
 						Session: ss.secretID,
 						Timeout: func() *uint {
-							// timeout controls the sending of RTCP keepalives.
-							// these are needed only when the client is playing
-							// and transport is UDP or UDP-multicast.
-							if (ss.state == ServerSessionStatePrePlay ||
-								ss.state == ServerSessionStatePlay) &&
-								(*ss.setuppedTransport == TransportUDP ||
-									*ss.setuppedTransport == TransportUDPMulticast) {
-								v := uint(ss.s.sessionTimeout / time.Second)
-								return &v
-							}
-							return nil
+							v := uint(ss.timeout / time.Second)
+							return &v
 						}(),
 					}.Marshal()
 				}
 
 				// after a TEARDOWN, session must be unpaired with the connection
 				if req.req.Method == base.Teardown {
+					ss.connsMutex.Lock()
 					delete(ss.conns, req.sc)
+					ss.connsMutex.Unlock()
 					returnedSession = nil
 				}
 			}
@@ -390,7 +521,9 @@ func (ss *ServerSession) runInner() error {
 			}
 
 		case sc := <-ss.connRemove:
+			ss.connsMutex.Lock()
 			delete(ss.conns, sc)
+			ss.connsMutex.Unlock()
 
 			// if session is not in state RECORD or PLAY, or transport is TCP,
 			// and there are no associated connections,
@@ -409,6 +542,23 @@ func (ss *ServerSession) runInner() error {
 				ss.writer.start()
 			}
 
+		case <-ss.writeQueueFull:
+			return liberrors.ErrServerWriteQueueFull{}
+
+		case <-ss.shutdown:
+			// let publishers finish their recordings.
+			if ss.state == ServerSessionStateRecord {
+				continue
+			}
+
+			if ss.state == ServerSessionStatePlay {
+				ss.writeRequest(&base.Request{
+					Method: base.Teardown,
+				})
+			}
+
+			return liberrors.ErrServerShuttingDown{}
+
 		case <-ss.udpCheckStreamTimer.C:
 			now := time.Now()
 
@@ -421,8 +571,8 @@ func (ss *ServerSession) runInner() error {
 				}
 
 				// in case of PLAY, timeout happens when no RTSP keepalives and no RTCP packets are being received
-			} else if now.Sub(ss.lastRequestTime) >= ss.s.sessionTimeout &&
-				now.Sub(time.Unix(lft, 0)) >= ss.s.sessionTimeout {
+			} else if now.Sub(ss.lastRequestTime) >= ss.timeout &&
+				now.Sub(time.Unix(lft, 0)) >= ss.timeout {
 				return liberrors.ErrServerSessionTimedOut{}
 			}
 
@@ -500,7 +650,7 @@ func (ss *ServerSession) handleRequest(sc *ServerConn, req *base.Request) (*base
 		})
 		if err != nil {
 			return &base.Response{
-				StatusCode: base.StatusBadRequest,
+				StatusCode: base.StatusMethodNotValidInThisState,
 			}, err
 		}
 
@@ -511,6 +661,12 @@ func (ss *ServerSession) handleRequest(sc *ServerConn, req *base.Request) (*base
 			}, liberrors.ErrServerContentTypeMissing{}
 		}
 
+		if ss.s.Auth != nil {
+			if res := sc.authorize(req, nil, ServerAuthActionPublish, path); res != nil {
+				return res, nil
+			}
+		}
+
 		if ct[0] != "application/sdp" {
 			return &base.Response{
 				StatusCode: base.StatusBadRequest,
@@ -585,7 +741,7 @@ func (ss *ServerSession) handleRequest(sc *ServerConn, req *base.Request) (*base
 		})
 		if err != nil {
 			return &base.Response{
-				StatusCode: base.StatusBadRequest,
+				StatusCode: base.StatusMethodNotValidInThisState,
 			}, err
 		}
 
@@ -597,7 +753,7 @@ func (ss *ServerSession) handleRequest(sc *ServerConn, req *base.Request) (*base
 			}, liberrors.ErrServerTransportHeaderInvalid{Err: err}
 		}
 
-		inTH := findFirstSupportedTransportHeader(ss.s, inTSH)
+		inTH := findFirstSupportedTransportHeader(ss.s, ss.listener, inTSH)
 		if inTH == nil {
 			return &base.Response{
 				StatusCode: base.StatusUnsupportedTransport,
@@ -623,6 +779,25 @@ func (ss *ServerSession) handleRequest(sc *ServerConn, req *base.Request) (*base
 				}, liberrors.ErrServerMediasDifferentPaths{}
 			}
 
+			if ss.s.Auth != nil {
+				// in SETUP requests, VLC strips the control attribute
+				// and signs the Content-Base URL.
+				baseURL := &url.URL{
+					Scheme: req.URL.Scheme,
+					Host:   req.URL.Host,
+					Path:   path,
+				}
+				if query != "" {
+					baseURL.RawQuery = query + "/"
+				} else {
+					baseURL.Path += "/"
+				}
+
+				if res := sc.authorize(req, baseURL, ServerAuthActionRead, path); res != nil {
+					return res, nil
+				}
+			}
+
 		default: // record
 			path = *ss.setuppedPath
 			query = ss.setuppedQuery
@@ -663,15 +838,17 @@ func (ss *ServerSession) handleRequest(sc *ServerConn, req *base.Request) (*base
 			}
 		}
 
-		res, stream, err := ss.s.Handler.(ServerHandlerOnSetup).OnSetup(&ServerHandlerOnSetupCtx{
-			Server:    ss.s,
-			Session:   ss,
-			Conn:      sc,
-			Request:   req,
-			Path:      path,
-			Query:     query,
-			Transport: transport,
-		})
+		setupCtx := &ServerHandlerOnSetupCtx{
+			Server:         ss.s,
+			Session:        ss,
+			Conn:           sc,
+			Request:        req,
+			Path:           path,
+			Query:          query,
+			Transport:      transport,
+			SessionTimeout: ss.timeout,
+		}
+		res, stream, err := ss.s.Handler.(ServerHandlerOnSetup).OnSetup(setupCtx)
 
 		// workaround to prevent a bug in rtspclientsink
 		// that makes impossible for the client to receive the response
@@ -689,6 +866,14 @@ func (ss *ServerSession) handleRequest(sc *ServerConn, req *base.Request) (*base
 			return res, err
 		}
 
+		// the timeout is advertised in seconds.
+		if setupCtx.SessionTimeout < time.Second {
+			return &base.Response{
+				StatusCode: base.StatusInternalServerError,
+			}, liberrors.ErrServerInvalidSessionTimeout{Value: setupCtx.SessionTimeout}
+		}
+		ss.timeout = setupCtx.SessionTimeout
+
 		var medi *media.Media
 		switch ss.state {
 		case ServerSessionStateInitial, ServerSessionStatePrePlay: // play
@@ -776,7 +961,7 @@ func (ss *ServerSession) handleRequest(sc *ServerConn, req *base.Request) (*base
 			de := headers.TransportDeliveryUnicast
 			th.Delivery = &de
 			th.ClientPorts = inTH.ClientPorts
-			th.ServerPorts = &[2]int{sc.s.udpRTPListener.port(), sc.s.udpRTCPListener.port()}
+			th.ServerPorts = &[2]int{ss.listener.udpRTPListener.port(), ss.listener.udpRTCPListener.port()}
 
 		case TransportUDPMulticast:
 			th.Protocol = headers.TransportProtocolUDP
@@ -821,7 +1006,7 @@ func (ss *ServerSession) handleRequest(sc *ServerConn, req *base.Request) (*base
 		})
 		if err != nil {
 			return &base.Response{
-				StatusCode: base.StatusBadRequest,
+				StatusCode: base.StatusMethodNotValidInThisState,
 			}, err
 		}
 
@@ -831,6 +1016,38 @@ func (ss *ServerSession) handleRequest(sc *ServerConn, req *base.Request) (*base
 			}, liberrors.ErrServerPathHasChanged{Prev: *ss.setuppedPath, Cur: path}
 		}
 
+		// Range is used to read the history of the stream.
+		// Invalid or unsupported ranges are ignored.
+		var ra *headers.Range
+		if v, ok := req.Header["Range"]; ok {
+			var tmp headers.Range
+			if err := tmp.Unmarshal(v); err == nil {
+				ra = &tmp
+			}
+		}
+
+		var scale *headers.Scale
+		if v, ok := req.Header["Scale"]; ok {
+			scale = &headers.Scale{}
+			err := scale.Unmarshal(v)
+			if err != nil {
+				return &base.Response{
+					StatusCode: base.StatusBadRequest,
+				}, liberrors.ErrServerScaleHeaderInvalid{Err: err}
+			}
+		}
+
+		var speed *headers.Speed
+		if v, ok := req.Header["Speed"]; ok {
+			speed = &headers.Speed{}
+			err := speed.Unmarshal(v)
+			if err != nil {
+				return &base.Response{
+					StatusCode: base.StatusBadRequest,
+				}, liberrors.ErrServerSpeedHeaderInvalid{Err: err}
+			}
+		}
+
 		// allocate writeBuffer before calling OnPlay().
 		// in this way it's possible to call ServerSession.WritePacket*()
 		// inside the callback.
@@ -845,6 +1062,8 @@ func (ss *ServerSession) handleRequest(sc *ServerConn, req *base.Request) (*base
 			Request: req,
 			Path:    path,
 			Query:   query,
+			Scale:   scale,
+			Speed:   speed,
 		})
 
 		if res.StatusCode != base.StatusOK {
@@ -867,7 +1086,18 @@ func (ss *ServerSession) handleRequest(sc *ServerConn, req *base.Request) (*base
 			sm.start()
 		}
 
-		ss.setuppedStream.readerSetActive(ss)
+		startRTPInfo, startRange, startErr := ss.setuppedStream.readerSetActive(ss, ra)
+		if startErr != nil {
+			onWarning(ss, startErr)
+		}
+
+		// Range and RTP-Info can be filled by the handler, for instance by ServerVOD.
+		if _, ok := res.Header["Range"]; !ok && startRange != nil {
+			if res.Header == nil {
+				res.Header = make(base.Header)
+			}
+			res.Header["Range"] = startRange.Marshal()
+		}
 
 		switch *ss.setuppedTransport {
 		case TransportUDP:
@@ -888,7 +1118,10 @@ func (ss *ServerSession) handleRequest(sc *ServerConn, req *base.Request) (*base
 		now := time.Now()
 
 		for _, sm := range ss.setuppedMediasOrdered {
-			entry := ss.setuppedStream.rtpInfoEntry(sm.media, now)
+			entry, ok := startRTPInfo[sm.media]
+			if !ok {
+				entry = ss.setuppedStream.rtpInfoEntry(sm.media, now)
+			}
 			if entry != nil {
 				entry.URL = (&url.URL{
 					Scheme: req.URL.Scheme,
@@ -898,7 +1131,7 @@ func (ss *ServerSession) handleRequest(sc *ServerConn, req *base.Request) (*base
 				ri = append(ri, entry)
 			}
 		}
-		if len(ri) > 0 {
+		if _, ok := res.Header["RTP-Info"]; !ok && len(ri) > 0 {
 			if res.Header == nil {
 				res.Header = make(base.Header)
 			}
@@ -913,7 +1146,7 @@ func (ss *ServerSession) handleRequest(sc *ServerConn, req *base.Request) (*base
 		})
 		if err != nil {
 			return &base.Response{
-				StatusCode: base.StatusBadRequest,
+				StatusCode: base.StatusMethodNotValidInThisState,
 			}, err
 		}
 
@@ -982,7 +1215,7 @@ func (ss *ServerSession) handleRequest(sc *ServerConn, req *base.Request) (*base
 		})
 		if err != nil {
 			return &base.Response{
-				StatusCode: base.StatusBadRequest,
+				StatusCode: base.StatusMethodNotValidInThisState,
 			}, err
 		}
 
@@ -1126,6 +1359,38 @@ func (ss *ServerSession) OnPacketRTCP(medi *media.Media, cb func(rtcp.Packet)) {
 	sm.onPacketRTCP = cb
 }
 
+// OnFrameAny sets the callback that is called when a frame is decoded from any setupped media.
+func (ss *ServerSession) OnFrameAny(cb func(*media.Media, formats.Format, *Frame)) {
+	for _, sm := range ss.setuppedMedias {
+		cmedia := sm.media
+		for _, forma := range sm.media.Formats {
+			cforma := forma
+			ss.OnFrame(sm.media, forma, func(fr *Frame) {
+				cb(cmedia, cforma, fr)
+			})
+		}
+	}
+}
+
+// OnFrame sets the callback that is called when a frame is decoded.
+// RTP packets are depacketized with the decoder of the format;
+// with formats without a decoder, RTP payloads are provided as they are.
+// It replaces the callback set with OnPacketRTP.
+func (ss *ServerSession) OnFrame(medi *media.Media, forma formats.Format, cb func(*Frame)) {
+	sm := ss.setuppedMedias[medi]
+	st := sm.formats[forma.PayloadType()]
+
+	fd := NewFrameDecoder(forma, cb)
+	st.frameDecoder = fd
+
+	st.onPacketRTP = func(pkt *rtp.Packet) {
+		err := fd.ProcessPacket(pkt)
+		if err != nil {
+			onWarning(ss, fmt.Errorf("unable to decode frame: %v", err))
+		}
+	}
+}
+
 func (ss *ServerSession) writePacketRTP(medi *media.Media, byts []byte) {
 	sm := ss.setuppedMedias[medi]
 	sm.writePacketRTP(byts)
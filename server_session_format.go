@@ -17,6 +17,7 @@ type serverSessionFormat struct {
 	format          formats.Format
 	udpReorderer    *rtpreorderer.Reorderer
 	udpRTCPReceiver *rtcpreceiver.RTCPReceiver
+	frameDecoder    *FrameDecoder
 	onPacketRTP     func(*rtp.Packet)
 }
 
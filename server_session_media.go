@@ -24,12 +24,14 @@ type serverSessionMedia struct {
 	tcpRTPFrame            *base.InterleavedFrame
 	tcpRTCPFrame           *base.InterleavedFrame
 	tcpBuffer              []byte
-	formats                map[uint8]*serverSessionFormat // record only
+	formats                map[uint8]*serverSessionFormat        // record only
+	gopCacheOffsets        map[uint8]*serverStreamGOPCacheOffset // play only
 	writePacketRTPInQueue  func([]byte)
 	writePacketRTCPInQueue func([]byte)
 	readRTP                func([]byte) error
 	readRTCP               func([]byte) error
 	onPacketRTCP           func(rtcp.Packet)
+	writeDropper           *writerDropper
 }
 
 func newServerSessionMedia(ss *ServerSession, medi *media.Media) *serverSessionMedia {
@@ -37,6 +39,7 @@ func newServerSessionMedia(ss *ServerSession, medi *media.Media) *serverSessionM
 		ss:           ss,
 		media:        medi,
 		onPacketRTCP: func(rtcp.Packet) {},
+		writeDropper: newWriterDropper(medi),
 	}
 
 	if ss.state == ServerSessionStatePreRecord {
@@ -90,22 +93,22 @@ func (sm *serverSessionMedia) start() {
 			// firewall opening is performed with RTCP sender reports generated by ServerStream
 
 			// readers can send RTCP packets only
-			sm.ss.s.udpRTCPListener.addClient(sm.ss.author.ip(), sm.udpRTCPReadPort, sm)
+			sm.ss.listener.udpRTCPListener.addClient(sm.ss.author.ip(), sm.udpRTCPReadPort, sm)
 		} else {
 			// open the firewall by sending test packets to the counterpart.
 			sm.ss.WritePacketRTP(sm.media, &rtp.Packet{Header: rtp.Header{Version: 2}})
 			sm.ss.WritePacketRTCP(sm.media, &rtcp.ReceiverReport{})
 
-			sm.ss.s.udpRTPListener.addClient(sm.ss.author.ip(), sm.udpRTPReadPort, sm)
-			sm.ss.s.udpRTCPListener.addClient(sm.ss.author.ip(), sm.udpRTCPReadPort, sm)
+			sm.ss.listener.udpRTPListener.addClient(sm.ss.author.ip(), sm.udpRTPReadPort, sm)
+			sm.ss.listener.udpRTCPListener.addClient(sm.ss.author.ip(), sm.udpRTCPReadPort, sm)
 		}
 	}
 }
 
 func (sm *serverSessionMedia) stop() {
 	if *sm.ss.setuppedTransport == TransportUDP {
-		sm.ss.s.udpRTPListener.removeClient(sm)
-		sm.ss.s.udpRTCPListener.removeClient(sm)
+		sm.ss.listener.udpRTPListener.removeClient(sm)
+		sm.ss.listener.udpRTCPListener.removeClient(sm)
 	}
 
 	for _, sf := range sm.formats {
@@ -115,12 +118,14 @@ func (sm *serverSessionMedia) stop() {
 
 func (sm *serverSessionMedia) writePacketRTPInQueueUDP(payload []byte) {
 	atomic.AddUint64(sm.ss.bytesSent, uint64(len(payload)))
-	sm.ss.s.udpRTPListener.write(payload, sm.udpRTPWriteAddr)
+	sm.ss.listener.udpRTPListener.write(payload, sm.udpRTPWriteAddr)
+	sm.ss.capture.writeUDP(true, sm.ss.listener.udpRTPListener.port(), sm.udpRTPWriteAddr, true, payload)
 }
 
 func (sm *serverSessionMedia) writePacketRTCPInQueueUDP(payload []byte) {
 	atomic.AddUint64(sm.ss.bytesSent, uint64(len(payload)))
-	sm.ss.s.udpRTCPListener.write(payload, sm.udpRTCPWriteAddr)
+	sm.ss.listener.udpRTCPListener.write(payload, sm.udpRTCPWriteAddr)
+	sm.ss.capture.writeUDP(true, sm.ss.listener.udpRTCPListener.port(), sm.udpRTCPWriteAddr, false, payload)
 }
 
 func (sm *serverSessionMedia) writePacketRTPInQueueTCP(payload []byte) {
@@ -128,6 +133,7 @@ func (sm *serverSessionMedia) writePacketRTPInQueueTCP(payload []byte) {
 	sm.tcpRTPFrame.Payload = payload
 	sm.ss.tcpConn.nconn.SetWriteDeadline(time.Now().Add(sm.ss.s.WriteTimeout))
 	sm.ss.tcpConn.conn.WriteInterleavedFrame(sm.tcpRTPFrame, sm.tcpBuffer)
+	sm.ss.capture.writeInterleavedFrame(sm.ss.tcpConn.nconn, true, sm.tcpRTPFrame.Channel, payload)
 }
 
 func (sm *serverSessionMedia) writePacketRTCPInQueueTCP(payload []byte) {
@@ -135,18 +141,38 @@ func (sm *serverSessionMedia) writePacketRTCPInQueueTCP(payload []byte) {
 	sm.tcpRTCPFrame.Payload = payload
 	sm.ss.tcpConn.nconn.SetWriteDeadline(time.Now().Add(sm.ss.s.WriteTimeout))
 	sm.ss.tcpConn.conn.WriteInterleavedFrame(sm.tcpRTCPFrame, sm.tcpBuffer)
+	sm.ss.capture.writeInterleavedFrame(sm.ss.tcpConn.nconn, true, sm.tcpRTCPFrame.Channel, payload)
 }
 
 func (sm *serverSessionMedia) writePacketRTP(payload []byte) {
-	sm.ss.writer.queue(func() {
+	if sm.writeDropper.skip(payload) {
+		atomic.AddUint64(sm.ss.packetsDropped, 1)
+		return
+	}
+
+	ok := sm.ss.writer.queue(func() {
 		sm.writePacketRTPInQueue(payload)
 	})
+	if !ok {
+		sm.ss.onWriteQueueFull(sm, true)
+	}
 }
 
 func (sm *serverSessionMedia) writePacketRTCP(payload []byte) {
-	sm.ss.writer.queue(func() {
+	ok := sm.ss.writer.queue(func() {
 		sm.writePacketRTCPInQueue(payload)
 	})
+	if !ok {
+		sm.ss.onWriteQueueFull(sm, false)
+	}
+}
+
+func (sm *serverSessionMedia) processSenderReport(sr *rtcp.SenderReport) {
+	for _, sf := range sm.formats {
+		if sf.frameDecoder != nil {
+			sf.frameDecoder.ProcessSenderReport(sr)
+		}
+	}
 }
 
 func (sm *serverSessionMedia) readRTCPUDPPlay(payload []byte) error {
@@ -230,6 +256,8 @@ func (sm *serverSessionMedia) readRTCPUDPRecord(payload []byte) error {
 			if format != nil {
 				format.udpRTCPReceiver.ProcessSenderReport(sr, now)
 			}
+
+			sm.processSenderReport(sr)
 		}
 	}
 
@@ -295,6 +323,10 @@ func (sm *serverSessionMedia) readRTCPTCPRecord(payload []byte) error {
 	}
 
 	for _, pkt := range packets {
+		if sr, ok := pkt.(*rtcp.SenderReport); ok {
+			sm.processSenderReport(sr)
+		}
+
 		sm.onPacketRTCP(pkt)
 	}
 
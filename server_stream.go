@@ -8,6 +8,7 @@ import (
 	"github.com/pion/rtcp"
 	"github.com/pion/rtp"
 
+	"github.com/bluenviron/gortsplib/v3/pkg/formats"
 	"github.com/bluenviron/gortsplib/v3/pkg/headers"
 	"github.com/bluenviron/gortsplib/v3/pkg/liberrors"
 	"github.com/bluenviron/gortsplib/v3/pkg/media"
@@ -25,7 +26,13 @@ type ServerStream struct {
 	s                    *Server
 	activeUnicastReaders map[*ServerSession]struct{}
 	readers              map[*ServerSession]struct{}
+	gopCacheReplayed     map[*ServerSession]struct{}
+	timeShift            *serverStreamTimeShift
+	timeShiftReaders     map[*ServerSession]*serverStreamTimeShiftReader
+	timeShiftPaused      map[*ServerSession]uint64
+	vod                  *ServerVOD
 	streamMedias         map[*media.Media]*serverStreamMedia
+	inProcessReaders     map[*ServerStreamReader]struct{}
 	closed               bool
 }
 
@@ -35,6 +42,10 @@ func NewServerStream(medias media.Medias) *ServerStream {
 		medias:               medias,
 		activeUnicastReaders: make(map[*ServerSession]struct{}),
 		readers:              make(map[*ServerSession]struct{}),
+		gopCacheReplayed:     make(map[*ServerSession]struct{}),
+		timeShiftReaders:     make(map[*ServerSession]*serverStreamTimeShiftReader),
+		timeShiftPaused:      make(map[*ServerSession]uint64),
+		inProcessReaders:     make(map[*ServerStreamReader]struct{}),
 	}
 
 	st.streamMedias = make(map[*media.Media]*serverStreamMedia, len(medias))
@@ -59,8 +70,17 @@ func (st *ServerStream) initializeServerDependentPart() {
 func (st *ServerStream) Close() error {
 	st.mutex.Lock()
 	st.closed = true
+	timeShiftReaders := st.timeShiftReaders
+	st.timeShiftReaders = nil
+	st.inProcessReaders = nil
 	st.mutex.Unlock()
 
+	// time-shift readers are closed without holding the mutex,
+	// since they may be waiting for space in the write queue of a session.
+	for _, r := range timeShiftReaders {
+		r.close()
+	}
+
 	for ss := range st.readers {
 		ss.Close()
 	}
@@ -72,6 +92,78 @@ func (st *ServerStream) Close() error {
 	return nil
 }
 
+// EnableGOPCache enables a cache that contains the packets of a media
+// received since the last keyframe (group of pictures, GOP).
+// Readers receive the cached packets before live ones, and therefore
+// can start decoding immediately.
+// Cached packets are rebased in order to have consecutive sequence numbers
+// and to start from the timestamp of the last received packet; the same offsets
+// are applied to the live packets and sender reports sent to the reader.
+// Keyframes are detected in H264, H265, VP8 and VP9 formats.
+// Packets are cached until maxPackets is reached, then the cache is
+// emptied until the next keyframe. Since cached packets are queued at once,
+// maxPackets must be lower than half of the server WriteBufferCount.
+// The cache is not used with the UDP-multicast transport protocol.
+func (st *ServerStream) EnableGOPCache(medi *media.Media, maxPackets int) error {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	sm, ok := st.streamMedias[medi]
+	if !ok {
+		return fmt.Errorf("media not found")
+	}
+
+	if maxPackets <= 0 {
+		return fmt.Errorf("maxPackets must be greater than zero")
+	}
+
+	enabled := false
+
+	for _, forma := range sm.formats {
+		forma.gopCache = newServerStreamGOPCache(forma.format, maxPackets)
+		if forma.gopCache != nil {
+			enabled = true
+		}
+	}
+
+	if !enabled {
+		return fmt.Errorf("media does not contain any format that supports the GOP cache")
+	}
+
+	return nil
+}
+
+// EnableTimeShift enables a history of the stream, that allows readers
+// to start reading from a point in the recent past, by sending a PLAY
+// request with a Range header.
+// Ranges can be expressed in NPT units, where 0 is the time of the first
+// packet of the stream, or in UTC units. Since most clients send npt=0-
+// by default, npt=0- is interpreted as a request for the live stream.
+// The current position in the NPT timeline is returned in the Range
+// header of PLAY responses.
+// When the history is enabled, PAUSE and PLAY requests resume reading
+// from the position in which the stream was paused.
+// Playback starts from keyframes of the first media that supports
+// the GOP cache. The history is bounded by maxDuration and by
+// maxSize, which is expressed in bytes.
+// The history is not used with the UDP-multicast transport protocol.
+func (st *ServerStream) EnableTimeShift(maxDuration time.Duration, maxSize int) error {
+	if maxDuration <= 0 {
+		return fmt.Errorf("maxDuration must be greater than zero")
+	}
+
+	if maxSize <= 0 {
+		return fmt.Errorf("maxSize must be greater than zero")
+	}
+
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	st.timeShift = newServerStreamTimeShift(st.medias, maxDuration, maxSize)
+
+	return nil
+}
+
 // Medias returns the medias of the stream.
 func (st *ServerStream) Medias() media.Medias {
 	return st.medias
@@ -99,6 +191,21 @@ func (st *ServerStream) lastSSRC(medi *media.Media) (uint32, bool) {
 	return sm.formats[firstKey].rtcpSender.LastSSRC()
 }
 
+// newRTPInfoEntry returns a RTP-Info entry that contains the sequence number
+// and timestamp of the first packet sent of a media, or nil if the media
+// contains multiple formats, since RTP-Info doesn't support
+// multiple sequence numbers / timestamps.
+func newRTPInfoEntry(medi *media.Media, seqNum uint16, ts uint32) *headers.RTPInfoEntry {
+	if len(medi.Formats) != 1 {
+		return nil
+	}
+
+	return &headers.RTPInfoEntry{
+		SequenceNumber: &seqNum,
+		Timestamp:      &ts,
+	}
+}
+
 func (st *ServerStream) rtpInfoEntry(medi *media.Media, now time.Time) *headers.RTPInfoEntry {
 	st.mutex.Lock()
 	defer st.mutex.Unlock()
@@ -202,6 +309,8 @@ func (st *ServerStream) readerRemove(ss *ServerSession) {
 	}
 
 	delete(st.readers, ss)
+	delete(st.gopCacheReplayed, ss)
+	delete(st.timeShiftPaused, ss)
 
 	if len(st.readers) == 0 {
 		for _, media := range st.streamMedias {
@@ -213,12 +322,40 @@ func (st *ServerStream) readerRemove(ss *ServerSession) {
 	}
 }
 
-func (st *ServerStream) readerSetActive(ss *ServerSession) {
+func (st *ServerStream) inProcessReaderAdd(r *ServerStreamReader) error {
 	st.mutex.Lock()
 	defer st.mutex.Unlock()
 
 	if st.closed {
-		return
+		return fmt.Errorf("stream is closed")
+	}
+
+	st.inProcessReaders[r] = struct{}{}
+	return nil
+}
+
+func (st *ServerStream) inProcessReaderRemove(r *ServerStreamReader) {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	delete(st.inProcessReaders, r)
+}
+
+// readerSetActive starts sending packets to a reader.
+// If the GOP cache is enabled, cached packets are sent first.
+// If the history is enabled and the reader requested a point in the past,
+// packets are read from the history.
+// RTP-Info entries and the Range header that describe the first
+// sent packets are returned.
+func (st *ServerStream) readerSetActive(
+	ss *ServerSession,
+	ra *headers.Range,
+) (map[*media.Media]*headers.RTPInfoEntry, *headers.Range, error) {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	if st.closed {
+		return nil, nil, nil
 	}
 
 	if *ss.setuppedTransport == TransportUDPMulticast {
@@ -227,17 +364,145 @@ func (st *ServerStream) readerSetActive(ss *ServerSession) {
 			streamMedia.multicastWriter.rtcpl.addClient(
 				ss.author.ip(), streamMedia.multicastWriter.rtcpl.port(), sm)
 		}
-	} else {
-		st.activeUnicastReaders[ss] = struct{}{}
+		return nil, nil, nil
+	}
+
+	if st.timeShift != nil {
+		pos, ok := st.timeShiftStartPosition(ss, ra)
+		delete(st.timeShiftPaused, ss)
+
+		if ok {
+			st.timeShiftReaders[ss] = newServerStreamTimeShiftReader(st.timeShift, ss, pos)
+			rtpInfo, resRange := st.timeShift.describe(pos, st.medias, isRangeUTC(ra))
+			return rtpInfo, resRange, nil
+		}
+	}
+
+	st.activeUnicastReaders[ss] = struct{}{}
+
+	if st.vod != nil {
+		st.vod.start()
 	}
+
+	rtpInfo, err := st.replayGOPCache(ss)
+
+	var resRange *headers.Range
+	if st.timeShift != nil {
+		resRange = st.timeShift.rangeHeader(time.Now(), isRangeUTC(ra))
+	}
+
+	return rtpInfo, resRange, err
+}
+
+func isRangeUTC(ra *headers.Range) bool {
+	if ra == nil {
+		return false
+	}
+	_, ok := ra.Value.(*headers.RangeUTC)
+	return ok
+}
+
+// timeShiftStartPosition returns the position of the history from which
+// a reader must start reading, or false if the reader must read the live stream.
+func (st *ServerStream) timeShiftStartPosition(ss *ServerSession, ra *headers.Range) (uint64, bool) {
+	if ra != nil {
+		target, ok := st.timeShift.target(ra)
+		if !ok {
+			return 0, false
+		}
+		return st.timeShift.seek(target)
+	}
+
+	pos, ok := st.timeShiftPaused[ss]
+	return pos, ok
+}
+
+func (st *ServerStream) replayGOPCache(ss *ServerSession) (map[*media.Media]*headers.RTPInfoEntry, error) {
+	// after a pause, readers already received older packets.
+	if _, ok := st.gopCacheReplayed[ss]; ok {
+		return nil, nil
+	}
+	st.gopCacheReplayed[ss] = struct{}{}
+
+	cached := make(map[*serverSessionMedia][]*rtp.Packet)
+	count := 0
+
+	for medi, sm := range ss.setuppedMedias {
+		for pt, forma := range st.streamMedias[medi].formats {
+			if forma.gopCache != nil {
+				pkts, offset := forma.gopCache.get()
+				if offset != nil {
+					if sm.gopCacheOffsets == nil {
+						sm.gopCacheOffsets = make(map[uint8]*serverStreamGOPCacheOffset)
+					}
+					sm.gopCacheOffsets[pt] = offset
+				}
+				cached[sm] = append(cached[sm], pkts...)
+				count += len(pkts)
+			}
+		}
+	}
+
+	if count == 0 {
+		return nil, nil
+	}
+
+	// packets are queued before the writer is started, therefore
+	// they must fit into the write buffer.
+	if count > ss.s.WriteBufferCount/2 {
+		return nil, fmt.Errorf("GOP cache contains %d packets, that do not fit into the write buffer. "+
+			"Increase WriteBufferCount or decrease the size of the GOP cache", count)
+	}
+
+	rtpInfo := make(map[*media.Media]*headers.RTPInfoEntry)
+
+	for sm, pkts := range cached {
+		for _, pkt := range pkts {
+			byts := make([]byte, maxPacketSize)
+			n, err := pkt.MarshalTo(byts)
+			if err != nil {
+				continue
+			}
+			sm.writePacketRTP(byts[:n])
+		}
+
+		if len(pkts) != 0 {
+			if entry := newRTPInfoEntry(sm.media, pkts[0].SequenceNumber, pkts[0].Timestamp); entry != nil {
+				rtpInfo[sm.media] = entry
+			}
+		}
+	}
+
+	return rtpInfo, nil
 }
 
 func (st *ServerStream) readerSetInactive(ss *ServerSession) {
+	r := st.readerSetInactiveInner(ss)
+	if r == nil {
+		return
+	}
+
+	// the time-shift reader is closed without holding the mutex,
+	// since it may be waiting for space in the write queue of the session.
+	pos := r.close()
+
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	// save the position, in order to resume reading from it.
+	if !st.closed {
+		st.timeShiftPaused[ss] = pos
+	}
+}
+
+// readerSetInactiveInner removes a reader from the active ones,
+// and returns its time-shift reader, if any.
+func (st *ServerStream) readerSetInactiveInner(ss *ServerSession) *serverStreamTimeShiftReader {
 	st.mutex.Lock()
 	defer st.mutex.Unlock()
 
 	if st.closed {
-		return
+		return nil
 	}
 
 	if *ss.setuppedTransport == TransportUDPMulticast {
@@ -245,9 +510,26 @@ func (st *ServerStream) readerSetInactive(ss *ServerSession) {
 			streamMedia := st.streamMedias[medi]
 			streamMedia.multicastWriter.rtcpl.removeClient(sm)
 		}
-	} else {
+		return nil
+	}
+
+	if r, ok := st.timeShiftReaders[ss]; ok {
+		delete(st.timeShiftReaders, ss)
+		return r
+	}
+
+	// save the position, in order to resume reading from it.
+	if _, ok := st.activeUnicastReaders[ss]; ok {
 		delete(st.activeUnicastReaders, ss)
+		if st.vod != nil {
+			st.vod.stopAsync()
+		}
+		if st.timeShift != nil {
+			st.timeShiftPaused[ss] = st.timeShift.end()
+		}
 	}
+
+	return nil
 }
 
 // WritePacketRTP writes a RTP packet to all the readers of the stream.
@@ -270,6 +552,30 @@ func (st *ServerStream) WritePacketRTPWithNTP(medi *media.Media, pkt *rtp.Packet
 	sm.WritePacketRTPWithNTP(st, pkt, ntp)
 }
 
+// WriteFrame writes a frame to all the readers of the stream.
+// The frame is packetized with the encoder of the format.
+// With H264 and H265, Payload contains NALUs, and parameter sets found among them are saved into the format;
+// with MPEG-4 Audio, it can contain multiple access units; otherwise, it must contain a single element.
+// If NTP is zero, it is computed from PTS.
+func (st *ServerStream) WriteFrame(medi *media.Media, forma formats.Format, fr *Frame) error {
+	sm := st.streamMedias[medi]
+	sf := sm.formats[forma.PayloadType()]
+
+	return sf.frameEncoder.encodeFrame(fr, func(pkt *rtp.Packet, ntp time.Time) error {
+		st.WritePacketRTPWithNTP(medi, pkt, ntp)
+		return nil
+	})
+}
+
+// WriteAccessUnit writes an access unit to all the readers of the stream.
+// It is equivalent to WriteFrame with a frame that contains PTS and Payload only.
+func (st *ServerStream) WriteAccessUnit(medi *media.Media, forma formats.Format, pts time.Duration, au [][]byte) error {
+	return st.WriteFrame(medi, forma, &Frame{
+		PTS:     pts,
+		Payload: au,
+	})
+}
+
 // WritePacketRTCP writes a RTCP packet to all the readers of the stream.
 func (st *ServerStream) WritePacketRTCP(medi *media.Media, pkt rtcp.Packet) {
 	st.mutex.RLock()
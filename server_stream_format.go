@@ -6,6 +6,8 @@ import (
 )
 
 type serverStreamFormat struct {
-	format     formats.Format
-	rtcpSender *rtcpsender.RTCPSender
+	format       formats.Format
+	rtcpSender   *rtcpsender.RTCPSender
+	gopCache     *serverStreamGOPCache
+	frameEncoder *frameEncoder
 }
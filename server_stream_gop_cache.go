@@ -0,0 +1,305 @@
+package gortsplib
+
+import (
+	"encoding/binary"
+	"sync"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+
+	"github.com/bluenviron/gortsplib/v3/pkg/formats"
+	"github.com/bluenviron/mediacommon/pkg/codecs/h265"
+)
+
+func h265NALUTypeIsIRAP(typ h265.NALUType) bool {
+	return typ >= h265.NALUType_BLA_W_LP && typ <= h265.NALUType_RSV_IRAP_VCL23
+}
+
+func rtpH265ContainsIRAP(pkt *rtp.Packet, donEnabled bool) bool {
+	if len(pkt.Payload) < 2 {
+		return false
+	}
+
+	typ := h265.NALUType((pkt.Payload[0] >> 1) & 0b111111)
+
+	switch typ {
+	case h265.NALUType_AggregationUnit:
+		payload := pkt.Payload[2:]
+		first := true
+
+		for len(payload) > 0 {
+			if donEnabled {
+				// DONL before the first NALU, DOND before the others
+				if first {
+					if len(payload) < 2 {
+						return false
+					}
+					payload = payload[2:]
+				} else {
+					if len(payload) < 1 {
+						return false
+					}
+					payload = payload[1:]
+				}
+			}
+			first = false
+
+			if len(payload) < 2 {
+				return false
+			}
+
+			size := uint16(payload[0])<<8 | uint16(payload[1])
+			payload = payload[2:]
+
+			if size == 0 || int(size) > len(payload) {
+				return false
+			}
+
+			nalu := payload[:size]
+			payload = payload[size:]
+
+			if h265NALUTypeIsIRAP(h265.NALUType((nalu[0] >> 1) & 0b111111)) {
+				return true
+			}
+		}
+
+		return false
+
+	case h265.NALUType_FragmentationUnit:
+		if len(pkt.Payload) < 3 {
+			return false
+		}
+
+		start := pkt.Payload[2] >> 7
+		if start != 1 {
+			return false
+		}
+
+		return h265NALUTypeIsIRAP(h265.NALUType(pkt.Payload[2] & 0b111111))
+
+	default:
+		return h265NALUTypeIsIRAP(typ)
+	}
+}
+
+func rtpVP8ContainsKeyframe(pkt *rtp.Packet) bool {
+	payload := pkt.Payload
+	if len(payload) < 1 {
+		return false
+	}
+
+	// a keyframe starts at the beginning of partition 0
+	start := (payload[0] & 0x10) != 0
+	partitionID := payload[0] & 0x07
+	if !start || partitionID != 0 {
+		return false
+	}
+
+	i := 1
+
+	// extended control bits
+	if (payload[0] & 0x80) != 0 {
+		if len(payload) < 2 {
+			return false
+		}
+		ext := payload[1]
+		i++
+
+		// picture ID
+		if (ext & 0x80) != 0 {
+			if len(payload) <= i {
+				return false
+			}
+			if (payload[i] & 0x80) != 0 {
+				i += 2
+			} else {
+				i++
+			}
+		}
+
+		// TL0PICIDX
+		if (ext & 0x40) != 0 {
+			i++
+		}
+
+		// TID / KEYIDX
+		if (ext & 0x30) != 0 {
+			i++
+		}
+	}
+
+	if len(payload) <= i {
+		return false
+	}
+
+	// P bit of the VP8 payload header
+	return (payload[i] & 0x01) == 0
+}
+
+func rtpVP9ContainsKeyframe(pkt *rtp.Packet) bool {
+	if len(pkt.Payload) < 1 {
+		return false
+	}
+
+	// start of a frame (B bit) that is not inter-picture predicted (P bit)
+	return (pkt.Payload[0]&0x08) != 0 && (pkt.Payload[0]&0x40) == 0
+}
+
+// gopCacheKeyframeFunc returns a function that detects keyframes
+// of a format, or nil if the format is not supported.
+func gopCacheKeyframeFunc(forma formats.Format) func(*rtp.Packet) bool {
+	switch tforma := forma.(type) {
+	case *formats.H264:
+		// in H264, PTS is equal to DTS in IDR frames.
+		return tforma.PTSEqualsDTS
+
+	case *formats.H265:
+		donEnabled := tforma.MaxDONDiff != 0
+		return func(pkt *rtp.Packet) bool {
+			return rtpH265ContainsIRAP(pkt, donEnabled)
+		}
+
+	case *formats.VP8:
+		return rtpVP8ContainsKeyframe
+
+	case *formats.VP9:
+		return rtpVP9ContainsKeyframe
+	}
+
+	return nil
+}
+
+// serverStreamGOPCache contains the packets of a format since the last keyframe.
+type serverStreamGOPCache struct {
+	maxPackets int
+	isKeyframe func(*rtp.Packet) bool
+
+	mutex   sync.Mutex
+	packets []*rtp.Packet
+	auStart int
+	started bool
+}
+
+func newServerStreamGOPCache(forma formats.Format, maxPackets int) *serverStreamGOPCache {
+	isKeyframe := gopCacheKeyframeFunc(forma)
+	if isKeyframe == nil {
+		return nil
+	}
+
+	return &serverStreamGOPCache{
+		maxPackets: maxPackets,
+		isKeyframe: isKeyframe,
+	}
+}
+
+func (c *serverStreamGOPCache) process(pkt *rtp.Packet) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// a new access unit begins.
+	// until a keyframe is found, keep only the current access unit,
+	// since it may contain parameters that precede the keyframe.
+	if len(c.packets) == 0 || c.packets[len(c.packets)-1].Timestamp != pkt.Timestamp {
+		if !c.started {
+			c.packets = nil
+		}
+		c.auStart = len(c.packets)
+	}
+
+	if c.isKeyframe(pkt) {
+		if c.auStart != 0 {
+			c.packets = append([]*rtp.Packet(nil), c.packets[c.auStart:]...)
+			c.auStart = 0
+		}
+		c.started = true
+	}
+
+	// GOP is too big, wait for the next keyframe
+	if len(c.packets) >= c.maxPackets {
+		c.packets = nil
+		c.auStart = 0
+		c.started = false
+		return
+	}
+
+	c.packets = append(c.packets, pkt.Clone())
+}
+
+// get returns the cached packets, rebased in order to have consecutive sequence numbers
+// and to start from the timestamp of the last received packet, and the offsets
+// that must be applied to the following live packets in order to continue the sequence.
+func (c *serverStreamGOPCache) get() ([]*rtp.Packet, *serverStreamGOPCacheOffset) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if !c.started {
+		return nil, nil
+	}
+
+	n := len(c.packets)
+	first := c.packets[0]
+	last := c.packets[n-1]
+
+	offset := &serverStreamGOPCacheOffset{
+		ssrc:      first.SSRC,
+		seqNum:    first.SequenceNumber + uint16(n) - (last.SequenceNumber + 1),
+		timestamp: last.Timestamp - first.Timestamp,
+	}
+
+	ret := make([]*rtp.Packet, n)
+
+	for i, pkt := range c.packets {
+		ret[i] = &rtp.Packet{
+			Header:  pkt.Header,
+			Payload: pkt.Payload,
+		}
+		ret[i].SequenceNumber = first.SequenceNumber + uint16(i)
+		ret[i].Timestamp = pkt.Timestamp + offset.timestamp
+	}
+
+	return ret, offset
+}
+
+// serverStreamGOPCacheOffset contains the offsets that are added to sequence numbers
+// and timestamps of the live packets of a format sent to a reader that received the GOP cache.
+type serverStreamGOPCacheOffset struct {
+	ssrc      uint32
+	seqNum    uint16
+	timestamp uint32
+}
+
+func (o *serverStreamGOPCacheOffset) applyRTP(byts []byte) []byte {
+	ret := make([]byte, len(byts))
+	copy(ret, byts)
+	binary.BigEndian.PutUint16(ret[2:], binary.BigEndian.Uint16(ret[2:])+o.seqNum)
+	binary.BigEndian.PutUint32(ret[4:], binary.BigEndian.Uint32(ret[4:])+o.timestamp)
+	return ret
+}
+
+// gopCacheApplyOffsetsRTCP rebases the RTP time of sender reports,
+// in order to keep them consistent with rebased timestamps.
+func gopCacheApplyOffsetsRTCP(
+	offsets map[uint8]*serverStreamGOPCacheOffset,
+	pkt rtcp.Packet,
+	byts []byte,
+) []byte {
+	sr, ok := pkt.(*rtcp.SenderReport)
+	if !ok {
+		return byts
+	}
+
+	for _, offset := range offsets {
+		if offset.ssrc == sr.SSRC {
+			sr2 := *sr
+			sr2.RTPTime += offset.timestamp
+
+			byts2, err := sr2.Marshal()
+			if err != nil {
+				return byts
+			}
+			return byts2
+		}
+	}
+
+	return byts
+}
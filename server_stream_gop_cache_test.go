@@ -0,0 +1,153 @@
+package gortsplib
+
+import (
+	"testing"
+
+	"github.com/pion/rtp"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/gortsplib/v3/pkg/formats"
+)
+
+func TestGOPCacheKeyframeDetection(t *testing.T) {
+	for _, ca := range []struct {
+		name     string
+		forma    formats.Format
+		payload  []byte
+		keyframe bool
+	}{
+		{"h264 idr", &formats.H264{}, []byte{0x65, 0x01}, true},
+		{"h264 non-idr", &formats.H264{}, []byte{0x41, 0x01}, false},
+		{"h264 fu-a start idr", &formats.H264{}, []byte{0x7c, 0x85, 0x01}, true},
+		{"h264 fu-a middle idr", &formats.H264{}, []byte{0x7c, 0x05, 0x01}, false},
+		{"h265 idr", &formats.H265{}, []byte{0x26, 0x01, 0x01}, true},
+		{"h265 cra", &formats.H265{}, []byte{0x2a, 0x01, 0x01}, true},
+		{"h265 trail", &formats.H265{}, []byte{0x02, 0x01, 0x01}, false},
+		{"h265 aggregation idr", &formats.H265{}, []byte{
+			0x60, 0x01,
+			0x00, 0x02, 0x40, 0x01, // VPS
+			0x00, 0x03, 0x26, 0x01, 0x01, // IDR
+		}, true},
+		{"h265 aggregation with don idr", &formats.H265{MaxDONDiff: 2}, []byte{
+			0x60, 0x01,
+			0x00, 0x00, 0x00, 0x02, 0x40, 0x01, // DONL, VPS
+			0x01, 0x00, 0x03, 0x26, 0x01, 0x01, // DOND, IDR
+		}, true},
+		{"h265 fu start idr", &formats.H265{}, []byte{0x62, 0x01, 0x93, 0x01}, true},
+		{"h265 fu end idr", &formats.H265{}, []byte{0x62, 0x01, 0x53, 0x01}, false},
+		{"vp8 keyframe", &formats.VP8{}, []byte{0x10, 0x00, 0x01}, true},
+		{"vp8 keyframe with picture id", &formats.VP8{}, []byte{0x90, 0x80, 0x81, 0x02, 0x00}, true},
+		{"vp8 interframe", &formats.VP8{}, []byte{0x10, 0x01, 0x01}, false},
+		{"vp8 continuation", &formats.VP8{}, []byte{0x00, 0x00, 0x01}, false},
+		{"vp9 keyframe", &formats.VP9{}, []byte{0x08, 0x01}, true},
+		{"vp9 interframe", &formats.VP9{}, []byte{0x48, 0x01}, false},
+		{"vp9 continuation", &formats.VP9{}, []byte{0x00, 0x01}, false},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			isKeyframe := gopCacheKeyframeFunc(ca.forma)
+			require.NotNil(t, isKeyframe)
+			require.Equal(t, ca.keyframe, isKeyframe(&rtp.Packet{Payload: ca.payload}))
+		})
+	}
+
+	require.Nil(t, gopCacheKeyframeFunc(&formats.G711{}))
+}
+
+func TestGOPCacheMaxPackets(t *testing.T) {
+	c := newServerStreamGOPCache(&formats.H264{}, 3)
+
+	for i, payload := range [][]byte{
+		{0x65, 0x01},
+		{0x41, 0x01},
+		{0x41, 0x02},
+	} {
+		c.process(&rtp.Packet{
+			Header: rtp.Header{
+				SequenceNumber: uint16(65534 + i),
+				Timestamp:      uint32(i),
+			},
+			Payload: payload,
+		})
+	}
+
+	pkts, _ := c.get()
+	require.Equal(t, 3, len(pkts))
+	require.Equal(t, uint16(65534), pkts[0].SequenceNumber)
+	require.Equal(t, uint16(0), pkts[2].SequenceNumber)
+
+	// GOP exceeds the limit
+	c.process(&rtp.Packet{
+		Header:  rtp.Header{SequenceNumber: 1, Timestamp: 3},
+		Payload: []byte{0x41, 0x03},
+	})
+	pkts, _ = c.get()
+	require.Equal(t, 0, len(pkts))
+
+	c.process(&rtp.Packet{
+		Header:  rtp.Header{SequenceNumber: 2, Timestamp: 4},
+		Payload: []byte{0x65, 0x02},
+	})
+	pkts, _ = c.get()
+	require.Equal(t, 1, len(pkts))
+}
+
+func TestGOPCacheOffset(t *testing.T) {
+	c := newServerStreamGOPCache(&formats.H264{}, 10)
+
+	for _, pkt := range []struct {
+		seqNum  uint16
+		ts      uint32
+		payload []byte
+	}{
+		{65533, 4294967000, []byte{0x65, 0x01}},
+		{65535, 4294967100, []byte{0x41, 0x01}},
+		{1, 4, []byte{0x41, 0x02}},
+	} {
+		c.process(&rtp.Packet{
+			Header: rtp.Header{
+				SequenceNumber: pkt.seqNum,
+				Timestamp:      pkt.ts,
+				SSRC:           1234,
+			},
+			Payload: pkt.payload,
+		})
+	}
+
+	pkts, offset := c.get()
+	require.Equal(t, &serverStreamGOPCacheOffset{
+		ssrc:      1234,
+		seqNum:    65534,
+		timestamp: 300,
+	}, offset)
+
+	live := &rtp.Packet{
+		Header: rtp.Header{
+			Version:        2,
+			SequenceNumber: 2,
+			Timestamp:      104,
+			SSRC:           1234,
+		},
+		Payload: []byte{0x41, 0x03},
+	}
+	byts, err := live.Marshal()
+	require.NoError(t, err)
+
+	var rebased rtp.Packet
+	err = rebased.Unmarshal(offset.applyRTP(byts))
+	require.NoError(t, err)
+	pkts = append(pkts, &rebased)
+
+	// sequence numbers are consecutive and timestamps keep their spacing
+	for i, expected := range []struct {
+		seqNum uint16
+		ts     uint32
+	}{
+		{65533, 4},
+		{65534, 104},
+		{65535, 304},
+		{0, 404},
+	} {
+		require.Equal(t, expected.seqNum, pkts[i].SequenceNumber)
+		require.Equal(t, expected.ts, pkts[i].Timestamp)
+	}
+}
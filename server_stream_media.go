@@ -27,7 +27,8 @@ func newServerStreamMedia(st *ServerStream, medi *media.Media) *serverStreamMedi
 	sm.formats = make(map[uint8]*serverStreamFormat)
 	for _, forma := range medi.Formats {
 		tr := &serverStreamFormat{
-			format: forma,
+			format:       forma,
+			frameEncoder: newFrameEncoder(forma),
 		}
 
 		cmedia := medi
@@ -80,11 +81,31 @@ func (sm *serverStreamMedia) WritePacketRTPWithNTP(ss *ServerStream, pkt *rtp.Pa
 
 	forma.rtcpSender.ProcessPacket(pkt, ntp, forma.format.PTSEqualsDTS(pkt))
 
+	if forma.gopCache != nil {
+		forma.gopCache.process(pkt)
+	}
+
+	if ss.timeShift != nil {
+		ss.timeShift.write(sm.media, pkt, byts, ntp)
+	}
+
 	// send unicast
 	for r := range ss.activeUnicastReaders {
 		sm, ok := r.setuppedMedias[sm.media]
 		if ok {
-			sm.writePacketRTP(byts)
+			if offset, ok := sm.gopCacheOffsets[pkt.PayloadType]; ok {
+				sm.writePacketRTP(offset.applyRTP(byts))
+			} else {
+				sm.writePacketRTP(byts)
+			}
+		}
+	}
+
+	// send to in-process readers
+	for r := range ss.inProcessReaders {
+		rm, ok := r.medias[sm.media]
+		if ok {
+			rm.writePacketRTP(byts)
 		}
 	}
 
@@ -104,7 +125,7 @@ func (sm *serverStreamMedia) writePacketRTCP(ss *ServerStream, pkt rtcp.Packet)
 	for r := range ss.activeUnicastReaders {
 		sm, ok := r.setuppedMedias[sm.media]
 		if ok {
-			sm.writePacketRTCP(byts)
+			sm.writePacketRTCP(gopCacheApplyOffsetsRTCP(sm.gopCacheOffsets, pkt, byts))
 		}
 	}
 
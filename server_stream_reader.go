@@ -0,0 +1,134 @@
+package gortsplib
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/pion/rtp"
+
+	"github.com/bluenviron/gortsplib/v3/pkg/formats"
+	"github.com/bluenviron/gortsplib/v3/pkg/media"
+)
+
+type serverStreamReaderMedia struct {
+	r            *ServerStreamReader
+	onPacketRTP  map[uint8]func(*rtp.Packet)
+	writeDropper *writerDropper
+}
+
+func (rm *serverStreamReaderMedia) writePacketRTP(byts []byte) {
+	if rm.writeDropper.skip(byts) {
+		atomic.AddUint64(rm.r.packetsDropped, 1)
+		return
+	}
+
+	ok := rm.r.writer.queue(func() {
+		var pkt rtp.Packet
+		err := pkt.Unmarshal(byts)
+		if err != nil {
+			return
+		}
+
+		cb, ok := rm.onPacketRTP[pkt.PayloadType]
+		if ok {
+			cb(&pkt)
+		}
+	})
+	if !ok {
+		atomic.AddUint64(rm.r.packetsDropped, 1)
+		rm.writeDropper.start()
+	}
+}
+
+// ServerStreamReader reads a ServerStream from the same process,
+// without passing through a RTSP session.
+// Packets are delivered through a dedicated queue, therefore a slow reader
+// does not slow down the stream or the other readers.
+// When the queue is full, packets of a media are discarded until the next keyframe.
+type ServerStreamReader struct {
+	//
+	// parameters
+	//
+	// stream to read.
+	Stream *ServerStream
+	// size of the queue of packets.
+	// It must be a power of two.
+	// It defaults to 256.
+	BufferCount int
+
+	medias         map[*media.Media]*serverStreamReaderMedia
+	writer         writer
+	packetsDropped *uint64
+	started        bool
+	closed         bool
+}
+
+// OnPacketRTP sets the callback that is called when a RTP packet is read.
+// It must be called before Start().
+func (r *ServerStreamReader) OnPacketRTP(medi *media.Media, forma formats.Format, cb func(*rtp.Packet)) {
+	if r.medias == nil {
+		r.medias = make(map[*media.Media]*serverStreamReaderMedia)
+	}
+
+	rm, ok := r.medias[medi]
+	if !ok {
+		rm = &serverStreamReaderMedia{
+			r:            r,
+			onPacketRTP:  make(map[uint8]func(*rtp.Packet)),
+			writeDropper: newWriterDropper(medi),
+		}
+		r.medias[medi] = rm
+	}
+
+	rm.onPacketRTP[forma.PayloadType()] = cb
+}
+
+// Start starts reading the stream.
+func (r *ServerStreamReader) Start() error {
+	if r.BufferCount == 0 {
+		r.BufferCount = 256
+	}
+	if (r.BufferCount & (r.BufferCount - 1)) != 0 {
+		return fmt.Errorf("BufferCount must be a power of two")
+	}
+
+	for medi := range r.medias {
+		if _, ok := r.Stream.streamMedias[medi]; !ok {
+			return fmt.Errorf("media not found in stream")
+		}
+	}
+
+	r.packetsDropped = new(uint64)
+	r.writer.policy = WriteQueuePolicyDropUntilKeyframe
+	r.writer.allocateBuffer(r.BufferCount)
+
+	err := r.Stream.inProcessReaderAdd(r)
+	if err != nil {
+		return err
+	}
+
+	r.writer.start()
+	r.started = true
+
+	return nil
+}
+
+// Close stops reading the stream.
+func (r *ServerStreamReader) Close() {
+	if !r.started || r.closed {
+		return
+	}
+	r.closed = true
+
+	r.Stream.inProcessReaderRemove(r)
+	r.writer.stop()
+}
+
+// PacketsDropped returns the number of packets that have been discarded
+// because the queue was full.
+func (r *ServerStreamReader) PacketsDropped() uint64 {
+	if r.packetsDropped == nil {
+		return 0
+	}
+	return atomic.LoadUint64(r.packetsDropped)
+}
@@ -0,0 +1,105 @@
+package gortsplib
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/gortsplib/v3/pkg/media"
+)
+
+func TestServerStreamReader(t *testing.T) {
+	stream := NewServerStream(media.Medias{testH264Media})
+	defer stream.Close()
+
+	received := make(chan *rtp.Packet)
+
+	r := &ServerStreamReader{Stream: stream}
+	r.OnPacketRTP(testH264Media, testH264Media.Formats[0], func(pkt *rtp.Packet) {
+		received <- pkt
+	})
+	err := r.Start()
+	require.NoError(t, err)
+	defer r.Close()
+
+	stream.WritePacketRTP(testH264Media, &testRTPPacket)
+
+	pkt := <-received
+	require.Equal(t, testRTPPacket.Payload, pkt.Payload)
+	require.Equal(t, testRTPPacket.SequenceNumber, pkt.SequenceNumber)
+	require.Equal(t, uint64(0), r.PacketsDropped())
+}
+
+func TestServerStreamReaderDropUntilKeyframe(t *testing.T) {
+	stream := NewServerStream(media.Medias{testH264Media})
+	defer stream.Close()
+
+	unblock := make(chan struct{})
+	received := make(chan *rtp.Packet, 16)
+
+	r := &ServerStreamReader{
+		Stream:      stream,
+		BufferCount: 2,
+	}
+	r.OnPacketRTP(testH264Media, testH264Media.Formats[0], func(pkt *rtp.Packet) {
+		<-unblock
+		received <- pkt
+	})
+	err := r.Start()
+	require.NoError(t, err)
+	defer r.Close()
+
+	write := func(seqNum uint16, payload []byte) {
+		stream.WritePacketRTP(testH264Media, &rtp.Packet{
+			Header: rtp.Header{
+				Version:        2,
+				Marker:         true,
+				PayloadType:    96,
+				SequenceNumber: seqNum,
+			},
+			Payload: payload,
+		})
+	}
+
+	// fill the queue with non-IDR frames
+	for i := 0; i < 8; i++ {
+		write(uint16(i), []byte{0x41, 0x01})
+	}
+	require.NotEqual(t, uint64(0), r.PacketsDropped())
+
+	// packets are discarded until a IDR frame
+	write(100, []byte{0x41, 0x01})
+	close(unblock)
+
+	// the IDR frame is discarded too until there's space in the queue
+	var seqNums []uint16
+	write(101, []byte{0x65, 0x01})
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
+outer:
+	for {
+		select {
+		case pkt := <-received:
+			seqNums = append(seqNums, pkt.SequenceNumber)
+			if pkt.SequenceNumber == 101 {
+				break outer
+			}
+
+		case <-ticker.C:
+			write(101, []byte{0x65, 0x01})
+		}
+	}
+	require.NotContains(t, seqNums, uint16(100))
+}
+
+func TestServerStreamReaderClosedStream(t *testing.T) {
+	stream := NewServerStream(media.Medias{testH264Media})
+	stream.Close()
+
+	r := &ServerStreamReader{Stream: stream}
+	err := r.Start()
+	require.EqualError(t, err, "stream is closed")
+}
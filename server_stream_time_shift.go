@@ -0,0 +1,460 @@
+package gortsplib
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+
+	"github.com/bluenviron/gortsplib/v3/pkg/formats"
+	"github.com/bluenviron/gortsplib/v3/pkg/headers"
+	"github.com/bluenviron/gortsplib/v3/pkg/media"
+)
+
+type serverStreamTimeShiftEntry struct {
+	media     *media.Media
+	payload   []byte
+	seqNum    uint16
+	timestamp uint32
+	ntp       time.Time
+	keyframe  bool
+}
+
+// serverStreamTimeShift is a bounded history of the packets of a stream,
+// indexed by keyframes.
+type serverStreamTimeShift struct {
+	maxDuration   time.Duration
+	maxSize       int
+	keyframeMedia *media.Media
+	isKeyframe    map[uint8]func(*rtp.Packet) bool
+
+	mutex   sync.Mutex
+	entries []serverStreamTimeShiftEntry
+	first   uint64 // absolute position of entries[0]
+	size    int
+	start   time.Time
+	started bool
+	notify  chan struct{}
+
+	auStarted   bool
+	auStart     uint64
+	auTimestamp uint32
+}
+
+func newServerStreamTimeShift(
+	medias media.Medias,
+	maxDuration time.Duration,
+	maxSize int,
+) *serverStreamTimeShift {
+	ts := &serverStreamTimeShift{
+		maxDuration: maxDuration,
+		maxSize:     maxSize,
+		notify:      make(chan struct{}),
+	}
+
+	// keyframes are searched in the first media that supports them.
+	// If there's no such media, every packet is a random access point.
+outer:
+	for _, medi := range medias {
+		for _, forma := range medi.Formats {
+			if isKeyframe := gopCacheKeyframeFunc(forma); isKeyframe != nil {
+				ts.keyframeMedia = medi
+				break outer
+			}
+		}
+	}
+
+	if ts.keyframeMedia != nil {
+		ts.isKeyframe = make(map[uint8]func(*rtp.Packet) bool)
+		for _, forma := range ts.keyframeMedia.Formats {
+			if isKeyframe := gopCacheKeyframeFunc(forma); isKeyframe != nil {
+				ts.isKeyframe[forma.PayloadType()] = isKeyframe
+			}
+		}
+	}
+
+	return ts
+}
+
+func (ts *serverStreamTimeShift) write(medi *media.Media, pkt *rtp.Packet, payload []byte, ntp time.Time) {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+
+	if !ts.started {
+		ts.started = true
+		ts.start = ntp
+	}
+
+	pos := ts.first + uint64(len(ts.entries))
+
+	// payload is copied, since it is a slice of a bigger buffer,
+	// whose size would not be taken into account by maxSize.
+	payloadCopy := make([]byte, len(payload))
+	copy(payloadCopy, payload)
+
+	ts.entries = append(ts.entries, serverStreamTimeShiftEntry{
+		media:     medi,
+		payload:   payloadCopy,
+		seqNum:    pkt.SequenceNumber,
+		timestamp: pkt.Timestamp,
+		ntp:       ntp,
+		keyframe:  ts.keyframeMedia == nil,
+	})
+	ts.size += len(payload)
+
+	if medi == ts.keyframeMedia {
+		if !ts.auStarted || pkt.Timestamp != ts.auTimestamp {
+			ts.auStarted = true
+			ts.auStart = pos
+			ts.auTimestamp = pkt.Timestamp
+		}
+
+		// playback starts from the beginning of the access unit that contains the keyframe,
+		// since it may contain parameters that precede the keyframe.
+		if isKeyframe, ok := ts.isKeyframe[pkt.PayloadType]; ok && isKeyframe(pkt) && ts.auStart >= ts.first {
+			ts.entries[ts.auStart-ts.first].keyframe = true
+		}
+	}
+
+	// remove old entries
+	for len(ts.entries) > 1 &&
+		(ntp.Sub(ts.entries[0].ntp) > ts.maxDuration || ts.size > ts.maxSize) {
+		ts.size -= len(ts.entries[0].payload)
+		ts.entries[0] = serverStreamTimeShiftEntry{}
+		ts.entries = ts.entries[1:]
+		ts.first++
+	}
+
+	close(ts.notify)
+	ts.notify = make(chan struct{})
+}
+
+func (ts *serverStreamTimeShift) end() uint64 {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+	return ts.first + uint64(len(ts.entries))
+}
+
+// firstKeyframe returns the position of the first keyframe after pos.
+// It must be called with the mutex locked.
+func (ts *serverStreamTimeShift) firstKeyframe(pos uint64) uint64 {
+	if pos < ts.first {
+		pos = ts.first
+	}
+
+	for i := int(pos - ts.first); i < len(ts.entries); i++ {
+		if ts.entries[i].keyframe {
+			return ts.first + uint64(i)
+		}
+	}
+
+	return ts.first + uint64(len(ts.entries))
+}
+
+// seek returns the position of the last keyframe before target,
+// or false if target is not inside the history.
+func (ts *serverStreamTimeShift) seek(target time.Time) (uint64, bool) {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+
+	if len(ts.entries) == 0 || !target.Before(ts.entries[len(ts.entries)-1].ntp) {
+		return 0, false
+	}
+
+	for i := len(ts.entries) - 1; i >= 0; i-- {
+		if ts.entries[i].keyframe && !ts.entries[i].ntp.After(target) {
+			return ts.first + uint64(i), true
+		}
+	}
+
+	// target is older than the history, start from the oldest keyframe
+	pos := ts.firstKeyframe(ts.first)
+	if pos == ts.first+uint64(len(ts.entries)) {
+		return 0, false
+	}
+	return pos, true
+}
+
+// get returns the entry at the given position.
+// If the entry has been removed, position is moved to the first available keyframe.
+// If the entry is not available yet, a channel that is closed when new entries are
+// available is returned.
+func (ts *serverStreamTimeShift) get(pos *uint64) (*serverStreamTimeShiftEntry, chan struct{}) {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+
+	if *pos < ts.first {
+		*pos = ts.firstKeyframe(*pos)
+	}
+
+	i := int(*pos - ts.first)
+	if i >= len(ts.entries) {
+		return nil, ts.notify
+	}
+
+	e := ts.entries[i]
+	return &e, nil
+}
+
+// npt returns the position of a time in the NPT timeline of the stream,
+// that begins with the first packet.
+func (ts *serverStreamTimeShift) npt(t time.Time) time.Duration {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+
+	if !ts.started || t.Before(ts.start) {
+		return 0
+	}
+	return t.Sub(ts.start)
+}
+
+// target returns the time requested by a Range header,
+// or false if the live stream is requested.
+func (ts *serverStreamTimeShift) target(ra *headers.Range) (time.Time, bool) {
+	switch rv := ra.Value.(type) {
+	case *headers.RangeNPT:
+		// npt=0- is sent by most clients by default and
+		// is interpreted as a request for the live stream.
+		if rv.Start == 0 {
+			return time.Time{}, false
+		}
+
+		ts.mutex.Lock()
+		defer ts.mutex.Unlock()
+
+		if !ts.started {
+			return time.Time{}, false
+		}
+		return ts.start.Add(rv.Start), true
+
+	case *headers.RangeUTC:
+		return rv.Start, true
+	}
+
+	return time.Time{}, false
+}
+
+// describe returns the RTP-Info entries and the Range header
+// that describe a playback that starts from pos.
+func (ts *serverStreamTimeShift) describe(
+	pos uint64,
+	medias media.Medias,
+	clock bool,
+) (map[*media.Media]*headers.RTPInfoEntry, *headers.Range) {
+	ts.mutex.Lock()
+
+	rtpInfo := make(map[*media.Media]*headers.RTPInfoEntry)
+	var startNTP time.Time
+
+	if pos < ts.first {
+		pos = ts.first
+	}
+
+	for i := int(pos - ts.first); i < len(ts.entries); i++ {
+		e := &ts.entries[i]
+
+		if startNTP.IsZero() {
+			startNTP = e.ntp
+		}
+
+		if _, ok := rtpInfo[e.media]; !ok {
+			if entry := newRTPInfoEntry(e.media, e.seqNum, e.timestamp); entry != nil {
+				rtpInfo[e.media] = entry
+
+				if len(rtpInfo) == len(medias) {
+					break
+				}
+			}
+		}
+	}
+
+	ts.mutex.Unlock()
+
+	if startNTP.IsZero() {
+		startNTP = time.Now()
+	}
+
+	return rtpInfo, ts.rangeHeader(startNTP, clock)
+}
+
+func (ts *serverStreamTimeShift) rangeHeader(t time.Time, clock bool) *headers.Range {
+	if clock {
+		return &headers.Range{
+			Value: &headers.RangeUTC{
+				Start: t.UTC(),
+			},
+		}
+	}
+
+	return &headers.Range{
+		Value: &headers.RangeNPT{
+			Start: ts.npt(t),
+		},
+	}
+}
+
+type serverStreamTimeShiftReportKey struct {
+	media       *media.Media
+	payloadType uint8
+}
+
+type serverStreamTimeShiftReport struct {
+	last        time.Time
+	packetCount uint32
+	octetCount  uint32
+}
+
+// serverStreamTimeShiftReader sends packets of the history to a reader,
+// with the same pace they were received.
+// Since live sender reports are not sent to the reader, it generates its own,
+// that map timestamps of packets to the time in which they were received.
+type serverStreamTimeShiftReader struct {
+	ts  *serverStreamTimeShift
+	ss  *ServerSession
+	pos uint64
+
+	reports map[serverStreamTimeShiftReportKey]*serverStreamTimeShiftReport
+
+	ctx       context.Context
+	ctxCancel func()
+	done      chan struct{}
+}
+
+func newServerStreamTimeShiftReader(
+	ts *serverStreamTimeShift,
+	ss *ServerSession,
+	pos uint64,
+) *serverStreamTimeShiftReader {
+	ctx, ctxCancel := context.WithCancel(context.Background())
+
+	r := &serverStreamTimeShiftReader{
+		ts:        ts,
+		ss:        ss,
+		pos:       pos,
+		reports:   make(map[serverStreamTimeShiftReportKey]*serverStreamTimeShiftReport),
+		ctx:       ctx,
+		ctxCancel: ctxCancel,
+		done:      make(chan struct{}),
+	}
+
+	go r.run()
+
+	return r
+}
+
+// close stops the reader and returns the position of the next packet.
+func (r *serverStreamTimeShiftReader) close() uint64 {
+	r.ctxCancel()
+	<-r.done
+	return r.pos
+}
+
+func (r *serverStreamTimeShiftReader) run() {
+	defer close(r.done)
+
+	var startTime time.Time
+	var startNTP time.Time
+
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		default:
+		}
+
+		e, wait := r.ts.get(&r.pos)
+		if e == nil {
+			select {
+			case <-wait:
+				continue
+			case <-r.ctx.Done():
+				return
+			}
+		}
+
+		d := time.Until(startTime.Add(e.ntp.Sub(startNTP)))
+
+		// first packet, or reader is too slow and packets have been skipped
+		if startNTP.IsZero() || d < -time.Second {
+			startTime = time.Now()
+			startNTP = e.ntp
+			d = 0
+		}
+
+		if d > 0 {
+			t := time.NewTimer(d)
+			select {
+			case <-t.C:
+			case <-r.ctx.Done():
+				t.Stop()
+				return
+			}
+		}
+
+		if sm, ok := r.ss.setuppedMedias[e.media]; ok {
+			sm.writePacketRTP(e.payload)
+			r.writeSenderReport(sm, e)
+		}
+
+		r.pos++
+	}
+}
+
+func (r *serverStreamTimeShiftReader) writeSenderReport(sm *serverSessionMedia, e *serverStreamTimeShiftEntry) {
+	if r.ss.s.DisableRTCPSenderReports {
+		return
+	}
+
+	var pkt rtp.Packet
+	err := pkt.Unmarshal(e.payload)
+	if err != nil {
+		return
+	}
+
+	key := serverStreamTimeShiftReportKey{media: e.media, payloadType: pkt.PayloadType}
+	rep, ok := r.reports[key]
+	if !ok {
+		rep = &serverStreamTimeShiftReport{}
+		r.reports[key] = rep
+	}
+
+	rep.packetCount++
+	rep.octetCount += uint32(len(pkt.Payload))
+
+	now := time.Now()
+	if !rep.last.IsZero() && now.Sub(rep.last) < r.ss.s.senderReportPeriod {
+		return
+	}
+
+	// the NTP time of a packet is the time of its PTS only when PTS is equal to DTS.
+	forma := findFormatByPayloadType(e.media, pkt.PayloadType)
+	if forma == nil || !forma.PTSEqualsDTS(&pkt) {
+		return
+	}
+
+	rep.last = now
+
+	byts, err := (&rtcp.SenderReport{
+		SSRC:        pkt.SSRC,
+		NTPTime:     timeToNTPTime(e.ntp),
+		RTPTime:     e.timestamp,
+		PacketCount: rep.packetCount,
+		OctetCount:  rep.octetCount,
+	}).Marshal()
+	if err != nil {
+		return
+	}
+
+	sm.writePacketRTCP(byts)
+}
+
+func findFormatByPayloadType(medi *media.Media, payloadType uint8) formats.Format {
+	for _, forma := range medi.Formats {
+		if forma.PayloadType() == payloadType {
+			return forma
+		}
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package gortsplib
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/gortsplib/v3/pkg/media"
+)
+
+func TestTimeShiftMaxSize(t *testing.T) {
+	medias := media.Medias{testH264Media}
+	ts := newServerStreamTimeShift(medias, 1*time.Minute, 10)
+
+	now := time.Now()
+
+	for i := 0; i < 8; i++ {
+		pkt := &rtp.Packet{
+			Header: rtp.Header{
+				Version:        2,
+				PayloadType:    96,
+				SequenceNumber: uint16(i),
+				Timestamp:      uint32(i),
+			},
+			Payload: []byte{0x41, byte(i)},
+		}
+
+		// packets are marshaled into buffers bigger than them
+		byts := make([]byte, maxPacketSize)
+		n, err := pkt.MarshalTo(byts)
+		require.NoError(t, err)
+
+		ts.write(medias[0], pkt, byts[:n], now.Add(time.Duration(i)*time.Millisecond))
+	}
+
+	require.Equal(t, uint64(8), ts.end())
+	require.Equal(t, 1, len(ts.entries))
+
+	size := 0
+	for _, e := range ts.entries {
+		size += cap(e.payload)
+	}
+	require.Equal(t, ts.size, size)
+}
@@ -1,16 +1,22 @@
 package gortsplib
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
 	"net"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/pion/rtp"
 	"github.com/stretchr/testify/require"
 
 	"github.com/bluenviron/gortsplib/v3/pkg/auth"
 	"github.com/bluenviron/gortsplib/v3/pkg/base"
 	"github.com/bluenviron/gortsplib/v3/pkg/conn"
 	"github.com/bluenviron/gortsplib/v3/pkg/headers"
+	"github.com/bluenviron/gortsplib/v3/pkg/liberrors"
 	"github.com/bluenviron/gortsplib/v3/pkg/media"
 )
 
@@ -94,6 +100,9 @@ type testServerHandler struct {
 	onSetParameter func(*ServerHandlerOnSetParameterCtx) (*base.Response, error)
 	onGetParameter func(*ServerHandlerOnGetParameterCtx) (*base.Response, error)
 	onWarning      func(*ServerHandlerOnWarningCtx)
+	onReject       func(*ServerHandlerOnRejectCtx)
+
+	onClientResponse func(*ServerHandlerOnClientResponseCtx)
 }
 
 func (sh *testServerHandler) OnConnOpen(ctx *ServerHandlerOnConnOpenCtx) {
@@ -182,6 +191,18 @@ func (sh *testServerHandler) OnWarning(ctx *ServerHandlerOnWarningCtx) {
 	}
 }
 
+func (sh *testServerHandler) OnReject(ctx *ServerHandlerOnRejectCtx) {
+	if sh.onReject != nil {
+		sh.onReject(ctx)
+	}
+}
+
+func (sh *testServerHandler) OnClientResponse(ctx *ServerHandlerOnClientResponseCtx) {
+	if sh.onClientResponse != nil {
+		sh.onClientResponse(ctx)
+	}
+}
+
 func TestServerClose(t *testing.T) {
 	s := &Server{
 		Handler:     &testServerHandler{},
@@ -216,6 +237,25 @@ func TestServerErrorInvalidUDPPorts(t *testing.T) {
 	})
 }
 
+func TestServerErrorInvalidSessionTimeout(t *testing.T) {
+	for _, ca := range []struct {
+		name    string
+		timeout time.Duration
+	}{
+		{"negative", -1 * time.Second},
+		{"less than one second", 500 * time.Millisecond},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			s := &Server{
+				RTSPAddress:    "localhost:8554",
+				SessionTimeout: ca.timeout,
+			}
+			err := s.Start()
+			require.EqualError(t, err, "SessionTimeout must be at least one second")
+		})
+	}
+}
+
 func TestServerConnClose(t *testing.T) {
 	nconnClosed := make(chan struct{})
 
@@ -625,7 +665,7 @@ func TestServerErrorTCPOneConnTwoSessions(t *testing.T) {
 		},
 	})
 	require.NoError(t, err)
-	require.Equal(t, base.StatusBadRequest, res.StatusCode)
+	require.Equal(t, base.StatusMethodNotValidInThisState, res.StatusCode)
 }
 
 func TestServerSetupMultipleTransports(t *testing.T) {
@@ -888,6 +928,57 @@ func TestServerErrorInvalidSession(t *testing.T) {
 	}
 }
 
+func TestServerErrorMissingSession(t *testing.T) {
+	for _, method := range []base.Method{
+		base.Play,
+		base.Record,
+		base.Pause,
+		base.Teardown,
+	} {
+		t.Run(string(method), func(t *testing.T) {
+			s := &Server{
+				Handler: &testServerHandler{
+					onPlay: func(ctx *ServerHandlerOnPlayCtx) (*base.Response, error) {
+						return &base.Response{
+							StatusCode: base.StatusOK,
+						}, nil
+					},
+					onRecord: func(ctx *ServerHandlerOnRecordCtx) (*base.Response, error) {
+						return &base.Response{
+							StatusCode: base.StatusOK,
+						}, nil
+					},
+					onPause: func(ctx *ServerHandlerOnPauseCtx) (*base.Response, error) {
+						return &base.Response{
+							StatusCode: base.StatusOK,
+						}, nil
+					},
+				},
+				RTSPAddress: "localhost:8554",
+			}
+
+			err := s.Start()
+			require.NoError(t, err)
+			defer s.Close()
+
+			nconn, err := net.Dial("tcp", "localhost:8554")
+			require.NoError(t, err)
+			defer nconn.Close()
+			conn := conn.NewConn(nconn)
+
+			res, err := writeReqReadRes(conn, base.Request{
+				Method: method,
+				URL:    mustParseURL("rtsp://localhost:8554/teststream"),
+				Header: base.Header{
+					"CSeq": base.HeaderValue{"1"},
+				},
+			})
+			require.NoError(t, err)
+			require.Equal(t, base.StatusSessionNotFound, res.StatusCode)
+		})
+	}
+}
+
 func TestServerSessionClose(t *testing.T) {
 	stream := NewServerStream(media.Medias{testH264Media})
 	defer stream.Close()
@@ -1171,3 +1262,387 @@ func TestServerAuth(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, base.StatusOK, res.StatusCode)
 }
+
+func TestServerLimits(t *testing.T) {
+	for _, ca := range []string{
+		"connections",
+		"sessions per ip",
+		"request rate",
+		"unauthenticated",
+		"header size",
+	} {
+		t.Run(ca, func(t *testing.T) {
+			stream := NewServerStream(media.Medias{testH264Media})
+			defer stream.Close()
+
+			rejected := make(chan error, 1)
+
+			s := &Server{
+				Handler: &testServerHandler{
+					onSetup: func(ctx *ServerHandlerOnSetupCtx) (*base.Response, *ServerStream, error) {
+						return &base.Response{
+							StatusCode: base.StatusOK,
+						}, stream, nil
+					},
+					onReject: func(ctx *ServerHandlerOnRejectCtx) {
+						rejected <- ctx.Error
+					},
+				},
+				RTSPAddress: "localhost:8554",
+			}
+
+			switch ca {
+			case "connections":
+				s.MaxConnections = 1
+
+			case "sessions per ip":
+				s.MaxSessionsPerIP = 1
+
+			case "request rate":
+				s.MaxRequestsPerSecond = 2
+
+			case "unauthenticated":
+				s.Auth = &ServerAuth{
+					Credentials: auth.StaticCredentials{"myuser": "mypass"},
+				}
+				s.UnauthenticatedTimeout = 500 * time.Millisecond
+
+			case "header size":
+				s.MaxRequestHeaderSize = 256
+			}
+
+			err := s.Start()
+			require.NoError(t, err)
+			defer s.Close()
+
+			dial := func() *conn.Conn {
+				nconn, err := net.Dial("tcp", "localhost:8554")
+				require.NoError(t, err)
+				t.Cleanup(func() { nconn.Close() })
+				return conn.NewConn(nconn)
+			}
+
+			options := func(conn *conn.Conn, header base.Header) (*base.Response, error) {
+				header["CSeq"] = base.HeaderValue{"1"}
+				return writeReqReadRes(conn, base.Request{
+					Method: base.Options,
+					URL:    mustParseURL("rtsp://localhost:8554/teststream"),
+					Header: header,
+				})
+			}
+
+			setup := func(conn *conn.Conn) (*base.Response, error) {
+				return writeReqReadRes(conn, base.Request{
+					Method: base.Setup,
+					URL: mustParseURL("rtsp://localhost:8554/teststream/mediaUUID=" +
+						stream.streamMedias[testH264Media].uuid.String()),
+					Header: base.Header{
+						"CSeq": base.HeaderValue{"1"},
+						"Transport": headers.Transport{
+							Protocol:       headers.TransportProtocolTCP,
+							InterleavedIDs: &[2]int{0, 1},
+							Delivery: func() *headers.TransportDelivery {
+								v := headers.TransportDeliveryUnicast
+								return &v
+							}(),
+							Mode: func() *headers.TransportMode {
+								v := headers.TransportModePlay
+								return &v
+							}(),
+						}.Marshal(),
+					},
+				})
+			}
+
+			conn1 := dial()
+
+			switch ca {
+			case "connections":
+				res, err := options(conn1, base.Header{})
+				require.NoError(t, err)
+				require.Equal(t, base.StatusOK, res.StatusCode)
+
+				// the response is sent without waiting for a request
+				conn2 := dial()
+				res, err = conn2.ReadResponse()
+				require.NoError(t, err)
+				require.Equal(t, base.StatusServiceUnavailable, res.StatusCode)
+				require.Equal(t, liberrors.ErrServerTooManyConnections{}, <-rejected)
+
+				_, err = conn2.ReadResponse()
+				require.Error(t, err)
+
+			case "sessions per ip":
+				res, err := setup(conn1)
+				require.NoError(t, err)
+				require.Equal(t, base.StatusOK, res.StatusCode)
+
+				res, err = setup(dial())
+				require.NoError(t, err)
+				require.Equal(t, base.StatusNotEnoughBandwidth, res.StatusCode)
+				require.Equal(t, liberrors.ErrServerTooManySessions{IP: net.ParseIP("127.0.0.1").To4()}, <-rejected)
+
+			case "request rate":
+				for i := 0; i < 2; i++ {
+					res, err := options(conn1, base.Header{})
+					require.NoError(t, err)
+					require.Equal(t, base.StatusOK, res.StatusCode)
+				}
+
+				res, err := options(conn1, base.Header{})
+				require.NoError(t, err)
+				require.Equal(t, base.StatusServiceUnavailable, res.StatusCode)
+				require.Equal(t, liberrors.ErrServerRequestRateExceeded{}, <-rejected)
+
+			case "unauthenticated":
+				res, err := options(conn1, base.Header{})
+				require.NoError(t, err)
+				require.Equal(t, base.StatusOK, res.StatusCode)
+
+				require.Equal(t, liberrors.ErrServerUnauthenticatedTimeout{}, <-rejected)
+
+				_, err = options(conn1, base.Header{})
+				require.Error(t, err)
+
+			case "header size":
+				_, err := options(conn1, base.Header{
+					"Testing": base.HeaderValue{strings.Repeat("a", 300)},
+				})
+				require.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestServerShutdown(t *testing.T) {
+	for _, ca := range []string{"drained", "timeout"} {
+		t.Run(ca, func(t *testing.T) {
+			stream := NewServerStream(media.Medias{testH264Media})
+			defer stream.Close()
+
+			s := &Server{
+				Handler: &testServerHandler{
+					onDescribe: func(ctx *ServerHandlerOnDescribeCtx) (*base.Response, *ServerStream, error) {
+						return &base.Response{
+							StatusCode: base.StatusOK,
+						}, stream, nil
+					},
+					onAnnounce: func(ctx *ServerHandlerOnAnnounceCtx) (*base.Response, error) {
+						return &base.Response{
+							StatusCode: base.StatusOK,
+						}, nil
+					},
+					onSetup: func(ctx *ServerHandlerOnSetupCtx) (*base.Response, *ServerStream, error) {
+						if ctx.Session.State() == ServerSessionStatePreRecord {
+							return &base.Response{
+								StatusCode: base.StatusOK,
+							}, nil, nil
+						}
+						return &base.Response{
+							StatusCode: base.StatusOK,
+						}, stream, nil
+					},
+					onPlay: func(ctx *ServerHandlerOnPlayCtx) (*base.Response, error) {
+						return &base.Response{
+							StatusCode: base.StatusOK,
+						}, nil
+					},
+					onRecord: func(ctx *ServerHandlerOnRecordCtx) (*base.Response, error) {
+						return &base.Response{
+							StatusCode: base.StatusOK,
+						}, nil
+					},
+				},
+				RTSPAddress: "localhost:8554",
+			}
+
+			err := s.Start()
+			require.NoError(t, err)
+			defer s.Close()
+
+			publisher := Client{
+				Transport: func() *Transport {
+					v := TransportTCP
+					return &v
+				}(),
+			}
+			err = publisher.StartRecording("rtsp://localhost:8554/recordstream",
+				media.Medias{testH264Media})
+			require.NoError(t, err)
+			defer publisher.Close()
+
+			nconn, err := net.Dial("tcp", "localhost:8554")
+			require.NoError(t, err)
+			defer nconn.Close()
+			conn := conn.NewConn(nconn)
+
+			desc, err := doDescribe(conn)
+			require.NoError(t, err)
+
+			inTH := &headers.Transport{
+				Delivery: func() *headers.TransportDelivery {
+					v := headers.TransportDeliveryUnicast
+					return &v
+				}(),
+				Mode: func() *headers.TransportMode {
+					v := headers.TransportModePlay
+					return &v
+				}(),
+				Protocol:       headers.TransportProtocolTCP,
+				InterleavedIDs: &[2]int{0, 1},
+			}
+
+			res, err := writeReqReadRes(conn, base.Request{
+				Method: base.Setup,
+				URL:    mustParseURL(absoluteControlAttribute(desc.MediaDescriptions[0])),
+				Header: base.Header{
+					"CSeq":      base.HeaderValue{"2"},
+					"Transport": inTH.Marshal(),
+				},
+			})
+			require.NoError(t, err)
+			require.Equal(t, base.StatusOK, res.StatusCode)
+
+			var sx headers.Session
+			err = sx.Unmarshal(res.Header["Session"])
+			require.NoError(t, err)
+
+			res, err = writeReqReadRes(conn, base.Request{
+				Method: base.Play,
+				URL:    mustParseURL("rtsp://localhost:8554/teststream"),
+				Header: base.Header{
+					"CSeq":    base.HeaderValue{"3"},
+					"Session": base.HeaderValue{sx.Session},
+				},
+			})
+			require.NoError(t, err)
+			require.Equal(t, base.StatusOK, res.StatusCode)
+
+			shutdownDone := make(chan error)
+			go func() {
+				ctx, ctxCancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+				defer ctxCancel()
+				shutdownDone <- s.Shutdown(ctx)
+			}()
+
+			// readers receive a TEARDOWN request
+			for {
+				what, err := conn.ReadInterleavedFrameOrRequest()
+				require.NoError(t, err)
+
+				if req, ok := what.(*base.Request); ok {
+					require.Equal(t, base.Teardown, req.Method)
+					require.Equal(t, base.HeaderValue{sx.Session}, req.Header["Session"])
+					break
+				}
+			}
+
+			_, err = conn.ReadInterleavedFrameOrRequest()
+			require.Error(t, err)
+
+			// new connections are not accepted
+			_, err = net.Dial("tcp", "localhost:8554")
+			require.Error(t, err)
+
+			if ca == "drained" {
+				// the publisher is still connected and can finish its recording
+				err = publisher.WritePacketRTP(testH264Media, &rtp.Packet{
+					Header: rtp.Header{
+						Version:     2,
+						PayloadType: 96,
+						SSRC:        96342362,
+					},
+					Payload: []byte{0x05, 0x01},
+				})
+				require.NoError(t, err)
+
+				publisher.Close()
+				require.NoError(t, <-shutdownDone)
+			} else {
+				require.Equal(t, context.DeadlineExceeded, <-shutdownDone)
+				require.Error(t, publisher.Wait())
+			}
+		})
+	}
+}
+
+func TestServerMultipleListeners(t *testing.T) {
+	stream := NewServerStream(media.Medias{testH264Media})
+	defer stream.Close()
+
+	cert, err := tls.X509KeyPair(serverCert, serverKey)
+	require.NoError(t, err)
+
+	var setupListeners []*ServerListener
+
+	s := &Server{
+		Handler: &testServerHandler{
+			onDescribe: func(ctx *ServerHandlerOnDescribeCtx) (*base.Response, *ServerStream, error) {
+				return &base.Response{
+					StatusCode: base.StatusOK,
+				}, stream, nil
+			},
+			onSetup: func(ctx *ServerHandlerOnSetupCtx) (*base.Response, *ServerStream, error) {
+				require.Equal(t, ctx.Conn.Listener(), ctx.Session.Listener())
+				setupListeners = append(setupListeners, ctx.Session.Listener())
+				return &base.Response{
+					StatusCode: base.StatusOK,
+				}, stream, nil
+			},
+			onPlay: func(ctx *ServerHandlerOnPlayCtx) (*base.Response, error) {
+				return &base.Response{
+					StatusCode: base.StatusOK,
+				}, nil
+			},
+		},
+		RTSPAddress:    "127.0.0.1:8554",
+		UDPRTPAddress:  "127.0.0.1:8000",
+		UDPRTCPAddress: "127.0.0.1:8001",
+		Listeners: []ServerListener{
+			{
+				RTSPAddress: "127.0.0.1:8322",
+				TLSConfig:   &tls.Config{Certificates: []tls.Certificate{cert}},
+			},
+			{
+				RTSPAddress:    "[::1]:8554",
+				UDPRTPAddress:  "[::1]:8000",
+				UDPRTCPAddress: "[::1]:8001",
+			},
+		},
+	}
+
+	err = s.Start()
+	require.NoError(t, err)
+	defer s.Close()
+
+	for _, ca := range []struct {
+		url       string
+		transport Transport
+	}{
+		{"rtsp://127.0.0.1:8554/teststream", TransportUDP},
+		{"rtsps://127.0.0.1:8322/teststream", TransportTCP},
+		{"rtsp://[::1]:8554/teststream", TransportUDP},
+	} {
+		c := Client{
+			TLSConfig: &tls.Config{
+				InsecureSkipVerify: true,
+			},
+			Transport: &ca.transport,
+		}
+
+		err := readAll(&c, ca.url, nil)
+		require.NoError(t, err)
+		c.Close()
+	}
+
+	require.Equal(t, []*ServerListener{
+		{
+			RTSPAddress:    "127.0.0.1:8554",
+			UDPRTPAddress:  "127.0.0.1:8000",
+			UDPRTCPAddress: "127.0.0.1:8001",
+		},
+		&s.Listeners[0],
+		&s.Listeners[1],
+	}, setupListeners)
+	require.Same(t, &s.Listeners[0], setupListeners[1])
+}
@@ -209,6 +209,8 @@ func (u *serverUDPListener) runReader() {
 				return
 			}
 
+			sm.ss.capture.writeUDP(false, u.port(), addr, u.isRTP, buf[:n])
+
 			readFunc(sm, buf[:n])
 		}()
 	}
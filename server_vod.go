@@ -0,0 +1,576 @@
+package gortsplib
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+
+	"github.com/bluenviron/gortsplib/v3/pkg/base"
+	"github.com/bluenviron/gortsplib/v3/pkg/headers"
+	"github.com/bluenviron/gortsplib/v3/pkg/media"
+	"github.com/bluenviron/gortsplib/v3/pkg/url"
+)
+
+// ServerVODSource is a source of packets of an on-demand stream,
+// like a recording.
+// A reference implementation, that reads MPEG-TS files, is available in pkg/mpegtssource.
+type ServerVODSource interface {
+	// Medias returns the medias of the source.
+	Medias() media.Medias
+
+	// Duration returns the duration of the source.
+	Duration() time.Duration
+
+	// Seek moves the read position to the random access point that precedes pos,
+	// and returns the position of that point.
+	Seek(pos time.Duration) (time.Duration, error)
+
+	// ReadPacket reads the next packet, together with its media and its position,
+	// that is the time at which the packet must be sent, relative to the beginning of the source.
+	// Packets whose position precedes the one of the previous packet are sent immediately.
+	// At the end of the source, io.EOF is returned.
+	ReadPacket() (*media.Media, *rtp.Packet, time.Duration, error)
+
+	// Close closes the source.
+	Close() error
+}
+
+type serverVODPacket struct {
+	media *media.Media
+	pkt   *rtp.Packet
+	pos   time.Duration
+}
+
+// ServerVOD is an on-demand stream, that is owned by a single session.
+// It reads packets from a ServerVODSource and sends them to the session
+// with the same pace they were recorded.
+//
+// A ServerVOD must be started in OnSetup, associated to the session and its
+// stream returned; PLAY requests must be passed to ServerVOD.OnPlay, that
+// positions the stream according to the Range, Scale and Speed headers.
+// With negative Scale values, keyframes of video medias are sent backwards.
+// Reading is paused by PAUSE requests and resumed by PLAY requests without Range.
+// When the end of the source is reached, a RTCP BYE packet is sent to the client.
+// The UDP-multicast transport protocol is not supported.
+type ServerVOD struct {
+	// source of packets. It is mandatory.
+	Source ServerVODSource
+
+	// stream returned by OnDescribe for the same path.
+	// Since clients set up medias by using the control attributes
+	// returned in the DESCRIBE response, these are copied from this stream.
+	// Its medias must be in the same number and order of the ones of Source.
+	DescribeStream *ServerStream
+
+	// called when the end of the source is reached.
+	OnEnd func()
+
+	stream *ServerStream
+
+	// fields that are accessed by a single routine at a time,
+	// either OnPlay() or run().
+	pending     []serverVODPacket
+	rate        float64
+	ended       bool
+	reversed    bool
+	reverseNext time.Duration
+	lastSSRCs   map[*media.Media]uint32
+
+	mutex     sync.Mutex
+	ctxCancel func()
+	done      chan struct{}
+}
+
+// Start starts the ServerVOD.
+func (v *ServerVOD) Start() error {
+	if v.Source == nil {
+		return fmt.Errorf("Source must be provided")
+	}
+
+	medias := v.Source.Medias()
+	st := NewServerStream(medias)
+
+	if v.DescribeStream != nil {
+		if len(v.DescribeStream.medias) != len(medias) {
+			st.Close()
+			return fmt.Errorf("medias of DescribeStream and Source do not match")
+		}
+
+		for i, medi := range medias {
+			st.streamMedias[medi].uuid = v.DescribeStream.streamMedias[v.DescribeStream.medias[i]].uuid
+		}
+	}
+
+	st.vod = v
+	v.stream = st
+	v.rate = 1
+	v.lastSSRCs = make(map[*media.Media]uint32)
+
+	return nil
+}
+
+// Close closes the ServerVOD and its source.
+func (v *ServerVOD) Close() error {
+	v.stop()
+	v.stream.Close()
+	return v.Source.Close()
+}
+
+// Stream returns the stream that must be returned by OnSetup.
+func (v *ServerVOD) Stream() *ServerStream {
+	return v.stream
+}
+
+// OnPlay positions the stream according to a PLAY request.
+// It must be called inside ServerHandlerOnPlay.OnPlay, and the
+// returned response must be sent to the client.
+func (v *ServerVOD) OnPlay(ctx *ServerHandlerOnPlayCtx) (*base.Response, error) {
+	var ra *headers.Range
+	if h, ok := ctx.Request.Header["Range"]; ok {
+		var tmp headers.Range
+		err := tmp.Unmarshal(h)
+		if err != nil {
+			return &base.Response{
+				StatusCode: base.StatusBadRequest,
+			}, err
+		}
+		ra = &tmp
+	}
+
+	rate := float64(1)
+	if ctx.Scale != nil {
+		rate *= ctx.Scale.Value
+	}
+	if ctx.Speed != nil {
+		rate *= ctx.Speed.Value
+	}
+
+	var npt *headers.RangeNPT
+	if ra != nil {
+		var ok bool
+		npt, ok = ra.Value.(*headers.RangeNPT)
+		if !ok || npt.Start > v.Source.Duration() {
+			return &base.Response{
+				StatusCode: base.StatusInvalidRange,
+			}, nil
+		}
+	}
+
+	v.stop()
+
+	var err error
+	if rate > 0 {
+		err = v.positionForward(npt)
+	} else {
+		err = v.positionReverse(npt)
+	}
+	if err != nil {
+		return &base.Response{
+			StatusCode: base.StatusInternalServerError,
+		}, err
+	}
+
+	v.rate = rate
+
+	res := &base.Response{
+		StatusCode: base.StatusOK,
+		Header:     make(base.Header),
+	}
+
+	resRange := &headers.RangeNPT{
+		Start: v.position(),
+	}
+	if rate > 0 {
+		duration := v.Source.Duration()
+		resRange.End = &duration
+	} else {
+		var zero time.Duration
+		resRange.End = &zero
+	}
+
+	res.Header["Range"] = headers.Range{
+		Value: resRange,
+	}.Marshal()
+
+	// Scale and Speed are both honored
+	if ctx.Scale != nil {
+		res.Header["Scale"] = ctx.Scale.Marshal()
+	}
+	if ctx.Speed != nil {
+		res.Header["Speed"] = ctx.Speed.Marshal()
+	}
+
+	if ri := v.rtpInfo(ctx); len(ri) != 0 {
+		res.Header["RTP-Info"] = ri.Marshal()
+	}
+
+	// when the session is not playing yet, reading is started
+	// when the session becomes an active reader of the stream.
+	if ctx.Session.State() == ServerSessionStatePlay {
+		v.start()
+	}
+
+	return res, nil
+}
+
+// position returns the position of the next packet.
+func (v *ServerVOD) position() time.Duration {
+	switch {
+	case len(v.pending) != 0:
+		return v.pending[0].pos
+
+	case v.ended && v.reversed:
+		return 0
+
+	case v.ended:
+		return v.Source.Duration()
+
+	case v.reversed:
+		return v.reverseNext
+	}
+
+	return 0
+}
+
+func (v *ServerVOD) seek(pos time.Duration) error {
+	_, err := v.Source.Seek(pos)
+	if err != nil {
+		return err
+	}
+
+	v.pending = nil
+	v.ended = false
+	return nil
+}
+
+// positionForward prepares forward playback from the requested position,
+// or from the current position.
+func (v *ServerVOD) positionForward(npt *headers.RangeNPT) error {
+	switch {
+	case npt != nil:
+		err := v.seek(npt.Start)
+		if err != nil {
+			return err
+		}
+
+	// the source has been used to read keyframes backwards
+	case v.reversed:
+		err := v.seek(v.position())
+		if err != nil {
+			return err
+		}
+	}
+
+	v.reversed = false
+	return v.fillPending()
+}
+
+// positionReverse prepares reverse playback from the keyframe that precedes
+// the requested position, or the current position.
+func (v *ServerVOD) positionReverse(npt *headers.RangeNPT) error {
+	var pos time.Duration
+	if npt != nil {
+		pos = npt.Start
+	} else {
+		pos = v.position()
+	}
+
+	v.pending = nil
+	v.ended = false
+	v.reversed = true
+
+	ok, err := v.readKeyframeBefore(pos + 1)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		v.ended = true
+	}
+
+	return nil
+}
+
+// readKeyframeBefore reads the packets of the last keyframe whose position
+// is lower than pos. Only packets of video medias are kept, since other medias
+// can't be played backwards.
+func (v *ServerVOD) readKeyframeBefore(pos time.Duration) (bool, error) {
+	if pos <= 0 {
+		return false, nil
+	}
+
+	kfPos, err := v.Source.Seek(pos - 1)
+	if err != nil {
+		return false, err
+	}
+
+	if kfPos >= pos {
+		return false, nil
+	}
+
+	hasVideo := false
+	for _, medi := range v.stream.medias {
+		if medi.Type == media.TypeVideo {
+			hasVideo = true
+			break
+		}
+	}
+
+	v.pending = nil
+
+	for {
+		medi, pkt, pktPos, err := v.Source.ReadPacket()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return false, err
+		}
+
+		isVideo := !hasVideo || medi.Type == media.TypeVideo
+
+		// the keyframe is over
+		if (isVideo && pktPos > kfPos) || pktPos > (kfPos+time.Second) {
+			break
+		}
+
+		if isVideo && pktPos == kfPos {
+			v.pending = append(v.pending, serverVODPacket{
+				media: medi,
+				pkt:   pkt,
+				pos:   pktPos,
+			})
+		}
+	}
+
+	v.reverseNext = kfPos
+	return true, nil
+}
+
+// fillPending reads packets until there's at least one packet for each media,
+// in order to fill RTP-Info.
+func (v *ServerVOD) fillPending() error {
+	if v.ended {
+		return nil
+	}
+
+	found := make(map[*media.Media]struct{})
+	for _, p := range v.pending {
+		found[p.media] = struct{}{}
+	}
+
+	for len(found) != len(v.stream.medias) {
+		// do not read too far
+		if len(v.pending) != 0 && (v.pending[len(v.pending)-1].pos-v.pending[0].pos) > time.Second {
+			break
+		}
+
+		medi, pkt, pos, err := v.Source.ReadPacket()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+
+		v.pending = append(v.pending, serverVODPacket{
+			media: medi,
+			pkt:   pkt,
+			pos:   pos,
+		})
+		found[medi] = struct{}{}
+	}
+
+	return nil
+}
+
+func (v *ServerVOD) rtpInfo(ctx *ServerHandlerOnPlayCtx) headers.RTPInfo {
+	var ri headers.RTPInfo
+
+	for _, medi := range v.stream.medias {
+		for _, p := range v.pending {
+			if p.media == medi {
+				entry := newRTPInfoEntry(medi, p.pkt.SequenceNumber, p.pkt.Timestamp)
+				if entry != nil {
+					entry.URL = (&url.URL{
+						Scheme: ctx.Request.URL.Scheme,
+						Host:   ctx.Request.URL.Host,
+						Path:   ctx.Path + "/mediaUUID=" + v.stream.streamMedias[medi].uuid.String(),
+					}).String()
+					ri = append(ri, entry)
+				}
+				break
+			}
+		}
+	}
+
+	return ri
+}
+
+// start starts reading.
+// It is called by OnPlay() or by the stream, when the session becomes an active reader.
+func (v *ServerVOD) start() {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	if v.ctxCancel != nil {
+		v.ctxCancel()
+	}
+
+	ctx, ctxCancel := context.WithCancel(context.Background())
+	prevDone := v.done
+	done := make(chan struct{})
+
+	v.ctxCancel = ctxCancel
+	v.done = done
+
+	go v.run(ctx, prevDone, done)
+}
+
+// stopAsync stops reading without waiting.
+// It is called by the stream when the session stops being an active reader.
+func (v *ServerVOD) stopAsync() {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	if v.ctxCancel != nil {
+		v.ctxCancel()
+		v.ctxCancel = nil
+	}
+}
+
+func (v *ServerVOD) stop() {
+	v.mutex.Lock()
+	if v.ctxCancel != nil {
+		v.ctxCancel()
+		v.ctxCancel = nil
+	}
+	done := v.done
+	v.done = nil
+	v.mutex.Unlock()
+
+	if done != nil {
+		<-done
+	}
+}
+
+func (v *ServerVOD) run(ctx context.Context, prevDone chan struct{}, done chan struct{}) {
+	defer close(done)
+
+	// wait until the previous routine has released the source.
+	if prevDone != nil {
+		<-prevDone
+	}
+
+	var startTime time.Time
+	var startPos time.Duration
+
+	for {
+		if len(v.pending) == 0 {
+			if v.ended {
+				return
+			}
+
+			if v.reversed {
+				ok, err := v.readKeyframeBefore(v.reverseNext)
+				if err != nil {
+					return
+				}
+
+				if !ok {
+					v.ended = true
+					v.end(ctx)
+					return
+				}
+				continue
+			}
+
+			medi, pkt, pos, err := v.Source.ReadPacket()
+			if err != nil {
+				if err == io.EOF {
+					v.ended = true
+					v.end(ctx)
+				}
+				return
+			}
+
+			v.pending = append(v.pending, serverVODPacket{
+				media: medi,
+				pkt:   pkt,
+				pos:   pos,
+			})
+		}
+
+		p := v.pending[0]
+
+		if startTime.IsZero() {
+			startTime = time.Now()
+			startPos = p.pos
+		}
+
+		ntp := startTime.Add(time.Duration(float64(p.pos-startPos) / v.rate))
+		d := time.Until(ntp)
+
+		// the reader is too slow, reset timing
+		if d < -time.Second {
+			startTime = time.Now()
+			startPos = p.pos
+			ntp = startTime
+			d = 0
+		}
+
+		if d > 0 {
+			t := time.NewTimer(d)
+			select {
+			case <-t.C:
+			case <-ctx.Done():
+				t.Stop()
+				return
+			}
+		}
+
+		if !v.writePacketRTP(ctx, p.media, p.pkt, ntp) {
+			return
+		}
+
+		v.lastSSRCs[p.media] = p.pkt.SSRC
+
+		v.pending[0] = serverVODPacket{}
+		v.pending = v.pending[1:]
+	}
+}
+
+// writePacketRTP writes a packet, unless reading has been stopped.
+// This is performed with the stream mutex locked, since the stream stops reading
+// while holding the same mutex, and therefore packets are never lost.
+func (v *ServerVOD) writePacketRTP(ctx context.Context, medi *media.Media, pkt *rtp.Packet, ntp time.Time) bool {
+	st := v.stream
+
+	st.mutex.RLock()
+	defer st.mutex.RUnlock()
+
+	if st.closed || ctx.Err() != nil {
+		return false
+	}
+
+	st.streamMedias[medi].WritePacketRTPWithNTP(st, pkt, ntp)
+	return true
+}
+
+// end notifies the client that the stream has ended.
+func (v *ServerVOD) end(ctx context.Context) {
+	for medi, ssrc := range v.lastSSRCs {
+		v.stream.WritePacketRTCP(medi, &rtcp.Goodbye{
+			Sources: []uint32{ssrc},
+		})
+	}
+
+	if v.OnEnd != nil && ctx.Err() == nil {
+		v.OnEnd()
+	}
+}
@@ -0,0 +1,296 @@
+package gortsplib
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/gortsplib/v3/pkg/base"
+	"github.com/bluenviron/gortsplib/v3/pkg/conn"
+	"github.com/bluenviron/gortsplib/v3/pkg/formats"
+	"github.com/bluenviron/gortsplib/v3/pkg/headers"
+	"github.com/bluenviron/gortsplib/v3/pkg/media"
+)
+
+// testVODSource contains 10 packets, one every 100ms,
+// with a random access point every 500ms.
+type testVODSource struct {
+	medi *media.Media
+	next int
+}
+
+func newTestVODSource() *testVODSource {
+	return &testVODSource{
+		medi: &media.Media{
+			Type:    media.TypeVideo,
+			Formats: []formats.Format{testH264Media.Formats[0]},
+		},
+	}
+}
+
+func (s *testVODSource) Medias() media.Medias {
+	return media.Medias{s.medi}
+}
+
+func (s *testVODSource) Duration() time.Duration {
+	return 1 * time.Second
+}
+
+func (s *testVODSource) Seek(pos time.Duration) (time.Duration, error) {
+	s.next = int(pos/(500*time.Millisecond)) * 5
+	return time.Duration(s.next) * 100 * time.Millisecond, nil
+}
+
+func (s *testVODSource) ReadPacket() (*media.Media, *rtp.Packet, time.Duration, error) {
+	if s.next >= 10 {
+		return nil, nil, 0, io.EOF
+	}
+
+	i := s.next
+	s.next++
+
+	return s.medi, &rtp.Packet{
+		Header: rtp.Header{
+			Version:        2,
+			PayloadType:    96,
+			SequenceNumber: uint16(100 + i),
+			Timestamp:      uint32(i * 9000),
+			SSRC:           96342362,
+		},
+		Payload: []byte{0x01, 0x02, 0x03, 0x04},
+	}, time.Duration(i) * 100 * time.Millisecond, nil
+}
+
+func (s *testVODSource) Close() error {
+	return nil
+}
+
+func TestServerVOD(t *testing.T) {
+	describeStream := NewServerStream(newTestVODSource().Medias())
+	defer describeStream.Close()
+
+	ended := make(chan struct{}, 2)
+
+	s := &Server{
+		Handler: &testServerHandler{
+			onSessionClose: func(ctx *ServerHandlerOnSessionCloseCtx) {
+				if vod, ok := ctx.Session.UserData().(*ServerVOD); ok {
+					vod.Close()
+				}
+			},
+			onDescribe: func(ctx *ServerHandlerOnDescribeCtx) (*base.Response, *ServerStream, error) {
+				return &base.Response{
+					StatusCode: base.StatusOK,
+				}, describeStream, nil
+			},
+			onSetup: func(ctx *ServerHandlerOnSetupCtx) (*base.Response, *ServerStream, error) {
+				vod, ok := ctx.Session.UserData().(*ServerVOD)
+				if !ok {
+					vod = &ServerVOD{
+						Source:         newTestVODSource(),
+						DescribeStream: describeStream,
+						OnEnd: func() {
+							ended <- struct{}{}
+						},
+					}
+					err := vod.Start()
+					require.NoError(t, err)
+					ctx.Session.SetUserData(vod)
+				}
+
+				return &base.Response{
+					StatusCode: base.StatusOK,
+				}, vod.Stream(), nil
+			},
+			onPlay: func(ctx *ServerHandlerOnPlayCtx) (*base.Response, error) {
+				return ctx.Session.UserData().(*ServerVOD).OnPlay(ctx)
+			},
+			onPause: func(ctx *ServerHandlerOnPauseCtx) (*base.Response, error) {
+				return &base.Response{
+					StatusCode: base.StatusOK,
+				}, nil
+			},
+		},
+		RTSPAddress: "localhost:8554",
+	}
+
+	err := s.Start()
+	require.NoError(t, err)
+	defer s.Close()
+
+	nconn, err := net.Dial("tcp", "localhost:8554")
+	require.NoError(t, err)
+	defer nconn.Close()
+	conn := conn.NewConn(nconn)
+
+	desc, err := doDescribe(conn)
+	require.NoError(t, err)
+
+	inTH := &headers.Transport{
+		Delivery: func() *headers.TransportDelivery {
+			v := headers.TransportDeliveryUnicast
+			return &v
+		}(),
+		Mode: func() *headers.TransportMode {
+			v := headers.TransportModePlay
+			return &v
+		}(),
+		Protocol:       headers.TransportProtocolTCP,
+		InterleavedIDs: &[2]int{0, 1},
+	}
+
+	res, err := writeReqReadRes(conn, base.Request{
+		Method: base.Setup,
+		URL:    mustParseURL(absoluteControlAttribute(desc.MediaDescriptions[0])),
+		Header: base.Header{
+			"CSeq":      base.HeaderValue{"2"},
+			"Transport": inTH.Marshal(),
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, base.StatusOK, res.StatusCode)
+
+	var sx headers.Session
+	err = sx.Unmarshal(res.Header["Session"])
+	require.NoError(t, err)
+
+	var seqNums []uint16
+
+	// writes a request and reads its response, saving received packets.
+	// reading stops when a RTCP BYE is received if bye is true.
+	request := func(method base.Method, header base.Header, bye bool) *base.Response {
+		header["CSeq"] = base.HeaderValue{"3"}
+		header["Session"] = base.HeaderValue{sx.Session}
+
+		err := conn.WriteRequest(&base.Request{
+			Method: method,
+			URL:    mustParseURL("rtsp://localhost:8554/teststream"),
+			Header: header,
+		})
+		require.NoError(t, err)
+
+		var res *base.Response
+
+		for res == nil || bye {
+			what, err := conn.ReadInterleavedFrameOrResponse()
+			require.NoError(t, err)
+
+			switch what := what.(type) {
+			case *base.Response:
+				res = &base.Response{}
+				*res = *what
+
+			case *base.InterleavedFrame:
+				if what.Channel == 0 {
+					var pkt rtp.Packet
+					err := pkt.Unmarshal(what.Payload)
+					require.NoError(t, err)
+					seqNums = append(seqNums, pkt.SequenceNumber)
+				} else {
+					pkts, err := rtcp.Unmarshal(what.Payload)
+					require.NoError(t, err)
+					for _, pkt := range pkts {
+						if _, ok := pkt.(*rtcp.Goodbye); ok && res != nil {
+							bye = false
+						}
+					}
+				}
+			}
+		}
+
+		return res
+	}
+
+	// seek and increase speed
+	start := time.Now()
+
+	res = request(base.Play, base.Header{
+		"Range": headers.Range{
+			Value: &headers.RangeNPT{
+				Start: 600 * time.Millisecond,
+			},
+		}.Marshal(),
+		"Scale": base.HeaderValue{"2"},
+	}, true)
+	require.Equal(t, base.StatusOK, res.StatusCode)
+	require.Equal(t, base.HeaderValue{"2"}, res.Header["Scale"])
+
+	var ra headers.Range
+	err = ra.Unmarshal(res.Header["Range"])
+	require.NoError(t, err)
+	end := 1 * time.Second
+	require.Equal(t, &headers.RangeNPT{Start: 500 * time.Millisecond, End: &end}, ra.Value)
+
+	var ri headers.RTPInfo
+	err = ri.Unmarshal(res.Header["RTP-Info"])
+	require.NoError(t, err)
+	require.Equal(t, uint16(105), *ri[0].SequenceNumber)
+	require.Equal(t, uint32(45000), *ri[0].Timestamp)
+
+	require.Equal(t, []uint16{105, 106, 107, 108, 109}, seqNums)
+	elapsed := time.Since(start)
+	require.GreaterOrEqual(t, elapsed, 150*time.Millisecond)
+	require.Less(t, elapsed, 400*time.Millisecond)
+
+	<-ended
+
+	// play from the beginning, pause and resume
+	seqNums = nil
+
+	res = request(base.Play, base.Header{
+		"Range": headers.Range{
+			Value: &headers.RangeNPT{},
+		}.Marshal(),
+	}, false)
+	require.Equal(t, base.StatusOK, res.StatusCode)
+
+	time.Sleep(250 * time.Millisecond)
+
+	res = request(base.Pause, base.Header{}, false)
+	require.Equal(t, base.StatusOK, res.StatusCode)
+
+	res = request(base.Play, base.Header{}, true)
+	require.Equal(t, base.StatusOK, res.StatusCode)
+
+	require.Equal(t, []uint16{100, 101, 102, 103, 104, 105, 106, 107, 108, 109}, seqNums)
+
+	<-ended
+
+	// rewind from the second keyframe
+	seqNums = nil
+
+	res = request(base.Play, base.Header{
+		"Range": headers.Range{
+			Value: &headers.RangeNPT{
+				Start: 900 * time.Millisecond,
+			},
+		}.Marshal(),
+		"Scale": headers.Scale{Value: -2}.Marshal(),
+	}, true)
+	require.Equal(t, base.StatusOK, res.StatusCode)
+	require.Equal(t, base.HeaderValue{"-2"}, res.Header["Scale"])
+
+	err = ra.Unmarshal(res.Header["Range"])
+	require.NoError(t, err)
+	zero := time.Duration(0)
+	require.Equal(t, &headers.RangeNPT{Start: 500 * time.Millisecond, End: &zero}, ra.Value)
+
+	require.Equal(t, []uint16{105, 100}, seqNums)
+
+	<-ended
+
+	// invalid range
+	res = request(base.Play, base.Header{
+		"Range": headers.Range{
+			Value: &headers.RangeNPT{
+				Start: 2 * time.Second,
+			},
+		}.Marshal(),
+	}, false)
+	require.Equal(t, base.StatusInvalidRange, res.StatusCode)
+}
@@ -0,0 +1,118 @@
+package gortsplib
+
+import (
+	"net"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v3/pkg/capture"
+)
+
+func addrIPPort(addr net.Addr) (net.IP, int) {
+	switch addr := addr.(type) {
+	case *net.TCPAddr:
+		return addr.IP, addr.Port
+	case *net.UDPAddr:
+		return addr.IP, addr.Port
+	}
+	return net.IPv4zero, 0
+}
+
+// sessionCapture writes RTSP messages, interleaved frames and UDP packets
+// of a session into a capture.Writer.
+// All methods can be called on a nil sessionCapture, and do nothing.
+type sessionCapture struct {
+	w       capture.Writer
+	localIP net.IP
+}
+
+func newSessionCapture(w capture.Writer, nconn net.Conn) *sessionCapture {
+	if w == nil {
+		return nil
+	}
+
+	localIP, _ := addrIPPort(nconn.LocalAddr())
+
+	return &sessionCapture{
+		w:       w,
+		localIP: localIP,
+	}
+}
+
+func (sc *sessionCapture) write(nconn net.Conn, outgoing bool, pkt *capture.Packet) {
+	localIP, localPort := addrIPPort(nconn.LocalAddr())
+	remoteIP, remotePort := addrIPPort(nconn.RemoteAddr())
+
+	if outgoing {
+		pkt.SrcIP, pkt.SrcPort, pkt.DstIP, pkt.DstPort = localIP, localPort, remoteIP, remotePort
+	} else {
+		pkt.SrcIP, pkt.SrcPort, pkt.DstIP, pkt.DstPort = remoteIP, remotePort, localIP, localPort
+	}
+
+	// errors are ignored, since the capture must not interfere with the session
+	sc.w.WritePacket(pkt)
+}
+
+// writeRTSP writes a request or a response.
+func (sc *sessionCapture) writeRTSP(nconn net.Conn, outgoing bool, msg interface{ Marshal() ([]byte, error) }) {
+	if sc == nil {
+		return
+	}
+
+	byts, err := msg.Marshal()
+	if err != nil {
+		return
+	}
+
+	sc.write(nconn, outgoing, &capture.Packet{
+		Time:     time.Now(),
+		Protocol: capture.ProtocolTCP,
+		Content:  capture.ContentRTSP,
+		Payload:  byts,
+	})
+}
+
+// writeInterleavedFrame writes a RTP or RTCP packet sent or received through TCP.
+func (sc *sessionCapture) writeInterleavedFrame(nconn net.Conn, outgoing bool, channel int, payload []byte) {
+	if sc == nil {
+		return
+	}
+
+	content := capture.ContentRTP
+	if (channel % 2) != 0 {
+		content = capture.ContentRTCP
+	}
+
+	sc.write(nconn, outgoing, &capture.Packet{
+		Time:     time.Now(),
+		Protocol: capture.ProtocolTCP,
+		Content:  content,
+		Channel:  channel,
+		Payload:  payload,
+	})
+}
+
+// writeUDP writes a RTP or RTCP packet sent or received through UDP.
+func (sc *sessionCapture) writeUDP(outgoing bool, localPort int, remote *net.UDPAddr, isRTP bool, payload []byte) {
+	if sc == nil {
+		return
+	}
+
+	pkt := &capture.Packet{
+		Time:     time.Now(),
+		Protocol: capture.ProtocolUDP,
+		Content:  capture.ContentRTP,
+		Payload:  payload,
+	}
+
+	if !isRTP {
+		pkt.Content = capture.ContentRTCP
+	}
+
+	if outgoing {
+		pkt.SrcIP, pkt.SrcPort, pkt.DstIP, pkt.DstPort = sc.localIP, localPort, remote.IP, remote.Port
+	} else {
+		pkt.SrcIP, pkt.SrcPort, pkt.DstIP, pkt.DstPort = remote.IP, remote.Port, sc.localIP, localPort
+	}
+
+	sc.w.WritePacket(pkt)
+}
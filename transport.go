@@ -23,3 +23,24 @@ func (t Transport) String() string {
 	}
 	return "unknown"
 }
+
+// TransportFallback is a set of conditions that allow the client to switch
+// to the next transport protocol of Client.TransportPreference.
+type TransportFallback int
+
+// transport fallback conditions.
+const (
+	// the server replied to a SETUP request with 461 Unsupported Transport.
+	TransportFallbackUnsupportedTransport TransportFallback = 1 << iota
+
+	// the server replied to a UDP SETUP request with a TCP transport.
+	TransportFallbackServerRequest
+
+	// no packets were received within Client.InitialUDPReadTimeout.
+	TransportFallbackNoPackets
+
+	// all conditions.
+	TransportFallbackAll = TransportFallbackUnsupportedTransport |
+		TransportFallbackServerRequest |
+		TransportFallbackNoPackets
+)
@@ -0,0 +1,36 @@
+package gortsplib
+
+// WriteQueuePolicy is the policy applied when the write queue of a session
+// or of a client is full, that happens when the network or the other party
+// is slower than the writer.
+type WriteQueuePolicy int
+
+// write queue policies.
+const (
+	// discard the packet that can't be queued and the following RTP packets
+	// of the same media, until a packet that starts a keyframe is found,
+	// in order not to send frames that can't be decoded.
+	// Medias without keyframes resume with the next packet.
+	WriteQueuePolicyDropUntilKeyframe WriteQueuePolicy = iota
+
+	// close the session or the client.
+	WriteQueuePolicyDisconnect
+
+	// wait until there's space in the queue.
+	// When serving a ServerStream, this slows down all its readers.
+	WriteQueuePolicyBlock
+)
+
+var writeQueuePolicyLabels = map[WriteQueuePolicy]string{
+	WriteQueuePolicyDropUntilKeyframe: "drop until keyframe",
+	WriteQueuePolicyDisconnect:        "disconnect",
+	WriteQueuePolicyBlock:             "block",
+}
+
+// String implements fmt.Stringer.
+func (p WriteQueuePolicy) String() string {
+	if l, ok := writeQueuePolicyLabels[p]; ok {
+		return l
+	}
+	return "unknown"
+}
@@ -1,12 +1,18 @@
 package gortsplib
 
 import (
+	"sync/atomic"
+
+	"github.com/pion/rtp"
+
+	"github.com/bluenviron/gortsplib/v3/pkg/media"
 	"github.com/bluenviron/gortsplib/v3/pkg/ringbuffer"
 )
 
 // this struct contains a queue that allows to detach the routine that is reading a stream
 // from the routine that is writing a stream.
 type writer struct {
+	policy  WriteQueuePolicy
 	running bool
 	buffer  *ringbuffer.RingBuffer
 
@@ -28,6 +34,9 @@ func (w *writer) stop() {
 		w.buffer.Close()
 		<-w.done
 		w.running = false
+	} else if w.buffer != nil {
+		// unblock routines that are waiting for space in the queue.
+		w.buffer.Close()
 	}
 }
 
@@ -44,6 +53,59 @@ func (w *writer) run() {
 	}
 }
 
-func (w *writer) queue(cb func()) {
-	w.buffer.Push(cb)
+// queue returns false when the queue is full and the callback has been discarded.
+func (w *writer) queue(cb func()) bool {
+	if w.policy == WriteQueuePolicyBlock {
+		w.buffer.PushWait(cb)
+		return true
+	}
+
+	return w.buffer.TryPush(cb)
+}
+
+// writerDropper discards the RTP packets of a media after a write queue overflow,
+// until a packet that starts a keyframe is found.
+type writerDropper struct {
+	isKeyframe map[uint8]func(*rtp.Packet) bool
+	dropping   uint32
+}
+
+func newWriterDropper(medi *media.Media) *writerDropper {
+	d := &writerDropper{
+		isKeyframe: make(map[uint8]func(*rtp.Packet) bool),
+	}
+
+	for _, forma := range medi.Formats {
+		d.isKeyframe[forma.PayloadType()] = gopCacheKeyframeFunc(forma)
+	}
+
+	return d
+}
+
+// start returns false if packets were already being dropped.
+func (d *writerDropper) start() bool {
+	return atomic.SwapUint32(&d.dropping, 1) == 0
+}
+
+// skip returns whether a RTP packet must be discarded.
+func (d *writerDropper) skip(payload []byte) bool {
+	if atomic.LoadUint32(&d.dropping) == 0 {
+		return false
+	}
+
+	if len(payload) < 2 {
+		return true
+	}
+
+	isKeyframe := d.isKeyframe[payload[1]&0x7F]
+	if isKeyframe != nil {
+		var pkt rtp.Packet
+		err := pkt.Unmarshal(payload)
+		if err != nil || !isKeyframe(&pkt) {
+			return true
+		}
+	}
+
+	atomic.StoreUint32(&d.dropping, 0)
+	return false
 }